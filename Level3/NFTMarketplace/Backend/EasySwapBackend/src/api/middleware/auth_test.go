@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/auth"
+)
+
+const testAuthSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestKvStore(t *testing.T) (*xkv.Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return xkv.NewStore(cache.CacheConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}}), mr
+}
+
+func newTestAuth(t *testing.T) (*auth.Manager, *auth.Signer) {
+	kv, _ := newTestKvStore(t)
+	signer, err := auth.NewSigner([]auth.Key{{ID: "k1", Secret: testAuthSecret}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth.NewManager(kv, signer, 0, 0), signer
+}
+
+// serveAuth 使用中间件处理一个请求，返回响应和处理函数看到的地址
+func serveAuth(t *testing.T, handler gin.HandlerFunc, authorization string) (*httptest.ResponseRecorder, []string, bool) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(w)
+
+	var addrs []string
+	var called bool
+	r.GET("/", handler, func(c *gin.Context) {
+		called = true
+		addrs, _ = GetAuthUserAddress(c)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	r.ServeHTTP(w, req)
+	return w, addrs, called
+}
+
+func responseCode(t *testing.T, w *httptest.ResponseRecorder) uint32 {
+	var resp xhttp.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected response %s: %v", w.Body.String(), err)
+	}
+	return resp.Code
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	m, signer := newTestAuth(t)
+	first, err := m.Login("0xAAA", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Login("0xbbb", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := m.Login("0xccc", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke("0xccc", revoked.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	expired, err := signer.Sign(auth.Claims{Subject: "0xaaa", SessionID: first.SessionID, IssuedAt: now.Add(-time.Hour).Unix(), ExpiresAt: now.Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		// 0 表示请求被放行
+		requireCode  uint32
+		optionalCode uint32
+		wantAddrs    []string
+	}{
+		{name: "no header", requireCode: 10003},
+		{name: "not bearer", authorization: "Basic " + first.AccessToken, requireCode: 10003, optionalCode: 10003},
+		{name: "valid", authorization: "Bearer " + first.AccessToken, wantAddrs: []string{"0xaaa"}},
+		{name: "multiple wallets", authorization: "Bearer " + first.AccessToken + ", " + second.AccessToken, wantAddrs: []string{"0xaaa", "0xbbb"}},
+		{name: "invalid", authorization: "Bearer not-a-token", requireCode: 10003, optionalCode: 10003},
+		{name: "one invalid of many", authorization: "Bearer " + first.AccessToken + ",bad", requireCode: 10003, optionalCode: 10003},
+		{name: "expired", authorization: "Bearer " + expired, requireCode: 10004, optionalCode: 10004},
+		{name: "revoked session", authorization: "Bearer " + revoked.AccessToken, requireCode: 10004, optionalCode: 10004},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mw := range []struct {
+				name     string
+				handler  gin.HandlerFunc
+				wantCode uint32
+			}{
+				{name: "require", handler: RequireAuth(m), wantCode: tt.requireCode},
+				{name: "optional", handler: OptionalAuth(m), wantCode: tt.optionalCode},
+			} {
+				w, addrs, called := serveAuth(t, mw.handler, tt.authorization)
+				if mw.wantCode != 0 {
+					if called || w.Code != http.StatusUnauthorized || responseCode(t, w) != mw.wantCode {
+						t.Fatalf("%s: expected 401 with code %d, got %d %s", mw.name, mw.wantCode, w.Code, w.Body.String())
+					}
+					continue
+				}
+				if !called || w.Code != http.StatusOK {
+					t.Fatalf("%s: expected request to pass, got %d %s", mw.name, w.Code, w.Body.String())
+				}
+				if len(addrs) != len(tt.wantAddrs) {
+					t.Fatalf("%s: addrs = %v, want %v", mw.name, addrs, tt.wantAddrs)
+				}
+				for i := range addrs {
+					if addrs[i] != tt.wantAddrs[i] {
+						t.Fatalf("%s: addrs = %v, want %v", mw.name, addrs, tt.wantAddrs)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	m, _ := newTestAuth(t)
+	admin, err := m.Login("0xaaa", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := m.Login("0xbbb", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.POST("/import", RequireAuth(m), RequireAdmin([]string{"0xAAA"}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/import", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+	if w := serve("Bearer " + user.AccessToken); w.Code != http.StatusForbidden || responseCode(t, w) != 10005 {
+		t.Fatalf("expected 403 for non admin, got %d %s", w.Code, w.Body.String())
+	}
+	// 管理员地址按小写比较，多个钱包中有一个是管理员即可
+	if w := serve("Bearer " + user.AccessToken + "," + admin.AccessToken); w.Code != http.StatusOK {
+		t.Fatalf("expected admin request to pass, got %d %s", w.Code, w.Body.String())
+	}
+}
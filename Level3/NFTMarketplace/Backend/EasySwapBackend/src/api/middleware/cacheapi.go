@@ -9,83 +9,203 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zeromicro/go-zero/core/metric"
+	"github.com/zeromicro/go-zero/core/syncx"
+	"go.uber.org/zap"
 
+	"github.com/ProjectsTask/EasySwapBase/apicache"
 	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 )
 
-const CacheApiPrefix = "apicache:"
+const (
+	CacheApiPrefix = "apicache:"
+
+	// cacheTagPrefix 标签下登记的缓存键（集合），收到失效消息时删除集合中的缓存键
+	cacheTagPrefix = CacheApiPrefix + "tag:"
+	// cacheRefreshSuffix 过期缓存的刷新锁，同一时间只有一个请求重新生成响应
+	cacheRefreshSuffix = ":refresh"
+	// cacheRefreshLockSeconds 刷新锁的过期时间，生成响应失败时锁过期后由下一个请求重试
+	cacheRefreshLockSeconds = 10
+
+	// cacheTagsKey 处理函数声明的缓存标签在 gin.Context 中的键
+	cacheTagsKey = "apicache_tags"
+)
+
+var (
+	// cacheRequests 缓存中间件处理的请求数量，
+	// result 为 hit(新鲜缓存) / stale(返回过期缓存) / revalidate(过期后重新生成) / miss(未命中) / shared(等待其他请求的结果)
+	cacheRequests = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: "apicache",
+		Subsystem: "requests",
+		Name:      "total",
+		Help:      "api cache requests by result.",
+		Labels:    []string{"route", "result"},
+	})
+
+	// cacheFlight 同一进程内相同缓存键的未命中请求只生成一次响应
+	cacheFlight = syncx.NewSingleFlight()
+)
 
 type responseCache struct {
 	Status int
 	Header http.Header
 	Data   []byte
+	// FreshUntil 缓存保持新鲜的截止时间(秒)，之后到缓存过期前返回过期缓存并重新生成
+	FreshUntil int64
+	// Tags 响应涉及的数据标签
+	Tags []string
+}
+
+// AddCacheTags 处理函数声明响应涉及的数据标签（见 apicache.CollectionTag 等），
+// 响应缓存后登记在这些标签下，同步服务发布对应标签的失效消息时删除缓存
+func AddCacheTags(c *gin.Context, tags ...string) {
+	c.Set(cacheTagsKey, append(c.GetStringSlice(cacheTagsKey), tags...))
 }
 
 // CacheApi 是一个缓存中间件函数,用于缓存API响应数据
 // 主要功能包括:
-// 1. 接收一个 xkv.Store 存储实例和过期时间作为参数
-// 2. 检查请求是否有缓存,如果有且状态码为200则直接返回缓存数据
-// 3. 如果没有缓存,则继续处理请求
-// 4. 请求处理完成后,如果响应状态码为200,则将响应数据缓存起来
-func CacheApi(store *xkv.Store, expireSeconds int) gin.HandlerFunc {
+// 1. 接收一个 xkv.Store 存储实例、新鲜时间和过期后可继续使用的时间作为参数
+// 2. 缓存新鲜时直接返回缓存数据
+// 3. 缓存过期但未超过 staleSeconds 时，抢到刷新锁的请求重新生成响应，其余请求直接返回过期缓存
+// 4. 没有缓存时，同一进程内相同请求只有一个继续处理，其余请求等待并共享它的响应
+// 5. 请求处理完成后,如果响应状态码为200,则将响应数据缓存起来，并登记在处理函数声明的标签下，
+// 数据变化时由 CacheInvalidator 按标签删除
+func CacheApi(store *xkv.Store, freshSeconds, staleSeconds int) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var data xhttp.Response
-		// 创建响应体写入器用于获取响应内容
-		bodyLogWriter := &BodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = bodyLogWriter
-
 		// 生成缓存key
 		cacheKey := CreateKey(c)
 		if cacheKey == "" {
 			xhttp.Error(c, errcode.NewCustomErr("cache error:no cache"))
 			c.Abort()
+			return
 		}
+		route := c.FullPath()
+		result := "miss"
 
 		// 尝试获取缓存数据
-		cacheData, err := (*store).Get(cacheKey)
-		if err == nil && cacheData != "" {
-			cache := unserialize(cacheData)
-			if cache != nil {
-				// 如果有缓存,则直接返回缓存的响应
-				bodyLogWriter.ResponseWriter.WriteHeader(cache.Status)
-				for k, vals := range cache.Header {
-					for _, v := range vals {
-						bodyLogWriter.ResponseWriter.Header().Set(k, v)
-					}
+		if cacheData, err := store.Get(cacheKey); err == nil && cacheData != "" {
+			if cache := unserialize(cacheData); cache != nil && cacheable(cache.Data) {
+				if time.Now().Unix() < cache.FreshUntil {
+					cacheRequests.Inc(route, "hit")
+					writeCache(c, cache)
+					return
 				}
-
-				if err := json.Unmarshal(cache.Data, &data); err == nil {
-					if data.Code == http.StatusOK {
-						bodyLogWriter.ResponseWriter.Write(cache.Data)
-						c.Abort()
-					}
+				// 缓存已过期，其他请求正在重新生成时直接返回过期缓存
+				if ok, err := store.SetnxEx(cacheKey+cacheRefreshSuffix, "1", cacheRefreshLockSeconds); err != nil || !ok {
+					cacheRequests.Inc(route, "stale")
+					writeCache(c, cache)
+					return
 				}
+				result = "revalidate"
+				defer store.Del(cacheKey + cacheRefreshSuffix)
 			}
 		}
 
-		// 继续处理请求
+		val, fresh, _ := cacheFlight.DoEx(cacheKey, func() (interface{}, error) {
+			return generate(c, store, cacheKey, freshSeconds, staleSeconds), nil
+		})
+		if fresh {
+			cacheRequests.Inc(route, result)
+			return
+		}
+
+		// 等待其他请求生成的响应，生成失败或未缓存时自己处理请求
+		if cache, ok := val.(*responseCache); ok && cache != nil {
+			cacheRequests.Inc(route, "shared")
+			writeCache(c, cache)
+			return
+		}
 		c.Next()
+	}
+}
 
-		// 获取响应数据
-		responseBody := bodyLogWriter.body.Bytes()
+// generate 继续处理请求并缓存状态码为200的响应，返回可以共享给其他请求的响应，不可缓存时返回 nil。
+// 处理期间发布了响应标签的失效消息时不写入缓存
+func generate(c *gin.Context, store *xkv.Store, cacheKey string, freshSeconds, staleSeconds int) *responseCache {
+	// 创建响应体写入器用于获取响应内容
+	bodyLogWriter := &BodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+	c.Writer = bodyLogWriter
 
-		// 如果响应状态码为200,则缓存响应数据
-		if err := json.Unmarshal(responseBody, &data); err == nil {
-			if data.Code == http.StatusOK {
-				storeCache := responseCache{
-					Header: bodyLogWriter.Header().Clone(),
-					Status: bodyLogWriter.ResponseWriter.Status(),
-					Data:   responseBody,
-				}
-				store.SetnxEx(cacheKey, serialize(storeCache), expireSeconds)
-			}
+	// 记录处理前失效消息的位置，处理期间发布的失效消息可能在缓存登记到标签之前就被消费，
+	// 写入缓存前检查这段时间内的消息，避免旧数据一直缓存到过期
+	invalidateAfter, latestErr := apicache.Latest(store)
+	if latestErr != nil {
+		xzap.WithContext(c).Error("failed on get latest cache invalidate message", zap.Error(latestErr))
+	}
+
+	// 继续处理请求
+	c.Next()
+
+	// 获取响应数据
+	responseBody := bodyLogWriter.body.Bytes()
+	if !cacheable(responseBody) {
+		return nil
+	}
+
+	// 如果响应状态码为200,则缓存响应数据
+	cache := &responseCache{
+		Header:     bodyLogWriter.Header().Clone(),
+		Status:     bodyLogWriter.ResponseWriter.Status(),
+		Data:       responseBody,
+		FreshUntil: time.Now().Unix() + int64(freshSeconds),
+		Tags:       c.GetStringSlice(cacheTagsKey),
+	}
+	// 无法确定处理期间是否有数据变化时不写入缓存，只共享给等待的请求
+	if latestErr != nil {
+		return cache
+	}
+	if invalidated, err := invalidatedSince(store, invalidateAfter, cache.Tags); err != nil || invalidated {
+		if err != nil {
+			xzap.WithContext(c).Error("failed on check cache invalidate messages", zap.String("key", cacheKey), zap.Error(err))
 		}
+		return cache
+	}
+	expire := freshSeconds + staleSeconds
+	if err := store.Setex(cacheKey, serialize(*cache), expire); err != nil {
+		xzap.WithContext(c).Error("failed on set api cache", zap.String("key", cacheKey), zap.Error(err))
+		return cache
+	}
+	// 登记到标签下，标签集合与缓存同时过期
+	for _, tag := range cache.Tags {
+		tagKey := cacheTagPrefix + tag
+		if _, err := store.Sadd(tagKey, cacheKey); err != nil {
+			xzap.WithContext(c).Error("failed on tag api cache", zap.String("tag", tag), zap.Error(err))
+			continue
+		}
+		_ = store.Expire(tagKey, expire)
+	}
+	// 检查之后、登记标签之前发布的失效消息可能已经被消费，登记后再检查一次
+	if invalidated, err := invalidatedSince(store, invalidateAfter, cache.Tags); err != nil || invalidated {
+		_, _ = store.Del(cacheKey)
+	}
+	return cache
+}
 
+// cacheable 只缓存业务状态码为200的响应
+func cacheable(body []byte) bool {
+	var data xhttp.Response
+	if err := json.Unmarshal(body, &data); err != nil {
+		return false
+	}
+	return data.Code == http.StatusOK
+}
+
+// writeCache 返回缓存的响应并结束处理
+func writeCache(c *gin.Context, cache *responseCache) {
+	for k, vals := range cache.Header {
+		for _, v := range vals {
+			c.Writer.Header().Set(k, v)
+		}
 	}
+	c.Writer.WriteHeader(cache.Status)
+	c.Writer.Write(cache.Data)
+	c.Abort()
 }
 
 // CreateKey 生成缓存的key
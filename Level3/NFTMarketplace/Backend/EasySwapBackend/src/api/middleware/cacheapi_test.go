@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+)
+
+const testCacheKey = CacheApiPrefix + "/cached,"
+
+var testCacheTag = apicache.CollectionTag("sepolia", "0x5fbdb2315678afecb367f032d93f642f64180aa3")
+
+// newCacheRouter 创建使用缓存中间件的路由，handler 返回处理次数
+func newCacheRouter(store *xkv.Store, freshSeconds, staleSeconds int, handler func(c *gin.Context, calls int32)) (*gin.Engine, *int32) {
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	var calls int32
+	r.GET("/cached", CacheApi(store, freshSeconds, staleSeconds), func(c *gin.Context) {
+		handler(c, atomic.AddInt32(&calls, 1))
+	})
+	return r, &calls
+}
+
+func serveCache(r *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cached", nil))
+	return w
+}
+
+// okWithTag 返回处理次数并声明缓存标签
+func okWithTag(c *gin.Context, calls int32) {
+	AddCacheTags(c, testCacheTag)
+	xhttp.OkJson(c, calls)
+}
+
+func TestCacheApiHit(t *testing.T) {
+	store, mr := newTestKvStore(t)
+	r, calls := newCacheRouter(store, 60, 300, okWithTag)
+
+	first := serveCache(r)
+	if *calls != 1 || responseCode(t, first) != errcode.CodeOK {
+		t.Fatalf("unexpected response %s", first.Body.String())
+	}
+	// 缓存在新鲜时间和过期后可继续使用的时间之后过期，并登记在处理函数声明的标签下
+	if ttl := mr.TTL(testCacheKey); ttl != 360*time.Second {
+		t.Fatalf("unexpected cache ttl %v", ttl)
+	}
+	if ok, _ := mr.SIsMember(cacheTagPrefix+testCacheTag, testCacheKey); !ok {
+		t.Fatal("expect cache key tagged")
+	}
+	if ttl := mr.TTL(cacheTagPrefix + testCacheTag); ttl != 360*time.Second {
+		t.Fatalf("unexpected tag ttl %v", ttl)
+	}
+
+	second := serveCache(r)
+	if *calls != 1 || second.Body.String() != first.Body.String() || second.Code != http.StatusOK {
+		t.Fatalf("expect cached response, got %s", second.Body.String())
+	}
+}
+
+func TestCacheApiNotCacheable(t *testing.T) {
+	store, mr := newTestKvStore(t)
+	r, calls := newCacheRouter(store, 60, 300, func(c *gin.Context, _ int32) {
+		AddCacheTags(c, testCacheTag)
+		xhttp.Error(c, errcode.ErrTokenExpire)
+	})
+
+	serveCache(r)
+	w := serveCache(r)
+	if *calls != 2 || responseCode(t, w) != errcode.ErrTokenExpire.Code() {
+		t.Fatalf("expect error response not cached, calls %d, got %s", *calls, w.Body.String())
+	}
+	if mr.Exists(testCacheKey) || mr.Exists(cacheTagPrefix+testCacheTag) {
+		t.Fatal("expect no cache")
+	}
+}
+
+func TestCacheApiStaleWhileRevalidate(t *testing.T) {
+	store, mr := newTestKvStore(t)
+	// 新鲜时间为 0，缓存写入后立即过期但仍可以返回
+	r, calls := newCacheRouter(store, 0, 300, okWithTag)
+	first := serveCache(r)
+
+	// 其他请求持有刷新锁时直接返回过期缓存
+	if err := mr.Set(testCacheKey+cacheRefreshSuffix, "1"); err != nil {
+		t.Fatal(err)
+	}
+	stale := serveCache(r)
+	if *calls != 1 || stale.Body.String() != first.Body.String() {
+		t.Fatalf("expect stale response, calls %d, got %s", *calls, stale.Body.String())
+	}
+
+	// 抢到刷新锁的请求重新生成响应，完成后释放锁
+	mr.Del(testCacheKey + cacheRefreshSuffix)
+	fresh := serveCache(r)
+	if *calls != 2 || fresh.Body.String() == first.Body.String() {
+		t.Fatalf("expect revalidated response, calls %d, got %s", *calls, fresh.Body.String())
+	}
+	if mr.Exists(testCacheKey + cacheRefreshSuffix) {
+		t.Fatal("expect refresh lock released")
+	}
+	raw, _ := mr.Get(testCacheKey)
+	if cached := unserialize(raw); cached == nil || string(cached.Data) != fresh.Body.String() {
+		t.Fatalf("expect revalidated response cached, got %+v", cached)
+	}
+}
+
+func TestCacheApiSingleFlight(t *testing.T) {
+	store, _ := newTestKvStore(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	// 新鲜时间为 0，没有共享结果的请求会重新生成响应
+	r, calls := newCacheRouter(store, 0, 300, func(c *gin.Context, n int32) {
+		if n == 1 {
+			close(started)
+			<-release
+		}
+		okWithTag(c, n)
+	})
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		responses[0] = serveCache(r)
+	}()
+	<-started
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		responses[1] = serveCache(r)
+	}()
+	// 等待第二个请求进入 single flight
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if *calls != 1 {
+		t.Fatalf("expect handler called once, got %d", *calls)
+	}
+	if responses[1].Code != http.StatusOK || responses[1].Body.String() != responses[0].Body.String() {
+		t.Fatalf("expect shared response, got %s and %s", responses[0].Body.String(), responses[1].Body.String())
+	}
+}
+
+func TestCacheApiSkipInvalidated(t *testing.T) {
+	store, mr := newTestKvStore(t)
+	// 处理前发布的失效消息不影响缓存
+	if err := apicache.Publish(store, testCacheTag); err != nil {
+		t.Fatal(err)
+	}
+	var publish string
+	r, calls := newCacheRouter(store, 60, 300, func(c *gin.Context, n int32) {
+		if err := apicache.Publish(store, publish); err != nil {
+			t.Error(err)
+		}
+		okWithTag(c, n)
+	})
+
+	// 处理期间发布了响应标签的失效消息，响应可能是旧数据，不写入缓存
+	publish = testCacheTag
+	w := serveCache(r)
+	if responseCode(t, w) != errcode.CodeOK {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	if mr.Exists(testCacheKey) || mr.Exists(cacheTagPrefix+testCacheTag) {
+		t.Fatal("expect invalidated response not cached")
+	}
+
+	// 其他标签的失效消息不影响缓存
+	publish = apicache.RankingTag("sepolia")
+	serveCache(r)
+	serveCache(r)
+	if *calls != 2 || !mr.Exists(testCacheKey) {
+		t.Fatalf("expect response cached, calls %d", *calls)
+	}
+}
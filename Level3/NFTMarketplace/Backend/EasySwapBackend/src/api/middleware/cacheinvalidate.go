@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/zeromicro/go-zero/core/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	// invalidatePollInterval 没有新的失效消息时的轮询间隔
+	invalidatePollInterval = time.Second
+	// invalidateBatchSize 每次读取的失效消息数量
+	invalidateBatchSize = 500
+)
+
+// cacheEvictions 按标签删除的缓存数量，kind 为标签类型(collection / item / ranking)
+var cacheEvictions = metric.NewCounterVec(&metric.CounterVecOpts{
+	Namespace: "apicache",
+	Subsystem: "evictions",
+	Name:      "total",
+	Help:      "api cache entries evicted by invalidation tags.",
+	Labels:    []string{"kind"},
+})
+
+// CacheInvalidator 读取同步服务发布的缓存失效消息，删除登记在消息标签下的 API 缓存。
+// 每个后端实例从启动时最新的消息之后开始读取，启动前的缓存最多在新鲜时间后过期。
+type CacheInvalidator struct {
+	store *xkv.Store
+}
+
+// NewCacheInvalidator 创建缓存失效消息的消费者
+func NewCacheInvalidator(store *xkv.Store) *CacheInvalidator {
+	return &CacheInvalidator{store: store}
+}
+
+// Start 在后台读取失效消息直到 ctx 结束
+func (i *CacheInvalidator) Start(ctx context.Context) {
+	go i.run(ctx)
+}
+
+func (i *CacheInvalidator) run(ctx context.Context) {
+	last, err := apicache.Latest(i.store)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get latest cache invalidate message", zap.Error(err))
+	}
+	xzap.WithContext(ctx).Info("api cache invalidator started", zap.String("after", last))
+
+	for {
+		var full bool
+		last, full = i.poll(ctx, last)
+		if full {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(invalidatePollInterval):
+		}
+	}
+}
+
+// poll 处理 last 之后的一批失效消息，返回新的读取位置和是否读满了一批
+func (i *CacheInvalidator) poll(ctx context.Context, last string) (string, bool) {
+	messages, err := apicache.ReadAfter(i.store, last, invalidateBatchSize)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on read cache invalidate messages", zap.Error(err))
+		return last, false
+	}
+	for _, message := range messages {
+		i.evict(ctx, message.Tags)
+		last = message.ID
+	}
+	return last, len(messages) == invalidateBatchSize
+}
+
+// evict 删除登记在标签下的缓存和标签本身，删除失败的缓存在新鲜时间后过期
+func (i *CacheInvalidator) evict(ctx context.Context, tags []string) {
+	for _, tag := range tags {
+		tagKey := cacheTagPrefix + tag
+		keys, err := i.store.Smembers(tagKey)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on get tagged api cache", zap.String("tag", tag), zap.Error(err))
+			continue
+		}
+		if len(keys) > 0 {
+			deleted, err := i.store.Del(keys...)
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on evict tagged api cache", zap.String("tag", tag), zap.Error(err))
+				continue
+			}
+			cacheEvictions.Add(float64(deleted), apicache.TagKind(tag))
+		}
+		if _, err := i.store.Del(tagKey); err != nil {
+			xzap.WithContext(ctx).Error("failed on delete api cache tag", zap.String("tag", tag), zap.Error(err))
+		}
+	}
+}
+
+// invalidatedSince 检查 after 之后是否发布了包含 tags 中任一标签的失效消息
+func invalidatedSince(store *xkv.Store, after string, tags []string) (bool, error) {
+	if len(tags) == 0 {
+		return false, nil
+	}
+	wanted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+	for {
+		messages, err := apicache.ReadAfter(store, after, invalidateBatchSize)
+		if err != nil {
+			return false, err
+		}
+		for _, message := range messages {
+			for _, tag := range message.Tags {
+				if wanted[tag] {
+					return true, nil
+				}
+			}
+			after = message.ID
+		}
+		if len(messages) < invalidateBatchSize {
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+var testLogCtx = xzap.ToContext(context.Background(), zap.NewNop())
+
+// tagCache 写入缓存并登记在标签下
+func tagCache(t *testing.T, store *xkv.Store, tag string, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := store.Setex(key, "cached", 60); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Sadd(cacheTagPrefix+tag, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCacheInvalidatorEvict(t *testing.T) {
+	store, mr := newTestKvStore(t)
+	i := NewCacheInvalidator(store)
+	rankingTag := apicache.RankingTag("sepolia")
+	tagCache(t, store, testCacheTag, CacheApiPrefix+"a", CacheApiPrefix+"b")
+	tagCache(t, store, rankingTag, CacheApiPrefix+"c")
+
+	i.evict(testLogCtx, []string{testCacheTag, apicache.ItemTag("sepolia", "0x01", "1")})
+	for _, key := range []string{CacheApiPrefix + "a", CacheApiPrefix + "b", cacheTagPrefix + testCacheTag} {
+		if mr.Exists(key) {
+			t.Fatalf("expect %s evicted", key)
+		}
+	}
+	if !mr.Exists(CacheApiPrefix+"c") || !mr.Exists(cacheTagPrefix+rankingTag) {
+		t.Fatal("expect other tags kept")
+	}
+}
+
+func TestCacheInvalidatorPoll(t *testing.T) {
+	store, mr := newTestKvStore(t)
+	i := NewCacheInvalidator(store)
+	key := CacheApiPrefix + "a"
+
+	// 从启动时最新的消息之后开始读取，之前的消息不处理
+	if err := apicache.Publish(store, testCacheTag); err != nil {
+		t.Fatal(err)
+	}
+	start, err := apicache.Latest(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagCache(t, store, testCacheTag, key)
+	last, full := i.poll(testLogCtx, start)
+	if last != start || full || !mr.Exists(key) {
+		t.Fatalf("expect no eviction, last %s full %v", last, full)
+	}
+
+	if err := apicache.Publish(store, testCacheTag); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := apicache.Latest(store)
+	last, full = i.poll(testLogCtx, last)
+	if last != latest || full || mr.Exists(key) {
+		t.Fatalf("expect evicted and cursor advanced to %s, last %s full %v", latest, last, full)
+	}
+
+	// 读取位置推进后，已经处理过的消息不会再次删除重新生成的缓存
+	tagCache(t, store, testCacheTag, key)
+	if last, _ = i.poll(testLogCtx, last); last != latest || !mr.Exists(key) {
+		t.Fatalf("expect cache kept, last %s", last)
+	}
+
+	// 读满一批时返回 full，由调用方立即读取下一批
+	for n := 0; n <= invalidateBatchSize; n++ {
+		if err := apicache.Publish(store, apicache.RankingTag("sepolia")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if last, full = i.poll(testLogCtx, last); !full {
+		t.Fatal("expect full batch")
+	}
+	latest, _ = apicache.Latest(store)
+	if last, full = i.poll(testLogCtx, last); full || last != latest {
+		t.Fatalf("expect caught up to %s, last %s full %v", latest, last, full)
+	}
+}
@@ -80,7 +80,6 @@ func RLog() gin.HandlerFunc {
 				zap.String("query", query),
 				zap.String("ip", c.ClientIP()),
 				zap.String("user-agent", c.Request.UserAgent()),
-				zap.String("token", c.Request.Header.Get("session_id")),
 				zap.String("content-type", c.Request.Header.Get("Content-Type")),
 				zap.Float64("latency", latency),
 				zap.String("request", string(requestBody)),
@@ -22,6 +22,12 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 		user.GET("/:address/login-message", v1.GetLoginMessageHandler(svcCtx))
 		// 登陆
 		user.POST("/login", v1.UserLoginHandler(svcCtx))
+		// 刷新令牌
+		user.POST("/refresh", v1.RefreshTokenHandler(svcCtx))
+		// 注销会话
+		user.POST("/logout", middleware.RequireAuth(svcCtx.Auth), v1.UserLogoutHandler(svcCtx))
+		// 获取用户的登录会话
+		user.GET("/sessions", middleware.RequireAuth(svcCtx.Auth), v1.UserSessionsHandler(svcCtx))
 		// 获取用户签名状态
 		user.GET("/:address/sig-status", v1.GetSigStatusHandler(svcCtx))
 	}
@@ -34,6 +40,8 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 		collections.GET("/:address", v1.CollectionDetailHandler(svcCtx))
 		// 指定Collection的bids信息
 		collections.GET("/:address/bids", v1.CollectionBidsHandler(svcCtx))
+		// 获取NFT集合的挂单和集合出价深度
+		collections.GET("/:address/depth", v1.CollectionDepthHandler(svcCtx))
 		// 指定Item的bid信息
 		collections.GET("/:address/:token_id/bids", v1.CollectionItemBidsHandler(svcCtx))
 		// 指定Collection的items信息
@@ -46,16 +54,26 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 		// 获取NFT Item的Trait的最高价格信息
 		collections.GET("/:address/top-trait", v1.ItemTopTraitPriceHandler(svcCtx))
 		// 获取NFT Item的图片信息，使用缓存中间件，缓存时间为60秒
-		collections.GET("/:address/:token_id/image", middleware.CacheApi(svcCtx.KvStore, 60), v1.GetItemImageHandler(svcCtx))
+		collections.GET("/:address/:token_id/image", middleware.CacheApi(svcCtx.KvStore, 60, 300), v1.GetItemImageHandler(svcCtx))
 		// NFT销售历史价格信息
 		collections.GET("/:address/history-sales", v1.HistorySalesHandler(svcCtx))
+		// NFT集合的成交价K线和地板价序列，使用缓存中间件，缓存时间为60秒
+		collections.GET("/:address/candles", middleware.CacheApi(svcCtx.KvStore, 60, 300), v1.CollectionCandlesHandler(svcCtx))
 		// 获取NFT Item的owner信息
 		collections.GET("/:address/:token_id/owner", v1.ItemOwnerHandler(svcCtx))
+		// 获取ERC-1155 NFT Item的持有人列表
+		collections.GET("/:address/:token_id/holders", v1.ItemHoldersHandler(svcCtx))
 		// 刷新NFT Item的metadata
 		collections.POST("/:address/:token_id/metadata", v1.ItemMetadataRefreshHandler(svcCtx))
 
 		// 获取NFT集合排名信息，使用缓存中间件，缓存时间为60秒
-		collections.GET("/ranking", middleware.CacheApi(svcCtx.KvStore, 60), v1.TopRankingHandler(svcCtx))
+		collections.GET("/ranking", middleware.CacheApi(svcCtx.KvStore, 60, 300), v1.TopRankingHandler(svcCtx))
+
+		// 导入集合，只有管理员可以提交，避免任意用户大量提交导入任务阻塞导入队列
+		collections.POST("/import", middleware.RequireAuth(svcCtx.Auth), middleware.RequireAdmin(svcCtx.C.Auth.Admins),
+			v1.CollectionImportHandler(svcCtx))
+		// 获取集合导入任务的进度
+		collections.GET("/import/:address", v1.CollectionImportStatusHandler(svcCtx))
 	}
 
 	// 创建一个名为 /activities 的子路由组
@@ -65,8 +83,8 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 		activities.GET("", v1.ActivityMultiChainHandler(svcCtx))
 	}
 
-	// 创建一个名为 /portfolio 的子路由组
-	portfolio := apiV1.Group("/portfolio")
+	// 创建一个名为 /portfolio 的子路由组，只能查询已证明拥有的地址
+	portfolio := apiV1.Group("/portfolio", middleware.RequireAuth(svcCtx.Auth))
 	{
 		// 获取用户拥有Collection信息
 		portfolio.GET("/collections", v1.UserMultiChainCollectionsHandler(svcCtx))
@@ -83,5 +101,17 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 	{
 		// 批量查询出价信息
 		orders.GET("", v1.OrderInfosHandler(svcCtx))
+		// 查询订单在链上处理失败的记录
+		orders.GET("/failures", v1.OrderFailuresHandler(svcCtx))
+	}
+
+	// 实时推送的 WebSocket 连接，握手时携带令牌可以订阅用户主题
+	apiV1.GET("/feed", middleware.OptionalAuth(svcCtx.Auth), v1.FeedHandler(svcCtx))
+
+	// 创建一个名为 /protocol 的子路由组
+	protocol := apiV1.Group("/protocol")
+	{
+		// 查询订单簿合约的全局状态（是否暂停、手续费比例等）
+		protocol.GET("/state", v1.ProtocolStateHandler(svcCtx))
 	}
 }
@@ -6,7 +6,10 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -35,10 +38,21 @@ func ActivityMultiChainHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			return
 		}
 
+		if filter.StartTime < 0 || filter.EndTime < 0 ||
+			(filter.StartTime > 0 && filter.EndTime > 0 && filter.StartTime > filter.EndTime) {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
 		// 指定链ID,只查询指定链上的活动
 		var chainName []string
 		for _, id := range filter.ChainID {
-			chainName = append(chainName, chainIDToChain[id])
+			chain, ok := chainIDToChain[id]
+			if !ok {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+			chainName = append(chainName, chain)
 		}
 
 		res, err := service.GetMultiChainActivities(
@@ -46,14 +60,23 @@ func ActivityMultiChainHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			svcCtx,
 			filter.ChainID,
 			chainName,
-			filter.CollectionAddresses,
-			filter.TokenID,
-			filter.UserAddresses,
-			filter.EventTypes,
+			dao.ActivityFilter{
+				CollectionAddrs: filter.CollectionAddresses,
+				TokenID:         filter.TokenID,
+				UserAddrs:       filter.UserAddresses,
+				EventTypes:      dao.ActivityEventTypeIDs(filter.EventTypes),
+				StartTime:       filter.StartTime,
+				EndTime:         filter.EndTime,
+			},
 			filter.Page,
 			filter.PageSize,
+			filter.CursorParams,
 		)
 		if err != nil {
+			if errors.Is(err, cursor.ErrInvalidCursor) {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
 			xhttp.Error(c, errcode.NewCustomErr("Get multi-chain activities failed."))
 			return
 		}
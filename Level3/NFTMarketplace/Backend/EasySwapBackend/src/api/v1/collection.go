@@ -3,14 +3,22 @@ package v1
 import (
 	"encoding/json"
 	"strconv"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -65,10 +73,22 @@ func CollectionItemsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			return
 		}
 
+		// 检查稀有度排名范围
+		if filter.RarityMin < 0 || filter.RarityMax < 0 ||
+			(filter.RarityMax > 0 && filter.RarityMin > filter.RarityMax) {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
 		// 调用服务层的 GetItems 函数获取集合中项目的信息
 		res, err := service.GetItems(c.Request.Context(), svcCtx, chain, filter, collectionAddr)
 		// 检查是否发生错误
 		if err != nil {
+			// 游标无效，返回参数错误
+			if errors.Is(err, cursor.ErrInvalidCursor) {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
 			// 如果发生错误，返回意外错误的响应
 			xhttp.Error(c, errcode.ErrUnexpected)
 			// 结束处理
@@ -539,6 +559,185 @@ func ItemOwnerHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	}
 }
 
+const (
+	defaultDepthLimit = 50
+	maxDepthLimit     = 200
+)
+
+// CollectionDepthHandler 处理获取集合挂单和集合出价深度的请求。
+// bucket 为合并价格区间的大小（与价格单位相同），不传时按原始价格档位返回；limit 为每一侧最多返回的区间数量。
+func CollectionDepthHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionAddr := c.Params.ByName("address")
+		if collectionAddr == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		bucket := decimal.Zero
+		if raw := c.Query("bucket"); raw != "" {
+			bucket, err = decimal.NewFromString(raw)
+			if err != nil || bucket.IsNegative() {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		limit := defaultDepthLimit
+		if raw := c.Query("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit <= 0 || limit > maxDepthLimit {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+
+		res, err := service.GetCollectionDepth(c.Request.Context(), svcCtx, chain, collectionAddr, bucket, limit)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get collection depth error"))
+			return
+		}
+		xhttp.OkJson(c, struct {
+			Result interface{} `json:"result"`
+		}{
+			Result: res,
+		})
+	}
+}
+
+const (
+	defaultCandleLimit = 300
+	maxCandleLimit     = 1000
+)
+
+// CollectionCandlesHandler 处理获取集合成交价 K 线和地板价序列的请求。
+// interval 为 K 线周期(5m/15m/30m/1h/4h/1d)；from、to 为秒级时间戳，to 默认为当前时间，from 默认取 to 之前 limit 个周期；
+// tz 为 IANA 时区名称，默认 UTC，日线等周期按该时区的 0 点对齐；limit 为单页最多返回的周期数量，超出时用返回的 next_from 翻页。
+func CollectionCandlesHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionAddr := c.Params.ByName("address")
+		if collectionAddr == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		interval := c.Query("interval")
+		intervalSeconds, ok := collectionstats.CandleIntervals[interval]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		limit := defaultCandleLimit
+		if raw := c.Query("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit <= 0 || limit > maxCandleLimit {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		loc := time.UTC
+		if raw := c.Query("tz"); raw != "" {
+			loc, err = time.LoadLocation(raw)
+			if err != nil {
+				xzap.WithContext(c).Error("tz parse error: ", zap.String("tz", raw))
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+
+		to := time.Now().Unix()
+		if raw := c.Query("to"); raw != "" {
+			to, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		from := to - intervalSeconds*int64(limit)
+		if raw := c.Query("from"); raw != "" {
+			from, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		if from < 0 || from >= to {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		// 新的成交和地板价变化时删除缓存
+		middleware.AddCacheTags(c, apicache.CollectionTag(chain, collectionAddr))
+		res, err := service.GetCollectionCandles(c.Request.Context(), svcCtx, chain, collectionAddr, interval, from, to, loc, limit)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get collection candles error"))
+			return
+		}
+		xhttp.OkJson(c, struct {
+			Result interface{} `json:"result"`
+		}{
+			Result: res,
+		})
+	}
+}
+
+// ItemHoldersHandler 处理分页获取 ERC-1155 token 持有人列表的请求。
+// filters 参数包含链ID和分页信息，结果按持有数量降序返回。
+func ItemHoldersHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter types.ItemHolderFilterParams
+		if err := json.Unmarshal([]byte(c.Query("filters")), &filter); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("Filter param is nil."))
+			return
+		}
+		if filter.Page <= 0 || filter.PageSize <= 0 {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		collectionAddr := c.Params.ByName("address")
+		tokenID := c.Params.ByName("token_id")
+		if collectionAddr == "" || tokenID == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[filter.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetItemHolders(c.Request.Context(), svcCtx, chain, collectionAddr, tokenID, filter.Page, filter.PageSize)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get item holders error"))
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
 // GetItemImageHandler 处理获取单个NFT项目图片信息的请求。
 // 它接收一个服务上下文对象 svcCtx，并返回一个 gin.HandlerFunc。
 // 该处理函数会从请求中获取链ID、集合地址和NFT的token ID，验证参数的有效性，
@@ -586,6 +785,9 @@ func GetItemImageHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			return
 		}
 
+		// 图片随元数据刷新变化，缓存登记在 item 标签下
+		middleware.AddCacheTags(c, apicache.ItemTag(chain, collectionAddr, tokenID))
+
 		// 调用服务层的 GetItemImage 函数获取指定NFT项目的图片信息
 		result, err := service.GetItemImage(c.Request.Context(), svcCtx, chain, collectionAddr, tokenID)
 		// 检查是否发生错误
@@ -702,3 +904,58 @@ func CollectionDetailHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 		xhttp.OkJson(c, res)
 	}
 }
+
+// CollectionImportHandler 创建集合导入任务。
+// 同步服务检测合约标准并导入全部 item 后，集合开始出现在市场中，导入进度通过 CollectionImportStatusHandler 查询。
+func CollectionImportHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.CollectionImportReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok || !common.IsHexAddress(req.Address) || req.FromBlock < 0 {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.ImportCollection(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.CommonResp{Result: res})
+	}
+}
+
+// CollectionImportStatusHandler 获取集合最近一次导入任务的进度
+func CollectionImportStatusHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 32)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		collectionAddr := c.Params.ByName("address")
+		if !common.IsHexAddress(collectionAddr) {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetCollectionImport(c.Request.Context(), svcCtx, int(chainID), chain, collectionAddr)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.CommonResp{Result: res})
+	}
+}
@@ -0,0 +1,163 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/auth"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/feed"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const (
+	// feedWriteWait 单条消息的写超时
+	feedWriteWait = 10 * time.Second
+	// feedPongWait 超过这个时间没有收到客户端的消息或 pong 时断开连接
+	feedPongWait = 60 * time.Second
+	// feedPingPeriod 发送 ping 的间隔，必须小于 feedPongWait
+	feedPingPeriod = 50 * time.Second
+	// feedMaxMessageSize 客户端消息的最大长度
+	feedMaxMessageSize = 8192
+)
+
+// 跨域由 CORS 中间件统一放行，这里同样接受所有来源
+var feedUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// FeedHandler 实时推送的 WebSocket 连接，查询参数 chain_id 指定订阅的链。
+// 客户端发送 subscribe / unsubscribe 订阅主题，订阅时带上 last_id 补发断线期间的事件；
+// 用户主题需要先登录：握手时携带 Authorization 头，或者连接后发送 auth 消息。
+func FeedHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID, err := strconv.Atoi(c.Query("chain_id"))
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		chain, ok := chainIDToChain[chainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		client, err := svcCtx.Feed.NewClient(chain)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		conn, err := feedUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// Upgrade 失败时已经返回了错误响应
+			xzap.WithContext(c.Request.Context()).Warn("failed on upgrade feed connection", zap.Error(err))
+			return
+		}
+		for _, claims := range middleware.GetAuthClaims(c) {
+			svcCtx.Feed.Authorize(client, claims.Subject, claims.ExpiresAt)
+		}
+
+		go writeFeed(conn, client)
+		readFeed(svcCtx, conn, client)
+	}
+}
+
+// readFeed 处理客户端发送的消息，连接断开后取消全部订阅
+func readFeed(svcCtx *svc.ServerCtx, conn *websocket.Conn, client *feed.Client) {
+	defer func() {
+		svcCtx.Feed.Remove(client)
+		_ = conn.Close()
+	}()
+
+	conn.SetReadLimit(feedMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(feedPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(feedPongWait))
+	})
+
+	for {
+		var req types.FeedRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(feedPongWait))
+
+		var reply *feed.Message
+		switch req.Op {
+		case types.FeedOpSubscribe:
+			if err := svcCtx.Feed.Subscribe(client, req.Topics, req.LastID); err != nil {
+				reply = &feed.Message{Type: feed.MsgError, Topics: req.Topics, Error: err.Error()}
+			}
+		case types.FeedOpUnsubscribe:
+			svcCtx.Feed.Unsubscribe(client, req.Topics)
+		case types.FeedOpAuth:
+			claims, err := svcCtx.Auth.Authenticate(req.Token)
+			if err != nil {
+				reply = &feed.Message{Type: feed.MsgError, Error: feedAuthError(err)}
+				break
+			}
+			svcCtx.Feed.Authorize(client, claims.Subject, claims.ExpiresAt)
+			reply = &feed.Message{Type: feed.MsgAuthorized, Topics: []string{claims.Subject}}
+		case types.FeedOpPing:
+			reply = &feed.Message{Type: feed.MsgPong}
+		default:
+			reply = &feed.Message{Type: feed.MsgError, Error: "unknown op"}
+		}
+		if reply != nil && !svcCtx.Feed.Reply(client, reply) {
+			return
+		}
+	}
+}
+
+// writeFeed 发送队列中的消息并定时 ping，连接关闭时退出，发送队列写满被断开时通知客户端重连
+func writeFeed(conn *websocket.Conn, client *feed.Client) {
+	ticker := time.NewTicker(feedPingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-client.Send():
+			_ = conn.SetWriteDeadline(time.Now().Add(feedWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-client.Done():
+			if client.Slow() {
+				// 客户端消费太慢，带上最后收到的事件 ID 重连后可以续传
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer"),
+					time.Now().Add(feedWriteWait))
+			}
+			return
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(feedWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// feedAuthError 返回令牌验证失败的原因
+func feedAuthError(err error) string {
+	if errors.Is(err, auth.ErrTokenExpired) || errors.Is(err, auth.ErrSessionRevoked) {
+		return "token expired"
+	}
+	return "invalid token"
+}
@@ -2,11 +2,15 @@ package v1
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -34,6 +38,12 @@ func UserMultiChainCollectionsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			chainNames = append(chainNames, chain.Name)
 		}
 
+		// 只能查询请求携带的令牌对应的地址，未指定时查询这些地址
+		if filter.UserAddresses, err = authorizedAddresses(c, filter.UserAddresses); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
 		res, err := service.GetMultiChainUserCollections(c.Request.Context(), svcCtx, chainIDs, chainNames, filter.UserAddresses)
 		if err != nil {
 			xhttp.Error(c, errcode.NewCustomErr("query user multi chain collections err."))
@@ -83,9 +93,19 @@ func UserMultiChainItemsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			chainNames = append(chainNames, chain)
 		}
 
+		// 只能查询请求携带的令牌对应的地址，未指定时查询这些地址
+		if filter.UserAddresses, err = authorizedAddresses(c, filter.UserAddresses); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
 		// 获取多链用户项目信息
-		res, err := service.GetMultiChainUserItems(c.Request.Context(), svcCtx, filter.ChainID, chainNames, filter.UserAddresses, filter.CollectionAddresses, filter.Page, filter.PageSize)
+		res, err := service.GetMultiChainUserItems(c.Request.Context(), svcCtx, filter.ChainID, chainNames, filter.UserAddresses, filter.CollectionAddresses, filter.Page, filter.PageSize, filter.CursorParams)
 		if err != nil {
+			if errors.Is(err, cursor.ErrInvalidCursor) {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
 			// 查询失败，返回错误
 			xhttp.Error(c, errcode.NewCustomErr("query user multi chain items err."))
 			return
@@ -135,9 +155,19 @@ func UserMultiChainListingsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			chainNames = append(chainNames, chain)
 		}
 
+		// 只能查询请求携带的令牌对应的地址，未指定时查询这些地址
+		if filter.UserAddresses, err = authorizedAddresses(c, filter.UserAddresses); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
 		// 获取多链用户列表
-		res, err := service.GetMultiChainUserListings(c.Request.Context(), svcCtx, filter.ChainID, chainNames, filter.UserAddresses, filter.CollectionAddresses, filter.Page, filter.PageSize)
+		res, err := service.GetMultiChainUserListings(c.Request.Context(), svcCtx, filter.ChainID, chainNames, filter.UserAddresses, filter.CollectionAddresses, filter.Page, filter.PageSize, filter.CursorParams)
 		if err != nil {
+			if errors.Is(err, cursor.ErrInvalidCursor) {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
 			// 如果查询出错，则返回错误
 			xhttp.Error(c, errcode.NewCustomErr("query user multi chain items err."))
 			return
@@ -187,9 +217,19 @@ func UserMultiChainBidsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			chainNames = append(chainNames, chain)
 		}
 
+		// 只能查询请求携带的令牌对应的地址，未指定时查询这些地址
+		if filter.UserAddresses, err = authorizedAddresses(c, filter.UserAddresses); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
 		// 获取用户跨链投标信息
-		res, err := service.GetMultiChainUserBids(c.Request.Context(), svcCtx, filter.ChainID, chainNames, filter.UserAddresses, filter.CollectionAddresses, filter.Page, filter.PageSize)
+		res, err := service.GetMultiChainUserBids(c.Request.Context(), svcCtx, filter.ChainID, chainNames, filter.UserAddresses, filter.CollectionAddresses, filter.Page, filter.PageSize, filter.CursorParams)
 		if err != nil {
+			if errors.Is(err, cursor.ErrInvalidCursor) {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
 			// 如果查询失败，则返回错误
 			xhttp.Error(c, errcode.NewCustomErr("query user multi chain items err."))
 			return
@@ -199,3 +239,25 @@ func UserMultiChainBidsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 		xhttp.OkJson(c, res)
 	}
 }
+
+// authorizedAddresses 校验查询的地址都已经通过登录证明拥有，未指定地址时返回令牌对应的地址
+func authorizedAddresses(c *gin.Context, requested []string) ([]string, error) {
+	addrs, err := middleware.GetAuthUserAddress(c)
+	if err != nil {
+		return nil, errcode.ErrTokenVerify
+	}
+	if len(requested) == 0 {
+		return addrs, nil
+	}
+
+	owned := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		owned[strings.ToLower(addr)] = true
+	}
+	for _, addr := range requested {
+		if !owned[strings.ToLower(addr)] {
+			return nil, errcode.ErrTokenVerify
+		}
+	}
+	return requested, nil
+}
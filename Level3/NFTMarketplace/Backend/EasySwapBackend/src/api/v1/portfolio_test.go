@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/auth"
+)
+
+func TestAuthorizedAddresses(t *testing.T) {
+	mr := miniredis.RunT(t)
+	kv := xkv.NewStore(cache.CacheConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	signer, err := auth.NewSigner([]auth.Key{{ID: "k1", Secret: "0123456789abcdef0123456789abcdef"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := auth.NewManager(kv, signer, 0, 0)
+	first, err := m.Login("0xAAA", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Login("0xbbb", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		tokens    string
+		requested []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "unauthenticated", requested: []string{"0xaaa"}, wantErr: true},
+		{name: "unauthenticated without addresses", wantErr: true},
+		{name: "token addresses by default", tokens: first.AccessToken + "," + second.AccessToken, want: []string{"0xaaa", "0xbbb"}},
+		{name: "owned address", tokens: first.AccessToken, requested: []string{"0xaaa"}, want: []string{"0xaaa"}},
+		{name: "case insensitive", tokens: first.AccessToken, requested: []string{"0xAaA"}, want: []string{"0xAaA"}},
+		{name: "subset of wallets", tokens: first.AccessToken + "," + second.AccessToken, requested: []string{"0xbbb"}, want: []string{"0xbbb"}},
+		{name: "address not owned", tokens: first.AccessToken, requested: []string{"0xaaa", "0xbbb"}, wantErr: true},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var gotErr error
+			_, r := gin.CreateTestContext(httptest.NewRecorder())
+			r.GET("/", middleware.OptionalAuth(m), func(c *gin.Context) {
+				got, gotErr = authorizedAddresses(c, tt.requested)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tokens != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.tokens)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantErr {
+				if gotErr != errcode.ErrTokenVerify {
+					t.Fatalf("authorizedAddresses() err = %v, want token verify error", gotErr)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatal(gotErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("authorizedAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
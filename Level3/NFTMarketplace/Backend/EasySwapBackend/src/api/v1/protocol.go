@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
+)
+
+// ProtocolStateHandler 获取订单簿合约的全局状态（手续费比例、资产托管合约、是否暂停、owner）
+func ProtocolStateHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetProtocolStates(c.Request.Context(), svcCtx, int(chainID), chain)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get protocol state error"))
+			return
+		}
+		xhttp.OkJson(c, struct {
+			Result interface{} `json:"result"`
+		}{Result: res})
+	}
+}
+
+// OrderFailuresHandler 获取订单在链上处理失败（被合约跳过、批量撮合失败）的记录，
+// order_ids 为逗号分隔的订单id
+func OrderFailuresHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		var orderIds []string
+		for _, orderId := range strings.Split(c.Query("order_ids"), ",") {
+			if orderId = strings.TrimSpace(orderId); orderId != "" {
+				orderIds = append(orderIds, strings.ToLower(orderId))
+			}
+		}
+		if len(orderIds) == 0 {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetOrderFailures(c.Request.Context(), svcCtx, chain, orderIds)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get order failures error"))
+			return
+		}
+		xhttp.OkJson(c, struct {
+			Result interface{} `json:"result"`
+		}{Result: res})
+	}
+}
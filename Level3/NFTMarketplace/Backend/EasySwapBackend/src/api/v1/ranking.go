@@ -5,12 +5,15 @@ import (
 	"strconv"
 	"sync"
 
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -29,16 +32,8 @@ func TopRankingHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 		// 获取时间范围参数
 		period := c.Query("range")
 		if period != "" {
-			// 验证时间范围参数是否有效
-			validParams := map[string]bool{
-				"15m": true, // 15分钟
-				"1h":  true, // 1小时
-				"6h":  true, // 6小时
-				"1d":  true, // 1天
-				"7d":  true, // 7天
-				"30d": true, // 30天
-			}
-			if ok := validParams[period]; !ok {
+			// 验证时间范围参数是否有效，支持的时间范围与集合统计的窗口一致(15m/1h/6h/24h/1d/7d/30d)
+			if _, ok := collectionstats.PeriodSeconds[period]; !ok {
 				xzap.WithContext(c).Error("range parse error: ", zap.String("range", period))
 				xhttp.Error(c, errcode.ErrInvalidParams)
 				return
@@ -55,8 +50,9 @@ func TopRankingHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 		var wg sync.WaitGroup
 		var mu sync.Mutex
 
-		// 并发获取每条链的排名数据
+		// 并发获取每条链的排名数据，任意一条链的集合统计更新后删除缓存
 		for _, chain := range svcCtx.C.ChainSupported {
+			middleware.AddCacheTags(c, apicache.RankingTag(chain.Name))
 			wg.Add(1)
 			go func(chain string) {
 				defer wg.Done()
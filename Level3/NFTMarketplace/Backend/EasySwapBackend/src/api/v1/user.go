@@ -1,11 +1,15 @@
 package v1
 
 import (
+	"strconv"
+
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/kit/validator"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -47,6 +51,58 @@ func UserLoginHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	}
 }
 
+// RefreshTokenHandler 使用刷新令牌换取新的访问令牌和刷新令牌
+func RefreshTokenHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.RefreshTokenReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		if req.RefreshToken == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.RefreshUserToken(c.Request.Context(), svcCtx, req.RefreshToken)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// UserLogoutHandler 注销请求携带的令牌所属的会话，查询参数 all=true 时注销这些地址的所有会话
+func UserLogoutHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		all := c.Query("all") == "true"
+		for _, claims := range middleware.GetAuthClaims(c) {
+			if err := service.UserLogout(c.Request.Context(), svcCtx, claims.Subject, claims.SessionID, all); err != nil {
+				xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+				return
+			}
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
+
+// UserSessionsHandler 列出请求携带的令牌对应地址的所有有效会话
+func UserSessionsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := &types.UserSessionsResp{}
+		for _, claims := range middleware.GetAuthClaims(c) {
+			sessions, err := service.GetUserSessions(c.Request.Context(), svcCtx, claims.Subject, claims.SessionID)
+			if err != nil {
+				xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+				return
+			}
+			res.Result = append(res.Result, sessions.Result...)
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
 // GetSigStatusHandler 处理获取签名状态消息的请求。
 // 它接收一个服务上下文对象 svcCtx，并返回一个 gin.HandlerFunc。
 // 该处理函数会从请求参数中获取用户地址，验证地址是否为空，
@@ -63,8 +119,14 @@ func GetLoginMessageHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			// 结束处理
 			return
 		}
-		// 调用服务层的 GetSigStatusMsg 函数获取签名状态消息
-		res, err := service.GetUserLoginMsg(c.Request.Context(), svcCtx, address)
+		// 登录的链，未指定时使用第一个支持的链
+		chainID, err := loginChainID(svcCtx, c.Query("chain_id"))
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		// 调用服务层的 GetUserLoginMsg 函数生成登录消息
+		res, err := service.GetUserLoginMsg(c.Request.Context(), svcCtx, address, chainID)
 		// 检查是否发生错误
 		if err != nil {
 			// 返回自定义错误响应，结束处理
@@ -105,3 +167,14 @@ func GetSigStatusHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 		xhttp.OkJson(c, res)
 	}
 }
+
+// loginChainID 解析登录消息的链 ID，为空时使用配置中的第一个链
+func loginChainID(svcCtx *svc.ServerCtx, raw string) (int, error) {
+	if raw != "" {
+		return strconv.Atoi(raw)
+	}
+	if len(svcCtx.C.ChainSupported) == 0 {
+		return 0, errors.New("no chain supported")
+	}
+	return svcCtx.C.ChainSupported[0].ChainID, nil
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
 	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/mq"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 )
 
@@ -40,8 +42,19 @@ func NewPlatform(config *config.Config, router *gin.Engine, serverCtx *svc.Serve
 }
 
 // Start 启动Platform实例
-// 使用zap日志库记录日志，并启动路由并监听指定端口
+// 启动元数据刷新队列的消费者、稀有度计算、图片转存任务和实时推送网关，使用zap日志库记录日志，并启动路由并监听指定端口
 func (p *Platform) Start() {
+	// 启动元数据刷新队列的消费者
+	mq.NewMetadataRefresher(p.serverCtx).Start(context.Background())
+	// 启动稀有度计算任务，重新计算属性变化的集合
+	mq.NewRarityUpdater(p.serverCtx).Start(context.Background())
+	// 启动图片和视频转存任务
+	mq.NewMediaMirror(p.serverCtx).Start(context.Background())
+	// 启动实时推送网关，读取同步服务发布的市场事件
+	p.serverCtx.Feed.Start(context.Background())
+	// 启动 API 缓存失效消息的消费者，按标签删除同步服务通知变化的缓存
+	middleware.NewCacheInvalidator(p.serverCtx.KvStore).Start(context.Background())
+
 	// 使用zap日志库记录日志
 	xzap.WithContext(context.Background()).Info("EasySwap-End run", zap.String("port", p.config.Api.Port))
 
@@ -31,10 +31,13 @@ func VerifySig(addr, sigHex string, digest []byte) bool {
 	if len(signature) != 65 {
 		return false
 	}
-	if signature[64] != 27 && signature[64] != 28 {
+	// 兼容 v 为 27/28 和 0/1 两种格式的签名
+	if signature[64] == 27 || signature[64] == 28 {
+		signature[64] -= 27
+	}
+	if signature[64] != 0 && signature[64] != 1 {
 		return false
 	}
-	signature[64] -= 27
 	publicKeyBytes, err := crypto.Ecrecover(digest, signature)
 	if err != nil {
 		return false
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+	siweVersion      = "1"
+	// siweClockSkew 允许客户端与服务端之间的时钟误差
+	siweClockSkew = 5 * time.Minute
+)
+
+// SiweMessage EIP-4361 (Sign-In with Ethereum) 登录消息
+type SiweMessage struct {
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+	NotBefore      time.Time
+}
+
+// String 按 EIP-4361 的格式生成待签名的消息，地址使用 EIP-55 校验和格式
+func (m *SiweMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeaderSuffix + "\n")
+	b.WriteString(common.HexToAddress(m.Address).Hex() + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n\n")
+	}
+	b.WriteString("URI: " + m.URI + "\n")
+	b.WriteString("Version: " + siweVersion + "\n")
+	b.WriteString(fmt.Sprintf("Chain ID: %d\n", m.ChainID))
+	b.WriteString("Nonce: " + m.Nonce + "\n")
+	b.WriteString("Issued At: " + m.IssuedAt.UTC().Format(time.RFC3339))
+	if !m.ExpirationTime.IsZero() {
+		b.WriteString("\nExpiration Time: " + m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	if !m.NotBefore.IsZero() {
+		b.WriteString("\nNot Before: " + m.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// ParseSiweMessage 解析 EIP-4361 格式的登录消息
+func ParseSiweMessage(message string) (*SiweMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	if len(lines) < 3 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, errors.New("invalid siwe message header")
+	}
+
+	m := &SiweMessage{Domain: strings.TrimSuffix(lines[0], siweHeaderSuffix)}
+	if !common.IsHexAddress(lines[1]) {
+		return nil, errors.New("invalid siwe message address")
+	}
+	m.Address = lines[1]
+
+	var err error
+	var statement []string
+	for _, line := range lines[2:] {
+		switch {
+		case strings.HasPrefix(line, "URI: "):
+			m.URI = strings.TrimPrefix(line, "URI: ")
+		case strings.HasPrefix(line, "Version: "):
+			m.Version = strings.TrimPrefix(line, "Version: ")
+		case strings.HasPrefix(line, "Chain ID: "):
+			if m.ChainID, err = strconv.Atoi(strings.TrimPrefix(line, "Chain ID: ")); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe message chain id")
+			}
+		case strings.HasPrefix(line, "Nonce: "):
+			m.Nonce = strings.TrimPrefix(line, "Nonce: ")
+		case strings.HasPrefix(line, "Issued At: "):
+			if m.IssuedAt, err = time.Parse(time.RFC3339, strings.TrimPrefix(line, "Issued At: ")); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe message issued at")
+			}
+		case strings.HasPrefix(line, "Expiration Time: "):
+			if m.ExpirationTime, err = time.Parse(time.RFC3339, strings.TrimPrefix(line, "Expiration Time: ")); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe message expiration time")
+			}
+		case strings.HasPrefix(line, "Not Before: "):
+			if m.NotBefore, err = time.Parse(time.RFC3339, strings.TrimPrefix(line, "Not Before: ")); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe message not before")
+			}
+		case m.URI == "" && line != "":
+			// URI 之前的非空行为 statement
+			statement = append(statement, line)
+		}
+	}
+	m.Statement = strings.Join(statement, "\n")
+
+	if m.URI == "" || m.Version != siweVersion || m.ChainID == 0 || m.Nonce == "" || m.IssuedAt.IsZero() {
+		return nil, errors.New("incomplete siwe message")
+	}
+	return m, nil
+}
+
+// Validate 检查消息在 now 时刻是否有效：签发时间不能晚于当前时间，未到生效时间或已过期的消息无效
+func (m *SiweMessage) Validate(now time.Time) error {
+	if m.IssuedAt.After(now.Add(siweClockSkew)) {
+		return errors.New("siwe message issued in the future")
+	}
+	if !m.NotBefore.IsZero() && now.Add(siweClockSkew).Before(m.NotBefore) {
+		return errors.New("siwe message not yet valid")
+	}
+	if !m.ExpirationTime.IsZero() && !now.Before(m.ExpirationTime) {
+		return errors.New("siwe message expired")
+	}
+	return nil
+}
+
+// SiweHash 返回消息按 EIP-191 personal_sign 格式计算的哈希，钱包对该哈希签名
+func SiweHash(message string) []byte {
+	return accounts.TextHash([]byte(message))
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSiweMessage() *SiweMessage {
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &SiweMessage{
+		Domain:         "easyswap.io",
+		Address:        "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed",
+		Statement:      "Welcome to EasySwap!",
+		URI:            "https://easyswap.io",
+		ChainID:        11155111,
+		Nonce:          "abc123",
+		IssuedAt:       issuedAt,
+		ExpirationTime: issuedAt.Add(10 * time.Minute),
+	}
+}
+
+func TestParseSiweMessage(t *testing.T) {
+	valid := testSiweMessage().String()
+
+	tests := []struct {
+		name    string
+		message string
+		wantErr bool
+	}{
+		{name: "valid", message: valid},
+		{name: "crlf", message: strings.ReplaceAll(valid, "\n", "\r\n")},
+		{name: "bad header", message: strings.Replace(valid, "wants you to sign in", "wants to sign in", 1), wantErr: true},
+		{name: "bad address", message: strings.Replace(valid, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5aAeb6053F3E94C9", 1), wantErr: true},
+		{name: "bad chain id", message: strings.Replace(valid, "Chain ID: 11155111", "Chain ID: sepolia", 1), wantErr: true},
+		{name: "bad version", message: strings.Replace(valid, "Version: 1", "Version: 2", 1), wantErr: true},
+		{name: "missing nonce", message: strings.Replace(valid, "Nonce: abc123\n", "", 1), wantErr: true},
+		{name: "missing uri", message: strings.Replace(valid, "URI: https://easyswap.io\n", "", 1), wantErr: true},
+		{name: "bad expiration time", message: strings.Replace(valid, "Expiration Time: 2024-01-01T00:10:00Z", "Expiration Time: tomorrow", 1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseSiweMessage(tt.message)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := testSiweMessage()
+			if msg.Domain != want.Domain || !strings.EqualFold(msg.Address, want.Address) || msg.URI != want.URI ||
+				msg.ChainID != want.ChainID || msg.Nonce != want.Nonce || msg.Statement != want.Statement ||
+				!msg.IssuedAt.Equal(want.IssuedAt) || !msg.ExpirationTime.Equal(want.ExpirationTime) {
+				t.Fatalf("unexpected message %+v", msg)
+			}
+		})
+	}
+}
+
+func TestSiweMessageValidate(t *testing.T) {
+	issuedAt := testSiweMessage().IssuedAt
+
+	tests := []struct {
+		name    string
+		modify  func(m *SiweMessage)
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", now: issuedAt.Add(time.Minute)},
+		{name: "clock skew", now: issuedAt.Add(-time.Minute)},
+		{name: "issued in the future", now: issuedAt.Add(-10 * time.Minute), wantErr: "issued in the future"},
+		{name: "expired", now: issuedAt.Add(10 * time.Minute), wantErr: "expired"},
+		{name: "no expiration", modify: func(m *SiweMessage) { m.ExpirationTime = time.Time{} }, now: issuedAt.Add(24 * time.Hour)},
+		{
+			name:    "not yet valid",
+			modify:  func(m *SiweMessage) { m.NotBefore = issuedAt.Add(8 * time.Minute) },
+			now:     issuedAt.Add(time.Minute),
+			wantErr: "not yet valid",
+		},
+		{
+			name:   "not before reached",
+			modify: func(m *SiweMessage) { m.NotBefore = issuedAt.Add(8 * time.Minute) },
+			now:    issuedAt.Add(4 * time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testSiweMessage()
+			if tt.modify != nil {
+				tt.modify(msg)
+			}
+			// 生成的消息解析后校验结果不变
+			parsed, err := ParseSiweMessage(msg.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = parsed.Validate(tt.now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
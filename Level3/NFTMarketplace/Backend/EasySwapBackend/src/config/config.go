@@ -4,22 +4,33 @@ import (
 	"strings"
 
 	"github.com/ProjectsTask/EasySwapBase/evm/erc"
-	//"github.com/ProjectsTask/EasySwapBase/image"
+	"github.com/ProjectsTask/EasySwapBase/image"
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
 	logging "github.com/ProjectsTask/EasySwapBase/logger"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Api        `toml:"api" json:"api"`
-	ProjectCfg *ProjectCfg     `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
-	Log        logging.LogConf `toml:"log" json:"log"`
-	//ImageCfg       *image.Config     `toml:"image_cfg" mapstructure:"image_cfg" json:"image_cfg"`
+	Api            `toml:"api" json:"api"`
+	ProjectCfg     *ProjectCfg       `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
+	Log            logging.LogConf   `toml:"log" json:"log"`
+	ImageCfg       *image.Config     `toml:"image_cfg" mapstructure:"image_cfg" json:"image_cfg"`
 	DB             gdb.Config        `toml:"db" json:"db"`
 	Kv             *KvConf           `toml:"kv" json:"kv"`
 	Evm            *erc.NftErc       `toml:"evm" json:"evm"`
 	MetadataParse  *MetadataParse    `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"`
 	ChainSupported []*ChainSupported `toml:"chain_supported" mapstructure:"chain_supported" json:"chain_supported"`
+	Siwe           *SiweCfg          `toml:"siwe" mapstructure:"siwe" json:"siwe"`
+	Auth           *AuthCfg          `toml:"auth" mapstructure:"auth" json:"auth"`
+	// MetadataRefresh 元数据刷新队列的消费配置
+	MetadataRefresh *MetadataRefreshCfg `toml:"metadata_refresh" mapstructure:"metadata_refresh" json:"metadata_refresh"`
+	// MediaMirror 图片和视频转存配置，需要同时配置 image_cfg
+	MediaMirror *MediaMirrorCfg `toml:"media_mirror" mapstructure:"media_mirror" json:"media_mirror"`
+	// Feed 实时推送配置
+	Feed *FeedCfg `toml:"feed" mapstructure:"feed" json:"feed"`
+	// Cursor 分页游标配置
+	Cursor *CursorCfg `toml:"cursor" mapstructure:"cursor" json:"cursor"`
 }
 
 type ProjectCfg struct {
@@ -48,6 +59,8 @@ type MetadataParse struct {
 	AttributesTags []string `toml:"attributes_tags" mapstructure:"attributes_tags" json:"attributes_tags"`
 	TraitNameTags  []string `toml:"trait_name_tags" mapstructure:"trait_name_tags" json:"trait_name_tags"`
 	TraitValueTags []string `toml:"trait_value_tags" mapstructure:"trait_value_tags" json:"trait_value_tags"`
+	// Ipfs 获取 IPFS 元数据和图片的网关池配置，未配置时使用公共网关
+	Ipfs *ipfs.Config `toml:"ipfs" mapstructure:"ipfs" json:"ipfs"`
 }
 
 type ChainSupported struct {
@@ -56,6 +69,74 @@ type ChainSupported struct {
 	Endpoint string `toml:"endpoint" mapstructure:"endpoint" json:"endpoint"`
 }
 
+// SiweCfg Sign-In with Ethereum (EIP-4361) 登录消息配置
+type SiweCfg struct {
+	// Domain 请求登录的域名，登录时校验消息中的域名
+	Domain string `toml:"domain" mapstructure:"domain" json:"domain"`
+	// URI 登录的资源地址
+	URI string `toml:"uri" mapstructure:"uri" json:"uri"`
+	// Statement 展示给用户的说明
+	Statement string `toml:"statement" mapstructure:"statement" json:"statement"`
+	// Expiration 登录消息的有效期（秒）
+	Expiration int64 `toml:"expiration" mapstructure:"expiration" json:"expiration"`
+}
+
+// AuthCfg 登录令牌配置
+type AuthCfg struct {
+	// Keys 访问令牌的签名密钥，轮换时先添加新密钥并设置为 ActiveKey，旧令牌过期后再删除旧密钥
+	Keys []*AuthKey `toml:"keys" mapstructure:"keys" json:"keys"`
+	// ActiveKey 签发新令牌使用的密钥 ID，为空时使用第一个密钥
+	ActiveKey string `toml:"active_key" mapstructure:"active_key" json:"active_key"`
+	// AccessTTL 访问令牌有效期（秒）
+	AccessTTL int64 `toml:"access_ttl" mapstructure:"access_ttl" json:"access_ttl"`
+	// RefreshTTL 刷新令牌有效期（秒）
+	RefreshTTL int64 `toml:"refresh_ttl" mapstructure:"refresh_ttl" json:"refresh_ttl"`
+	// Admins 管理员钱包地址，只有管理员可以提交集合导入等管理操作
+	Admins []string `toml:"admins" mapstructure:"admins" json:"admins"`
+}
+
+type AuthKey struct {
+	ID     string `toml:"id" mapstructure:"id" json:"id"`
+	Secret string `toml:"secret" mapstructure:"secret" json:"-"`
+}
+
+// CursorCfg 分页游标配置
+type CursorCfg struct {
+	// Secret 游标的签名密钥，至少 32 字节，未配置时由登录令牌的当前密钥派生。
+	// 更换密钥后已经发出的游标失效，客户端需要从第一页重新查询
+	Secret string `toml:"secret" mapstructure:"secret" json:"-"`
+}
+
+// MetadataRefreshCfg 元数据刷新配置
+type MetadataRefreshCfg struct {
+	// Workers 同时刷新的元数据数量
+	Workers int `toml:"workers" mapstructure:"workers" json:"workers"`
+	// HostRate 每个元数据域名每秒最多请求次数，IPFS 网关统一按一个域名计算
+	HostRate int `toml:"host_rate" mapstructure:"host_rate" json:"host_rate"`
+	// MaxAttempts 单个 NFT 最多尝试次数，全部失败后标记为获取元数据失败
+	MaxAttempts int `toml:"max_attempts" mapstructure:"max_attempts" json:"max_attempts"`
+}
+
+// MediaMirrorCfg 图片和视频转存配置
+type MediaMirrorCfg struct {
+	// Workers 同时转存的文件数量
+	Workers int `toml:"workers" mapstructure:"workers" json:"workers"`
+	// BatchSize 每次从数据库读取的待转存物品数量
+	BatchSize int `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`
+}
+
+// FeedCfg 实时推送配置
+type FeedCfg struct {
+	// SendBuffer 每个连接待发送的消息数量上限，超过时断开连接，客户端需要带上最后收到的事件 ID 重连
+	SendBuffer int `toml:"send_buffer" mapstructure:"send_buffer" json:"send_buffer"`
+	// MaxTopics 每个连接最多订阅的主题数量
+	MaxTopics int `toml:"max_topics" mapstructure:"max_topics" json:"max_topics"`
+	// ReplayLimit 断线重连时最多补发的事件数量（按 Stream 中的事件计算），超过时通知客户端重新拉取全量数据
+	ReplayLimit int `toml:"replay_limit" mapstructure:"replay_limit" json:"replay_limit"`
+	// PollInterval 读取新事件的间隔（毫秒）
+	PollInterval int `toml:"poll_interval" mapstructure:"poll_interval" json:"poll_interval"`
+}
+
 // UnmarshalConfig unmarshal conifg file
 // @params path: the path of config dir
 // UnmarshalConfig 函数用于从指定的配置文件中读取配置信息，并将其反序列化为 Config 结构体。
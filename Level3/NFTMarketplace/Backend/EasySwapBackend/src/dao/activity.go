@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 	"sync"
 
@@ -31,6 +30,9 @@ var eventTypesToID = map[string]int{
 	"item_bid":              multi.ItemBid,
 	"cancel_collection_bid": multi.CancelCollectionBid,
 	"cancel_item_bid":       multi.CancelItemBid,
+	"edit_list":             multi.EditListing,
+	"edit_collection_bid":   multi.EditCollectionBid,
+	"edit_item_bid":         multi.EditItemBid,
 }
 
 var idToEventTypes = map[int]string{
@@ -46,6 +48,9 @@ var idToEventTypes = map[int]string{
 	multi.ItemBid:             "item_bid",
 	multi.CancelCollectionBid: "cancel_collection_bid",
 	multi.CancelItemBid:       "cancel_item_bid",
+	multi.EditListing:         "edit_list",
+	multi.EditCollectionBid:   "edit_collection_bid",
+	multi.EditItemBid:         "edit_item_bid",
 }
 
 type ActivityCountCache struct {
@@ -53,7 +58,9 @@ type ActivityCountCache struct {
 	ContractAddresses []string `json:"contract_addresses"`
 	TokenId           string   `json:"token_id"`
 	UserAddress       string   `json:"user_address"`
-	EventTypes        []string `json:"event_types"`
+	EventTypes        []int    `json:"event_types"`
+	StartTime         int64    `json:"start_time,omitempty"`
+	EndTime           int64    `json:"end_time,omitempty"`
 }
 
 type ActivityMultiChainInfo struct {
@@ -61,6 +68,32 @@ type ActivityMultiChainInfo struct {
 	ChainName string `gorm:"column:chain_name"`
 }
 
+// ActivityFilter 多链活动查询的过滤条件，为空的条件不过滤
+type ActivityFilter struct {
+	CollectionAddrs []string
+	TokenID         string
+	// UserAddrs 作为 maker 或 taker 参与的活动
+	UserAddrs []string
+	// EventTypes 活动类型 ID，由 ActivityEventTypeIDs 从事件名称转换
+	EventTypes []int
+	// StartTime、EndTime 活动时间范围（秒，包含两端），为 0 表示不限制
+	StartTime int64
+	EndTime   int64
+}
+
+// ActivityEventTypeIDs 把事件名称转换为活动类型 ID，忽略不认识的名称
+func ActivityEventTypeIDs(eventTypes []string) []int {
+	var events []int
+	for _, v := range eventTypes {
+		id, ok := eventTypesToID[v]
+		if !ok {
+			continue
+		}
+		events = append(events, id)
+	}
+	return events
+}
+
 func getActivityCountCacheKey(activity *ActivityCountCache) (string, error) {
 	uid, err := json.Marshal(activity)
 	if err != nil {
@@ -69,161 +102,188 @@ func getActivityCountCacheKey(activity *ActivityCountCache) (string, error) {
 	return CacheActivityNumPrefix + string(uid), nil
 }
 
+// activityUnion 生成多链活动查询，过滤条件放在每条链的子查询中，返回还没有排序和分页的 union 查询
+func activityUnion(tables chainTables, chains []string, filter ActivityFilter) (*sqlQuery, error) {
+	return unionChains(chains, func(chain string) (*sqlQuery, error) {
+		q, conds, err := activitySelect(tables, chain, filter)
+		if err != nil {
+			return nil, err
+		}
+		return q.Where(conds), nil
+	})
+}
+
+// activitySelect 生成一条链的活动子查询和过滤条件，where 子句由调用方追加
+func activitySelect(tables chainTables, chain string, filter ActivityFilter) (*sqlQuery, sqlConds, error) {
+	table, err := tables.table(chain, multi.ActivityTableName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var conds sqlConds
+	if len(filter.UserAddrs) > 0 {
+		userAddrs := make([]string, 0, len(filter.UserAddrs))
+		for _, addr := range filter.UserAddrs {
+			userAddrs = append(userAddrs, strings.ToLower(addr))
+		}
+		// 用户作为 maker 或 taker 参与的活动
+		maker, taker := inExpr("maker", userAddrs), inExpr("taker", userAddrs)
+		conds.Add("("+maker.sql+" or "+taker.sql+")", append(maker.args, taker.args...)...)
+	}
+	if len(filter.CollectionAddrs) > 0 {
+		conds.AddExpr(inExpr("collection_address", filter.CollectionAddrs))
+	}
+	if filter.TokenID != "" {
+		conds.Add("token_id = ?", filter.TokenID)
+	}
+	if len(filter.EventTypes) > 0 {
+		conds.AddExpr(inExpr("activity_type", filter.EventTypes))
+	}
+	if filter.StartTime > 0 {
+		conds.Add("event_time >= ?", filter.StartTime)
+	}
+	if filter.EndTime > 0 {
+		conds.Add("event_time <= ?", filter.EndTime)
+	}
+
+	q := &sqlQuery{}
+	q.Add("select ? as chain_name,id,collection_address,token_id,currency_address,activity_type,"+
+		"maker,taker,price,tx_hash,event_time,marketplace_id ", chain)
+	q.Add(fmt.Sprintf("from %s ", table))
+	return q, conds, nil
+}
+
+// activityPageQuery 在 union 查询上追加按时间倒序的分页
+func activityPageQuery(union *sqlQuery, page, pageSize int) *sqlQuery {
+	q := &sqlQuery{}
+	return q.Add(union.SQL(), union.Args()...).
+		Add(" ORDER BY combined.event_time DESC, combined.id DESC limit ? offset ?", pageSize, pageSize*(page-1))
+}
+
+// activitySortKeys 活动在一条链内的排序，不同链的活动 ID 可能相同，多链合并后再按链名排序
+var activitySortKeys = []sortKey{{Expr: "event_time", Desc: true}, {Expr: "id", Desc: true}}
+
+// activityKeysetQuery 生成多链活动的游标分页查询，排序为 event_time, id, chain_name 倒序。
+// 游标条件和 limit 放在每条链的子查询中，每条链只读取一页，合并后再取一页；
+// page.After 为 [event_time, id, chain_name]，与游标中的行时间和 ID 相同的行按链名决定是否包含
+func activityKeysetQuery(tables chainTables, chains []string, filter ActivityFilter, page KeysetPage) (*sqlQuery, error) {
+	union, err := unionChains(chains, func(chain string) (*sqlQuery, error) {
+		q, conds, err := activitySelect(tables, chain, filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.After) == len(activitySortKeys)+1 {
+			cursorChain, _ := page.After[len(activitySortKeys)].(string)
+			// 按链名倒序，向后翻页时链名更小的链包含时间和 ID 都相同的行，向前翻页时反之
+			inclusive := chain < cursorChain
+			if page.Backward {
+				inclusive = chain > cursorChain
+			}
+			conds.AddExpr(keysetAfter(activitySortKeys, page.After[:len(activitySortKeys)], page.Backward, inclusive))
+		}
+		return q.Where(conds).Add("order by "+orderBy(activitySortKeys, page.Backward)+" limit ?", page.Limit+1), nil
+	})
+	if err != nil || union == nil {
+		return nil, err
+	}
+	return union.Add(" ORDER BY "+orderBy([]sortKey{
+		{Expr: "combined.event_time", Desc: true},
+		{Expr: "combined.id", Desc: true},
+		{Expr: "combined.chain_name", Desc: true},
+	}, page.Backward)+" limit ?", page.Limit+1), nil
+}
+
+// activityKeys 活动在多链排序中的排序键，与 activityKeysetQuery 的 page.After 对应
+func activityKeys(activity ActivityMultiChainInfo) []interface{} {
+	return []interface{}{activity.EventTime, activity.Id, activity.ChainName}
+}
+
 // QueryMultiChainActivities 查询多链上的活动信息
 // 参数:
 // - ctx: 上下文
 // - chainName: 链名称列表
-// - collectionAddrs: NFT合约地址列表
-// - tokenID: NFT的tokenID
-// - userAddrs: 用户地址列表
-// - eventTypes: 事件类型列表
+// - filter: 过滤条件(合约地址、tokenID、用户地址、事件类型、时间范围)
 // - page: 页码
 // - pageSize: 每页大小
 // 返回:
 // - []ActivityMultiChainInfo: 活动信息列表
 // - int64: 总记录数
 // - error: 错误信息
-func (d *Dao) QueryMultiChainActivities(ctx context.Context, chainName []string, collectionAddrs []string, tokenID string, userAddrs []string, eventTypes []string, page, pageSize int) ([]ActivityMultiChainInfo, int64, error) {
-	//查询缓存中的总数
-	var strNums []string
-
-	var total int64
+func (d *Dao) QueryMultiChainActivities(ctx context.Context, chainName []string, filter ActivityFilter, page, pageSize int) ([]ActivityMultiChainInfo, int64, error) {
 	var activities []ActivityMultiChainInfo
 
-	//将事件类型转换为对应的ID
-	var events []int
-	for _, v := range eventTypes {
-		id, ok := eventTypesToID[v]
-		if !ok {
-			continue
-		}
-		events = append(events, id)
+	//构建SQL查询: 每条链一个子查询,使用UNION ALL合并
+	union, err := activityUnion(d.tables, chainName, filter)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed on build activity query")
 	}
-
-	//构建SQL查询
-	//1. 构建SQL头部
-	sqlHead := "SELECT * FROM ("
-
-	//2. 构建SQL中间部分 - 使用UNION ALL合并多个链的查询
-	sqlMid := ""
-	for _, chain := range chainName {
-		if sqlMid != "" {
-			sqlMid += "UNION ALL "
-		}
-		//为每个链构建子查询
-		sqlMid += fmt.Sprintf("(select '%s' as chain_name,id,collection_address,token_id,currency_address,activity_type,maker,taker,price,tx_hash,event_time,marketplace_id ", chain)
-		sqlMid += fmt.Sprintf("from %s ", multi.ActivityTableName(chain))
-
-		//添加用户地址过滤条件
-		if len(userAddrs) == 1 {
-			sqlMid += fmt.Sprintf("where maker = '%s' or taker = '%s'", strings.ToLower(userAddrs[0]), strings.ToLower(userAddrs[0]))
-		} else if len(userAddrs) > 1 {
-			var userAddrsParam string
-			for i, addr := range userAddrs {
-				userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-				if i < len(userAddrs)-1 {
-					userAddrsParam += ","
-				}
-			}
-			sqlMid += fmt.Sprintf("where maker in (%s) or taker in (%s)", userAddrsParam, userAddrsParam)
-		}
-		sqlMid += ") "
+	if union == nil {
+		return nil, 0, nil
 	}
 
-	//3. 构建SQL尾部 - 添加过滤条件
-	sqlTail := ") as combined "
-	firstFlag := true
-
-	//添加合约地址过滤
-	if len(collectionAddrs) == 1 {
-		sqlTail += fmt.Sprintf("WHERE collection_address = '%s' ", collectionAddrs[0])
-		firstFlag = false
-	} else if len(collectionAddrs) > 1 {
-		sqlTail += fmt.Sprintf("WHERE collection_address in ('%s'", collectionAddrs[0])
-		for i := 1; i < len(collectionAddrs); i++ {
-			sqlTail += fmt.Sprintf(",'%s'", collectionAddrs[i])
-		}
-		sqlTail += ") "
-		firstFlag = false
+	//执行查询
+	query := activityPageQuery(union, page, pageSize)
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&activities).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query activity")
 	}
 
-	//添加tokenID过滤
-	if tokenID != "" {
-		if firstFlag {
-			sqlTail += fmt.Sprintf("WHERE token_id = '%s' ", tokenID)
-			firstFlag = false
-		} else {
-			sqlTail += fmt.Sprintf("and token_id = '%s' ", tokenID)
-		}
+	total, err := d.countActivities(ctx, union, filter)
+	if err != nil {
+		return nil, 0, err
 	}
+	return activities, total, nil
+}
 
-	//添加事件类型过滤
-	if len(events) > 0 {
-		if firstFlag {
-			sqlTail += fmt.Sprintf("WHERE activity_type in (%d", events[0])
-			for i := 1; i < len(events); i++ {
-				sqlTail += fmt.Sprintf(",%d", events[i])
-			}
-			sqlTail += ") "
-			firstFlag = false
-		} else {
-			sqlTail += fmt.Sprintf("and activity_type in (%d", events[0])
-			for i := 1; i < len(events); i++ {
-				sqlTail += fmt.Sprintf(",%d", events[i])
-			}
-			sqlTail += ") "
-		}
+// QueryMultiChainActivitiesByCursor 按游标查询多链上的活动信息，排序与 QueryMultiChainActivities 相同，
+// 返回的活动已经按时间倒序排列，PageEdges 中的排序键用于生成前后翻页的游标
+func (d *Dao) QueryMultiChainActivitiesByCursor(ctx context.Context, chainName []string, filter ActivityFilter, page KeysetPage) ([]ActivityMultiChainInfo, PageEdges, error) {
+	query, err := activityKeysetQuery(d.tables, chainName, filter, page)
+	if err != nil {
+		return nil, PageEdges{}, errors.Wrap(err, "failed on build activity query")
+	}
+	if query == nil {
+		return nil, PageEdges{}, nil
 	}
 
-	//添加分页
-	sqlTail += fmt.Sprintf("ORDER BY combined.event_time DESC, combined.id DESC limit %d offset %d", pageSize, pageSize*(page-1))
-
-	//组合完整SQL
-	sql := sqlHead + sqlMid + sqlTail
-
-	//执行查询
-	if err := d.DB.Raw(sql).Scan(&activities).Error; err != nil {
-		return nil, 0, errors.Wrap(err, "failed on query activity")
+	var activities []ActivityMultiChainInfo
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&activities).Error; err != nil {
+		return nil, PageEdges{}, errors.Wrap(err, "failed on query activity")
 	}
+	activities, edges := pageEdges(activities, page, activityKeys)
+	return activities, edges, nil
+}
 
-	//构建计数SQL
-	sqlCnt := "SELECT COUNT(*) FROM (" + sqlMid + sqlTail
+// CountMultiChainActivities 统计多链活动的数量，结果按过滤条件缓存 30 秒，是近似值
+func (d *Dao) CountMultiChainActivities(ctx context.Context, chainName []string, filter ActivityFilter) (int64, error) {
+	union, err := activityUnion(d.tables, chainName, filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on build activity query")
+	}
+	if union == nil {
+		return 0, nil
+	}
+	return d.countActivities(ctx, union, filter)
+}
 
-	//从Redis缓存获取总数
+// countActivities 统计活动数量，按过滤条件缓存 30 秒
+func (d *Dao) countActivities(ctx context.Context, union *sqlQuery, filter ActivityFilter) (int64, error) {
 	cacheKey, err := getActivityCountCacheKey(&ActivityCountCache{
 		Chain:             "MultiChain",
-		ContractAddresses: collectionAddrs,
-		TokenId:           tokenID,
-		UserAddress:       strings.ToLower(strings.Join(userAddrs, ",")),
-		EventTypes:        eventTypes,
+		ContractAddresses: filter.CollectionAddrs,
+		TokenId:           filter.TokenID,
+		UserAddress:       strings.ToLower(strings.Join(filter.UserAddrs, ",")),
+		EventTypes:        filter.EventTypes,
+		StartTime:         filter.StartTime,
+		EndTime:           filter.EndTime,
 	})
 	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed on get activity number cache key")
+		return 0, errors.Wrap(err, "failed on get activity number cache key")
 	}
-
-	strNum, err := d.KvStore.Get(cacheKey)
+	total, err := d.cachedCount(ctx, cacheKey, d.countRows(ctx, countQuery(union)))
 	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed on get activity number from cache")
-	}
-	strNums = append(strNums, strNum)
-
-	//获取总数
-	if strNum != "" {
-		//从缓存获取
-		total, _ = strconv.ParseInt(strNum, 10, 64)
-	} else {
-		//从数据库查询
-		if err := d.DB.Raw(sqlCnt).Scan(&total).Error; err != nil {
-			return nil, 0, errors.Wrap(err, "failed on count activity")
-		}
-
-		//更新缓存
-		if err := d.KvStore.Setex(cacheKey, strconv.FormatInt(total, 10), 30); err != nil {
-			return nil, 0, errors.Wrap(err, "failed on cache activities number")
-		}
+		return 0, errors.Wrap(err, "failed on count activity")
 	}
-
-	return activities, total, nil
+	return total, nil
 }
 
 // QueryMultiChainActivityExternalInfo 查询多链活动的外部信息
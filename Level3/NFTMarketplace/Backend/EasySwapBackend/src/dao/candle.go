@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// candleStatsQuery 查询 [start, end) 内粒度为 bucket 的有成交的桶，按时间升序
+func candleStatsQuery(table, collectionAddr string, bucket, start, end int64) *sqlQuery {
+	var conds sqlConds
+	conds.Add("collection_address = ? and bucket = ? and bucket_start >= ? and bucket_start < ?",
+		strings.ToLower(collectionAddr), bucket, start, end)
+	conds.Add("sales_count > 0")
+
+	q := &sqlQuery{}
+	q.Add("select bucket_start, sales_count, volume, min_price, max_price, open_price, close_price from " + table + " ")
+	return q.Where(conds).Add("order by bucket_start")
+}
+
+// prevCloseQuery 查询 before 之前最近一次成交的价格，使用最细的 5m 桶
+func prevCloseQuery(table, collectionAddr string, before int64) *sqlQuery {
+	q := &sqlQuery{}
+	q.Add("select bucket_start, close_price from "+table+" "+
+		"where collection_address = ? and bucket = ? and bucket_start < ? and sales_count > 0 "+
+		"order by bucket_start desc limit 1",
+		strings.ToLower(collectionAddr), collectionstats.Bucket5m, before)
+	return q
+}
+
+// floorHistoryQuery 取 [start, end) 内每个 bucket 长度的区间中最后一次地板价快照，按时间升序
+func floorHistoryQuery(table, collectionAddr string, bucket, start, end int64) *sqlQuery {
+	q := &sqlQuery{}
+	q.Add("select event_time - event_time % ? as time, "+
+		"SUBSTRING_INDEX(GROUP_CONCAT(price ORDER BY event_time DESC), ',', 1) as price from "+table+" "+
+		"where collection_address = ? and event_time >= ? and event_time < ? "+
+		"group by event_time - event_time % ? order by time",
+		bucket, strings.ToLower(collectionAddr), start, end, bucket)
+	return q
+}
+
+// prevFloorQuery 查询 before 之前最近一次地板价快照
+func prevFloorQuery(table, collectionAddr string, before int64) *sqlQuery {
+	q := &sqlQuery{}
+	q.Add("select event_time as time, price from "+table+" "+
+		"where collection_address = ? and event_time < ? order by event_time desc limit 1",
+		strings.ToLower(collectionAddr), before)
+	return q
+}
+
+// QueryCollectionCandleStats 查询集合 [start, end) 内粒度为 bucket 的成交统计，
+// 同时返回 start 之前最近一次成交的价格，用于填充没有成交的周期
+func (d *Dao) QueryCollectionCandleStats(ctx context.Context, chain, collectionAddr string, bucket, start, end int64) ([]multi.CollectionStats, decimal.Decimal, error) {
+	table, err := d.tables.table(chain, multi.CollectionStatsTableName)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	var rows []multi.CollectionStats
+	q := candleStatsQuery(table, collectionAddr, bucket, start, end)
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&rows).Error; err != nil {
+		return nil, decimal.Zero, errors.Wrap(err, "failed on query collection candle stats")
+	}
+
+	var prev []multi.CollectionStats
+	q = prevCloseQuery(table, collectionAddr, start)
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&prev).Error; err != nil {
+		return nil, decimal.Zero, errors.Wrap(err, "failed on query collection previous close")
+	}
+	if len(prev) == 0 {
+		return rows, decimal.Zero, nil
+	}
+	return rows, prev[0].ClosePrice, nil
+}
+
+// QueryCollectionFloorHistory 从地板价快照表查询集合 [start, end) 内每个 bucket 长度区间的最后一次快照，
+// 同时返回 start 之前最近一次快照的地板价
+func (d *Dao) QueryCollectionFloorHistory(ctx context.Context, chain, collectionAddr string, bucket, start, end int64) ([]collectionstats.FloorPoint, decimal.Decimal, error) {
+	table, err := d.tables.table(chain, multi.CollectionFloorPriceTableName)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	var points []collectionstats.FloorPoint
+	q := floorHistoryQuery(table, collectionAddr, bucket, start, end)
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&points).Error; err != nil {
+		return nil, decimal.Zero, errors.Wrap(err, "failed on query collection floor history")
+	}
+
+	var prev []collectionstats.FloorPoint
+	q = prevFloorQuery(table, collectionAddr, start)
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&prev).Error; err != nil {
+		return nil, decimal.Zero, errors.Wrap(err, "failed on query collection previous floor")
+	}
+	if len(prev) == 0 {
+		return points, decimal.Zero, nil
+	}
+	return points, prev[0].Price, nil
+}
@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
+)
+
+func TestCandleStatsQuery(t *testing.T) {
+	assertQuery(t, candleStatsQuery("ob_collection_stats_eth", "0xAB", collectionstats.Bucket1h, 3600, 7200),
+		"select bucket_start, sales_count, volume, min_price, max_price, open_price, close_price from ob_collection_stats_eth "+
+			"where collection_address = ? and bucket = ? and bucket_start >= ? and bucket_start < ? and sales_count > 0 "+
+			"order by bucket_start",
+		"0xab", collectionstats.Bucket1h, int64(3600), int64(7200))
+
+	assertQuery(t, prevCloseQuery("ob_collection_stats_eth", "0xab", 3600),
+		"select bucket_start, close_price from ob_collection_stats_eth "+
+			"where collection_address = ? and bucket = ? and bucket_start < ? and sales_count > 0 "+
+			"order by bucket_start desc limit 1",
+		"0xab", collectionstats.Bucket5m, int64(3600))
+}
+
+func TestFloorHistoryQuery(t *testing.T) {
+	assertQuery(t, floorHistoryQuery("ob_collection_floor_price_eth", "0xAB", collectionstats.Bucket5m, 0, 3600),
+		"select event_time - event_time % ? as time, "+
+			"SUBSTRING_INDEX(GROUP_CONCAT(price ORDER BY event_time DESC), ',', 1) as price from ob_collection_floor_price_eth "+
+			"where collection_address = ? and event_time >= ? and event_time < ? "+
+			"group by event_time - event_time % ? order by time",
+		collectionstats.Bucket5m, "0xab", int64(0), int64(3600), collectionstats.Bucket5m)
+
+	assertQuery(t, prevFloorQuery("ob_collection_floor_price_eth", "0xab", 3600),
+		"select event_time as time, price from ob_collection_floor_price_eth "+
+			"where collection_address = ? and event_time < ? order by event_time desc limit 1",
+		"0xab", int64(3600))
+}
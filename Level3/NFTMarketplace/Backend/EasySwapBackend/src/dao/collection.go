@@ -198,29 +198,37 @@ func (d *Dao) QueryMultiChainUserCollectionInfos(ctx context.Context, chainID []
 	chainNames []string, userAddrs []string) ([]types.UserCollections, error) {
 	var userCollections []types.UserCollections
 
-	// 构建用户地址参数字符串,格式: 'addr1','addr2',...
-	var userAddrsParam string
-	for i, addr := range userAddrs {
-		// 将用户地址用单引号包裹并拼接成字符串
-		userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-		if i < len(userAddrs)-1 {
-			// 如果不是最后一个地址，添加逗号分隔
-			userAddrsParam += ","
-		}
+	query, err := userCollectionsQuery(d.tables, chainNames, userAddrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on build user multi chain collection query")
+	}
+	if query == nil {
+		return nil, nil
 	}
 
-	// SQL语句组成部分
-	sqlHead := "SELECT * FROM ("
-	// 按照地板价*持有数量降序排序
-	sqlTail := ") as combined ORDER BY combined.floor_price * " +
-		"CAST(combined.item_count AS DECIMAL) DESC"
-	var sqlMids []string
+	// 执行SQL查询
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&userCollections).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get user multi chain collection infos")
+	}
 
-	// 遍历每条链,构建子查询
-	for _, chainName := range chainNames {
-		sqlMid := "("
+	return userCollections, nil
+}
+
+// userCollectionsQuery 生成用户在多条链上持有的Collection查询,按照地板价*持有数量降序排序
+func userCollectionsQuery(tables chainTables, chainNames []string, userAddrs []string) (*sqlQuery, error) {
+	union, err := unionChains(chainNames, func(chainName string) (*sqlQuery, error) {
+		collectionTable, err := tables.table(chainName, multi.CollectionTableName)
+		if err != nil {
+			return nil, err
+		}
+		itemTable, err := tables.table(chainName, multi.ItemTableName)
+		if err != nil {
+			return nil, err
+		}
+
+		q := &sqlQuery{}
 		// 查询Collection基本信息和用户持有数量
-		sqlMid += "select " +
+		q.Add("select " +
 			"gc.address as address, " +
 			"gc.name as name, " +
 			"gc.floor_price as floor_price, " +
@@ -228,36 +236,19 @@ func (d *Dao) QueryMultiChainUserCollectionInfos(ctx context.Context, chainID []
 			"gc.item_amount as item_amount, " +
 			"gc.symbol as symbol, " +
 			"gc.image_uri as image_uri, " +
-			"count(*) as item_count "
+			"count(*) as item_count ")
 		// 从Collection表和Item表联表查询
-		sqlMid += fmt.Sprintf("from %s as gc ", multi.CollectionTableName(chainName))
-		sqlMid += fmt.Sprintf("join %s as gi ", multi.ItemTableName(chainName))
-		sqlMid += "on gc.address = gi.collection_address "
+		q.Add(fmt.Sprintf("from %s as gc join %s as gi ", collectionTable, itemTable))
+		q.Add("on gc.address = gi.collection_address ")
 		// 过滤指定用户持有的Item
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
-		sqlMid += "group by gc.address"
-		sqlMid += ")"
-
-		sqlMids = append(sqlMids, sqlMid)
+		q.Add("where ").AddExpr(inExpr("gi.owner", userAddrs))
+		q.Add(" group by gc.address")
+		return q, nil
+	})
+	if err != nil || union == nil {
+		return nil, err
 	}
-
-	// 组装完整SQL,使用UNION ALL合并多链结果
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			// 使用UNION ALL合并多个子查询结果
-			sql += " UNION ALL "
-		}
-		sql += sqlMids[i]
-	}
-	sql += sqlTail
-
-	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(sql).Scan(&userCollections).Error; err != nil {
-		return nil, errors.Wrap(err, "failed on get user multi chain collection infos")
-	}
-
-	return userCollections, nil
+	return union.Add(" ORDER BY combined.floor_price * CAST(combined.item_count AS DECIMAL) DESC"), nil
 }
 
 // QueryMultiChainUserItemInfos 查询用户拥有nft的Item基本信息，list信息和bid信息，从Item表和Activity表中查询
@@ -276,185 +267,176 @@ func (d *Dao) QueryMultiChainUserItemInfos(ctx context.Context, chain []string,
 	var count int64
 	var items []types.PortfolioItemInfo
 
-	// 构建用户地址参数字符串,格式: 'addr1','addr2',...
-	var userAddrsParam string
-	for i, addr := range userAddrs {
-		userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-		if i < len(userAddrs)-1 {
-			userAddrsParam += ","
-		}
+	union, err := userItemsUnion(d.tables, chain, userAddrs, contractAddrs)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed on build user multi chain items query")
+	}
+	if union == nil {
+		return nil, 0, nil
 	}
 
-	// SQL语句组成部分
-	sqlCntHead := "SELECT COUNT(*) FROM ("
-	sqlHead := "SELECT * FROM ("
-	sqlTail := fmt.Sprintf(") as combined ORDER BY combined.owned_time DESC LIMIT %d OFFSET %d",
-		pageSize, page-1)
-	var sqlMids []string
+	// 执行SQL查询
+	sqlCnt := countQuery(union)
+	if err := d.DB.WithContext(ctx).Raw(sqlCnt.SQL(), sqlCnt.Args()...).Scan(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count user multi chain items")
+	}
+	query := userItemsPageQuery(union, page, pageSize)
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&items).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on get user multi chain items")
+	}
+
+	return items, count, nil
+}
+
+// userItemsUnion 生成用户在多条链上持有的Item查询,owned_time为Item最后一次成交的时间,
+// 返回还没有排序和分页的 union 查询
+func userItemsUnion(tables chainTables, chain []string, userAddrs []string, contractAddrs []string) (*sqlQuery, error) {
+	return unionChains(chain, func(chainName string) (*sqlQuery, error) {
+		itemTable, err := tables.table(chainName, multi.ItemTableName)
+		if err != nil {
+			return nil, err
+		}
+		activityTable, err := tables.table(chainName, multi.ActivityTableName)
+		if err != nil {
+			return nil, err
+		}
 
-	// 遍历每条链,构建子查询
-	for _, chainName := range chain {
-		sqlMid := "("
+		q := &sqlQuery{}
 		// 查询Item基本信息和最后交易时间
 		// 选择字段: chain_id, collection_address, token_id, name, owner, owned_time
-		sqlMid += "select gi.chain_id as chain_id, " +
+		q.Add("select gi.chain_id as chain_id, " +
 			"gi.collection_address as collection_address, " +
 			"gi.token_id as token_id, " +
 			"gi.name as name, " +
 			"gi.owner as owner, " +
-			"sub.last_event_time as owned_time "
-		sqlMid += fmt.Sprintf("from %s gi ", multi.ItemTableName(chainName))
+			"sub.last_event_time as owned_time ")
+		q.Add(fmt.Sprintf("from %s gi ", itemTable))
 
 		// 左连接子查询,获取最后交易时间
-		sqlMid += "left join "
-		sqlMid += "(select sgi.collection_address, sgi.token_id, " +
-			"max(sga.event_time) as last_event_time "
-		sqlMid += fmt.Sprintf("from %s sgi join %s sga ",
-			multi.ItemTableName(chainName), multi.ActivityTableName(chainName))
-		sqlMid += "on sgi.collection_address = sga.collection_address " +
-			"and sgi.token_id = sga.token_id "
-		sqlMid += fmt.Sprintf("where sgi.owner in (%s) and sga.activity_type = %d ",
-			userAddrsParam, multi.Sale)
-
+		var subConds sqlConds
+		subConds.AddExpr(inExpr("sgi.owner", userAddrs))
+		subConds.Add("sga.activity_type = ?", multi.Sale)
 		// 如果指定了合约地址,添加合约地址过滤条件
 		if len(contractAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and sgi.collection_address in ('%s'", contractAddrs[0])
-			for i := 1; i < len(contractAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", contractAddrs[i])
-			}
-			sqlMid += ") "
+			subConds.AddExpr(inExpr("sgi.collection_address", contractAddrs))
 		}
-		sqlMid += "group by sgi.collection_address, sgi.token_id) sub "
-		sqlMid += "on gi.collection_address = sub.collection_address " +
-			"and gi.token_id = sub.token_id "
+		q.Add("left join (select sgi.collection_address, sgi.token_id, max(sga.event_time) as last_event_time ")
+		q.Add(fmt.Sprintf("from %s sgi join %s sga ", itemTable, activityTable))
+		q.Add("on sgi.collection_address = sga.collection_address and sgi.token_id = sga.token_id ")
+		q.Where(subConds)
+		q.Add("group by sgi.collection_address, sgi.token_id) sub ")
+		q.Add("on gi.collection_address = sub.collection_address and gi.token_id = sub.token_id ")
 
 		// 过滤指定用户持有的Item
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
+		var conds sqlConds
+		conds.AddExpr(inExpr("gi.owner", userAddrs))
 		if len(contractAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and gi.collection_address in ('%s'", contractAddrs[0])
-			for i := 1; i < len(contractAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", contractAddrs[i])
-			}
-			sqlMid += ")"
+			conds.AddExpr(inExpr("gi.collection_address", contractAddrs))
 		}
-		sqlMid += ")"
+		return q.Where(conds), nil
+	})
+}
+
+// userItemsPageQuery 在 union 查询上追加按持有时间倒序的分页
+func userItemsPageQuery(union *sqlQuery, page, pageSize int) *sqlQuery {
+	q := &sqlQuery{}
+	return q.Add(union.SQL(), union.Args()...).
+		Add(" ORDER BY combined.owned_time DESC LIMIT ? OFFSET ?", pageSize, pageSize*(page-1))
+}
 
-		sqlMids = append(sqlMids, sqlMid)
+// userItemsSortKeys 用户 Item 游标分页的排序，在持有时间倒序的基础上按链、集合和 tokenID 排序，
+// 没有成交记录的 Item 持有时间为 null，排在最后
+var userItemsSortKeys = []sortKey{
+	{Expr: "combined.owned_time", Desc: true, Nullable: true},
+	{Expr: "combined.chain_id", Desc: true},
+	{Expr: "combined.collection_address", Desc: true},
+	{Expr: "combined.token_id", Desc: true},
+}
+
+// userItemsKeysetQuery 在 union 查询上追加游标条件和排序，多读取一行用于判断是否还有更多的 Item
+func userItemsKeysetQuery(union *sqlQuery, page KeysetPage) *sqlQuery {
+	q := &sqlQuery{}
+	q.Add(union.SQL(), union.Args()...)
+	if len(page.After) > 0 {
+		q.Add(" WHERE ").AddExpr(keysetAfter(userItemsSortKeys, page.After, page.Backward, false))
 	}
+	return q.Add(" ORDER BY "+orderBy(userItemsSortKeys, page.Backward)+" LIMIT ?", page.Limit+1)
+}
 
-	// 组装完整SQL,使用UNION ALL合并多链结果
-	sqlCnt := sqlCntHead
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			sql += " UNION ALL "
-			sqlCnt += " UNION ALL "
-		}
-		sql += sqlMids[i]
-		sqlCnt += sqlMids[i]
+// userItemKeys Item 在 userItemsSortKeys 中的排序键，持有时间为 0 表示查询结果为 null
+func userItemKeys(item types.PortfolioItemInfo) []interface{} {
+	var ownedTime interface{}
+	if item.OwnedTime > 0 {
+		ownedTime = item.OwnedTime
 	}
-	sql += sqlTail
-	sqlCnt += ") as combined"
+	return []interface{}{ownedTime, item.ChainID, item.CollectionAddress, item.TokenID}
+}
 
-	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(sqlCnt).Scan(&count).Error; err != nil {
-		return nil, 0, errors.Wrap(err, "failed on count user multi chain items")
+// QueryMultiChainUserItemInfosByCursor 按游标查询多链上用户持有的 Item，查询条件与 QueryMultiChainUserItemInfos 相同
+func (d *Dao) QueryMultiChainUserItemInfosByCursor(ctx context.Context, chain []string, userAddrs []string,
+	contractAddrs []string, page KeysetPage) ([]types.PortfolioItemInfo, PageEdges, error) {
+	union, err := userItemsUnion(d.tables, chain, userAddrs, contractAddrs)
+	if err != nil {
+		return nil, PageEdges{}, errors.Wrap(err, "failed on build user multi chain items query")
 	}
-	if err := d.DB.WithContext(ctx).Raw(sql).Scan(&items).Error; err != nil {
-		return nil, 0, errors.Wrap(err, "failed on get user multi chain items")
+	if union == nil {
+		return nil, PageEdges{}, nil
 	}
 
-	return items, count, nil
+	var items []types.PortfolioItemInfo
+	query := userItemsKeysetQuery(union, page)
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&items).Error; err != nil {
+		return nil, PageEdges{}, errors.Wrap(err, "failed on get user multi chain items")
+	}
+	items, edges := pageEdges(items, page, userItemKeys)
+	return items, edges, nil
+}
+
+// QueryMultiChainUserListingItemInfosByCursor 按游标查询多链上用户挂单的 Item，查询条件与 QueryMultiChainUserListingItemInfos 相同
+func (d *Dao) QueryMultiChainUserListingItemInfosByCursor(ctx context.Context, chain []string, userAddrs []string,
+	contractAddrs []string, page KeysetPage) ([]types.PortfolioItemInfo, PageEdges, error) {
+	return d.QueryMultiChainUserItemInfosByCursor(ctx, chain, userAddrs, contractAddrs, page)
+}
+
+// CountMultiChainUserItems 统计多链上用户持有的 Item 数量，结果按查询条件缓存，是近似值
+func (d *Dao) CountMultiChainUserItems(ctx context.Context, chain []string, userAddrs []string, contractAddrs []string) (int64, error) {
+	union, err := userItemsUnion(d.tables, chain, userAddrs, contractAddrs)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on build user multi chain items query")
+	}
+	if union == nil {
+		return 0, nil
+	}
+	cacheKey := countCacheKey("user:items", strings.Join(chain, ","),
+		strings.ToLower(strings.Join(userAddrs, ",")), strings.ToLower(strings.Join(contractAddrs, ",")))
+	total, err := d.cachedCount(ctx, cacheKey, d.countRows(ctx, countQuery(union)))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on count user multi chain items")
+	}
+	return total, nil
 }
 
-// QueryMultiChainUserListingItemInfos 查询多链上用户挂单Item信息
+// QueryMultiChainUserListingItemInfos 查询多链上用户挂单Item信息,Item的查询条件与 QueryMultiChainUserItemInfos 相同
 func (d *Dao) QueryMultiChainUserListingItemInfos(ctx context.Context, chain []string, userAddrs []string,
 	contractAddrs []string, page, pageSize int) ([]types.PortfolioItemInfo, int64, error) {
 	var count int64
 	var items []types.PortfolioItemInfo
 
-	// 构建用户地址参数字符串
-	var userAddrsParam string
-	for i, addr := range userAddrs {
-		userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-		if i < len(userAddrs)-1 {
-			userAddrsParam += ","
-		}
-	}
-
-	// SQL语句头部
-	sqlCntHead := "SELECT COUNT(*) FROM ("
-	sqlHead := "SELECT * FROM ("
-	// 分页SQL
-	sqlTail := fmt.Sprintf(") as combined ORDER BY combined.owned_time DESC LIMIT %d OFFSET %d",
-		pageSize, page-1)
-	var sqlMids []string
-
-	// 遍历每条链构建SQL
-	for _, chainName := range chain {
-		sqlMid := "("
-		// 查询Item基本信息和最后交易时间
-		sqlMid += "select gi.chain_id as chain_id, gi.collection_address as collection_address, " +
-			"gi.token_id as token_id, gi.name as name, gi.owner as owner, " +
-			"sub.last_event_time as owned_time "
-		sqlMid += fmt.Sprintf("from %s gi ", multi.ItemTableName(chainName))
-		sqlMid += "left join "
-		// 子查询获取每个Item最后的交易时间
-		sqlMid += "(select sgi.collection_address, sgi.token_id, " +
-			"max(sga.event_time) as last_event_time "
-		sqlMid += fmt.Sprintf("from %s sgi join %s sga ",
-			multi.ItemTableName(chainName), multi.ActivityTableName(chainName))
-		sqlMid += "on sgi.collection_address = sga.collection_address " +
-			"and sgi.token_id = sga.token_id "
-		// 过滤条件:指定用户和Sale类型活动
-		sqlMid += fmt.Sprintf("where sgi.owner in (%s) and sga.activity_type = %d ",
-			userAddrsParam, multi.Sale)
-
-		// 添加合约地址过滤
-		if len(contractAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and sgi.collection_address in ('%s'", contractAddrs[0])
-			for i := 1; i < len(contractAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", contractAddrs[i])
-			}
-			sqlMid += ") "
-		}
-		sqlMid += "group by sgi.collection_address, sgi.token_id) sub "
-		sqlMid += "on gi.collection_address = sub.collection_address " +
-			"and gi.token_id = sub.token_id "
-
-		// 主查询过滤条件
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
-		if len(contractAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and gi.collection_address in ('%s'", contractAddrs[0])
-			for i := 1; i < len(contractAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", contractAddrs[i])
-			}
-			sqlMid += ")"
-		}
-		sqlMid += ")"
-
-		sqlMids = append(sqlMids, sqlMid)
+	union, err := userItemsUnion(d.tables, chain, userAddrs, contractAddrs)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed on build user multi chain items query")
 	}
-
-	// 使用UNION ALL合并多链结果
-	sqlCnt := sqlCntHead
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			sql += " UNION ALL "
-			sqlCnt += " UNION ALL "
-		}
-		sql += sqlMids[i]
-		sqlCnt += sqlMids[i]
+	if union == nil {
+		return nil, 0, nil
 	}
-	sql += sqlTail
-	sqlCnt += ") as combined"
 
 	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(sqlCnt).Scan(&count).Error; err != nil {
+	sqlCnt := countQuery(union)
+	if err := d.DB.WithContext(ctx).Raw(sqlCnt.SQL(), sqlCnt.Args()...).Scan(&count).Error; err != nil {
 		return nil, 0, errors.Wrap(err, "failed on count user multi chain items")
 	}
-	if err := d.DB.WithContext(ctx).Raw(sql).Scan(&items).Error; err != nil {
+	query := userItemsPageQuery(union, page, pageSize)
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&items).Error; err != nil {
 		return nil, 0, errors.Wrap(err, "failed on get user multi chain items")
 	}
 
@@ -518,30 +500,40 @@ func (d *Dao) QueryFloorPrice(ctx context.Context, chain string, collectionAddr
 	//    - 指定集合地址
 	//    - 订单类型为listing(OrderType=1)
 	//    - 订单状态为active(OrderStatus=0)
-	//    - 卖家是NFT当前所有者
+	//    - 卖家仍然持有挂单的NFT
 	//    - 排除marketplace_id=1的订单
+	//    - 订单簿合约未暂停
 	// 5. 按价格升序排序,取第一条记录(即最低价)
-	sql := fmt.Sprintf(`SELECT co.price as price
-        FROM %s as ci
-                left join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id
-        WHERE (co.collection_address= ? and co.order_type = ? and
-            co.order_status = ? and co.maker = ci.owner and co.marketplace_id != ?)
-        order by co.price asc limit 1`, multi.ItemTableName(chain), multi.OrderTableName(chain))
+	q, err := floorPriceQuery(d.tables, chain, collectionAddr)
+	if err != nil {
+		return decimal.Zero, err
+	}
 
 	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(
-		sql,
-		collectionAddr,
-		OrderType,
-		OrderStatus,
-		1,
-	).Scan(&order).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&order).Error; err != nil {
 		return decimal.Zero, errors.Wrap(err, "failed on get collection floor price")
 	}
 
 	return order.Price, nil
 }
 
+// floorPriceQuery 生成集合地板价的查询,条件见 QueryFloorPrice
+func floorPriceQuery(tables chainTables, chain, collectionAddr string) (*sqlQuery, error) {
+	from, err := listedItemsFrom(tables, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("co.collection_address = ?", collectionAddr)
+	conds = append(conds, listedAmountConds(chain)...)
+	conds.Add(orderbookActive(chain, "co"))
+
+	q := &sqlQuery{}
+	q.Add("select co.price as price ").Add(from)
+	return q.Where(conds).Add("order by co.price asc limit 1"), nil
+}
+
 func GetCollectionTradeInfoKey(project, chain string, collectionAddr string) string {
 	return fmt.Sprintf("cache:%s:%s:collection:%s:trade", strings.ToLower(project), strings.ToLower(chain), strings.ToLower(collectionAddr))
 }
@@ -554,69 +546,6 @@ func GetHoldersCountKey(chain string) string {
 	return fmt.Sprintf("cache:es:%s:holders:count", chain)
 }
 
-// QueryCollectionFloorChange 查询集合地板价变化情况
-// @param chain string 链名称
-// @param timeDiff int64 时间差(秒)
-// @return map[string]float64 返回集合地址到地板价变化率的映射
-// @return error 错误信息
-func (d *Dao) QueryCollectionFloorChange(chain string, timeDiff int64) (map[string]float64, error) {
-	collectionFloorChange := make(map[string]float64)
-
-	var collectionPrices []multi.CollectionFloorPrice
-	// 这个SQL语句用于查询NFT集合的地板价变化情况:
-	// 1. 从集合地板价表中选择collection_address(集合地址)、price(价格)和event_time(事件时间)
-	// 2. WHERE子句包含两个条件:
-	//    a) 查询每个集合的最新地板价记录(通过GROUP BY和MAX(event_time)获取)
-	//    b) 查询每个集合在指定时间段之前的最新地板价记录(通过WHERE event_time <= UNIX_TIMESTAMP() - ? 筛选)
-	// 3. 最后按集合地址和时间降序排序,这样可以方便计算价格变化率
-	rawSql := fmt.Sprintf(`SELECT collection_address, price, event_time 
-        FROM %s 
-        WHERE (collection_address, event_time) IN (
-            SELECT collection_address, MAX(event_time)
-            FROM %s
-            GROUP BY collection_address
-        ) OR (collection_address, event_time) IN (
-            SELECT collection_address, MAX(event_time)
-            FROM %s 
-            WHERE event_time <= UNIX_TIMESTAMP() - ? 
-            GROUP BY collection_address
-        ) 
-        ORDER BY collection_address,event_time DESC`,
-		multi.CollectionFloorPriceTableName(chain),
-		multi.CollectionFloorPriceTableName(chain),
-		multi.CollectionFloorPriceTableName(chain))
-	if err := d.DB.Raw(rawSql, timeDiff).Scan(&collectionPrices).Error; err != nil {
-		return nil, errors.Wrap(err, "failed on get collection floor change")
-	}
-
-	// 这个循环用于计算每个NFT集合的地板价变化率:
-	// 1. 遍历collectionPrices数组,每个元素包含集合地址和对应时间点的地板价
-	// 2. 对于每个集合:
-	//    - 如果当前元素和下一个元素是同一个集合的记录(CollectionAddress相同)
-	//    - 且下一个元素的价格大于0
-	//    则:
-	//    - 计算价格变化率 = (当前价格 - 历史价格) / 历史价格
-	//    - 使用Price.Sub()计算价格差
-	//    - 使用Div()计算变化率
-	//    - 使用InexactFloat64()转换为float64类型
-	//    - i++跳过下一个元素(因为已经使用过了)
-	// 3. 如果不满足条件,则将该集合的变化率设为0
-	// 4. 最终得到一个从集合地址到其地板价变化率的映射
-	for i := 0; i < len(collectionPrices); i++ {
-		if i < len(collectionPrices)-1 &&
-			collectionPrices[i].CollectionAddress == collectionPrices[i+1].CollectionAddress &&
-			collectionPrices[i+1].Price.GreaterThan(decimal.Zero) {
-			collectionFloorChange[collectionPrices[i].CollectionAddress] = collectionPrices[i].Price.
-				Sub(collectionPrices[i+1].Price).Div(collectionPrices[i+1].Price).InexactFloat64()
-			i++
-		} else {
-			collectionFloorChange[collectionPrices[i].CollectionAddress] = 0.0
-		}
-	}
-
-	return collectionFloorChange, nil
-}
-
 // QueryCollectionsSellPrice 查询所有集合的最高卖单价格
 // @param ctx context.Context 上下文
 // @param chain string 链名称
@@ -634,19 +563,35 @@ func (d *Dao) QueryCollectionsSellPrice(ctx context.Context, chain string) ([]mu
 	//    - order_type = ? - 订单类型(传入参数,筛选：卖订单)
 	//    - expire_time > ? - 过期时间大于当前时间(筛选：未过期订单)
 	// 4. group by collection_address - 按集合地址分组,获取每个集合的最高价
-	sql := fmt.Sprintf(`SELECT collection_address as address, max(co.price) as sale_price
-FROM %s as co where order_status = ? and order_type = ? and expire_time > ? group by collection_address`, multi.OrderTableName(chain))
-	if err := d.DB.WithContext(ctx).Raw(
-		sql,
-		multi.OrderStatusActive,
-		multi.CollectionBidOrder,
-		time.Now().Unix()).Scan(&collections).Error; err != nil {
+	q, err := collectionsSellPriceQuery(d.tables, chain, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&collections).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get collection sell price")
 	}
 
 	return collections, nil
 }
 
+// collectionsSellPriceQuery 生成每个集合有效集合出价的最高价格的查询,按集合地址分组
+func collectionsSellPriceQuery(tables chainTables, chain string, now int64) (*sqlQuery, error) {
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("order_status = ?", multi.OrderStatusActive)
+	conds.Add("order_type = ?", multi.CollectionBidOrder)
+	conds.Add("expire_time > ?", now)
+	conds.Add(orderbookActive(chain, "co"))
+
+	q := &sqlQuery{}
+	q.Add("select collection_address as address, max(co.price) as sale_price from " + orderTable + " as co ")
+	return q.Where(conds).Add("group by collection_address"), nil
+}
+
 // QueryCollectionSellPrice 查询指定NFT集合的最高卖单价格
 // 参数:
 // - ctx context.Context: 上下文，用于控制请求的生命周期。
@@ -659,17 +604,12 @@ func (d *Dao) QueryCollectionSellPrice(ctx context.Context, chain, collectionAdd
 	// 定义一个 multi.Collection 类型的变量，用于存储查询结果
 	var collection multi.Collection
 	// 构建SQL查询语句，从订单表中查询指定集合的最高卖单价格
-	// 查询条件：集合地址匹配、订单状态为活跃、订单类型为集合买单、剩余数量大于0、未过期
-	// 按价格降序排序，取第一条记录（即最高价格）
-	sql := fmt.Sprintf(`SELECT collection_address as address, co.price as sale_price
-FROM %s as co where collection_address = ? and order_status = ? and order_type = ? and quantity_remaining > 0 and expire_time > ? order by price desc limit 1`, multi.OrderTableName(chain))
+	q, err := collectionSellPriceQuery(d.tables, chain, collectionAddr, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
 	// 执行SQL查询，将查询结果扫描到 collection 变量中
-	if err := d.DB.WithContext(ctx).Raw(
-		sql,
-		collectionAddr,
-		multi.OrderStatusActive,
-		multi.CollectionBidOrder,
-		time.Now().Unix()).Scan(&collection).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&collection).Error; err != nil {
 		// 若查询过程中出现错误，返回错误信息并添加错误上下文
 		return nil, errors.Wrap(err, "failed on get collection sell price")
 	}
@@ -677,3 +617,25 @@ FROM %s as co where collection_address = ? and order_status = ? and order_type =
 	// 查询成功，返回查询结果的指针
 	return &collection, nil
 }
+
+// collectionSellPriceQuery 生成集合最高的有效集合出价的查询
+// 查询条件：集合地址匹配、订单状态为活跃、订单类型为集合买单、剩余数量大于0、未过期、订单簿合约未暂停
+// 按价格降序排序，取第一条记录（即最高价格）
+func collectionSellPriceQuery(tables chainTables, chain, collectionAddr string, now int64) (*sqlQuery, error) {
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("collection_address = ?", collectionAddr)
+	conds.Add("order_status = ?", multi.OrderStatusActive)
+	conds.Add("order_type = ?", multi.CollectionBidOrder)
+	conds.Add("quantity_remaining > 0")
+	conds.Add("expire_time > ?", now)
+	conds.Add(orderbookActive(chain, "co"))
+
+	q := &sqlQuery{}
+	q.Add("select collection_address as address, co.price as sale_price from " + orderTable + " as co ")
+	return q.Where(conds).Add("order by price desc limit 1"), nil
+}
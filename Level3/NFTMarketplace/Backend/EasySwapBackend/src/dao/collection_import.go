@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// QueryCollectionImportRecord 查询集合最近一次的导入任务，没有导入过时返回 nil
+func (d *Dao) QueryCollectionImportRecord(ctx context.Context, chain string, collectionAddr string) (*multi.CollectionImportRecord, error) {
+	var records []*multi.CollectionImportRecord
+	if err := d.DB.WithContext(ctx).Table(multi.CollectionImportRecordTableName(chain)).
+		Where("collection_address = ?", collectionAddr).
+		Order("id desc").Limit(1).
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get collection import record")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return records[0], nil
+}
+
+// CreateCollectionImportRecord 创建导入任务，由同步服务按创建顺序处理
+func (d *Dao) CreateCollectionImportRecord(ctx context.Context, chain string, record *multi.CollectionImportRecord) error {
+	if err := d.DB.WithContext(ctx).Table(multi.CollectionImportRecordTableName(chain)).
+		Create(record).Error; err != nil {
+		return errors.Wrap(err, "failed on create collection import record")
+	}
+
+	return nil
+}
+
+// RequeueCollectionImportRecord 把失败的导入任务重新加入队列，已导入的 item 数量保留，同步服务从该位置继续
+func (d *Dao) RequeueCollectionImportRecord(ctx context.Context, chain string, record *multi.CollectionImportRecord) error {
+	if err := d.DB.WithContext(ctx).Table(multi.CollectionImportRecordTableName(chain)).
+		Where("id = ? and finished_stage = ?", record.Id, multi.ImportStageFailed).
+		Updates(map[string]interface{}{
+			"finished_stage": multi.ImportStageQueued,
+			"from_block":     record.FromBlock,
+			"msg":            "",
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on requeue collection import record")
+	}
+
+	return nil
+}
@@ -13,6 +13,9 @@ type Dao struct {
 
 	DB      *gorm.DB
 	KvStore *xkv.Store
+
+	// tables 配置中支持的链，多链查询只允许访问这些链的表
+	tables chainTables
 }
 
 // New 函数用于创建一个新的 Dao 实例
@@ -21,10 +24,11 @@ type Dao struct {
 //     ctx context.Context: 上下文对象，用于传递请求范围内的值、取消信号等
 //     db *gorm.DB: GORM 数据库连接对象，用于数据库操作
 //     kvStore *xkv.Store: 键值存储对象，用于键值对存储操作
+//     chains []string: 配置中支持的链名称，多链查询的表名只能由这些链生成
 //
 // 返回值：
 //     *Dao: 初始化后的 Dao 实例指针
-func New(ctx context.Context, db *gorm.DB, kvStore *xkv.Store) *Dao {
+func New(ctx context.Context, db *gorm.DB, kvStore *xkv.Store, chains []string) *Dao {
 	// 初始化 Dao 结构体并返回
 	return &Dao{
 		// 设置上下文
@@ -33,5 +37,7 @@ func New(ctx context.Context, db *gorm.DB, kvStore *xkv.Store) *Dao {
 		DB:      db,
 		// 设置键值存储
 		KvStore: kvStore,
+		// 设置允许查询的链
+		tables: newChainTables(chains),
 	}
 }
@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+)
+
+// makerHoldsItem 返回挂单的 maker 仍然持有挂单 token 的查询条件，order / item 是订单表和 item 表的别名：
+// ERC-721 要求 maker 是 item 的 owner，ERC-1155 要求 maker 的持有数量不少于订单的剩余数量
+func makerHoldsItem(chain, order, item string) string {
+	return fmt.Sprintf("(%[1]s.maker = %[2]s.owner or exists (select 1 from %[3]s ib where ib.collection_address = %[1]s.collection_address"+
+		" and ib.token_id = %[1]s.token_id and ib.owner = %[1]s.maker and ib.balance >= %[1]s.quantity_remaining))",
+		order, item, multi.ItemBalanceTableName(chain))
+}
+
+// QueryItemHolders 分页查询 ERC-1155 token 的持有人，按持有数量降序排列
+func (d *Dao) QueryItemHolders(ctx context.Context, chain, collectionAddr, tokenID string, page, pageSize int) ([]multi.ItemBalance, int64, error) {
+	var holders []multi.ItemBalance
+	var count int64
+
+	db := d.DB.WithContext(ctx).Table(multi.ItemBalanceTableName(chain)).
+		Where("collection_address = ? and token_id = ? and balance > 0", collectionAddr, tokenID)
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count item holders")
+	}
+	if count == 0 {
+		return nil, 0, nil
+	}
+
+	if err := db.Order("balance desc, id asc").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&holders).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query item holders")
+	}
+	return holders, count, nil
+}
@@ -2,8 +2,8 @@ package dao
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
@@ -26,6 +26,8 @@ const (
 	listPriceDesc = 2
 	salePriceDesc = 3
 	salePriceAsc  = 4
+	rarityAsc     = 5 // 最稀有的排在前面
+	rarityDesc    = 6 // 最常见的排在前面
 )
 
 type CollectionItem struct {
@@ -53,6 +55,7 @@ func (d *Dao) QueryCollectionBids(ctx context.Context, chain string, collectionA
 		Table(multi.OrderTableName(chain)).
 		Where("collection_address = ? and order_type = ? and order_status = ? and expire_time > ?",
 			collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Where(orderbookActive(chain, multi.OrderTableName(chain))).
 		Group("price").
 		Count(&count).Error; err != nil {
 		return nil, 0, errors.Wrap(err, "failed on count user items")
@@ -77,6 +80,7 @@ func (d *Dao) QueryCollectionBids(ctx context.Context, chain string, collectionA
 		Where(`collection_address = ? and order_type = ? and order_status = ? 
 			   and expire_time > ? and quantity_remaining > 0`,
 			collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Where(orderbookActive(chain, multi.OrderTableName(chain))).
 		Group("price").
 		Order("price desc").
 		Limit(int(pageSize)).
@@ -88,17 +92,28 @@ func (d *Dao) QueryCollectionBids(ctx context.Context, chain string, collectionA
 	return bids, count, nil
 }
 
-// QueryCollectionItemOrder 查询集合内NFT Item的订单信息
+// collectionItemsQuery 生成集合内NFT Item和订单信息的查询，按状态、市场、属性等条件过滤，不包含排序和分页
+func (d *Dao) collectionItemsQuery(ctx context.Context, chain string, filter types.CollectionItemFilterParams, collectionAddr string) (*gorm.DB, error) {
+	itemTable, err := d.tables.table(chain, multi.ItemTableName)
+	if err != nil {
+		return nil, err
+	}
+	coTableName, err := d.tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+	traitTable, err := d.tables.table(chain, multi.ItemTraitTableName)
+	if err != nil {
+		return nil, err
+	}
 
-func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter types.CollectionItemFilterParams, collectionAddr string) ([]*CollectionItem, int64, error) {
 	// 如果未指定市场,默认使用OrderBookDex
 	if len(filter.Markets) == 0 {
 		filter.Markets = []int{int(multi.OrderBookDex)}
 	}
 
 	// 初始化数据库查询
-	db := d.DB.WithContext(ctx).Table(fmt.Sprintf("%s as ci", multi.ItemTableName(chain)))
-	coTableName := multi.OrderTableName(chain)
+	db := d.DB.WithContext(ctx).Table(itemTable + " as ci")
 
 	// 根据状态过滤查询
 	// status: 1-buy now(立即购买), 2-has offer(有报价), 3-all(所有)
@@ -108,6 +123,8 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 			"ci.id as id, ci.chain_id as chain_id, " +
 				"ci.collection_address as collection_address,ci.token_id as token_id, " +
 				"ci.name as name, ci.owner as owner, " +
+				"ci.rarity_score as rarity_score, ci.rarity_rank as rarity_rank, " +
+				"ci.list_time as list_time, ci.sale_price as sale_price, " +
 				"min(co.price) as list_price, " +
 				"SUBSTRING_INDEX(GROUP_CONCAT(co.marketplace_id ORDER BY co.price,co.marketplace_id),',', 1) AS market_id, " +
 				"min(co.price) != 0 as listing")
@@ -122,7 +139,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 				coTableName)).
 				Where(
 					"co.collection_address = ? and co.order_type = ? and co.order_status=? "+
-						"and co.maker = ci.owner",
+						"and "+makerHoldsItem(chain, "co", "ci")+" and "+orderbookActive(chain, "co"),
 					collectionAddr, multi.ListingOrder, multi.OrderStatusActive)
 
 			// 根据市场ID过滤
@@ -152,7 +169,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 				"join %s co on co.collection_address=ci.collection_address and co.token_id=ci.token_id",
 				coTableName)).
 				Where(
-					"co.collection_address = ? and co.order_type = ? and co.order_status = ?",
+					"co.collection_address = ? and co.order_type = ? and co.order_status = ? and "+orderbookActive(chain, "co"),
 					collectionAddr, multi.OfferOrder, multi.OrderStatusActive)
 
 			// 根据市场ID过滤
@@ -188,6 +205,8 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 			"ci.id as id, ci.chain_id as chain_id," +
 				"ci.collection_address as collection_address,ci.token_id as token_id, " +
 				"ci.name as name, ci.owner as owner, " +
+				"ci.rarity_score as rarity_score, ci.rarity_rank as rarity_rank, " +
+				"ci.list_time as list_time, ci.sale_price as sale_price, " +
 				"min(co.price) as list_price, " +
 				"SUBSTRING_INDEX(GROUP_CONCAT(co.marketplace_id ORDER BY co.price,co.marketplace_id),',', 1) AS market_id")
 
@@ -195,7 +214,8 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 			"join %s co on co.collection_address=ci.collection_address and co.token_id=ci.token_id",
 			coTableName)).
 			Where(
-				"co.collection_address = ? and co.order_status=? and co.maker = ci.owner",
+				"co.collection_address = ? and co.order_status=? and "+makerHoldsItem(chain, "co", "ci")+
+					" and "+orderbookActive(chain, "co"),
 				collectionAddr, multi.OrderStatusActive)
 
 		// 根据市场ID过滤
@@ -223,8 +243,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 		// 1. 子查询获取每个token的最低listing价格
 		// 2. 左连接子查询结果到Item表
 		// 3. 根据条件过滤
-		subQuery := d.DB.WithContext(ctx).Table(
-			fmt.Sprintf("%s as cis", multi.ItemTableName(chain))).
+		subQuery := d.DB.WithContext(ctx).Table(itemTable+" as cis").
 			Select(
 				"cis.id as item_id,cis.collection_address as collection_address,"+
 					"cis.token_id as token_id, cis.owner as owner, cos.order_id as order_id, "+
@@ -236,7 +255,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 				coTableName)).
 			Where(
 				"cos.collection_address = ? and cos.order_type = ? and cos.order_status=? "+
-					"and cos.maker = cis.owner",
+					"and "+makerHoldsItem(chain, "cos", "cis")+" and "+orderbookActive(chain, "cos"),
 				collectionAddr, multi.ListingOrder, multi.OrderStatusActive)
 
 		if len(filter.Markets) == 1 {
@@ -249,49 +268,114 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 		db.Joins("left join (?) co on co.collection_address=ci.collection_address and co.token_id=ci.token_id",
 			subQuery).
 			Select(
-				"ci.id as id, ci.chain_id as chain_id," +
-					"ci.collection_address as collection_address, ci.token_id as token_id, " +
-					"ci.name as name, ci.owner as owner, " +
+				"ci.id as id, ci.chain_id as chain_id,"+
+					"ci.collection_address as collection_address, ci.token_id as token_id, "+
+					"ci.name as name, ci.owner as owner, "+
+					"ci.rarity_score as rarity_score, ci.rarity_rank as rarity_rank, "+
+					"ci.list_time as list_time, ci.sale_price as sale_price, "+
 					"co.list_price as list_price, co.market_id as market_id, co.listing as listing").
-			Where(fmt.Sprintf("ci.collection_address = '%s'", collectionAddr))
+			Where("ci.collection_address = ?", collectionAddr)
 
 		if filter.TokenID != "" {
-			db.Where(fmt.Sprintf("ci.token_id = '%s'", filter.TokenID))
+			db.Where("ci.token_id = ?", filter.TokenID)
 		}
 		if filter.UserAddress != "" {
-			db.Where(fmt.Sprintf("ci.owner = '%s'", filter.UserAddress))
+			db.Where("ci.owner = ?", filter.UserAddress)
 		}
 	}
 
-	// 统计总记录数
-	var count int64
-	countTx := db.Session(&gorm.Session{})
-	if err := countTx.Count(&count).Error; err != nil {
-		return nil, 0, errors.Wrap(db.Error, "failed on count items")
+	// 按属性和稀有度排名过滤
+	filterItemTraits(db, traitTable, filter)
+	return db, nil
+}
+
+// itemSortKey 集合 Item 列表的排序键和它在查询结果中的值
+type itemSortKey struct {
+	sortKey
+	value func(item *CollectionItem) interface{}
+}
+
+// collectionItemSortKeys 集合 Item 列表的排序，最后按 Item ID 排序保证顺序确定。
+// 表达式使用查询中的列别名，游标条件放在 having 中，按状态分组的查询也可以比较 list_price
+func collectionItemSortKeys(filter types.CollectionItemFilterParams) []itemSortKey {
+	// 查询全部状态时上架的 Item 排在前面，没有上架的 Item listing 和 list_price 为 null
+	all := len(filter.Status) == 0
+	listPrice := func(item *CollectionItem) interface{} {
+		if all && !item.Listing {
+			return nil
+		}
+		return item.ListPrice
 	}
 
-	// 处理排序
-	if len(filter.Status) == 0 {
-		db.Order("listing desc")
+	var keys []itemSortKey
+	if all {
+		keys = append(keys, itemSortKey{sortKey{Expr: "listing", Desc: true, Nullable: true}, func(item *CollectionItem) interface{} {
+			if !item.Listing {
+				return nil
+			}
+			return true
+		}})
 	}
 
 	if filter.Sort == 0 {
 		filter.Sort = listPriceAsc
 	}
-
-	// 根据不同排序条件设置ORDER BY
 	switch filter.Sort {
 	case listTime:
-		db.Order("list_time desc,ci.id asc")
+		keys = append(keys, itemSortKey{sortKey{Expr: "list_time", Desc: true}, func(item *CollectionItem) interface{} { return item.ListTime }})
 	case listPriceAsc:
-		db.Order("list_price asc, ci.id asc")
+		keys = append(keys, itemSortKey{sortKey{Expr: "list_price", Nullable: all}, listPrice})
 	case listPriceDesc:
-		db.Order("list_price desc,ci.id asc")
+		keys = append(keys, itemSortKey{sortKey{Expr: "list_price", Desc: true, Nullable: all}, listPrice})
 	case salePriceDesc:
-		db.Order("sale_price desc,ci.id asc")
+		keys = append(keys, itemSortKey{sortKey{Expr: "sale_price", Desc: true}, func(item *CollectionItem) interface{} { return item.SalePrice }})
 	case salePriceAsc:
-		db.Order("sale_price = 0,sale_price asc,ci.id asc")
+		// 没有成交过的 Item 排在最后
+		keys = append(keys,
+			itemSortKey{sortKey{Expr: "(sale_price = 0)"}, func(item *CollectionItem) interface{} { return item.SalePrice.IsZero() }},
+			itemSortKey{sortKey{Expr: "sale_price"}, func(item *CollectionItem) interface{} { return item.SalePrice }})
+	case rarityAsc:
+		// 还没有计算稀有度的item排在最后
+		keys = append(keys,
+			itemSortKey{sortKey{Expr: "(rarity_rank = 0)"}, func(item *CollectionItem) interface{} { return item.RarityRank == 0 }},
+			itemSortKey{sortKey{Expr: "rarity_rank"}, func(item *CollectionItem) interface{} { return item.RarityRank }})
+	case rarityDesc:
+		keys = append(keys, itemSortKey{sortKey{Expr: "rarity_rank", Desc: true}, func(item *CollectionItem) interface{} { return item.RarityRank }})
 	}
+	return append(keys, itemSortKey{sortKey{Expr: "id"}, func(item *CollectionItem) interface{} { return item.Id }})
+}
+
+func splitItemSortKeys(keys []itemSortKey) ([]sortKey, func(item *CollectionItem) []interface{}) {
+	sortKeys := make([]sortKey, 0, len(keys))
+	for _, key := range keys {
+		sortKeys = append(sortKeys, key.sortKey)
+	}
+	return sortKeys, func(item *CollectionItem) []interface{} {
+		values := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, key.value(item))
+		}
+		return values
+	}
+}
+
+// QueryCollectionItemOrder 查询集合内NFT Item的订单信息
+func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter types.CollectionItemFilterParams, collectionAddr string) ([]*CollectionItem, int64, error) {
+	db, err := d.collectionItemsQuery(ctx, chain, filter, collectionAddr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 统计总记录数
+	var count int64
+	countTx := db.Session(&gorm.Session{})
+	if err := countTx.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(db.Error, "failed on count items")
+	}
+
+	// 根据不同排序条件设置ORDER BY
+	sortKeys, _ := splitItemSortKeys(collectionItemSortKeys(filter))
+	db.Order(orderBy(sortKeys, false))
 
 	// 执行分页查询
 	var items []*CollectionItem
@@ -306,6 +390,70 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 	return items, count, nil
 }
 
+// QueryCollectionItemOrderByCursor 按游标查询集合内NFT Item的订单信息，过滤条件和排序与 QueryCollectionItemOrder 相同
+func (d *Dao) QueryCollectionItemOrderByCursor(ctx context.Context, chain string, filter types.CollectionItemFilterParams,
+	collectionAddr string, page KeysetPage) ([]*CollectionItem, PageEdges, error) {
+	db, err := d.collectionItemsQuery(ctx, chain, filter, collectionAddr)
+	if err != nil {
+		return nil, PageEdges{}, err
+	}
+	sortKeys, itemKeys := splitItemSortKeys(collectionItemSortKeys(filter))
+	if len(page.After) > 0 {
+		after := keysetAfter(sortKeys, page.After, page.Backward, false)
+		db.Having(after.sql, after.args...)
+	}
+
+	var items []*CollectionItem
+	if err := db.Order(orderBy(sortKeys, page.Backward)).Limit(page.Limit + 1).Scan(&items).Error; err != nil {
+		return nil, PageEdges{}, errors.Wrap(err, "failed on get query items info")
+	}
+	items, edges := pageEdges(items, page, itemKeys)
+	return items, edges, nil
+}
+
+// CountCollectionItems 统计集合内符合过滤条件的 Item 数量，结果按过滤条件缓存，是近似值
+func (d *Dao) CountCollectionItems(ctx context.Context, chain string, filter types.CollectionItemFilterParams, collectionAddr string) (int64, error) {
+	// 分页参数不影响总数
+	filter.Page, filter.PageSize, filter.CursorParams = 0, 0, types.CursorParams{}
+	raw, err := json.Marshal(filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on marshal item filter")
+	}
+	total, err := d.cachedCount(ctx, countCacheKey("collection:items", chain, collectionAddr, string(raw)), func() (int64, error) {
+		db, err := d.collectionItemsQuery(ctx, chain, filter, collectionAddr)
+		if err != nil {
+			return 0, err
+		}
+		var count int64
+		err = db.Count(&count).Error
+		return count, err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on count items")
+	}
+	return total, nil
+}
+
+// filterItemTraits 按属性和稀有度排名过滤item：
+// 每个属性生成一个 exists 子查询，不同属性之间为且，同一属性的多个取值用 in 表示或
+func filterItemTraits(db *gorm.DB, traitTable string, filter types.CollectionItemFilterParams) {
+	for _, trait := range filter.Traits {
+		if trait.Trait == "" || len(trait.Values) == 0 {
+			continue
+		}
+		db.Where("exists (select 1 from "+traitTable+" it where it.collection_address = ci.collection_address "+
+			"and it.token_id = ci.token_id and it.trait = ? and it.trait_value in (?))",
+			trait.Trait, trait.Values)
+	}
+
+	if filter.RarityMin > 0 {
+		db.Where("ci.rarity_rank >= ?", filter.RarityMin)
+	}
+	if filter.RarityMax > 0 {
+		db.Where("ci.rarity_rank > 0 and ci.rarity_rank <= ?", filter.RarityMax)
+	}
+}
+
 type UserItemCount struct {
 	Owner  string `json:"owner"`
 	Counts int64  `json:"counts"`
@@ -346,40 +494,59 @@ func (d *Dao) QueryLastSalePrice(ctx context.Context, chain string,
 	collectionAddr string, tokenIds []string) ([]multi.Activity, error) {
 	var lastSales []multi.Activity
 
-	// SQL解释:
-	// 1. 子查询:按集合地址和代币ID分组,找出每组最新的销售事件时间
-	//    - 条件:指定集合地址、代币ID列表、活动类型为销售
-	//    - 分组后取每组最大event_time
-	// 2. 主查询:关联活动表和子查询结果
-	//    - 匹配集合地址、代币ID、事件时间和活动类型
-	//    - 获取每个NFT最近一次销售的价格信息
-	sql := fmt.Sprintf(`
-		SELECT a.collection_address, a.token_id, a.price
-		FROM %s a
-		INNER JOIN (
-			SELECT collection_address,token_id, 
-				MAX(event_time) as max_event_time
-			FROM %s
-			WHERE collection_address = ?
-				AND token_id IN (?)
-				AND activity_type = ?
-			GROUP BY collection_address,token_id
-		) groupedA 
-		ON a.collection_address = groupedA.collection_address
-		AND a.token_id = groupedA.token_id
-		AND a.event_time = groupedA.max_event_time
-		AND a.activity_type = ?`,
-		multi.ActivityTableName(chain),
-		multi.ActivityTableName(chain))
-
-	if err := d.DB.Raw(sql, collectionAddr, tokenIds,
-		multi.Sale, multi.Sale).Scan(&lastSales).Error; err != nil {
+	q, err := lastSalePriceQuery(d.tables, chain, collectionAddr, tokenIds)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&lastSales).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get item last sale price")
 	}
 
 	return lastSales, nil
 }
 
+// lastSalePriceQuery 生成NFT最近一次销售价格的查询:
+// 1. 子查询:按集合地址和代币ID分组,找出每组最新的销售事件时间
+// 2. 主查询:关联活动表和子查询结果,获取每个NFT最近一次销售的价格信息
+func lastSalePriceQuery(tables chainTables, chain, collectionAddr string, tokenIds []string) (*sqlQuery, error) {
+	activityTable, err := tables.table(chain, multi.ActivityTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("collection_address = ?", collectionAddr)
+	conds.AddExpr(inExpr("token_id", tokenIds))
+	conds.Add("activity_type = ?", multi.Sale)
+
+	q := &sqlQuery{}
+	q.Add("select a.collection_address, a.token_id, a.price from " + activityTable + " a ")
+	q.Add("join (select collection_address, token_id, max(event_time) as max_event_time from " + activityTable + " ")
+	q.Where(conds)
+	q.Add("group by collection_address, token_id) grouped ")
+	q.Add("on a.collection_address = grouped.collection_address and a.token_id = grouped.token_id "+
+		"and a.event_time = grouped.max_event_time and a.activity_type = ?", multi.Sale)
+	return q, nil
+}
+
+// bidFields 出价查询返回的订单字段
+const bidFields = "order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining, size"
+
+// activeOrderConds 有效订单的条件:指定订单类型、订单状态为活跃、剩余数量大于0、未过期、订单簿合约未暂停,
+// userAddr 不为空时排除该用户的订单。orderTable 是订单表在查询中的表名或别名
+func activeOrderConds(chain, orderTable string, orderType int, userAddr string, now int64) sqlConds {
+	var conds sqlConds
+	conds.Add("order_type = ?", orderType)
+	conds.Add("order_status = ?", multi.OrderStatusActive)
+	conds.Add("quantity_remaining > 0")
+	conds.Add("expire_time > ?", now)
+	if userAddr != "" {
+		conds.Add("maker != ?", userAddr)
+	}
+	conds.Add(orderbookActive(chain, orderTable))
+	return conds
+}
+
 // QueryBestBids 查询NFT的最佳出价信息
 // 该函数主要功能:
 // 1. 根据链名称、用户地址、集合地址和代币ID列表查询NFT的出价信息
@@ -388,111 +555,78 @@ func (d *Dao) QueryLastSalePrice(ctx context.Context, chain string,
 func (d *Dao) QueryBestBids(ctx context.Context, chain string, userAddr string,
 	collectionAddr string, tokenIds []string) ([]multi.Order, error) {
 	var bestBids []multi.Order
-	var sql string
 
-	// SQL解释:
-	// 1. 查询订单表中符合条件的出价记录
-	// 2. 条件包括:
-	//    - 指定集合地址
-	//    - 指定代币ID列表
-	//    - 订单类型为出价单
-	//    - 订单状态为激活
-	//    - 未过期
-	//    - 剩余数量大于0
-	//    - 如果指定用户地址,则排除该用户的出价
-	if userAddr == "" {
-		sql = fmt.Sprintf(`
-			SELECT order_id, token_id, event_time, price, salt, 
-				expire_time, maker, order_type, quantity_remaining, size   
-			FROM %s
-			WHERE collection_address = ?
-				AND token_id IN (?)
-				AND order_type = ?
-				AND order_status = ?
-				AND expire_time > ?
-				AND quantity_remaining > 0
-		`, multi.OrderTableName(chain))
-	} else {
-		sql = fmt.Sprintf(`
-			SELECT order_id, token_id, event_time, price, salt, 
-				expire_time, maker, order_type, quantity_remaining, size   
-			FROM %s
-			WHERE collection_address = ?
-				AND token_id IN (?)
-				AND order_type = ?
-				AND order_status = ?
-				AND expire_time > ?
-				AND quantity_remaining > 0
-				AND maker != '%s'
-		`, multi.OrderTableName(chain), userAddr)
-	}
-
-	if err := d.DB.Raw(sql, collectionAddr, tokenIds,
-		multi.ItemBidOrder, multi.OrderStatusActive,
-		time.Now().Unix()).Scan(&bestBids).Error; err != nil {
+	q, err := bestBidsQuery(d.tables, chain, userAddr, collectionAddr, tokenIds, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&bestBids).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get item best bids")
 	}
 
 	return bestBids, nil
 }
 
+// bestBidsQuery 生成集合内指定代币的有效Item出价查询
+func bestBidsQuery(tables chainTables, chain, userAddr, collectionAddr string, tokenIds []string, now int64) (*sqlQuery, error) {
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("collection_address = ?", collectionAddr)
+	conds.AddExpr(inExpr("token_id", tokenIds))
+	conds = append(conds, activeOrderConds(chain, orderTable, multi.ItemBidOrder, userAddr, now)...)
+
+	q := &sqlQuery{}
+	q.Add("select " + bidFields + " from " + orderTable + " ")
+	return q.Where(conds), nil
+}
+
 // QueryItemsBestBids 查询多个NFT Item的最高出价信息
 // 主要功能:
 // 1. 根据链名称、用户地址和Itemem信息列表查询ItemItem的最高出价订单
 // 2. 如果指定了用户地址,则排除该用户的出价
 // 3. 返回所有符合条件的有效订单(未过期且有剩余数量)
 func (d *Dao) QueryItemsBestBids(ctx context.Context, chain string, userAddr string, itemInfos []types.ItemInfo) ([]multi.Order, error) {
-	// 构建查询条件,将每个Item的集合地址和tokenID组合成(addr,tokenId)形式
-	var conditions []clause.Expr
-	for _, info := range itemInfos {
-		conditions = append(conditions, gorm.Expr("(?, ?)", info.CollectionAddress, info.TokenID))
-	}
-
 	var bestBids []multi.Order
-	var sql string
 
-	// 根据是否指定用户地址构建不同的SQL
-	if userAddr == "" {
-		// SQL解释:
-		// 1. 从订单表中查询订单详细信息
-		// 2. WHERE条件:
-		//   - 集合地址和tokenID匹配输入的Item列表
-		//   - 订单类型为Item出价单
-		//   - 订单状态为活跃
-		//   - 剩余数量大于0
-		//   - 未过期
-		sql = fmt.Sprintf(`
-SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining, size
-    FROM %s
-    WHERE (collection_address,token_id) IN (?)
-      AND order_type = ?
-      AND order_status = ?
-	  AND quantity_remaining > 0
-      AND expire_time > ?
-`, multi.OrderTableName(chain))
-	} else {
-		// SQL解释:
-		// 与上面相同,但增加了排除指定用户的条件
-		sql = fmt.Sprintf(`
-SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining,size 
-    FROM %s
-    WHERE (collection_address,token_id) IN (?)
-      AND order_type = ?
-      AND order_status = ?
-	  AND quantity_remaining > 0
-      AND expire_time > ?
-	  AND maker != '%s'
-`, multi.OrderTableName(chain), userAddr)
+	q, err := itemsBestBidsQuery(d.tables, chain, userAddr, itemInfos, time.Now().Unix())
+	if err != nil {
+		return nil, err
 	}
-
-	// 执行SQL查询
-	if err := d.DB.Raw(sql, conditions, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix()).Scan(&bestBids).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&bestBids).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get item best bids")
 	}
 
 	return bestBids, nil
 }
 
+// itemsBestBidsQuery 生成多个Item的有效出价查询,集合地址和tokenID组合成 (addr,tokenId) 匹配
+func itemsBestBidsQuery(tables chainTables, chain, userAddr string, itemInfos []types.ItemInfo, now int64) (*sqlQuery, error) {
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]interface{}
+	for _, info := range itemInfos {
+		rows = append(rows, []interface{}{info.CollectionAddress, info.TokenID})
+	}
+	var conds sqlConds
+	if len(rows) == 0 {
+		conds.Add("1 = 0")
+	} else {
+		conds.AddExpr(tupleInExpr([]string{"collection_address", "token_id"}, rows))
+	}
+	conds = append(conds, activeOrderConds(chain, orderTable, multi.ItemBidOrder, userAddr, now)...)
+
+	q := &sqlQuery{}
+	q.Add("select " + bidFields + " from " + orderTable + " ")
+	return q.Where(conds), nil
+}
+
 // QueryCollectionsBestBid 查询多个集合的最高出价信息
 // 该函数主要功能:
 // 1. 根据链名称、用户地址和集合地址列表查询每个集合的最高出价订单
@@ -501,42 +635,43 @@ SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_ty
 func (d *Dao) QueryCollectionsBestBid(ctx context.Context, chain string, userAddr string, collectionAddrs []string) ([]*multi.Order, error) {
 	var bestBid []*multi.Order
 
-	// SQL解释:
-	// 1. 主查询:从订单表中查询订单详细信息
-	sql := fmt.Sprintf(`
-		SELECT collection_address, order_id, price,event_time, expire_time, salt, maker, order_type, quantity_remaining, size  
-		FROM %s `, multi.OrderTableName(chain))
-
-	// 2. 子查询:获取每个集合的最高出价
-	sql += fmt.Sprintf(`where (collection_address,price) in (SELECT collection_address, max(price) as price FROM %s `, multi.OrderTableName(chain))
-
-	// 3. 子查询条件:
-	//   - 集合地址在给定列表中
-	//   - 订单类型为集合出价单
-	//   - 订单状态为活跃
-	//   - 剩余数量大于0
-	//   - 未过期
-	//   - 如果指定用户地址,则排除该用户
-	sql += `where collection_address in (?) and order_type = ? and order_status = ? and quantity_remaining > 0 and expire_time > ? `
-	if userAddr != "" {
-		sql += fmt.Sprintf(" and maker != '%s'", userAddr)
-	}
-	sql += `group by collection_address ) `
-
-	// 4. 主查询条件:与子查询条件相同
-	sql += `and order_type = ? and order_status = ? and quantity_remaining > 0 and expire_time > ? `
-	if userAddr != "" {
-		sql += fmt.Sprintf(" and maker != '%s'", userAddr)
+	q, err := collectionsBestBidQuery(d.tables, chain, userAddr, collectionAddrs, time.Now().Unix())
+	if err != nil {
+		return nil, err
 	}
-
-	// 5. 执行查询
-	if err := d.DB.Raw(sql, collectionAddrs, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix(), multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).Scan(&bestBid).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&bestBid).Error; err != nil {
 		return bestBid, errors.Wrap(err, "failed on get item best bids")
 	}
 
 	return bestBid, nil
 }
 
+// collectionsBestBidQuery 生成每个集合最高的有效集合出价查询:
+// 1. 子查询:获取给定集合中每个集合有效出价的最高价格
+// 2. 主查询:查询价格等于最高价格的有效出价,条件与子查询相同
+func collectionsBestBidQuery(tables chainTables, chain, userAddr string, collectionAddrs []string, now int64) (*sqlQuery, error) {
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var subConds sqlConds
+	subConds.AddExpr(inExpr("collection_address", collectionAddrs))
+	subConds = append(subConds, activeOrderConds(chain, "cb", multi.CollectionBidOrder, userAddr, now)...)
+	sub := &sqlQuery{}
+	sub.Add("select collection_address, max(price) as price from " + orderTable + " cb ")
+	sub.Where(subConds).Add("group by collection_address")
+
+	var conds sqlConds
+	conds.Add("(collection_address,price) in ("+sub.SQL()+")", sub.Args()...)
+	conds = append(conds, activeOrderConds(chain, "co", multi.CollectionBidOrder, userAddr, now)...)
+
+	q := &sqlQuery{}
+	q.Add("select collection_address, order_id, price, event_time, expire_time, salt, maker, order_type, " +
+		"quantity_remaining, size from " + orderTable + " co ")
+	return q.Where(conds), nil
+}
+
 // QueryCollectionBestBid 查询集合最高出价信息
 // 该函数主要功能:
 // 1. 根据链名称、用户地址和集合地址查询该集合的最高出价订单
@@ -545,48 +680,12 @@ func (d *Dao) QueryCollectionsBestBid(ctx context.Context, chain string, userAdd
 func (d *Dao) QueryCollectionBestBid(ctx context.Context, chain string,
 	userAddr string, collectionAddr string) (multi.Order, error) {
 	var bestBid multi.Order
-	var sql string
 
-	// SQL解释:
-	// 1. 从订单表中查询订单详细信息
-	// 2. 条件:
-	//   - 指定集合地址
-	//   - 订单类型为集合出价单
-	//   - 订单状态为活跃
-	//   - 剩余数量大于0
-	//   - 未过期
-	// 3. 按价格降序排序并限制返回1条记录
-	if userAddr == "" {
-		sql = fmt.Sprintf(`
-			SELECT order_id, price, event_time, expire_time, salt, maker, 
-				order_type, quantity_remaining, size  
-			FROM %s
-			WHERE collection_address = ?
-			AND order_type = ?
-			AND order_status = ?
-			AND quantity_remaining > 0
-			AND expire_time > ? 
-			ORDER BY price DESC 
-			LIMIT 1
-		`, multi.OrderTableName(chain))
-	} else {
-		sql = fmt.Sprintf(`
-			SELECT order_id, price, event_time, expire_time, salt, maker, 
-				order_type, quantity_remaining, size  
-			FROM %s
-			WHERE collection_address = ?
-			AND order_type = ?
-			AND order_status = ?
-			AND quantity_remaining > 0
-			AND expire_time > ? 
-			AND maker != '%s'
-			ORDER BY price DESC 
-			LIMIT 1
-		`, multi.OrderTableName(chain), userAddr)
-	}
-
-	if err := d.DB.Raw(sql, collectionAddr, multi.CollectionBidOrder,
-		multi.OrderStatusActive, time.Now().Unix()).Scan(&bestBid).Error; err != nil {
+	q, err := collectionTopBidsQuery(d.tables, chain, userAddr, collectionAddr, time.Now().Unix(), 1)
+	if err != nil {
+		return bestBid, err
+	}
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&bestBid).Error; err != nil {
 		return bestBid, errors.Wrap(err, "failed on get item best bids")
 	}
 
@@ -601,51 +700,12 @@ func (d *Dao) QueryCollectionBestBid(ctx context.Context, chain string,
 func (d *Dao) QueryCollectionTopNBid(ctx context.Context, chain string,
 	userAddr string, collectionAddr string, num int) ([]multi.Order, error) {
 	var bestBids []multi.Order
-	var sql string
 
-	// 根据是否指定用户地址构建不同的SQL
-	if userAddr == "" {
-		// SQL解释:
-		// 1. 查询订单基本信息(订单ID、价格、时间、过期时间等)
-		// 2. 条件:
-		//   - 指定集合地址
-		//   - 订单类型为集合出价单
-		//   - 订单状态为活跃
-		//   - 剩余数量大于0
-		//   - 未过期
-		// 3. 按价格降序排序并限制返回记录数
-		sql = fmt.Sprintf(`
-			SELECT order_id, price, event_time, expire_time, salt, maker, 
-				order_type, quantity_remaining, size 
-			FROM %s
-			WHERE collection_address = ?
-				AND order_type = ?
-				AND order_status = ?
-				AND quantity_remaining > 0
-				AND expire_time > ? 
-			ORDER BY price DESC 
-			LIMIT %d
-		`, multi.OrderTableName(chain), num)
-	} else {
-		// SQL与上面类似,增加了排除指定用户的条件(maker != userAddr)
-		sql = fmt.Sprintf(`
-			SELECT order_id, price, event_time, expire_time, salt, maker, 
-				order_type, quantity_remaining, size
-			FROM %s
-			WHERE collection_address = ?
-				AND order_type = ?
-				AND order_status = ?
-				AND quantity_remaining > 0
-				AND expire_time > ? 
-				AND maker != '%s'
-			ORDER BY price DESC 
-			LIMIT %d
-		`, multi.OrderTableName(chain), userAddr, num)
+	q, err := collectionTopBidsQuery(d.tables, chain, userAddr, collectionAddr, time.Now().Unix(), num)
+	if err != nil {
+		return nil, err
 	}
-
-	// 执行SQL查询
-	if err := d.DB.Raw(sql, collectionAddr, multi.CollectionBidOrder,
-		multi.OrderStatusActive, time.Now().Unix()).Scan(&bestBids).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&bestBids).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get item best bids")
 	}
 
@@ -664,6 +724,23 @@ func (d *Dao) QueryCollectionTopNBid(ctx context.Context, chain string,
 	return results[:num], nil
 }
 
+// collectionTopBidsQuery 生成集合中价格最高的 limit 个有效集合出价的查询,按价格降序排列
+func collectionTopBidsQuery(tables chainTables, chain, userAddr, collectionAddr string, now int64, limit int) (*sqlQuery, error) {
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("collection_address = ?", collectionAddr)
+	conds = append(conds, activeOrderConds(chain, orderTable, multi.CollectionBidOrder, userAddr, now)...)
+
+	q := &sqlQuery{}
+	q.Add("select order_id, price, event_time, expire_time, salt, maker, order_type, quantity_remaining, size " +
+		"from " + orderTable + " ")
+	return q.Where(conds).Add("order by price desc limit ?", limit), nil
+}
+
 var collectionDetailFields = []string{"id", "chain_id", "token_standard", "name", "address", "image_uri", "floor_price", "sale_price", "item_amount", "owner_amount"}
 
 const OrderType = 1
@@ -671,31 +748,13 @@ const OrderStatus = 0
 
 // QueryListedAmount 查询集合中已上架NFT的数量
 func (d *Dao) QueryListedAmount(ctx context.Context, chain string, collectionAddr string) (int64, error) {
-	// SQL解释:
-	// 1. 从Item表(ci)和订单表(co)联表查询
-	// 2. 关联条件:集合地址和tokenID都相同
-	// 3. 使用distinct去重统计不同的tokenID数量
-	// 4. WHERE条件:
-	//   - 指定集合地址
-	//   - 订单类型为listing(OrderType=1)
-	//   - 订单状态为active(OrderStatus=0)
-	//   - 卖家是NFT当前所有者
-	//   - 排除marketplace_id=1的订单
-	sql := fmt.Sprintf(`SELECT count(distinct (co.token_id)) as counts
-			FROM %s as ci
-					join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id
-			WHERE (co.collection_address=? and co.order_type = ? and
-				co.order_status = ? and co.maker = ci.owner and co.marketplace_id != ?)
-		`, multi.ItemTableName(chain), multi.OrderTableName(chain))
+	q, err := listedAmountQuery(d.tables, chain, collectionAddr)
+	if err != nil {
+		return 0, err
+	}
 
 	var counts int64
-	if err := d.DB.WithContext(ctx).Raw(
-		sql,
-		collectionAddr,
-		OrderType,
-		OrderStatus,
-		1,
-	).Scan(&counts).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&counts).Error; err != nil {
 		return 0, errors.Wrap(err, "failed on get listed item amount")
 	}
 
@@ -706,40 +765,78 @@ func (d *Dao) QueryListedAmount(ctx context.Context, chain string, collectionAdd
 func (d *Dao) QueryListedAmountEachCollection(ctx context.Context, chain string, collectionAddrs []string, userAddrs []string) ([]types.CollectionInfo, error) {
 	var counts []types.CollectionInfo
 
-	// SQL解释:
-	// 1. 从Item表(ci)和订单表(co)联表查询
-	// 2. 选择字段:
-	//    - ci.collection_address 作为 address
-	//    - count(distinct co.token_id) 作为 list_amount,统计每个集合中不重复的tokenID数量
-	// 3. 关联条件:集合地址和tokenID都相同
-	// 4. WHERE条件:
-	//    - 集合地址在给定列表中
-	//    - NFT所有者在给定用户列表中
-	//    - 订单类型为listing(OrderType=1)
-	//    - 订单状态为active(OrderStatus=0)
-	//    - 卖家是NFT当前所有者
-	//    - 排除marketplace_id=1的订单
-	// 5. 按集合地址分组,获取每个集合的统计结果
-	sql := fmt.Sprintf(`SELECT  ci.collection_address as address, count(distinct (co.token_id)) as list_amount
-			FROM %s as ci
-					join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id
-			WHERE (co.collection_address in (?) and ci.owner in (?) and co.order_type = ? and
-				co.order_status = ? and co.maker = ci.owner and co.marketplace_id != ?) group by ci.collection_address`,
-		multi.ItemTableName(chain), multi.OrderTableName(chain))
-	if err := d.DB.WithContext(ctx).Raw(
-		sql,
-		collectionAddrs,
-		userAddrs,
-		OrderType,
-		OrderStatus,
-		1,
-	).Scan(&counts).Error; err != nil {
+	q, err := listedAmountEachCollectionQuery(d.tables, chain, collectionAddrs, userAddrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(&counts).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get listed item amount")
 	}
 
 	return counts, nil
 }
 
+// listedAmountConds 已上架NFT的条件:
+//   - 订单类型为listing(OrderType=1)
+//   - 订单状态为active(OrderStatus=0)
+//   - 卖家是NFT当前所有者
+//   - 排除marketplace_id=1的订单
+func listedAmountConds(chain string) sqlConds {
+	var conds sqlConds
+	conds.Add("co.order_type = ?", OrderType)
+	conds.Add("co.order_status = ?", OrderStatus)
+	conds.Add(makerHoldsItem(chain, "co", "ci"))
+	conds.Add("co.marketplace_id != ?", 1)
+	return conds
+}
+
+// listedItemsFrom 从Item表(ci)和订单表(co)联表查询,关联条件为集合地址和tokenID都相同
+func listedItemsFrom(tables chainTables, chain string) (string, error) {
+	itemTable, err := tables.table(chain, multi.ItemTableName)
+	if err != nil {
+		return "", err
+	}
+	orderTable, err := tables.table(chain, multi.OrderTableName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("from %s as ci join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id ",
+		itemTable, orderTable), nil
+}
+
+// listedAmountQuery 生成集合中已上架NFT数量的查询,使用distinct去重统计不同的tokenID数量
+func listedAmountQuery(tables chainTables, chain, collectionAddr string) (*sqlQuery, error) {
+	from, err := listedItemsFrom(tables, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.Add("co.collection_address = ?", collectionAddr)
+	conds = append(conds, listedAmountConds(chain)...)
+
+	q := &sqlQuery{}
+	q.Add("select count(distinct (co.token_id)) as counts ").Add(from)
+	return q.Where(conds), nil
+}
+
+// listedAmountEachCollectionQuery 生成多个集合中用户已上架NFT数量的查询,按集合地址分组返回每个集合的数量
+func listedAmountEachCollectionQuery(tables chainTables, chain string, collectionAddrs []string, userAddrs []string) (*sqlQuery, error) {
+	from, err := listedItemsFrom(tables, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var conds sqlConds
+	conds.AddExpr(inExpr("co.collection_address", collectionAddrs))
+	conds.AddExpr(inExpr("co.maker", userAddrs))
+	conds = append(conds, listedAmountConds(chain)...)
+
+	q := &sqlQuery{}
+	q.Add("select ci.collection_address as address, count(distinct (co.token_id)) as list_amount ").Add(from)
+	return q.Where(conds).Add("group by ci.collection_address"), nil
+}
+
 type MultiChainItemInfo struct {
 	types.ItemInfo
 	ChainName string
@@ -754,81 +851,63 @@ func (d *Dao) QueryMultiChainUserItemsListInfo(ctx context.Context, userAddrs []
 	itemInfos []MultiChainItemInfo) ([]*CollectionItem, error) {
 	var collectionItems []*CollectionItem
 
-	// 构建用户地址参数字符串: 'addr1','addr2',...
-	var userAddrsParam string
-	for i, addr := range userAddrs {
-		userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-		if i < len(userAddrs)-1 {
-			userAddrsParam += ","
-		}
+	query, err := userItemsListQuery(d.tables, userAddrs, itemInfos, []int{multi.OrderStatusActive})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on build user multi chain items list query")
+	}
+	if query == nil {
+		return nil, nil
 	}
 
-	// 按链名称对Item信息分组
-	chainItems := make(map[string][]MultiChainItemInfo)
-	for _, itemInfo := range itemInfos {
-		items, ok := chainItems[strings.ToLower(itemInfo.ChainName)]
-		if ok {
-			items = append(items, itemInfo)
-			chainItems[strings.ToLower(itemInfo.ChainName)] = items
-		} else {
-			chainItems[strings.ToLower(itemInfo.ChainName)] = []MultiChainItemInfo{itemInfo}
-		}
+	// 执行SQL查询
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&collectionItems).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query user multi chain items list info")
 	}
 
-	// SQL语句组成部分
-	sqlHead := "SELECT * FROM (" // 外层查询开始
-	sqlTail := ") as combined"   // 外层查询结束
-	var sqlMids []string         // 存储每条链的子查询
+	return collectionItems, nil
+}
 
-	// 遍历每条链构建子查询
-	for chainName, items := range chainItems {
-		// 构建IN查询条件: (('addr1','id1'),('addr2','id2'),...)
-		tmpStat := fmt.Sprintf("(('%s','%s')", items[0].CollectionAddress, items[0].TokenID)
-		for i := 1; i < len(items); i++ {
-			tmpStat += fmt.Sprintf(",('%s','%s')", items[i].CollectionAddress, items[i].TokenID)
+// userItemsListQuery 生成多条链上用户Item的挂单查询,Item按链分组,每条链一个子查询。
+// 子查询的条件:匹配集合地址和tokenID、订单类型为listing、订单状态在statuses中、卖家仍持有该Item且在用户列表中
+func userItemsListQuery(tables chainTables, userAddrs []string, itemInfos []MultiChainItemInfo, statuses []int) (*sqlQuery, error) {
+	chains, chainItems := groupByChain(itemInfos, func(info MultiChainItemInfo) string { return info.ChainName })
+
+	return unionChains(chains, func(chainName string) (*sqlQuery, error) {
+		itemTable, err := tables.table(chainName, multi.ItemTableName)
+		if err != nil {
+			return nil, err
+		}
+		orderTable, err := tables.table(chainName, multi.OrderTableName)
+		if err != nil {
+			return nil, err
 		}
-		tmpStat += ") "
 
-		// 构建子查询SQL
-		sqlMid := "("
+		// 构建IN查询条件: ((?,?),(?,?),...)
+		var rows [][]interface{}
+		for _, item := range chainItems[chainName] {
+			rows = append(rows, []interface{}{item.CollectionAddress, item.TokenID})
+		}
+		var conds sqlConds
+		conds.AddExpr(tupleInExpr([]string{"co.collection_address", "co.token_id"}, rows))
+		conds.Add("co.order_type = ?", multi.ListingOrder)
+		conds.AddExpr(inExpr("co.order_status", statuses))
+		conds.Add(makerHoldsItem(chainName, "co", "ci"))
+		conds.AddExpr(inExpr("co.maker", userAddrs))
+
+		q := &sqlQuery{}
 		// 选择字段:Item基本信息、最低挂单价格、市场ID等
-		sqlMid += "select ci.id as id, ci.chain_id as chain_id,"
-		sqlMid += "ci.collection_address as collection_address,ci.token_id as token_id, ci.name as name, ci.owner as owner,"
-		sqlMid += "min(co.price) as list_price, " +
+		q.Add("select ci.id as id, ci.chain_id as chain_id," +
+			"ci.collection_address as collection_address,ci.token_id as token_id, ci.name as name, ci.owner as owner," +
+			"min(co.price) as list_price, " +
 			"SUBSTRING_INDEX(GROUP_CONCAT(co.marketplace_id ORDER BY co.price,co.marketplace_id),',', 1) " +
-			"AS market_id, min(co.price) != 0 as listing "
+			"AS market_id, min(co.price) != 0 as listing ")
 		// 关联Item表和订单表
-		sqlMid += fmt.Sprintf("from %s as ci ", multi.ItemTableName(chainName))
-		sqlMid += fmt.Sprintf("join %s co ", multi.OrderTableName(chainName))
-		sqlMid += "on co.collection_address=ci.collection_address and co.token_id=ci.token_id "
-		// 查询条件:匹配集合地址和tokenID、订单类型为listing、状态为active、卖家是Item所有者
-		sqlMid += "where (co.collection_address,co.token_id) in "
-		sqlMid += tmpStat
-		sqlMid += fmt.Sprintf("and co.order_type = %d and co.order_status=%d "+
-			"and co.maker = ci.owner and co.maker in (%s) ",
-			multi.ListingOrder, multi.OrderStatusActive, userAddrsParam)
-		sqlMid += "group by co.collection_address,co.token_id"
-		sqlMid += ")"
-
-		sqlMids = append(sqlMids, sqlMid)
-	}
-
-	// 使用UNION ALL组合所有子查询
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			sql += " UNION ALL " // 使用UNION ALL合并结果集
-		}
-		sql += sqlMids[i]
-	}
-	sql += sqlTail
-
-	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(sql).Scan(&collectionItems).Error; err != nil {
-		return nil, errors.Wrap(err, "failed on query user multi chain items list info")
-	}
-
-	return collectionItems, nil
+		q.Add(fmt.Sprintf("from %s as ci join %s co ", itemTable, orderTable))
+		q.Add("on co.collection_address=ci.collection_address and co.token_id=ci.token_id ")
+		q.Where(conds)
+		q.Add("group by co.collection_address,co.token_id")
+		return q, nil
+	})
 }
 
 // QueryMultiChainUserItemsExpireListInfo 查询多条链上用户Item的过期挂单信息
@@ -840,71 +919,16 @@ func (d *Dao) QueryMultiChainUserItemsExpireListInfo(ctx context.Context, userAd
 	itemInfos []MultiChainItemInfo) ([]*CollectionItem, error) {
 	var collectionItems []*CollectionItem
 
-	// 构建用户地址参数字符串: 'addr1','addr2',...
-	var userAddrsParam string
-	for i, addr := range userAddrs {
-		userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-		if i < len(userAddrs)-1 {
-			userAddrsParam += ","
-		}
+	query, err := userItemsListQuery(d.tables, userAddrs, itemInfos, []int{multi.OrderStatusActive, multi.OrderStatusExpired})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on build user multi chain items list query")
 	}
-
-	// SQL语句组成部分
-	sqlHead := "SELECT * FROM (" // 外层查询开始
-	sqlTail := ") as combined"   // 外层查询结束
-	var sqlMids []string         // 存储每个Item的子查询
-
-	// 构建IN查询条件: (('addr1','id1'),('addr2','id2'),...)
-	tmpStat := fmt.Sprintf("(('%s','%s')", itemInfos[0].CollectionAddress, itemInfos[0].TokenID)
-	for i := 1; i < len(itemInfos); i++ {
-		tmpStat += fmt.Sprintf(",('%s','%s')", itemInfos[i].CollectionAddress, itemInfos[i].TokenID)
+	if query == nil {
+		return nil, nil
 	}
-	tmpStat += ") "
-
-	// 遍历每个Item构建子查询
-	for _, info := range itemInfos {
-		sqlMid := "("
-		// 选择字段:Item基本信息、最低挂单价格、市场ID等
-		sqlMid += "select ci.id as id, ci.chain_id as chain_id,"
-		sqlMid += "ci.collection_address as collection_address,ci.token_id as token_id, " +
-			"ci.name as name, ci.owner as owner,"
-		sqlMid += "min(co.price) as list_price, " +
-			"SUBSTRING_INDEX(GROUP_CONCAT(co.marketplace_id ORDER BY co.price,co.marketplace_id),',', 1) " +
-			"AS market_id, min(co.price) != 0 as listing "
-
-		// 关联Item表和订单表
-		sqlMid += fmt.Sprintf("from %s as ci ", multi.ItemTableName(info.ChainName))
-		sqlMid += fmt.Sprintf("join %s co ", multi.OrderTableName(info.ChainName))
-		sqlMid += "on co.collection_address=ci.collection_address and co.token_id=ci.token_id "
-
-		// 查询条件:
-		// 1. 匹配集合地址和tokenID
-		// 2. 订单类型为listing
-		// 3. 订单状态为active或expired
-		// 4. 卖家是Item所有者且在用户列表中
-		sqlMid += "where (co.collection_address,co.token_id) in "
-		sqlMid += tmpStat
-		sqlMid += fmt.Sprintf("and co.order_type = %d and (co.order_status=%d or co.order_status=%d) "+
-			"and co.maker = ci.owner and co.maker in (%s) ",
-			multi.ListingOrder, multi.OrderStatusActive, multi.OrderStatusExpired, userAddrsParam)
-		sqlMid += "group by co.collection_address,co.token_id"
-		sqlMid += ")"
-
-		sqlMids = append(sqlMids, sqlMid)
-	}
-
-	// 使用UNION ALL组合所有子查询
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			sql += " UNION ALL " // 使用UNION ALL合并结果集
-		}
-		sql += sqlMids[i]
-	}
-	sql += sqlTail
 
 	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(sql).Scan(&collectionItems).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&collectionItems).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on query user multi chain items list info")
 	}
 
@@ -935,7 +959,7 @@ func (d *Dao) QueryItemListInfo(ctx context.Context, chain, collectionAddr, toke
 		Joins(fmt.Sprintf("join %s co on co.collection_address=ci.collection_address and co.token_id=ci.token_id",
 			coTableName)).
 		Where("ci.collection_address =? and ci.token_id = ? and co.order_type = ? and co.order_status=? "+
-			"and co.maker = ci.owner",
+			"and "+makerHoldsItem(chain, "co", "ci")+" and "+orderbookActive(chain, "co"),
 			collectionAddr, tokenID, multi.ListingOrder, multi.OrderStatusActive).
 		Group("ci.collection_address,ci.token_id").
 		Scan(&collectionItem).Error
@@ -1019,64 +1043,47 @@ type MultiChainItemPriceInfo struct {
 func (d *Dao) QueryMultiChainListingInfo(ctx context.Context, priceInfos []MultiChainItemPriceInfo) ([]multi.Order, error) {
 	var orders []multi.Order
 
-	// 按链名称对价格信息分组
-	chainItemPrices := make(map[string][]MultiChainItemPriceInfo)
-	for _, priceInfo := range priceInfos {
-		items, ok := chainItemPrices[strings.ToLower(priceInfo.ChainName)]
-		if ok {
-			items = append(items, priceInfo)
-			chainItemPrices[strings.ToLower(priceInfo.ChainName)] = items
-		} else {
-			chainItemPrices[strings.ToLower(priceInfo.ChainName)] = []MultiChainItemPriceInfo{priceInfo}
-		}
+	query, err := listingInfoQuery(d.tables, priceInfos)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on build user multi chain order list query")
 	}
-
-	// SQL语句组成部分
-	sqlHead := "SELECT * FROM (" // 外层查询开始
-	sqlTail := ") as combined"   // 外层查询结束
-	var sqlMids []string         // 存储每条链的子查询
-
-	// 遍历每条链构建子查询
-	for chainName, priceInfos := range chainItemPrices {
-		// 构建IN查询条件: (('addr1','id1','maker1',status1,price1),...)
-		tmpStat := fmt.Sprintf("(('%s','%s','%s',%d, %s)", priceInfos[0].CollectionAddress, priceInfos[0].TokenID, priceInfos[0].Maker, priceInfos[0].OrderStatus, priceInfos[0].Price.String())
-		for i := 1; i < len(priceInfos); i++ {
-			tmpStat += fmt.Sprintf(",('%s','%s','%s',%d, %s)", priceInfos[i].CollectionAddress, priceInfos[i].TokenID, priceInfos[i].Maker, priceInfos[i].OrderStatus, priceInfos[i].Price.String())
-		}
-		tmpStat += ") "
-
-		// 构建子查询SQL:
-		// 1. 选择订单的基本字段
-		// 2. 从对应链的订单表查询
-		// 3. 匹配集合地址、代币ID、创建者、状态和价格
-		sqlMid := "("
-		sqlMid += "select collection_address,token_id,order_id,salt,event_time,expire_time,maker "
-		sqlMid += fmt.Sprintf("from %s ", multi.OrderTableName(chainName))
-		sqlMid += "where (collection_address,token_id,maker,order_status,price) in "
-		sqlMid += tmpStat
-		sqlMid += ")"
-
-		sqlMids = append(sqlMids, sqlMid)
-	}
-
-	// 使用UNION ALL组合所有子查询
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			sql += " UNION ALL " // 使用UNION ALL合并结果集
-		}
-		sql += sqlMids[i]
+	if query == nil {
+		return nil, nil
 	}
-	sql += sqlTail
 
 	// 执行SQL查询
-	if err := d.DB.WithContext(ctx).Raw(sql).Scan(&orders).Error; err != nil {
+	if err := d.DB.WithContext(ctx).Raw(query.SQL(), query.Args()...).Scan(&orders).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on query user multi chain order list info")
 	}
 
 	return orders, nil
 }
 
+// listingInfoQuery 按链分组生成挂单查询,匹配集合地址、代币ID、创建者、状态和价格
+func listingInfoQuery(tables chainTables, priceInfos []MultiChainItemPriceInfo) (*sqlQuery, error) {
+	chains, chainItemPrices := groupByChain(priceInfos, func(info MultiChainItemPriceInfo) string { return info.ChainName })
+
+	return unionChains(chains, func(chainName string) (*sqlQuery, error) {
+		orderTable, err := tables.table(chainName, multi.OrderTableName)
+		if err != nil {
+			return nil, err
+		}
+
+		// 构建IN查询条件: ((?,?,?,?,?),...)
+		var rows [][]interface{}
+		for _, info := range chainItemPrices[chainName] {
+			rows = append(rows, []interface{}{info.CollectionAddress, info.TokenID, info.Maker, info.OrderStatus, info.Price})
+		}
+
+		q := &sqlQuery{}
+		q.Add("select collection_address,token_id,order_id,salt,event_time,expire_time,maker ")
+		q.Add(fmt.Sprintf("from %s ", orderTable))
+		q.Add("where ").AddExpr(tupleInExpr(
+			[]string{"collection_address", "token_id", "maker", "order_status", "price"}, rows))
+		return q, nil
+	})
+}
+
 // QueryItemListingAcrossPlatforms 查询NFT在各平台的挂单价格信息
 func (d *Dao) QueryItemListingAcrossPlatforms(ctx context.Context, chain, collectionAddr, tokenID string, user []string) ([]types.ListingInfo, error) {
 	var listings []types.ListingInfo
@@ -1087,7 +1094,7 @@ func (d *Dao) QueryItemListingAcrossPlatforms(ctx context.Context, chain, collec
 			tokenID,
 			user,
 			multi.ListingOrder,
-			multi.OrderStatusActive).Group("marketplace_id").Scan(&listings).Error; err != nil {
+			multi.OrderStatusActive).Where(orderbookActive(chain, multi.OrderTableName(chain))).Group("marketplace_id").Scan(&listings).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on query listing from db")
 	}
 
@@ -1178,11 +1185,11 @@ func (d *Dao) QueryItemBids(ctx context.Context, chain string, collectionAddr, t
 			"quantity_remaining as bid_unfilled, size as bid_size").
 		// 查询条件1:集合级别的出价 - 匹配集合地址,订单类型为集合出价,状态为活跃,未过期且有剩余数量
 		Where("collection_address = ? and order_type = ? and order_status = ? "+
-			"and expire_time > ? and quantity_remaining > 0",
+			"and expire_time > ? and quantity_remaining > 0 and "+orderbookActive(chain, multi.OrderTableName(chain)),
 			collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
 		// 查询条件2:Item级别的出价 - 匹配集合地址和代币ID,订单类型为Item出价,其他条件同上
 		Or("collection_address = ? and token_id=? and order_type = ? and order_status = ? "+
-			"and expire_time > ? and quantity_remaining > 0",
+			"and expire_time > ? and quantity_remaining > 0 and "+orderbookActive(chain, multi.OrderTableName(chain)),
 			collectionAddr, tokenID, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix())
 
 	// 查询总记录数
@@ -0,0 +1,186 @@
+package dao
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CacheCountPrefix 游标分页总数的缓存键前缀
+const CacheCountPrefix = "cache:es:count:"
+
+const (
+	// DefaultPageLimit 游标分页未指定每页数量时的默认值
+	DefaultPageLimit = 20
+	// MaxPageLimit 游标分页每页数量的上限
+	MaxPageLimit = 100
+
+	// countCacheSeconds 总数的缓存时间，缓存期间返回的总数是近似值
+	countCacheSeconds = 30
+)
+
+// sortKey 游标分页的一个排序键。Expr 为排序表达式，Nullable 表示表达式可能为 null，
+// null 按 MySQL 的规则在升序时排在最前、降序时排在最后
+type sortKey struct {
+	Expr     string
+	Desc     bool
+	Nullable bool
+}
+
+// KeysetPage 游标分页的读取位置：读取排在 After 之后（Backward 时为之前）的 Limit 行，
+// After 为某一行各排序键的值，为空时从第一行（Backward 时为最后一行）开始读取
+type KeysetPage struct {
+	After    []interface{}
+	Backward bool
+	Limit    int
+}
+
+// PageEdges 一页第一行和最后一行的排序键，分别用于生成向前和向后翻页的游标，为空表示该方向没有更多的行
+type PageEdges struct {
+	Prev []interface{}
+	Next []interface{}
+}
+
+// NormalizeLimit 把游标分页的每页数量限制在 [1, MaxPageLimit]，未指定时使用 DefaultPageLimit
+func NormalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(limit, MaxPageLimit)
+}
+
+// orderBy 生成 order by 的排序列表，backward 时每个键都反向排序
+func orderBy(keys []sortKey, backward bool) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Desc != backward {
+			parts = append(parts, key.Expr+" desc")
+		} else {
+			parts = append(parts, key.Expr+" asc")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keysetAfter 生成排在 values 之后（backward 时为之前）的行的条件，inclusive 时也包含排序键全部相等的行。
+// 按排序键展开为 (k1 > v1) or (k1 = v1 and k2 > v2) or ...，不使用行比较，便于 MySQL 使用索引
+func keysetAfter(keys []sortKey, values []interface{}, backward, inclusive bool) sqlExpr {
+	var ors []string
+	var args []interface{}
+	var prefix []string
+	var prefixArgs []interface{}
+	for i, key := range keys {
+		var v interface{}
+		if i < len(values) {
+			v = values[i]
+		}
+		if after, afterArgs, ok := keyAfter(key, v, key.Desc != backward); ok {
+			ors = append(ors, "("+strings.Join(append(append([]string{}, prefix...), after), " and ")+")")
+			args = append(append(args, prefixArgs...), afterArgs...)
+		}
+		if v == nil {
+			prefix = append(prefix, key.Expr+" is null")
+		} else {
+			prefix = append(prefix, key.Expr+" = ?")
+			prefixArgs = append(prefixArgs, v)
+		}
+	}
+	if inclusive {
+		ors = append(ors, "("+strings.Join(prefix, " and ")+")")
+		args = append(args, prefixArgs...)
+	}
+	if len(ors) == 0 {
+		return sqlExpr{sql: "1 = 0"}
+	}
+	return sqlExpr{sql: "(" + strings.Join(ors, " or ") + ")", args: args}
+}
+
+// keyAfter 生成一个排序键排在 v 之后的条件，没有这样的值时 ok 为 false
+func keyAfter(key sortKey, v interface{}, desc bool) (string, []interface{}, bool) {
+	switch {
+	case v == nil && desc:
+		// null 已经排在降序的最后
+		return "", nil, false
+	case v == nil:
+		return key.Expr + " is not null", nil, true
+	case desc && key.Nullable:
+		return "(" + key.Expr + " < ? or " + key.Expr + " is null)", []interface{}{v}, true
+	case desc:
+		return key.Expr + " < ?", []interface{}{v}, true
+	default:
+		return key.Expr + " > ?", []interface{}{v}, true
+	}
+}
+
+// pageEdges 处理按 page 方向多读取一行的查询结果：去掉多读的一行，Backward 时恢复为正常的顺序，
+// 并返回用于翻页的第一行和最后一行的排序键
+func pageEdges[T any](rows []T, page KeysetPage, key func(T) []interface{}) ([]T, PageEdges) {
+	more := len(rows) > page.Limit
+	if more {
+		rows = rows[:page.Limit]
+	}
+	var edges PageEdges
+	if len(rows) == 0 {
+		return rows, edges
+	}
+	// 读取的位置来自相邻的一页，读取方向的反方向一定还有行
+	if page.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+		if more {
+			edges.Prev = key(rows[0])
+		}
+		if len(page.After) > 0 {
+			edges.Next = key(rows[len(rows)-1])
+		}
+	} else {
+		if more {
+			edges.Next = key(rows[len(rows)-1])
+		}
+		if len(page.After) > 0 {
+			edges.Prev = key(rows[0])
+		}
+	}
+	return rows, edges
+}
+
+// countCacheKey 总数的缓存键，parts 为查询的名称和条件，条件较长，使用摘要
+func countCacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return CacheCountPrefix + hex.EncodeToString(sum[:16])
+}
+
+// cachedCount 优先从缓存获取总数，没有缓存时调用 count 统计并缓存 countCacheSeconds 秒
+func (d *Dao) cachedCount(ctx context.Context, cacheKey string, count func() (int64, error)) (int64, error) {
+	strNum, err := d.KvStore.Get(cacheKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get count from cache")
+	}
+	if strNum != "" {
+		total, _ := strconv.ParseInt(strNum, 10, 64)
+		return total, nil
+	}
+
+	total, err := count()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on count rows")
+	}
+	if err := d.KvStore.Setex(cacheKey, strconv.FormatInt(total, 10), countCacheSeconds); err != nil {
+		return 0, errors.Wrap(err, "failed on cache count")
+	}
+	return total, nil
+}
+
+// countRows 执行 countQuery 生成的查询
+func (d *Dao) countRows(ctx context.Context, count *sqlQuery) func() (int64, error) {
+	return func() (int64, error) {
+		var total int64
+		err := d.DB.WithContext(ctx).Raw(count.SQL(), count.Args()...).Scan(&total).Error
+		return total, err
+	}
+}
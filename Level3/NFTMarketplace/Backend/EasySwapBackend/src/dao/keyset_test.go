@@ -0,0 +1,140 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeysetAfter(t *testing.T) {
+	keys := []sortKey{{Expr: "event_time", Desc: true}, {Expr: "id", Desc: true}}
+	e := keysetAfter(keys, []interface{}{int64(100), int64(7)}, false, false)
+	if e.sql != "((event_time < ?) or (event_time = ? and id < ?))" ||
+		!reflect.DeepEqual(e.args, []interface{}{int64(100), int64(100), int64(7)}) {
+		t.Fatalf("unexpected keyset %+v", e)
+	}
+
+	// 向前翻页时反向比较，inclusive 时包含排序键相等的行
+	e = keysetAfter(keys, []interface{}{int64(100), int64(7)}, true, true)
+	if e.sql != "((event_time > ?) or (event_time = ? and id > ?) or (event_time = ? and id = ?))" ||
+		!reflect.DeepEqual(e.args, []interface{}{int64(100), int64(100), int64(7), int64(100), int64(7)}) {
+		t.Fatalf("unexpected backward keyset %+v", e)
+	}
+}
+
+func TestKeysetAfterNullable(t *testing.T) {
+	keys := []sortKey{{Expr: "owned_time", Desc: true, Nullable: true}, {Expr: "token_id", Desc: true}}
+
+	// 降序时 null 排在最后，非 null 的值之后还有 null
+	e := keysetAfter(keys, []interface{}{int64(100), "1"}, false, false)
+	if e.sql != "(((owned_time < ? or owned_time is null)) or (owned_time = ? and token_id < ?))" ||
+		!reflect.DeepEqual(e.args, []interface{}{int64(100), int64(100), "1"}) {
+		t.Fatalf("unexpected nullable keyset %+v", e)
+	}
+
+	// 游标的值为 null 时只能在 null 的行内继续
+	e = keysetAfter(keys, []interface{}{nil, "1"}, false, false)
+	if e.sql != "((owned_time is null and token_id < ?))" || !reflect.DeepEqual(e.args, []interface{}{"1"}) {
+		t.Fatalf("unexpected null keyset %+v", e)
+	}
+
+	// 向前翻页时 null 之前是全部非 null 的行
+	e = keysetAfter(keys, []interface{}{nil, "1"}, true, false)
+	if e.sql != "((owned_time is not null) or (owned_time is null and token_id > ?))" || !reflect.DeepEqual(e.args, []interface{}{"1"}) {
+		t.Fatalf("unexpected backward null keyset %+v", e)
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	keys := []sortKey{{Expr: "list_price"}, {Expr: "id", Desc: true}}
+	if s := orderBy(keys, false); s != "list_price asc, id desc" {
+		t.Fatalf("unexpected order by %s", s)
+	}
+	if s := orderBy(keys, true); s != "list_price desc, id asc" {
+		t.Fatalf("unexpected backward order by %s", s)
+	}
+}
+
+func TestNormalizeLimit(t *testing.T) {
+	for limit, want := range map[int]int{0: DefaultPageLimit, -1: DefaultPageLimit, 5: 5, MaxPageLimit + 1: MaxPageLimit} {
+		if got := NormalizeLimit(limit); got != want {
+			t.Fatalf("NormalizeLimit(%d) = %d, want %d", limit, got, want)
+		}
+	}
+}
+
+func TestActivityKeysetQuery(t *testing.T) {
+	sub := func(table, conds string) string {
+		return "(select ? as chain_name,id,collection_address,token_id,currency_address,activity_type," +
+			"maker,taker,price,tx_hash,event_time,marketplace_id from " + table + " " + conds + "order by event_time desc, id desc limit ?)"
+	}
+
+	// 第一页没有游标条件，每条链多读取一行
+	q, err := activityKeysetQuery(testTables, []string{"eth", "sepolia"}, ActivityFilter{TokenID: "7"}, KeysetPage{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "SELECT * FROM ("+sub("ob_activity_eth", "where token_id = ? ")+" UNION ALL "+
+		sub("ob_activity_sepolia", "where token_id = ? ")+") as combined "+
+		"ORDER BY combined.event_time desc, combined.id desc, combined.chain_name desc limit ?",
+		"eth", "7", 3, "sepolia", "7", 3, 3)
+
+	// 游标行在 sepolia 上，链名更小的 eth 包含时间和 ID 相同的行
+	keyset := "((event_time < ?) or (event_time = ? and id < ?)"
+	q, err = activityKeysetQuery(testTables, []string{"eth", "sepolia"}, ActivityFilter{},
+		KeysetPage{After: []interface{}{int64(100), int64(7), "sepolia"}, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "SELECT * FROM ("+sub("ob_activity_eth", "where "+keyset+" or (event_time = ? and id = ?)) ")+" UNION ALL "+
+		sub("ob_activity_sepolia", "where "+keyset+") ")+") as combined "+
+		"ORDER BY combined.event_time desc, combined.id desc, combined.chain_name desc limit ?",
+		"eth", int64(100), int64(100), int64(7), int64(100), int64(7), 3,
+		"sepolia", int64(100), int64(100), int64(7), 3, 3)
+}
+
+func TestUserItemsKeysetQuery(t *testing.T) {
+	union, err := userItemsUnion(testTables, []string{"eth"}, []string{"0xa"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unionArgs := union.Args()
+
+	assertQuery(t, userItemsKeysetQuery(union, KeysetPage{Limit: 10}), union.SQL()+
+		" ORDER BY combined.owned_time desc, combined.chain_id desc, combined.collection_address desc, combined.token_id desc LIMIT ?",
+		append(append([]interface{}{}, unionArgs...), 11)...)
+
+	q := userItemsKeysetQuery(union, KeysetPage{After: []interface{}{nil, int64(1), "0xc", "5"}, Backward: true, Limit: 10})
+	assertQuery(t, q, union.SQL()+" WHERE ((combined.owned_time is not null) or "+
+		"(combined.owned_time is null and combined.chain_id > ?) or "+
+		"(combined.owned_time is null and combined.chain_id = ? and combined.collection_address > ?) or "+
+		"(combined.owned_time is null and combined.chain_id = ? and combined.collection_address = ? and combined.token_id > ?))"+
+		" ORDER BY combined.owned_time asc, combined.chain_id asc, combined.collection_address asc, combined.token_id asc LIMIT ?",
+		append(append([]interface{}{}, unionArgs...), int64(1), int64(1), "0xc", int64(1), "0xc", "5", 11)...)
+}
+
+func TestPageEdges(t *testing.T) {
+	key := func(v int) []interface{} { return []interface{}{v} }
+
+	// 第一页：多读的一行说明还有下一页，没有上一页
+	rows, edges := pageEdges([]int{9, 8, 7}, KeysetPage{Limit: 2}, key)
+	if !reflect.DeepEqual(rows, []int{9, 8}) || edges.Prev != nil || !reflect.DeepEqual(edges.Next, key(8)) {
+		t.Fatalf("unexpected first page %v %+v", rows, edges)
+	}
+
+	// 最后一页：从相邻的一页翻过来，只有上一页
+	rows, edges = pageEdges([]int{6, 5}, KeysetPage{After: key(7), Limit: 2}, key)
+	if !reflect.DeepEqual(rows, []int{6, 5}) || !reflect.DeepEqual(edges.Prev, key(6)) || edges.Next != nil {
+		t.Fatalf("unexpected last page %v %+v", rows, edges)
+	}
+
+	// 向前翻页：按反向顺序读取，恢复为正常顺序
+	rows, edges = pageEdges([]int{7, 8, 9}, KeysetPage{After: key(6), Backward: true, Limit: 2}, key)
+	if !reflect.DeepEqual(rows, []int{8, 7}) || !reflect.DeepEqual(edges.Prev, key(8)) || !reflect.DeepEqual(edges.Next, key(7)) {
+		t.Fatalf("unexpected backward page %v %+v", rows, edges)
+	}
+
+	rows, edges = pageEdges([]int{}, KeysetPage{After: key(1), Limit: 2}, key)
+	if len(rows) != 0 || edges.Prev != nil || edges.Next != nil {
+		t.Fatalf("unexpected empty page %v %+v", rows, edges)
+	}
+}
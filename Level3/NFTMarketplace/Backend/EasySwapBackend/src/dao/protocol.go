@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// QueryProtocolStates 查询指定链上订单簿合约的全局状态（手续费比例、资产托管合约、是否暂停、owner）。
+// 状态由同步服务根据合约事件维护，每个订单簿合约一行。
+func (d *Dao) QueryProtocolStates(ctx context.Context, chain string) ([]multi.ProtocolState, error) {
+	var states []multi.ProtocolState
+	if err := d.DB.WithContext(ctx).Table(multi.ProtocolStateTableName(chain)).
+		Order("id asc").
+		Find(&states).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get protocol states")
+	}
+
+	return states, nil
+}
+
+// orderbookActive 生成订单所属的订单簿合约未暂停的SQL条件，orderTable 是订单表在查询中的表名或别名。
+// 合约暂停期间拒绝该合约的所有撮合，挂单和出价都不可成交，最优挂单、出价等查询需加上该条件
+func orderbookActive(chain, orderTable string) string {
+	return fmt.Sprintf("not exists (select 1 from %s ps where ps.contract_address = %s.contract_address and ps.paused = 1)",
+		multi.ProtocolStateTableName(chain), orderTable)
+}
+
+// QueryOrderFailures 查询订单在链上处理失败（被合约跳过、批量撮合失败）的记录
+func (d *Dao) QueryOrderFailures(ctx context.Context, chain string, orderIds []string) ([]multi.OrderFailure, error) {
+	var failures []multi.OrderFailure
+	if err := d.DB.WithContext(ctx).Table(multi.OrderFailureTableName(chain)).
+		Where("order_id in (?)", orderIds).
+		Order("block_number desc, log_index desc").
+		Find(&failures).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get order failures")
+	}
+
+	return failures, nil
+}
@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestOrderbookActive(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderTable := multi.OrderTableName("sepolia")
+	stateTable := multi.ProtocolStateTableName("sepolia")
+	for _, stmt := range []string{
+		"create table " + orderTable + " (order_id varchar(66), contract_address varchar(42))",
+		"create table " + stateTable + " (contract_address varchar(42), paused tinyint)",
+		// 同一条链上一个订单簿合约已暂停，另一个正常
+		"insert into " + stateTable + " values ('0xpaused', 1), ('0xactive', 0)",
+		"insert into " + orderTable + " values ('0x01', '0xpaused'), ('0x02', '0xactive'), ('0x03', '0xunknown')",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只过滤已暂停合约的订单，其他合约的订单不受影响
+	var orderIds []string
+	if err := db.Table(orderTable).Where(orderbookActive("sepolia", orderTable)).
+		Order("order_id").Pluck("order_id", &orderIds).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orderIds) != 2 || orderIds[0] != "0x02" || orderIds[1] != "0x03" {
+		t.Fatalf("unexpected active orders %v", orderIds)
+	}
+
+	// 订单表使用别名时按别名关联
+	orderIds = nil
+	if err := db.Table(orderTable+" as co").Where(orderbookActive("sepolia", "co")).
+		Order("co.order_id").Pluck("co.order_id", &orderIds).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orderIds) != 2 || orderIds[0] != "0x02" || orderIds[1] != "0x03" {
+		t.Fatalf("unexpected active orders with alias %v", orderIds)
+	}
+}
@@ -0,0 +1,170 @@
+package dao
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedChain 查询的链不在配置的 ChainSupported 中
+var ErrUnsupportedChain = errors.New("unsupported chain")
+
+// chainTables 允许查询的链，多链查询的表名只能由这里的链名生成，避免把请求中的链名拼进 SQL
+type chainTables map[string]bool
+
+func newChainTables(chains []string) chainTables {
+	tables := make(chainTables, len(chains))
+	for _, chain := range chains {
+		tables[strings.ToLower(chain)] = true
+	}
+	return tables
+}
+
+// table 返回链对应的表名，name 为 multi.XTableName 这类表名函数
+func (t chainTables) table(chain string, name func(string) string) (string, error) {
+	chain = strings.ToLower(chain)
+	if !t[chain] {
+		return "", errors.Wrapf(ErrUnsupportedChain, "chain %q", chain)
+	}
+	return name(chain), nil
+}
+
+// sqlExpr 一段 SQL 及其绑定参数
+type sqlExpr struct {
+	sql  string
+	args []interface{}
+}
+
+func expr(sql string, args ...interface{}) sqlExpr {
+	return sqlExpr{sql: sql, args: args}
+}
+
+// placeholders 生成 n 个以逗号分隔的占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// inExpr 生成 column in (?,?,...)，列表在这里展开成占位符，不依赖驱动对切片参数的处理。
+// values 为空时生成恒假的条件，与空的 in 列表语义相同
+func inExpr[T any](column string, values []T) sqlExpr {
+	if len(values) == 0 {
+		return sqlExpr{sql: "1 = 0"}
+	}
+	args := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return sqlExpr{sql: fmt.Sprintf("%s in (%s)", column, placeholders(len(values))), args: args}
+}
+
+// tupleInExpr 生成 (c1,c2) in ((?,?),(?,?),...)，rows 中每一行的长度必须等于列数
+func tupleInExpr(columns []string, rows [][]interface{}) sqlExpr {
+	tuple := "(" + placeholders(len(columns)) + ")"
+	tuples := make([]string, 0, len(rows))
+	var args []interface{}
+	for _, row := range rows {
+		tuples = append(tuples, tuple)
+		args = append(args, row...)
+	}
+	return sqlExpr{
+		sql:  fmt.Sprintf("(%s) in (%s)", strings.Join(columns, ","), strings.Join(tuples, ",")),
+		args: args,
+	}
+}
+
+// sqlConds 以 and 连接的过滤条件
+type sqlConds []sqlExpr
+
+func (c *sqlConds) Add(sql string, args ...interface{}) {
+	*c = append(*c, expr(sql, args...))
+}
+
+func (c *sqlConds) AddExpr(e sqlExpr) {
+	*c = append(*c, e)
+}
+
+// expr 合并为一个条件，没有条件时 sql 为空
+func (c sqlConds) expr() sqlExpr {
+	var e sqlExpr
+	parts := make([]string, 0, len(c))
+	for _, cond := range c {
+		parts = append(parts, cond.sql)
+		e.args = append(e.args, cond.args...)
+	}
+	e.sql = strings.Join(parts, " and ")
+	return e
+}
+
+// sqlQuery 按顺序拼接 SQL 片段和绑定参数，生成的 SQL 只包含占位符，值全部在 Args 中
+type sqlQuery struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+func (q *sqlQuery) Add(sql string, args ...interface{}) *sqlQuery {
+	q.sql.WriteString(sql)
+	q.args = append(q.args, args...)
+	return q
+}
+
+func (q *sqlQuery) AddExpr(e sqlExpr) *sqlQuery {
+	return q.Add(e.sql, e.args...)
+}
+
+// Where 追加 where 子句，没有条件时不追加
+func (q *sqlQuery) Where(conds sqlConds) *sqlQuery {
+	if len(conds) == 0 {
+		return q
+	}
+	return q.Add("where ").AddExpr(conds.expr()).Add(" ")
+}
+
+func (q *sqlQuery) SQL() string {
+	return q.sql.String()
+}
+
+func (q *sqlQuery) Args() []interface{} {
+	return q.args
+}
+
+// unionChains 为每条链生成一个子查询，用 UNION ALL 合并成 select * from (...) as combined，
+// 排序、分页由调用方继续追加。chains 为空时返回 nil。
+func unionChains(chains []string, sub func(chain string) (*sqlQuery, error)) (*sqlQuery, error) {
+	if len(chains) == 0 {
+		return nil, nil
+	}
+	q := &sqlQuery{}
+	q.Add("SELECT * FROM (")
+	for i, chain := range chains {
+		s, err := sub(chain)
+		if err != nil {
+			return nil, err
+		}
+		if i != 0 {
+			q.Add(" UNION ALL ")
+		}
+		q.Add("(").Add(s.SQL(), s.Args()...).Add(")")
+	}
+	q.Add(") as combined")
+	return q, nil
+}
+
+// countQuery 统计 union 查询的总行数，union 为 unionChains 返回的、还没有追加排序和分页的查询
+func countQuery(union *sqlQuery) *sqlQuery {
+	return (&sqlQuery{}).Add("SELECT COUNT(*) FROM (").Add(union.SQL(), union.Args()...).Add(") as counted")
+}
+
+// groupByChain 按链名（小写）分组，保持链第一次出现的顺序
+func groupByChain[T any](values []T, chain func(T) string) ([]string, map[string][]T) {
+	var chains []string
+	groups := make(map[string][]T)
+	for _, v := range values {
+		name := strings.ToLower(chain(v))
+		if _, ok := groups[name]; !ok {
+			chains = append(chains, name)
+		}
+		groups[name] = append(groups[name], v)
+	}
+	return chains, groups
+}
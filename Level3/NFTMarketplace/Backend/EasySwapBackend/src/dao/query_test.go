@@ -0,0 +1,316 @@
+package dao
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+var testTables = newChainTables([]string{"eth", "Sepolia"})
+
+func assertQuery(t *testing.T, q *sqlQuery, sql string, args ...interface{}) {
+	t.Helper()
+	if q == nil {
+		t.Fatal("expected query, got nil")
+	}
+	if q.SQL() != sql {
+		t.Fatalf("unexpected sql\n got: %s\nwant: %s", q.SQL(), sql)
+	}
+	if !reflect.DeepEqual(q.Args(), args) {
+		t.Fatalf("unexpected args\n got: %#v\nwant: %#v", q.Args(), args)
+	}
+	if n := strings.Count(sql, "?"); n != len(args) {
+		t.Fatalf("sql has %d placeholders but %d args", n, len(args))
+	}
+}
+
+func TestInExpr(t *testing.T) {
+	e := inExpr("maker", []string{"0xa", "0xb"})
+	if e.sql != "maker in (?,?)" || !reflect.DeepEqual(e.args, []interface{}{"0xa", "0xb"}) {
+		t.Fatalf("unexpected in expr %+v", e)
+	}
+
+	// 空列表不匹配任何行
+	e = inExpr[int]("activity_type", nil)
+	if e.sql != "1 = 0" || len(e.args) != 0 {
+		t.Fatalf("unexpected empty in expr %+v", e)
+	}
+
+	e = tupleInExpr([]string{"collection_address", "token_id"},
+		[][]interface{}{{"0xc", "1"}, {"0xc", "2"}})
+	if e.sql != "(collection_address,token_id) in ((?,?),(?,?))" ||
+		!reflect.DeepEqual(e.args, []interface{}{"0xc", "1", "0xc", "2"}) {
+		t.Fatalf("unexpected tuple in expr %+v", e)
+	}
+}
+
+func TestChainTables(t *testing.T) {
+	table, err := testTables.table("SEPOLIA", multi.OrderTableName)
+	if err != nil || table != "ob_order_sepolia" {
+		t.Fatalf("unexpected table %q, err %v", table, err)
+	}
+
+	// 不在配置中的链不能拼进表名
+	for _, chain := range []string{"", "polygon", "eth; drop table ob_order_eth"} {
+		if _, err := testTables.table(chain, multi.OrderTableName); !errors.Is(err, ErrUnsupportedChain) {
+			t.Fatalf("expected unsupported chain for %q, got %v", chain, err)
+		}
+	}
+	if _, err := activityUnion(testTables, []string{"eth", "polygon"}, ActivityFilter{}); !errors.Is(err, ErrUnsupportedChain) {
+		t.Fatalf("expected unsupported chain, got %v", err)
+	}
+}
+
+func TestActivityQuery(t *testing.T) {
+	union, err := activityUnion(testTables, []string{"eth", "sepolia"}, ActivityFilter{
+		CollectionAddrs: []string{"0xc1", "0xc2"},
+		TokenID:         "7",
+		UserAddrs:       []string{"0xAB"},
+		EventTypes:      []int{multi.Sale, multi.Listing},
+		StartTime:       100,
+		EndTime:         200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := func(table string) string {
+		return "(select ? as chain_name,id,collection_address,token_id,currency_address,activity_type," +
+			"maker,taker,price,tx_hash,event_time,marketplace_id from " + table + " " +
+			"where (maker in (?) or taker in (?)) and collection_address in (?,?) and token_id = ? " +
+			"and activity_type in (?,?) and event_time >= ? and event_time <= ? )"
+	}
+	subArgs := func(chain string) []interface{} {
+		return []interface{}{chain, "0xab", "0xab", "0xc1", "0xc2", "7", multi.Sale, multi.Listing, int64(100), int64(200)}
+	}
+	unionSQL := "SELECT * FROM (" + sub("ob_activity_eth") + " UNION ALL " + sub("ob_activity_sepolia") + ") as combined"
+	unionArgs := append(subArgs("eth"), subArgs("sepolia")...)
+
+	assertQuery(t, activityPageQuery(union, 3, 20),
+		unionSQL+" ORDER BY combined.event_time DESC, combined.id DESC limit ? offset ?",
+		append(unionArgs, 20, 40)...)
+	assertQuery(t, countQuery(union), "SELECT COUNT(*) FROM ("+unionSQL+") as counted", unionArgs...)
+
+	// 没有过滤条件时不生成 where
+	union, err = activityUnion(testTables, []string{"eth"}, ActivityFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, union, "SELECT * FROM ((select ? as chain_name,id,collection_address,token_id,currency_address,activity_type,"+
+		"maker,taker,price,tx_hash,event_time,marketplace_id from ob_activity_eth )) as combined", "eth")
+}
+
+func TestActivityQueryBindsValues(t *testing.T) {
+	evil := "0x1' or '1'='1"
+	union, err := activityUnion(testTables, []string{"eth"}, ActivityFilter{
+		CollectionAddrs: []string{evil},
+		TokenID:         evil,
+		UserAddrs:       []string{evil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(union.SQL(), "'") {
+		t.Fatalf("value leaked into sql: %s", union.SQL())
+	}
+}
+
+func TestUserCollectionsQuery(t *testing.T) {
+	q, err := userCollectionsQuery(testTables, []string{"eth"}, []string{"0xa", "0xb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "SELECT * FROM ((select gc.address as address, gc.name as name, gc.floor_price as floor_price, "+
+		"gc.chain_id as chain_id, gc.item_amount as item_amount, gc.symbol as symbol, gc.image_uri as image_uri, "+
+		"count(*) as item_count from ob_collection_eth as gc join ob_item_eth as gi on gc.address = gi.collection_address "+
+		"where gi.owner in (?,?) group by gc.address)) as combined "+
+		"ORDER BY combined.floor_price * CAST(combined.item_count AS DECIMAL) DESC",
+		"0xa", "0xb")
+
+	q, err = userCollectionsQuery(testTables, nil, []string{"0xa"})
+	if err != nil || q != nil {
+		t.Fatalf("expected no query without chains, got %v %v", q, err)
+	}
+}
+
+func TestUserItemsQuery(t *testing.T) {
+	union, err := userItemsUnion(testTables, []string{"eth"}, []string{"0xa"}, []string{"0xc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unionSQL := "SELECT * FROM ((select gi.chain_id as chain_id, gi.collection_address as collection_address, " +
+		"gi.token_id as token_id, gi.name as name, gi.owner as owner, sub.last_event_time as owned_time " +
+		"from ob_item_eth gi left join (select sgi.collection_address, sgi.token_id, max(sga.event_time) as last_event_time " +
+		"from ob_item_eth sgi join ob_activity_eth sga on sgi.collection_address = sga.collection_address and sgi.token_id = sga.token_id " +
+		"where sgi.owner in (?) and sga.activity_type = ? and sgi.collection_address in (?) " +
+		"group by sgi.collection_address, sgi.token_id) sub on gi.collection_address = sub.collection_address and gi.token_id = sub.token_id " +
+		"where gi.owner in (?) and gi.collection_address in (?) )) as combined"
+	unionArgs := []interface{}{"0xa", multi.Sale, "0xc", "0xa", "0xc"}
+
+	// 第 2 页跳过第 1 页的全部记录
+	assertQuery(t, userItemsPageQuery(union, 2, 10),
+		unionSQL+" ORDER BY combined.owned_time DESC LIMIT ? OFFSET ?", append(unionArgs, 10, 10)...)
+	assertQuery(t, countQuery(union), "SELECT COUNT(*) FROM ("+unionSQL+") as counted", unionArgs...)
+}
+
+func TestUserItemsListQuery(t *testing.T) {
+	items := []MultiChainItemInfo{
+		{ItemInfo: types.ItemInfo{CollectionAddress: "0xc", TokenID: "1"}, ChainName: "Sepolia"},
+		{ItemInfo: types.ItemInfo{CollectionAddress: "0xd", TokenID: "2"}, ChainName: "eth"},
+		{ItemInfo: types.ItemInfo{CollectionAddress: "0xc", TokenID: "3"}, ChainName: "sepolia"},
+	}
+	q, err := userItemsListQuery(testTables, []string{"0xa"}, items, []int{multi.OrderStatusActive, multi.OrderStatusExpired})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按链第一次出现的顺序分组，同一条链的 Item 合并到一个子查询
+	sub := func(chain, tuples string) string {
+		return "(select ci.id as id, ci.chain_id as chain_id,ci.collection_address as collection_address,ci.token_id as token_id, " +
+			"ci.name as name, ci.owner as owner,min(co.price) as list_price, " +
+			"SUBSTRING_INDEX(GROUP_CONCAT(co.marketplace_id ORDER BY co.price,co.marketplace_id),',', 1) AS market_id, " +
+			"min(co.price) != 0 as listing from ob_item_" + chain + " as ci join ob_order_" + chain + " co " +
+			"on co.collection_address=ci.collection_address and co.token_id=ci.token_id " +
+			"where (co.collection_address,co.token_id) in (" + tuples + ") and co.order_type = ? and co.order_status in (?,?) and " +
+			makerHoldsItem(chain, "co", "ci") + " and co.maker in (?) group by co.collection_address,co.token_id)"
+	}
+	assertQuery(t, q, "SELECT * FROM ("+sub("sepolia", "(?,?),(?,?)")+" UNION ALL "+sub("eth", "(?,?)")+") as combined",
+		"0xc", "1", "0xc", "3", multi.ListingOrder, multi.OrderStatusActive, multi.OrderStatusExpired, "0xa",
+		"0xd", "2", multi.ListingOrder, multi.OrderStatusActive, multi.OrderStatusExpired, "0xa")
+
+	q, err = userItemsListQuery(testTables, []string{"0xa"}, nil, []int{multi.OrderStatusActive})
+	if err != nil || q != nil {
+		t.Fatalf("expected no query without items, got %v %v", q, err)
+	}
+}
+
+func TestListingInfoQuery(t *testing.T) {
+	price := decimal.RequireFromString("1.5")
+	q, err := listingInfoQuery(testTables, []MultiChainItemPriceInfo{{
+		ItemPriceInfo: types.ItemPriceInfo{CollectionAddress: "0xc", TokenID: "1", Maker: "0xa", Price: price, OrderStatus: multi.OrderStatusActive},
+		ChainName:     "eth",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "SELECT * FROM ((select collection_address,token_id,order_id,salt,event_time,expire_time,maker "+
+		"from ob_order_eth where (collection_address,token_id,maker,order_status,price) in ((?,?,?,?,?)))) as combined",
+		"0xc", "1", "0xa", multi.OrderStatusActive, price)
+}
+
+func TestItemsExternalQuery(t *testing.T) {
+	q, err := itemsExternalQuery(testTables, []MultiChainItemInfo{
+		{ItemInfo: types.ItemInfo{CollectionAddress: "0xc", TokenID: "1"}, ChainName: "eth"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "SELECT * FROM ((select collection_address, token_id, is_uploaded_oss, image_uri, oss_uri "+
+		"from ob_item_external_eth where (collection_address,token_id) in ((?,?)))) as combined", "0xc", "1")
+
+	_, err = itemsExternalQuery(testTables, []MultiChainItemInfo{
+		{ItemInfo: types.ItemInfo{CollectionAddress: "0xc", TokenID: "1"}, ChainName: "polygon"},
+	})
+	if !errors.Is(err, ErrUnsupportedChain) {
+		t.Fatalf("expected unsupported chain, got %v", err)
+	}
+}
+
+func TestBidQueries(t *testing.T) {
+	active := func(table string) string {
+		return "order_type = ? and order_status = ? and quantity_remaining > 0 and expire_time > ? and maker != ? and " +
+			orderbookActive("eth", table)
+	}
+
+	q, err := bestBidsQuery(testTables, "eth", "0xa", "0xc", []string{"1", "2"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select "+bidFields+" from ob_order_eth "+
+		"where collection_address = ? and token_id in (?,?) and "+active("ob_order_eth")+" ",
+		"0xc", "1", "2", multi.ItemBidOrder, multi.OrderStatusActive, int64(100), "0xa")
+
+	// 不指定用户时不排除任何出价
+	q, err = collectionTopBidsQuery(testTables, "eth", "", "0xc", 100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select order_id, price, event_time, expire_time, salt, maker, order_type, quantity_remaining, size "+
+		"from ob_order_eth where collection_address = ? and order_type = ? and order_status = ? and quantity_remaining > 0 "+
+		"and expire_time > ? and "+orderbookActive("eth", "ob_order_eth")+" order by price desc limit ?",
+		"0xc", multi.CollectionBidOrder, multi.OrderStatusActive, int64(100), 3)
+
+	// 子查询和主查询使用不同的别名，订单簿合约暂停的条件分别关联各自的订单
+	q, err = collectionsBestBidQuery(testTables, "eth", "0xa", []string{"0xc", "0xd"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select collection_address, order_id, price, event_time, expire_time, salt, maker, order_type, "+
+		"quantity_remaining, size from ob_order_eth co where (collection_address,price) in ("+
+		"select collection_address, max(price) as price from ob_order_eth cb where collection_address in (?,?) and "+
+		active("cb")+" group by collection_address) and "+active("co")+" ",
+		"0xc", "0xd", multi.CollectionBidOrder, multi.OrderStatusActive, int64(100), "0xa",
+		multi.CollectionBidOrder, multi.OrderStatusActive, int64(100), "0xa")
+
+	q, err = itemsBestBidsQuery(testTables, "eth", "", nil, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select "+bidFields+" from ob_order_eth where 1 = 0 and order_type = ? and order_status = ? "+
+		"and quantity_remaining > 0 and expire_time > ? and "+orderbookActive("eth", "ob_order_eth")+" ",
+		multi.ItemBidOrder, multi.OrderStatusActive, int64(100))
+
+	if _, err := bestBidsQuery(testTables, "polygon", "", "0xc", []string{"1"}, 100); !errors.Is(err, ErrUnsupportedChain) {
+		t.Fatalf("expected unsupported chain, got %v", err)
+	}
+}
+
+func TestListedAmountQuery(t *testing.T) {
+	from := "from ob_item_eth as ci join ob_order_eth co on co.collection_address = ci.collection_address and co.token_id = ci.token_id "
+	listed := "co.order_type = ? and co.order_status = ? and " + makerHoldsItem("eth", "co", "ci") + " and co.marketplace_id != ?"
+
+	q, err := listedAmountQuery(testTables, "eth", "0xc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select count(distinct (co.token_id)) as counts "+from+"where co.collection_address = ? and "+listed+" ",
+		"0xc", OrderType, OrderStatus, 1)
+
+	q, err = listedAmountEachCollectionQuery(testTables, "eth", []string{"0xc", "0xd"}, []string{"0xa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select ci.collection_address as address, count(distinct (co.token_id)) as list_amount "+from+
+		"where co.collection_address in (?,?) and co.maker in (?) and "+listed+" group by ci.collection_address",
+		"0xc", "0xd", "0xa", OrderType, OrderStatus, 1)
+
+	q, err = floorPriceQuery(testTables, "eth", "0xc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select co.price as price "+from+"where co.collection_address = ? and "+listed+" and "+
+		orderbookActive("eth", "co")+" order by co.price asc limit 1", "0xc", OrderType, OrderStatus, 1)
+
+	if _, err := listedAmountQuery(testTables, "polygon", "0xc"); !errors.Is(err, ErrUnsupportedChain) {
+		t.Fatalf("expected unsupported chain, got %v", err)
+	}
+}
+
+func TestLastSalePriceQuery(t *testing.T) {
+	q, err := lastSalePriceQuery(testTables, "eth", "0xc", []string{"1", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuery(t, q, "select a.collection_address, a.token_id, a.price from ob_activity_eth a "+
+		"join (select collection_address, token_id, max(event_time) as max_event_time from ob_activity_eth "+
+		"where collection_address = ? and token_id in (?,?) and activity_type = ? group by collection_address, token_id) grouped "+
+		"on a.collection_address = grouped.collection_address and a.token_id = grouped.token_id "+
+		"and a.event_time = grouped.max_event_time and a.activity_type = ?",
+		"0xc", "1", "2", multi.Sale, multi.Sale)
+}
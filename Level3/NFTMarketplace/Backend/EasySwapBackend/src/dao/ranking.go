@@ -1,22 +1,30 @@
 package dao
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 )
 
+// CollectionTrade 集合在一个时间窗口内的成交统计，变化率为与上一个等长窗口相比的百分比
 type CollectionTrade struct {
 	ContractAddress string          `json:"contract_address"`
 	ItemCount       int64           `json:"item_count"`
 	Volume          decimal.Decimal `json:"volume"`
 	VolumeChange    int             `json:"volume_change"`
-	PreFloorPrice   decimal.Decimal `json:"pre_floor_price"`
+	MinPrice        decimal.Decimal `json:"min_price"`
+	AvgPrice        decimal.Decimal `json:"avg_price"`
+	MaxPrice        decimal.Decimal `json:"max_price"`
+	FloorPrice      decimal.Decimal `json:"floor_price"`     // 窗口结束时的地板价快照
+	PreFloorPrice   decimal.Decimal `json:"pre_floor_price"` // 窗口开始时的地板价快照
 	FloorChange     int             `json:"floor_change"`
 }
 
@@ -24,197 +32,187 @@ func GenRankingKey(project, chain string, period int) string {
 	return fmt.Sprintf("cache:%s:%s:ranking:volume:%d", strings.ToLower(project), strings.ToLower(chain), period)
 }
 
-type periodEpochMap map[string]int
+// windowStats 集合在一个窗口内各个桶的成交统计之和
+type windowStats struct {
+	CollectionAddress string
+	SalesCount        int64
+	Volume            decimal.Decimal
+	MinPrice          decimal.Decimal
+	MaxPrice          decimal.Decimal
+}
 
-var periodToEpoch = periodEpochMap{
-	"15m": 3,
-	"1h":  12,
-	"6h":  72,
-	"24h": 288,
-	"1d":  288,
-	"7d":  2016,
-	"30d": 8640,
+// floorPrice 集合在某一时刻的地板价快照
+type floorPrice struct {
+	CollectionAddress string
+	FloorPrice        decimal.Decimal
 }
 
-// GetTradeInfoByCollection 获取指定时间段内集合的交易统计信息
-func (d *Dao) GetTradeInfoByCollection(chain, collectionAddr, period string) (*CollectionTrade, error) {
-	// 查询当前时间段的交易信息
-	var tradeCount int64
-	var totalVolume decimal.Decimal
-	var floorPrice decimal.Decimal
-
-	// 获取时间段对应的epoch值
-	epoch, ok := periodToEpoch[period]
-	if !ok {
-		return nil, errors.Errorf("invalid period: %s", period)
-	}
-	// 计算查询的时间范围
-	startTime := time.Now().Add(-time.Duration(epoch) * time.Minute)
-	endTime := time.Now()
-
-	// 统计当前时间段内的交易数量和总交易额
-	err := d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Where("collection_address = ? AND activity_type = ? AND event_time >= ? AND event_time <= ?",
-			collectionAddr, multi.Sale, startTime, endTime).
-		Select("COUNT(*) as trade_count, COALESCE(SUM(price), 0) as total_volume").
-		Row().Scan(&tradeCount, &totalVolume)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get trade count and volume")
+// windowStatsQuery 对覆盖窗口的各段桶求和，collectionAddr 为空时统计全部集合
+func windowStatsQuery(table string, segments []collectionstats.Segment, collectionAddr string) *sqlQuery {
+	var buckets []string
+	var args []interface{}
+	for _, s := range segments {
+		buckets = append(buckets, "(bucket = ? and bucket_start >= ? and bucket_start < ?)")
+		args = append(args, s.Bucket, s.Start, s.End)
 	}
-
-	// 获取当前时间段内的地板价(最低成交价)
-	err = d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Where("collection_address = ? AND activity_type = ? AND event_time >= ? AND event_time <= ?",
-			collectionAddr, multi.Sale, startTime, endTime).
-		Select("COALESCE(MIN(price), 0)").
-		Row().Scan(&floorPrice)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get floor price")
+	var conds sqlConds
+	if len(buckets) == 0 {
+		conds.Add("1 = 0")
+	} else {
+		conds.Add("("+strings.Join(buckets, " or ")+")", args...)
+	}
+	conds.Add("sales_count > 0")
+	if collectionAddr != "" {
+		conds.Add("collection_address = ?", strings.ToLower(collectionAddr))
 	}
 
-	// 计算上一个时间段的时间范围
-	prevStartTime := startTime.Add(-time.Duration(epoch) * time.Minute)
-	prevEndTime := startTime
-
-	var prevVolume decimal.Decimal
-	var prevFloorPrice decimal.Decimal
+	q := &sqlQuery{}
+	q.Add("select collection_address, sum(sales_count) as sales_count, coalesce(sum(volume), 0) as volume, " +
+		"coalesce(min(min_price), 0) as min_price, coalesce(max(max_price), 0) as max_price from " + table + " ")
+	return q.Where(conds).Add("group by collection_address")
+}
 
-	// 获取上一时段的总交易额
-	err = d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Where("collection_address = ? AND activity_type = ? AND event_time >= ? AND event_time <= ?",
-			collectionAddr, multi.Sale, prevStartTime, prevEndTime).
-		Select("COALESCE(SUM(price), 0)").
-		Row().Scan(&prevVolume)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get previous volume")
+// floorAtQuery 查询时刻 t 的地板价，即 t 之前（含 t）最近的一次快照，collectionAddr 为空时查询全部集合
+func floorAtQuery(table string, t int64, collectionAddr string) *sqlQuery {
+	var conds sqlConds
+	conds.Add("floor_time > 0 and floor_time <= ?", t)
+	if collectionAddr != "" {
+		conds.Add("collection_address = ?", strings.ToLower(collectionAddr))
 	}
 
-	// 获取上一时段的地板价
-	err = d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Where("collection_address = ? AND activity_type = ? AND event_time >= ? AND event_time <= ?",
-			collectionAddr, multi.Sale, prevStartTime, prevEndTime).
-		Select("COALESCE(MIN(price), 0)").
-		Row().Scan(&prevFloorPrice)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get previous floor price")
+	q := &sqlQuery{}
+	q.Add("select s.collection_address, s.floor_price from " + table + " s join " +
+		"(select collection_address, max(floor_time) as floor_time from " + table + " ")
+	return q.Where(conds).Add("group by collection_address) l " +
+		"on s.collection_address = l.collection_address and s.floor_time = l.floor_time")
+}
+
+// percentChange 计算 cur 相对 prev 的变化百分比，prev 为 0 时返回 0
+func percentChange(cur, prev decimal.Decimal) int {
+	if prev.IsZero() {
+		return 0
 	}
+	return int(cur.Sub(prev).Div(prev).Mul(decimal.NewFromInt(100)).IntPart())
+}
 
-	// 计算交易额和地板价的变化百分比
-	volumeChange := 0
-	floorChange := 0
+// mergeTrades 合并当前窗口、上一窗口的成交统计和窗口两端的地板价，
+// 窗口内有成交或者有地板价快照的集合都会出现在结果中，结果按成交额降序排列
+func mergeTrades(cur, prev []windowStats, floors, preFloors []floorPrice) []*CollectionTrade {
+	trades := make(map[string]*CollectionTrade)
+	get := func(addr string) *CollectionTrade {
+		addr = strings.ToLower(addr)
+		trade, ok := trades[addr]
+		if !ok {
+			trade = &CollectionTrade{ContractAddress: addr}
+			trades[addr] = trade
+		}
+		return trade
+	}
 
-	// 如果上一时段交易额不为0,计算交易额变化百分比
-	if !prevVolume.IsZero() {
-		volumeChangeDecimal := totalVolume.Sub(prevVolume).Div(prevVolume).Mul(decimal.NewFromInt(100))
-		volumeChange = int(volumeChangeDecimal.IntPart())
+	for _, s := range cur {
+		trade := get(s.CollectionAddress)
+		trade.ItemCount = s.SalesCount
+		trade.Volume = s.Volume
+		trade.MinPrice = s.MinPrice
+		trade.MaxPrice = s.MaxPrice
+		if s.SalesCount > 0 {
+			trade.AvgPrice = s.Volume.Div(decimal.NewFromInt(s.SalesCount))
+		}
+	}
+	for _, f := range floors {
+		get(f.CollectionAddress).FloorPrice = f.FloorPrice
 	}
-	// 如果上一时段地板价不为0,计算地板价变化百分比
-	if !prevFloorPrice.IsZero() {
-		floorChangeDecimal := floorPrice.Sub(prevFloorPrice).Div(prevFloorPrice).Mul(decimal.NewFromInt(100))
-		floorChange = int(floorChangeDecimal.IntPart())
+	prevVolumes := make(map[string]decimal.Decimal, len(prev))
+	for _, s := range prev {
+		prevVolumes[strings.ToLower(s.CollectionAddress)] = s.Volume
+	}
+	preFloorPrices := make(map[string]decimal.Decimal, len(preFloors))
+	for _, f := range preFloors {
+		preFloorPrices[strings.ToLower(f.CollectionAddress)] = f.FloorPrice
 	}
 
-	// 返回集合交易统计信息
-	return &CollectionTrade{
-		ContractAddress: collectionAddr,
-		ItemCount:       tradeCount,
-		Volume:          totalVolume,
-		VolumeChange:    volumeChange,
-		PreFloorPrice:   prevFloorPrice,
-		FloorChange:     floorChange,
-	}, nil
+	result := make([]*CollectionTrade, 0, len(trades))
+	for addr, trade := range trades {
+		trade.VolumeChange = percentChange(trade.Volume, prevVolumes[addr])
+		trade.PreFloorPrice = preFloorPrices[addr]
+		trade.FloorChange = percentChange(trade.FloorPrice, trade.PreFloorPrice)
+		result = append(result, trade)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Volume.Equal(result[j].Volume) {
+			return result[i].Volume.GreaterThan(result[j].Volume)
+		}
+		return result[i].ContractAddress < result[j].ContractAddress
+	})
+	return result
 }
 
-// 根据Activity获取集合排行榜信息
-func (d *Dao) GetCollectionRankingByActivity(chain, period string) ([]*CollectionTrade, error) {
-	// 解析时间范围
-	// 获取时间段对应的epoch值
-	epoch, ok := periodToEpoch[period]
-	if !ok {
-		return nil, errors.Errorf("invalid period: %s", period)
-	}
-	// 计算查询的时间范围
-	startTime := time.Now().Add(-time.Duration(epoch) * time.Minute)
-	endTime := time.Now()
-
-	// 计算上一个时间段
-	prevEndTime := startTime
-	prevStartTime := startTime.Add(-time.Duration(epoch) * time.Minute)
-
-	// 获取当前时间段的交易统计
-	type TradeStats struct {
-		CollectionAddress string
-		ItemCount         int64
-		Volume            decimal.Decimal
-		FloorPrice        decimal.Decimal
-	}
-
-	var currentStats []TradeStats
-	err := d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Select("collection_address, COUNT(*) as item_count, COALESCE(SUM(price), 0) as volume, COALESCE(MIN(price), 0) as floor_price").
-		Where("activity_type = ? AND event_time >= ? AND event_time <= ?", multi.Sale, startTime, endTime).
-		Group("collection_address").
-		Find(&currentStats).Error
+// queryCollectionTrades 从集合统计表读取截止到当前时间的 period 窗口的成交统计，
+// 与上一个等长窗口比较得到成交额和地板价的变化，collectionAddr 为空时查询全部集合
+func (d *Dao) queryCollectionTrades(ctx context.Context, chain, collectionAddr, period string) ([]*CollectionTrade, error) {
+	table, err := d.tables.table(chain, multi.CollectionStatsTableName)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get current stats")
+		return nil, err
 	}
-
-	// 获取上一时间段的交易统计
-	var prevStats []TradeStats
-	err = d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Select("collection_address, COUNT(*) as item_count, COALESCE(SUM(price), 0) as volume, COALESCE(MIN(price), 0) as floor_price").
-		Where("activity_type = ? AND event_time >= ? AND event_time <= ?", multi.Sale, prevStartTime, prevEndTime).
-		Group("collection_address").
-		Find(&prevStats).Error
+	start, end, err := collectionstats.Window(period, time.Now().Unix())
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get previous stats")
+		return nil, err
 	}
-
-	// 构建上一时间段数据的map
-	prevStatsMap := make(map[string]TradeStats)
-	for _, stat := range prevStats {
-		prevStatsMap[stat.CollectionAddress] = stat
+	prevStart := start - (end - start)
+
+	var cur, prev []windowStats
+	for _, w := range []struct {
+		stats      *[]windowStats
+		start, end int64
+	}{{&cur, start, end}, {&prev, prevStart, start}} {
+		q := windowStatsQuery(table, collectionstats.Segments(w.start, w.end), collectionAddr)
+		if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(w.stats).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on query collection stats")
+		}
 	}
 
-	// 构建结果
-	var result []*CollectionTrade
-	for _, curr := range currentStats {
-		trade := &CollectionTrade{
-			ContractAddress: curr.CollectionAddress,
-			ItemCount:       curr.ItemCount,
-			Volume:          curr.Volume,
-			VolumeChange:    0,
-			PreFloorPrice:   decimal.Zero,
-			FloorChange:     0,
+	var floors, preFloors []floorPrice
+	for _, f := range []struct {
+		floors *[]floorPrice
+		t      int64
+	}{{&floors, end}, {&preFloors, start}} {
+		q := floorAtQuery(table, f.t, collectionAddr)
+		if err := d.DB.WithContext(ctx).Raw(q.SQL(), q.Args()...).Scan(f.floors).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on query collection floor snapshot")
 		}
+	}
 
-		// 计算变化率
-		if prev, ok := prevStatsMap[curr.CollectionAddress]; ok {
-			trade.PreFloorPrice = prev.FloorPrice
-
-			if !prev.Volume.IsZero() {
-				volumeChangeDecimal := curr.Volume.Sub(prev.Volume).Div(prev.Volume).Mul(decimal.NewFromInt(100))
-				trade.VolumeChange = int(volumeChangeDecimal.IntPart())
-			}
-
-			if !prev.FloorPrice.IsZero() {
-				floorChangeDecimal := curr.FloorPrice.Sub(prev.FloorPrice).Div(prev.FloorPrice).Mul(decimal.NewFromInt(100))
-				trade.FloorChange = int(floorChangeDecimal.IntPart())
-			}
-		}
+	return mergeTrades(cur, prev, floors, preFloors), nil
+}
 
-		result = append(result, trade)
+// GetTradeInfoByCollection 获取指定时间段内集合的交易统计信息
+func (d *Dao) GetTradeInfoByCollection(ctx context.Context, chain, collectionAddr, period string) (*CollectionTrade, error) {
+	trades, err := d.queryCollectionTrades(ctx, chain, collectionAddr, period)
+	if err != nil {
+		return nil, err
+	}
+	if len(trades) == 0 {
+		return &CollectionTrade{ContractAddress: strings.ToLower(collectionAddr)}, nil
 	}
+	return trades[0], nil
+}
 
-	return result, nil
+// GetCollectionRankingByStats 根据集合统计表获取指定时间段内全部集合的交易统计，按成交额降序排列
+func (d *Dao) GetCollectionRankingByStats(ctx context.Context, chain, period string) ([]*CollectionTrade, error) {
+	return d.queryCollectionTrades(ctx, chain, "", period)
 }
 
-// 获取指定COllection的交易总量
-func (d *Dao) GetCollectionVolume(chain, collectionAddr string) (decimal.Decimal, error) {
+// GetCollectionVolume 获取指定集合的历史总成交额，1d 桶覆盖了全部成交记录
+func (d *Dao) GetCollectionVolume(ctx context.Context, chain, collectionAddr string) (decimal.Decimal, error) {
+	table, err := d.tables.table(chain, multi.CollectionStatsTableName)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
 	var volume decimal.Decimal
-	err := d.DB.WithContext(d.ctx).Table(multi.ActivityTableName(chain)).
-		Where("collection_address = ? AND activity_type = ?", collectionAddr, multi.Sale).
-		Select("COALESCE(SUM(price), 0)").
+	err = d.DB.WithContext(ctx).Table(table).
+		Where("collection_address = ? AND bucket = ?", strings.ToLower(collectionAddr), collectionstats.Bucket1d).
+		Select("COALESCE(SUM(volume), 0)").
 		Row().Scan(&volume)
 	if err != nil {
 		return decimal.Zero, errors.Wrap(err, "failed to get collection volume")
@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
+	"github.com/shopspring/decimal"
+)
+
+func TestWindowStatsQuery(t *testing.T) {
+	segments := []collectionstats.Segment{
+		{Bucket: collectionstats.Bucket5m, Start: 600, End: 3600},
+		{Bucket: collectionstats.Bucket1h, Start: 3600, End: 7200},
+	}
+	assertQuery(t, windowStatsQuery("ob_collection_stats_eth", segments, "0xAB"),
+		"select collection_address, sum(sales_count) as sales_count, coalesce(sum(volume), 0) as volume, "+
+			"coalesce(min(min_price), 0) as min_price, coalesce(max(max_price), 0) as max_price from ob_collection_stats_eth "+
+			"where ((bucket = ? and bucket_start >= ? and bucket_start < ?) or (bucket = ? and bucket_start >= ? and bucket_start < ?)) "+
+			"and sales_count > 0 and collection_address = ? group by collection_address",
+		collectionstats.Bucket5m, int64(600), int64(3600), collectionstats.Bucket1h, int64(3600), int64(7200), "0xab")
+
+	// 没有桶时不匹配任何行
+	assertQuery(t, windowStatsQuery("ob_collection_stats_eth", nil, ""),
+		"select collection_address, sum(sales_count) as sales_count, coalesce(sum(volume), 0) as volume, "+
+			"coalesce(min(min_price), 0) as min_price, coalesce(max(max_price), 0) as max_price from ob_collection_stats_eth "+
+			"where 1 = 0 and sales_count > 0 group by collection_address")
+}
+
+func TestFloorAtQuery(t *testing.T) {
+	assertQuery(t, floorAtQuery("ob_collection_stats_eth", 1000, ""),
+		"select s.collection_address, s.floor_price from ob_collection_stats_eth s join "+
+			"(select collection_address, max(floor_time) as floor_time from ob_collection_stats_eth "+
+			"where floor_time > 0 and floor_time <= ? group by collection_address) l "+
+			"on s.collection_address = l.collection_address and s.floor_time = l.floor_time",
+		int64(1000))
+}
+
+func TestMergeTrades(t *testing.T) {
+	d := decimal.RequireFromString
+	trades := mergeTrades(
+		[]windowStats{
+			{CollectionAddress: "0xa", SalesCount: 4, Volume: d("10"), MinPrice: d("1"), MaxPrice: d("4")},
+			{CollectionAddress: "0xb", SalesCount: 1, Volume: d("20"), MinPrice: d("20"), MaxPrice: d("20")},
+		},
+		[]windowStats{{CollectionAddress: "0xA", SalesCount: 1, Volume: d("8")}},
+		[]floorPrice{{CollectionAddress: "0xa", FloorPrice: d("3")}, {CollectionAddress: "0xc", FloorPrice: d("1")}},
+		[]floorPrice{{CollectionAddress: "0xa", FloorPrice: d("2")}},
+	)
+
+	// 按成交额降序，只有地板价快照的集合也会返回
+	if len(trades) != 3 || trades[0].ContractAddress != "0xb" || trades[1].ContractAddress != "0xa" || trades[2].ContractAddress != "0xc" {
+		t.Fatalf("unexpected trades order %+v", trades)
+	}
+	a := trades[1]
+	if a.ItemCount != 4 || !a.AvgPrice.Equal(d("2.5")) || a.VolumeChange != 25 ||
+		!a.PreFloorPrice.Equal(d("2")) || a.FloorChange != 50 {
+		t.Fatalf("unexpected trade %+v", a)
+	}
+	// 上一窗口没有成交时变化率为 0
+	if trades[0].VolumeChange != 0 || trades[0].FloorChange != 0 {
+		t.Fatalf("unexpected trade %+v", trades[0])
+	}
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CacheSessionPre 会话信息（hash），key 为会话 ID，过期时间与刷新令牌一致
+	CacheSessionPre = "cache:es:auth:session:%s"
+	// CacheUserSessionsPre 用户的会话 ID 集合，用于列出和注销用户的所有会话
+	CacheUserSessionsPre = "cache:es:auth:sessions:%s"
+
+	// DefaultAccessTTL 访问令牌默认有效期（秒）
+	DefaultAccessTTL = 15 * 60
+	// DefaultRefreshTTL 刷新令牌默认有效期（秒），每次刷新后重新计算
+	DefaultRefreshTTL = 30 * 24 * 60 * 60
+
+	// rotateRefreshScript 校验并轮换刷新令牌。会话不存在返回 0；
+	// 令牌与当前令牌不一致说明旧令牌被重复使用（可能已泄露），删除会话并返回 -1；成功返回 1。
+	// ARGV: 旧令牌哈希, 新令牌哈希, 当前时间, 有效期
+	rotateRefreshScript = `local hash = redis.call('HGET', KEYS[1], 'refresh_hash')
+if not hash then
+    return 0
+end
+if hash ~= ARGV[1] then
+    redis.call('DEL', KEYS[1])
+    return -1
+end
+redis.call('HSET', KEYS[1], 'refresh_hash', ARGV[2], 'last_used_at', ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return 1`
+
+	// createSessionScript 写入会话并设置有效期，避免只写入字段没有设置有效期的会话永久保留。
+	// ARGV: 有效期, 字段1, 值1, 字段2, 值2, ...
+	createSessionScript = `redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return 1`
+
+	// addUserSessionScript 把会话 ID 加入用户的会话集合并重新计算有效期。ARGV: 会话ID, 有效期
+	addUserSessionScript = `redis.call('SADD', KEYS[1], ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1`
+)
+
+func genSessionCacheKey(sessionID string) string {
+	return fmt.Sprintf(CacheSessionPre, sessionID)
+}
+
+func genUserSessionsCacheKey(address string) string {
+	return fmt.Sprintf(CacheUserSessionsPre, strings.ToLower(address))
+}
+
+// Session 一个设备上的登录会话
+type Session struct {
+	ID         string `json:"id"`
+	Address    string `json:"address"`
+	Device     string `json:"device"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+}
+
+// Tokens 登录或刷新后返回给客户端的令牌
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn 访问令牌的有效期（秒）
+	ExpiresIn int64  `json:"expires_in"`
+	SessionID string `json:"session_id"`
+}
+
+// Manager 管理登录会话和令牌
+type Manager struct {
+	kv         *xkv.Store
+	signer     *Signer
+	accessTTL  int64
+	refreshTTL int64
+	now        func() time.Time
+}
+
+// NewManager 创建会话管理器，有效期小于等于 0 时使用默认值
+func NewManager(kv *xkv.Store, signer *Signer, accessTTL, refreshTTL int64) *Manager {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTTL
+	}
+	return &Manager{kv: kv, signer: signer, accessTTL: accessTTL, refreshTTL: refreshTTL, now: time.Now}
+}
+
+// Login 为地址创建一个新的会话，返回访问令牌和刷新令牌
+func (m *Manager) Login(address, device string) (*Tokens, error) {
+	address = strings.ToLower(address)
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先加入用户的会话集合，写入会话失败时集合中多出的 ID 在列出会话时清理
+	if _, err := m.kv.Eval(addUserSessionScript, genUserSessionsCacheKey(address), sessionID, m.refreshTTL); err != nil {
+		return nil, errors.Wrap(err, "failed on add user session")
+	}
+	now := strconv.FormatInt(m.now().Unix(), 10)
+	if _, err := m.kv.Eval(createSessionScript, genSessionCacheKey(sessionID), m.refreshTTL,
+		"address", address,
+		"device", device,
+		"refresh_hash", hashSecret(secret),
+		"created_at", now,
+		"last_used_at", now); err != nil {
+		return nil, errors.Wrap(err, "failed on create session")
+	}
+
+	return m.issue(address, sessionID, secret)
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌立即失效。
+// 已经轮换过的刷新令牌再次使用时注销整个会话。
+func (m *Manager) Refresh(refreshToken string) (*Tokens, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, ErrInvalidToken
+	}
+	newSecret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := genSessionCacheKey(sessionID)
+	result, err := m.kv.Eval(rotateRefreshScript, key, hashSecret(secret), hashSecret(newSecret), m.now().Unix(), m.refreshTTL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on rotate refresh token")
+	}
+	switch code, _ := result.(int64); code {
+	case 1:
+	case -1:
+		return nil, ErrRefreshTokenReused
+	default:
+		return nil, ErrSessionRevoked
+	}
+
+	address, err := m.kv.Hget(key, "address")
+	if err != nil || address == "" {
+		return nil, ErrSessionRevoked
+	}
+	if err := m.kv.Expire(genUserSessionsCacheKey(address), int(m.refreshTTL)); err != nil {
+		return nil, errors.Wrap(err, "failed on set user sessions expiration")
+	}
+	return m.issue(address, sessionID, newSecret)
+}
+
+// Authenticate 验证访问令牌，令牌所属的会话被注销后验证失败
+func (m *Manager) Authenticate(accessToken string) (*Claims, error) {
+	claims, err := m.signer.Verify(accessToken, m.now())
+	if err != nil {
+		return nil, err
+	}
+	exists, err := m.kv.Exists(genSessionCacheKey(claims.SessionID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get session")
+	}
+	if !exists {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
+// Revoke 注销地址的一个会话
+func (m *Manager) Revoke(address, sessionID string) error {
+	address = strings.ToLower(address)
+	owner, err := m.kv.Hget(genSessionCacheKey(sessionID), "address")
+	if err != nil || owner != address {
+		// 会话不存在或不属于该地址
+		return nil
+	}
+	if _, err := m.kv.Del(genSessionCacheKey(sessionID)); err != nil {
+		return errors.Wrap(err, "failed on delete session")
+	}
+	if _, err := m.kv.Srem(genUserSessionsCacheKey(address), sessionID); err != nil {
+		return errors.Wrap(err, "failed on remove user session")
+	}
+	return nil
+}
+
+// RevokeAll 注销地址的所有会话
+func (m *Manager) RevokeAll(address string) error {
+	sessionIDs, err := m.kv.Smembers(genUserSessionsCacheKey(address))
+	if err != nil {
+		return errors.Wrap(err, "failed on get user sessions")
+	}
+	for _, sessionID := range sessionIDs {
+		if err := m.Revoke(address, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sessions 列出地址当前有效的会话，按最近使用时间倒序，已过期的会话从集合中清理
+func (m *Manager) Sessions(address string) ([]*Session, error) {
+	address = strings.ToLower(address)
+	sessionIDs, err := m.kv.Smembers(genUserSessionsCacheKey(address))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get user sessions")
+	}
+
+	sessions := make([]*Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		fields, err := m.kv.Hgetall(genSessionCacheKey(sessionID))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on get session")
+		}
+		if len(fields) == 0 || fields["address"] != address {
+			_, _ = m.kv.Srem(genUserSessionsCacheKey(address), sessionID)
+			continue
+		}
+		createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+		lastUsedAt, _ := strconv.ParseInt(fields["last_used_at"], 10, 64)
+		sessions = append(sessions, &Session{
+			ID:         sessionID,
+			Address:    address,
+			Device:     fields["device"],
+			CreatedAt:  createdAt,
+			LastUsedAt: lastUsedAt,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt > sessions[j].LastUsedAt })
+	return sessions, nil
+}
+
+// issue 签发访问令牌，刷新令牌为 "会话ID.随机串"，Redis 中只保存随机串的哈希
+func (m *Manager) issue(address, sessionID, secret string) (*Tokens, error) {
+	now := m.now().Unix()
+	accessToken, err := m.signer.Sign(Claims{
+		Subject:   address,
+		SessionID: sessionID,
+		IssuedAt:  now,
+		ExpiresAt: now + m.accessTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: sessionID + "." + secret,
+		ExpiresIn:    m.accessTTL,
+		SessionID:    sessionID,
+	}, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "failed on generate random token")
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+func newTestManager(t *testing.T) (*Manager, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	kv := xkv.NewStore(cache.CacheConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	m := NewManager(kv, mustSigner(t, []Key{{ID: "k1", Secret: testSecret1}}, ""), 60, 3600)
+	now := time.Unix(1700000000, 0)
+	m.now = func() time.Time { return now }
+	return m, mr
+}
+
+func TestRefreshRotation(t *testing.T) {
+	m, _ := newTestManager(t)
+	login, err := m.Login("0xABC", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次刷新都返回新的刷新令牌，会话不变
+	refreshed, err := m.Refresh(login.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.SessionID != login.SessionID || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("unexpected refreshed tokens %+v", refreshed)
+	}
+	claims, err := m.Authenticate(refreshed.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "0xabc" || claims.SessionID != login.SessionID {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	again, err := m.Refresh(refreshed.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.RefreshToken == refreshed.RefreshToken {
+		t.Fatal("refresh token should rotate")
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	m, mr := newTestManager(t)
+	login, err := m.Login("0xabc", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := m.Refresh(login.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 已轮换的刷新令牌再次使用，整个会话被注销
+	if _, err := m.Refresh(login.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected reused error, got %v", err)
+	}
+	if mr.Exists(genSessionCacheKey(login.SessionID)) {
+		t.Fatal("session should be deleted")
+	}
+	if _, err := m.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected revoked error for the latest refresh token, got %v", err)
+	}
+	if _, err := m.Authenticate(refreshed.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected revoked error for access token, got %v", err)
+	}
+
+	// 其他会话不受影响
+	other, err := m.Login("0xabc", "mobile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(other.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshInvalidToken(t *testing.T) {
+	m, _ := newTestManager(t)
+	for _, token := range []string{"", "no-separator", ".secret", "session."} {
+		if _, err := m.Refresh(token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Refresh(%q) err = %v, want invalid token", token, err)
+		}
+	}
+	if _, err := m.Refresh("unknown.secret"); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected revoked error for unknown session, got %v", err)
+	}
+}
+
+func TestAuthenticateExpiry(t *testing.T) {
+	m, _ := newTestManager(t)
+	login, err := m.Login("0xabc", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := m.now()
+	m.now = func() time.Time { return start.Add(time.Duration(m.accessTTL) * time.Second) }
+	if _, err := m.Authenticate(login.AccessToken); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected expired error, got %v", err)
+	}
+
+	// 访问令牌过期后仍可使用刷新令牌换取新令牌
+	refreshed, err := m.Refresh(login.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(refreshed.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginSetsSessionExpiration(t *testing.T) {
+	m, mr := newTestManager(t)
+	login, err := m.Login("0xABC", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话和用户的会话集合写入时同时设置有效期
+	key := genSessionCacheKey(login.SessionID)
+	if ttl := mr.TTL(key); ttl != time.Hour {
+		t.Fatalf("unexpected session ttl %v", ttl)
+	}
+	if ttl := mr.TTL(genUserSessionsCacheKey("0xabc")); ttl != time.Hour {
+		t.Fatalf("unexpected user sessions ttl %v", ttl)
+	}
+	if address := mr.HGet(key, "address"); address != "0xabc" {
+		t.Fatalf("unexpected session address %q", address)
+	}
+	if device := mr.HGet(key, "device"); device != "web" {
+		t.Fatalf("unexpected session device %q", device)
+	}
+
+	sessions, err := m.Sessions("0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != login.SessionID || sessions[0].CreatedAt != 1700000000 {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+}
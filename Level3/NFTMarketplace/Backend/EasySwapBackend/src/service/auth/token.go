@@ -0,0 +1,132 @@
+// Package auth 实现登录会话：短期的访问令牌（HS256 签名的 JWT）和按设备保存在 Redis 中、每次使用后轮换的刷新令牌。
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrSessionRevoked     = errors.New("session revoked")
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Key 签名密钥，ID 写入令牌头部的 kid，用于密钥轮换
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// Claims 访问令牌中的声明
+type Claims struct {
+	// Subject 用户地址（小写）
+	Subject string `json:"sub"`
+	// SessionID 令牌所属的会话，会话被注销后令牌失效
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Signer 使用配置中的密钥签发和验证访问令牌。
+// 新令牌使用当前密钥签名，验证时接受所有配置的密钥，轮换密钥时先添加新密钥并切换，旧令牌过期后再删除旧密钥。
+type Signer struct {
+	keys   map[string][]byte
+	active string
+}
+
+// NewSigner 创建签名器，active 为空时使用第一个密钥签名
+func NewSigner(keys []Key, active string) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no token signing key configured")
+	}
+	s := &Signer{keys: make(map[string][]byte, len(keys)), active: active}
+	for _, key := range keys {
+		if key.ID == "" || len(key.Secret) < 32 {
+			return nil, errors.Errorf("token signing key %q must have an id and a secret of at least 32 bytes", key.ID)
+		}
+		s.keys[key.ID] = []byte(key.Secret)
+	}
+	if s.active == "" {
+		s.active = keys[0].ID
+	}
+	if _, ok := s.keys[s.active]; !ok {
+		return nil, errors.Errorf("active token signing key %q not found", s.active)
+	}
+	return s, nil
+}
+
+// Sign 签发访问令牌
+func (s *Signer) Sign(claims Claims) (string, error) {
+	header, err := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT", Kid: s.active})
+	if err != nil {
+		return "", errors.Wrap(err, "failed on marshal token header")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed on marshal token claims")
+	}
+	unsigned := encodeSegment(header) + "." + encodeSegment(payload)
+	return unsigned + "." + encodeSegment(sign(s.keys[s.active], unsigned)), nil
+}
+
+// Verify 验证访问令牌的签名和有效期
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+	key, ok := s.keys[header.Kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(key, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Subject == "" || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func sign(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
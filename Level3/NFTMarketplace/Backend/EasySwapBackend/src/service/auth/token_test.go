@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	testSecret1 = "0123456789abcdef0123456789abcdef"
+	testSecret2 = "fedcba9876543210fedcba9876543210"
+)
+
+func mustSigner(t *testing.T, keys []Key, active string) *Signer {
+	s, err := NewSigner(keys, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []Key
+		active  string
+		wantErr bool
+	}{
+		{name: "first key active", keys: []Key{{ID: "k1", Secret: testSecret1}}},
+		{name: "explicit active", keys: []Key{{ID: "k1", Secret: testSecret1}, {ID: "k2", Secret: testSecret2}}, active: "k2"},
+		{name: "no keys", wantErr: true},
+		{name: "short secret", keys: []Key{{ID: "k1", Secret: "short"}}, wantErr: true},
+		{name: "missing id", keys: []Key{{Secret: testSecret1}}, wantErr: true},
+		{name: "unknown active", keys: []Key{{ID: "k1", Secret: testSecret1}}, active: "k2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSigner(tt.keys, tt.active)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSigner() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignerVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := Claims{Subject: "0xabc", SessionID: "s1", IssuedAt: now.Unix(), ExpiresAt: now.Unix() + 60}
+
+	oldSigner := mustSigner(t, []Key{{ID: "k1", Secret: testSecret1}}, "")
+	oldToken, err := oldSigner.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 轮换中：新密钥签名，旧密钥仍可验证
+	rotating := mustSigner(t, []Key{{ID: "k1", Secret: testSecret1}, {ID: "k2", Secret: testSecret2}}, "k2")
+	newToken, err := rotating.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 轮换完成：旧密钥已删除
+	rotated := mustSigner(t, []Key{{ID: "k2", Secret: testSecret2}}, "")
+	// 同一个 kid 换了密钥
+	replaced := mustSigner(t, []Key{{ID: "k1", Secret: testSecret2}}, "")
+
+	parts := strings.Split(oldToken, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"0xdef","sid":"s1","exp":9999999999}`)) + "." + parts[2]
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"k1"}`))
+
+	tests := []struct {
+		name    string
+		signer  *Signer
+		token   string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid", signer: oldSigner, token: oldToken, now: now},
+		{name: "old key during rotation", signer: rotating, token: oldToken, now: now},
+		{name: "new key during rotation", signer: rotating, token: newToken, now: now},
+		{name: "new key after rotation", signer: rotated, token: newToken, now: now},
+		{name: "rotated out kid", signer: rotated, token: oldToken, now: now, wantErr: ErrInvalidToken},
+		{name: "unknown kid", signer: oldSigner, token: newToken, now: now, wantErr: ErrInvalidToken},
+		{name: "replaced secret", signer: replaced, token: oldToken, now: now, wantErr: ErrInvalidToken},
+		{name: "tampered claims", signer: oldSigner, token: tampered, now: now, wantErr: ErrInvalidToken},
+		{name: "bad signature", signer: oldSigner, token: parts[0] + "." + parts[1] + ".c2lnbmF0dXJl", now: now, wantErr: ErrInvalidToken},
+		{name: "alg none", signer: oldSigner, token: noneHeader + "." + parts[1] + ".", now: now, wantErr: ErrInvalidToken},
+		{name: "malformed", signer: oldSigner, token: "not-a-token", now: now, wantErr: ErrInvalidToken},
+		{name: "last second", signer: oldSigner, token: oldToken, now: now.Add(59 * time.Second)},
+		{name: "expired", signer: oldSigner, token: oldToken, now: now.Add(60 * time.Second), wantErr: ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.signer.Verify(tt.token, tt.now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != claims {
+				t.Fatalf("Verify() = %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/livefeed"
+)
+
+// 推送给客户端的消息类型
+const (
+	MsgEvent        = "event"
+	MsgSubscribed   = "subscribed"
+	MsgUnsubscribed = "unsubscribed"
+	MsgAuthorized   = "authorized"
+	// MsgResync 断线期间的事件无法完整补发，客户端需要通过接口重新拉取订阅主题的数据
+	MsgResync = "resync"
+	MsgError  = "error"
+	MsgPong   = "pong"
+)
+
+// Message 推送给客户端的消息
+type Message struct {
+	Type string `json:"type"`
+	// ID 事件在 Stream 中的 ID，客户端重连时作为 last_id 续传
+	ID     string          `json:"id,omitempty"`
+	Topics []string        `json:"topics,omitempty"`
+	Data   *livefeed.Event `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Client 一个推送连接。消息先写入有界的发送队列，由连接的写协程发送；
+// 队列写满说明客户端消费太慢，连接会被断开（Done 关闭并且 Slow 返回 true），客户端带上最后收到的事件 ID 重连即可续传。
+type Client struct {
+	chain string
+	send  chan *Message
+
+	// 以下字段由 Hub 的锁保护
+	topics map[string]*livefeed.Topic
+	// users 已登录的地址及其令牌过期时间，只有登录了对应地址才能订阅用户主题
+	users map[string]int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+	slow      bool
+}
+
+func newClient(chain string, sendBuffer int) *Client {
+	return &Client{
+		chain:  chain,
+		send:   make(chan *Message, sendBuffer),
+		topics: make(map[string]*livefeed.Topic),
+		users:  make(map[string]int64),
+		done:   make(chan struct{}),
+	}
+}
+
+// Chain 返回连接订阅的链
+func (c *Client) Chain() string {
+	return c.chain
+}
+
+// Send 返回待发送的消息队列
+func (c *Client) Send() <-chan *Message {
+	return c.send
+}
+
+// Done 连接被关闭或者因发送队列写满被断开时关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Slow 连接是否因发送队列写满被断开，在 Done 关闭之后调用
+func (c *Client) Slow() bool {
+	return c.slow
+}
+
+func (c *Client) close(slow bool) {
+	c.closeOnce.Do(func() {
+		c.slow = slow
+		close(c.done)
+	})
+}
+
+// enqueue 写入发送队列，连接已关闭或者队列已满时返回 false，队列已满时断开连接
+func (c *Client) enqueue(msg *Message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.close(true)
+		return false
+	}
+}
+
+// authorized 检查连接是否可以订阅主题，用户主题要求登录了对应的地址并且令牌没有过期
+func (c *Client) authorized(topic *livefeed.Topic, now time.Time) bool {
+	if topic.Kind != livefeed.TopicUserOrders {
+		return true
+	}
+	expiresAt, ok := c.users[topic.User]
+	return ok && expiresAt > now.Unix()
+}
@@ -0,0 +1,397 @@
+// Package feed 实时推送网关：读取同步服务写入 Redis Stream 的市场事件，按主题分发给订阅的连接。
+package feed
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/livefeed"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+)
+
+const (
+	defaultSendBuffer   = 256
+	defaultMaxTopics    = 50
+	defaultReplayLimit  = 1000
+	defaultPollInterval = 500 * time.Millisecond
+
+	// readBatchSize 每次从 Stream 读取的事件数量
+	readBatchSize = 200
+	// maxReplayRounds 订阅补发时最多读取的轮数，每一轮补读上一轮读取期间新分发的事件
+	maxReplayRounds = 3
+)
+
+var (
+	ErrUnknownChain   = errors.New("unknown chain")
+	ErrTooManyTopics  = errors.New("too many topics")
+	ErrUnauthorized   = errors.New("unauthorized topic")
+	ErrInvalidEventID = errors.New("invalid last_id")
+)
+
+// stream 一条链的事件流和订阅关系
+type stream struct {
+	// cursor 已分发的最新事件 ID，空表示启动时 Stream 为空
+	cursor string
+	// ready 启动时的读取位置已经确定
+	ready bool
+	subs  map[string]map[*Client]struct{}
+}
+
+// Hub 管理所有推送连接。每条链一个读取协程，按 cursor 顺序读取新事件并分发；
+// 订阅时补发 (last_id, cursor] 的事件，登记订阅和确定 cursor 在同一把锁内，保证补发和实时事件之间不重复、不遗漏。
+type Hub struct {
+	kv           *xkv.Store
+	sendBuffer   int
+	maxTopics    int
+	replayLimit  int
+	pollInterval time.Duration
+
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+// NewHub 创建推送网关，cfg 为空时使用默认配置
+func NewHub(kv *xkv.Store, cfg *config.FeedCfg, chains []*config.ChainSupported) *Hub {
+	c := config.FeedCfg{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.SendBuffer <= 0 {
+		c.SendBuffer = defaultSendBuffer
+	}
+	if c.MaxTopics <= 0 {
+		c.MaxTopics = defaultMaxTopics
+	}
+	if c.ReplayLimit <= 0 {
+		c.ReplayLimit = defaultReplayLimit
+	}
+	pollInterval := defaultPollInterval
+	if c.PollInterval > 0 {
+		pollInterval = time.Duration(c.PollInterval) * time.Millisecond
+	}
+
+	streams := make(map[string]*stream, len(chains))
+	for _, chain := range chains {
+		streams[chain.Name] = &stream{subs: make(map[string]map[*Client]struct{})}
+	}
+	return &Hub{
+		kv:           kv,
+		sendBuffer:   c.SendBuffer,
+		maxTopics:    c.MaxTopics,
+		replayLimit:  c.ReplayLimit,
+		pollInterval: pollInterval,
+		streams:      streams,
+	}
+}
+
+// Start 为每条链启动一个读取协程
+func (h *Hub) Start(ctx context.Context) {
+	for chain := range h.streams {
+		go h.run(ctx, chain)
+	}
+}
+
+func (h *Hub) run(ctx context.Context, chain string) {
+	xzap.WithContext(ctx).Info("feed hub started", zap.String("chain", chain))
+	for {
+		// 读满一批时立即读取下一批，否则等待下一轮
+		full, err := h.poll(chain)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on poll feed events", zap.String("chain", chain), zap.Error(err))
+		}
+		if full && err == nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.pollInterval):
+		}
+	}
+}
+
+// poll 读取 cursor 之后的新事件并分发，返回是否读满了一批
+func (h *Hub) poll(chain string) (bool, error) {
+	h.mu.Lock()
+	s := h.streams[chain]
+	ready, cursor := s.ready, s.cursor
+	h.mu.Unlock()
+
+	// 启动时从最新的事件开始推送，之前的事件只用于重连补发
+	if !ready {
+		_, latest, err := livefeed.Bounds(h.kv, chain)
+		if err != nil {
+			return false, err
+		}
+		h.mu.Lock()
+		s.cursor, s.ready = latest, true
+		h.mu.Unlock()
+		return false, nil
+	}
+
+	// 只有读取协程修改 cursor，读取期间不需要持有锁
+	events, err := livefeed.ReadAfter(h.kv, chain, cursor, readBatchSize)
+	if err != nil {
+		return false, err
+	}
+	if len(events) == 0 {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, event := range events {
+		h.dispatchLocked(s, event)
+		s.cursor = event.ID
+	}
+	return len(events) == readBatchSize, nil
+}
+
+// dispatchLocked 把事件发送给订阅了事件主题的连接，同一个连接只发送一次
+func (h *Hub) dispatchLocked(s *stream, event *livefeed.Event) {
+	if event.Type == "" {
+		return
+	}
+	now := time.Now()
+	matched := make(map[*Client][]string)
+	var order []*Client
+	for _, topic := range event.Topics() {
+		for client := range s.subs[topic] {
+			if !client.authorized(client.topics[topic], now) {
+				// 令牌过期后不再推送用户主题
+				h.unsubscribeLocked(s, client, topic)
+				client.enqueue(&Message{Type: MsgUnsubscribed, Topics: []string{topic}, Error: ErrUnauthorized.Error()})
+				continue
+			}
+			if _, ok := matched[client]; !ok {
+				order = append(order, client)
+			}
+			matched[client] = append(matched[client], topic)
+		}
+	}
+	for _, client := range order {
+		if !client.enqueue(&Message{Type: MsgEvent, ID: event.ID, Topics: matched[client], Data: event}) {
+			h.removeLocked(s, client)
+		}
+	}
+}
+
+// NewClient 创建一个订阅指定链的连接
+func (h *Hub) NewClient(chain string) (*Client, error) {
+	if _, ok := h.streams[chain]; !ok {
+		return nil, ErrUnknownChain
+	}
+	return newClient(chain, h.sendBuffer), nil
+}
+
+// Authorize 记录连接登录的地址，expiresAt 为令牌的过期时间（秒）
+func (h *Hub) Authorize(c *Client, address string, expiresAt int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.users[strings.ToLower(address)] = expiresAt
+}
+
+// Subscribe 订阅主题。lastID 不为空时先补发 lastID 之后这些主题的事件，
+// 补发范围超过 ReplayLimit 或者事件已经被 Stream 裁剪时发送 resync，客户端需要重新拉取数据。
+// 补发在锁外读取 Redis，不阻塞其他连接的分发；读取期间 cursor 推进时再补读新增的范围，
+// cursor 不变时才在锁内登记订阅，保证补发和实时事件之间不重复、不遗漏。
+func (h *Hub) Subscribe(c *Client, topics []string, lastID string) error {
+	if lastID != "" && !livefeed.ValidID(lastID) {
+		return ErrInvalidEventID
+	}
+
+	h.mu.Lock()
+	parsed, err := h.checkTopicsLocked(c, topics, time.Now())
+	if err != nil {
+		h.mu.Unlock()
+		return err
+	}
+	names := make([]string, 0, len(parsed))
+	for _, topic := range parsed {
+		names = append(names, topic.String())
+	}
+
+	s := h.streams[c.chain]
+	var (
+		replay  []*Message
+		resync  bool
+		from    = lastID
+		remain  = h.replayLimit
+		replays int
+	)
+	for {
+		// 启动后还没有确定读取位置，无法判断需要补发的范围
+		if lastID != "" && !s.ready {
+			resync = true
+		}
+		cursor := s.cursor
+		if resync || cursor == "" || from == "" || livefeed.CompareID(from, cursor) >= 0 {
+			break
+		}
+		if replays >= maxReplayRounds {
+			// 分发持续推进，补读追不上时让客户端重新拉取
+			resync = true
+			break
+		}
+		h.mu.Unlock()
+		msgs, read, ok := h.readReplay(c.chain, names, from, cursor, remain, replays == 0)
+		h.mu.Lock()
+		if !ok {
+			resync = true
+			break
+		}
+		replay = append(replay, msgs...)
+		remain -= read
+		from = cursor
+		replays++
+	}
+	defer h.mu.Unlock()
+
+	select {
+	case <-c.Done():
+		// 补发期间连接已经关闭，不再登记订阅
+		return nil
+	default:
+	}
+	for _, topic := range parsed {
+		name := topic.String()
+		c.topics[name] = topic
+		if s.subs[name] == nil {
+			s.subs[name] = make(map[*Client]struct{})
+		}
+		s.subs[name][c] = struct{}{}
+	}
+	// 补发完成后再确认订阅，确认消息中的 ID 是之后实时事件的起点
+	if resync {
+		replay = []*Message{{Type: MsgResync, ID: s.cursor, Topics: names}}
+	}
+	for _, msg := range replay {
+		if !c.enqueue(msg) {
+			h.removeLocked(s, c)
+			return nil
+		}
+	}
+	c.enqueue(&Message{Type: MsgSubscribed, ID: s.cursor, Topics: names})
+	return nil
+}
+
+// checkTopicsLocked 解析要订阅的主题，检查用户主题的登录状态和连接的主题数量上限
+func (h *Hub) checkTopicsLocked(c *Client, topics []string, now time.Time) ([]*livefeed.Topic, error) {
+	parsed := make([]*livefeed.Topic, 0, len(topics))
+	for _, raw := range topics {
+		topic, err := livefeed.ParseTopic(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !c.authorized(topic, now) {
+			return nil, ErrUnauthorized
+		}
+		parsed = append(parsed, topic)
+	}
+	added := 0
+	for _, topic := range parsed {
+		if _, ok := c.topics[topic.String()]; !ok {
+			added++
+		}
+	}
+	if len(c.topics)+added > h.maxTopics {
+		return nil, ErrTooManyTopics
+	}
+	return parsed, nil
+}
+
+// readReplay 读取 (after, end] 范围内属于 topics 的事件，返回补发的消息和读取的事件数量。
+// 范围超过 limit、读取失败或者 checkTrim 时 after 已经被 Stream 裁剪，返回 false
+func (h *Hub) readReplay(chain string, topics []string, after, end string, limit int, checkTrim bool) ([]*Message, int, bool) {
+	if checkTrim {
+		oldest, _, err := livefeed.Bounds(h.kv, chain)
+		if err != nil || (oldest != "" && livefeed.CompareID(after, oldest) < 0) {
+			return nil, 0, false
+		}
+	}
+	events, err := livefeed.ReadRange(h.kv, chain, after, end, limit+1)
+	if err != nil || len(events) > limit {
+		return nil, 0, false
+	}
+
+	wanted := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		wanted[topic] = true
+	}
+	var msgs []*Message
+	for _, event := range events {
+		var matched []string
+		for _, topic := range event.Topics() {
+			if wanted[topic] {
+				matched = append(matched, topic)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		msgs = append(msgs, &Message{Type: MsgEvent, ID: event.ID, Topics: matched, Data: event})
+	}
+	return msgs, len(events), true
+}
+
+// Unsubscribe 取消订阅主题
+func (h *Hub) Unsubscribe(c *Client, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.streams[c.chain]
+	names := make([]string, 0, len(topics))
+	for _, raw := range topics {
+		topic, err := livefeed.ParseTopic(raw)
+		if err != nil {
+			continue
+		}
+		h.unsubscribeLocked(s, c, topic.String())
+		names = append(names, topic.String())
+	}
+	c.enqueue(&Message{Type: MsgUnsubscribed, Topics: names})
+}
+
+// Reply 回复客户端的请求，连接已关闭或者发送队列写满时返回 false
+func (h *Hub) Reply(c *Client, msg *Message) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !c.enqueue(msg) {
+		h.removeLocked(h.streams[c.chain], c)
+		return false
+	}
+	return true
+}
+
+// Remove 连接关闭时取消全部订阅
+func (h *Hub) Remove(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(h.streams[c.chain], c)
+	c.close(false)
+}
+
+func (h *Hub) removeLocked(s *stream, c *Client) {
+	for topic := range c.topics {
+		h.unsubscribeLocked(s, c, topic)
+	}
+}
+
+func (h *Hub) unsubscribeLocked(s *stream, c *Client, topic string) {
+	delete(c.topics, topic)
+	if subs, ok := s.subs[topic]; ok {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(s.subs, topic)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/livefeed"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+)
+
+const (
+	testChain      = "sepolia"
+	testCollection = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	testUser       = "0x70997970c51812dc3a010c7d01b50e20d17dc79c"
+)
+
+var (
+	activityTopic = livefeed.CollectionActivityTopic(testCollection)
+	floorTopic    = livefeed.CollectionFloorTopic(testCollection)
+	userTopic     = livefeed.UserOrdersTopic(testUser)
+)
+
+func newTestHub(t *testing.T, cfg *config.FeedCfg) (*Hub, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	kv := xkv.NewStore(cache.CacheConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	return NewHub(kv, cfg, []*config.ChainSupported{{Name: testChain}}), mr
+}
+
+// publish 发布事件并返回事件 ID
+func publish(t *testing.T, h *Hub, event *livefeed.Event) string {
+	t.Helper()
+	if err := livefeed.Publish(h.kv, testChain, event); err != nil {
+		t.Fatal(err)
+	}
+	_, latest, err := livefeed.Bounds(h.kv, testChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return latest
+}
+
+func publishActivity(t *testing.T, h *Hub) string {
+	return publish(t, h, &livefeed.Event{Type: livefeed.EventActivity, CollectionAddr: testCollection})
+}
+
+func publishFloor(t *testing.T, h *Hub) string {
+	return publish(t, h, &livefeed.Event{Type: livefeed.EventFloor, CollectionAddr: testCollection})
+}
+
+// pollOnce 读取并分发一次新事件，第一次调用确定启动时的读取位置
+func pollOnce(t *testing.T, h *Hub) {
+	t.Helper()
+	if _, err := h.poll(testChain); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// drain 取出发送队列中的全部消息
+func drain(c *Client) []*Message {
+	var msgs []*Message
+	for {
+		select {
+		case msg := <-c.Send():
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func newTestClient(t *testing.T, h *Hub) *Client {
+	t.Helper()
+	c, err := h.NewClient(testChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSubscribeAuthorization(t *testing.T) {
+	h, _ := newTestHub(t, &config.FeedCfg{MaxTopics: 2})
+	pollOnce(t, h)
+	c := newTestClient(t, h)
+
+	if _, err := h.NewClient("mainnet"); err != ErrUnknownChain {
+		t.Fatalf("expect ErrUnknownChain, got %v", err)
+	}
+	if err := h.Subscribe(c, []string{"collection:0x01:activity"}, ""); err == nil {
+		t.Fatal("expect invalid topic error")
+	}
+	if err := h.Subscribe(c, []string{activityTopic}, "bad-id"); err != ErrInvalidEventID {
+		t.Fatalf("expect ErrInvalidEventID, got %v", err)
+	}
+	// 用户主题要求登录了对应的地址，令牌过期后无法订阅
+	if err := h.Subscribe(c, []string{userTopic}, ""); err != ErrUnauthorized {
+		t.Fatalf("expect ErrUnauthorized, got %v", err)
+	}
+	h.Authorize(c, testUser, time.Now().Add(-time.Second).Unix())
+	if err := h.Subscribe(c, []string{userTopic}, ""); err != ErrUnauthorized {
+		t.Fatalf("expect ErrUnauthorized for expired token, got %v", err)
+	}
+	// 地址不区分大小写
+	h.Authorize(c, "0x70997970C51812dc3A010C7d01b50e20d17dc79C", time.Now().Add(time.Hour).Unix())
+	if err := h.Subscribe(c, []string{userTopic, activityTopic}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Subscribe(c, []string{floorTopic}, ""); err != ErrTooManyTopics {
+		t.Fatalf("expect ErrTooManyTopics, got %v", err)
+	}
+	// 重复订阅已有的主题不占用数量
+	if err := h.Subscribe(c, []string{activityTopic}, ""); err != nil {
+		t.Fatal(err)
+	}
+	msgs := drain(c)
+	if len(msgs) != 2 || msgs[0].Type != MsgSubscribed || len(msgs[0].Topics) != 2 || msgs[1].Type != MsgSubscribed {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	// 令牌过期后分发时取消用户主题的订阅，不再推送
+	h.mu.Lock()
+	c.users[testUser] = time.Now().Add(-time.Second).Unix()
+	h.mu.Unlock()
+	publish(t, h, &livefeed.Event{Type: livefeed.EventOrder, CollectionAddr: testCollection, TokenId: "1", Maker: testUser})
+	pollOnce(t, h)
+	msgs = drain(c)
+	if len(msgs) != 1 || msgs[0].Type != MsgUnsubscribed || msgs[0].Topics[0] != userTopic || msgs[0].Error != ErrUnauthorized.Error() {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if _, ok := c.topics[userTopic]; ok {
+		t.Fatal("expect user topic unsubscribed")
+	}
+	if _, ok := h.streams[testChain].subs[userTopic]; ok {
+		t.Fatal("expect no subscribers of user topic")
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	h, _ := newTestHub(t, nil)
+	pollOnce(t, h)
+	c := newTestClient(t, h)
+	if err := h.Subscribe(c, []string{activityTopic, floorTopic}, ""); err != nil {
+		t.Fatal(err)
+	}
+	drain(c)
+
+	id1 := publishActivity(t, h)
+	publish(t, h, &livefeed.Event{Type: livefeed.EventActivity, CollectionAddr: "0x9fe46736679d2d9a65f0992f2272de9f3c7fa6e0"})
+	id3 := publishFloor(t, h)
+	pollOnce(t, h)
+	msgs := drain(c)
+	if len(msgs) != 2 || msgs[0].ID != id1 || msgs[0].Topics[0] != activityTopic || msgs[1].ID != id3 || msgs[1].Topics[0] != floorTopic {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	h.Unsubscribe(c, []string{floorTopic})
+	publishFloor(t, h)
+	pollOnce(t, h)
+	if msgs := drain(c); len(msgs) != 1 || msgs[0].Type != MsgUnsubscribed {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+}
+
+func TestSlowConsumerDropped(t *testing.T) {
+	h, _ := newTestHub(t, &config.FeedCfg{SendBuffer: 2})
+	pollOnce(t, h)
+	slow := newTestClient(t, h)
+	fast := newTestClient(t, h)
+	for _, c := range []*Client{slow, fast} {
+		if err := h.Subscribe(c, []string{activityTopic}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drain(fast)
+
+	// 慢连接的队列中还有订阅确认，第二个事件写满队列后断开
+	publishActivity(t, h)
+	pollOnce(t, h)
+	drain(fast)
+	last := publishActivity(t, h)
+	pollOnce(t, h)
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("expect slow client closed")
+	}
+	if !slow.Slow() {
+		t.Fatal("expect slow client marked slow")
+	}
+	if len(slow.topics) != 0 {
+		t.Fatalf("expect slow client unsubscribed, got %v", slow.topics)
+	}
+	subs := h.streams[testChain].subs[activityTopic]
+	if _, ok := subs[slow]; ok || len(subs) != 1 {
+		t.Fatalf("unexpected subscribers %v", subs)
+	}
+	if msgs := drain(fast); len(msgs) != 1 || msgs[0].ID != last {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	// 断开后的连接不再接收消息
+	if h.Reply(slow, &Message{Type: MsgPong}) {
+		t.Fatal("expect reply to closed client fail")
+	}
+
+	// 关闭的连接不会被重新登记
+	h.Remove(fast)
+	if err := h.Subscribe(fast, []string{floorTopic}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.streams[testChain].subs) != 0 {
+		t.Fatalf("expect no subscribers, got %v", h.streams[testChain].subs)
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	h, _ := newTestHub(t, &config.FeedCfg{ReplayLimit: 3})
+	id1 := publishActivity(t, h)
+
+	// 启动后还没有确定读取位置时无法补发
+	c := newTestClient(t, h)
+	if err := h.Subscribe(c, []string{activityTopic}, id1); err != nil {
+		t.Fatal(err)
+	}
+	msgs := drain(c)
+	if len(msgs) != 2 || msgs[0].Type != MsgResync || msgs[1].Type != MsgSubscribed {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	h.Remove(c)
+
+	pollOnce(t, h)
+	publishFloor(t, h)
+	id3 := publishActivity(t, h)
+	id4 := publishActivity(t, h)
+	pollOnce(t, h)
+
+	// 补发 last_id 之后订阅主题的事件，确认消息的 ID 是实时事件的起点
+	c = newTestClient(t, h)
+	if err := h.Subscribe(c, []string{activityTopic}, id1); err != nil {
+		t.Fatal(err)
+	}
+	msgs = drain(c)
+	if len(msgs) != 3 || msgs[0].ID != id3 || msgs[1].ID != id4 || msgs[2].Type != MsgSubscribed || msgs[2].ID != id4 {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	// 之后的事件只通过实时分发推送一次
+	id5 := publishActivity(t, h)
+	pollOnce(t, h)
+	if msgs := drain(c); len(msgs) != 1 || msgs[0].ID != id5 {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	// last_id 已经是最新事件时不需要补发
+	c = newTestClient(t, h)
+	if err := h.Subscribe(c, []string{activityTopic, floorTopic}, id5); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := drain(c); len(msgs) != 1 || msgs[0].Type != MsgSubscribed || msgs[0].ID != id5 {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	// 补发范围超过 ReplayLimit 时通知重新拉取
+	c = newTestClient(t, h)
+	if err := h.Subscribe(c, []string{floorTopic}, id1); err != nil {
+		t.Fatal(err)
+	}
+	msgs = drain(c)
+	if len(msgs) != 2 || msgs[0].Type != MsgResync || msgs[0].ID != id5 || msgs[1].Type != MsgSubscribed {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if _, ok := c.topics[floorTopic]; !ok {
+		t.Fatal("expect subscribed after resync")
+	}
+
+	// last_id 已经被 Stream 裁剪时通知重新拉取
+	c = newTestClient(t, h)
+	if err := h.Subscribe(c, []string{floorTopic}, "1-0"); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := drain(c); len(msgs) != 2 || msgs[0].Type != MsgResync {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+}
+
+// 补发期间分发协程持续推进 cursor，补发和实时事件合起来不重复、不遗漏
+func TestSubscribeReplayWhileDispatching(t *testing.T) {
+	h, _ := newTestHub(t, &config.FeedCfg{SendBuffer: 1000})
+	pollOnce(t, h)
+	lastID := publishActivity(t, h)
+	for i := 0; i < 20; i++ {
+		publishActivity(t, h)
+	}
+	pollOnce(t, h)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := livefeed.Publish(h.kv, testChain, &livefeed.Event{Type: livefeed.EventActivity, CollectionAddr: testCollection}); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := h.poll(testChain); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	c := newTestClient(t, h)
+	if err := h.Subscribe(c, []string{activityTopic}, lastID); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	pollOnce(t, h)
+
+	all, err := livefeed.ReadAfter(h.kv, testChain, lastID, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	resync := false
+	for _, msg := range drain(c) {
+		switch msg.Type {
+		case MsgEvent:
+			ids = append(ids, msg.ID)
+		case MsgResync:
+			resync = true
+		}
+	}
+	if resync {
+		// 补读追不上时只推送实时事件，仍然保持顺序且不重复
+		for i := 1; i < len(ids); i++ {
+			if livefeed.CompareID(ids[i-1], ids[i]) >= 0 {
+				t.Fatalf("unordered events %v", ids)
+			}
+		}
+		return
+	}
+	if len(ids) != len(all) {
+		t.Fatalf("expect %d events, got %d", len(all), len(ids))
+	}
+	for i, event := range all {
+		if ids[i] != event.ID {
+			t.Fatalf("event %d: expect %s, got %s", i, event.ID, ids[i])
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/image"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+// CacheMediaMirrorLockKey 转存任务的锁，多个实例同时运行时同一条链只有一个实例转存
+const CacheMediaMirrorLockKey = "cache:%s:%s:item:media:mirror:lock"
+
+const (
+	defaultMirrorWorkers   = 4
+	defaultMirrorBatchSize = 100
+
+	// mirrorIdleInterval 没有待转存的物品时的轮询间隔
+	mirrorIdleInterval = 10 * time.Second
+	// mirrorLockTTL 锁的有效期（秒），每批物品处理前获取，处理完后释放
+	mirrorLockTTL = 300
+
+	// releaseMirrorLockScript 锁的值与获取时的令牌一致时才删除，
+	// 避免处理时间超过有效期后删除其他实例已经获取的锁
+	releaseMirrorLockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0`
+)
+
+// GetMediaMirrorLockKey 根据项目名和链名生成转存锁的缓存键
+func GetMediaMirrorLockKey(project, chain string) string {
+	return fmt.Sprintf(CacheMediaMirrorLockKey, strings.ToLower(project), strings.ToLower(chain))
+}
+
+// MediaMirror 把 ob_item_external_* 中还没有转存的图片和视频保存到对象存储，并更新转存状态。
+//
+// 待转存的条件是 is_uploaded_oss（视频为 is_video_uploaded）为 0，且状态为 OK 或 IpfsUploadRetry。
+// 转存成功后状态记录文件来源（HttpUpload、IpfsUpload、Base64Image）；
+// IPFS 文件第一次失败时标记为 IpfsUploadRetry 等待下一轮重试，其他失败标记为 FetchImageFailed。
+// image_uri 指向的文件是视频时保存到视频相关的字段。
+type MediaMirror struct {
+	svcCtx    *svc.ServerCtx
+	imageMgr  image.ImageManager
+	project   string
+	chains    []*config.ChainSupported
+	workers   int
+	batchSize int
+}
+
+// NewMediaMirror 创建转存任务，未配置的参数使用默认值
+func NewMediaMirror(svcCtx *svc.ServerCtx) *MediaMirror {
+	cfg := config.MediaMirrorCfg{}
+	if svcCtx.C.MediaMirror != nil {
+		cfg = *svcCtx.C.MediaMirror
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultMirrorWorkers
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultMirrorBatchSize
+	}
+
+	return &MediaMirror{
+		svcCtx:    svcCtx,
+		imageMgr:  svcCtx.ImageMgr,
+		project:   svcCtx.C.ProjectCfg.Name,
+		chains:    svcCtx.C.ChainSupported,
+		workers:   cfg.Workers,
+		batchSize: cfg.BatchSize,
+	}
+}
+
+// Start 为每条链启动一个转存协程，未配置图片管理器时不启动
+func (m *MediaMirror) Start(ctx context.Context) {
+	if m.imageMgr == nil {
+		xzap.WithContext(ctx).Info("image manager not configured, media mirror disabled")
+		return
+	}
+	for _, chain := range m.chains {
+		go m.run(ctx, chain.Name)
+	}
+}
+
+func (m *MediaMirror) run(ctx context.Context, chain string) {
+	xzap.WithContext(ctx).Info("media mirror started", zap.String("chain", chain))
+	var cursor int64
+	for {
+		processed, next, err := m.mirrorBatch(ctx, chain, cursor)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on mirror media", zap.String("chain", chain), zap.Error(err))
+		}
+		cursor = next
+		if processed < m.batchSize {
+			// 一轮扫描结束，从头开始，上一轮标记为 IpfsUploadRetry 的物品在下一轮重试
+			cursor = 0
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(mirrorIdleInterval):
+			}
+		}
+	}
+}
+
+// mirrorBatch 转存 id 大于 cursor 的一批物品，返回处理的数量和下一批的起始 id
+func (m *MediaMirror) mirrorBatch(ctx context.Context, chain string, cursor int64) (int, int64, error) {
+	lockKey := GetMediaMirrorLockKey(m.project, chain)
+	token := uuid.NewString()
+	locked, err := m.svcCtx.KvStore.SetnxEx(lockKey, token, mirrorLockTTL)
+	if err != nil {
+		return 0, cursor, errors.Wrap(err, "failed on acquire media mirror lock")
+	}
+	if !locked {
+		return 0, cursor, nil
+	}
+	defer m.unlock(ctx, lockKey, token)
+
+	pending := []int32{multi.OK, multi.IpfsUploadRetry}
+	var items []multi.ItemExternal
+	if err := m.svcCtx.DB.WithContext(ctx).Table(multi.ItemExternalTableName(chain)).
+		Where("id > ?", cursor).
+		Where("(is_uploaded_oss = 0 AND image_uri <> '' AND upload_status IN ?) OR "+
+			"(is_video_uploaded = 0 AND video_uri <> '' AND video_upload_status IN ?)", pending, pending).
+		Order("id").Limit(m.batchSize).Find(&items).Error; err != nil {
+		return 0, cursor, errors.Wrap(err, "failed on query pending media")
+	}
+
+	sem := make(chan struct{}, m.workers)
+	var wg sync.WaitGroup
+	for i := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(item *multi.ItemExternal) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			m.mirrorItem(ctx, chain, item)
+		}(&items[i])
+		cursor = items[i].ID
+	}
+	wg.Wait()
+	return len(items), cursor, nil
+}
+
+// unlock 释放当前实例持有的转存锁，锁已经过期并被其他实例获取时不删除
+func (m *MediaMirror) unlock(ctx context.Context, lockKey, token string) {
+	if _, err := m.svcCtx.KvStore.Eval(releaseMirrorLockScript, lockKey, token); err != nil {
+		xzap.WithContext(ctx).Error("failed on release media mirror lock", zap.String("key", lockKey), zap.Error(err))
+	}
+}
+
+// mirrorItem 转存一个物品待转存的图片和视频，并更新状态
+func (m *MediaMirror) mirrorItem(ctx context.Context, chain string, item *multi.ItemExternal) {
+	dir := image.ObjectDir(chain, item.CollectionAddress, item.TokenId)
+	updates := make(map[string]interface{})
+	// mirrored 是否有文件转存成功，成功后 item 的图片地址变化
+	mirrored := false
+
+	if !item.IsUploadedOss && item.ImageUri != "" && isPendingUpload(item.UploadStatus) {
+		result, err := m.imageMgr.Mirror(ctx, dir, item.ImageUri)
+		switch {
+		case err != nil:
+			updates["upload_status"] = failedUploadStatus(item.ImageUri, item.UploadStatus)
+			m.logFailure(ctx, chain, item, item.ImageUri, err)
+		case result.IsVideo():
+			// 图片地址指向视频，图片保持原地址；元数据没有 animation_url 时记录到视频字段，
+			// 已有 animation_url 时保留其转存结果，不覆盖
+			updates["upload_status"] = uploadStatus(result.Source)
+			if item.VideoUri == "" {
+				updates["video_uri"] = item.ImageUri
+				updates["video_type"] = result.ContentType
+				updates["video_oss_uri"] = result.Url
+				updates["is_video_uploaded"] = true
+				updates["video_upload_status"] = uploadStatus(result.Source)
+				mirrored = true
+			}
+		default:
+			updates["upload_status"] = uploadStatus(result.Source)
+			updates["oss_uri"] = result.Url
+			updates["is_uploaded_oss"] = true
+			mirrored = true
+		}
+	}
+
+	if !item.IsVideoUploaded && item.VideoUri != "" && isPendingUpload(item.VideoUploadStatus) && updates["video_uri"] == nil {
+		result, err := m.imageMgr.Mirror(ctx, dir, item.VideoUri)
+		if err != nil {
+			updates["video_upload_status"] = failedUploadStatus(item.VideoUri, item.VideoUploadStatus)
+			m.logFailure(ctx, chain, item, item.VideoUri, err)
+		} else {
+			updates["video_type"] = result.ContentType
+			updates["video_oss_uri"] = result.Url
+			updates["is_video_uploaded"] = true
+			updates["video_upload_status"] = uploadStatus(result.Source)
+			mirrored = true
+		}
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+	updates["update_time"] = time.Now().UnixMilli()
+	if err := m.svcCtx.DB.WithContext(ctx).Table(multi.ItemExternalTableName(chain)).
+		Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+		xzap.WithContext(ctx).Error("failed on update media status", zap.String("chain", chain),
+			zap.String("collection_addr", item.CollectionAddress), zap.String("token_id", item.TokenId), zap.Error(err))
+		return
+	}
+	if !mirrored {
+		return
+	}
+	// 图片接口缓存登记在 item 标签下，转存成功后失效
+	if err := apicache.Publish(m.svcCtx.KvStore, apicache.ItemTag(chain, item.CollectionAddress, item.TokenId)); err != nil {
+		xzap.WithContext(ctx).Error("failed on publish cache invalidate message", zap.String("chain", chain),
+			zap.String("collection_addr", item.CollectionAddress), zap.String("token_id", item.TokenId), zap.Error(err))
+	}
+}
+
+func (m *MediaMirror) logFailure(ctx context.Context, chain string, item *multi.ItemExternal, uri string, err error) {
+	xzap.WithContext(ctx).Warn("failed on mirror media", zap.String("chain", chain),
+		zap.String("collection_addr", item.CollectionAddress), zap.String("token_id", item.TokenId),
+		zap.String("uri", uri), zap.Error(err))
+}
+
+func isPendingUpload(status int32) bool {
+	return status == multi.OK || status == multi.IpfsUploadRetry
+}
+
+// uploadStatus 转存成功后记录文件来源
+func uploadStatus(source image.Source) int32 {
+	switch source {
+	case image.SourceIpfs:
+		return multi.IpfsUpload
+	case image.SourceBase64:
+		return multi.Base64Image
+	default:
+		return multi.HttpUpload
+	}
+}
+
+// failedUploadStatus IPFS 网关不稳定，第一次失败时等待重试，其他情况标记为失败
+func failedUploadStatus(uri string, status int32) int32 {
+	if strings.HasPrefix(uri, "ipfs://") && status != multi.IpfsUploadRetry {
+		return multi.IpfsUploadRetry
+	}
+	return multi.FetchImageFailed
+}
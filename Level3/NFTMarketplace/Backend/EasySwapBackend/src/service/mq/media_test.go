@@ -0,0 +1,125 @@
+package mq
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/image"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+)
+
+func TestMediaMirrorLock(t *testing.T) {
+	svcCtx, mr, mock := newTestSvcCtx(t, &config.Config{})
+	m := NewMediaMirror(svcCtx)
+	lockKey := GetMediaMirrorLockKey(testProject, "sepolia")
+
+	// 其他实例持有锁时不处理
+	mr.Set(lockKey, "other")
+	processed, cursor, err := m.mirrorBatch(testCtx, "sepolia", 7)
+	if err != nil || processed != 0 || cursor != 7 {
+		t.Fatalf("unexpected batch %d %d %v", processed, cursor, err)
+	}
+	if v, _ := mr.Get(lockKey); v != "other" {
+		t.Fatalf("lock should be kept, got %q", v)
+	}
+
+	// 锁过期后被其他实例获取，释放时不能删除其他实例的锁
+	m.unlock(testCtx, lockKey, "mine")
+	if v, _ := mr.Get(lockKey); v != "other" {
+		t.Fatalf("lock of other instance released, got %q", v)
+	}
+	m.unlock(testCtx, lockKey, "other")
+	if mr.Exists(lockKey) {
+		t.Fatal("lock should be released by its owner")
+	}
+
+	// 获取锁处理一批物品后释放
+	mock.ExpectQuery("SELECT \\* FROM `ob_item_external_sepolia` WHERE id > \\?").
+		WithArgs(0, multi.OK, multi.IpfsUploadRetry, multi.OK, multi.IpfsUploadRetry).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	processed, _, err = m.mirrorBatch(testCtx, "sepolia", 0)
+	if err != nil || processed != 0 {
+		t.Fatalf("unexpected batch %d %v", processed, err)
+	}
+	if mr.Exists(lockKey) {
+		t.Fatal("lock should be released after the batch")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeImageManager 按地址返回预先设置的转存结果
+type fakeImageManager struct {
+	results map[string]*image.MirrorResult
+}
+
+func (f *fakeImageManager) Mirror(ctx context.Context, dir, uri string) (*image.MirrorResult, error) {
+	result, ok := f.results[uri]
+	if !ok {
+		return nil, errors.Errorf("unexpected uri %s", uri)
+	}
+	return result, nil
+}
+
+func (f *fakeImageManager) GetSmallSizeImageUrl(uri string) string {
+	return uri
+}
+
+func TestMediaMirrorItem(t *testing.T) {
+	svcCtx, _, mock := newTestSvcCtx(t, &config.Config{})
+	svcCtx.ImageMgr = &fakeImageManager{results: map[string]*image.MirrorResult{
+		"https://a/image.mp4": {Url: "https://oss/image.mp4", ContentType: "video/mp4", Source: image.SourceHttp},
+		"https://a/anim.mp4":  {Url: "https://oss/anim.mp4", ContentType: "video/mp4", Source: image.SourceHttp},
+		"https://a/image.png": {Url: "https://oss/image.png", ContentType: "image/png", Source: image.SourceHttp},
+	}}
+	m := NewMediaMirror(svcCtx)
+
+	// 图片地址指向视频且已有 animation_url 时，视频字段保存 animation_url 的转存结果
+	mock.ExpectExec("UPDATE `ob_item_external_sepolia` SET `is_video_uploaded`=\\?,`update_time`=\\?,`upload_status`=\\?,"+
+		"`video_oss_uri`=\\?,`video_type`=\\?,`video_upload_status`=\\? WHERE id = \\?").
+		WithArgs(true, sqlmock.AnyArg(), multi.HttpUpload, "https://oss/anim.mp4", "video/mp4", multi.HttpUpload, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.mirrorItem(testCtx, "sepolia", &multi.ItemExternal{ID: 1, CollectionAddress: "0x01", TokenId: "1",
+		ImageUri: "https://a/image.mp4", VideoUri: "https://a/anim.mp4"})
+
+	// 只有图片地址指向视频时记录到视频字段
+	mock.ExpectExec("UPDATE `ob_item_external_sepolia` SET `is_video_uploaded`=\\?,`update_time`=\\?,`upload_status`=\\?,"+
+		"`video_oss_uri`=\\?,`video_type`=\\?,`video_upload_status`=\\?,`video_uri`=\\? WHERE id = \\?").
+		WithArgs(true, sqlmock.AnyArg(), multi.HttpUpload, "https://oss/image.mp4", "video/mp4", multi.HttpUpload, "https://a/image.mp4", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.mirrorItem(testCtx, "sepolia", &multi.ItemExternal{ID: 2, CollectionAddress: "0x01", TokenId: "2",
+		ImageUri: "https://a/image.mp4"})
+
+	mock.ExpectExec("UPDATE `ob_item_external_sepolia` SET `is_uploaded_oss`=\\?,`oss_uri`=\\?,`update_time`=\\?,`upload_status`=\\? WHERE id = \\?").
+		WithArgs(true, "https://oss/image.png", sqlmock.AnyArg(), multi.HttpUpload, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.mirrorItem(testCtx, "sepolia", &multi.ItemExternal{ID: 3, CollectionAddress: "0x01", TokenId: "3",
+		ImageUri: "https://a/image.png"})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 转存成功后发布 item 标签，使图片接口的缓存失效
+	messages, err := apicache.ReadAfter(svcCtx.KvStore, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, message := range messages {
+		tags = append(tags, message.Tags...)
+	}
+	want := []string{apicache.ItemTag("sepolia", "0x01", "1"), apicache.ItemTag("sepolia", "0x01", "2"),
+		apicache.ItemTag("sepolia", "0x01", "3")}
+	if strings.Join(tags, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected invalidate tags %v", tags)
+	}
+}
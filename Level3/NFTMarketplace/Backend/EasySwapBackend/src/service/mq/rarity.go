@@ -0,0 +1,79 @@
+package mq
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/rarity"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+// rarityInterval 两轮重新计算稀有度之间的间隔，批量刷新元数据时同一个集合在一轮内只计算一次
+const rarityInterval = 30 * time.Second
+
+// RarityUpdater 重新计算属性发生变化的集合的稀有度。
+// 元数据刷新后集合被记录到 rarity.GetRarityDirtyKey 中，每轮取出全部集合逐个计算；
+// 计算失败的集合重新记录，下一轮再次计算。
+type RarityUpdater struct {
+	svcCtx  *svc.ServerCtx
+	project string
+	chains  []*config.ChainSupported
+}
+
+// NewRarityUpdater 创建稀有度计算任务
+func NewRarityUpdater(svcCtx *svc.ServerCtx) *RarityUpdater {
+	return &RarityUpdater{
+		svcCtx:  svcCtx,
+		project: svcCtx.C.ProjectCfg.Name,
+		chains:  svcCtx.C.ChainSupported,
+	}
+}
+
+// Start 为每条链启动一个计算协程
+func (u *RarityUpdater) Start(ctx context.Context) {
+	for _, chain := range u.chains {
+		go u.run(ctx, chain.Name)
+	}
+}
+
+func (u *RarityUpdater) run(ctx context.Context, chain string) {
+	xzap.WithContext(ctx).Info("rarity updater started", zap.String("chain", chain))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rarityInterval):
+		}
+		u.updateDirty(ctx, chain)
+	}
+}
+
+// updateDirty 取出本轮全部需要计算的集合，失败的集合放回下一轮
+func (u *RarityUpdater) updateDirty(ctx context.Context, chain string) {
+	var failed []string
+	for ctx.Err() == nil {
+		collectionAddr, err := rarity.PopDirty(u.svcCtx.KvStore, u.project, chain)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on pop rarity dirty collection", zap.String("chain", chain), zap.Error(err))
+			break
+		}
+		if collectionAddr == "" {
+			break
+		}
+		if err := rarity.Recompute(ctx, u.svcCtx.DB, u.project, chain, collectionAddr); err != nil {
+			xzap.WithContext(ctx).Error("failed on recompute collection rarity", zap.String("chain", chain),
+				zap.String("collection_addr", collectionAddr), zap.Error(err))
+			failed = append(failed, collectionAddr)
+		}
+	}
+
+	for _, collectionAddr := range failed {
+		if err := rarity.MarkDirty(u.svcCtx.KvStore, u.project, chain, collectionAddr); err != nil {
+			xzap.WithContext(ctx).Error("failed on mark rarity dirty", zap.String("collection_addr", collectionAddr), zap.Error(err))
+		}
+	}
+}
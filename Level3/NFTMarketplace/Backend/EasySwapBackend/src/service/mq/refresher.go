@@ -0,0 +1,377 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/rarity"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// CacheRefreshMetadataRetryKey 刷新失败等待重试的物品（有序集合），score 为下一次重试的时间戳（秒）
+const CacheRefreshMetadataRetryKey = "cache:%s:%s:item:refresh:metadata:retry"
+
+const (
+	defaultRefreshWorkers     = 8
+	defaultRefreshHostRate    = 5
+	defaultRefreshMaxAttempts = 5
+
+	// refreshIdleInterval 队列为空时的轮询间隔
+	refreshIdleInterval = time.Second
+	// refreshRetryBaseDelay 第一次重试的等待时间，之后每次翻倍
+	refreshRetryBaseDelay = 5 * time.Second
+	// refreshRetryMaxDelay 重试等待时间的上限
+	refreshRetryMaxDelay = 10 * time.Minute
+
+	// ipfsHost ipfs:// 地址通过网关访问，统一按一个域名限流
+	ipfsHost = "ipfs"
+
+	// claimRefreshRetryScript 取出并删除已到重试时间的物品，ARGV: 当前时间戳, 数量
+	claimRefreshRetryScript = `local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #items > 0 then
+    redis.call('ZREM', KEYS[1], unpack(items))
+end
+return items`
+)
+
+// GetRefreshMetadataRetryKey 根据项目名和链名生成刷新元数据重试队列的缓存键
+func GetRefreshMetadataRetryKey(project, chain string) string {
+	return fmt.Sprintf(CacheRefreshMetadataRetryKey, strings.ToLower(project), strings.ToLower(chain))
+}
+
+// MetadataRefresher 消费 AddSingleItemToRefreshMetadataQueue 写入的刷新队列，
+// 通过链上 tokenURI 重新获取元数据并更新 ob_item_*、ob_item_trait_* 和 ob_item_external_*，
+// 并标记集合需要重新计算稀有度。
+//
+// 所有链共用一个并发上限，同一个元数据域名按 HostRate 限流；
+// 失败的物品按指数退避放入重试队列，超过 MaxAttempts 次后标记为 FetchMetadataFailed。
+// 物品从队列取出后进程退出会丢失本次刷新，用户可以重新发起刷新。
+type MetadataRefresher struct {
+	svcCtx      *svc.ServerCtx
+	project     string
+	chains      []*config.ChainSupported
+	maxAttempts int
+	sem         chan struct{}
+	limiter     *hostLimiter
+}
+
+// NewMetadataRefresher 创建元数据刷新器，未配置的参数使用默认值
+func NewMetadataRefresher(svcCtx *svc.ServerCtx) *MetadataRefresher {
+	cfg := config.MetadataRefreshCfg{}
+	if svcCtx.C.MetadataRefresh != nil {
+		cfg = *svcCtx.C.MetadataRefresh
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultRefreshWorkers
+	}
+	if cfg.HostRate <= 0 {
+		cfg.HostRate = defaultRefreshHostRate
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultRefreshMaxAttempts
+	}
+
+	return &MetadataRefresher{
+		svcCtx:      svcCtx,
+		project:     svcCtx.C.ProjectCfg.Name,
+		chains:      svcCtx.C.ChainSupported,
+		maxAttempts: cfg.MaxAttempts,
+		sem:         make(chan struct{}, cfg.Workers),
+		limiter:     newHostLimiter(time.Second / time.Duration(cfg.HostRate)),
+	}
+}
+
+// Start 为每条链启动一个消费协程，ctx 取消后停止取新的物品
+func (r *MetadataRefresher) Start(ctx context.Context) {
+	for _, chain := range r.chains {
+		go r.run(ctx, chain.Name)
+	}
+}
+
+func (r *MetadataRefresher) run(ctx context.Context, chain string) {
+	xzap.WithContext(ctx).Info("metadata refresher started", zap.String("chain", chain))
+	for {
+		// 先占用并发名额再取物品，保证取出的物品都能被处理
+		select {
+		case <-ctx.Done():
+			return
+		case r.sem <- struct{}{}:
+		}
+
+		item, err := r.next(ctx, chain)
+		if err != nil || item == nil {
+			<-r.sem
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on pop refresh item", zap.String("chain", chain), zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(refreshIdleInterval):
+			}
+			continue
+		}
+
+		go func(item *types.RefreshItem) {
+			defer func() { <-r.sem }()
+			r.refresh(ctx, chain, item)
+		}(item)
+	}
+}
+
+// next 优先取已到重试时间的物品，没有时从刷新队列中取一个，队列为空时返回 nil
+func (r *MetadataRefresher) next(ctx context.Context, chain string) (*types.RefreshItem, error) {
+	result, err := r.svcCtx.KvStore.Eval(claimRefreshRetryScript, GetRefreshMetadataRetryKey(r.project, chain), time.Now().Unix(), 1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on claim refresh retry")
+	}
+	var raw string
+	if items, ok := result.([]interface{}); ok && len(items) > 0 {
+		raw, _ = items[0].(string)
+	}
+
+	if raw == "" {
+		raw, err = r.svcCtx.KvStore.Spop(GetRefreshSingleItemMetadataKey(r.project, chain))
+		if err == redis.Nil {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on pop refresh queue")
+		}
+	}
+
+	var item types.RefreshItem
+	if err := json.Unmarshal([]byte(raw), &item); err != nil {
+		// 无法解析的物品直接丢弃
+		xzap.WithContext(ctx).Error("invalid refresh item", zap.String("item", raw), zap.Error(err))
+		return nil, nil
+	}
+	return &item, nil
+}
+
+// refresh 刷新一个物品的元数据，失败时放入重试队列或者标记为获取失败
+func (r *MetadataRefresher) refresh(ctx context.Context, chain string, item *types.RefreshItem) {
+	err := r.refreshItem(ctx, chain, item)
+	if err == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		// 退出过程中被中断，不计入失败次数
+		r.retry(ctx, chain, item, 0)
+		return
+	}
+
+	item.Attempts++
+	fields := []zap.Field{zap.String("chain", chain), zap.String("collection_addr", item.CollectionAddr),
+		zap.String("token_id", item.TokenID), zap.Int("attempts", item.Attempts), zap.Error(err)}
+	if item.Attempts >= r.maxAttempts {
+		xzap.WithContext(ctx).Error("failed on refresh item metadata, give up", fields...)
+		if err := r.markFailed(ctx, chain, item); err != nil {
+			xzap.WithContext(ctx).Error("failed on mark item metadata failed", zap.Error(err))
+		}
+		return
+	}
+
+	delay := refreshRetryBaseDelay << (item.Attempts - 1)
+	if delay > refreshRetryMaxDelay {
+		delay = refreshRetryMaxDelay
+	}
+	xzap.WithContext(ctx).Warn("failed on refresh item metadata, retry later", append(fields, zap.Duration("delay", delay))...)
+	r.retry(ctx, chain, item, delay)
+}
+
+// retry 把物品放入重试队列，delay 后可以再次被取出
+func (r *MetadataRefresher) retry(ctx context.Context, chain string, item *types.RefreshItem, delay time.Duration) {
+	rawInfo, err := json.Marshal(item)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on marshal refresh item", zap.Error(err))
+		return
+	}
+	if _, err := r.svcCtx.KvStore.Zadd(GetRefreshMetadataRetryKey(r.project, chain), time.Now().Add(delay).Unix(), string(rawInfo)); err != nil {
+		xzap.WithContext(ctx).Error("failed on push refresh item to retry queue", zap.Error(err))
+	}
+}
+
+// refreshItem 通过物品所在链的节点获取 tokenURI，按域名限流后获取元数据并写入数据库
+func (r *MetadataRefresher) refreshItem(ctx context.Context, chain string, item *types.RefreshItem) error {
+	nodeSrv, ok := r.svcCtx.NodeSrvs[item.ChainID]
+	if !ok {
+		return errors.Errorf("unsupported chain id %d", item.ChainID)
+	}
+
+	tokenUri, err := nodeSrv.TokenURI(item.CollectionAddr, item.TokenID)
+	if err != nil {
+		return errors.Wrap(err, "failed on get token uri")
+	}
+	if err := r.limiter.Wait(ctx, metadataHost(tokenUri)); err != nil {
+		return err
+	}
+	metadata, err := nodeSrv.FetchMetadataByURI(tokenUri)
+	if err != nil {
+		return errors.Wrap(err, "failed on fetch metadata")
+	}
+
+	if err := r.saveMetadata(ctx, chain, item, tokenUri, metadata); err != nil {
+		return err
+	}
+	// 属性可能发生了变化，由 RarityUpdater 重新计算集合的稀有度
+	if err := rarity.MarkDirty(r.svcCtx.KvStore, r.project, chain, item.CollectionAddr); err != nil {
+		xzap.WithContext(ctx).Error("failed on mark rarity dirty", zap.String("collection_addr", item.CollectionAddr), zap.Error(err))
+	}
+	return nil
+}
+
+// saveMetadata 在一个事务中更新物品名称、属性和元数据地址，图片地址变化时需要重新上传 oss
+func (r *MetadataRefresher) saveMetadata(ctx context.Context, chain string, item *types.RefreshItem, tokenUri string, metadata *nftchainservice.JsonMetadata) error {
+	collectionAddr := strings.ToLower(item.CollectionAddr)
+	return r.svcCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if metadata.Name != "" {
+			if err := tx.Table(multi.ItemTableName(chain)).
+				Where("collection_address = ? and token_id = ?", collectionAddr, item.TokenID).
+				Update("name", metadata.Name).Error; err != nil {
+				return errors.Wrap(err, "failed on update item name")
+			}
+		}
+
+		if err := tx.Table(multi.ItemTraitTableName(chain)).
+			Where("collection_address = ? and token_id = ?", collectionAddr, item.TokenID).
+			Delete(&multi.ItemTrait{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete item traits")
+		}
+		var traits []multi.ItemTrait
+		for _, attr := range metadata.Attributes {
+			if attr == nil || attr.TraitType == "" {
+				continue
+			}
+			traits = append(traits, multi.ItemTrait{
+				CollectionAddress: collectionAddr,
+				TokenId:           item.TokenID,
+				Trait:             attr.TraitType,
+				TraitValue:        attr.Value,
+			})
+		}
+		if len(traits) > 0 {
+			if err := tx.Table(multi.ItemTraitTableName(chain)).Create(&traits).Error; err != nil {
+				return errors.Wrap(err, "failed on create item traits")
+			}
+		}
+
+		external := multi.ItemExternal{
+			CollectionAddress: collectionAddr,
+			TokenId:           item.TokenID,
+			UploadStatus:      multi.OK,
+			MetaDataUri:       tokenUri,
+			ImageUri:          metadata.Image,
+		}
+		// MySQL 按顺序执行赋值，is_uploaded_oss 和 upload_status 需要在 image_uri 更新前比较；
+		// 图片没有变化时保留转存状态，图片变化或者之前获取元数据失败时重新等待转存
+		if err := tx.Table(multi.ItemExternalTableName(chain)).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "is_uploaded_oss"}, Value: gorm.Expr("IF(image_uri <=> VALUES(image_uri), is_uploaded_oss, 0)")},
+				{Column: clause.Column{Name: "upload_status"}, Value: gorm.Expr("IF(image_uri <=> VALUES(image_uri) AND upload_status <> ?, upload_status, ?)", multi.FetchMetadataFailed, multi.OK)},
+				{Column: clause.Column{Name: "meta_data_uri"}, Value: tokenUri},
+				{Column: clause.Column{Name: "image_uri"}, Value: metadata.Image},
+				{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+			},
+		}).Create(&external).Error; err != nil {
+			return errors.Wrap(err, "failed on upsert item external")
+		}
+		return nil
+	})
+}
+
+// markFailed 重试次数用完后把物品标记为获取元数据失败
+func (r *MetadataRefresher) markFailed(ctx context.Context, chain string, item *types.RefreshItem) error {
+	external := multi.ItemExternal{
+		CollectionAddress: strings.ToLower(item.CollectionAddr),
+		TokenId:           item.TokenID,
+		UploadStatus:      multi.FetchMetadataFailed,
+	}
+	return r.svcCtx.DB.WithContext(ctx).Table(multi.ItemExternalTableName(chain)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "upload_status"}, Value: multi.FetchMetadataFailed},
+			{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+		},
+	}).Create(&external).Error
+}
+
+// metadataHost 返回元数据地址用于限流的域名，base64 内嵌的元数据不需要限流
+func metadataHost(tokenUri string) string {
+	if strings.HasPrefix(tokenUri, "data:") {
+		return ""
+	}
+	if strings.HasPrefix(tokenUri, "ipfs:") {
+		return ipfsHost
+	}
+	u, err := url.Parse(tokenUri)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// hostLimiter 按域名限制请求频率，同一个域名两次请求至少间隔 interval
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+// Wait 等待到 host 可以发起下一次请求，ctx 取消时返回错误
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	if host == "" || l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	// 清理已经空闲的域名，避免 map 无限增长
+	if len(l.next) > 1024 {
+		for h, t := range l.next {
+			if t.Before(now) {
+				delete(l.next, h)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,239 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const testProject = "EasySwap"
+
+var testCtx = xzap.ToContext(context.Background(), zap.NewNop())
+
+// newTestSvcCtx 创建使用 miniredis 和 sqlmock 的服务上下文，没有链节点
+func newTestSvcCtx(t *testing.T, c *config.Config) (*svc.ServerCtx, *miniredis.Miniredis, sqlmock.Sqlmock) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.ProjectCfg = &config.ProjectCfg{Name: testProject}
+	c.ChainSupported = []*config.ChainSupported{{Name: "sepolia", ChainID: 11155111}}
+	return &svc.ServerCtx{
+		C:        c,
+		DB:       db,
+		KvStore:  xkv.NewStore(cache.CacheConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}}),
+		NodeSrvs: map[int64]*nftchainservice.Service{},
+	}, mr, mock
+}
+
+// newTestRefresher 创建没有链节点的刷新器，所有刷新都会失败
+func newTestRefresher(t *testing.T, maxAttempts int) (*MetadataRefresher, *miniredis.Miniredis, sqlmock.Sqlmock) {
+	t.Helper()
+	svcCtx, mr, mock := newTestSvcCtx(t, &config.Config{MetadataRefresh: &config.MetadataRefreshCfg{MaxAttempts: maxAttempts}})
+	return NewMetadataRefresher(svcCtx), mr, mock
+}
+
+// retryItems 返回重试队列中的物品和对应的重试时间
+func retryItems(t *testing.T, mr *miniredis.Miniredis) ([]types.RefreshItem, []float64) {
+	t.Helper()
+	key := GetRefreshMetadataRetryKey(testProject, "sepolia")
+	if !mr.Exists(key) {
+		return nil, nil
+	}
+	members, err := mr.ZMembers(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []types.RefreshItem
+	var scores []float64
+	for _, member := range members {
+		var item types.RefreshItem
+		if err := json.Unmarshal([]byte(member), &item); err != nil {
+			t.Fatal(err)
+		}
+		score, err := mr.ZScore(key, member)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+		scores = append(scores, score)
+	}
+	return items, scores
+}
+
+func TestRefreshRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{attempts: 0, delay: 5 * time.Second},
+		{attempts: 1, delay: 10 * time.Second},
+		{attempts: 3, delay: 40 * time.Second},
+		{attempts: 6, delay: 320 * time.Second},
+		// 超过上限后不再翻倍
+		{attempts: 7, delay: 10 * time.Minute},
+		{attempts: 15, delay: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		r, mr, _ := newTestRefresher(t, 20)
+		before := time.Now().Unix()
+		r.refresh(testCtx, "sepolia", &types.RefreshItem{ChainID: 11155111, CollectionAddr: "0xabc", TokenID: "1", Attempts: tt.attempts})
+		after := time.Now().Unix()
+
+		items, scores := retryItems(t, mr)
+		if len(items) != 1 || items[0].Attempts != tt.attempts+1 {
+			t.Fatalf("attempts %d: unexpected retry items %+v", tt.attempts, items)
+		}
+		delay := int64(tt.delay / time.Second)
+		if score := int64(scores[0]); score < before+delay || score > after+delay {
+			t.Fatalf("attempts %d: retry at %d, want %d after now", tt.attempts, score, delay)
+		}
+	}
+}
+
+func TestRefreshInterruptedRetryNow(t *testing.T) {
+	r, mr, _ := newTestRefresher(t, 3)
+	ctx, cancel := context.WithCancel(testCtx)
+	cancel()
+
+	// 退出时被中断的刷新立即重试，不计入失败次数
+	before := time.Now().Unix()
+	r.refresh(ctx, "sepolia", &types.RefreshItem{ChainID: 11155111, CollectionAddr: "0xabc", TokenID: "1", Attempts: 2})
+	items, scores := retryItems(t, mr)
+	if len(items) != 1 || items[0].Attempts != 2 || int64(scores[0]) < before || int64(scores[0]) > time.Now().Unix() {
+		t.Fatalf("unexpected retry items %+v %v", items, scores)
+	}
+}
+
+func TestRefreshMarkFailed(t *testing.T) {
+	r, mr, mock := newTestRefresher(t, 3)
+	mock.ExpectExec("INSERT INTO `ob_item_external_sepolia`.*ON DUPLICATE KEY UPDATE `upload_status`=\\?,`update_time`=\\?").
+		WithArgs("0xabc", "1", false, multi.FetchMetadataFailed, "", "", "", false, 0, "", "", "", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			multi.FetchMetadataFailed, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// 最后一次失败后不再重试，标记为获取元数据失败
+	r.refresh(testCtx, "sepolia", &types.RefreshItem{ChainID: 11155111, CollectionAddr: "0xABC", TokenID: "1", Attempts: 2})
+	if items, _ := retryItems(t, mr); len(items) != 0 {
+		t.Fatalf("unexpected retry items %+v", items)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshNext(t *testing.T) {
+	r, mr, _ := newTestRefresher(t, 3)
+	retryKey := GetRefreshMetadataRetryKey(testProject, "sepolia")
+	queueKey := GetRefreshSingleItemMetadataKey(testProject, "sepolia")
+	now := time.Now().Unix()
+	mr.ZAdd(retryKey, float64(now-10), `{"chain_id":11155111,"collection_addr":"0xabc","token_id":"1","attempts":1}`)
+	mr.ZAdd(retryKey, float64(now+60), `{"chain_id":11155111,"collection_addr":"0xabc","token_id":"2","attempts":2}`)
+	mr.SAdd(queueKey, `{"chain_id":11155111,"collection_addr":"0xabc","token_id":"3"}`)
+
+	// 已到时间的重试优先于刷新队列
+	item, err := r.next(testCtx, "sepolia")
+	if err != nil || item == nil || item.TokenID != "1" || item.Attempts != 1 {
+		t.Fatalf("unexpected first item %+v %v", item, err)
+	}
+	item, err = r.next(testCtx, "sepolia")
+	if err != nil || item == nil || item.TokenID != "3" {
+		t.Fatalf("unexpected second item %+v %v", item, err)
+	}
+	// 未到时间的重试留在队列中
+	item, err = r.next(testCtx, "sepolia")
+	if err != nil || item != nil {
+		t.Fatalf("unexpected item %+v %v", item, err)
+	}
+	if items, _ := retryItems(t, mr); len(items) != 1 || items[0].TokenID != "2" {
+		t.Fatalf("unexpected retry items %+v", items)
+	}
+
+	// 无法解析的物品被丢弃
+	mr.SAdd(queueKey, "not-json")
+	if item, err := r.next(testCtx, "sepolia"); err != nil || item != nil {
+		t.Fatalf("unexpected item %+v %v", item, err)
+	}
+	if mr.Exists(queueKey) {
+		t.Fatal("invalid item should be removed from queue")
+	}
+}
+
+func TestMetadataHost(t *testing.T) {
+	for uri, want := range map[string]string{
+		"https://API.Example.com/token/1":    "api.example.com",
+		"ipfs://QmHash/1.json":               ipfsHost,
+		"data:application/json;base64,e30=":  "",
+		"http://example.com:8080/metadata/1": "example.com:8080",
+		"://bad":                             "",
+	} {
+		if got := metadataHost(uri); got != want {
+			t.Fatalf("metadataHost(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	interval := 100 * time.Millisecond
+	l := newHostLimiter(interval)
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := l.Wait(ctx, "a.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Wait(ctx, "b.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Wait(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	// 不同域名和不限流的地址不需要等待
+	if elapsed := time.Since(start); elapsed >= interval {
+		t.Fatalf("first requests waited %s", elapsed)
+	}
+
+	// 同一个域名的第二次请求需要等待一个间隔
+	if err := l.Wait(ctx, "a.com"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < interval {
+		t.Fatalf("second request waited only %s", elapsed)
+	}
+
+	// 等待中取消返回错误，已经占用的时间不会释放
+	cancelCtx, cancel := context.WithTimeout(ctx, interval/4)
+	defer cancel()
+	if err := l.Wait(cancelCtx, "a.com"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if next := l.next["a.com"]; next.Sub(start) < 3*interval {
+		t.Fatalf("unexpected next request time %s", next.Sub(start))
+	}
+}
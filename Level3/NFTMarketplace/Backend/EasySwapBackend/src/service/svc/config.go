@@ -2,7 +2,7 @@ package svc
 
 import (
 	"github.com/ProjectsTask/EasySwapBase/evm/erc"
-	//"github.com/ProjectsTask/EasySwapBase/image"
+	"github.com/ProjectsTask/EasySwapBase/image"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"gorm.io/gorm"
 
@@ -10,11 +10,11 @@ import (
 )
 
 type CtxConfig struct {
-	db *gorm.DB
-	//imageMgr image.ImageManager
-	dao     *dao.Dao
-	KvStore *xkv.Store
-	Evm     erc.Erc
+	db       *gorm.DB
+	imageMgr image.ImageManager
+	dao      *dao.Dao
+	KvStore  *xkv.Store
+	Evm      erc.Erc
 }
 
 type CtxOption func(conf *CtxConfig)
@@ -32,7 +32,8 @@ func NewServerCtx(options ...CtxOption) *ServerCtx {
 	return &ServerCtx{
 		// 返回数据库连接
 		DB: c.db,
-		//ImageMgr: c.imageMgr,
+		// 返回图片管理器
+		ImageMgr: c.imageMgr,
 		// 返回键值存储
 		KvStore: c.KvStore,
 		// 返回数据访问对象
@@ -66,3 +67,11 @@ func WithDao(dao *dao.Dao) CtxOption {
 		conf.dao = dao
 	}
 }
+
+func WithImageMgr(imageMgr image.ImageManager) CtxOption {
+	// 返回一个函数，该函数接受一个指向CtxConfig的指针作为参数
+	return func(conf *CtxConfig) {
+		// 将传入的图片管理器赋值给CtxConfig的imageMgr字段
+		conf.imageMgr = imageMgr
+	}
+}
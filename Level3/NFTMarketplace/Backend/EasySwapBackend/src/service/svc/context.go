@@ -3,9 +3,16 @@ package svc
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 
 	// 引入 NFT 链服务相关的包
 	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	// 引入图片转存相关的包
+	"github.com/ProjectsTask/EasySwapBase/image"
+	// 引入 IPFS 网关池相关的包
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
 	// 引入日志相关的包
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	// 引入数据库相关的包
@@ -27,6 +34,12 @@ import (
 	"github.com/ProjectsTask/EasySwapBackend/src/config"
 	// 引入数据访问对象相关的包
 	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	// 引入登录令牌相关的包
+	"github.com/ProjectsTask/EasySwapBackend/src/service/auth"
+	// 引入分页游标相关的包
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
+	// 引入实时推送相关的包
+	"github.com/ProjectsTask/EasySwapBackend/src/service/feed"
 )
 
 // ServerCtx 结构体用于保存服务的上下文信息
@@ -35,8 +48,8 @@ type ServerCtx struct {
 	C *config.Config
 	// GORM 数据库连接对象
 	DB *gorm.DB
-	// 图片管理器，用于处理图片相关操作
-	//ImageMgr image.ImageManager
+	// 图片管理器，用于处理图片相关操作，未配置 image_cfg 时为空
+	ImageMgr image.ImageManager
 	// 数据访问对象，用于操作数据库
 	Dao *dao.Dao
 	// KV 存储对象，用于缓存数据
@@ -45,16 +58,34 @@ type ServerCtx struct {
 	RankKey string
 	// 链服务映射，键为链 ID，值为对应的链服务实例
 	NodeSrvs map[int64]*nftchainservice.Service
+	// 登录会话和令牌管理
+	Auth *auth.Manager
+	// 实时推送网关
+	Feed *feed.Hub
+	// 分页游标的编码和验证
+	Cursor *cursor.Codec
 }
 
 // NewServiceContext 函数用于创建并初始化服务上下文
 func NewServiceContext(c *config.Config) (*ServerCtx, error) {
-	var err error
-	// 图片管理器初始化
-	//imageMgr, err = image.NewManager(c.ImageCfg)
-	//if err != nil {
-	//    return nil, errors.Wrap(err, "failed on create image manager")
-	//}
+	// 所有链和图片转存共用一个 IPFS 网关池，共享网关健康状态和磁盘缓存
+	var ipfsCfg ipfs.Config
+	if c.MetadataParse.Ipfs != nil {
+		ipfsCfg = *c.MetadataParse.Ipfs
+	}
+	ipfsPool, err := ipfs.NewPool(ipfsCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create ipfs pool")
+	}
+
+	// 图片管理器初始化，未配置时不转存图片
+	var imageMgr image.ImageManager
+	if c.ImageCfg != nil {
+		imageMgr, err = image.NewManager(c.ImageCfg, ipfsPool)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on create image manager")
+		}
+	}
 
 	// 根据配置设置日志
 	_, err = xzap.SetUp(c.Log)
@@ -100,23 +131,86 @@ func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 			// 如果链服务创建失败，返回错误
 			return nil, errors.Wrap(err, "failed on start onchain sync service")
 		}
+		nodeSrvs[int64(supported.ChainID)].Ipfs = ipfsPool
+	}
+
+	// 创建登录令牌管理器
+	authMgr, err := newAuthManager(c.Auth, store)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建分页游标编码器
+	cursorCodec, err := newCursorCodec(c)
+	if err != nil {
+		return nil, err
 	}
 
-	// 创建数据访问对象实例
-	dao := dao.New(context.Background(), db, store)
+	// 创建数据访问对象实例，多链查询只允许访问配置中支持的链
+	chains := make([]string, 0, len(c.ChainSupported))
+	for _, supported := range c.ChainSupported {
+		chains = append(chains, supported.Name)
+	}
+	dao := dao.New(context.Background(), db, store, chains)
 	// 创建服务上下文实例
 	serverCtx := NewServerCtx(
 		WithDB(db),
 		WithKv(store),
-		// 注释掉的图片管理器设置，可能后续会启用
-		//WithImageMgr(imageMgr),
+		// 设置图片管理器
+		WithImageMgr(imageMgr),
 		WithDao(dao),
 	)
 	// 设置服务上下文的配置
 	serverCtx.C = c
 	// 设置服务上下文的链服务映射
 	serverCtx.NodeSrvs = nodeSrvs
+	// 设置服务上下文的令牌管理器
+	serverCtx.Auth = authMgr
+	// 设置服务上下文的实时推送网关
+	serverCtx.Feed = feed.NewHub(store, c.Feed, c.ChainSupported)
+	// 设置服务上下文的分页游标编码器
+	serverCtx.Cursor = cursorCodec
 
 	// 返回服务上下文实例和 nil 错误
 	return serverCtx, nil
 }
+
+// newAuthManager 根据配置创建登录令牌管理器，未配置签名密钥时返回错误
+func newAuthManager(c *config.AuthCfg, store *xkv.Store) (*auth.Manager, error) {
+	if c == nil {
+		return nil, errors.New("auth config is required")
+	}
+	var keys []auth.Key
+	for _, key := range c.Keys {
+		keys = append(keys, auth.Key{ID: key.ID, Secret: key.Secret})
+	}
+	signer, err := auth.NewSigner(keys, c.ActiveKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create token signer")
+	}
+	return auth.NewManager(store, signer, c.AccessTTL, c.RefreshTTL), nil
+}
+
+// newCursorCodec 创建分页游标编码器，未配置游标密钥时由登录令牌的当前密钥派生，
+// 令牌密钥轮换后已经发出的游标随之失效
+func newCursorCodec(c *config.Config) (*cursor.Codec, error) {
+	secret := ""
+	if c.Cursor != nil {
+		secret = c.Cursor.Secret
+	}
+	if secret == "" {
+		for _, key := range c.Auth.Keys {
+			if key.ID == c.Auth.ActiveKey || c.Auth.ActiveKey == "" {
+				mac := hmac.New(sha256.New, []byte(key.Secret))
+				mac.Write([]byte("easyswap pagination cursor"))
+				secret = hex.EncodeToString(mac.Sum(nil))
+				break
+			}
+		}
+	}
+	codec, err := cursor.NewCodec(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create cursor codec")
+	}
+	return codec, nil
+}
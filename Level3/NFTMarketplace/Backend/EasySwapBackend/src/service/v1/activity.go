@@ -5,6 +5,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
 )
@@ -16,19 +18,21 @@ import (
 //     svcCtx: 服务上下文对象
 //     chainID: 链ID数组
 //     chainName: 链名称数组
-//     collectionAddrs: 集合地址数组
-//     tokenID: 代币ID
-//     userAddrs: 用户地址数组
-//     eventTypes: 事件类型数组
-//     page: 页码
+//     filter: 过滤条件，包括集合地址、代币ID、用户地址、事件类型和时间范围
+//     page: 页码，为 0 时按游标分页
 //     pageSize: 每页条数
+//     cursorParams: 游标分页参数
 //
 // 返回值：
 //     *types.ActivityResp: 活动响应对象，包含活动结果和总数
 //     error: 错误信息，如果发生错误则返回
-func GetMultiChainActivities(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chainName []string, collectionAddrs []string, tokenID string, userAddrs []string, eventTypes []string, page, pageSize int) (*types.ActivityResp, error) {
+func GetMultiChainActivities(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chainName []string, filter dao.ActivityFilter, page, pageSize int, cursorParams types.CursorParams) (*types.ActivityResp, error) {
+	if cursorParams.UseCursor(page) {
+		return getMultiChainActivitiesByCursor(ctx, svcCtx, chainID, chainName, filter, pageSize, cursorParams)
+	}
+
 	// 查询多链活动
-	activities, total, err := svcCtx.Dao.QueryMultiChainActivities(ctx, chainName, collectionAddrs, tokenID, userAddrs, eventTypes, page, pageSize)
+	activities, total, err := svcCtx.Dao.QueryMultiChainActivities(ctx, chainName, filter, page, pageSize)
 	if err != nil {
 		// 如果查询失败，返回错误信息
 		return nil, errors.Wrap(err, "failed on query multi-chain activity")
@@ -56,3 +60,36 @@ func GetMultiChainActivities(ctx context.Context, svcCtx *svc.ServerCtx, chainID
 		Count:  total,
 	}, nil
 }
+
+// getMultiChainActivitiesByCursor 按游标查询多链活动，游标只能用于相同的链和过滤条件
+func getMultiChainActivitiesByCursor(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chainName []string, filter dao.ActivityFilter, pageSize int, cursorParams types.CursorParams) (*types.ActivityResp, error) {
+	scope := cursor.Scope("activity", []interface{}{chainName, filter})
+	page, err := decodePage(svcCtx, scope, cursorParams, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, edges, err := svcCtx.Dao.QueryMultiChainActivitiesByCursor(ctx, chainName, filter, page)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query multi-chain activity")
+	}
+
+	res := &types.ActivityResp{}
+	if res.CursorPage, err = encodePage(svcCtx, scope, edges); err != nil {
+		return nil, errors.Wrap(err, "failed on encode activity cursor")
+	}
+	if cursorParams.WithTotal {
+		if res.Count, err = svcCtx.Dao.CountMultiChainActivities(ctx, chainName, filter); err != nil {
+			return nil, errors.Wrap(err, "failed on count multi-chain activity")
+		}
+	}
+	if len(activities) == 0 {
+		return res, nil
+	}
+
+	// 查询外部信息
+	if res.Result, err = svcCtx.Dao.QueryMultiChainActivityExternalInfo(ctx, chainID, chainName, activities); err != nil {
+		return nil, errors.Wrap(err, "failed on query activity external info")
+	}
+	return res, nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// GetCollectionCandles 获取集合 [from, to) 内的成交价 K 线和地板价序列。
+// K 线由同步服务增量汇总的集合统计桶合并得到，不扫描活动表；地板价取自地板价快照表。
+// 周期按 loc 的本地时间对齐，最多返回 limit 个周期，没有成交或快照的周期沿用上一周期的价格。
+func GetCollectionCandles(ctx context.Context, svcCtx *svc.ServerCtx, chain, collectionAddr, interval string,
+	from, to int64, loc *time.Location, limit int) (*types.CollectionCandles, error) {
+	res := &types.CollectionCandles{
+		Interval: interval,
+		TimeZone: loc.String(),
+		Candles:  []collectionstats.Candle{},
+		Floors:   []collectionstats.FloorPoint{},
+	}
+	starts, end, more := collectionstats.CandlePeriods(from, to, collectionstats.CandleIntervals[interval], loc, limit)
+	if len(starts) == 0 {
+		return res, nil
+	}
+	if more {
+		res.NextFrom = end
+	}
+
+	// 使用能对齐全部周期边界的最粗的桶，减少读取的行数
+	bucket := collectionstats.SourceBucket(starts, end)
+	rows, prevClose, err := svcCtx.Dao.QueryCollectionCandleStats(ctx, chain, collectionAddr, bucket, starts[0], end)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection candle stats")
+	}
+	points, prevFloor, err := svcCtx.Dao.QueryCollectionFloorHistory(ctx, chain, collectionAddr, bucket, starts[0], end)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection floor history")
+	}
+
+	res.Candles = collectionstats.FoldCandles(starts, end, rows, prevClose)
+	res.Floors = collectionstats.FoldFloors(starts, end, points, prevFloor)
+	return res, nil
+}
@@ -16,6 +16,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/mq"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -62,8 +63,16 @@ func GetBids(ctx context.Context, svcCtx *svc.ServerCtx, chain string, collectio
 func GetItems(ctx context.Context, svcCtx *svc.ServerCtx, chain string, filter types.CollectionItemFilterParams, collectionAddr string) (*types.NFTListingInfoResp, error) {
 	// 1. 查询基础Item信息和订单信息
 	// 调用Dao层的QueryCollectionItemOrder方法查询指定集合中符合过滤条件的Item信息和订单信息
-	// 传入上下文、链名称、过滤参数和集合地址作为参数
-	items, count, err := svcCtx.Dao.QueryCollectionItemOrder(ctx, chain, filter, collectionAddr)
+	// 传入上下文、链名称、过滤参数和集合地址作为参数，page 为 0 或指定了游标时按游标分页
+	var items []*dao.CollectionItem
+	var count int64
+	var pageRes types.CursorPage
+	var err error
+	if filter.UseCursor(filter.Page) {
+		items, count, pageRes, err = getCollectionItemsByCursor(ctx, svcCtx, chain, filter, collectionAddr)
+	} else {
+		items, count, err = svcCtx.Dao.QueryCollectionItemOrder(ctx, chain, filter, collectionAddr)
+	}
 	// 检查查询过程中是否出现错误
 	if err != nil {
 		// 若出现错误，返回 nil 和包装后的错误信息，提示获取Item信息失败
@@ -256,6 +265,8 @@ func GetItems(ctx context.Context, svcCtx *svc.ServerCtx, chain string, filter t
 			OwnerAddress:      item.Owner,
 			ListPrice:         item.ListPrice,
 			MarketID:          item.MarketID,
+			RarityScore:       item.RarityScore,
+			RarityRank:        item.RarityRank,
 			// 初始设置为集合级别的最高出价信息
 			BidOrderID:    collectionBestBid.OrderID,
 			BidExpireTime: collectionBestBid.ExpireTime,
@@ -328,11 +339,42 @@ func GetItems(ctx context.Context, svcCtx *svc.ServerCtx, chain string, filter t
 	}
 
 	return &types.NFTListingInfoResp{
-		Result: respItems,
-		Count:  count,
+		Result:     respItems,
+		Count:      count,
+		CursorPage: pageRes,
 	}, nil
 }
 
+// getCollectionItemsByCursor 按游标查询集合内的Item，请求 with_total 时返回近似的总数
+func getCollectionItemsByCursor(ctx context.Context, svcCtx *svc.ServerCtx, chain string, filter types.CollectionItemFilterParams,
+	collectionAddr string) ([]*dao.CollectionItem, int64, types.CursorPage, error) {
+	// 游标只能用于相同的过滤条件和排序
+	conds := filter
+	conds.Page, conds.PageSize, conds.CursorParams = 0, 0, types.CursorParams{}
+	scope := cursor.Scope("collection:items", []interface{}{chain, strings.ToLower(collectionAddr), conds})
+	page, err := decodePage(svcCtx, scope, filter.CursorParams, filter.PageSize)
+	if err != nil {
+		return nil, 0, types.CursorPage{}, err
+	}
+
+	items, edges, err := svcCtx.Dao.QueryCollectionItemOrderByCursor(ctx, chain, filter, collectionAddr, page)
+	if err != nil {
+		return nil, 0, types.CursorPage{}, err
+	}
+	pageRes, err := encodePage(svcCtx, scope, edges)
+	if err != nil {
+		return nil, 0, types.CursorPage{}, errors.Wrap(err, "failed on encode items cursor")
+	}
+
+	var count int64
+	if filter.WithTotal {
+		if count, err = svcCtx.Dao.CountCollectionItems(ctx, chain, conds, collectionAddr); err != nil {
+			return nil, 0, types.CursorPage{}, err
+		}
+	}
+	return items, count, pageRes, nil
+}
+
 // GetItem 获取单个NFT的详细信息
 // 参数:
 // - ctx context.Context: 上下文，用于控制请求的生命周期。
@@ -708,6 +750,26 @@ func GetItemOwner(ctx context.Context, svcCtx *svc.ServerCtx, chainID int64, cha
 	}, nil
 }
 
+// GetItemHolders 分页获取 ERC-1155 token 的持有人列表，按持有数量降序排列
+func GetItemHolders(ctx context.Context, svcCtx *svc.ServerCtx, chain, collectionAddr, tokenID string, page, pageSize int) (*types.ItemHoldersResp, error) {
+	balances, count, err := svcCtx.Dao.QueryItemHolders(ctx, chain, collectionAddr, tokenID, page, pageSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get item holders")
+	}
+
+	holders := make([]types.ItemHolder, 0, len(balances))
+	for _, balance := range balances {
+		holders = append(holders, types.ItemHolder{
+			Owner:   balance.Owner,
+			Balance: balance.Balance,
+		})
+	}
+	return &types.ItemHoldersResp{
+		Result: holders,
+		Count:  count,
+	}, nil
+}
+
 // GetItemTraits 获取NFT的 Trait信息
 // 主要功能:
 // 1. 并发查询三个信息:
@@ -817,7 +879,7 @@ func GetCollectionDetail(ctx context.Context, svcCtx *svc.ServerCtx, chain strin
 	}
 
 	// 获取集合24小时交易信息
-	tradeInfos, err := svcCtx.Dao.GetTradeInfoByCollection(chain, collectionAddr, "1d")
+	tradeInfos, err := svcCtx.Dao.GetTradeInfoByCollection(ctx, chain, collectionAddr, "1d")
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on get collection trade info", zap.Error(err))
 		//return nil, errcode.NewCustomErr("cache error")
@@ -858,17 +920,20 @@ func GetCollectionDetail(ctx context.Context, svcCtx *svc.ServerCtx, chain strin
 		}
 	}
 
-	// 获取24小时交易量和销售数量
-	var volume24h decimal.Decimal
-	var sold int64
+	// 获取24小时交易统计
+	var trade24h dao.CollectionTrade
 	if tradeInfos != nil {
-		volume24h = tradeInfos.Volume
-		sold = tradeInfos.ItemCount
+		trade24h = *tradeInfos
+	}
+	// 地板价变化以当前地板价和 24 小时前的地板价快照计算
+	var floorChange int
+	if trade24h.PreFloorPrice.GreaterThan(decimal.Zero) {
+		floorChange = int(floorPrice.Sub(trade24h.PreFloorPrice).Div(trade24h.PreFloorPrice).Mul(decimal.NewFromInt(100)).IntPart())
 	}
 
 	// 查询总交易量
 	var allVol decimal.Decimal
-	collectionVol, err := svcCtx.Dao.GetCollectionVolume(chain, collectionAddr)
+	collectionVol, err := svcCtx.Dao.GetCollectionVolume(ctx, chain, collectionAddr)
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on query collection all volume", zap.Error(err))
 	} else {
@@ -877,18 +942,23 @@ func GetCollectionDetail(ctx context.Context, svcCtx *svc.ServerCtx, chain strin
 
 	// 构建返回结果
 	detail := types.CollectionDetail{
-		ImageUri:    collection.ImageUri, // svcCtx.ImageMgr.GetFileUrl(collection.ImageUri),
-		Name:        collection.Name,
-		Address:     collection.Address,
-		ChainId:     collection.ChainId,
-		FloorPrice:  floorPrice,
-		SellPrice:   collectionSell.SalePrice.String(),
-		VolumeTotal: allVol,
-		Volume24h:   volume24h,
-		Sold24h:     sold,
-		ListAmount:  listed,
-		TotalSupply: collection.ItemAmount,
-		OwnerAmount: collection.OwnerAmount,
+		ImageUri:        collection.ImageUri, // svcCtx.ImageMgr.GetFileUrl(collection.ImageUri),
+		Name:            collection.Name,
+		Address:         collection.Address,
+		ChainId:         collection.ChainId,
+		FloorPrice:      floorPrice,
+		SellPrice:       collectionSell.SalePrice.String(),
+		VolumeTotal:     allVol,
+		Volume24h:       trade24h.Volume,
+		Sold24h:         trade24h.ItemCount,
+		VolumeChange24h: trade24h.VolumeChange,
+		FloorChange24h:  floorChange,
+		MinPrice24h:     trade24h.MinPrice,
+		AvgPrice24h:     trade24h.AvgPrice,
+		MaxPrice24h:     trade24h.MaxPrice,
+		ListAmount:      listed,
+		TotalSupply:     collection.ItemAmount,
+		OwnerAmount:     collection.OwnerAmount,
 	}
 
 	return &types.CollectionDetailResp{
@@ -930,11 +1000,14 @@ func GetItemImage(ctx context.Context, svcCtx *svc.ServerCtx, chain string, coll
 	var imageUri string
 	// 检查查询到的图片信息中，是否已上传到OSS（对象存储服务）
 	if items[0].IsUploadedOss {
-		// 如果已上传到OSS，使用OSS的URI作为图片的URI
-		imageUri = items[0].OssUri // svcCtx.ImageMgr.GetSmallSizeImageUrl(items[0].OssUri)
+		// 如果已上传到OSS，使用OSS中缩略图的URI作为图片的URI
+		imageUri = items[0].OssUri
+		if svcCtx.ImageMgr != nil {
+			imageUri = svcCtx.ImageMgr.GetSmallSizeImageUrl(items[0].OssUri)
+		}
 	} else {
 		// 如果未上传到OSS，使用原始的图片URI
-		imageUri = items[0].ImageUri // svcCtx.ImageMgr.GetSmallSizeImageUrl(items[0].ImageUri)
+		imageUri = items[0].ImageUri
 	}
 
 	// 若查询成功，创建并返回包含集合地址、token ID和图片URI的响应结构体指针
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// ImportCollection 创建集合导入任务，由同步服务检测合约标准、导入全部 item 后开始同步该集合的订单。
+// 集合已经在导入或者已经导入完成时直接返回该任务；上次导入失败时重新加入队列，从失败的位置继续。
+func ImportCollection(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.CollectionImportReq) (*types.CollectionImportRecord, error) {
+	address := strings.ToLower(req.Address)
+
+	record, err := svcCtx.Dao.QueryCollectionImportRecord(ctx, chain, address)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on query collection import record", zap.Error(err), zap.String("collection_address", address))
+		return nil, errcode.ErrUnexpected
+	}
+
+	switch {
+	case record == nil:
+		record = &multi.CollectionImportRecord{
+			CollectionAddress: address,
+			FinishedStage:     multi.ImportStageQueued,
+			FromBlock:         req.FromBlock,
+		}
+		if err := svcCtx.Dao.CreateCollectionImportRecord(ctx, chain, record); err != nil {
+			xzap.WithContext(ctx).Error("failed on create collection import record", zap.Error(err), zap.String("collection_address", address))
+			return nil, errcode.ErrUnexpected
+		}
+	case record.FinishedStage == multi.ImportStageFailed:
+		// 已经导入过部分 item 时 ERC-1155 的持有数量是按区块区间累加的，
+		// 只有尚未导入任何 item 时才能调整起始区块，否则重放区间会变化导致数量重复累加
+		if record.ItemImported == 0 {
+			record.FromBlock = req.FromBlock
+		}
+		if err := svcCtx.Dao.RequeueCollectionImportRecord(ctx, chain, record); err != nil {
+			xzap.WithContext(ctx).Error("failed on requeue collection import record", zap.Error(err), zap.String("collection_address", address))
+			return nil, errcode.ErrUnexpected
+		}
+		record.FinishedStage = multi.ImportStageQueued
+		record.Msg = ""
+	}
+
+	return toCollectionImportRecord(req.ChainID, record), nil
+}
+
+// GetCollectionImport 获取集合最近一次导入任务的进度
+func GetCollectionImport(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chain string, collectionAddr string) (*types.CollectionImportRecord, error) {
+	record, err := svcCtx.Dao.QueryCollectionImportRecord(ctx, chain, strings.ToLower(collectionAddr))
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on query collection import record", zap.Error(err), zap.String("collection_address", collectionAddr))
+		return nil, errcode.ErrUnexpected
+	}
+	if record == nil {
+		return nil, errcode.NewCustomErr("collection import not found")
+	}
+
+	return toCollectionImportRecord(chainID, record), nil
+}
+
+func toCollectionImportRecord(chainID int, record *multi.CollectionImportRecord) *types.CollectionImportRecord {
+	return &types.CollectionImportRecord{
+		ChainID:       chainID,
+		Address:       record.CollectionAddress,
+		Stage:         record.FinishedStage,
+		Msg:           record.Msg,
+		TokenStandard: record.TokenStandard,
+		ItemTotal:     record.ItemTotal,
+		ItemImported:  record.ItemImported,
+		CreateTime:    record.CreateTime,
+		UpdateTime:    record.UpdateTime,
+	}
+}
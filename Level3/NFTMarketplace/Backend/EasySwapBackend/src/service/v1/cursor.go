@@ -0,0 +1,35 @@
+package service
+
+import (
+	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// decodePage 解析游标分页的读取位置，游标为空时从第一页开始。
+// scope 为查询条件的摘要（见 cursor.Scope），游标只能用于生成它的查询条件
+func decodePage(svcCtx *svc.ServerCtx, scope string, params types.CursorParams, pageSize int) (dao.KeysetPage, error) {
+	page := dao.KeysetPage{Limit: dao.NormalizeLimit(pageSize)}
+	if params.Cursor == "" {
+		return page, nil
+	}
+	cur, err := svcCtx.Cursor.Decode(params.Cursor, scope)
+	if err != nil {
+		return page, err
+	}
+	page.After, page.Backward = cur.Keys, cur.Backward
+	return page, nil
+}
+
+// encodePage 根据一页的第一行和最后一行生成前后翻页的游标
+func encodePage(svcCtx *svc.ServerCtx, scope string, edges dao.PageEdges) (types.CursorPage, error) {
+	var res types.CursorPage
+	var err error
+	if res.Next, err = svcCtx.Cursor.Encode(scope, edges.Next, false); err != nil {
+		return res, err
+	}
+	if res.Prev, err = svcCtx.Cursor.Encode(scope, edges.Prev, true); err != nil {
+		return res, err
+	}
+	return res, nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// GetCollectionDepth 获取集合的挂单和集合出价深度。
+// 深度由订单管理器随订单变化增量维护在缓存中，这里只按 bucket 合并价格区间并计算累计数量，
+// 同时返回地板价、最高集合出价和两者之间的价差。
+func GetCollectionDepth(ctx context.Context, svcCtx *svc.ServerCtx, chain, collectionAddr string, bucket decimal.Decimal, limit int) (*types.CollectionDepth, error) {
+	depth, err := ordermanager.LoadDepth(svcCtx.KvStore, chain, strings.ToLower(collectionAddr))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on load collection depth")
+	}
+
+	res := &types.CollectionDepth{
+		Asks: ordermanager.AggregateLevels(depth.Asks, bucket, true, limit),
+		Bids: ordermanager.AggregateLevels(depth.Bids, bucket, false, limit),
+	}
+	if len(depth.Asks) > 0 {
+		res.FloorPrice = depth.Asks[0].Price
+	}
+	if len(depth.Bids) > 0 {
+		res.TopBid = depth.Bids[0].Price
+	}
+	if len(depth.Asks) > 0 && len(depth.Bids) > 0 {
+		res.Spread = res.FloorPrice.Sub(res.TopBid)
+	}
+	return res, nil
+}
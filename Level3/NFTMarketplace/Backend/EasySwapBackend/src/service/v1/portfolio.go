@@ -12,6 +12,7 @@ import (
 	"github.com/shopspring/decimal"
 
 	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/cursor"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
 )
@@ -128,19 +129,29 @@ func GetMultiChainUserCollections(ctx context.Context, svcCtx *svc.ServerCtx, ch
 	}, nil
 }
 
-// GetMultiChainUserItems 查询用户拥有nft的Item基本信息，list信息和bid信息，从Item表和Activity表中查询
-func GetMultiChainUserItems(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chain []string, userAddrs []string, contractAddrs []string, page, pageSize int) (*types.UserItemsResp, error) {
+// GetMultiChainUserItems 查询用户拥有nft的Item基本信息，list信息和bid信息，从Item表和Activity表中查询。
+// page 为 0 或指定了游标时按游标分页
+func GetMultiChainUserItems(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chain []string, userAddrs []string, contractAddrs []string, page, pageSize int, cursorParams types.CursorParams) (*types.UserItemsResp, error) {
 	// 1.
-	items, count, err := svcCtx.Dao.QueryMultiChainUserItemInfos(ctx, chain, userAddrs, contractAddrs, page, pageSize)
+	var items []types.PortfolioItemInfo
+	var count int64
+	var pageRes types.CursorPage
+	var err error
+	if cursorParams.UseCursor(page) {
+		items, count, pageRes, err = getUserItemsByCursor(ctx, svcCtx, "user:items", chain, userAddrs, contractAddrs, pageSize, cursorParams)
+	} else {
+		items, count, err = svcCtx.Dao.QueryMultiChainUserItemInfos(ctx, chain, userAddrs, contractAddrs, page, pageSize)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get user items info")
 	}
 
 	// 如果没有Item,直接返回空结果
-	if count == 0 {
+	if len(items) == 0 {
 		return &types.UserItemsResp{
-			Result: items,
-			Count:  count,
+			Result:     items,
+			Count:      count,
+			CursorPage: pageRes,
 		}, nil
 	}
 
@@ -381,24 +392,61 @@ func GetMultiChainUserItems(ctx context.Context, svcCtx *svc.ServerCtx, chainID
 	}
 
 	return &types.UserItemsResp{
-		Result: items,
-		Count:  count,
+		Result:     items,
+		Count:      count,
+		CursorPage: pageRes,
 	}, nil
 }
 
-// GetMultiChainUserListings 获取用户在多条链上的挂单信息
-func GetMultiChainUserListings(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chain []string, userAddrs []string, contractAddrs []string, page, pageSize int) (*types.UserListingsResp, error) {
+// getUserItemsByCursor 按游标查询用户在多条链上持有的Item，name 区分持有和挂单两个接口的游标
+func getUserItemsByCursor(ctx context.Context, svcCtx *svc.ServerCtx, name string, chain []string, userAddrs []string,
+	contractAddrs []string, pageSize int, cursorParams types.CursorParams) ([]types.PortfolioItemInfo, int64, types.CursorPage, error) {
+	scope := cursor.Scope(name, []interface{}{chain, userAddrs, contractAddrs})
+	page, err := decodePage(svcCtx, scope, cursorParams, pageSize)
+	if err != nil {
+		return nil, 0, types.CursorPage{}, err
+	}
+
+	items, edges, err := svcCtx.Dao.QueryMultiChainUserItemInfosByCursor(ctx, chain, userAddrs, contractAddrs, page)
+	if err != nil {
+		return nil, 0, types.CursorPage{}, err
+	}
+	pageRes, err := encodePage(svcCtx, scope, edges)
+	if err != nil {
+		return nil, 0, types.CursorPage{}, errors.Wrap(err, "failed on encode user items cursor")
+	}
+
+	var count int64
+	if cursorParams.WithTotal {
+		if count, err = svcCtx.Dao.CountMultiChainUserItems(ctx, chain, userAddrs, contractAddrs); err != nil {
+			return nil, 0, types.CursorPage{}, err
+		}
+	}
+	return items, count, pageRes, nil
+}
+
+// GetMultiChainUserListings 获取用户在多条链上的挂单信息，page 为 0 或指定了游标时按游标分页
+func GetMultiChainUserListings(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chain []string, userAddrs []string, contractAddrs []string, page, pageSize int, cursorParams types.CursorParams) (*types.UserListingsResp, error) {
 	var result []types.Listing
 	// 1. 查询用户挂单Item基本信息
-	items, count, err := svcCtx.Dao.QueryMultiChainUserListingItemInfos(ctx, chain, userAddrs, contractAddrs, page, pageSize)
+	var items []types.PortfolioItemInfo
+	var count int64
+	var pageRes types.CursorPage
+	var err error
+	if cursorParams.UseCursor(page) {
+		items, count, pageRes, err = getUserItemsByCursor(ctx, svcCtx, "user:listings", chain, userAddrs, contractAddrs, pageSize, cursorParams)
+	} else {
+		items, count, err = svcCtx.Dao.QueryMultiChainUserListingItemInfos(ctx, chain, userAddrs, contractAddrs, page, pageSize)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get user items info")
 	}
 
 	// 如果没有挂单,直接返回空结果
-	if count == 0 {
+	if len(items) == 0 {
 		return &types.UserListingsResp{
-			Count: count,
+			Count:      count,
+			CursorPage: pageRes,
 		}, nil
 	}
 
@@ -656,8 +704,9 @@ func GetMultiChainUserListings(ctx context.Context, svcCtx *svc.ServerCtx, chain
 	}
 
 	return &types.UserListingsResp{
-		Count:  count,
-		Result: result,
+		Count:      count,
+		Result:     result,
+		CursorPage: pageRes,
 	}, nil
 }
 
@@ -680,7 +729,20 @@ type multiOrder struct {
 // 返回:
 // - *types.UserBidsResp: 用户出价信息响应
 // - error: 错误信息
-func GetMultiChainUserBids(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chainNames []string, userAddrs []string, contractAddrs []string, page, pageSize int) (*types.UserBidsResp, error) {
+// page 为 0 或指定了游标时按游标分页，否则返回全部出价
+func GetMultiChainUserBids(ctx context.Context, svcCtx *svc.ServerCtx, chainID []int, chainNames []string, userAddrs []string, contractAddrs []string, page, pageSize int, cursorParams types.CursorParams) (*types.UserBidsResp, error) {
+	// 游标分页时先解析游标，游标无效时不需要查询
+	var keysetPage dao.KeysetPage
+	var scope string
+	useCursor := cursorParams.UseCursor(page)
+	if useCursor {
+		var err error
+		scope = cursor.Scope("user:bids", []interface{}{chainNames, userAddrs, contractAddrs})
+		if keysetPage, err = decodePage(svcCtx, scope, cursorParams, pageSize); err != nil {
+			return nil, err
+		}
+	}
+
 	// 1. 遍历每条链,查询用户出价信息
 	var totalBids []multiOrder
 	for i, chain := range chainNames {
@@ -769,28 +831,120 @@ func GetMultiChainUserBids(ctx context.Context, svcCtx *svc.ServerCtx, chainID [
 	}
 
 	// 4. 组装最终结果
-	var results []types.UserBid
-	for _, userBid := range bidsMap {
+	var bids []keyedBid
+	for key, userBid := range bidsMap {
 		// 设置Collection名称和图片信息
 		if c, ok := collectionInfos[fmt.Sprintf("%d:%s", userBid.ChainID, strings.ToLower(userBid.CollectionAddress))]; ok {
 			userBid.CollectionName = c.Name
 			userBid.ImageURI = c.ImageUri
 		}
 
-		results = append(results, userBid)
+		bids = append(bids, keyedBid{key: key, bid: userBid})
 	}
 
-	// 5. 按过期时间降序排序
-	sort.SliceStable(results, func(i, j int) bool {
-		return results[i].ExpireTime > (results[j].ExpireTime)
+	// 5. 按过期时间降序排序，过期时间相同时按合并的key排序，保证翻页时顺序稳定
+	sort.Slice(bids, func(i, j int) bool {
+		if bids[i].bid.ExpireTime != bids[j].bid.ExpireTime {
+			return bids[i].bid.ExpireTime > bids[j].bid.ExpireTime
+		}
+		return bids[i].key > bids[j].key
 	})
 
+	count := len(bidsMap)
+	var pageRes types.CursorPage
+	if useCursor {
+		var edges dao.PageEdges
+		var err error
+		if bids, edges, err = pageUserBids(bids, keysetPage); err != nil {
+			return nil, err
+		}
+		if pageRes, err = encodePage(svcCtx, scope, edges); err != nil {
+			return nil, errors.Wrap(err, "failed on encode user bids cursor")
+		}
+		if !cursorParams.WithTotal {
+			count = 0
+		}
+	}
+
+	var results []types.UserBid
+	for _, b := range bids {
+		results = append(results, b.bid)
+	}
+
 	return &types.UserBidsResp{
-		Count:  len(bidsMap),
-		Result: results,
+		Count:      count,
+		Result:     results,
+		CursorPage: pageRes,
 	}, nil
 }
 
+// keyedBid 合并后的出价和合并使用的key，key 在用户的出价中唯一，作为游标的第二个排序键
+type keyedBid struct {
+	key string
+	bid types.UserBid
+}
+
+// pageUserBids 对已按 (过期时间, key) 降序排序的出价做游标分页。
+// 出价需要在内存中合并，无法在数据库中分页，游标保存边界出价的过期时间和key
+func pageUserBids(bids []keyedBid, page dao.KeysetPage) ([]keyedBid, dao.PageEdges, error) {
+	var edges dao.PageEdges
+	start, end := 0, len(bids)
+	if len(page.After) > 0 {
+		if len(page.After) != 2 {
+			return nil, edges, cursor.ErrInvalidCursor
+		}
+		expireTime, ok1 := page.After[0].(int64)
+		key, ok2 := page.After[1].(string)
+		if !ok1 || !ok2 {
+			return nil, edges, cursor.ErrInvalidCursor
+		}
+		// 第一个排在游标之后的出价
+		pos := sort.Search(len(bids), func(i int) bool {
+			b := bids[i]
+			return b.bid.ExpireTime < expireTime || (b.bid.ExpireTime == expireTime && b.key < key)
+		})
+		if page.Backward {
+			// 跳过游标本身
+			end = pos
+			if end > 0 && bids[end-1].bid.ExpireTime == expireTime && bids[end-1].key == key {
+				end--
+			}
+		} else {
+			start = pos
+		}
+	}
+
+	if page.Backward {
+		start = max(end-page.Limit, 0)
+	} else {
+		end = min(start+page.Limit, len(bids))
+	}
+	total := len(bids)
+	bids = bids[start:end]
+	if len(bids) == 0 {
+		return bids, edges, nil
+	}
+
+	// 与数据库游标分页相同：读取的位置来自相邻的一页，读取方向的反方向一定还有出价
+	keys := func(b keyedBid) []interface{} { return []interface{}{b.bid.ExpireTime, b.key} }
+	if page.Backward {
+		if start > 0 {
+			edges.Prev = keys(bids[0])
+		}
+		if len(page.After) > 0 {
+			edges.Next = keys(bids[len(bids)-1])
+		}
+	} else {
+		if end < total {
+			edges.Next = keys(bids[len(bids)-1])
+		}
+		if len(page.After) > 0 {
+			edges.Prev = keys(bids[0])
+		}
+	}
+	return bids, edges, nil
+}
+
 func removeRepeatedElement(arr []string) (newArr []string) {
 	newArr = make([]string, 0)
 	for i := 0; i < len(arr); i++ {
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// GetProtocolStates 获取指定链上订单簿合约的全局状态。
+// 合约处于暂停状态时，所有订单都无法成交，前端应据此提示用户。
+func GetProtocolStates(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chain string) ([]types.ProtocolState, error) {
+	states, err := svcCtx.Dao.QueryProtocolStates(ctx, chain)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query protocol states")
+	}
+
+	results := make([]types.ProtocolState, 0, len(states))
+	for _, state := range states {
+		results = append(results, types.ProtocolState{
+			ChainID:         chainID,
+			ContractAddress: state.ContractAddress,
+			ProtocolShare:   state.ProtocolShare,
+			Vault:           state.Vault,
+			Owner:           state.Owner,
+			Paused:          state.Paused,
+			BlockNumber:     state.BlockNumber,
+			UpdateTime:      state.UpdateTime,
+		})
+	}
+
+	return results, nil
+}
+
+// GetOrderFailures 获取订单在链上处理失败的记录，用于解释订单为什么没有成交
+func GetOrderFailures(ctx context.Context, svcCtx *svc.ServerCtx, chain string, orderIds []string) ([]types.OrderFailure, error) {
+	if len(orderIds) == 0 {
+		return []types.OrderFailure{}, nil
+	}
+
+	failures, err := svcCtx.Dao.QueryOrderFailures(ctx, chain, orderIds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query order failures")
+	}
+
+	results := make([]types.OrderFailure, 0, len(failures))
+	for _, failure := range failures {
+		results = append(results, types.OrderFailure{
+			OrderID:     failure.OrderID,
+			FailureType: failure.FailureType,
+			BatchOffset: failure.BatchOffset,
+			Reason:      failure.Reason,
+			TxHash:      failure.TxHash,
+			BlockNumber: failure.BlockNumber,
+			EventTime:   failure.EventTime,
+		})
+	}
+
+	return results, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,21 +18,17 @@ import (
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
 )
 
-const MinuteSeconds = 60
-const HourSeconds = 60 * 60
-const DaySeconds = 3600 * 24
-
 // GetTopRanking 获取指定链上的NFT集合排名信息
 // @param ctx context.Context 上下文
 // @param svcCtx *svc.ServerCtx 服务上下文
 // @param chain string 链名称
-// @param period string 时间范围(15m/1h/6h/1d/7d/30d)
+// @param period string 时间范围(15m/1h/6h/1d/7d/30d)，统计截止到当前时间所在的 5 分钟
 // @param limit int64 返回结果数量限制
 // @return []*types.CollectionRankingInfo 返回集合排名信息列表
 // @return error 错误信息
 func GetTopRanking(ctx context.Context, svcCtx *svc.ServerCtx, chain string, period string, limit int64) ([]*types.CollectionRankingInfo, error) {
-	// 获取集合交易信息
-	tradeInfos, err := svcCtx.Dao.GetCollectionRankingByActivity(chain, period)
+	// 从集合统计表获取时间段内的交易信息
+	tradeInfos, err := svcCtx.Dao.GetCollectionRankingByStats(ctx, chain, period)
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on get collection trade info", zap.Error(err))
 		//return nil, errcode.NewCustomErr("cache error")
@@ -43,21 +40,6 @@ func GetTopRanking(ctx context.Context, svcCtx *svc.ServerCtx, chain string, per
 		collectionTradeMap[strings.ToLower(tradeInfo.ContractAddress)] = *tradeInfo
 	}
 
-	// 时间范围映射表
-	periodTime := map[string]int64{
-		"15m": MinuteSeconds * 15,
-		"1h":  HourSeconds,
-		"6h":  HourSeconds * 6,
-		"1d":  DaySeconds,
-		"7d":  DaySeconds * 7,
-		"30d": DaySeconds * 30,
-	}
-	// 获取地板价变化信息
-	collectionFloorChange, err := svcCtx.Dao.QueryCollectionFloorChange(chain, periodTime[period])
-	if err != nil {
-		xzap.WithContext(ctx).Error("failed on get collection floor change", zap.Error(err))
-	}
-
 	var wg sync.WaitGroup
 	var queryErr error
 
@@ -101,14 +83,19 @@ func GetTopRanking(ctx context.Context, svcCtx *svc.ServerCtx, chain string, per
 	for _, collection := range allCollections {
 		var priceChange float64
 		var volume decimal.Decimal
+		var volumeChange int
 		var sellPrice decimal.Decimal
 		var sales int64
 
 		// 获取交易相关信息
 		tradeInfo, ok := collectionTradeMap[strings.ToLower(collection.Address)] // 统一小写
 		if ok {
-			priceChange = collectionFloorChange[strings.ToLower(collection.Address)]
+			// 地板价变化率为当前地板价相对时间段开始时地板价快照的变化
+			if tradeInfo.PreFloorPrice.GreaterThan(decimal.Zero) {
+				priceChange = collection.FloorPrice.Sub(tradeInfo.PreFloorPrice).Div(tradeInfo.PreFloorPrice).InexactFloat64()
+			}
 			volume = tradeInfo.Volume
+			volumeChange = tradeInfo.VolumeChange
 			sales = tradeInfo.ItemCount
 		}
 		// 获取销售价格信息
@@ -128,22 +115,26 @@ func GetTopRanking(ctx context.Context, svcCtx *svc.ServerCtx, chain string, per
 
 		// 构建单个集合的排名信息
 		respInfos = append(respInfos, &types.CollectionRankingInfo{
-			Name:        collection.Name,
-			Address:     collection.Address,
-			ImageUri:    collection.ImageUri,
-			FloorPrice:  collection.FloorPrice.String(),
-			FloorChange: strconv.FormatFloat(priceChange, 'f', 4, 32),
-			SellPrice:   sellPrice.String(),
-			Volume:      volume,
-			ItemSold:    sales,
-			ItemNum:     collection.ItemAmount,
-			ItemOwner:   collection.OwnerAmount,
-			ListAmount:  listAmount,
-			ChainID:     collection.ChainId,
+			Name:         collection.Name,
+			Address:      collection.Address,
+			ImageUri:     collection.ImageUri,
+			FloorPrice:   collection.FloorPrice.String(),
+			FloorChange:  strconv.FormatFloat(priceChange, 'f', 4, 32),
+			SellPrice:    sellPrice.String(),
+			Volume:       volume,
+			VolumeChange: volumeChange,
+			ItemSold:     sales,
+			ItemNum:      collection.ItemAmount,
+			ItemOwner:    collection.OwnerAmount,
+			ListAmount:   listAmount,
+			ChainID:      collection.ChainId,
 		})
 	}
 
-	// 限制返回数量
+	// 按交易量降序排列后再限制返回数量
+	sort.SliceStable(respInfos, func(i, j int) bool {
+		return respInfos[i].Volume.GreaterThan(respInfos[j].Volume)
+	})
 	if limit < int64(len(respInfos)) {
 		respInfos = respInfos[:limit]
 	}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/common/utils"
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+const (
+	defaultSiweDomain     = "localhost"
+	defaultSiweURI        = "http://localhost"
+	defaultSiweStatement  = "Welcome to EasySwap!"
+	defaultSiweExpiration = 600
+
+	// eip1271Abi 合约钱包验证签名的接口 isValidSignature(bytes32,bytes)
+	eip1271Abi = `[{"inputs":[{"name":"hash","type":"bytes32"},{"name":"signature","type":"bytes"}],"name":"isValidSignature","outputs":[{"name":"","type":"bytes4"}],"stateMutability":"view","type":"function"}]`
+
+	// consumeLoginNonceScript nonce 与缓存一致时删除并返回 1，保证一个 nonce 只能登录一次
+	consumeLoginNonceScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0`
+)
+
+// eip1271MagicValue isValidSignature 验证通过时返回的值
+var eip1271MagicValue = []byte{0x16, 0x26, 0xba, 0x7e}
+
+var eip1271Contract, _ = abi.JSON(strings.NewReader(eip1271Abi))
+
+// siweCfg 返回登录消息配置，未配置的字段使用默认值
+func siweCfg(c *config.Config) config.SiweCfg {
+	cfg := config.SiweCfg{}
+	if c != nil && c.Siwe != nil {
+		cfg = *c.Siwe
+	}
+	if cfg.Domain == "" {
+		cfg.Domain = defaultSiweDomain
+	}
+	if cfg.URI == "" {
+		cfg.URI = defaultSiweURI
+	}
+	if cfg.Statement == "" {
+		cfg.Statement = defaultSiweStatement
+	}
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = defaultSiweExpiration
+	}
+	return cfg
+}
+
+// verifyLoginMessage 校验登录消息的域名、资源地址、地址、链和有效期
+func verifyLoginMessage(svcCtx *svc.ServerCtx, msg *utils.SiweMessage, address string, chainID int, now time.Time) error {
+	cfg := siweCfg(svcCtx.C)
+	if msg.Domain != cfg.Domain {
+		return errors.New("siwe message domain mismatch")
+	}
+	if msg.URI != cfg.URI {
+		return errors.New("siwe message uri mismatch")
+	}
+	if !strings.EqualFold(msg.Address, address) {
+		return errors.New("siwe message address mismatch")
+	}
+	if chainID != 0 && msg.ChainID != chainID {
+		return errors.New("siwe message chain id mismatch")
+	}
+	if _, ok := svcCtx.NodeSrvs[int64(msg.ChainID)]; !ok {
+		return errors.New("unsupported chain")
+	}
+	return msg.Validate(now)
+}
+
+// verifyLoginSignature 验证登录消息的签名。
+// 先按 EOA 通过 ecrecover 验证，失败时按合约钱包调用 EIP-1271 isValidSignature 验证。
+func verifyLoginSignature(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, address, message, signature string) (bool, error) {
+	digest := utils.SiweHash(message)
+	if utils.VerifySig(address, signature, digest) {
+		return true, nil
+	}
+
+	nodeSrv, ok := svcCtx.NodeSrvs[int64(chainID)]
+	if !ok {
+		return false, errors.New("unsupported chain")
+	}
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return false, nil
+	}
+	var hash [32]byte
+	copy(hash[:], digest)
+	data, err := eip1271Contract.Pack("isValidSignature", hash, sig)
+	if err != nil {
+		return false, errors.Wrap(err, "failed on pack isValidSignature")
+	}
+
+	wallet := common.HexToAddress(address)
+	out, err := nodeSrv.NodeClient.CallContract(ctx, ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		// EOA 或未实现 EIP-1271 的合约调用失败，视为签名无效
+		return false, nil
+	}
+	return len(out) >= 4 && bytes.Equal(out[:4], eip1271MagicValue), nil
+}
+
+// consumeLoginNonce 校验并删除地址对应的登录 nonce，同一个 nonce 只有一次登录能成功
+func consumeLoginNonce(svcCtx *svc.ServerCtx, address, nonce string) (bool, error) {
+	result, err := svcCtx.KvStore.Eval(consumeLoginNonceScript, getUserLoginMsgCacheKey(address), nonce)
+	if err != nil {
+		return false, errors.Wrap(err, "failed on consume login nonce")
+	}
+	consumed, _ := result.(int64)
+	return consumed == 1, nil
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/common/utils"
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+const testChainID = 11155111
+
+// fakeWalletClient 模拟部署了 EIP-1271 合约钱包的节点，合约钱包用 owner 的签名验证
+type fakeWalletClient struct {
+	chainclient.ChainClient
+	owner common.Address
+	err   error
+	calls int
+}
+
+func (c *fakeWalletClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	args, err := eip1271Contract.Methods["isValidSignature"].Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	hash := args[0].([32]byte)
+	sig := args[1].([]byte)
+	result := make([]byte, 32)
+	if utils.VerifySig(c.owner.Hex(), hexutil.Encode(sig), hash[:]) {
+		copy(result, eip1271MagicValue)
+	}
+	return result, nil
+}
+
+func newTestSiweCtx(client chainclient.ChainClient) *svc.ServerCtx {
+	return &svc.ServerCtx{
+		C:        &config.Config{Siwe: &config.SiweCfg{Domain: "easyswap.io", URI: "https://easyswap.io"}},
+		NodeSrvs: map[int64]*nftchainservice.Service{testChainID: {NodeClient: client}},
+	}
+}
+
+func newTestKvStore(t *testing.T) (*xkv.Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return xkv.NewStore(cache.CacheConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}}), mr
+}
+
+// signLoginMessages 为同一个私钥生成 v 分别为 0 和 1 的登录消息签名
+func signLoginMessages(t *testing.T, key *ecdsa.PrivateKey) map[byte][2]string {
+	signed := make(map[byte][2]string)
+	for i := 0; len(signed) < 2; i++ {
+		message := fmt.Sprintf("easyswap.io wants you to sign in with your Ethereum account:\n%s\n\nNonce: %d",
+			crypto.PubkeyToAddress(key.PublicKey).Hex(), i)
+		sig, err := crypto.Sign(utils.SiweHash(message), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := signed[sig[64]]; !ok {
+			signed[sig[64]] = [2]string{message, hexutil.Encode(sig)}
+		}
+	}
+	return signed
+}
+
+// withV 把签名的 v 改为 recid + offset
+func withV(signature string, offset byte) string {
+	sig := hexutil.MustDecode(signature)
+	sig[64] += offset
+	return hexutil.Encode(sig)
+}
+
+func TestVerifyLoginSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	wallet := common.HexToAddress("0x00000000000000000000000000000000000c0de1")
+	other, _ := crypto.GenerateKey()
+	signed := signLoginMessages(t, key)
+
+	tests := []struct {
+		name      string
+		address   common.Address
+		recid     byte
+		offset    byte
+		owner     common.Address
+		callErr   error
+		want      bool
+		wantCalls int
+	}{
+		{name: "eoa v=0", address: signer, recid: 0, want: true},
+		{name: "eoa v=1", address: signer, recid: 1, want: true},
+		{name: "eoa v=27", address: signer, recid: 0, offset: 27, want: true},
+		{name: "eoa v=28", address: signer, recid: 1, offset: 27, want: true},
+		{name: "eoa invalid v", address: signer, recid: 0, offset: 2, want: false, wantCalls: 1},
+		{name: "eip1271 v=0", address: wallet, recid: 0, owner: signer, want: true, wantCalls: 1},
+		{name: "eip1271 v=1", address: wallet, recid: 1, owner: signer, want: true, wantCalls: 1},
+		{name: "eip1271 v=27", address: wallet, recid: 0, offset: 27, owner: signer, want: true, wantCalls: 1},
+		{name: "eip1271 v=28", address: wallet, recid: 1, offset: 27, owner: signer, want: true, wantCalls: 1},
+		{name: "eip1271 other owner", address: wallet, recid: 0, owner: crypto.PubkeyToAddress(other.PublicKey), want: false, wantCalls: 1},
+		{name: "eip1271 call reverted", address: wallet, recid: 0, owner: signer, callErr: errors.New("execution reverted"), want: false, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeWalletClient{owner: tt.owner, err: tt.callErr}
+			message, signature := signed[tt.recid][0], withV(signed[tt.recid][1], tt.offset)
+			ok, err := verifyLoginSignature(context.Background(), newTestSiweCtx(client), testChainID,
+				strings.ToLower(tt.address.Hex()), message, signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want || client.calls != tt.wantCalls {
+				t.Fatalf("verify = %v with %d calls, want %v with %d calls", ok, client.calls, tt.want, tt.wantCalls)
+			}
+		})
+	}
+
+	// 不支持的链上的合约钱包无法验证
+	if _, err := verifyLoginSignature(context.Background(), newTestSiweCtx(&fakeWalletClient{}), 1,
+		wallet.Hex(), signed[0][0], signed[0][1]); err == nil {
+		t.Fatal("expected unsupported chain error")
+	}
+}
+
+func TestVerifyLoginMessage(t *testing.T) {
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	newMessage := func() *utils.SiweMessage {
+		return &utils.SiweMessage{
+			Domain:         "easyswap.io",
+			Address:        address,
+			URI:            "https://easyswap.io",
+			Version:        "1",
+			ChainID:        testChainID,
+			Nonce:          "abc123",
+			IssuedAt:       issuedAt,
+			ExpirationTime: issuedAt.Add(10 * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(m *utils.SiweMessage)
+		address string
+		chainID int
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", address: strings.ToLower(address), chainID: testChainID, now: issuedAt.Add(time.Minute)},
+		{name: "any chain", address: address, now: issuedAt.Add(time.Minute)},
+		{name: "wrong domain", modify: func(m *utils.SiweMessage) { m.Domain = "evil.io" }, address: address, now: issuedAt, wantErr: "domain mismatch"},
+		{name: "wrong uri", modify: func(m *utils.SiweMessage) { m.URI = "https://evil.io" }, address: address, now: issuedAt, wantErr: "uri mismatch"},
+		{name: "wrong address", address: "0x0000000000000000000000000000000000000001", now: issuedAt, wantErr: "address mismatch"},
+		{name: "wrong chain id", address: address, chainID: 1, now: issuedAt, wantErr: "chain id mismatch"},
+		{name: "unsupported chain", modify: func(m *utils.SiweMessage) { m.ChainID = 1 }, address: address, now: issuedAt, wantErr: "unsupported chain"},
+		{name: "expired", address: address, now: issuedAt.Add(time.Hour), wantErr: "expired"},
+		{
+			name:    "not yet valid",
+			modify:  func(m *utils.SiweMessage) { m.NotBefore = issuedAt.Add(time.Hour) },
+			address: address,
+			now:     issuedAt,
+			wantErr: "not yet valid",
+		},
+	}
+	svcCtx := newTestSiweCtx(&fakeWalletClient{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newMessage()
+			if tt.modify != nil {
+				tt.modify(msg)
+			}
+			err := verifyLoginMessage(svcCtx, msg, tt.address, tt.chainID, tt.now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConsumeLoginNonce(t *testing.T) {
+	kvStore, mr := newTestKvStore(t)
+	svcCtx := &svc.ServerCtx{KvStore: kvStore}
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	if err := mr.Set(getUserLoginMsgCacheKey(address), "abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		nonce   string
+		want    bool
+	}{
+		{name: "wrong nonce", address: address, nonce: "other", want: false},
+		{name: "first login", address: strings.ToLower(address), nonce: "abc123", want: true},
+		{name: "replayed nonce", address: address, nonce: "abc123", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := consumeLoginNonce(svcCtx, tt.address, tt.nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Fatalf("consume = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+	if mr.Exists(getUserLoginMsgCacheKey(address)) {
+		t.Fatal("nonce should be deleted after login")
+	}
+}
@@ -1,23 +1,19 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/hex"
-	"fmt"
-	"io"
 	"strings"
 	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
 	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
+	"github.com/ProjectsTask/EasySwapBackend/src/common/utils"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/auth"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
 )
@@ -26,35 +22,38 @@ func getUserLoginMsgCacheKey(address string) string {
 	return middleware.CR_LOGIN_MSG_KEY + ":" + strings.ToLower(address)
 }
 
-func getUserLoginTokenCacheKey(address string) string {
-	return middleware.CR_LOGIN_KEY + ":" + strings.ToLower(address)
-}
-
+// UserLogin 用户登录:
+// 1. 解析 SIWE 登录消息，校验域名、地址、链和有效期
+// 2. 验证签名，EOA 使用 ecrecover，合约钱包使用 EIP-1271
+// 3. 消费登录 nonce，之后生成并缓存用户 token
 func UserLogin(ctx context.Context, svcCtx *svc.ServerCtx, req types.LoginReq) (*types.UserLoginInfo, error) {
 	// 返回结果
 	res := types.UserLoginInfo{}
 
-	//todo: add verify signature
-	//ok := verifySignature(req.Message, req.Signature, req.PublicKey)
-	//if !ok {
-	//	return nil, errors.New("invalid signature")
-	//}
-
-	// 从缓存中获取登录消息UUID
-	cachedUUID, err := svcCtx.KvStore.Get(getUserLoginMsgCacheKey(req.Address))
-	if cachedUUID == "" || err != nil {
+	// 解析并校验 SIWE 登录消息
+	msg, err := utils.ParseSiweMessage(req.Message)
+	if err != nil {
+		return nil, errcode.ErrTokenVerify
+	}
+	if err := verifyLoginMessage(svcCtx, msg, req.Address, req.ChainID, time.Now()); err != nil {
 		return nil, errcode.ErrTokenExpire
 	}
 
-	// 分割消息获取UUID
-	splits := strings.Split(req.Message, "Nonce:")
-	if len(splits) != 2 {
-		return nil, errcode.ErrTokenExpire
+	// 验证签名，支持 EOA 和 EIP-1271 合约钱包
+	ok, err := verifyLoginSignature(ctx, svcCtx, msg.ChainID, req.Address, req.Message, req.Signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on verify login signature")
+	}
+	if !ok {
+		return nil, errcode.ErrTokenVerify
 	}
 
-	// 获取登录UUID并验证
-	loginUUID := strings.Trim(splits[1], "\n")
-	if loginUUID != cachedUUID {
+	// 签名验证通过后消费 nonce，同一条登录消息只能使用一次
+	consumed, err := consumeLoginNonce(svcCtx, req.Address, msg.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
 		return nil, errcode.ErrTokenExpire
 	}
 
@@ -84,68 +83,104 @@ func UserLogin(ctx context.Context, svcCtx *svc.ServerCtx, req types.LoginReq) (
 		}
 	}
 
-	// 生成用户token
-	tokenKey := getUserLoginTokenCacheKey(req.Address)
-	userToken, err := AesEncryptOFB([]byte(tokenKey), []byte(middleware.CR_LOGIN_SALT))
+	// 为当前设备创建会话并签发令牌
+	tokens, err := svcCtx.Auth.Login(req.Address, req.Device)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed on get user token")
-	}
-
-	// 缓存用户token
-	if err := CacheUserToken(svcCtx, tokenKey, uuid.NewString()); err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed on create user session")
 	}
 
 	// 设置返回结果
-	res.Token = hex.EncodeToString(userToken)
+	res.Token = tokens.AccessToken
+	res.RefreshToken = tokens.RefreshToken
+	res.ExpiresIn = tokens.ExpiresIn
 	res.IsAllowed = user.IsAllowed
 
-	return &res, err
+	return &res, nil
 }
 
-// 把token写入redis
-func CacheUserToken(svcCtx *svc.ServerCtx, tokenKey, token string) error {
-	if err := svcCtx.KvStore.Setex(tokenKey, token, 30*24*60*60); err != nil {
-		return err
+// RefreshUserToken 使用刷新令牌换取新的令牌，旧的刷新令牌失效；
+// 已轮换的刷新令牌被再次使用时会话被注销，需要重新登录
+func RefreshUserToken(ctx context.Context, svcCtx *svc.ServerCtx, refreshToken string) (*types.UserTokenResp, error) {
+	tokens, err := svcCtx.Auth.Refresh(refreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, errcode.ErrTokenVerify
+		}
+		if errors.Is(err, auth.ErrSessionRevoked) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return nil, errcode.ErrTokenExpire
+		}
+		return nil, errors.Wrap(err, "failed on refresh user token")
 	}
 
-	return nil
+	return &types.UserTokenResp{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	}, nil
 }
 
-func AesEncryptOFB(data []byte, key []byte) ([]byte, error) {
-	data = PKCS7Padding(data, aes.BlockSize)
-	block, _ := aes.NewCipher([]byte(key))
-	out := make([]byte, aes.BlockSize+len(data))
-	iv := out[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, err
+// UserLogout 注销当前会话，all 为 true 时注销地址的所有会话
+func UserLogout(ctx context.Context, svcCtx *svc.ServerCtx, address, sessionID string, all bool) error {
+	if all {
+		if err := svcCtx.Auth.RevokeAll(address); err != nil {
+			return errors.Wrap(err, "failed on revoke user sessions")
+		}
+		return nil
 	}
-
-	stream := cipher.NewOFB(block, iv)
-	stream.XORKeyStream(out[aes.BlockSize:], data)
-	return out, nil
+	if err := svcCtx.Auth.Revoke(address, sessionID); err != nil {
+		return errors.Wrap(err, "failed on revoke user session")
+	}
+	return nil
 }
 
-// 补码
-// AES加密数据块分组长度必须为128bit(byte[16])，密钥长度可以是128bit(byte[16])、192bit(byte[24])、256bit(byte[32])中的任意一个。
-func PKCS7Padding(ciphertext []byte, blocksize int) []byte {
-	padding := blocksize - len(ciphertext)%blocksize
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(ciphertext, padtext...)
-}
+// GetUserSessions 列出地址当前有效的会话，current 为发起请求的会话
+func GetUserSessions(ctx context.Context, svcCtx *svc.ServerCtx, address, current string) (*types.UserSessionsResp, error) {
+	sessions, err := svcCtx.Auth.Sessions(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get user sessions")
+	}
 
-func genLoginTemplate(nonce string) string {
-	return fmt.Sprintf("Welcome to EasySwap!\nNonce:%s", nonce)
+	res := &types.UserSessionsResp{Result: make([]types.UserSession, 0, len(sessions))}
+	for _, session := range sessions {
+		res.Result = append(res.Result, types.UserSession{
+			Address:    session.Address,
+			SessionID:  session.ID,
+			Device:     session.Device,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID == current,
+		})
+	}
+	return res, nil
 }
 
-func GetUserLoginMsg(ctx context.Context, svcCtx *svc.ServerCtx, address string) (*types.UserLoginMsgResp, error) {
-	uuid := uuid.NewString()
-	loginMsg := genLoginTemplate(uuid)
-	if err := svcCtx.KvStore.Setex(getUserLoginMsgCacheKey(address), uuid, 72*60*60); err != nil {
+// GetUserLoginMsg 生成 EIP-4361 (Sign-In with Ethereum) 格式的登录消息，
+// nonce 缓存到消息过期，登录成功后删除
+func GetUserLoginMsg(ctx context.Context, svcCtx *svc.ServerCtx, address string, chainID int) (*types.UserLoginMsgResp, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errcode.ErrInvalidParams
+	}
+	if _, ok := svcCtx.NodeSrvs[int64(chainID)]; !ok {
+		return nil, errors.New("unsupported chain")
+	}
+
+	cfg := siweCfg(svcCtx.C)
+	now := time.Now().UTC().Truncate(time.Second)
+	msg := utils.SiweMessage{
+		Domain:         cfg.Domain,
+		Address:        address,
+		Statement:      cfg.Statement,
+		URI:            cfg.URI,
+		ChainID:        chainID,
+		Nonce:          strings.ReplaceAll(uuid.NewString(), "-", ""),
+		IssuedAt:       now,
+		ExpirationTime: now.Add(time.Duration(cfg.Expiration) * time.Second),
+	}
+	if err := svcCtx.KvStore.Setex(getUserLoginMsgCacheKey(address), msg.Nonce, int(cfg.Expiration)); err != nil {
 		return nil, errors.Wrap(err, "failed on generate login msg")
 	}
 
-	return &types.UserLoginMsgResp{Address: address, Message: loginMsg}, nil
+	return &types.UserLoginMsgResp{Address: address, Message: msg.String()}, nil
 }
 
 // GetSigStatusMsg 用于获取用户的签名状态信息。
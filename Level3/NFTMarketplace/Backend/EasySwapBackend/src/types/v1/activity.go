@@ -10,9 +10,13 @@ type ActivityMultiChainFilterParams struct {
 	TokenID             string   `json:"token_id"`
 	UserAddresses       []string `json:"user_addresses"`
 	EventTypes          []string `json:"event_types"`
+	// StartTime、EndTime 活动时间范围（秒），为 0 表示不限制
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	CursorParams
 }
 
 type ActivityInfo struct {
@@ -35,5 +39,7 @@ type ActivityInfo struct {
 
 type ActivityResp struct {
 	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	// Count 总数，游标分页时只在请求 with_total 时返回
+	Count int64 `json:"count"`
+	CursorPage
 }
@@ -1,18 +1,30 @@
 package types
 
 import (
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/shopspring/decimal"
 )
 
 type CollectionItemFilterParams struct {
-	Sort        int    `json:"sort"`    //1- listing_price  2-listing_time 3-sale_price
-	Status      []int  `json:"status"`  // 1 buy now  2 has offer  3 全选
-	Markets     []int  `json:"markets"` // 0:ns 1:os 2:looksrare 3:x2y2
-	TokenID     string `json:"token_id"`
-	UserAddress string `json:"user_address"`
-	ChainID     int    `json:"chain_id"`
-	Page        int    `json:"page"`
-	PageSize    int    `json:"page_size"`
+	Sort        int           `json:"sort"`    //1- listing_price  2-listing_time 3-sale_price 5-最稀有优先 6-最常见优先
+	Status      []int         `json:"status"`  // 1 buy now  2 has offer  3 全选
+	Markets     []int         `json:"markets"` // 0:ns 1:os 2:looksrare 3:x2y2
+	TokenID     string        `json:"token_id"`
+	UserAddress string        `json:"user_address"`
+	Traits      []TraitFilter `json:"traits"`     // 属性筛选，不同属性之间为且，同一属性的多个取值之间为或
+	RarityMin   int64         `json:"rarity_min"` // 稀有度排名下限，0 表示不限制
+	RarityMax   int64         `json:"rarity_max"` // 稀有度排名上限，0 表示不限制
+	ChainID     int           `json:"chain_id"`
+	Page        int           `json:"page"`
+	PageSize    int           `json:"page_size"`
+	CursorParams
+}
+
+// TraitFilter 一个属性的筛选条件，item 的该属性取值在 Values 中即满足
+type TraitFilter struct {
+	Trait  string   `json:"trait"`
+	Values []string `json:"values"`
 }
 
 type CollectionBidFilterParams struct {
@@ -33,6 +45,25 @@ type CollectionBidsResp struct {
 	Count  int64       `json:"count"`
 }
 
+// CollectionDepth 集合的挂单和集合出价深度，Asks 按价格升序，Bids 按价格降序
+type CollectionDepth struct {
+	Asks       []ordermanager.DepthLevel `json:"asks"`
+	Bids       []ordermanager.DepthLevel `json:"bids"`
+	FloorPrice decimal.Decimal           `json:"floor_price"` // 最低挂单价格
+	TopBid     decimal.Decimal           `json:"top_bid"`     // 最高集合出价
+	Spread     decimal.Decimal           `json:"spread"`      // 地板价与最高集合出价之差，任意一侧为空时为 0
+}
+
+// CollectionCandles 集合的成交价 K 线和地板价序列，两者的周期一一对应。
+// 周期数超过单页上限时 NextFrom 为下一页的 from，否则为 0
+type CollectionCandles struct {
+	Interval string                       `json:"interval"`
+	TimeZone string                       `json:"time_zone"`
+	Candles  []collectionstats.Candle     `json:"candles"`
+	Floors   []collectionstats.FloorPoint `json:"floors"`
+	NextFrom int64                        `json:"next_from"`
+}
+
 type HistorySalesPriceInfo struct {
 	Price     decimal.Decimal `json:"price"`
 	TokenID   string          `json:"token_id"`
@@ -46,7 +77,9 @@ type TopTraitFilterParams struct {
 
 type NFTListingInfoResp struct {
 	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	// Count 总数，游标分页时只在请求 with_total 时返回
+	Count int64 `json:"count"`
+	CursorPage
 }
 
 type NFTListingInfo struct {
@@ -78,6 +111,9 @@ type NFTListingInfo struct {
 
 	MarketID int `json:"market_id"`
 
+	RarityScore float64 `json:"rarity_score"`
+	RarityRank  int64   `json:"rarity_rank"`
+
 	LastSellPrice    decimal.Decimal `json:"last_sell_price"`
 	OwnerOwnedAmount int64           `json:"owner_owned_amount"`
 }
@@ -88,18 +124,19 @@ type ItemTrait struct {
 }
 
 type CollectionRankingInfo struct {
-	ImageUri    string          `json:"image_uri"`
-	Name        string          `json:"name"`
-	Address     string          `json:"address"`
-	FloorPrice  string          `json:"floor_price"`
-	FloorChange string          `json:"floor_price_change"`
-	SellPrice   string          `json:"sell_price"`
-	Volume      decimal.Decimal `json:"volume"`
-	ItemNum     int64           `json:"item_num"`
-	ItemOwner   int64           `json:"item_owner"`
-	ItemSold    int64           `json:"item_sold"`
-	ListAmount  int             `json:"list_amount"`
-	ChainID     int             `json:"chain_id"`
+	ImageUri     string          `json:"image_uri"`
+	Name         string          `json:"name"`
+	Address      string          `json:"address"`
+	FloorPrice   string          `json:"floor_price"`
+	FloorChange  string          `json:"floor_price_change"`
+	SellPrice    string          `json:"sell_price"`
+	Volume       decimal.Decimal `json:"volume"`
+	VolumeChange int             `json:"volume_change"` // 交易量相对上一个等长时间段的变化百分比
+	ItemNum      int64           `json:"item_num"`
+	ItemOwner    int64           `json:"item_owner"`
+	ItemSold     int64           `json:"item_sold"`
+	ListAmount   int             `json:"list_amount"`
+	ChainID      int             `json:"chain_id"`
 }
 
 type CollectionRankingResp struct {
@@ -107,19 +144,24 @@ type CollectionRankingResp struct {
 }
 
 type CollectionDetail struct {
-	ImageUri       string          `json:"image_uri"`
-	Name           string          `json:"name"`
-	Address        string          `json:"address"`
-	ChainId        int             `json:"chain_id"`
-	FloorPrice     decimal.Decimal `json:"floor_price"`
-	SellPrice      string          `json:"sell_price"`
-	VolumeTotal    decimal.Decimal `json:"volume_total"`
-	Volume24h      decimal.Decimal `json:"volume_24h"`
-	Sold24h        int64           `json:"sold_24h"`
-	ListAmount     int64           `json:"list_amount"`
-	TotalSupply    int64           `json:"total_supply"`
-	OwnerAmount    int64           `json:"owner_amount"`
-	RoyaltyFeeRate string          `json:"royalty_fee_rate"`
+	ImageUri        string          `json:"image_uri"`
+	Name            string          `json:"name"`
+	Address         string          `json:"address"`
+	ChainId         int             `json:"chain_id"`
+	FloorPrice      decimal.Decimal `json:"floor_price"`
+	SellPrice       string          `json:"sell_price"`
+	VolumeTotal     decimal.Decimal `json:"volume_total"`
+	Volume24h       decimal.Decimal `json:"volume_24h"`
+	Sold24h         int64           `json:"sold_24h"`
+	VolumeChange24h int             `json:"volume_change_24h"` // 24 小时交易量相对前 24 小时的变化百分比
+	FloorChange24h  int             `json:"floor_change_24h"`  // 地板价相对 24 小时前的变化百分比
+	MinPrice24h     decimal.Decimal `json:"min_price_24h"`
+	AvgPrice24h     decimal.Decimal `json:"avg_price_24h"`
+	MaxPrice24h     decimal.Decimal `json:"max_price_24h"`
+	ListAmount      int64           `json:"list_amount"`
+	TotalSupply     int64           `json:"total_supply"`
+	OwnerAmount     int64           `json:"owner_amount"`
+	RoyaltyFeeRate  string          `json:"royalty_fee_rate"`
 }
 
 type CollectionDetailResp struct {
@@ -134,9 +176,31 @@ type RefreshItem struct {
 	ChainID        int64  `json:"chain_id"`
 	CollectionAddr string `json:"collection_addr"`
 	TokenID        string `json:"token_id"`
+	// Attempts 已经失败的次数，重试时使用
+	Attempts int `json:"attempts,omitempty"`
 }
 
 type CollectionListed struct {
 	CollectionAddr string `json:"collection_address"`
 	Count          int    `json:"count"`
 }
+
+// CollectionImportReq 导入集合请求，合约没有实现 ERC721Enumerable 时从 from_block 开始查找 mint 事件
+type CollectionImportReq struct {
+	ChainID   int    `json:"chain_id"`
+	Address   string `json:"address"`
+	FromBlock int64  `json:"from_block"`
+}
+
+// CollectionImportRecord 集合导入任务的进度
+type CollectionImportRecord struct {
+	ChainID       int    `json:"chain_id"`
+	Address       string `json:"address"`
+	Stage         int32  `json:"stage"` // 0:等待导入 1:导入collection完成 2:全部完成 3:导入失败
+	Msg           string `json:"msg"`
+	TokenStandard int64  `json:"token_standard"`
+	ItemTotal     int64  `json:"item_total"`
+	ItemImported  int64  `json:"item_imported"`
+	CreateTime    int64  `json:"create_time"`
+	UpdateTime    int64  `json:"update_time"`
+}
@@ -0,0 +1,20 @@
+package types
+
+// CursorParams 游标分页参数。page 大于 0 时仍按页码分页，否则按游标分页，
+// 每页数量为 page_size，Cursor 为上一次响应中的 next 或 prev，为空时从第一页开始
+type CursorParams struct {
+	Cursor string `json:"cursor"`
+	// WithTotal 游标分页时是否返回总数，总数会缓存一段时间，是近似值
+	WithTotal bool `json:"with_total"`
+}
+
+// UseCursor 是否按游标分页
+func (p CursorParams) UseCursor(page int) bool {
+	return page <= 0 || p.Cursor != ""
+}
+
+// CursorPage 游标分页响应中的翻页游标，为空表示该方向没有更多数据
+type CursorPage struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
@@ -0,0 +1,20 @@
+package types
+
+// 实时推送连接中客户端发送的操作
+const (
+	FeedOpSubscribe   = "subscribe"
+	FeedOpUnsubscribe = "unsubscribe"
+	FeedOpAuth        = "auth"
+	FeedOpPing        = "ping"
+)
+
+// FeedRequest 实时推送连接中客户端发送的消息
+type FeedRequest struct {
+	Op string `json:"op"`
+	// Topics 订阅或取消订阅的主题，例如 collection:<address>:activity、user:<address>:orders
+	Topics []string `json:"topics"`
+	// LastID 断线前最后收到的事件 ID，订阅时补发之后的事件
+	LastID string `json:"last_id"`
+	// Token 访问令牌，登录后才能订阅自己地址的用户主题
+	Token string `json:"token"`
+}
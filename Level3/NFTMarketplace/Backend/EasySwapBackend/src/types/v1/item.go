@@ -21,6 +21,24 @@ type ItemOwner struct {
 	Owner             string `json:"owner"`
 }
 
+// ItemHolderFilterParams 查询 ERC-1155 token 持有人的分页参数
+type ItemHolderFilterParams struct {
+	ChainID  int `json:"chain_id"`
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// ItemHolder 表示 ERC-1155 token 的一个持有人及其持有数量
+type ItemHolder struct {
+	Owner   string `json:"owner"`
+	Balance int64  `json:"balance"`
+}
+
+type ItemHoldersResp struct {
+	Result []ItemHolder `json:"result"`
+	Count  int64        `json:"count"`
+}
+
 type ItemImage struct {
 	CollectionAddress string `json:"collection_address"`
 	TokenID           string `json:"token_id"`
@@ -52,6 +52,7 @@ type PortfolioMultiChainItemFilterParams struct {
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	CursorParams
 }
 
 type PortfolioMultiChainListingFilterParams struct {
@@ -61,6 +62,7 @@ type PortfolioMultiChainListingFilterParams struct {
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	CursorParams
 }
 
 type PortfolioMultiChainBidFilterParams struct {
@@ -70,6 +72,7 @@ type PortfolioMultiChainBidFilterParams struct {
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	CursorParams
 }
 
 type PortfolioItemInfo struct {
@@ -108,12 +111,16 @@ type PortfolioItemInfo struct {
 
 type UserItemsResp struct {
 	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	// Count 总数，游标分页时只在请求 with_total 时返回
+	Count int64 `json:"count"`
+	CursorPage
 }
 
 type UserListingsResp struct {
+	// Count 总数，游标分页时只在请求 with_total 时返回
 	Count  int64     `json:"count"`
 	Result []Listing `json:"result"`
+	CursorPage
 }
 
 type Listing struct {
@@ -156,8 +163,10 @@ type BidInfo struct {
 }
 
 type UserBidsResp struct {
+	// Count 总数，游标分页时只在请求 with_total 时返回
 	Count  int       `json:"count"`
 	Result []UserBid `json:"result"`
+	CursorPage
 }
 
 type UserBid struct {
@@ -0,0 +1,24 @@
+package types
+
+import "github.com/shopspring/decimal"
+
+type ProtocolState struct {
+	ChainID         int             `json:"chain_id"`
+	ContractAddress string          `json:"contract_address"`
+	ProtocolShare   decimal.Decimal `json:"protocol_share"`
+	Vault           string          `json:"vault"`
+	Owner           string          `json:"owner"`
+	Paused          bool            `json:"paused"`
+	BlockNumber     int64           `json:"block_number"`
+	UpdateTime      int64           `json:"update_time"`
+}
+
+type OrderFailure struct {
+	OrderID     string `json:"order_id"`
+	FailureType int    `json:"failure_type"`
+	BatchOffset int64  `json:"batch_offset"`
+	Reason      string `json:"reason"`
+	TxHash      string `json:"tx_hash"`
+	BlockNumber int64  `json:"block_number"`
+	EventTime   int64  `json:"event_time"`
+}
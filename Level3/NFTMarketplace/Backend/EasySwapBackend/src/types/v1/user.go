@@ -5,11 +5,41 @@ type LoginReq struct {
 	Message   string `json:"message"`
 	Signature string `json:"signature"`
 	Address   string `json:"address"`
+	// Device 登录设备的名称，用于会话列表展示
+	Device string `json:"device"`
 }
 
 type UserLoginInfo struct {
-	Token     string `json:"token"`
-	IsAllowed bool   `json:"is_allowed"`
+	// Token 访问令牌，请求时放在 Authorization 头中
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn 访问令牌的有效期（秒）
+	ExpiresIn int64 `json:"expires_in"`
+	IsAllowed bool  `json:"is_allowed"`
+}
+
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type UserTokenResp struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type UserSession struct {
+	Address    string `json:"address"`
+	SessionID  string `json:"session_id"`
+	Device     string `json:"device"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+	// Current 是否为发起请求的会话
+	Current bool `json:"current"`
+}
+
+type UserSessionsResp struct {
+	Result []UserSession `json:"result"`
 }
 
 type UserLoginResp struct {
@@ -0,0 +1,142 @@
+// Package apicache 后端 API 响应缓存的标签和失效消息：后端缓存响应时把缓存键登记在响应涉及的标签下，
+// 同步服务在数据变化后发布带有标签的失效消息，后端读取后只删除登记在这些标签下的缓存。
+// 失效消息写入所有链共用的 Redis Stream，每个后端实例独立读取，删除缓存是幂等的。
+package apicache
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	// CacheInvalidateStream 失效消息的 Redis Stream
+	CacheInvalidateStream = "cache:es:apicache:invalidate"
+
+	// InvalidateMaxLen Stream 保留的最大消息数量（近似）
+	InvalidateMaxLen = 10000
+
+	// publishScript 写入消息，ARGV: maxlen, tags
+	publishScript = `return redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'tags', ARGV[2])`
+
+	// rangeScript 读取 ARGV[1] 之后的消息，返回 {id1, tags1, id2, tags2, ...}。ARGV: start, count
+	rangeScript = `local result = redis.call('XRANGE', KEYS[1], ARGV[1], '+', 'COUNT', ARGV[2])
+local items = {}
+for _, entry in ipairs(result) do
+    local value = ''
+    local fields = entry[2]
+    if fields then
+        for i = 1, #fields, 2 do
+            if fields[i] == 'tags' then
+                value = fields[i + 1]
+            end
+        end
+    end
+    table.insert(items, entry[1])
+    table.insert(items, value)
+end
+return items`
+
+	// latestScript 返回最新的消息 ID，Stream 为空时返回空字符串
+	latestScript = `local last = redis.call('XREVRANGE', KEYS[1], '+', '-', 'COUNT', 1)
+if last[1] then
+    return last[1][1]
+end
+return ''`
+)
+
+// CollectionTag 集合级别的数据：集合详情、K 线、挂单和成交统计等
+func CollectionTag(chain, collectionAddr string) string {
+	return "collection:" + strings.ToLower(chain) + ":" + strings.ToLower(collectionAddr)
+}
+
+// ItemTag 单个 item 的数据：owner、挂单、图片等
+func ItemTag(chain, collectionAddr, tokenId string) string {
+	return "item:" + strings.ToLower(chain) + ":" + strings.ToLower(collectionAddr) + ":" + tokenId
+}
+
+// RankingTag 链上的集合排行，集合统计汇总后失效
+func RankingTag(chain string) string {
+	return "ranking:" + strings.ToLower(chain)
+}
+
+// Message 一条失效消息
+type Message struct {
+	// ID 消息在 Stream 中的 ID，读取时设置
+	ID   string   `json:"-"`
+	Tags []string `json:"tags"`
+}
+
+// Publish 发布失效消息，重复和空的标签会被去掉，没有标签时不发布
+func Publish(kv *xkv.Store, tags ...string) error {
+	tags = uniqueTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(&Message{Tags: tags})
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal cache invalidate message")
+	}
+	if _, err := kv.Eval(publishScript, CacheInvalidateStream, InvalidateMaxLen, string(raw)); err != nil {
+		return errors.Wrap(err, "failed on publish cache invalidate message")
+	}
+	return nil
+}
+
+// ReadAfter 读取 after 之后（不含）最多 count 条消息，after 为空时从最早的消息开始读取
+func ReadAfter(kv *xkv.Store, after string, count int) ([]*Message, error) {
+	start := "-"
+	if after != "" {
+		// 不包含 after 本身，需要 Redis 6.2 以上
+		start = "(" + after
+	}
+	result, err := kv.Eval(rangeScript, CacheInvalidateStream, start, count)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on read cache invalidate messages")
+	}
+	items, _ := result.([]interface{})
+	messages := make([]*Message, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		id, _ := items[i].(string)
+		raw, _ := items[i+1].(string)
+		var message Message
+		// 无法解析的消息仍然返回 ID，让调用方推进读取位置
+		_ = json.Unmarshal([]byte(raw), &message)
+		message.ID = id
+		messages = append(messages, &message)
+	}
+	return messages, nil
+}
+
+// Latest 返回最新的消息 ID，Stream 为空时返回空字符串
+func Latest(kv *xkv.Store) (string, error) {
+	result, err := kv.Eval(latestScript, CacheInvalidateStream)
+	if err != nil && err != redis.Nil {
+		return "", errors.Wrap(err, "failed on read latest cache invalidate message")
+	}
+	id, _ := result.(string)
+	return id, nil
+}
+
+// TagKind 返回标签的类型（collection / item / ranking），用于监控标签
+func TagKind(tag string) string {
+	kind, _, _ := strings.Cut(tag, ":")
+	return kind
+}
+
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
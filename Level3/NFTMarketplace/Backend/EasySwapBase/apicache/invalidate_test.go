@@ -0,0 +1,22 @@
+package apicache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags(t *testing.T) {
+	assert.Equal(t, "collection:sepolia:0xabc", CollectionTag("Sepolia", "0xABC"))
+	assert.Equal(t, "item:sepolia:0xabc:42", ItemTag("sepolia", "0xAbc", "42"))
+	assert.Equal(t, "ranking:eth", RankingTag("ETH"))
+
+	assert.Equal(t, "collection", TagKind(CollectionTag("eth", "0xabc")))
+	assert.Equal(t, "ranking", TagKind(RankingTag("eth")))
+}
+
+func TestUniqueTags(t *testing.T) {
+	// 去掉重复和空的标签，保持原有顺序
+	assert.Equal(t, []string{"a", "b"}, uniqueTags([]string{"a", "", "b", "a"}))
+	assert.Empty(t, uniqueTags(nil))
+}
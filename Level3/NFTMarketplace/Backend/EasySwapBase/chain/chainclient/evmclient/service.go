@@ -9,6 +9,10 @@ import (
 	"github.com/ethereum/go-ethereum"
 	// 导入以太坊通用工具包
 	"github.com/ethereum/go-ethereum/common"
+	// 导入以太坊区块、日志类型包
+	"github.com/ethereum/go-ethereum/core/types"
+	// 导入以太坊订阅工具包
+	"github.com/ethereum/go-ethereum/event"
 	// 导入以太坊客户端包
 	"github.com/ethereum/go-ethereum/ethclient"
 	// 导入错误处理包
@@ -18,10 +22,15 @@ import (
 	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
 )
 
+// ErrSubscriptionNotSupported 没有配置 websocket 节点，无法订阅
+var ErrSubscriptionNotSupported = errors.New("subscription requires websocket endpoint")
+
 // Service 结构体表示一个 EVM 客户端服务实例。
 type Service struct {
 	// client 是以太坊客户端实例，用于与 EVM 兼容的区块链进行交互。
 	client *ethclient.Client
+	// wsClient 是基于 websocket 的以太坊客户端实例，用于订阅，未配置时为 nil。
+	wsClient *ethclient.Client
 }
 
 // New 创建一个新的 EVM 客户端服务实例。
@@ -41,6 +50,24 @@ func New(nodeUrl string) (*Service, error) {
 	}, nil
 }
 
+// NewWithWebsocket 创建一个支持订阅的 EVM 客户端服务实例。
+// 参数 nodeUrl 是以太坊节点的 URL，用于普通请求；wsUrl 是 websocket 节点的 URL，用于订阅。
+// 返回一个指向 Service 结构体的指针和可能出现的错误。
+func NewWithWebsocket(nodeUrl, wsUrl string) (*Service, error) {
+	s, err := New(nodeUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	// websocket 连接断开后，下一次订阅时会自动重连
+	wsClient, err := ethclient.Dial(wsUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create websocket client")
+	}
+	s.wsClient = wsClient
+	return s, nil
+}
+
 // Client 返回底层的以太坊客户端实例。
 // 返回值为一个空接口，允许调用者将其转换为所需的类型。
 func (s *Service) Client() interface{} {
@@ -109,6 +136,27 @@ func (s *Service) BlockTimeByNumber(ctx context.Context, blockNum *big.Int) (uin
 	return header.Time, nil
 }
 
+// HeaderByNumber 根据给定的块号获取块头信息。
+// 参数 ctx 是上下文，用于控制操作的生命周期。
+// 参数 number 是要查询的块号，nil 表示最新块。
+// 返回包含块号、块哈希、父块哈希和时间戳的块头信息，以及可能出现的错误。
+func (s *Service) HeaderByNumber(ctx context.Context, number *big.Int) (*logTypes.Header, error) {
+	// 调用以太坊客户端的 HeaderByNumber 方法获取块头
+	header, err := s.client.HeaderByNumber(ctx, number)
+	if err != nil {
+		// 如果获取块头失败，返回错误信息
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+
+	// 转换为链无关的块头结构
+	return &logTypes.Header{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash().Hex(),
+		ParentHash: header.ParentHash.Hex(),
+		Time:       header.Time,
+	}, nil
+}
+
 // CallContractByChain 根据给定的参数调用智能合约。
 // 参数 ctx 是上下文，用于控制操作的生命周期。
 // 参数 param 是调用参数，包含 EVM 参数和块号等信息。
@@ -157,3 +205,94 @@ func (s *Service) BlockWithTxs(ctx context.Context, blockNumber uint64) (interfa
 	// 返回包含交易的块信息和 nil 错误
 	return blockWithTxs, nil
 }
+
+// SubscribeNewHead 订阅新区块头。
+// 参数 ctx 是上下文，用于控制订阅的建立。
+// 参数 ch 是接收新区块头的通道。
+// 返回订阅和可能出现的错误，连接断开时订阅的 Err() 返回错误。
+func (s *Service) SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.Header) (ethereum.Subscription, error) {
+	if s.wsClient == nil {
+		return nil, ErrSubscriptionNotSupported
+	}
+
+	headers := make(chan *types.Header)
+	sub, err := s.wsClient.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe new head")
+	}
+
+	// 把以太坊区块头转换为链无关的区块头后转发
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case header := <-headers:
+				select {
+				case ch <- &logTypes.Header{
+					Number:     header.Number.Uint64(),
+					Hash:       header.Hash().Hex(),
+					ParentHash: header.ParentHash.Hex(),
+					Time:       header.Time,
+				}:
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// SubscribeFilterLogs 订阅符合查询条件的新日志。
+// 参数 ctx 是上下文，用于控制订阅的建立。
+// 参数 q 是过滤查询条件，只使用地址和主题。
+// 参数 ch 是接收日志的通道，日志类型为 types.Log，与 FilterLogs 一致。
+// 返回订阅和可能出现的错误，连接断开时订阅的 Err() 返回错误。
+func (s *Service) SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- interface{}) (ethereum.Subscription, error) {
+	if s.wsClient == nil {
+		return nil, ErrSubscriptionNotSupported
+	}
+
+	var addresses []common.Address
+	for _, addr := range q.Addresses {
+		addresses = append(addresses, common.HexToAddress(addr))
+	}
+	var topicsHash [][]common.Hash
+	for _, topics := range q.Topics {
+		var topicHash []common.Hash
+		for _, topic := range topics {
+			topicHash = append(topicHash, common.HexToHash(topic))
+		}
+		topicsHash = append(topicsHash, topicHash)
+	}
+
+	logs := make(chan types.Log)
+	sub, err := s.wsClient.SubscribeFilterLogs(ctx, ethereum.FilterQuery{
+		Addresses: addresses,
+		Topics:    topicsHash,
+	}, logs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe filter logs")
+	}
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				select {
+				case ch <- log:
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
@@ -4,6 +4,7 @@ package chainclient
 import (
 	"context"
 	"math/big"
+	"sync"
 
 	// 导入以太坊相关包
 	"github.com/ethereum/go-ethereum"
@@ -38,6 +39,15 @@ type ChainClient interface {
 	//   - error: 操作过程中可能出现的错误
 	BlockTimeByNumber(context.Context, *big.Int) (uint64, error)
 
+	// HeaderByNumber 根据区块号获取区块头信息（区块哈希、父区块哈希、时间戳）
+	// 参数:
+	//   - ctx: 上下文，用于控制操作的生命周期
+	//   - number: 区块号，nil 表示最新区块
+	// 返回值:
+	//   - *logTypes.Header: 区块头信息
+	//   - error: 操作过程中可能出现的错误
+	HeaderByNumber(ctx context.Context, number *big.Int) (*logTypes.Header, error)
+
 	// Client 返回底层的区块链客户端实例
 	// 返回值:
 	//   - interface{}: 区块链客户端实例
@@ -76,6 +86,73 @@ type ChainClient interface {
 	//   - interface{}: 包含交易信息的区块
 	//   - error: 操作过程中可能出现的错误
 	BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error)
+
+	// SubscribeNewHead 订阅新区块头，需要 websocket 节点
+	// 参数:
+	//   - ctx: 上下文，用于控制操作的生命周期
+	//   - ch: 接收新区块头的通道
+	// 返回值:
+	//   - ethereum.Subscription: 订阅，连接断开时 Err() 返回错误
+	//   - error: 没有配置 websocket 节点时返回 ErrSubscriptionNotSupported
+	SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.Header) (ethereum.Subscription, error)
+
+	// SubscribeFilterLogs 订阅符合查询条件的新日志，需要 websocket 节点
+	// 参数:
+	//   - ctx: 上下文，用于控制操作的生命周期
+	//   - q: 过滤查询条件，只使用地址和主题
+	//   - ch: 接收日志的通道，日志类型与 FilterLogs 返回的一致
+	// 返回值:
+	//   - ethereum.Subscription: 订阅，连接断开时 Err() 返回错误
+	//   - error: 没有配置 websocket 节点时返回 ErrSubscriptionNotSupported
+	SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- interface{}) (ethereum.Subscription, error)
+}
+
+// ErrSubscriptionNotSupported 客户端没有配置 websocket 节点，无法订阅
+var ErrSubscriptionNotSupported = evmclient.ErrSubscriptionNotSupported
+
+// 链虚拟机类型，决定使用哪种客户端实现
+const (
+	VMTypeEVM = "evm"
+)
+
+var (
+	registryMu sync.RWMutex
+	// registry 链 ID 到虚拟机类型的映射，内置以太坊、Optimism 和 Sepolia，
+	// 其他 EVM 链通过 Register 加入（例如根据同步服务的链配置）。
+	registry = map[int]string{
+		chain.EthChainID:      VMTypeEVM,
+		chain.OptimismChainID: VMTypeEVM,
+		chain.SepoliaChainID:  VMTypeEVM,
+	}
+)
+
+// Register 注册一条链，之后可以通过 New / NewWithWebsocket 为该链创建客户端
+// 参数:
+//   - chainID: 链的 ID
+//   - vmType: 虚拟机类型，目前只支持 VMTypeEVM
+//
+// 返回值:
+//   - error: 虚拟机类型不支持，或者链 ID 已注册为其他虚拟机类型
+func Register(chainID int, vmType string) error {
+	if vmType != VMTypeEVM {
+		return errors.Errorf("unsupported vm type %s", vmType)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registered, ok := registry[chainID]; ok && registered != vmType {
+		return errors.Errorf("chain id %d already registered as %s", chainID, registered)
+	}
+	registry[chainID] = vmType
+	return nil
+}
+
+// vmTypeOf 返回链的虚拟机类型，未注册时返回 false
+func vmTypeOf(chainID int) (string, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	vmType, ok := registry[chainID]
+	return vmType, ok
 }
 
 // New 根据链 ID 和节点 URL 创建一个新的 ChainClient 实例
@@ -87,13 +164,38 @@ type ChainClient interface {
 //   - ChainClient: 新创建的 ChainClient 实例
 //   - error: 操作过程中可能出现的错误
 func New(chainID int, nodeUrl string) (ChainClient, error) {
-	// 根据链 ID 选择不同的客户端实现
-	switch chainID {
-	// 支持以太坊、Optimism 和 Sepolia 链
-	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID:
+	// 根据链注册的虚拟机类型选择不同的客户端实现
+	vmType, ok := vmTypeOf(chainID)
+	if !ok {
+		// 未注册的链 ID，返回错误
+		return nil, errors.Errorf("unsupported chain id %d", chainID)
+	}
+	switch vmType {
+	case VMTypeEVM:
 		return evmclient.New(nodeUrl)
 	default:
-		// 不支持的链 ID，返回错误
-		return nil, errors.New("unsupported chain id")
+		return nil, errors.Errorf("unsupported vm type %s", vmType)
+	}
+}
+
+// NewWithWebsocket 根据链 ID、节点 URL 和 websocket 节点 URL 创建一个支持订阅的 ChainClient 实例
+// 参数:
+//   - chainID: 链的 ID
+//   - nodeUrl: 节点的 URL，用于普通请求
+//   - wsUrl: websocket 节点的 URL，用于订阅新区块头和日志
+//
+// 返回值:
+//   - ChainClient: 新创建的 ChainClient 实例
+//   - error: 操作过程中可能出现的错误
+func NewWithWebsocket(chainID int, nodeUrl, wsUrl string) (ChainClient, error) {
+	vmType, ok := vmTypeOf(chainID)
+	if !ok {
+		return nil, errors.Errorf("unsupported chain id %d", chainID)
+	}
+	switch vmType {
+	case VMTypeEVM:
+		return evmclient.NewWithWebsocket(nodeUrl, wsUrl)
+	default:
+		return nil, errors.Errorf("unsupported vm type %s", vmType)
 	}
 }
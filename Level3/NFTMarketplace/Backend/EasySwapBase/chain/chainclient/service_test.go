@@ -0,0 +1,28 @@
+package chainclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/chain"
+)
+
+func TestRegister(t *testing.T) {
+	const baseChainID = 8453
+
+	_, ok := vmTypeOf(baseChainID)
+	assert.False(t, ok)
+	_, err := New(baseChainID, "http://127.0.0.1:8545")
+	assert.Error(t, err)
+
+	assert.NoError(t, Register(baseChainID, VMTypeEVM))
+	vmType, ok := vmTypeOf(baseChainID)
+	assert.True(t, ok)
+	assert.Equal(t, VMTypeEVM, vmType)
+
+	// 重复注册同一类型是允许的，内置的链也一样
+	assert.NoError(t, Register(baseChainID, VMTypeEVM))
+	assert.NoError(t, Register(chain.SepoliaChainID, VMTypeEVM))
+	assert.Error(t, Register(baseChainID, "svm"))
+}
@@ -0,0 +1,111 @@
+package nftchainservice
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// EIP-165 接口 ID
+var (
+	InterfaceIdERC721           = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	InterfaceIdERC721Enumerable = [4]byte{0x78, 0x0e, 0x9d, 0x63}
+	InterfaceIdERC1155          = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+// CollectionInfo 从合约读取的集合信息
+type CollectionInfo struct {
+	Address string
+	Name    string
+	Symbol  string
+	// IsERC721 / IsERC1155 通过 supportsInterface 检测的合约标准
+	IsERC721  bool
+	IsERC1155 bool
+	// Enumerable 是否实现了 ERC721Enumerable，实现时可以通过 tokenByIndex 枚举全部 token
+	Enumerable bool
+	// TotalSupply 发行总量，合约没有实现 totalSupply 时为 nil
+	TotalSupply *big.Int
+}
+
+// FetchCollectionInfo 读取合约的标准、名称、符号和发行总量。
+// name / symbol / totalSupply 都是可选的扩展接口，合约没有实现时对应字段为空，不作为错误返回。
+func (s *Service) FetchCollectionInfo(collectionAddr string) (*CollectionInfo, error) {
+	info := &CollectionInfo{Address: collectionAddr}
+
+	var err error
+	if info.IsERC721, err = s.SupportsInterface(collectionAddr, InterfaceIdERC721); err != nil {
+		return nil, err
+	}
+	if !info.IsERC721 {
+		if info.IsERC1155, err = s.SupportsInterface(collectionAddr, InterfaceIdERC1155); err != nil {
+			return nil, err
+		}
+	} else if info.Enumerable, err = s.SupportsInterface(collectionAddr, InterfaceIdERC721Enumerable); err != nil {
+		return nil, err
+	}
+
+	if res, err := s.callContract(collectionAddr, "name"); err == nil {
+		info.Name = res[0].(string)
+	}
+	if res, err := s.callContract(collectionAddr, "symbol"); err == nil {
+		info.Symbol = res[0].(string)
+	}
+	if res, err := s.callContract(collectionAddr, "totalSupply"); err == nil {
+		info.TotalSupply = res[0].(*big.Int)
+	}
+	return info, nil
+}
+
+// SupportsInterface 调用合约的 supportsInterface 方法。
+// 没有实现 EIP-165 的合约调用会失败，此时视为不支持，只有节点请求失败时返回错误。
+func (s *Service) SupportsInterface(collectionAddr string, interfaceId [4]byte) (bool, error) {
+	res, err := s.callContract(collectionAddr, "supportsInterface", interfaceId)
+	if err != nil {
+		if IsExecutionReverted(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return res[0].(bool), nil
+}
+
+// TokenByIndex 调用 ERC721Enumerable 的 tokenByIndex 方法，返回十进制的 token id
+func (s *Service) TokenByIndex(collectionAddr string, index int64) (string, error) {
+	res, err := s.callContract(collectionAddr, "tokenByIndex", big.NewInt(index))
+	if err != nil {
+		return "", err
+	}
+	return res[0].(*big.Int).String(), nil
+}
+
+// callContract 按 NFT 合约的 ABI 调用只读方法并解析返回值
+func (s *Service) callContract(collectionAddr string, method string, args ...interface{}) ([]interface{}, error) {
+	reqData, err := s.Abi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed on pack %s", method))
+	}
+
+	to := common.HexToAddress(collectionAddr)
+	respData, err := s.NodeClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: reqData}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed on request %s", method))
+	}
+
+	res, err := s.Abi.Unpack(method, respData)
+	if err != nil || len(res) == 0 {
+		// 没有实现该方法的合约可能返回空数据
+		return nil, errors.Wrap(errExecutionReverted, fmt.Sprintf("failed on unpack %s", method))
+	}
+	return res, nil
+}
+
+var errExecutionReverted = errors.New("execution reverted")
+
+// IsExecutionReverted 合约调用被回滚或者返回了无法解析的数据，通常表示合约没有实现该方法或者 token 不存在
+func IsExecutionReverted(err error) bool {
+	return errors.Is(err, errExecutionReverted) || strings.Contains(err.Error(), "revert")
+}
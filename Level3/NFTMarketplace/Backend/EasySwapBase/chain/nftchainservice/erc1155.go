@@ -0,0 +1,132 @@
+package nftchainservice
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	evmTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// ERC-1155 的 TransferSingle / TransferBatch 事件
+var (
+	EVMTransferSingleTopic = common.HexToHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+	EVMTransferBatchTopic  = common.HexToHash("0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb")
+)
+
+// erc1155Abi 只包含同步需要用到的 ERC-1155 方法和事件
+const erc1155Abi = `[
+{"anonymous":false,"inputs":[{"indexed":true,"name":"operator","type":"address"},{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"id","type":"uint256"},{"indexed":false,"name":"value","type":"uint256"}],"name":"TransferSingle","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"operator","type":"address"},{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"ids","type":"uint256[]"},{"indexed":false,"name":"values","type":"uint256[]"}],"name":"TransferBatch","type":"event"},
+{"inputs":[{"name":"id","type":"uint256"}],"name":"uri","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+var erc1155ParsedAbi = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(erc1155Abi))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// URI 调用 ERC-1155 合约的 uri 方法获取元数据地址，并按标准把 {id} 替换为 64 位十六进制的 token id
+func (s *Service) URI(collectionAddr string, tokenID string) (string, error) {
+	tokenId, ok := new(big.Int).SetString(tokenID, 10)
+	if !ok {
+		return "", errors.Errorf("invalid token id %s", tokenID)
+	}
+	reqData, err := erc1155ParsedAbi.Pack("uri", tokenId)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed on pack uri %s", tokenID))
+	}
+
+	to := common.HexToAddress(collectionAddr)
+	respData, err := s.NodeClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: reqData}, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed on request uri")
+	}
+	res, err := erc1155ParsedAbi.Unpack("uri", respData)
+	if err != nil || len(res) == 0 {
+		return "", errors.Wrap(errExecutionReverted, "failed on unpack uri")
+	}
+	return expandTokenURI(res[0].(string), tokenId), nil
+}
+
+// expandTokenURI 把 ERC-1155 元数据地址中的 {id} 替换为补零到 64 位的小写十六进制 token id
+func expandTokenURI(uri string, tokenId *big.Int) string {
+	return strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", tokenId))
+}
+
+// decodeERC1155Transfer 解析 TransferSingle / TransferBatch 事件，每个 (token, value) 返回一条转移记录。
+// 数量超过 int64 范围的转移不截断，Amount 为 0，原始数量记录在 OverflowAmount 中，由调用方决定如何处理，
+// 避免一条异常的日志导致整个区间无法同步。
+func decodeERC1155Transfer(evmLog evmTypes.Log) ([]*TransferLog, error) {
+	if len(evmLog.Topics) < 4 {
+		return nil, errors.New("invalid erc1155 transfer topics")
+	}
+
+	var ids, values []*big.Int
+	switch evmLog.Topics[0] {
+	case EVMTransferSingleTopic:
+		var event struct {
+			Id    *big.Int
+			Value *big.Int
+		}
+		if err := erc1155ParsedAbi.UnpackIntoInterface(&event, "TransferSingle", evmLog.Data); err != nil {
+			return nil, errors.Wrap(err, "failed on unpack TransferSingle event")
+		}
+		ids, values = []*big.Int{event.Id}, []*big.Int{event.Value}
+	case EVMTransferBatchTopic:
+		var event struct {
+			Ids    []*big.Int
+			Values []*big.Int
+		}
+		if err := erc1155ParsedAbi.UnpackIntoInterface(&event, "TransferBatch", evmLog.Data); err != nil {
+			return nil, errors.Wrap(err, "failed on unpack TransferBatch event")
+		}
+		if len(event.Ids) != len(event.Values) {
+			return nil, errors.New("mismatched TransferBatch ids and values")
+		}
+		ids, values = event.Ids, event.Values
+	default:
+		return nil, errors.Errorf("unexpected erc1155 transfer topic %s", evmLog.Topics[0].Hex())
+	}
+
+	from := common.BytesToAddress(evmLog.Topics[2].Bytes()).String()
+	to := common.BytesToAddress(evmLog.Topics[3].Bytes()).String()
+	transferLogs := make([]*TransferLog, 0, len(ids))
+	for i := range ids {
+		var amount int64
+		var overflowAmount string
+		if values[i].IsInt64() {
+			amount = values[i].Int64()
+		} else {
+			overflowAmount = values[i].String()
+		}
+		transferLogs = append(transferLogs, &TransferLog{
+			Address:         evmLog.Address.String(),
+			TransactionHash: evmLog.TxHash.String(),
+			BlockNumber:     evmLog.BlockNumber,
+			BlockHash:       evmLog.BlockHash.String(),
+			Data:            evmLog.Data,
+			Topics:          evmLog.Topics,
+			Topic0:          evmLog.Topics[0].Hex(),
+			From:            from,
+			To:              to,
+			TokenID:         ids[i].String(),
+			Amount:          amount,
+			OverflowAmount:  overflowAmount,
+			IsERC1155:       true,
+			BatchIndex:      i,
+			TxIndex:         evmLog.TxIndex,
+			Index:           evmLog.Index,
+			Removed:         evmLog.Removed,
+		})
+	}
+	return transferLogs, nil
+}
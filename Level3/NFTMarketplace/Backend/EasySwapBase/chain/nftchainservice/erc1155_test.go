@@ -0,0 +1,66 @@
+package nftchainservice
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	evmTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestERC1155Topics(t *testing.T) {
+	assert.Equal(t, crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)")), EVMTransferSingleTopic)
+	assert.Equal(t, crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])")), EVMTransferBatchTopic)
+}
+
+func TestDecodeERC1155Transfer(t *testing.T) {
+	operator := common.HexToAddress("0x1")
+	from := common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e20d17dc79C")
+	topics := func(topic0 common.Hash) []common.Hash {
+		return []common.Hash{topic0, common.BytesToHash(operator.Bytes()), common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}
+	}
+
+	single := erc1155ParsedAbi.Events["TransferSingle"]
+	data, err := single.Inputs.NonIndexed().Pack(big.NewInt(7), big.NewInt(5))
+	assert.NoError(t, err)
+	logs, err := decodeERC1155Transfer(evmTypes.Log{Topics: topics(EVMTransferSingleTopic), Data: data, BlockNumber: 10, Index: 3})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "7", logs[0].TokenID)
+	assert.Equal(t, int64(5), logs[0].Amount)
+	assert.Equal(t, from.String(), logs[0].From)
+	assert.Equal(t, to.String(), logs[0].To)
+	assert.True(t, logs[0].IsERC1155)
+
+	batch := erc1155ParsedAbi.Events["TransferBatch"]
+	data, err = batch.Inputs.NonIndexed().Pack([]*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{big.NewInt(10), big.NewInt(20)})
+	assert.NoError(t, err)
+	logs, err = decodeERC1155Transfer(evmTypes.Log{Topics: topics(EVMTransferBatchTopic), Data: data, Index: 4})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "2", logs[1].TokenID)
+	assert.Equal(t, int64(20), logs[1].Amount)
+	assert.Equal(t, uint(4), logs[1].Index)
+
+	// 数量超过 int64 时不截断，记录原始数量，同一批次中的其他转移不受影响
+	huge := new(big.Int).Lsh(big.NewInt(1), 64)
+	data, err = batch.Inputs.NonIndexed().Pack([]*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{huge, big.NewInt(20)})
+	assert.NoError(t, err)
+	logs, err = decodeERC1155Transfer(evmTypes.Log{Topics: topics(EVMTransferBatchTopic), Data: data})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, int64(0), logs[0].Amount)
+	assert.Equal(t, "18446744073709551616", logs[0].OverflowAmount)
+	assert.Equal(t, int64(20), logs[1].Amount)
+	assert.Empty(t, logs[1].OverflowAmount)
+}
+
+func TestExpandTokenURI(t *testing.T) {
+	assert.Equal(t, "https://example.com/000000000000000000000000000000000000000000000000000000000000004d.json",
+		expandTokenURI("https://example.com/{id}.json", big.NewInt(77)))
+	assert.Equal(t, "ipfs://QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/77",
+		expandTokenURI("ipfs://QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/77", big.NewInt(77)))
+}
@@ -2,7 +2,6 @@ package nftchainservice
 
 import (
 	"bytes"
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -20,15 +19,10 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 )
 
-const fetchIPFSTimeout = 30 * time.Second
-
-var (
-	hosts = []string{"https://ipfs.io/ipfs/", "https://cf-ipfs.com/ipfs/", "https://infura-ipfs.io/ipfs/", "https://cloudflare-ipfs.com/ipfs/"}
-)
-
 type nftInfoSimple struct {
 	Name         string `json:"name"`
 	Image        string `json:"image"`
@@ -51,59 +45,82 @@ func (s *Service) fetchNftMetadata(collectionAddr string, tokenID string) ([]byt
 		// 记录获取NFT元数据结束的日志，并计算耗时
 		xzap.WithContext(s.ctx).Info("fetch nft metadata end", zap.String("collection_addr", collectionAddr), zap.String("token_id", tokenID), zap.Float64("take", time.Now().Sub(beginTime).Seconds()))
 	}()
+	tokenUri, err := s.TokenURI(collectionAddr, tokenID)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := s.fetchRawMetadata(tokenUri)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, tokenUri, nil
+}
+
+// TokenURI 调用合约的 tokenURI 方法获取NFT元数据的地址
+func (s *Service) TokenURI(collectionAddr string, tokenID string) (string, error) {
 	// 将tokenID转换为大整数类型
 	tokenId, _ := big.NewInt(0).SetString(tokenID, 10)
 	// 调用智能合约的tokenURI方法获取tokenURI的数据
 	tokenURIReqData, err := s.Abi.Pack("tokenURI", tokenId)
 	if err != nil {
-		return nil, "", errors.Wrap(err, fmt.Sprintf("failed on pack token uri %s", tokenID))
+		return "", errors.Wrap(err, fmt.Sprintf("failed on pack token uri %s", tokenID))
 	}
 
 	to := common.HexToAddress(collectionAddr)
 	// 通过以太坊节点调用智能合约，获取tokenURI的响应数据
 	respData, err := s.NodeClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: tokenURIReqData}, nil)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "failed on request token uri")
+		return "", errors.Wrap(err, "failed on request token uri")
 	}
 	// 解析tokenURI的响应数据
 	res, err := s.Abi.Unpack("tokenURI", respData)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "failed on unpack token uri")
+		return "", errors.Wrap(err, "failed on unpack token uri")
 	}
+	return res[0].(string), nil
+}
 
-	tokenUri := res[0].(string)
+// fetchRawMetadata 根据元数据地址获取原始元数据
+// 根据tokenUri的前缀判断元数据的存储位置和格式:
+// 如果是base64编码的JSON数据，它将解码数据；如果是IPFS上的数据，它将调用fetchIpfsData方法获取数据
+func (s *Service) fetchRawMetadata(tokenUri string) ([]byte, error) {
 	var body []byte
+	var err error
 	// 根据tokenUri的前缀判断元数据的存储位置和格式，并获取元数据
 	if len(tokenUri) > 29 && tokenUri[0:29] == "data:application/json;base64," {
 		// 解码base64编码的JSON数据
 		body, err = base64.StdEncoding.DecodeString(tokenUri[29:])
 		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on decode token uri: %s", tokenUri))
+			return nil, errors.Wrap(err, fmt.Sprintf("failed on decode token uri: %s", tokenUri))
 		}
-	} else if len(tokenUri) > 5 && tokenUri[0:5] == "ipfs:" {
-		// 从IPFS网络获取数据
+	} else if ipfs.IsIpfsURI(tokenUri) {
+		// ipfs:// 地址和网关地址都按内容寻址从IPFS网络获取数据
 		body, err = s.fetchIpfsData(tokenUri)
+		if err != nil && !strings.HasPrefix(tokenUri, "http") {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed on fetch token uri: %s", tokenUri))
+		}
 		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch token uri: %s", tokenUri))
+			// 网关地址获取失败时直接请求原地址
+			xzap.WithContext(s.ctx).Warn("failed on fetch ipfs data, fallback to http", zap.String("token_uri", tokenUri), zap.Error(err))
+			body = nil
 		}
 	} else if len(tokenUri) > 5 && tokenUri[0:4] != "http" {
 		// 如果URI格式不正确，返回错误
-		return nil, "", errors.New(fmt.Sprintf("invalid url %s", tokenUri))
+		return nil, errors.New(fmt.Sprintf("invalid url %s", tokenUri))
 	}
 	// 如果是HTTP链接，获取JSON格式的元数据
-	if len(tokenUri) > 5 && tokenUri[0:4] == "http" {
+	if body == nil && len(tokenUri) > 5 && tokenUri[0:4] == "http" {
 		body, err = s.fetchJsonData(tokenUri)
 		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch metadata. uri:%s", tokenUri))
+			return nil, errors.Wrap(err, fmt.Sprintf("failed on fetch metadata. uri:%s", tokenUri))
 		}
 	}
 	// 处理获取到的元数据，去除可能的BOM标记
 	if body != nil {
-		body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
-		return body, tokenUri, nil
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), nil
 	}
 	// 如果元数据为空，返回错误
-	return nil, "", errors.New("empty metadata")
+	return nil, errors.New("empty metadata")
 }
 
 // FetchNftOwner 获取NFT所有者地址。
@@ -154,75 +171,15 @@ func (s *Service) FetchNftOwner(collectionAddr string, tokenID string) (common.A
 	return address, nil
 }
 
-// fetchIpfsData 通过IPFS获取数据。
-// 该方法尝试从多个IPFS主机获取数据，直到成功或超时。
-// 参数:tokenUri - 包含IPFS路径的URI。
+// fetchIpfsData 通过网关池获取IPFS数据。
+// 网关池按 CID 校验返回的数据，并优先使用本地节点和磁盘缓存。
+// 参数:tokenUri - ipfs:// 地址或者IPFS网关地址。
 // 返回值：
 //
 //	[]byte - 获取到的数据。
 //	error - 如果获取失败，返回错误信息。
 func (s *Service) fetchIpfsData(tokenUri string) ([]byte, error) {
-	// 创建一个通道，用于接收成功获取的数据。
-	finished := make(chan []byte)
-	// 创建一个定时器，用于在fetchIPFSTimeout后触发超时。
-	ticker := time.NewTicker(fetchIPFSTimeout)
-	// 定义一个取消函数切片，用于取消未完成的HTTP请求。
-	var cancelFns []context.CancelFunc
-	// 遍历所有IPFS主机，尝试获取数据
-	for i := range hosts {
-		host := hosts[i]
-		// 构建完整的IPFS请求URL。
-		fullUrl := strings.Replace(tokenUri, "ipfs://", host, 1)
-		// 创建一个可取消的上下文，用于控制HTTP请求的生命周期。
-		ctx, cancel := context.WithCancel(context.Background())
-		// 将取消函数添加到切片中，以便后续取消所有未完成的请求。
-		cancelFns = append(cancelFns, cancel)
-		// 启动一个新的goroutine，用于发起HTTP请求。
-		go func() {
-			// 创建HTTP GET请求。
-			req, err := http.NewRequestWithContext(ctx, "GET", fullUrl, nil)
-			if err != nil {
-				// 记录错误日志，并退出goroutine。
-				xzap.WithContext(s.ctx).Error("failed on create fetch ipfs data req",
-					zap.String("token_uri", tokenUri), zap.Error(err))
-				return
-			}
-			// 发送HTTP请求，并获取响应。
-			resp, err := s.HttpClient.Do(req)
-			if err != nil {
-				// 记录错误日志，并退出goroutine。
-				xzap.WithContext(s.ctx).Error("failed on fetch metadata from ipfs",
-					zap.String("token_uri", tokenUri), zap.Error(err))
-				return
-			}
-			// 检查HTTP响应状态码是否为200（成功）。
-			if resp.StatusCode == http.StatusOK {
-				// 读取HTTP响应体。
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					// 记录错误日志，并退出goroutine。
-					xzap.WithContext(s.ctx).Error("failed on read ipfs req resp body",
-						zap.String("token_uri", tokenUri), zap.Error(err))
-					return
-				}
-				// 将获取到的数据发送到finished通道。
-				finished <- body
-			}
-		}()
-	}
-	// 监听finished通道和定时器，等待数据获取成功或超时。
-	select {
-	case data := <-finished:
-		// 数据获取成功，取消所有未完成的请求，并返回获取到的数据。
-		for i := range cancelFns {
-			cancelFns[i]()
-		}
-
-		return data, nil
-	case <-ticker.C:
-		// 超时，返回错误信息。
-		return nil, errors.New("request metadata timeout: " + tokenUri)
-	}
+	return s.Ipfs.Fetch(s.ctx, tokenUri)
 }
 
 func (s *Service) fetchJsonData(tokenUri string) (body []byte, err error) {
@@ -264,6 +221,21 @@ func (s *Service) FetchOnChainMetadata(collectionAddr string, tokenID string) (*
 		return nil, errors.Wrap(err, "failed on fetch nft metadata")
 	}
 
+	return s.decodeMetadata(rawData, tokenUri)
+}
+
+// FetchMetadataByURI 根据 TokenURI 返回的元数据地址获取并解析元数据。
+// 与 FetchOnChainMetadata 相同，调用方可以在两步之间按元数据所在的域名限流。
+func (s *Service) FetchMetadataByURI(tokenUri string) (*JsonMetadata, error) {
+	rawData, err := s.fetchRawMetadata(tokenUri)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on fetch nft metadata")
+	}
+
+	return s.decodeMetadata(rawData, tokenUri)
+}
+
+func (s *Service) decodeMetadata(rawData []byte, tokenUri string) (*JsonMetadata, error) {
 	if len(rawData) == 0 {
 		return nil, errors.New("metadata length is zero")
 	}
@@ -285,7 +257,7 @@ func DecodeJsonMetadata(content []byte, tokenUri string, nameTags, imageTags, at
 		}, nil
 	}
 
-	if isImageFile(content) {
+	if IsImageFile(content) {
 		return &JsonMetadata{
 			Image: tokenUri,
 		}, nil
@@ -420,10 +392,12 @@ func isTextFile(data []byte) bool {
 	return strings.Contains(http.DetectContentType(data), "text/")
 }
 
-func isImageFile(data []byte) bool {
+// IsImageFile 根据文件内容判断是否为图片
+func IsImageFile(data []byte) bool {
 	return strings.Contains(http.DetectContentType(data), "image/")
 }
 
-func isVideoFile(data []byte) bool {
+// IsVideoFile 根据文件内容判断是否为视频
+func IsVideoFile(data []byte) bool {
 	return strings.Contains(http.DetectContentType(data), "video/")
 }
@@ -14,6 +14,8 @@ import (
 
 	// 导入自定义的链客户端包，用于与区块链节点进行交互
 	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	// 导入 IPFS 网关池，用于按内容寻址获取元数据
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
 	// 导入自定义的 HTTP 客户端包，用于进行 HTTP 请求
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 )
@@ -44,6 +46,8 @@ type Service struct {
 	HttpClient *xhttp.Client
 	// 链客户端，用于与区块链节点进行交互
 	NodeClient chainclient.ChainClient
+	// IPFS 网关池，默认使用公共网关，多条链可以共用一个网关池
+	Ipfs *ipfs.Pool
 	// 链的名称，例如 "Ethereum"、"BSC" 等
 	ChainName string
 	// 节点的名称
@@ -101,12 +105,19 @@ func New(ctx context.Context, endpoint, chainName string, chainID int, nameTags,
 		return nil, errors.Wrap(err, "failed on get contract abi")
 	}
 
+	// 创建默认的 IPFS 网关池，调用方可以替换为按配置创建的网关池
+	ipfsPool, err := ipfs.NewPool(ipfs.Config{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create ipfs pool")
+	}
+
 	// 返回新创建的 Service 实例
 	return &Service{
 		ctx:            ctx,
 		Abi:            abi,
 		HttpClient:     xhttp.NewClient(conf),
 		NodeClient:     nodeClient,
+		Ipfs:           ipfsPool,
 		ChainName:      chainName,
 		NameTags:       nameTags,
 		ImageTags:      imageTags,
@@ -36,6 +36,14 @@ type TransferLog struct {
 	From            string        `json:"topic1"`
 	To              string        `json:"topic2"`
 	TokenID         string        `json:"topic3"`
+	// Amount 转移的数量，ERC-721 固定为 1
+	Amount int64 `json:"amount"`
+	// OverflowAmount ERC-1155 转移的数量超过 int64 范围时为十进制的原始数量，此时 Amount 为 0
+	OverflowAmount string `json:"overflow_amount,omitempty"`
+	// IsERC1155 是否是 ERC-1155 的 TransferSingle / TransferBatch 事件，TransferBatch 按 token 拆分为多条
+	IsERC1155 bool `json:"is_erc1155"`
+	// BatchIndex TransferBatch 拆分出的记录在批次中的序号，与 Index 一起唯一标识一次转移
+	BatchIndex int `json:"batch_index"`
 	TxIndex         uint          `json:"transactionIndex"`
 	Index           uint          `json:"logIndex"`
 	Removed         bool          `json:"removed"`
@@ -45,6 +53,13 @@ type TransferLog struct {
 // 参数 fromBlock 表示起始区块编号，toBlock 表示结束区块编号。
 // 返回值为 TransferLog 结构体指针切片和错误信息。
 func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog, error) {
+	return s.GetNFTTransferEventByAddresses(fromBlock, toBlock, nil)
+}
+
+// GetNFTTransferEventByAddresses 方法用于获取指定区块范围内、指定合约地址的 NFT 转移事件日志。
+// 参数 addresses 为空时不限制合约地址。
+// 返回的日志按区块编号和日志索引排序。
+func (s *Service) GetNFTTransferEventByAddresses(fromBlock, toBlock uint64, addresses []string) ([]*TransferLog, error) {
 	// 获取起始区块的时间戳
 	var startBlockTime uint64
 	var err error
@@ -60,13 +75,12 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		startBlockTime = blockTimestamp
 	}
 
-	// 定义转移事件的主题
-	var transferTopic string
+	// 定义转移事件的主题，同时查询 ERC-721 和 ERC-1155 的转移事件
+	var transferTopics []string
 	// 根据不同的链名称设置转移事件的主题
 	switch s.ChainName {
 	case chain.Eth, chain.Optimism, chain.Sepolia:
-		// 将 EVMTransferTopic 转换为字符串
-		transferTopic = EVMTransferTopic.String()
+		transferTopics = []string{EVMTransferTopic.String(), EVMTransferSingleTopic.String(), EVMTransferBatchTopic.String()}
 	default:
 		// 如果链名称不支持，返回错误信息
 		return nil, errors.Wrap(err, "unsupported chain")
@@ -78,9 +92,11 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		FromBlock: new(big.Int).SetUint64(fromBlock),
 		// 设置结束区块编号
 		ToBlock: new(big.Int).SetUint64(toBlock),
+		// 设置合约地址过滤条件
+		Addresses: addresses,
 		// 设置主题过滤条件
 		Topics: [][]string{
-			{transferTopic},
+			transferTopics,
 		},
 	}
 
@@ -99,6 +115,18 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		var ok bool
 		// 将日志转换为 evmTypes.Log 类型
 		evmLog, ok = log.(evmTypes.Log)
+		if ok && len(evmLog.Topics) > 0 && evmLog.Topics[0] != EVMTransferTopic {
+			// ERC-1155 转移事件，TransferBatch 按 token 拆分为多条
+			erc1155Logs, err := decodeERC1155Transfer(evmLog)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed on decode erc1155 transfer %s:%d", evmLog.TxHash.String(), evmLog.Index)
+			}
+			for _, transferLog := range erc1155Logs {
+				transferLog.BlockTime = startBlockTime + (evmLog.BlockNumber-fromBlock)*uint64(BlockTimeGap[s.ChainName])
+			}
+			transferLogs = append(transferLogs, erc1155Logs...)
+			continue
+		}
 		if ok {
 			var topics [4]string
 			// 将 evmLog 的主题转换为十六进制字符串
@@ -136,6 +164,8 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 				To: common.HexToAddress(topics[2]).String(),
 				// 设置 token ID
 				TokenID: tokenId.String(),
+				// ERC-721 每次转移一个 token
+				Amount: 1,
 				// 设置交易索引
 				TxIndex: evmLog.TxIndex,
 				// 设置日志索引
@@ -149,9 +179,13 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		}
 	}
 
-	// 按区块编号对转移日志进行排序
-	sort.Slice(transferLogs, func(i, j int) bool {
-		return transferLogs[i].BlockNumber < transferLogs[j].BlockNumber
+	// 按区块编号和日志索引对转移日志进行排序，保证同一区块内的转移按发生顺序处理，
+	// TransferBatch 拆分出的多条记录日志索引相同，保持原来的顺序
+	sort.SliceStable(transferLogs, func(i, j int) bool {
+		if transferLogs[i].BlockNumber != transferLogs[j].BlockNumber {
+			return transferLogs[i].BlockNumber < transferLogs[j].BlockNumber
+		}
+		return transferLogs[i].Index < transferLogs[j].Index
 	})
 
 	// 返回转移日志切片和错误信息
@@ -0,0 +1,10 @@
+package types
+
+// Header 描述了区块头中与事件索引相关的字段，
+// 用于在同步过程中校验区块是否仍在主链上（链重组检测）。
+type Header struct {
+	Number     uint64 // 区块号
+	Hash       string // 区块哈希
+	ParentHash string // 父区块哈希
+	Time       uint64 // 区块时间戳（秒）
+}
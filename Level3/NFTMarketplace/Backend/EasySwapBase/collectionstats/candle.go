@@ -0,0 +1,136 @@
+package collectionstats
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// CandleIntervals 支持的 K 线周期(秒)，都能整除一天，每天的第一根 K 线从本地时间 0 点开始
+var CandleIntervals = map[string]int64{
+	"5m":  Bucket5m,
+	"15m": 15 * 60,
+	"30m": 30 * 60,
+	"1h":  Bucket1h,
+	"4h":  4 * Bucket1h,
+	"1d":  Bucket1d,
+}
+
+// Candle 一个周期内成交价格的 OHLC。周期内没有成交时开高低收都等于上一周期的收盘价
+type Candle struct {
+	Time   int64           `json:"time"` // 周期的开始时间(秒)
+	Open   decimal.Decimal `json:"open"`
+	High   decimal.Decimal `json:"high"`
+	Low    decimal.Decimal `json:"low"`
+	Close  decimal.Decimal `json:"close"`
+	Volume decimal.Decimal `json:"volume"`
+	Count  int64           `json:"count"`
+}
+
+// FloorPoint 一个周期结束时的地板价，周期内没有快照时沿用上一周期的地板价
+type FloorPoint struct {
+	Time  int64           `json:"time"` // 周期的开始时间(秒)
+	Price decimal.Decimal `json:"price"`
+}
+
+// CandlePeriods 返回与 [from, to) 相交的 K 线周期的开始时间，周期按 loc 的本地时间对齐，最多返回 limit 个。
+// 周期首尾相连，第 i 个周期为 [starts[i], starts[i+1])，最后一个周期的结束时间为 end；
+// 夏令时切换当天的最后一个周期在本地 0 点截断。more 表示 end 之后到 to 之间还有周期，下一页从 end 开始查询。
+func CandlePeriods(from, to, interval int64, loc *time.Location, limit int) (starts []int64, end int64, more bool) {
+	t := time.Unix(from, 0).In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	for {
+		nextDay := day.AddDate(0, 0, 1)
+		for s := day.Unix(); s < nextDay.Unix(); s += interval {
+			e := min(s+interval, nextDay.Unix())
+			if e <= from {
+				continue
+			}
+			if s >= to {
+				return starts, end, false
+			}
+			if len(starts) == limit {
+				return starts, end, true
+			}
+			starts = append(starts, s)
+			end = e
+		}
+		day = nextDay
+	}
+}
+
+// SourceBucket 返回能够合并成这些周期的最粗的桶粒度，周期边界不在整点时（例如半小时时区）只能使用更细的桶
+func SourceBucket(starts []int64, end int64) int64 {
+	for i := len(Buckets) - 1; i > 0; i-- {
+		bucket := Buckets[i]
+		aligned := end%bucket == 0
+		for _, s := range starts {
+			aligned = aligned && s%bucket == 0
+		}
+		if aligned {
+			return bucket
+		}
+	}
+	return Bucket5m
+}
+
+// FoldCandles 把按 bucket_start 升序排列的桶合并成 K 线，prevClose 为第一个周期之前最近一次成交的价格
+func FoldCandles(starts []int64, end int64, rows []multi.CollectionStats, prevClose decimal.Decimal) []Candle {
+	if len(starts) == 0 {
+		return nil
+	}
+	candles := make([]Candle, len(starts))
+	for i, s := range starts {
+		candles[i].Time = s
+	}
+
+	i := 0
+	for _, row := range rows {
+		if row.SalesCount == 0 || row.BucketStart < starts[0] || row.BucketStart >= end {
+			continue
+		}
+		for i+1 < len(starts) && row.BucketStart >= starts[i+1] {
+			i++
+		}
+		c := &candles[i]
+		if c.Count == 0 {
+			c.Open, c.High, c.Low = row.OpenPrice, row.MaxPrice, row.MinPrice
+		}
+		c.High = decimal.Max(c.High, row.MaxPrice)
+		c.Low = decimal.Min(c.Low, row.MinPrice)
+		c.Close = row.ClosePrice
+		c.Volume = c.Volume.Add(row.Volume)
+		c.Count += row.SalesCount
+	}
+
+	// 没有成交的周期沿用上一周期的收盘价
+	for i := range candles {
+		if candles[i].Count == 0 {
+			candles[i].Open, candles[i].High, candles[i].Low, candles[i].Close = prevClose, prevClose, prevClose, prevClose
+		}
+		prevClose = candles[i].Close
+	}
+	return candles
+}
+
+// FoldFloors 取每个周期内最后一次地板价快照作为该周期的地板价，points 按时间升序排列，
+// prevFloor 为第一个周期之前最近一次快照的地板价
+func FoldFloors(starts []int64, end int64, points []FloorPoint, prevFloor decimal.Decimal) []FloorPoint {
+	floors := make([]FloorPoint, len(starts))
+	j := 0
+	for i, s := range starts {
+		e := end
+		if i+1 < len(starts) {
+			e = starts[i+1]
+		}
+		for ; j < len(points) && points[j].Time < e; j++ {
+			if points[j].Time >= s {
+				prevFloor = points[j].Price
+			}
+		}
+		floors[i] = FloorPoint{Time: s, Price: prevFloor}
+	}
+	return floors
+}
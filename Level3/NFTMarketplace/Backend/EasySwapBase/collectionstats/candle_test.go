@@ -0,0 +1,88 @@
+package collectionstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestCandlePeriods(t *testing.T) {
+	day := int64(1704153600) // 2024-01-02 00:00:00 UTC
+
+	// from 所在的周期也会返回，超过 limit 时 more 为 true，下一页从 end 开始
+	starts, end, more := CandlePeriods(day+100, day+4*Bucket1h, Bucket1h, time.UTC, 2)
+	assert.Equal(t, []int64{day, day + Bucket1h}, starts)
+	assert.Equal(t, day+2*Bucket1h, end)
+	assert.True(t, more)
+
+	starts, end, more = CandlePeriods(end, day+4*Bucket1h, Bucket1h, time.UTC, 2)
+	assert.Equal(t, []int64{day + 2*Bucket1h, day + 3*Bucket1h}, starts)
+	assert.Equal(t, day+4*Bucket1h, end)
+	assert.False(t, more)
+
+	// 日线按本地 0 点对齐
+	shanghai := time.FixedZone("UTC+8", 8*3600)
+	starts, _, _ = CandlePeriods(day, day+2*Bucket1d, Bucket1d, shanghai, 10)
+	assert.Equal(t, []int64{day - 8*Bucket1h, day + 16*Bucket1h, day + 40*Bucket1h}, starts)
+	assert.Equal(t, Bucket1h, SourceBucket(starts, day+64*Bucket1h))
+
+	// 半小时时区只能使用 5m 桶
+	india := time.FixedZone("UTC+5:30", 5*3600+1800)
+	starts, end, _ = CandlePeriods(day, day+Bucket1d, Bucket1d, india, 10)
+	assert.Equal(t, Bucket5m, SourceBucket(starts, end))
+	assert.Equal(t, Bucket1d, SourceBucket([]int64{day}, day+Bucket1d))
+
+	// 夏令时开始当天只有 23 个小时，最后一个 4h 周期在本地 0 点截断
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	dst := time.Date(2024, 3, 10, 0, 0, 0, 0, ny).Unix()
+	starts, end, _ = CandlePeriods(dst, dst+23*Bucket1h, 4*Bucket1h, ny, 10)
+	assert.Len(t, starts, 6)
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, ny).Unix(), end)
+}
+
+func TestFoldCandles(t *testing.T) {
+	d := decimal.RequireFromString
+	starts := []int64{0, 3600, 7200}
+	rows := []multi.CollectionStats{
+		{BucketStart: 0, SalesCount: 1, Volume: d("2"), MinPrice: d("2"), MaxPrice: d("2"), OpenPrice: d("2"), ClosePrice: d("2")},
+		{BucketStart: 600, SalesCount: 2, Volume: d("9"), MinPrice: d("4"), MaxPrice: d("5"), OpenPrice: d("5"), ClosePrice: d("4")},
+		{BucketStart: 7500, SalesCount: 1, Volume: d("1"), MinPrice: d("1"), MaxPrice: d("1"), OpenPrice: d("1"), ClosePrice: d("1")},
+	}
+	candles := FoldCandles(starts, 10800, rows, d("3"))
+	assert.Len(t, candles, 3)
+
+	c := candles[0]
+	assert.True(t, c.Open.Equal(d("2")) && c.High.Equal(d("5")) && c.Low.Equal(d("2")) && c.Close.Equal(d("4")))
+	assert.True(t, c.Volume.Equal(d("11")))
+	assert.Equal(t, int64(3), c.Count)
+
+	// 没有成交的周期使用上一周期的收盘价
+	c = candles[1]
+	assert.Equal(t, int64(3600), c.Time)
+	assert.True(t, c.Open.Equal(d("4")) && c.High.Equal(d("4")) && c.Low.Equal(d("4")) && c.Close.Equal(d("4")))
+	assert.True(t, c.Volume.IsZero())
+
+	assert.True(t, candles[2].Close.Equal(d("1")))
+	assert.Nil(t, FoldCandles(nil, 0, rows, d("3")))
+}
+
+func TestFoldFloors(t *testing.T) {
+	d := decimal.RequireFromString
+	floors := FoldFloors([]int64{0, 3600, 7200}, 10800, []FloorPoint{
+		{Time: 300, Price: d("2")},
+		{Time: 3000, Price: d("3")},
+		{Time: 7200, Price: d("5")},
+	}, d("1"))
+	assert.Equal(t, []FloorPoint{
+		{Time: 0, Price: d("3")},
+		{Time: 3600, Price: d("3")},
+		{Time: 7200, Price: d("5")},
+	}, floors)
+}
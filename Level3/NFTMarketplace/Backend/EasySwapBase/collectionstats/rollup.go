@@ -0,0 +1,276 @@
+package collectionstats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/zeromicro/go-zero/core/threading"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	// rollupInterval 汇总的间隔
+	rollupInterval = time.Minute
+	// rollupLookback 每次至少重新汇总最近这段时间内的桶，覆盖链重组撤销的成交
+	rollupLookback int64 = 3600
+	// statsBatchSize 每条 insert 语句写入的行数
+	statsBatchSize = 500
+
+	cacheRollupCursorPre = "cache:es:%s:stats:rollup:cursor"
+)
+
+// GenRollupCursorKey 已汇总的最大活动 ID 的缓存键，ID 更大的成交记录需要重新汇总所在的桶
+func GenRollupCursorKey(chain string) string {
+	return fmt.Sprintf(cacheRollupCursorPre, strings.ToLower(chain))
+}
+
+// Rollup 定时把成交记录汇总到集合统计表，并在地板价变化时写入地板价快照。
+// 每次从活动表重新计算受影响的桶，重复执行是幂等的：
+// 新增的成交（包括回溯同步写入的历史成交）按活动 ID 游标找到最早的成交时间，最近 rollupLookback 内的桶每次都重新计算。
+type Rollup struct {
+	ctx     context.Context
+	db      *gorm.DB
+	kv      *xkv.Store
+	chain   string
+	project string
+}
+
+func New(ctx context.Context, db *gorm.DB, kv *xkv.Store, chain, project string) *Rollup {
+	return &Rollup{
+		ctx:     ctx,
+		db:      db,
+		kv:      kv,
+		chain:   chain,
+		project: project,
+	}
+}
+
+func (r *Rollup) Start() {
+	threading.GoSafe(r.loop)
+}
+
+func (r *Rollup) loop() {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.RunOnce(time.Now().Unix()); err != nil {
+			xzap.WithContext(r.ctx).Error("failed on rollup collection stats",
+				zap.String("chain", r.chain), zap.Error(err))
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 汇总截止到 now 的成交记录，并记录当前的地板价快照
+func (r *Rollup) RunOnce(now int64) error {
+	cursor, err := r.kv.GetInt64(GenRollupCursorKey(r.chain))
+	if err != nil {
+		return errors.Wrap(err, "failed on get rollup cursor")
+	}
+
+	// 游标之后新写入的成交中最早的成交时间，游标为 0 时重新汇总全部历史成交
+	var dirty struct {
+		MinEventTime int64
+		MaxId        int64
+	}
+	if err := r.db.WithContext(r.ctx).Table(gdb.GetMultiProjectActivityTableName(r.project, r.chain)).
+		Select("COALESCE(MIN(event_time), 0) as min_event_time, COALESCE(MAX(id), 0) as max_id").
+		Where("activity_type = ? and id > ?", multi.Sale, cursor).
+		Scan(&dirty).Error; err != nil {
+		return errors.Wrap(err, "failed on query new sales")
+	}
+
+	from := now - rollupLookback
+	if dirty.MaxId > 0 && dirty.MinEventTime < from {
+		from = dirty.MinEventTime
+	}
+	for _, bucket := range Buckets {
+		if err := r.rollupBuckets(bucket, BucketStart(from, bucket), BucketStart(now, bucket)+bucket); err != nil {
+			return err
+		}
+	}
+	floorChanged, err := r.snapshotFloor(now)
+	if err != nil {
+		return err
+	}
+
+	if dirty.MaxId > cursor {
+		if err := r.invalidate(cursor, dirty.MaxId); err != nil {
+			xzap.WithContext(r.ctx).Error("failed on invalidate api cache", zap.String("chain", r.chain), zap.Error(err))
+		}
+		if err := r.kv.SetInt64(GenRollupCursorKey(r.chain), dirty.MaxId); err != nil {
+			return errors.Wrap(err, "failed on save rollup cursor")
+		}
+	} else if floorChanged {
+		if err := apicache.Publish(r.kv, apicache.RankingTag(r.chain)); err != nil {
+			xzap.WithContext(r.ctx).Error("failed on invalidate api cache", zap.String("chain", r.chain), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// invalidate 汇总了 (cursor, maxId] 内的新成交后，使排行和有新成交的集合的 API 缓存失效
+func (r *Rollup) invalidate(cursor, maxId int64) error {
+	var collections []string
+	if err := r.db.WithContext(r.ctx).Table(gdb.GetMultiProjectActivityTableName(r.project, r.chain)).
+		Select("DISTINCT LOWER(collection_address)").
+		Where("activity_type = ? and id > ? and id <= ?", multi.Sale, cursor, maxId).
+		Scan(&collections).Error; err != nil {
+		return errors.Wrap(err, "failed on query collections of new sales")
+	}
+
+	tags := []string{apicache.RankingTag(r.chain)}
+	for _, collectionAddr := range collections {
+		tags = append(tags, apicache.CollectionTag(r.chain, collectionAddr))
+	}
+	return apicache.Publish(r.kv, tags...)
+}
+
+// aggregateSales 从活动表汇总 [start, end) 内的成交到粒度为 bucket 的桶。
+// 开盘价和收盘价为桶内 (event_time, id) 最小和最大的成交的价格：先按成交时间找到桶内最早和最晚的成交时间，
+// 同一时间有多笔成交时取 id 最小和最大的一笔。
+func (r *Rollup) aggregateSales(bucket, start, end int64) ([]multi.CollectionStats, error) {
+	// sales 同一集合、同一成交时间的第一笔和最后一笔成交
+	sales := `(SELECT LOWER(collection_address) as collection_address, event_time, MIN(id) as first_id, MAX(id) as last_id
+      FROM %[1]s
+      WHERE activity_type = ? and event_time >= ? and event_time < ?
+      GROUP BY LOWER(collection_address), event_time)`
+	var rows []multi.CollectionStats
+	if err := r.db.WithContext(r.ctx).Raw(fmt.Sprintf(`SELECT g.collection_address, g.bucket_start, g.sales_count, g.volume,
+       g.min_price, g.max_price, o.price as open_price, c.price as close_price
+FROM (SELECT LOWER(collection_address) as collection_address,
+             event_time - event_time %% ? as bucket_start,
+             COUNT(*) as sales_count, COALESCE(SUM(price), 0) as volume,
+             MIN(price) as min_price, MAX(price) as max_price,
+             MIN(event_time) as first_time, MAX(event_time) as last_time
+      FROM %[1]s
+      WHERE activity_type = ? and event_time >= ? and event_time < ?
+      GROUP BY LOWER(collection_address), bucket_start) g
+         join `+sales+` f on f.collection_address = g.collection_address and f.event_time = g.first_time
+         join `+sales+` l on l.collection_address = g.collection_address and l.event_time = g.last_time
+         join %[1]s o on o.id = f.first_id
+         join %[1]s c on c.id = l.last_id`, gdb.GetMultiProjectActivityTableName(r.project, r.chain)),
+		bucket, multi.Sale, start, end, multi.Sale, start, end, multi.Sale, start, end).Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on aggregate sales")
+	}
+	return rows, nil
+}
+
+// rollupBuckets 从活动表重新计算 [start, end) 内粒度为 bucket 的桶。
+// 先清空范围内已有桶的成交统计（成交可能因链重组被撤销），再写入重新计算的结果，地板价快照保持不变。
+func (r *Rollup) rollupBuckets(bucket, start, end int64) error {
+	rows, err := r.aggregateSales(bucket, start, end)
+	if err != nil {
+		return err
+	}
+
+	table := gdb.GetMultiProjectCollectionStatsTableName(r.project, r.chain)
+	return r.db.WithContext(r.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET sales_count = 0, volume = 0, min_price = 0, max_price = 0,
+    open_price = 0, close_price = 0
+WHERE bucket = ? and bucket_start >= ? and bucket_start < ? and sales_count > 0`, table),
+			bucket, start, end).Error; err != nil {
+			return errors.Wrap(err, "failed on reset collection stats")
+		}
+
+		nowMilli := time.Now().UnixMilli()
+		for i := 0; i < len(rows); i += statsBatchSize {
+			batch := rows[i:min(i+statsBatchSize, len(rows))]
+			valueStrings := make([]string, 0, len(batch))
+			valueArgs := make([]interface{}, 0, len(batch)*11)
+			for _, row := range batch {
+				valueStrings = append(valueStrings, "(?,?,?,?,?,?,?,?,?,?,?)")
+				valueArgs = append(valueArgs, row.CollectionAddress, bucket, row.BucketStart, row.SalesCount, row.Volume,
+					row.MinPrice, row.MaxPrice, row.OpenPrice, row.ClosePrice, nowMilli, nowMilli)
+			}
+			stmt := fmt.Sprintf(`INSERT INTO %s (collection_address,bucket,bucket_start,sales_count,volume,min_price,max_price,
+    open_price,close_price,create_time,update_time) VALUES %s
+ON DUPLICATE KEY UPDATE sales_count=VALUES(sales_count),volume=VALUES(volume),min_price=VALUES(min_price),
+    max_price=VALUES(max_price),open_price=VALUES(open_price),close_price=VALUES(close_price),
+    update_time=VALUES(update_time)`, table, strings.Join(valueStrings, ","))
+			if err := tx.Exec(stmt, valueArgs...).Error; err != nil {
+				return errors.Wrap(err, "failed on save collection stats")
+			}
+		}
+		return nil
+	})
+}
+
+// floorSnapshot 集合的地板价
+type floorSnapshot struct {
+	CollectionAddress string          `gorm:"column:collection_address"`
+	FloorPrice        decimal.Decimal `gorm:"column:floor_price"`
+}
+
+// snapshotFloor 地板价与最近一次快照不同时，把当前地板价写入 now 所在的 5m 桶，返回是否有集合的地板价发生变化
+func (r *Rollup) snapshotFloor(now int64) (bool, error) {
+	var current []floorSnapshot
+	if err := r.db.WithContext(r.ctx).Table(gdb.GetMultiProjectCollectionTableName(r.project, r.chain)).
+		Select("LOWER(address) as collection_address, floor_price").
+		Scan(&current).Error; err != nil {
+		return false, errors.Wrap(err, "failed on query collection floor price")
+	}
+
+	table := gdb.GetMultiProjectCollectionStatsTableName(r.project, r.chain)
+	var latest []floorSnapshot
+	if err := r.db.WithContext(r.ctx).Raw(fmt.Sprintf(`SELECT s.collection_address, s.floor_price
+FROM %s s
+         join (SELECT collection_address, MAX(floor_time) as floor_time FROM %s WHERE floor_time > 0
+               GROUP BY collection_address) l
+              on s.collection_address = l.collection_address and s.floor_time = l.floor_time`, table, table)).
+		Scan(&latest).Error; err != nil {
+		return false, errors.Wrap(err, "failed on query latest floor snapshot")
+	}
+
+	changed := changedFloors(current, latest)
+	nowMilli := time.Now().UnixMilli()
+	bucketStart := BucketStart(now, Bucket5m)
+	for i := 0; i < len(changed); i += statsBatchSize {
+		batch := changed[i:min(i+statsBatchSize, len(changed))]
+		valueStrings := make([]string, 0, len(batch))
+		valueArgs := make([]interface{}, 0, len(batch)*7)
+		for _, floor := range batch {
+			valueStrings = append(valueStrings, "(?,?,?,?,?,?,?)")
+			valueArgs = append(valueArgs, floor.CollectionAddress, Bucket5m, bucketStart, floor.FloorPrice, now, nowMilli, nowMilli)
+		}
+		stmt := fmt.Sprintf(`INSERT INTO %s (collection_address,bucket,bucket_start,floor_price,floor_time,create_time,update_time)
+VALUES %s
+ON DUPLICATE KEY UPDATE floor_price=VALUES(floor_price),floor_time=VALUES(floor_time),update_time=VALUES(update_time)`,
+			table, strings.Join(valueStrings, ","))
+		if err := r.db.WithContext(r.ctx).Exec(stmt, valueArgs...).Error; err != nil {
+			return false, errors.Wrap(err, "failed on save floor snapshot")
+		}
+	}
+	return len(changed) > 0, nil
+}
+
+// changedFloors 返回没有快照或者与最近一次快照不同的地板价
+func changedFloors(current, latest []floorSnapshot) []floorSnapshot {
+	snapshots := make(map[string]decimal.Decimal, len(latest))
+	for _, s := range latest {
+		snapshots[strings.ToLower(s.CollectionAddress)] = s.FloorPrice
+	}
+	var changed []floorSnapshot
+	for _, c := range current {
+		if price, ok := snapshots[strings.ToLower(c.CollectionAddress)]; ok && price.Equal(c.FloorPrice) {
+			continue
+		}
+		changed = append(changed, c)
+	}
+	return changed
+}
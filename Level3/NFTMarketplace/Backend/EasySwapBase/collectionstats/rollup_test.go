@@ -0,0 +1,76 @@
+package collectionstats
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+)
+
+func TestChangedFloors(t *testing.T) {
+	current := []floorSnapshot{
+		{CollectionAddress: "0xa", FloorPrice: decimal.RequireFromString("1.50")},
+		{CollectionAddress: "0xb", FloorPrice: decimal.RequireFromString("2")},
+		{CollectionAddress: "0xc", FloorPrice: decimal.RequireFromString("3")},
+	}
+	latest := []floorSnapshot{
+		// 数值相同只是精度不同，不需要新的快照
+		{CollectionAddress: "0xA", FloorPrice: decimal.RequireFromString("1.5")},
+		{CollectionAddress: "0xb", FloorPrice: decimal.RequireFromString("2.5")},
+	}
+	assert.Equal(t, []floorSnapshot{current[1], current[2]}, changedFloors(current, latest))
+	assert.Empty(t, changedFloors(current[:1], latest))
+}
+
+func TestAggregateSales(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	table := gdb.GetMultiProjectActivityTableName(gdb.OrderBookDexProject, "sepolia")
+	for _, stmt := range []string{
+		"create table " + table + " (id integer primary key, activity_type tinyint, collection_address varchar(42), " +
+			"event_time bigint, price decimal(30))",
+		// 0xa 的第一个桶内最早和最晚的时间都有两笔成交，开盘价取 id 较小的一笔，收盘价取 id 较大的一笔；
+		// 成交按 id 的顺序与成交时间的顺序不一致
+		"insert into " + table + " values (1, 7, '0xA', 60, 30), (2, 7, '0xa', 60, 10), (3, 7, '0xa', 120, 20), " +
+			"(4, 7, '0xa', 200, 50), (5, 7, '0xa', 200, 40), (6, 7, '0xa', 100, 100)",
+		// 第二个桶和其他集合，以及不是成交的活动
+		"insert into " + table + " values (7, 7, '0xa', 400, 70), (8, 7, '0xb', 10, 5), (9, 1, '0xa', 30, 1)",
+	} {
+		require.NoError(t, db.Exec(stmt).Error)
+	}
+
+	r := New(context.Background(), db, nil, "sepolia", gdb.OrderBookDexProject)
+	rows, err := r.aggregateSales(Bucket5m, 0, 600)
+	require.NoError(t, err)
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].CollectionAddress != rows[j].CollectionAddress {
+			return rows[i].CollectionAddress < rows[j].CollectionAddress
+		}
+		return rows[i].BucketStart < rows[j].BucketStart
+	})
+
+	type bucketStats struct {
+		collection    string
+		start, count  int64
+		volume        string
+		minP, maxP    string
+		openP, closeP string
+	}
+	var got []bucketStats
+	for _, row := range rows {
+		got = append(got, bucketStats{row.CollectionAddress, row.BucketStart, row.SalesCount, row.Volume.String(),
+			row.MinPrice.String(), row.MaxPrice.String(), row.OpenPrice.String(), row.ClosePrice.String()})
+	}
+	assert.Equal(t, []bucketStats{
+		{"0xa", 0, 6, "250", "10", "100", "30", "40"},
+		{"0xa", 300, 1, "70", "70", "70", "70", "70"},
+		{"0xb", 0, 1, "5", "5", "5", "5", "5"},
+	}, got)
+}
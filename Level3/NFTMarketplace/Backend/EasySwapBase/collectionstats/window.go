@@ -0,0 +1,74 @@
+// Package collectionstats 集合成交统计的时间桶汇总：同步服务用 Rollup 维护 5m / 1h / 1d 三种粒度的桶，
+// 查询时用 Window 和 Segments 把一个时间窗口拆成尽量粗的桶，对桶求和得到窗口内的统计；
+// K 线用 CandlePeriods 按本地时间划分周期，再用 FoldCandles 合并周期内的桶。
+package collectionstats
+
+import (
+	"github.com/pkg/errors"
+)
+
+// 桶的粒度(秒)，按 UTC 对齐
+const (
+	Bucket5m int64 = 300
+	Bucket1h int64 = 3600
+	Bucket1d int64 = 86400
+)
+
+// Buckets 所有粒度，从细到粗
+var Buckets = []int64{Bucket5m, Bucket1h, Bucket1d}
+
+// PeriodSeconds 查询支持的时间窗口长度
+var PeriodSeconds = map[string]int64{
+	"15m": 15 * 60,
+	"1h":  Bucket1h,
+	"6h":  6 * Bucket1h,
+	"24h": Bucket1d,
+	"1d":  Bucket1d,
+	"7d":  7 * Bucket1d,
+	"30d": 30 * Bucket1d,
+}
+
+// Segment 同一粒度下连续的一段桶，覆盖 [Start, End)
+type Segment struct {
+	Bucket int64
+	Start  int64
+	End    int64
+}
+
+// BucketStart 返回时间 t 所在桶的开始时间
+func BucketStart(t, bucket int64) int64 {
+	return t - t%bucket
+}
+
+// Window 返回截止到 now 的时间窗口 [start, end)。
+// end 为 now 所在 5m 桶的结束时间，包含当前未结束的桶，窗口的精度为 5 分钟。
+func Window(period string, now int64) (int64, int64, error) {
+	length, ok := PeriodSeconds[period]
+	if !ok {
+		return 0, 0, errors.Errorf("invalid period: %s", period)
+	}
+	end := BucketStart(now, Bucket5m) + Bucket5m
+	return end - length, end, nil
+}
+
+// Segments 把 [start, end) 拆成尽量粗的桶：两端用细粒度的桶补齐到粗粒度的边界，中间使用粗粒度的桶。
+// start 和 end 必须按 5m 对齐。
+func Segments(start, end int64) []Segment {
+	var segments []Segment
+	for t := start; t < end; {
+		bucket := Bucket5m
+		for _, b := range Buckets {
+			if t%b == 0 && t+b <= end {
+				bucket = b
+			}
+		}
+		// 与上一段粒度相同且相连时合并
+		if n := len(segments); n > 0 && segments[n-1].Bucket == bucket && segments[n-1].End == t {
+			segments[n-1].End = t + bucket
+		} else {
+			segments = append(segments, Segment{Bucket: bucket, Start: t, End: t + bucket})
+		}
+		t += bucket
+	}
+	return segments
+}
@@ -0,0 +1,60 @@
+package collectionstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow(t *testing.T) {
+	// 2024-01-02 10:07:30 UTC
+	now := int64(1704190050)
+	start, end, err := Window("1d", now)
+	assert.NoError(t, err)
+	// 包含当前未结束的 5m 桶
+	assert.Equal(t, int64(1704190200), end)
+	assert.Equal(t, end-Bucket1d, start)
+
+	start, end, err = Window("15m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(900), end-start)
+
+	_, _, err = Window("2h", now)
+	assert.Error(t, err)
+}
+
+func TestSegments(t *testing.T) {
+	day := int64(1704153600) // 2024-01-02 00:00:00 UTC
+
+	// 前一天 10:10 ~ 当天 10:10：5m 补齐到 11:00，中间不足一天只能使用 1h，最后用 5m 补齐到结束
+	start, end := day-Bucket1d+10*Bucket1h+10*60, day+10*Bucket1h+10*60
+	segments := Segments(start, end)
+	// 同一粒度的相邻段会合并
+	assert.Equal(t, []Segment{
+		{Bucket: Bucket5m, Start: start, End: day - Bucket1d + 11*Bucket1h},
+		{Bucket: Bucket1h, Start: day - Bucket1d + 11*Bucket1h, End: day + 10*Bucket1h},
+		{Bucket: Bucket5m, Start: day + 10*Bucket1h, End: end},
+	}, segments)
+
+	// 7 天窗口中间使用 1d 桶
+	segments = Segments(day-7*Bucket1d+Bucket1h, day+Bucket1h)
+	assert.Equal(t, []Segment{
+		{Bucket: Bucket1h, Start: day - 7*Bucket1d + Bucket1h, End: day - 6*Bucket1d},
+		{Bucket: Bucket1d, Start: day - 6*Bucket1d, End: day},
+		{Bucket: Bucket1h, Start: day, End: day + Bucket1h},
+	}, segments)
+
+	// 各段首尾相连并且覆盖整个窗口
+	for _, window := range [][2]int64{{day + 300, day + 900}, {day - 30*Bucket1d + 3300, day + 3300}} {
+		segments := Segments(window[0], window[1])
+		next := window[0]
+		for _, s := range segments {
+			assert.Equal(t, next, s.Start)
+			assert.Zero(t, s.Start%s.Bucket)
+			assert.Zero(t, (s.End-s.Start)%s.Bucket)
+			next = s.End
+		}
+		assert.Equal(t, window[1], next)
+	}
+	assert.Empty(t, Segments(day, day))
+}
@@ -50,6 +50,7 @@ var (
 	ErrInvalidParams    = NewErr(10002, "Parameter is illegal")
 	ErrTokenVerify      = NewErr(10003, "Token check error", http.StatusUnauthorized)
 	ErrTokenExpire      = NewErr(10004, "Expired token", http.StatusUnauthorized)
+	ErrPermissionDenied = NewErr(10005, "Permission denied", http.StatusForbidden)
 )
 
 var codeToErr = map[uint32]*Err{
@@ -60,6 +61,7 @@ var codeToErr = map[uint32]*Err{
 	10002: ErrInvalidParams,
 	10003: ErrTokenVerify,
 	10004: ErrTokenExpire,
+	10005: ErrPermissionDenied,
 }
 
 // NewErr 创建新的业务错误
@@ -0,0 +1,46 @@
+// Package image 把NFT的图片和视频转存到对象存储，并生成缩略图。
+package image
+
+const (
+	// StoreLocal 保存到本地目录
+	StoreLocal = "local"
+	// StoreS3 保存到 S3 兼容的对象存储（AWS S3、MinIO、OSS 等）
+	StoreS3 = "s3"
+
+	defaultTimeout       = 40
+	defaultMaxFileSize   = 50 << 20
+	defaultThumbnailSize = 256
+)
+
+// Config 图片转存配置
+type Config struct {
+	// ValidFileType 允许转存的文件后缀，地址中没有后缀时按文件内容判断
+	ValidFileType []string `toml:"valid_file_type" mapstructure:"valid_file_type" json:"valid_file_type"`
+	// TimeOut 下载单个文件的超时时间（秒）
+	TimeOut int `toml:"time_out" mapstructure:"time_out" json:"time_out"`
+	// DefaultOssUri 对象存储的访问地址，未单独配置 Store.BaseURL 时使用
+	DefaultOssUri string `toml:"default_oss_uri" mapstructure:"default_oss_uri" json:"default_oss_uri"`
+	// MaxFileSize 允许转存的最大文件大小（字节）
+	MaxFileSize int64 `toml:"max_file_size" mapstructure:"max_file_size" json:"max_file_size"`
+	// ThumbnailSize 缩略图最长边的像素
+	ThumbnailSize int `toml:"thumbnail_size" mapstructure:"thumbnail_size" json:"thumbnail_size"`
+	// Store 对象存储配置
+	Store StoreConfig `toml:"store" mapstructure:"store" json:"store"`
+}
+
+// StoreConfig 对象存储配置，Type 为 local 或 s3
+type StoreConfig struct {
+	Type string `toml:"type" mapstructure:"type" json:"type"`
+	// BaseURL 文件的访问地址前缀
+	BaseURL string `toml:"base_url" mapstructure:"base_url" json:"base_url"`
+	// Dir 本地存储的目录
+	Dir string `toml:"dir" mapstructure:"dir" json:"dir"`
+	// Endpoint S3 服务地址，例如 https://s3.us-east-1.amazonaws.com
+	Endpoint  string `toml:"endpoint" mapstructure:"endpoint" json:"endpoint"`
+	Region    string `toml:"region" mapstructure:"region" json:"region"`
+	Bucket    string `toml:"bucket" mapstructure:"bucket" json:"bucket"`
+	AccessKey string `toml:"access_key" mapstructure:"access_key" json:"access_key"`
+	SecretKey string `toml:"secret_key" mapstructure:"secret_key" json:"-"`
+	// PathStyle 使用 endpoint/bucket/key 形式的地址，MinIO 等自建服务通常需要开启
+	PathStyle bool `toml:"path_style" mapstructure:"path_style" json:"path_style"`
+}
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
+)
+
+// Source 文件的来源
+type Source int
+
+const (
+	SourceHttp Source = iota + 1
+	SourceIpfs
+	SourceBase64
+)
+
+var (
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	ErrFileTooLarge     = errors.New("file too large")
+)
+
+// Media 下载的文件
+type Media struct {
+	Data        []byte
+	ContentType string
+	Source      Source
+}
+
+// IsImage 文件是否为图片
+func (m *Media) IsImage() bool {
+	return strings.HasPrefix(m.ContentType, "image/")
+}
+
+// IsVideo 文件是否为视频
+func (m *Media) IsVideo() bool {
+	return strings.HasPrefix(m.ContentType, "video/")
+}
+
+// Fetch 下载 http(s)://、ipfs:// 或 data: 地址的文件，按文件内容判断类型，不是图片或视频时返回 ErrUnsupportedMedia
+func (m *Manager) Fetch(ctx context.Context, uri string) (*Media, error) {
+	var media *Media
+	var err error
+	switch {
+	case strings.HasPrefix(uri, "data:"):
+		media, err = decodeDataURI(uri)
+	case strings.HasPrefix(uri, "ipfs://"):
+		media, err = m.fetchIpfs(ctx, uri)
+	case strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://"):
+		media, err = m.fetchHttp(ctx, uri)
+		if media != nil {
+			media.Source = SourceHttp
+		}
+	default:
+		return nil, errors.Errorf("invalid media uri %s", uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(media.Data)) > m.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	media.ContentType = sniffContentType(media.Data, media.ContentType)
+	if media.ContentType == "" {
+		return nil, ErrUnsupportedMedia
+	}
+	return media, nil
+}
+
+// fetchIpfs 通过网关池获取文件，所有数据块都经过 CID 校验
+func (m *Manager) fetchIpfs(ctx context.Context, uri string) (*Media, error) {
+	data, err := m.ipfs.Fetch(ctx, uri)
+	if errors.Is(err, ipfs.ErrFileTooLarge) {
+		return nil, ErrFileTooLarge
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on fetch ipfs file")
+	}
+	return &Media{Data: data, Source: SourceIpfs}, nil
+}
+
+func (m *Manager) fetchHttp(ctx context.Context, uri string) (*Media, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create media request")
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on fetch media")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed on fetch media, status: %d", resp.StatusCode)
+	}
+
+	// 多读一个字节用于判断是否超过大小限制
+	data, err := io.ReadAll(io.LimitReader(resp.Body, m.maxFileSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on read media")
+	}
+	if int64(len(data)) > m.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+	return &Media{Data: data, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// decodeDataURI 解析 data:[<mediatype>][;base64],<data> 格式的地址
+func decodeDataURI(uri string) (*Media, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, errors.New("invalid data uri")
+	}
+
+	var data []byte
+	var err error
+	if strings.HasSuffix(header, ";base64") {
+		header = strings.TrimSuffix(header, ";base64")
+		data, err = base64.StdEncoding.DecodeString(payload)
+	} else {
+		var s string
+		s, err = url.PathUnescape(payload)
+		data = []byte(s)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on decode data uri")
+	}
+	return &Media{Data: data, ContentType: header, Source: SourceBase64}, nil
+}
+
+// sniffContentType 按文件内容判断类型，无法识别的 SVG 使用声明的类型（IPFS 文件没有声明的类型），不是图片或视频时返回空
+func sniffContentType(data []byte, declared string) string {
+	if nftchainservice.IsImageFile(data) || nftchainservice.IsVideoFile(data) {
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+		return contentType
+	}
+	declared, _, _ = mime.ParseMediaType(declared)
+	if (declared == "image/svg+xml" || declared == "") && bytes.Contains(data, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	data, err := Thumbnail(testPNG(t, 800, 400), 200)
+	assert.Nil(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, img.Bounds().Dx())
+	assert.Equal(t, 100, img.Bounds().Dy())
+	r, g, _, _ := img.At(50, 50).RGBA()
+	assert.True(t, r>>8 > 0xf0 && g>>8 < 0x10)
+
+	_, err = Thumbnail([]byte("<svg></svg>"), 200)
+	assert.NotNil(t, err)
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "https://cdn.example.com/")
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.Put(context.Background(), "sepolia/0xabc/1/image", []byte("data"), "image/png"))
+	data, err := os.ReadFile(filepath.Join(dir, "sepolia", "0xabc", "1", "image"))
+	assert.Nil(t, err)
+	assert.Equal(t, "data", string(data))
+	assert.Equal(t, "https://cdn.example.com/sepolia/0xabc/1/image", store.URL("sepolia/0xabc/1/image"))
+
+	assert.NotNil(t, store.Put(context.Background(), "../escape", []byte("data"), "image/png"))
+}
+
+func TestS3StorePut(t *testing.T) {
+	var gotPath, gotAuth, gotType string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth, gotType = r.URL.EscapedPath(), r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	store, err := NewS3Store(StoreConfig{Endpoint: server.URL, Bucket: "nft", AccessKey: "AKID", SecretKey: "secret", PathStyle: true})
+	assert.Nil(t, err)
+	store.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	assert.Nil(t, store.Put(context.Background(), "sepolia/0xabc/1 2/image", []byte("data"), "image/png"))
+	assert.Equal(t, "/nft/sepolia/0xabc/1%202/image", gotPath)
+	assert.Equal(t, "image/png", gotType)
+	assert.Equal(t, "data", string(gotBody))
+	assert.True(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-east-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="))
+	assert.Equal(t, server.URL+"/nft/a", store.URL("a"))
+}
+
+// rawCID 返回数据作为 raw 数据块的 CIDv1
+func rawCID(data []byte) ipfs.CID {
+	sum := sha256.Sum256(data)
+	return ipfs.CID{Version: 1, Codec: ipfs.CodecRaw, Multihash: append([]byte{0x12, 32}, sum[:]...)}
+}
+
+func TestManagerMirror(t *testing.T) {
+	pngData := testPNG(t, 512, 512)
+	svgData := []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+	pngCID, svgCID := rawCID(pngData), rawCID(svgData)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipfs/" + pngCID.String():
+			_, _ = w.Write(pngData)
+		case "/ipfs/" + svgCID.String():
+			_, _ = w.Write(svgData)
+		case "/video.mp4":
+			_, _ = w.Write(append([]byte{0, 0, 0, 0x18, 'f', 't', 'y', 'p', 'm', 'p', '4', '2'}, make([]byte, 64)...))
+		case "/doc.json":
+			_, _ = w.Write([]byte(`{"name":"x"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "https://cdn.example.com")
+	assert.Nil(t, err)
+	pool, err := ipfs.NewPool(ipfs.Config{Gateways: []string{server.URL + "/missing/", server.URL + "/ipfs/"}})
+	assert.Nil(t, err)
+	m := NewManagerWithStore(&Config{
+		ValidFileType: []string{".png", ".mp4", ".json"},
+		ThumbnailSize: 64,
+	}, store, pool)
+
+	result, err := m.Mirror(context.Background(), ObjectDir("sepolia", "0xABC", "1"), "ipfs://"+pngCID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, SourceIpfs, result.Source)
+	assert.Equal(t, "image/png", result.ContentType)
+	assert.Equal(t, "https://cdn.example.com/sepolia/0xabc/1/image", result.Url)
+	assert.Equal(t, "https://cdn.example.com/sepolia/0xabc/1/image_small", m.GetSmallSizeImageUrl(result.Url))
+	thumbnail, err := os.ReadFile(filepath.Join(dir, "sepolia", "0xabc", "1", "image_small"))
+	assert.Nil(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	assert.Nil(t, err)
+	assert.Equal(t, 64, img.Bounds().Dx())
+
+	result, err = m.Mirror(context.Background(), ObjectDir("sepolia", "0xabc", "2"), server.URL+"/video.mp4")
+	assert.Nil(t, err)
+	assert.True(t, result.IsVideo())
+	assert.Equal(t, SourceHttp, result.Source)
+	assert.Equal(t, "https://cdn.example.com/sepolia/0xabc/2/video", result.Url)
+
+	// IPFS 文件没有声明的类型，SVG 按内容识别
+	result, err = m.Mirror(context.Background(), ObjectDir("sepolia", "0xabc", "6"), "ipfs://"+svgCID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, SourceIpfs, result.Source)
+	assert.Equal(t, "image/svg+xml", result.ContentType)
+
+	svg := "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`))
+	result, err = m.Mirror(context.Background(), ObjectDir("sepolia", "0xabc", "3"), svg)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceBase64, result.Source)
+	assert.Equal(t, "image/svg+xml", result.ContentType)
+
+	_, err = m.Mirror(context.Background(), ObjectDir("sepolia", "0xabc", "4"), server.URL+"/doc.json")
+	assert.Equal(t, ErrUnsupportedMedia, err)
+	_, err = m.Mirror(context.Background(), ObjectDir("sepolia", "0xabc", "5"), server.URL+"/image.webp")
+	assert.Equal(t, ErrUnsupportedMedia, err)
+	assert.Equal(t, "https://example.com/a.png", m.GetSmallSizeImageUrl("https://example.com/a.png"))
+}
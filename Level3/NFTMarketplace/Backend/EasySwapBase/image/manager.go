@@ -0,0 +1,156 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/ipfs"
+)
+
+const (
+	// imageObject 原图在对象目录下的名称
+	imageObject = "image"
+	// thumbnailSuffix 缩略图在原图名称后追加的后缀
+	thumbnailSuffix = "_small"
+	// videoObject 视频在对象目录下的名称
+	videoObject = "video"
+)
+
+// ImageManager 转存NFT的图片和视频
+type ImageManager interface {
+	// Mirror 下载 uri 指向的文件并保存到 dir 目录下，图片同时生成缩略图
+	Mirror(ctx context.Context, dir, uri string) (*MirrorResult, error)
+	// GetSmallSizeImageUrl 返回转存后图片的缩略图地址，不是转存的图片时原样返回
+	GetSmallSizeImageUrl(uri string) string
+}
+
+// MirrorResult 转存结果
+type MirrorResult struct {
+	// Url 转存后的访问地址
+	Url         string
+	ContentType string
+	Source      Source
+}
+
+// IsVideo 转存的文件是否为视频
+func (r *MirrorResult) IsVideo() bool {
+	return strings.HasPrefix(r.ContentType, "video/")
+}
+
+// Manager 使用配置的对象存储转存文件
+type Manager struct {
+	store         BlobStore
+	client        *http.Client
+	timeout       time.Duration
+	ipfs          *ipfs.Pool
+	validTypes    map[string]bool
+	maxFileSize   int64
+	thumbnailSize int
+}
+
+// NewManager 根据配置创建转存管理器，未配置的参数使用默认值。
+// ipfs:// 文件通过 pool 获取，与元数据共用网关健康状态和缓存。
+func NewManager(c *Config, pool *ipfs.Pool) (*Manager, error) {
+	if c == nil {
+		return nil, errors.New("image config is required")
+	}
+	if pool == nil {
+		return nil, errors.New("ipfs pool is required")
+	}
+	store, err := NewBlobStore(c.Store, c.DefaultOssUri)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create blob store")
+	}
+	return NewManagerWithStore(c, store, pool), nil
+}
+
+// NewManagerWithStore 使用指定的对象存储和 IPFS 网关池创建转存管理器
+func NewManagerWithStore(c *Config, store BlobStore, pool *ipfs.Pool) *Manager {
+	m := &Manager{
+		store:         store,
+		client:        &http.Client{},
+		timeout:       time.Duration(c.TimeOut) * time.Second,
+		ipfs:          pool,
+		validTypes:    make(map[string]bool),
+		maxFileSize:   c.MaxFileSize,
+		thumbnailSize: c.ThumbnailSize,
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultTimeout * time.Second
+	}
+	if m.maxFileSize <= 0 {
+		m.maxFileSize = defaultMaxFileSize
+	}
+	if m.thumbnailSize <= 0 {
+		m.thumbnailSize = defaultThumbnailSize
+	}
+	for _, t := range c.ValidFileType {
+		m.validTypes[strings.ToLower(t)] = true
+	}
+	return m
+}
+
+// ObjectDir 返回NFT在对象存储中的目录
+func ObjectDir(chain, collectionAddr, tokenID string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(chain), strings.ToLower(collectionAddr), tokenID)
+}
+
+// Mirror 下载并转存文件。图片保存为 dir/image 和缩略图 dir/image_small，
+// 无法生成缩略图的格式（如 SVG）缩略图使用原图；视频保存为 dir/video。
+func (m *Manager) Mirror(ctx context.Context, dir, uri string) (*MirrorResult, error) {
+	if !m.validFileType(uri) {
+		return nil, ErrUnsupportedMedia
+	}
+	media, err := m.Fetch(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if media.IsVideo() {
+		key := path.Join(dir, videoObject)
+		if err := m.store.Put(ctx, key, media.Data, media.ContentType); err != nil {
+			return nil, errors.Wrap(err, "failed on save video")
+		}
+		return &MirrorResult{Url: m.store.URL(key), ContentType: media.ContentType, Source: media.Source}, nil
+	}
+
+	key := path.Join(dir, imageObject)
+	if err := m.store.Put(ctx, key, media.Data, media.ContentType); err != nil {
+		return nil, errors.Wrap(err, "failed on save image")
+	}
+	thumbnail, thumbnailType := media.Data, media.ContentType
+	if data, err := Thumbnail(media.Data, m.thumbnailSize); err == nil {
+		thumbnail, thumbnailType = data, "image/jpeg"
+	}
+	if err := m.store.Put(ctx, key+thumbnailSuffix, thumbnail, thumbnailType); err != nil {
+		return nil, errors.Wrap(err, "failed on save thumbnail")
+	}
+	return &MirrorResult{Url: m.store.URL(key), ContentType: media.ContentType, Source: media.Source}, nil
+}
+
+func (m *Manager) GetSmallSizeImageUrl(uri string) string {
+	if uri == "" || !strings.HasSuffix(uri, "/"+imageObject) {
+		return uri
+	}
+	return uri + thumbnailSuffix
+}
+
+// validFileType 地址中有文件后缀时检查是否允许转存，没有后缀或者未配置时按文件内容判断
+func (m *Manager) validFileType(uri string) bool {
+	if len(m.validTypes) == 0 || strings.HasPrefix(uri, "data:") {
+		return true
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	return ext == "" || m.validTypes[ext]
+}
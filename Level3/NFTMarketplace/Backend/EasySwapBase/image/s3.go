@@ -0,0 +1,178 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	s3Service   = "s3"
+	s3TimeFmt   = "20060102T150405Z"
+	s3DateFmt   = "20060102"
+)
+
+// S3Store 通过 S3 PutObject 接口保存文件，使用 Signature V4 签名，兼容 AWS S3 以及 MinIO 等服务
+type S3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	baseURL   string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Store 创建 S3 存储，未配置 BaseURL 时使用存储桶的地址
+func NewS3Store(c StoreConfig) (*S3Store, error) {
+	if c.Endpoint == "" || c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return nil, errors.New("s3 blob store requires endpoint, bucket, access_key and secret_key")
+	}
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.Errorf("invalid s3 endpoint %q", c.Endpoint)
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+
+	s := &S3Store{
+		endpoint:  endpoint,
+		region:    c.Region,
+		bucket:    c.Bucket,
+		accessKey: c.AccessKey,
+		secretKey: c.SecretKey,
+		pathStyle: c.PathStyle,
+		client:    &http.Client{Timeout: time.Minute},
+		now:       time.Now,
+	}
+	s.baseURL = strings.TrimSuffix(c.BaseURL, "/")
+	if s.baseURL == "" {
+		s.baseURL = strings.TrimSuffix(s.objectURL("").String(), "/")
+	}
+	return s, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed on create s3 request")
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, data)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed on put s3 object")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("failed on put s3 object, status: %d, body: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *S3Store) URL(key string) string {
+	return s.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+// objectURL 返回对象的请求地址，PathStyle 时存储桶放在路径中，否则放在域名中
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	key = strings.TrimPrefix(key, "/")
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+// sign 按 AWS Signature V4 为请求签名
+func (s *S3Store) sign(req *http.Request, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format(s3TimeFmt)
+	date := now.Format(s3DateFmt)
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signedHeaders = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, s.region, s3Service)
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// s3EscapePath 按 S3 的规则编码路径，保留 '/' 和不需要编码的字符
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BlobStore 对象存储
+type BlobStore interface {
+	// Put 保存文件，同一个 key 重复保存时覆盖
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// URL 返回文件的访问地址
+	URL(key string) string
+}
+
+// NewBlobStore 根据配置创建对象存储，未配置 BaseURL 时使用 defaultBaseURL
+func NewBlobStore(c StoreConfig, defaultBaseURL string) (BlobStore, error) {
+	if c.BaseURL == "" {
+		c.BaseURL = defaultBaseURL
+	}
+	switch c.Type {
+	case StoreLocal, "":
+		return NewLocalStore(c.Dir, c.BaseURL)
+	case StoreS3:
+		return NewS3Store(c)
+	default:
+		return nil, errors.Errorf("unsupported blob store type %q", c.Type)
+	}
+}
+
+// LocalStore 把文件保存在本地目录，适合开发环境或挂载了共享存储的部署
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore 创建本地存储，目录不存在时自动创建
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("local blob store dir is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed on create blob store dir")
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put 先写临时文件再重命名，读取方不会读到写了一半的文件
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "failed on create blob dir")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return errors.Wrap(err, "failed on create blob file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed on write blob file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed on close blob file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "failed on rename blob file")
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+// path 返回 key 对应的文件路径，不允许 key 跳出存储目录
+func (s *LocalStore) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(s.dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", errors.Errorf("invalid blob key %q", key)
+	}
+	return path, nil
+}
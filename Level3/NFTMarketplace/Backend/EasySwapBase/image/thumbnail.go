@@ -0,0 +1,80 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/pkg/errors"
+)
+
+const thumbnailQuality = 85
+
+// Thumbnail 把 PNG、JPEG、GIF 图片按比例缩小到最长边不超过 size，输出 JPEG。
+// 缩小时按区域取平均值，透明部分以白色为背景；GIF 只取第一帧。
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on decode image")
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil, errors.New("empty image")
+	}
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+		if tw == 0 {
+			tw = 1
+		}
+		if th == 0 {
+			th = 1
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			if x1 == x0 {
+				x1++
+			}
+			dst.Set(x, y, averageOnWhite(src, x0, y0, x1, y1))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, errors.Wrap(err, "failed on encode thumbnail")
+	}
+	return buf.Bytes(), nil
+}
+
+// averageOnWhite 计算区域内像素的平均颜色，透明像素与白色背景混合
+func averageOnWhite(src image.Image, x0, y0, x1, y1 int) color.RGBA {
+	var r, g, b, n uint64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			// RGBA 返回预乘 alpha 的颜色，加上 (1-alpha) 的白色
+			cr, cg, cb, ca := src.At(x, y).RGBA()
+			r += uint64(cr + 0xffff - ca)
+			g += uint64(cg + 0xffff - ca)
+			b += uint64(cb + 0xffff - ca)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff}
+}
@@ -0,0 +1,54 @@
+package ipfs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// diskCache 按 CID 在本地磁盘缓存校验过的数据块，内容不可变，不需要过期
+type diskCache struct {
+	dir string
+}
+
+func newDiskCache(dir string) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed on create ipfs cache dir")
+	}
+	return &diskCache{dir: dir}, nil
+}
+
+// path 按 CID 的最后两个字符分目录，避免单个目录下文件过多
+func (c *diskCache) path(cid string) string {
+	return filepath.Join(c.dir, cid[len(cid)-2:], cid)
+}
+
+func (c *diskCache) Get(cid string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(cid))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Put 先写临时文件再重命名，并发写同一个 CID 时内容相同，后写的覆盖先写的
+func (c *diskCache) Put(cid string, data []byte) error {
+	path := c.path(cid)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "failed on create ipfs cache dir")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".block-*")
+	if err != nil {
+		return errors.Wrap(err, "failed on create ipfs cache file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed on write ipfs cache file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed on close ipfs cache file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "failed on rename ipfs cache file")
+}
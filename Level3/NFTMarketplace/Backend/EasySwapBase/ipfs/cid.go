@@ -0,0 +1,189 @@
+// Package ipfs 按内容寻址获取 IPFS 文件：从网关池或本地节点获取原始数据块，
+// 校验数据块的哈希与 CID 一致后再组装成文件，校验过的数据块可以缓存在本地磁盘。
+package ipfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CodecRaw 原始数据块
+	CodecRaw = 0x55
+	// CodecDagPb UnixFS 使用的 dag-pb 数据块
+	CodecDagPb = 0x70
+
+	hashIdentity = 0x00
+	hashSha256   = 0x12
+
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
+var (
+	ErrInvalidCID     = errors.New("invalid cid")
+	ErrCIDMismatch    = errors.New("block does not match cid")
+	ErrUnsupportedCID = errors.New("unsupported cid")
+
+	base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+)
+
+// CID 内容标识符，只支持 sha2-256 和 identity 哈希
+type CID struct {
+	Version int
+	Codec   uint64
+	// Multihash 哈希算法、长度和摘要
+	Multihash []byte
+}
+
+// ParseCID 解析字符串形式的 CID，支持 CIDv0（Qm...）以及 base32（b...）、base58btc（z...）、base16（f...）编码的 CIDv1
+func ParseCID(s string) (CID, error) {
+	if len(s) == 46 && strings.HasPrefix(s, "Qm") {
+		mh, err := decodeBase58(s)
+		if err != nil {
+			return CID{}, ErrInvalidCID
+		}
+		return newCIDv0(mh)
+	}
+	if len(s) < 2 {
+		return CID{}, ErrInvalidCID
+	}
+
+	var data []byte
+	var err error
+	switch s[0] {
+	case 'b':
+		data, err = base32Lower.DecodeString(s[1:])
+	case 'B':
+		data, err = base32Lower.DecodeString(strings.ToLower(s[1:]))
+	case 'z':
+		data, err = decodeBase58(s[1:])
+	case 'f', 'F':
+		data, err = hex.DecodeString(s[1:])
+	default:
+		return CID{}, ErrUnsupportedCID
+	}
+	if err != nil {
+		return CID{}, ErrInvalidCID
+	}
+	return CIDFromBytes(data)
+}
+
+// CIDFromBytes 解析二进制形式的 CID，dag-pb 链接中保存的是这种形式
+func CIDFromBytes(data []byte) (CID, error) {
+	if len(data) == 34 && data[0] == hashSha256 && data[1] == 32 {
+		return newCIDv0(data)
+	}
+	version, n := binary.Uvarint(data)
+	if n <= 0 || version != 1 {
+		return CID{}, ErrInvalidCID
+	}
+	codec, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return CID{}, ErrInvalidCID
+	}
+	c := CID{Version: 1, Codec: codec, Multihash: data[n+m:]}
+	if _, _, err := c.digest(); err != nil {
+		return CID{}, err
+	}
+	return c, nil
+}
+
+func newCIDv0(mh []byte) (CID, error) {
+	c := CID{Version: 0, Codec: CodecDagPb, Multihash: mh}
+	if code, _, err := c.digest(); err != nil || code != hashSha256 {
+		return CID{}, ErrInvalidCID
+	}
+	return c, nil
+}
+
+// String 返回 CID 的字符串形式，CIDv0 使用 base58btc，CIDv1 使用 base32
+func (c CID) String() string {
+	if c.Version == 0 {
+		return encodeBase58(c.Multihash)
+	}
+	buf := binary.AppendUvarint(nil, 1)
+	buf = binary.AppendUvarint(buf, c.Codec)
+	return "b" + base32Lower.EncodeToString(append(buf, c.Multihash...))
+}
+
+// Verify 校验数据块的哈希是否与 CID 一致
+func (c CID) Verify(block []byte) error {
+	code, digest, err := c.digest()
+	if err != nil {
+		return err
+	}
+	switch code {
+	case hashSha256:
+		sum := sha256.Sum256(block)
+		if !bytes.Equal(sum[:], digest) {
+			return ErrCIDMismatch
+		}
+	case hashIdentity:
+		if !bytes.Equal(block, digest) {
+			return ErrCIDMismatch
+		}
+	default:
+		return ErrUnsupportedCID
+	}
+	return nil
+}
+
+// digest 返回 multihash 的哈希算法和摘要
+func (c CID) digest() (uint64, []byte, error) {
+	code, n := binary.Uvarint(c.Multihash)
+	if n <= 0 {
+		return 0, nil, ErrInvalidCID
+	}
+	length, m := binary.Uvarint(c.Multihash[n:])
+	if m <= 0 || uint64(len(c.Multihash)-n-m) != length {
+		return 0, nil, ErrInvalidCID
+	}
+	if code != hashSha256 && code != hashIdentity {
+		return 0, nil, ErrUnsupportedCID
+	}
+	return code, c.Multihash[n+m:], nil
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return nil, ErrInvalidCID
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	data := n.Bytes()
+	// 开头的 '1' 表示 0x00
+	for i := 0; i < len(s) && s[i] == '1'; i++ {
+		data = append([]byte{0}, data...)
+	}
+	return data, nil
+}
+
+func encodeBase58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < len(data) && data[i] == 0; i++ {
+		out = append(out, '1')
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
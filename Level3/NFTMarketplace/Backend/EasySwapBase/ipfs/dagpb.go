@@ -0,0 +1,124 @@
+package ipfs
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// UnixFS 节点类型
+const (
+	unixfsRaw       = 0
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsMetadata  = 3
+	unixfsSymlink   = 4
+	unixfsHAMTShard = 5
+)
+
+var errInvalidNode = errors.New("invalid dag-pb node")
+
+// pbLink dag-pb 节点中的链接
+type pbLink struct {
+	Hash []byte
+	Name string
+}
+
+// pbNode dag-pb 节点，Data 为 UnixFS 数据
+type pbNode struct {
+	Links []pbLink
+	Data  []byte
+}
+
+// unixfsData UnixFS 节点数据
+type unixfsData struct {
+	Type     uint64
+	Data     []byte
+	FileSize uint64
+}
+
+// decodePBNode 解析 dag-pb 数据块，字段定义见 https://ipld.io/specs/codecs/dag-pb/spec/
+func decodePBNode(block []byte) (*pbNode, error) {
+	node := &pbNode{}
+	err := walkProto(block, func(field int, value []byte, _ uint64) error {
+		switch field {
+		case 1:
+			node.Data = value
+		case 2:
+			var link pbLink
+			if err := walkProto(value, func(field int, value []byte, _ uint64) error {
+				switch field {
+				case 1:
+					link.Hash = value
+				case 2:
+					link.Name = string(value)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			node.Links = append(node.Links, link)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// decodeUnixfs 解析 UnixFS 数据，字段定义见 https://github.com/ipfs/specs/blob/main/UNIXFS.md
+func decodeUnixfs(data []byte) (*unixfsData, error) {
+	u := &unixfsData{}
+	err := walkProto(data, func(field int, value []byte, varint uint64) error {
+		switch field {
+		case 1:
+			u.Type = varint
+		case 2:
+			u.Data = value
+		case 3:
+			u.FileSize = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// walkProto 遍历 protobuf 编码的字段，只支持 varint 和 length-delimited 两种类型
+func walkProto(data []byte, fn func(field int, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errInvalidNode
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), key&7
+		switch wireType {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errInvalidNode
+			}
+			data = data[n:]
+			if err := fn(field, nil, v); err != nil {
+				return err
+			}
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errInvalidNode
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if err := fn(field, value, 0); err != nil {
+				return err
+			}
+		default:
+			return errInvalidNode
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// emptyDirCIDv0 空目录的 CID，数据块为 0x0a 0x02 0x08 0x01
+const (
+	emptyDirCIDv0 = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	emptyDirCIDv1 = "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"
+)
+
+var emptyDirBlock = []byte{0x0a, 0x02, 0x08, 0x01}
+
+func protoBytes(field int, value []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+func protoVarint(field int, value uint64) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3))
+	return binary.AppendUvarint(buf, value)
+}
+
+// encodeNode 按 dag-pb 格式编码节点，返回 CIDv0 和数据块
+func encodeNode(unixfsType uint64, data []byte, fileSize uint64, links ...pbLink) (CID, []byte) {
+	var block []byte
+	for _, link := range links {
+		block = append(block, protoBytes(2, append(protoBytes(1, link.Hash), protoBytes(2, []byte(link.Name))...))...)
+	}
+	unixfs := protoVarint(1, unixfsType)
+	if data != nil {
+		unixfs = append(unixfs, protoBytes(2, data)...)
+	}
+	unixfs = append(unixfs, protoVarint(3, fileSize)...)
+	block = append(block, protoBytes(1, unixfs)...)
+	return sha256CID(0, CodecDagPb, block), block
+}
+
+func sha256CID(version int, codec uint64, block []byte) CID {
+	sum := sha256.Sum256(block)
+	return CID{Version: version, Codec: codec, Multihash: append([]byte{hashSha256, 32}, sum[:]...)}
+}
+
+func cidBytes(c CID) []byte {
+	if c.Version == 0 {
+		return c.Multihash
+	}
+	buf := binary.AppendUvarint(nil, 1)
+	buf = binary.AppendUvarint(buf, c.Codec)
+	return append(buf, c.Multihash...)
+}
+
+func TestParseCID(t *testing.T) {
+	v0, err := ParseCID(emptyDirCIDv0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, v0.Version)
+	assert.Equal(t, emptyDirCIDv0, v0.String())
+	assert.Nil(t, v0.Verify(emptyDirBlock))
+	assert.Equal(t, ErrCIDMismatch, v0.Verify([]byte("tampered")))
+
+	v1, err := ParseCID(emptyDirCIDv1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, uint64(CodecDagPb), v1.Codec)
+	assert.Equal(t, emptyDirCIDv1, v1.String())
+	assert.Equal(t, v0.Multihash, v1.Multihash)
+
+	fromBytes, err := CIDFromBytes(cidBytes(v1))
+	assert.Nil(t, err)
+	assert.Equal(t, v1, fromBytes)
+
+	_, err = ParseCID("QmInvalid")
+	assert.NotNil(t, err)
+}
+
+func TestParseURI(t *testing.T) {
+	for _, uri := range []string{
+		"ipfs://" + emptyDirCIDv0 + "/1.json",
+		"ipfs://ipfs/" + emptyDirCIDv0 + "/1.json",
+		"https://ipfs.io/ipfs/" + emptyDirCIDv0 + "/1.json?filename=1.json",
+		"https://" + emptyDirCIDv1 + ".ipfs.dweb.link/1.json",
+	} {
+		root, path, err := ParseURI(uri)
+		assert.Nil(t, err, uri)
+		assert.Equal(t, []string{"1.json"}, path, uri)
+		assert.Nil(t, root.Verify(emptyDirBlock), uri)
+	}
+	assert.False(t, IsIpfsURI("https://api.example.com/metadata/1"))
+	assert.False(t, IsIpfsURI("https://api.example.com/ipfs/metadata/1"))
+}
+
+// blockServer 模拟支持 trustless 请求的网关，tamper 为 true 时返回被篡改的数据
+func blockServer(blocks map[string][]byte, tamper bool, delay time.Duration, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if r.URL.Query().Get("format") != "raw" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(delay)
+		block, ok := blocks[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if tamper {
+			block = append([]byte("x"), block...)
+		}
+		_, _ = w.Write(block)
+	}))
+}
+
+func TestPoolFetchVerifiesAndCaches(t *testing.T) {
+	// 文件由两个 raw 数据块组成，放在目录 dir/1.json 下
+	part1, part2 := []byte(`{"name":`), []byte(`"EasySwap #1"}`)
+	raw1, raw2 := sha256CID(1, CodecRaw, part1), sha256CID(1, CodecRaw, part2)
+	fileCID, fileBlock := encodeNode(unixfsFile, nil, uint64(len(part1)+len(part2)),
+		pbLink{Hash: cidBytes(raw1)}, pbLink{Hash: cidBytes(raw2)})
+	dirCID, dirBlock := encodeNode(unixfsDirectory, nil, 0, pbLink{Hash: cidBytes(fileCID), Name: "1.json"})
+	blocks := map[string][]byte{
+		raw1.String():    part1,
+		raw2.String():    part2,
+		fileCID.String(): fileBlock,
+		dirCID.String():  dirBlock,
+	}
+
+	var badHits, goodHits int32
+	bad := blockServer(blocks, true, 0, &badHits)
+	good := blockServer(blocks, false, 0, &goodHits)
+
+	pool, err := NewPool(Config{Gateways: []string{bad.URL, good.URL + "/ipfs/"}, CacheDir: t.TempDir(), HedgeDelay: 1000})
+	assert.Nil(t, err)
+
+	data, err := pool.Fetch(context.Background(), "ipfs://"+dirCID.String()+"/1.json")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"EasySwap #1"}`, string(data))
+	assert.True(t, badHits > 0)
+
+	// 篡改数据的网关连续失败后排在最后
+	ranked := pool.ranked()
+	assert.Equal(t, good.URL+"/ipfs/", ranked[0].base)
+
+	// 数据块已经缓存，网关不可用时也能获取
+	bad.Close()
+	good.Close()
+	data, err = pool.Fetch(context.Background(), "https://ipfs.io/ipfs/"+dirCID.String()+"/1.json")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"EasySwap #1"}`, string(data))
+}
+
+func TestPoolHedgedRequest(t *testing.T) {
+	content := []byte("hello")
+	c := sha256CID(1, CodecRaw, content)
+	blocks := map[string][]byte{c.String(): content}
+
+	var slowHits, fastHits int32
+	slow := blockServer(blocks, false, 2*time.Second, &slowHits)
+	defer slow.Close()
+	fast := blockServer(blocks, false, 0, &fastHits)
+	defer fast.Close()
+
+	pool, err := NewPool(Config{Gateways: []string{slow.URL, fast.URL}, HedgeDelay: 50})
+	assert.Nil(t, err)
+
+	begin := time.Now()
+	data, err := pool.Fetch(context.Background(), "ipfs://"+c.String())
+	assert.Nil(t, err)
+	assert.Equal(t, content, data)
+	assert.True(t, time.Since(begin) < time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fastHits))
+}
+
+func TestPoolMaxFileSize(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 64)
+	c := sha256CID(1, CodecRaw, content)
+	server := blockServer(map[string][]byte{c.String(): content}, false, 0, new(int32))
+	defer server.Close()
+
+	pool, err := NewPool(Config{Gateways: []string{server.URL}, MaxFileSize: 32})
+	assert.Nil(t, err)
+	_, err = pool.Fetch(context.Background(), "ipfs://"+c.String())
+	assert.Equal(t, ErrFileTooLarge, err)
+}
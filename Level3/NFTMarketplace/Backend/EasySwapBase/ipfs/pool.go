@@ -0,0 +1,544 @@
+package ipfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+const (
+	defaultTimeout     = 30 * time.Second
+	defaultHedgeDelay  = 500 * time.Millisecond
+	defaultMaxFileSize = 50 << 20
+	// maxBlockSize IPFS 数据块最大 1MiB，留出余量
+	maxBlockSize = 4 << 20
+	// blockFetchConcurrency 获取同一个文件的子数据块时的并发数
+	blockFetchConcurrency = 8
+
+	// failureThreshold 网关连续失败多少次后暂停使用
+	failureThreshold = 3
+	baseCooldown     = 30 * time.Second
+	maxCooldown      = 10 * time.Minute
+)
+
+var (
+	// DefaultGateways 未配置网关时使用的公共网关
+	DefaultGateways = []string{"https://ipfs.io/ipfs/", "https://dweb.link/ipfs/", "https://cf-ipfs.com/ipfs/", "https://infura-ipfs.io/ipfs/", "https://cloudflare-ipfs.com/ipfs/"}
+
+	ErrFileTooLarge = errors.New("ipfs file too large")
+	ErrNotFound     = errors.New("ipfs path not found")
+)
+
+// Config 网关池配置
+type Config struct {
+	// Gateways 支持 trustless 请求（?format=raw）的网关，例如 https://ipfs.io/ipfs/
+	Gateways []string `toml:"gateways" mapstructure:"gateways" json:"gateways"`
+	// LocalNode 本地 Kubo 节点的 RPC 地址，例如 http://127.0.0.1:5001，配置后优先使用
+	LocalNode string `toml:"local_node" mapstructure:"local_node" json:"local_node"`
+	// CacheDir 数据块的磁盘缓存目录，为空时不缓存
+	CacheDir string `toml:"cache_dir" mapstructure:"cache_dir" json:"cache_dir"`
+	// Timeout 获取一个文件的超时时间（秒）
+	Timeout int `toml:"timeout" mapstructure:"timeout" json:"timeout"`
+	// HedgeDelay 网关多久没有返回时向下一个网关发起请求（毫秒）
+	HedgeDelay int `toml:"hedge_delay" mapstructure:"hedge_delay" json:"hedge_delay"`
+	// MaxFileSize 允许获取的最大文件大小（字节）
+	MaxFileSize int64 `toml:"max_file_size" mapstructure:"max_file_size" json:"max_file_size"`
+}
+
+// gateway 网关及其健康状态
+type gateway struct {
+	base string
+
+	mu sync.Mutex
+	// latency 成功请求耗时的指数移动平均
+	latency   time.Duration
+	failures  int
+	downUntil time.Time
+}
+
+func (g *gateway) success(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.latency == 0 {
+		g.latency = d
+	} else {
+		g.latency = (g.latency*7 + d*3) / 10
+	}
+	g.failures = 0
+	g.downUntil = time.Time{}
+}
+
+// failure 连续失败达到阈值后暂停使用，暂停时间随失败次数翻倍
+func (g *gateway) failure(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures++
+	if g.failures >= failureThreshold {
+		cooldown := baseCooldown << (g.failures - failureThreshold)
+		if cooldown > maxCooldown || cooldown <= 0 {
+			cooldown = maxCooldown
+		}
+		g.downUntil = now.Add(cooldown)
+	}
+}
+
+// state 返回网关是否暂停使用、连续失败次数和平均耗时
+func (g *gateway) state(now time.Time) (bool, int, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return now.Before(g.downUntil), g.failures, g.latency
+}
+
+// Pool 网关池。每个数据块按网关的健康状态依次请求，
+// 前一个网关 HedgeDelay 内没有返回时同时向下一个网关请求，第一个通过 CID 校验的结果胜出。
+type Pool struct {
+	gateways    []*gateway
+	localNode   string
+	cache       *diskCache
+	client      *http.Client
+	timeout     time.Duration
+	hedgeDelay  time.Duration
+	maxFileSize int64
+	now         func() time.Time
+}
+
+// NewPool 根据配置创建网关池，未配置的参数使用默认值
+func NewPool(c Config) (*Pool, error) {
+	p := &Pool{
+		localNode:   strings.TrimSuffix(c.LocalNode, "/"),
+		client:      &http.Client{},
+		timeout:     time.Duration(c.Timeout) * time.Second,
+		hedgeDelay:  time.Duration(c.HedgeDelay) * time.Millisecond,
+		maxFileSize: c.MaxFileSize,
+		now:         time.Now,
+	}
+	if p.timeout <= 0 {
+		p.timeout = defaultTimeout
+	}
+	if p.hedgeDelay <= 0 {
+		p.hedgeDelay = defaultHedgeDelay
+	}
+	if p.maxFileSize <= 0 {
+		p.maxFileSize = defaultMaxFileSize
+	}
+	gateways := c.Gateways
+	if len(gateways) == 0 {
+		gateways = DefaultGateways
+	}
+	for _, g := range gateways {
+		base := strings.TrimSuffix(g, "/")
+		if !strings.HasSuffix(base, "/ipfs") {
+			base += "/ipfs"
+		}
+		p.gateways = append(p.gateways, &gateway{base: base + "/"})
+	}
+	if c.CacheDir != "" {
+		cache, err := newDiskCache(c.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		p.cache = cache
+	}
+	return p, nil
+}
+
+// IsIpfsURI 判断地址是否指向 IPFS 内容，包括 ipfs:// 和网关地址
+func IsIpfsURI(uri string) bool {
+	_, _, err := ParseURI(uri)
+	return err == nil
+}
+
+// ParseURI 解析 IPFS 地址，返回根 CID 和路径。支持
+// ipfs://<cid>/path、ipfs://ipfs/<cid>/path、https://<gateway>/ipfs/<cid>/path 和 https://<cid>.ipfs.<gateway>/path
+func ParseURI(uri string) (CID, []string, error) {
+	var segments []string
+	switch {
+	case strings.HasPrefix(uri, "ipfs://"):
+		rest := strings.TrimPrefix(strings.TrimPrefix(uri, "ipfs://"), "ipfs/")
+		rest, _, _ = strings.Cut(rest, "?")
+		segments = strings.Split(rest, "/")
+	case strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://"):
+		u, err := url.Parse(uri)
+		if err != nil {
+			return CID{}, nil, ErrInvalidCID
+		}
+		if host, _, ok := strings.Cut(u.Hostname(), ".ipfs."); ok {
+			segments = append([]string{host}, strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")...)
+		} else if _, rest, ok := strings.Cut(u.EscapedPath(), "/ipfs/"); ok {
+			segments = strings.Split(rest, "/")
+		} else {
+			return CID{}, nil, ErrInvalidCID
+		}
+	default:
+		return CID{}, nil, ErrInvalidCID
+	}
+
+	root, err := ParseCID(segments[0])
+	if err != nil {
+		return CID{}, nil, err
+	}
+	var path []string
+	for _, s := range segments[1:] {
+		if s == "" {
+			continue
+		}
+		name, err := url.PathUnescape(s)
+		if err != nil {
+			return CID{}, nil, ErrInvalidCID
+		}
+		path = append(path, name)
+	}
+	return root, path, nil
+}
+
+// Fetch 获取 IPFS 地址指向的文件，所有数据块都经过 CID 校验
+func (p *Pool) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	root, path, err := ParseURI(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on parse ipfs uri")
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	c, err := p.resolve(ctx, root, path)
+	if err != nil {
+		return nil, err
+	}
+	block, err := p.Block(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	if err := p.appendFile(ctx, c, block, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// resolve 按路径在 UnixFS 目录中查找文件的 CID
+func (p *Pool) resolve(ctx context.Context, c CID, path []string) (CID, error) {
+	for _, name := range path {
+		block, err := p.Block(ctx, c)
+		if err != nil {
+			return CID{}, err
+		}
+		if c.Codec != CodecDagPb {
+			return CID{}, ErrNotFound
+		}
+		node, err := decodePBNode(block)
+		if err != nil {
+			return CID{}, err
+		}
+		u, err := decodeUnixfs(node.Data)
+		if err != nil {
+			return CID{}, err
+		}
+		switch u.Type {
+		case unixfsDirectory:
+			c, err = findLink(node.Links, name)
+		case unixfsHAMTShard:
+			c, err = p.findInShard(ctx, node, name)
+		default:
+			err = ErrNotFound
+		}
+		if err != nil {
+			return CID{}, errors.Wrapf(err, "failed on resolve %s", name)
+		}
+	}
+	return c, nil
+}
+
+func findLink(links []pbLink, name string) (CID, error) {
+	for _, link := range links {
+		if link.Name == name {
+			return CIDFromBytes(link.Hash)
+		}
+	}
+	return CID{}, ErrNotFound
+}
+
+// findInShard 在分片目录中查找文件。分片目录的链接名为两位十六进制的桶编号，
+// 桶编号后接文件名的是文件，只有桶编号的是下一级分片；这里不计算文件名的哈希，依次查找各级分片。
+func (p *Pool) findInShard(ctx context.Context, node *pbNode, name string) (CID, error) {
+	for _, link := range node.Links {
+		if len(link.Name) > 2 && link.Name[2:] == name {
+			return CIDFromBytes(link.Hash)
+		}
+	}
+	for _, link := range node.Links {
+		if len(link.Name) != 2 {
+			continue
+		}
+		c, err := CIDFromBytes(link.Hash)
+		if err != nil {
+			return CID{}, err
+		}
+		block, err := p.Block(ctx, c)
+		if err != nil {
+			return CID{}, err
+		}
+		child, err := decodePBNode(block)
+		if err != nil {
+			return CID{}, err
+		}
+		if found, err := p.findInShard(ctx, child, name); err == nil {
+			return found, nil
+		} else if !errors.Is(err, ErrNotFound) {
+			return CID{}, err
+		}
+	}
+	return CID{}, ErrNotFound
+}
+
+// appendFile 把文件数据块及其子数据块的内容按顺序追加到 out
+func (p *Pool) appendFile(ctx context.Context, c CID, block []byte, out *[]byte) error {
+	if c.Codec == CodecRaw {
+		return p.appendData(out, block)
+	}
+	if c.Codec != CodecDagPb {
+		return ErrUnsupportedCID
+	}
+	node, err := decodePBNode(block)
+	if err != nil {
+		return err
+	}
+	u, err := decodeUnixfs(node.Data)
+	if err != nil {
+		return err
+	}
+	if u.Type != unixfsFile && u.Type != unixfsRaw {
+		return errors.New("ipfs path is not a file")
+	}
+	if int64(u.FileSize) > p.maxFileSize {
+		return ErrFileTooLarge
+	}
+	if err := p.appendData(out, u.Data); err != nil {
+		return err
+	}
+
+	children, blocks, err := p.blocks(ctx, node.Links)
+	if err != nil {
+		return err
+	}
+	for i := range children {
+		if err := p.appendFile(ctx, children[i], blocks[i], out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pool) appendData(out *[]byte, data []byte) error {
+	if int64(len(*out)+len(data)) > p.maxFileSize {
+		return ErrFileTooLarge
+	}
+	*out = append(*out, data...)
+	return nil
+}
+
+// blocks 并发获取链接指向的数据块，结果与链接顺序一致
+func (p *Pool) blocks(ctx context.Context, links []pbLink) ([]CID, [][]byte, error) {
+	cids := make([]CID, len(links))
+	for i, link := range links {
+		c, err := CIDFromBytes(link.Hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		cids[i] = c
+	}
+
+	blocks := make([][]byte, len(links))
+	errs := make([]error, len(links))
+	sem := make(chan struct{}, blockFetchConcurrency)
+	var wg sync.WaitGroup
+	for i := range cids {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			blocks[i], errs[i] = p.Block(ctx, cids[i])
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return cids, blocks, nil
+}
+
+// Block 获取并校验一个数据块，依次使用磁盘缓存、本地节点和网关
+func (p *Pool) Block(ctx context.Context, c CID) ([]byte, error) {
+	if code, digest, err := c.digest(); err != nil {
+		return nil, err
+	} else if code == hashIdentity {
+		return digest, nil
+	}
+
+	key := c.String()
+	if p.cache != nil {
+		if block, ok := p.cache.Get(key); ok && c.Verify(block) == nil {
+			return block, nil
+		}
+	}
+
+	block, err := p.fetchLocal(ctx, c)
+	if err != nil {
+		block, err = p.fetchGateways(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.cache != nil {
+		if err := p.cache.Put(key, block); err != nil {
+			xzap.WithContext(ctx).Warn("failed on cache ipfs block", zap.String("cid", key), zap.Error(err))
+		}
+	}
+	return block, nil
+}
+
+// fetchLocal 通过本地 Kubo 节点的 block/get 接口获取数据块
+func (p *Pool) fetchLocal(ctx context.Context, c CID) ([]byte, error) {
+	if p.localNode == "" {
+		return nil, errors.New("local ipfs node not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.localNode+"/api/v0/block/get?arg="+c.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create local ipfs request")
+	}
+	return p.doBlockRequest(req, c)
+}
+
+// fetchGateways 按健康状态向网关请求数据块，HedgeDelay 内没有返回或者请求失败时向下一个网关请求
+func (p *Pool) fetchGateways(ctx context.Context, c CID) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		block []byte
+		err   error
+	}
+	ranked := p.ranked()
+	results := make(chan result, len(ranked))
+	launched := 0
+	launch := func() {
+		g := ranked[launched]
+		launched++
+		go func() {
+			begin := p.now()
+			block, err := p.fetchGateway(ctx, g, c)
+			if err == nil {
+				g.success(p.now().Sub(begin))
+			} else if ctx.Err() == nil {
+				// 因为其他网关先返回而取消的请求不计入失败
+				g.failure(p.now())
+			}
+			results <- result{block: block, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(p.hedgeDelay)
+	defer timer.Stop()
+	pending := 1
+	err := errors.New("no ipfs gateway configured")
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.block, nil
+			}
+			err = r.err
+			if launched < len(ranked) {
+				launch()
+				pending++
+			}
+		case <-timer.C:
+			if launched < len(ranked) {
+				launch()
+				pending++
+				timer.Reset(p.hedgeDelay)
+			}
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "failed on fetch ipfs block %s", c)
+		}
+	}
+	return nil, errors.Wrapf(err, "failed on fetch ipfs block %s", c)
+}
+
+func (p *Pool) fetchGateway(ctx context.Context, g *gateway, c CID) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.base+c.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create ipfs gateway request")
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+	return p.doBlockRequest(req, c)
+}
+
+func (p *Pool) doBlockRequest(req *http.Request, c CID) ([]byte, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on request ipfs block")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed on request ipfs block, status: %d", resp.StatusCode)
+	}
+	block, err := io.ReadAll(io.LimitReader(resp.Body, maxBlockSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on read ipfs block")
+	}
+	if len(block) > maxBlockSize {
+		return nil, errors.New("ipfs block too large")
+	}
+	if err := c.Verify(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// ranked 按健康状态排序的网关：暂停中的排在最后，其余按连续失败次数、平均耗时排序，相同时保持配置顺序
+func (p *Pool) ranked() []*gateway {
+	now := p.now()
+	type scored struct {
+		g        *gateway
+		down     bool
+		failures int
+		latency  time.Duration
+	}
+	list := make([]scored, len(p.gateways))
+	for i, g := range p.gateways {
+		down, failures, latency := g.state(now)
+		list[i] = scored{g: g, down: down, failures: failures, latency: latency}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].down != list[j].down {
+			return !list[i].down
+		}
+		if list[i].failures != list[j].failures {
+			return list[i].failures < list[j].failures
+		}
+		return list[i].latency < list[j].latency
+	})
+	ranked := make([]*gateway, len(list))
+	for i := range list {
+		ranked[i] = list[i].g
+	}
+	return ranked
+}
@@ -0,0 +1,206 @@
+// Package livefeed 实时推送的市场事件：同步服务在数据写入后发布事件，后端按主题推送给订阅的客户端。
+// 事件写入每条链一个的 Redis Stream，Stream 中的事件 ID 同时作为客户端断线重连时的续传位置。
+package livefeed
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// 事件类型
+const (
+	// EventActivity 集合活动：挂单、出价、成交、取消等，与活动表中的记录对应
+	EventActivity = "activity"
+	// EventOrder 订单状态变化：创建、部分成交、成交、取消、过期
+	EventOrder = "order"
+	// EventFloor 集合地板价变化
+	EventFloor = "floor"
+)
+
+// 主题类型
+const (
+	// TopicCollectionActivity 集合的活动，collection:<address>:activity
+	TopicCollectionActivity = "activity"
+	// TopicCollectionFloor 集合的地板价，collection:<address>:floor
+	TopicCollectionFloor = "floor"
+	// TopicItemOrders 单个 item 的订单，item:<address>:<token_id>:orders
+	TopicItemOrders = "item_orders"
+	// TopicUserOrders 用户的挂单和出价，user:<address>:orders，需要登录
+	TopicUserOrders = "user_orders"
+)
+
+// Event 推送给客户端的市场事件
+type Event struct {
+	// ID 事件在 Stream 中的 ID，读取时设置
+	ID             string `json:"id"`
+	Type           string `json:"type"`
+	Chain          string `json:"chain"`
+	CollectionAddr string `json:"collection_address"`
+	TokenId        string `json:"token_id,omitempty"`
+
+	// 订单事件
+	OrderId           string `json:"order_id,omitempty"`
+	OrderType         int64  `json:"order_type,omitempty"`
+	OrderStatus       int    `json:"order_status,omitempty"`
+	QuantityRemaining int64  `json:"quantity_remaining,omitempty"`
+	ExpireTime        int64  `json:"expire_time,omitempty"`
+
+	// 活动事件
+	ActivityType int    `json:"activity_type,omitempty"`
+	TxHash       string `json:"tx_hash,omitempty"`
+
+	Maker     string          `json:"maker,omitempty"`
+	Taker     string          `json:"taker,omitempty"`
+	Price     decimal.Decimal `json:"price"`
+	EventTime int64           `json:"event_time"`
+}
+
+// Topic 解析后的订阅主题
+type Topic struct {
+	Kind           string
+	CollectionAddr string
+	TokenId        string
+	// User 用户主题的地址，只有登录了该地址的连接可以订阅
+	User string
+}
+
+// CollectionActivityTopic 集合活动主题
+func CollectionActivityTopic(collectionAddr string) string {
+	return "collection:" + strings.ToLower(collectionAddr) + ":activity"
+}
+
+// CollectionFloorTopic 集合地板价主题
+func CollectionFloorTopic(collectionAddr string) string {
+	return "collection:" + strings.ToLower(collectionAddr) + ":floor"
+}
+
+// ItemOrdersTopic 单个 item 的订单主题
+func ItemOrdersTopic(collectionAddr, tokenId string) string {
+	return "item:" + strings.ToLower(collectionAddr) + ":" + tokenId + ":orders"
+}
+
+// UserOrdersTopic 用户订单主题
+func UserOrdersTopic(user string) string {
+	return "user:" + strings.ToLower(user) + ":orders"
+}
+
+// ParseTopic 解析并校验订阅主题，地址统一转换为小写
+func ParseTopic(topic string) (*Topic, error) {
+	parts := strings.Split(topic, ":")
+	switch {
+	case len(parts) == 3 && parts[0] == "collection" && parts[2] == "activity" && isAddress(parts[1]):
+		return &Topic{Kind: TopicCollectionActivity, CollectionAddr: strings.ToLower(parts[1])}, nil
+	case len(parts) == 3 && parts[0] == "collection" && parts[2] == "floor" && isAddress(parts[1]):
+		return &Topic{Kind: TopicCollectionFloor, CollectionAddr: strings.ToLower(parts[1])}, nil
+	case len(parts) == 4 && parts[0] == "item" && parts[3] == "orders" && isAddress(parts[1]) && isTokenId(parts[2]):
+		return &Topic{Kind: TopicItemOrders, CollectionAddr: strings.ToLower(parts[1]), TokenId: parts[2]}, nil
+	case len(parts) == 3 && parts[0] == "user" && parts[2] == "orders" && isAddress(parts[1]):
+		return &Topic{Kind: TopicUserOrders, User: strings.ToLower(parts[1])}, nil
+	}
+	return nil, errors.Errorf("invalid topic %q", topic)
+}
+
+// String 返回主题的规范形式
+func (t *Topic) String() string {
+	switch t.Kind {
+	case TopicCollectionActivity:
+		return CollectionActivityTopic(t.CollectionAddr)
+	case TopicCollectionFloor:
+		return CollectionFloorTopic(t.CollectionAddr)
+	case TopicItemOrders:
+		return ItemOrdersTopic(t.CollectionAddr, t.TokenId)
+	case TopicUserOrders:
+		return UserOrdersTopic(t.User)
+	}
+	return ""
+}
+
+// Topics 返回事件需要推送到的全部主题
+func (e *Event) Topics() []string {
+	switch e.Type {
+	case EventActivity:
+		return []string{CollectionActivityTopic(e.CollectionAddr)}
+	case EventFloor:
+		return []string{CollectionFloorTopic(e.CollectionAddr)}
+	case EventOrder:
+		var topics []string
+		if e.TokenId != "" {
+			topics = append(topics, ItemOrdersTopic(e.CollectionAddr, e.TokenId))
+		}
+		if e.Maker != "" {
+			topics = append(topics, UserOrdersTopic(e.Maker))
+		}
+		// 成交后买方也能收到对方订单的变化
+		if e.Taker != "" && !strings.EqualFold(e.Taker, e.Maker) && !isZeroAddress(e.Taker) {
+			topics = append(topics, UserOrdersTopic(e.Taker))
+		}
+		return topics
+	}
+	return nil
+}
+
+// CompareID 比较两个 Stream 事件 ID（<毫秒时间戳>-<序号>），a 在 b 之前返回 -1，相同返回 0，之后返回 1。
+// 格式错误的 ID 按 0-0 处理。
+func CompareID(a, b string) int {
+	aMs, aSeq := splitID(a)
+	bMs, bSeq := splitID(b)
+	switch {
+	case aMs < bMs || (aMs == bMs && aSeq < bSeq):
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// ValidID 检查是否为合法的 Stream 事件 ID
+func ValidID(id string) bool {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return false
+	}
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return false
+	}
+	_, err := strconv.ParseUint(seq, 10, 64)
+	return err == nil
+}
+
+func splitID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseUint(ms, 10, 64)
+	seqValue, _ := strconv.ParseUint(seq, 10, 64)
+	return msValue, seqValue
+}
+
+func isAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(strings.ToLower(s), "0x") {
+		return false
+	}
+	for _, c := range strings.ToLower(s[2:]) {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenId(s string) bool {
+	if s == "" || len(s) > 78 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeroAddress(s string) bool {
+	return strings.TrimLeft(strings.TrimPrefix(strings.ToLower(s), "0x"), "0") == ""
+}
@@ -0,0 +1,70 @@
+package livefeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	collection = "0x1234567890AbcdEF1234567890aBcdef12345678"
+	maker      = "0x00000000000000000000000000000000000000aA"
+	taker      = "0x00000000000000000000000000000000000000bb"
+)
+
+func TestParseTopic(t *testing.T) {
+	topic, err := ParseTopic("collection:" + collection + ":activity")
+	assert.NoError(t, err)
+	assert.Equal(t, TopicCollectionActivity, topic.Kind)
+	// 地址统一转换为小写
+	assert.Equal(t, CollectionActivityTopic(collection), topic.String())
+
+	topic, err = ParseTopic("item:" + collection + ":42:orders")
+	assert.NoError(t, err)
+	assert.Equal(t, TopicItemOrders, topic.Kind)
+	assert.Equal(t, "42", topic.TokenId)
+
+	topic, err = ParseTopic("user:" + maker + ":orders")
+	assert.NoError(t, err)
+	assert.Equal(t, TopicUserOrders, topic.Kind)
+	assert.Equal(t, "0x00000000000000000000000000000000000000aa", topic.User)
+
+	for _, invalid := range []string{
+		"",
+		"collection:0x1234:activity",
+		"collection:" + collection + ":bids",
+		"item:" + collection + ":abc:orders",
+		"user:" + maker,
+		"user:" + maker + ":orders:extra",
+	} {
+		_, err := ParseTopic(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEventTopics(t *testing.T) {
+	activity := &Event{Type: EventActivity, CollectionAddr: collection, TokenId: "1", Maker: maker}
+	assert.Equal(t, []string{CollectionActivityTopic(collection)}, activity.Topics())
+
+	floor := &Event{Type: EventFloor, CollectionAddr: collection}
+	assert.Equal(t, []string{CollectionFloorTopic(collection)}, floor.Topics())
+
+	order := &Event{Type: EventOrder, CollectionAddr: collection, TokenId: "1", Maker: maker, Taker: taker}
+	assert.Equal(t, []string{ItemOrdersTopic(collection, "1"), UserOrdersTopic(maker), UserOrdersTopic(taker)}, order.Topics())
+
+	// 集合出价没有 token，未成交的订单 taker 为零地址
+	bid := &Event{Type: EventOrder, CollectionAddr: collection, Maker: maker, Taker: "0x0000000000000000000000000000000000000000"}
+	assert.Equal(t, []string{UserOrdersTopic(maker)}, bid.Topics())
+}
+
+func TestCompareID(t *testing.T) {
+	assert.Equal(t, -1, CompareID("1700000000000-0", "1700000000000-1"))
+	assert.Equal(t, -1, CompareID("999-5", "1000-0"))
+	assert.Equal(t, 0, CompareID("1000-2", "1000-2"))
+	assert.Equal(t, 1, CompareID("1000-10", "1000-9"))
+
+	assert.True(t, ValidID("1700000000000-0"))
+	assert.False(t, ValidID("1700000000000"))
+	assert.False(t, ValidID("abc-1"))
+	assert.False(t, ValidID("(1-0"))
+}
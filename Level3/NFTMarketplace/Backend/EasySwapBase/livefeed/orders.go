@@ -0,0 +1,86 @@
+package livefeed
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+// OrderEvent 根据订单生成订单变化事件
+func OrderEvent(order *multi.Order) *Event {
+	return &Event{
+		Type:              EventOrder,
+		CollectionAddr:    order.CollectionAddress,
+		TokenId:           order.TokenId,
+		OrderId:           order.OrderID,
+		OrderType:         order.OrderType,
+		OrderStatus:       order.OrderStatus,
+		QuantityRemaining: order.QuantityRemaining,
+		ExpireTime:        order.ExpireTime,
+		Maker:             order.Maker,
+		Taker:             order.Taker,
+		Price:             order.Price,
+		EventTime:         order.EventTime,
+	}
+}
+
+// ActivityEvent 根据活动记录生成集合活动事件
+func ActivityEvent(activity *multi.Activity) *Event {
+	return &Event{
+		Type:           EventActivity,
+		CollectionAddr: activity.CollectionAddress,
+		TokenId:        activity.TokenId,
+		ActivityType:   activity.ActivityType,
+		TxHash:         activity.TxHash,
+		Maker:          activity.Maker,
+		Taker:          activity.Taker,
+		Price:          activity.Price,
+		EventTime:      activity.EventTime,
+	}
+}
+
+// FloorEvent 生成集合地板价变化事件，集合没有有效挂单时地板价为 0
+func FloorEvent(collectionAddr string, floorPrice decimal.Decimal, eventTime int64) *Event {
+	return &Event{
+		Type:           EventFloor,
+		CollectionAddr: collectionAddr,
+		Price:          floorPrice,
+		EventTime:      eventTime,
+	}
+}
+
+// PublishOrders 按数据库中的最新状态发布订单变化事件，同一个订单只发布一次。
+// 不存在的订单（例如因链重组被撤销插入的订单）忽略。
+func PublishOrders(ctx context.Context, db *gorm.DB, kv *xkv.Store, project, chain string, orderIds []string) error {
+	seen := make(map[string]bool, len(orderIds))
+	ids := make([]string, 0, len(orderIds))
+	for _, orderId := range orderIds {
+		if orderId != "" && !seen[orderId] {
+			seen[orderId] = true
+			ids = append(ids, orderId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var orders []multi.Order
+	if err := db.WithContext(ctx).Table(gdb.GetMultiProjectOrderTableName(project, chain)).
+		Where("order_id in (?)", ids).
+		Order("id asc").
+		Find(&orders).Error; err != nil {
+		return errors.Wrap(err, "failed on query feed orders")
+	}
+	for i := range orders {
+		if err := Publish(kv, chain, OrderEvent(&orders[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
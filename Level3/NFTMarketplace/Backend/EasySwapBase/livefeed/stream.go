@@ -0,0 +1,125 @@
+package livefeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	// CacheFeedStreamPre 实时推送事件的 Redis Stream，每条链一个
+	CacheFeedStreamPre = "cache:es:feed:stream:%s"
+
+	// FeedMaxLen Stream 保留的最大事件数量（近似），客户端断线超过这个范围后需要重新拉取全量数据
+	FeedMaxLen = 50000
+
+	// publishScript 写入事件，ARGV: maxlen, event
+	publishScript = `return redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'event', ARGV[2])`
+
+	// rangeScript 按 ID 范围读取事件，返回 {id1, event1, id2, event2, ...}。ARGV: start, end, count
+	rangeScript = `local result = redis.call('XRANGE', KEYS[1], ARGV[1], ARGV[2], 'COUNT', ARGV[3])
+local items = {}
+for _, entry in ipairs(result) do
+    local value = ''
+    local fields = entry[2]
+    if fields then
+        for i = 1, #fields, 2 do
+            if fields[i] == 'event' then
+                value = fields[i + 1]
+            end
+        end
+    end
+    table.insert(items, entry[1])
+    table.insert(items, value)
+end
+return items`
+
+	// boundsScript 返回 Stream 中最早和最新的事件 ID，Stream 为空时返回空字符串
+	boundsScript = `local first = redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', 1)
+local last = redis.call('XREVRANGE', KEYS[1], '+', '-', 'COUNT', 1)
+local oldest = ''
+local latest = ''
+if first[1] then
+    oldest = first[1][1]
+end
+if last[1] then
+    latest = last[1][1]
+end
+return {oldest, latest}`
+)
+
+// GenFeedStreamKey 根据链名生成实时推送事件的 Stream 键
+func GenFeedStreamKey(chain string) string {
+	return fmt.Sprintf(CacheFeedStreamPre, strings.ToLower(chain))
+}
+
+// Publish 发布一个事件，事件中的地址统一转换为小写。
+// go-zero 的 redis 客户端没有 Stream 相关的命令，通过 Lua 脚本调用。
+func Publish(kv *xkv.Store, chain string, event *Event) error {
+	event.ID = ""
+	event.Chain = chain
+	event.CollectionAddr = strings.ToLower(event.CollectionAddr)
+	event.Maker = strings.ToLower(event.Maker)
+	event.Taker = strings.ToLower(event.Taker)
+	rawEvent, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal feed event")
+	}
+	if _, err := kv.Eval(publishScript, GenFeedStreamKey(chain), FeedMaxLen, string(rawEvent)); err != nil {
+		return errors.Wrap(err, "failed on publish feed event")
+	}
+	return nil
+}
+
+// ReadAfter 读取 after 之后（不含）最多 count 个事件，after 为空时从最早的事件开始读取
+func ReadAfter(kv *xkv.Store, chain, after string, count int) ([]*Event, error) {
+	return ReadRange(kv, chain, after, "+", count)
+}
+
+// ReadRange 读取 (after, end] 范围内最多 count 个事件，after 为空时从最早的事件开始读取
+func ReadRange(kv *xkv.Store, chain, after, end string, count int) ([]*Event, error) {
+	start := "-"
+	if after != "" {
+		// 不包含 after 本身，需要 Redis 6.2 以上
+		start = "(" + after
+	}
+	result, err := kv.Eval(rangeScript, GenFeedStreamKey(chain), start, end, count)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on read feed events")
+	}
+	items, _ := result.([]interface{})
+	events := make([]*Event, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		id, _ := items[i].(string)
+		raw, _ := items[i+1].(string)
+		var event Event
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			// 无法解析的事件跳过，但仍然返回 ID 让调用方推进读取位置
+			events = append(events, &Event{ID: id})
+			continue
+		}
+		event.ID = id
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// Bounds 返回 Stream 中最早和最新的事件 ID，Stream 为空时都返回空字符串
+func Bounds(kv *xkv.Store, chain string) (string, string, error) {
+	result, err := kv.Eval(boundsScript, GenFeedStreamKey(chain))
+	if err != nil && err != redis.Nil {
+		return "", "", errors.Wrap(err, "failed on read feed stream bounds")
+	}
+	items, _ := result.([]interface{})
+	if len(items) != 2 {
+		return "", "", nil
+	}
+	oldest, _ := items[0].(string)
+	latest, _ := items[1].(string)
+	return oldest, latest, nil
+}
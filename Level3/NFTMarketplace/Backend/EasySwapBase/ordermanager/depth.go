@@ -0,0 +1,326 @@
+package ordermanager
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+// 深度缓存中的订单方向
+const (
+	DepthAsk = "a" // 挂单
+	DepthBid = "b" // 集合出价
+)
+
+const (
+	// depthOrderPrefix 深度缓存中记录订单当前贡献的字段前缀，值为 "方向:价格:数量"
+	depthOrderPrefix = "o:"
+	// depthBatchSize 每次脚本调用写入的订单数量
+	depthBatchSize = 500
+
+	// depthEntriesScript 依次应用 ARGV 中的订单（每个订单 4 个参数：订单ID、方向、价格、数量）：
+	// 先撤销订单之前在价格档位上的数量，方向为空或数量为 0 时订单不再计入深度，否则计入新的价格档位。
+	// 按订单记录贡献使得同一个订单重复写入是幂等的。
+	depthEntriesScript = `for i = 1, #ARGV, 4 do
+    local field = 'o:' .. ARGV[i]
+    local old = redis.call('HGET', KEYS[1], field)
+    if old then
+        local side, price, qty = string.match(old, '^(%a):([^:]+):(%d+)$')
+        if side then
+            local level = side .. ':' .. price
+            if redis.call('HINCRBY', KEYS[1], level, -tonumber(qty)) <= 0 then
+                redis.call('HDEL', KEYS[1], level)
+            end
+        end
+        redis.call('HDEL', KEYS[1], field)
+    end
+    if ARGV[i + 1] ~= '' and tonumber(ARGV[i + 3]) > 0 then
+        redis.call('HINCRBY', KEYS[1], ARGV[i + 1] .. ':' .. ARGV[i + 2], ARGV[i + 3])
+        redis.call('HSET', KEYS[1], field, ARGV[i + 1] .. ':' .. ARGV[i + 2] .. ':' .. ARGV[i + 3])
+    end
+end
+return 1`
+	// replaceDepthScript 清空集合的深度后写入 ARGV 中的订单
+	replaceDepthScript = "redis.call('DEL', KEYS[1])\n" + depthEntriesScript
+)
+
+// GenCollectionDepthKey 集合订单深度的缓存键。
+// 哈希中 "a:价格"、"b:价格" 为挂单和集合出价在该价格上的剩余数量，"o:订单ID" 为订单当前计入的档位。
+func GenCollectionDepthKey(chain, address string) string {
+	return fmt.Sprintf("cache:es:%s:collection:depth:%s", strings.ToLower(chain), strings.ToLower(address))
+}
+
+// depthEntry 一个订单在深度中的贡献，Side 为空表示订单不计入深度
+type depthEntry struct {
+	OrderId  string
+	Side     string
+	Price    decimal.Decimal
+	Quantity int64
+}
+
+// depthOrder 计算订单深度需要的订单信息，Held 表示挂单的 maker 仍然持有挂单的 token
+type depthOrder struct {
+	OrderId           string          `gorm:"column:order_id"`
+	CollectionAddress string          `gorm:"column:collection_address"`
+	OrderType         int64           `gorm:"column:order_type"`
+	OrderStatus       int             `gorm:"column:order_status"`
+	Price             decimal.Decimal `gorm:"column:price"`
+	QuantityRemaining int64           `gorm:"column:quantity_remaining"`
+	ExpireTime        int64           `gorm:"column:expire_time"`
+	Held              bool            `gorm:"column:held"`
+}
+
+// depthEntryOf 计算订单在深度中的贡献：
+// 只有有效的挂单和集合出价计入深度，挂单还要求 maker 仍然持有 token；单个 item 的出价不计入集合深度
+func depthEntryOf(order *depthOrder, now int64) depthEntry {
+	entry := depthEntry{OrderId: order.OrderId}
+	if order.OrderStatus != multi.OrderStatusActive || order.ExpireTime <= now || order.QuantityRemaining <= 0 {
+		return entry
+	}
+	switch {
+	case order.OrderType == multi.ListingOrder && order.Held:
+		entry.Side = DepthAsk
+	case order.OrderType == multi.CollectionBidOrder:
+		entry.Side = DepthBid
+	default:
+		return entry
+	}
+	entry.Price = order.Price
+	entry.Quantity = order.QuantityRemaining
+	return entry
+}
+
+// depthArgs 把订单贡献转换为脚本参数
+func depthArgs(entries []depthEntry) []interface{} {
+	args := make([]interface{}, 0, len(entries)*4)
+	for _, entry := range entries {
+		price := ""
+		if entry.Side != "" {
+			price = entry.Price.Truncate(0).String()
+		}
+		args = append(args, entry.OrderId, entry.Side, price, entry.Quantity)
+	}
+	return args
+}
+
+// queryDepthOrders 查询计算深度需要的订单信息，where 中订单表别名为 co
+func (om *OrderManager) queryDepthOrders(where string, args ...interface{}) ([]*depthOrder, error) {
+	var orders []*depthOrder
+	sql := fmt.Sprintf(`select co.order_id, co.collection_address, co.order_type, co.order_status, co.price,
+        co.quantity_remaining, co.expire_time, (co.order_type <> %d or %s) as held
+        from %s as co left join %s as ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id
+        where %s`, multi.ListingOrder, om.heldByMakerCondition(),
+		gdb.GetMultiProjectOrderTableName(om.project, om.chain), gdb.GetMultiProjectItemTableName(om.project, om.chain), where)
+	if err := om.DB.WithContext(om.Ctx).Raw(sql, args...).Scan(&orders).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query depth orders")
+	}
+	return orders, nil
+}
+
+// RefreshDepth 按数据库中订单的最新状态更新它们在集合深度中的贡献。
+// 订单按数据库中所属的集合更新，不存在的订单从 collectionAddr 的深度中移除，collectionAddr 为空时忽略。
+// 重复刷新同一个订单是安全的，订单簿同步器在事务提交后刷新本次修改过的订单。
+func (om *OrderManager) RefreshDepth(collectionAddr string, orderIds []string) error {
+	if len(orderIds) == 0 {
+		return nil
+	}
+	orders, err := om.queryDepthOrders("co.order_id in (?)", orderIds)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	found := make(map[string]bool, len(orders))
+	collectionEntries := make(map[string][]depthEntry)
+	for _, order := range orders {
+		found[order.OrderId] = true
+		addr := strings.ToLower(order.CollectionAddress)
+		collectionEntries[addr] = append(collectionEntries[addr], depthEntryOf(order, now))
+	}
+	if collectionAddr != "" {
+		addr := strings.ToLower(collectionAddr)
+		for _, orderId := range orderIds {
+			if !found[orderId] {
+				collectionEntries[addr] = append(collectionEntries[addr], depthEntry{OrderId: orderId})
+			}
+		}
+	}
+
+	for addr, entries := range collectionEntries {
+		key := GenCollectionDepthKey(om.chain, addr)
+		for start := 0; start < len(entries); start += depthBatchSize {
+			end := start + depthBatchSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			if _, err := om.Xkv.Eval(depthEntriesScript, key, depthArgs(entries[start:end])...); err != nil {
+				return errors.Wrapf(err, "failed on update collection %s depth", addr)
+			}
+		}
+	}
+	return nil
+}
+
+// refreshTokenDepth 刷新一个 token 上全部有效挂单的深度，token 转移后挂单是否计入深度可能发生变化
+func (om *OrderManager) refreshTokenDepth(collectionAddr, tokenId string) error {
+	var orderIds []string
+	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Where("collection_address = ? and token_id = ? and order_type = ? and order_status = ?",
+			collectionAddr, tokenId, multi.ListingOrder, multi.OrderStatusActive).
+		Pluck("order_id", &orderIds).Error; err != nil {
+		return errors.Wrap(err, "failed on query token listings")
+	}
+	return om.RefreshDepth(collectionAddr, orderIds)
+}
+
+// RebuildDepth 根据数据库中的有效订单重建全部集合的深度。
+// 订单簿同步器在开始同步前调用，修复进程退出时没有来得及刷新的订单。
+func (om *OrderManager) RebuildDepth() error {
+	var collectionAddrs []string
+	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectCollectionTableName(om.project, om.chain)).
+		Pluck("address", &collectionAddrs).Error; err != nil {
+		return errors.Wrap(err, "failed on query collections")
+	}
+
+	now := time.Now().Unix()
+	orders, err := om.queryDepthOrders("co.order_status = ? and co.expire_time > ? and co.order_type in (?)",
+		multi.OrderStatusActive, now, []int64{multi.ListingOrder, multi.CollectionBidOrder})
+	if err != nil {
+		return err
+	}
+	collectionEntries := make(map[string][]depthEntry)
+	for _, order := range orders {
+		if entry := depthEntryOf(order, now); entry.Side != "" {
+			addr := strings.ToLower(order.CollectionAddress)
+			collectionEntries[addr] = append(collectionEntries[addr], entry)
+		}
+	}
+
+	for _, addr := range collectionAddrs {
+		entries := collectionEntries[strings.ToLower(addr)]
+		key := GenCollectionDepthKey(om.chain, addr)
+		// 第一批替换原有的深度，之后的批次追加
+		script := replaceDepthScript
+		for start := 0; start == 0 || start < len(entries); start += depthBatchSize {
+			end := start + depthBatchSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			if _, err := om.Xkv.Eval(script, key, depthArgs(entries[start:end])...); err != nil {
+				return errors.Wrapf(err, "failed on rebuild collection %s depth", addr)
+			}
+			script = depthEntriesScript
+		}
+	}
+	return nil
+}
+
+// PriceLevel 一个价格档位上的剩余数量
+type PriceLevel struct {
+	Price decimal.Decimal
+	Size  int64
+}
+
+// CollectionDepth 集合的挂单和集合出价深度，Asks 按价格升序，Bids 按价格降序
+type CollectionDepth struct {
+	Asks []PriceLevel
+	Bids []PriceLevel
+}
+
+// LoadDepth 从缓存读取集合的深度
+func LoadDepth(kv *xkv.Store, chain, collectionAddr string) (*CollectionDepth, error) {
+	fields, err := kv.Hgetall(GenCollectionDepthKey(chain, collectionAddr))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get collection depth")
+	}
+	return parseDepth(fields), nil
+}
+
+// parseDepth 解析深度缓存中的价格档位，忽略订单字段和无法解析的字段
+func parseDepth(fields map[string]string) *CollectionDepth {
+	depth := &CollectionDepth{}
+	for field, value := range fields {
+		if strings.HasPrefix(field, depthOrderPrefix) {
+			continue
+		}
+		side, rawPrice, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		price, err := decimal.NewFromString(rawPrice)
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			continue
+		}
+		switch side {
+		case DepthAsk:
+			depth.Asks = append(depth.Asks, PriceLevel{Price: price, Size: size})
+		case DepthBid:
+			depth.Bids = append(depth.Bids, PriceLevel{Price: price, Size: size})
+		}
+	}
+	sort.Slice(depth.Asks, func(i, j int) bool { return depth.Asks[i].Price.LessThan(depth.Asks[j].Price) })
+	sort.Slice(depth.Bids, func(i, j int) bool { return depth.Bids[i].Price.GreaterThan(depth.Bids[j].Price) })
+	return depth
+}
+
+// DepthLevel 合并到价格区间后的深度档位
+type DepthLevel struct {
+	Price           decimal.Decimal `json:"price"`            // 区间价格，挂单向上取整，出价向下取整
+	Size            int64           `json:"size"`             // 区间内的数量
+	Total           decimal.Decimal `json:"total"`            // 区间内按原始价格计算的总金额
+	CumulativeSize  int64           `json:"cumulative_size"`  // 从最优价格到本区间的累计数量
+	CumulativeTotal decimal.Decimal `json:"cumulative_total"` // 从最优价格到本区间的累计金额
+}
+
+// AggregateLevels 把按最优价格排序的档位合并到 bucket 大小的价格区间，并计算累计数量，最多返回 limit 个区间。
+// 挂单价格向上取整、出价价格向下取整，合并后买卖两侧不会交叉；bucket 不大于 0 时不合并。
+func AggregateLevels(levels []PriceLevel, bucket decimal.Decimal, isAsk bool, limit int) []DepthLevel {
+	var result []DepthLevel
+	var cumulativeSize int64
+	cumulativeTotal := decimal.Zero
+	for _, level := range levels {
+		price := level.Price
+		if bucket.IsPositive() {
+			steps := price.Div(bucket).Floor()
+			if isAsk {
+				steps = price.Div(bucket).Ceil()
+			}
+			price = steps.Mul(bucket)
+		}
+		total := level.Price.Mul(decimal.NewFromInt(level.Size))
+		cumulativeSize += level.Size
+		cumulativeTotal = cumulativeTotal.Add(total)
+
+		if n := len(result); n > 0 && result[n-1].Price.Equal(price) {
+			result[n-1].Size += level.Size
+			result[n-1].Total = result[n-1].Total.Add(total)
+			result[n-1].CumulativeSize = cumulativeSize
+			result[n-1].CumulativeTotal = cumulativeTotal
+			continue
+		}
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		result = append(result, DepthLevel{
+			Price:           price,
+			Size:            level.Size,
+			Total:           total,
+			CumulativeSize:  cumulativeSize,
+			CumulativeTotal: cumulativeTotal,
+		})
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestDepthEntryOf(t *testing.T) {
+	now := int64(1000)
+	listing := &depthOrder{OrderId: "1", OrderType: multi.ListingOrder, OrderStatus: multi.OrderStatusActive,
+		Price: decimal.NewFromInt(100), QuantityRemaining: 2, ExpireTime: 2000, Held: true}
+	entry := depthEntryOf(listing, now)
+	assert.Equal(t, DepthAsk, entry.Side)
+	assert.Equal(t, int64(2), entry.Quantity)
+
+	// maker 不再持有 token 的挂单不计入深度
+	listing.Held = false
+	assert.Equal(t, "", depthEntryOf(listing, now).Side)
+
+	bid := &depthOrder{OrderId: "2", OrderType: multi.CollectionBidOrder, OrderStatus: multi.OrderStatusActive,
+		Price: decimal.NewFromInt(90), QuantityRemaining: 3, ExpireTime: 2000}
+	assert.Equal(t, DepthBid, depthEntryOf(bid, now).Side)
+
+	// 过期、已成交和单个 item 的出价都不计入深度
+	bid.ExpireTime = now
+	assert.Equal(t, "", depthEntryOf(bid, now).Side)
+	bid.ExpireTime, bid.QuantityRemaining = 2000, 0
+	assert.Equal(t, "", depthEntryOf(bid, now).Side)
+	itemBid := &depthOrder{OrderId: "3", OrderType: multi.ItemBidOrder, OrderStatus: multi.OrderStatusActive,
+		Price: decimal.NewFromInt(90), QuantityRemaining: 1, ExpireTime: 2000}
+	assert.Equal(t, "", depthEntryOf(itemBid, now).Side)
+
+	assert.Equal(t, []interface{}{"1", "", "", int64(2)}, depthArgs([]depthEntry{{OrderId: "1", Quantity: 2}}))
+}
+
+func TestParseDepth(t *testing.T) {
+	depth := parseDepth(map[string]string{
+		"a:300":   "1",
+		"a:100":   "2",
+		"b:90":    "4",
+		"b:95":    "1",
+		"a:200":   "0",
+		"o:0xabc": "a:100:2",
+		"invalid": "1",
+	})
+	assert.Equal(t, []PriceLevel{{Price: decimal.NewFromInt(100), Size: 2}, {Price: decimal.NewFromInt(300), Size: 1}}, depth.Asks)
+	assert.Equal(t, []PriceLevel{{Price: decimal.NewFromInt(95), Size: 1}, {Price: decimal.NewFromInt(90), Size: 4}}, depth.Bids)
+}
+
+func TestAggregateLevels(t *testing.T) {
+	asks := []PriceLevel{
+		{Price: decimal.NewFromInt(101), Size: 1},
+		{Price: decimal.NewFromInt(105), Size: 2},
+		{Price: decimal.NewFromInt(120), Size: 1},
+		{Price: decimal.NewFromInt(135), Size: 1},
+	}
+	levels := AggregateLevels(asks, decimal.NewFromInt(10), true, 2)
+	assert.Len(t, levels, 2)
+	// 挂单价格向上取整：101 和 105 合并到 110
+	assert.True(t, levels[0].Price.Equal(decimal.NewFromInt(110)))
+	assert.Equal(t, int64(3), levels[0].Size)
+	assert.True(t, levels[0].Total.Equal(decimal.NewFromInt(311)))
+	assert.Equal(t, int64(4), levels[1].CumulativeSize)
+	assert.True(t, levels[1].CumulativeTotal.Equal(decimal.NewFromInt(431)))
+
+	bids := []PriceLevel{
+		{Price: decimal.NewFromInt(99), Size: 1},
+		{Price: decimal.NewFromInt(91), Size: 1},
+		{Price: decimal.NewFromInt(89), Size: 2},
+	}
+	levels = AggregateLevels(bids, decimal.NewFromInt(10), false, 0)
+	// 出价价格向下取整：99 和 91 合并到 90
+	assert.Len(t, levels, 2)
+	assert.True(t, levels[0].Price.Equal(decimal.NewFromInt(90)))
+	assert.Equal(t, int64(2), levels[0].Size)
+	assert.True(t, levels[1].Price.Equal(decimal.NewFromInt(80)))
+	assert.Equal(t, int64(4), levels[1].CumulativeSize)
+
+	// 不合并时按原始档位返回
+	assert.Len(t, AggregateLevels(bids, decimal.Zero, false, 0), 3)
+}
@@ -0,0 +1,548 @@
+package ordermanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/metric"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	// CacheTradeEventsStreamPre 交易事件的 Redis Stream，替代原来的列表 CacheTradeEventsQueuePre
+	CacheTradeEventsStreamPre = "cache:es:trade:events:stream:%s"
+
+	// TradeEventsGroup 地板价处理使用的消费组
+	TradeEventsGroup = "ordermanager"
+	// TradeEventsConsumer 消费组中消费者名称的前缀，后面加上主机名（Pod 名称），每个进程使用独立的消费者
+	TradeEventsConsumer = "floorprice"
+	// CacheTradeEventsDeadLetterPre 多次处理失败的交易事件转移到的死信 Stream
+	CacheTradeEventsDeadLetterPre = "cache:es:trade:events:dead:%s"
+	// TradeEventsMaxLen Stream 保留的最大事件数量（近似），已确认的事件会被立即删除
+	TradeEventsMaxLen = 100000
+	// TradeEventsFetchSize 每次读取的事件数量
+	TradeEventsFetchSize = 100
+	// TradeEventsRetryIdle 处理失败的事件保持未确认，空闲超过该时间后重新投递
+	TradeEventsRetryIdle = time.Minute
+	// TradeEventsMaxDeliveries 事件最多投递的次数，仍然处理失败时转移到死信 Stream
+	TradeEventsMaxDeliveries = 5
+	// TradeEventsDeadLetterMaxLen 死信 Stream 保留的最大事件数量（近似）
+	TradeEventsDeadLetterMaxLen = 10000
+
+	// pushTradeEventScript 写入事件，ARGV: maxlen, event
+	pushTradeEventScript = `return redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'event', ARGV[2])`
+
+	// createTradeEventsGroupScript 创建消费组，消费组已存在（BUSYGROUP）时忽略错误，ARGV: group
+	createTradeEventsGroupScript = `redis.pcall('XGROUP', 'CREATE', KEYS[1], ARGV[1], '0', 'MKSTREAM')
+return 1`
+
+	// readTradeEventsScript 读取事件，返回 {id1, event1, deliveries1, id2, event2, deliveries2, ...}。
+	// ARGV[4] 为 '>' 时读取新事件，否则读取本消费者 id 之后已投递未确认的事件。
+	// 脚本中不能阻塞，没有事件时返回空数组。ARGV: group, consumer, count, id
+	readTradeEventsScript = `local result = redis.call('XREADGROUP', 'GROUP', ARGV[1], ARGV[2], 'COUNT', ARGV[3], 'STREAMS', KEYS[1], ARGV[4])
+local items = {}
+if not result or not result[1] then
+    return items
+end
+for _, entry in ipairs(result[1][2]) do
+    local value = ''
+    local fields = entry[2]
+    if fields then
+        for i = 1, #fields, 2 do
+            if fields[i] == 'event' then
+                value = fields[i + 1]
+            end
+        end
+    end
+    local deliveries = 1
+    if ARGV[4] ~= '>' then
+        local pending = redis.call('XPENDING', KEYS[1], ARGV[1], entry[1], entry[1], 1)
+        if pending[1] then
+            deliveries = pending[1][4]
+        end
+    end
+    table.insert(items, entry[1])
+    table.insert(items, value)
+    table.insert(items, deliveries)
+end
+return items`
+
+	// claimTradeEventsScript 把消费组中空闲超过 min-idle 毫秒的未确认事件转移给当前消费者并返回，
+	// 返回 {next, id1, event1, deliveries1, ...}，next 为下一次的起始 id，为 '0-0' 时已扫描完一轮。
+	// 处理失败的事件、其他进程退出时留下的事件都会被重新投递。需要 Redis 6.2 以上。
+	// ARGV: group, consumer, min-idle, start, count
+	claimTradeEventsScript = `local result = redis.call('XAUTOCLAIM', KEYS[1], ARGV[1], ARGV[2], ARGV[3], ARGV[4], 'COUNT', ARGV[5])
+local items = {result[1]}
+for _, entry in ipairs(result[2]) do
+    if entry then
+        local value = ''
+        local fields = entry[2]
+        if fields then
+            for i = 1, #fields, 2 do
+                if fields[i] == 'event' then
+                    value = fields[i + 1]
+                end
+            end
+        end
+        local deliveries = 1
+        local pending = redis.call('XPENDING', KEYS[1], ARGV[1], entry[1], entry[1], 1)
+        if pending[1] then
+            deliveries = pending[1][4]
+        end
+        table.insert(items, entry[1])
+        table.insert(items, value)
+        table.insert(items, deliveries)
+    end
+end
+return items`
+
+	// deadLetterTradeEventScript 写入死信 Stream，ARGV: maxlen, id, event, error, deliveries
+	deadLetterTradeEventScript = `return redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'id', ARGV[2], 'event', ARGV[3], 'error', ARGV[4], 'deliveries', ARGV[5])`
+
+	// ackTradeEventsScript 确认并删除事件，ARGV: group, id...
+	ackTradeEventsScript = `local ids = {}
+for i = 2, #ARGV do
+    table.insert(ids, ARGV[i])
+end
+redis.call('XACK', KEYS[1], ARGV[1], unpack(ids))
+return redis.call('XDEL', KEYS[1], unpack(ids))`
+)
+
+var (
+	// tradeEventsPushed 写入队列的交易事件数量
+	tradeEventsPushed = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: "ordermanager",
+		Subsystem: "trade_events",
+		Name:      "pushed_total",
+		Help:      "trade events pushed to the floor price queue.",
+		Labels:    []string{"chain", "event_type"},
+	})
+	// tradeEventsHandled 地板价处理完成的交易事件数量，result 为 ok / error / invalid / skipped / dead_letter
+	tradeEventsHandled = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: "ordermanager",
+		Subsystem: "trade_events",
+		Name:      "handled_total",
+		Help:      "trade events handled by the floor price process.",
+		Labels:    []string{"chain", "event_type", "result"},
+	})
+	// tradeEventsRedelivered 启动时重新投递的未确认事件数量
+	tradeEventsRedelivered = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: "ordermanager",
+		Subsystem: "trade_events",
+		Name:      "redelivered_total",
+		Help:      "unacknowledged trade events redelivered after restart.",
+		Labels:    []string{"chain", "event_type"},
+	})
+)
+
+func genTradeEventsStreamKey(chain string) string {
+	return fmt.Sprintf(CacheTradeEventsStreamPre, chain)
+}
+
+func genTradeEventsDeadLetterKey(chain string) string {
+	return fmt.Sprintf(CacheTradeEventsDeadLetterPre, chain)
+}
+
+// tradeEventsConsumerName 返回当前进程的消费者名称，Kubernetes 中主机名即 Pod 名称，获取失败时使用进程号
+func tradeEventsConsumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = strconv.Itoa(os.Getpid())
+	}
+	return TradeEventsConsumer + "-" + host
+}
+
+// String 返回事件类型的名称，用于日志和监控标签
+func (t EventType) String() string {
+	switch t {
+	case Buy:
+		return "buy"
+	case Mint:
+		return "mint"
+	case Listing:
+		return "listing"
+	case Cancel:
+		return "cancel"
+	case Transfer:
+		return "transfer"
+	case Expired:
+		return "expired"
+	case ImportCollection:
+		return "import_collection"
+	case UpdateCollection:
+		return "update_collection"
+	case Edit:
+		return "edit"
+	default:
+		return "unknown"
+	}
+}
+
+// QueuedTradeEvent 从队列中读取的事件，处理完成后需要通过 Ack 确认
+type QueuedTradeEvent struct {
+	ID  string
+	Raw string
+	// Deliveries 事件已投递的次数，包括本次
+	Deliveries int64
+}
+
+// TradeEventQueue 地板价更新使用的可靠事件队列。
+// 事件读取后在确认之前一直保留，处理失败或进程在处理过程中退出时，事件空闲超过 TradeEventsRetryIdle 后重新投递，
+// 重启后通过 Recover 立即重新投递本消费者的事件。事件至少被处理一次，地板价处理逻辑需要保证重复处理是安全的。
+type TradeEventQueue interface {
+	// Push 写入一个事件
+	Push(event *TradeEvent) error
+	// Recover 启动时调用，之后的 Fetch 先返回之前已投递但未确认的事件，再返回新事件，返回重新投递的事件数量
+	Recover() (int, error)
+	// Fetch 读取最多 limit 个事件，优先返回空闲超过 TradeEventsRetryIdle 的未确认事件，没有事件时返回空
+	Fetch(limit int) ([]*QueuedTradeEvent, error)
+	// Ack 确认事件处理完成，确认后的事件不会再被投递
+	Ack(ids ...string) error
+	// DeadLetter 把多次处理失败的事件转移到死信队列并确认
+	DeadLetter(event *QueuedTradeEvent, cause error) error
+}
+
+// redisTradeEventQueue 基于 Redis Stream 消费组的 TradeEventQueue 实现。
+// go-zero 的 redis 客户端没有 Stream 相关的命令，通过 Lua 脚本调用。
+type redisTradeEventQueue struct {
+	kv       *xkv.Store
+	chain    string
+	consumer string
+
+	// pending 为 true 时从 pendingStart 之后读取本消费者已投递未确认的事件，读完后切换为读取新事件
+	pending      bool
+	pendingStart string
+	// claimStart 下一次转移空闲事件的起始 id，lastClaim 上一次转移的时间
+	claimStart string
+	lastClaim  time.Time
+	ready      bool
+}
+
+// NewRedisTradeEventQueue 创建基于 Redis Stream 的交易事件队列，消费者名称包含主机名
+func NewRedisTradeEventQueue(kv *xkv.Store, chain string) TradeEventQueue {
+	return &redisTradeEventQueue{kv: kv, chain: chain, consumer: tradeEventsConsumerName(), claimStart: "0-0"}
+}
+
+func (q *redisTradeEventQueue) key() string {
+	return genTradeEventsStreamKey(q.chain)
+}
+
+func (q *redisTradeEventQueue) Push(event *TradeEvent) error {
+	rawEvent, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal event")
+	}
+	if _, err := q.kv.Eval(pushTradeEventScript, q.key(), TradeEventsMaxLen, string(rawEvent)); err != nil {
+		return errors.Wrap(err, "failed on push trade event to queue")
+	}
+	tradeEventsPushed.Inc(q.chain, event.EventType.String())
+	return nil
+}
+
+// ensureGroup 创建 Stream 和消费组
+func (q *redisTradeEventQueue) ensureGroup() error {
+	if q.ready {
+		return nil
+	}
+	if _, err := q.kv.Eval(createTradeEventsGroupScript, q.key(), TradeEventsGroup); err != nil {
+		return errors.Wrap(err, "failed on create trade events consumer group")
+	}
+	q.ready = true
+	return nil
+}
+
+func (q *redisTradeEventQueue) Recover() (int, error) {
+	if err := q.ensureGroup(); err != nil {
+		return 0, err
+	}
+	if err := q.migrateLegacyQueue(); err != nil {
+		return 0, err
+	}
+
+	// 统计本消费者（同一主机重启前）未确认的事件，之后的 Fetch 先返回这些事件。
+	// 其他消费者（已退出的 Pod、旧版本进程）留下的事件空闲超过 TradeEventsRetryIdle 后由 Fetch 转移过来
+	q.pending = true
+	q.pendingStart = "0"
+	count := 0
+	id := "0"
+	for {
+		events, err := q.read(id, TradeEventsFetchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, event := range events {
+			var tradeEvent TradeEvent
+			_ = json.Unmarshal([]byte(event.Raw), &tradeEvent)
+			tradeEventsRedelivered.Inc(q.chain, tradeEvent.EventType.String())
+		}
+		count += len(events)
+		if len(events) < TradeEventsFetchSize {
+			return count, nil
+		}
+		id = events[len(events)-1].ID
+	}
+}
+
+// migrateLegacyQueue 把旧版本列表队列中剩余的事件按顺序转移到 Stream 中
+func (q *redisTradeEventQueue) migrateLegacyQueue() error {
+	key := genTradeEventsCacheKey(q.chain)
+	for {
+		result, err := q.kv.Lpop(key)
+		if err == redis.Nil || (err == nil && result == "") {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed on pop legacy trade events")
+		}
+		if _, err := q.kv.Eval(pushTradeEventScript, q.key(), TradeEventsMaxLen, result); err != nil {
+			// 写入失败时放回列表头部，下次启动继续迁移
+			_, _ = q.kv.Lpush(key, result)
+			return errors.Wrap(err, "failed on migrate legacy trade event")
+		}
+	}
+}
+
+func (q *redisTradeEventQueue) Fetch(limit int) ([]*QueuedTradeEvent, error) {
+	if err := q.ensureGroup(); err != nil {
+		return nil, err
+	}
+	if q.pending {
+		// 按 id 顺序读取一遍，处理失败的事件保持未确认，空闲超时后再重新投递
+		events, err := q.read(q.pendingStart, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 {
+			q.pendingStart = events[len(events)-1].ID
+			return events, nil
+		}
+		q.pending = false
+	}
+
+	// 每隔 TradeEventsRetryIdle 扫描一次空闲的未确认事件，一轮扫描完之前连续转移
+	if q.claimStart != "0-0" || time.Since(q.lastClaim) >= TradeEventsRetryIdle {
+		if q.claimStart == "0-0" {
+			q.lastClaim = time.Now()
+		}
+		events, err := q.claim(limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 {
+			return events, nil
+		}
+	}
+	return q.read(">", limit)
+}
+
+// claim 通过 XAUTOCLAIM 转移空闲超过 TradeEventsRetryIdle 的未确认事件
+func (q *redisTradeEventQueue) claim(limit int) ([]*QueuedTradeEvent, error) {
+	result, err := q.kv.Eval(claimTradeEventsScript, q.key(), TradeEventsGroup, q.consumer,
+		TradeEventsRetryIdle.Milliseconds(), q.claimStart, limit)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on claim idle trade events")
+	}
+	items, _ := result.([]interface{})
+	if len(items) == 0 {
+		q.claimStart = "0-0"
+		return nil, nil
+	}
+	q.claimStart, _ = items[0].(string)
+	if q.claimStart == "" {
+		q.claimStart = "0-0"
+	}
+	return parseQueuedTradeEvents(items[1:]), nil
+}
+
+// read 通过 XREADGROUP 读取事件，id 为 '>' 时读取新事件，否则读取 id 之后已投递未确认的事件
+func (q *redisTradeEventQueue) read(id string, limit int) ([]*QueuedTradeEvent, error) {
+	result, err := q.kv.Eval(readTradeEventsScript, q.key(), TradeEventsGroup, q.consumer, limit, id)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on read trade events from queue")
+	}
+	items, _ := result.([]interface{})
+	return parseQueuedTradeEvents(items), nil
+}
+
+// parseQueuedTradeEvents 解析脚本返回的 {id, event, deliveries, ...}
+func parseQueuedTradeEvents(items []interface{}) []*QueuedTradeEvent {
+	events := make([]*QueuedTradeEvent, 0, len(items)/3)
+	for i := 0; i+2 < len(items); i += 3 {
+		id, _ := items[i].(string)
+		raw, _ := items[i+1].(string)
+		deliveries, _ := items[i+2].(int64)
+		events = append(events, &QueuedTradeEvent{ID: id, Raw: raw, Deliveries: deliveries})
+	}
+	return events
+}
+
+func (q *redisTradeEventQueue) Ack(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, TradeEventsGroup)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := q.kv.Eval(ackTradeEventsScript, q.key(), args...); err != nil {
+		return errors.Wrap(err, "failed on ack trade events")
+	}
+	return nil
+}
+
+// DeadLetter 先写入死信 Stream 再确认，确认失败时事件会再次投递并重复写入死信，不会丢失
+func (q *redisTradeEventQueue) DeadLetter(event *QueuedTradeEvent, cause error) error {
+	if _, err := q.kv.Eval(deadLetterTradeEventScript, genTradeEventsDeadLetterKey(q.chain),
+		TradeEventsDeadLetterMaxLen, event.ID, event.Raw, cause.Error(), event.Deliveries); err != nil {
+		return errors.Wrap(err, "failed on dead letter trade event")
+	}
+	return q.Ack(event.ID)
+}
+
+// MemoryTradeEventQueue 内存版 TradeEventQueue，投递、重新投递和确认语义与 Redis 实现一致，用于单元测试
+type MemoryTradeEventQueue struct {
+	mu      sync.Mutex
+	seq     int
+	events  []*QueuedTradeEvent
+	unacked []*QueuedTradeEvent
+	dead    []*QueuedTradeEvent
+	// deliveredAt 未确认事件上一次投递的时间
+	deliveredAt map[string]time.Time
+	// retryIdle 未确认事件重新投递前的空闲时间，默认为 TradeEventsRetryIdle
+	retryIdle time.Duration
+	// pending 为 true 时依次返回 pendingAfter 之后的未确认事件
+	pending      bool
+	pendingAfter int
+}
+
+// NewMemoryTradeEventQueue 创建内存版交易事件队列
+func NewMemoryTradeEventQueue() *MemoryTradeEventQueue {
+	return &MemoryTradeEventQueue{deliveredAt: make(map[string]time.Time), retryIdle: TradeEventsRetryIdle}
+}
+
+func (q *MemoryTradeEventQueue) Push(event *TradeEvent) error {
+	rawEvent, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal event")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	q.events = append(q.events, &QueuedTradeEvent{ID: strconv.Itoa(q.seq), Raw: string(rawEvent)})
+	return nil
+}
+
+func (q *MemoryTradeEventQueue) Recover() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = true
+	q.pendingAfter = 0
+	return len(q.unacked), nil
+}
+
+func (q *MemoryTradeEventQueue) Fetch(limit int) ([]*QueuedTradeEvent, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if q.pending {
+		var events []*QueuedTradeEvent
+		for _, event := range q.unacked {
+			if id, _ := strconv.Atoi(event.ID); id > q.pendingAfter && len(events) < limit {
+				events = append(events, event)
+			}
+		}
+		if len(events) > 0 {
+			q.pendingAfter, _ = strconv.Atoi(events[len(events)-1].ID)
+			return q.deliver(events, now), nil
+		}
+		q.pending = false
+	}
+
+	// 空闲超过 retryIdle 的未确认事件重新投递
+	var retries []*QueuedTradeEvent
+	for _, event := range q.unacked {
+		if now.Sub(q.deliveredAt[event.ID]) >= q.retryIdle && len(retries) < limit {
+			retries = append(retries, event)
+		}
+	}
+	if len(retries) > 0 {
+		return q.deliver(retries, now), nil
+	}
+
+	events := q.events[:minInt(limit, len(q.events))]
+	q.events = q.events[len(events):]
+	q.unacked = append(q.unacked, events...)
+	return q.deliver(events, now), nil
+}
+
+// deliver 增加事件的投递次数，返回事件的副本
+func (q *MemoryTradeEventQueue) deliver(events []*QueuedTradeEvent, now time.Time) []*QueuedTradeEvent {
+	delivered := make([]*QueuedTradeEvent, 0, len(events))
+	for _, event := range events {
+		event.Deliveries++
+		q.deliveredAt[event.ID] = now
+		copied := *event
+		delivered = append(delivered, &copied)
+	}
+	return delivered
+}
+
+func (q *MemoryTradeEventQueue) Ack(ids ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ack(ids...)
+	return nil
+}
+
+func (q *MemoryTradeEventQueue) ack(ids ...string) {
+	acked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		acked[id] = true
+		delete(q.deliveredAt, id)
+	}
+	unacked := q.unacked[:0]
+	for _, event := range q.unacked {
+		if !acked[event.ID] {
+			unacked = append(unacked, event)
+		}
+	}
+	q.unacked = unacked
+}
+
+func (q *MemoryTradeEventQueue) DeadLetter(event *QueuedTradeEvent, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	copied := *event
+	q.dead = append(q.dead, &copied)
+	q.ack(event.ID)
+	return nil
+}
+
+// Len 返回尚未确认的事件数量（包括未投递的）
+func (q *MemoryTradeEventQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events) + len(q.unacked)
+}
+
+// DeadLetters 返回转移到死信队列的事件
+func (q *MemoryTradeEventQueue) DeadLetters() []*QueuedTradeEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*QueuedTradeEvent(nil), q.dead...)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package ordermanager
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func newTestFloorPriceManager(events TradeEventQueue) *OrderManager {
+	return &OrderManager{
+		Ctx:                xzap.ToContext(context.Background(), zap.NewNop()),
+		chain:              "sepolia",
+		events:             events,
+		collectionOrders:   make(map[string]*collectionTradeInfo),
+		collectionListedCh: make(chan string, 100),
+	}
+}
+
+// useMockDB 为 OrderManager 设置 sqlmock 数据库
+func useMockDB(t *testing.T, om *OrderManager) sqlmock.Sqlmock {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}),
+		&gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	om.DB, om.project = db, gdb.OrderBookDexProject
+	return mock
+}
+
+// expectOrderStatus 期望查询一次订单状态
+func expectOrderStatus(mock sqlmock.Sqlmock, orderId string, status int) {
+	mock.ExpectQuery("SELECT `order_status` FROM `ob_order_sepolia`").WithArgs(orderId).
+		WillReturnRows(sqlmock.NewRows([]string{"order_status"}).AddRow(status))
+}
+
+func TestMemoryTradeEventQueue(t *testing.T) {
+	queue := NewMemoryTradeEventQueue()
+	assert.NoError(t, queue.Push(&TradeEvent{EventType: Cancel, OrderId: "0x01"}))
+	assert.NoError(t, queue.Push(&TradeEvent{EventType: Cancel, OrderId: "0x02"}))
+
+	events, err := queue.Fetch(1)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	// 未确认的事件在 Recover 之前不会重复投递
+	events, err = queue.Fetch(10)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, 2, queue.Len())
+
+	// 重启后未确认的事件按顺序重新投递
+	redelivered, err := queue.Recover()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, redelivered)
+	events, err = queue.Fetch(10)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "1", events[0].ID)
+
+	assert.NoError(t, queue.Ack(events[0].ID, events[1].ID))
+	events, err = queue.Fetch(10)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, 0, queue.Len())
+}
+
+func TestTradeEventsRedeliveredAfterCrash(t *testing.T) {
+	queue := NewMemoryTradeEventQueue()
+	const collection = "0xc1"
+
+	// 第一个进程读取了事件，但在处理完成前退出
+	assert.NoError(t, queue.Push(&TradeEvent{EventType: ImportCollection, CollectionAddr: collection}))
+	assert.NoError(t, queue.Push(&TradeEvent{EventType: ImportCollection, CollectionAddr: "0xc2"}))
+	_, err := queue.Fetch(TradeEventsFetchSize)
+	assert.NoError(t, err)
+
+	// 重启后事件没有丢失
+	om := newTestFloorPriceManager(queue)
+	mock := useMockDB(t, om)
+	redelivered, err := om.events.Recover()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, redelivered)
+	assert.Equal(t, 2, om.processTradeEvents())
+	assert.Contains(t, om.collectionOrders, collection)
+	assert.Contains(t, om.collectionOrders, "0xc2")
+	assert.Equal(t, 0, queue.Len())
+
+	// 新事件处理后确认
+	om.collectionOrders[collection].orders.Add("0x01", decimal.NewFromInt(1), "0xm1", "1")
+	om.collectionOrders[collection].orders.Add("0x03", decimal.NewFromInt(3), "0xm3", "3")
+	om.collectionOrders[collection].floorPrice = decimal.NewFromInt(1)
+	expectOrderStatus(mock, "0x02", multi.OrderStatusActive)
+	assert.NoError(t, om.addUpdateFloorPriceEvent(&TradeEvent{
+		EventType:      Listing,
+		CollectionAddr: collection,
+		OrderId:        "0x02",
+		TokenID:        "2",
+		From:           "0xm2",
+		Price:          decimal.NewFromInt(2),
+	}))
+	assert.Equal(t, 1, om.processTradeEvents())
+	assert.Equal(t, 3, om.collectionOrders[collection].orders.Len())
+	assert.Equal(t, 0, queue.Len())
+
+	// 未跟踪集合的事件跳过并确认，不进入死信队列
+	assert.NoError(t, queue.Push(&TradeEvent{EventType: Cancel, CollectionAddr: "0xunknown", OrderId: "0x04"}))
+	assert.Equal(t, 1, om.processTradeEvents())
+	assert.Equal(t, 0, queue.Len())
+
+	// 处理失败的事件保持未确认，空闲超时之前不会重新投递
+	assert.NoError(t, queue.Push(&TradeEvent{EventType: EventType(99), CollectionAddr: collection, OrderId: "0x04"}))
+	assert.Equal(t, 1, om.processTradeEvents())
+	assert.Equal(t, 0, om.processTradeEvents())
+	assert.Equal(t, 1, queue.Len())
+
+	// 空闲超时后重新投递，达到最大投递次数后转移到死信队列
+	queue.retryIdle = 0
+	for i := 1; i < TradeEventsMaxDeliveries; i++ {
+		assert.Equal(t, 1, om.processTradeEvents())
+	}
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, 0, om.processTradeEvents())
+	dead := queue.DeadLetters()
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, int64(TradeEventsMaxDeliveries), dead[0].Deliveries)
+	}
+
+	// 无法解析的事件直接确认
+	queue.events = append(queue.events, &QueuedTradeEvent{ID: "100", Raw: "{"})
+	assert.Equal(t, 1, om.processTradeEvents())
+	assert.Equal(t, 0, queue.Len())
+	assert.Len(t, queue.DeadLetters(), 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListingRedeliveredAfterCancel(t *testing.T) {
+	const collection = "0xc1"
+	om := newTestFloorPriceManager(NewMemoryTradeEventQueue())
+	mock := useMockDB(t, om)
+	om.collectionOrders[collection] = &collectionTradeInfo{floorPrice: decimal.NewFromInt(5), orders: NewPriorityQueueMap(maxQueueLength)}
+	om.collectionOrders[collection].orders.Add("0x01", decimal.NewFromInt(5), "0xm1", "1")
+	listing := &TradeEvent{
+		EventType:      Listing,
+		CollectionAddr: collection,
+		OrderId:        "0x02",
+		TokenID:        "2",
+		From:           "0xm2",
+		Price:          decimal.NewFromInt(1),
+	}
+
+	// 挂单事件在取消事件之后重新投递，已经取消的订单不会重新成为地板价
+	expectOrderStatus(mock, "0x02", multi.OrderStatusCancelled)
+	assert.NoError(t, om.handleTradeEvent(listing))
+	orderId, price := om.collectionOrders[collection].orders.GetMin()
+	assert.Equal(t, "0x01", orderId)
+	assert.True(t, price.Equal(decimal.NewFromInt(5)))
+
+	// 订单被链重组撤销时同样不添加
+	mock.ExpectQuery("SELECT `order_status` FROM `ob_order_sepolia`").WithArgs("0x02").
+		WillReturnRows(sqlmock.NewRows([]string{"order_status"}))
+	assert.NoError(t, om.handleTradeEvent(listing))
+	assert.Equal(t, 1, om.collectionOrders[collection].orders.Len())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTradeEventsConsumerName(t *testing.T) {
+	name := tradeEventsConsumerName()
+	assert.True(t, strings.HasPrefix(name, TradeEventsConsumer+"-"))
+	assert.Greater(t, len(name), len(TradeEventsConsumer)+1)
+}
+
+func TestEditEventOnlyForListings(t *testing.T) {
+	queue := NewMemoryTradeEventQueue()
+	const collection = "0xc1"
+	om := newTestFloorPriceManager(queue)
+	om.collectionOrders[collection] = &collectionTradeInfo{orders: NewPriorityQueueMap(maxQueueLength)}
+	om.collectionOrders[collection].orders.Add("0x01", decimal.NewFromInt(5), "0xm1", "1")
+
+	// 修改出价不进入地板价队列，被替换的订单也不会被移除
+	assert.NoError(t, om.handleTradeEvent(&TradeEvent{
+		EventType:      Edit,
+		CollectionAddr: collection,
+		OrderId:        "0x02",
+		PrevOrderId:    "0x01",
+		TokenID:        "1",
+		From:           "0xm1",
+		Price:          decimal.NewFromInt(1),
+		OrderType:      multi.CollectionBidOrder,
+	}))
+	orderId, price := om.collectionOrders[collection].orders.GetMin()
+	assert.Equal(t, "0x01", orderId)
+	assert.True(t, price.Equal(decimal.NewFromInt(5)))
+	assert.Equal(t, 1, om.collectionOrders[collection].orders.Len())
+}
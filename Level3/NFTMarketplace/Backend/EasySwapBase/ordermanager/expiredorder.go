@@ -2,21 +2,144 @@ package ordermanager
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/livefeed"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 )
 
+const (
+	// CacheOrderExpiryPre 订单过期调度的有序集合，member 为 order_id,collection_address，score 为过期时间
+	CacheOrderExpiryPre = "cache:es:orders:expiry:%s"
+	// CacheOrderExpirySeededPre 标记过期调度已经从数据库初始化过，之后重启不再扫描订单表
+	CacheOrderExpirySeededPre = "cache:es:orders:expiry:seeded:%s"
+
+	// ExpiryCheckInterval 检查到期订单的间隔（秒）
+	ExpiryCheckInterval = 1
+	// ExpiryClaimSize 每次领取的到期订单数量
+	ExpiryClaimSize = 100
+	// ExpiryLease 领取后的租约（秒），处理前进程退出时，租约到期后订单会被重新领取
+	ExpiryLease = 60
+	// ExpirySeedMaxBackoff 从数据库初始化过期调度失败后重试的最大间隔（秒）
+	ExpirySeedMaxBackoff = 60
+
+	// claimExpiryScript 原子地领取到期的订单：取出 score <= now 的成员，并把 score 改为租约到期时间，
+	// 多个副本同时领取时每个成员只会被其中一个副本拿到
+	claimExpiryScript = `local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, item in ipairs(items) do
+    redis.call('ZADD', KEYS[1], ARGV[3], item)
+end
+return items`
+)
+
+func genOrderExpiryCacheKey(chain string) string {
+	return fmt.Sprintf(CacheOrderExpiryPre, chain)
+}
+
+func genOrderExpirySeededCacheKey(chain string) string {
+	return fmt.Sprintf(CacheOrderExpirySeededPre, chain)
+}
+
+// expiryTask 一个待过期的订单
+type expiryTask struct {
+	OrderId        string
+	CollectionAddr string
+	ExpireAt       int64
+}
+
+func (t expiryTask) member() string {
+	return t.OrderId + "," + t.CollectionAddr
+}
+
+func parseExpiryMember(member string) (expiryTask, error) {
+	parts := strings.SplitN(member, ",", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return expiryTask{}, errors.Errorf("invalid expiry member %s", member)
+	}
+	return expiryTask{OrderId: parts[0], CollectionAddr: parts[1]}, nil
+}
+
+// expiryStore 持久化的订单过期调度，多个副本共享
+type expiryStore interface {
+	// Schedule 添加或更新一个订单的过期时间
+	Schedule(task expiryTask) error
+	// Claim 领取 now 之前到期的订单，领取后 lease 秒内其他副本不会再领取到
+	Claim(now int64, limit int, lease int64) ([]expiryTask, error)
+	// Done 订单处理完成，从调度中删除
+	Done(task expiryTask) error
+	// Seeded 返回调度是否已经从数据库初始化过
+	Seeded() (bool, error)
+	// MarkSeeded 标记调度已经从数据库初始化
+	MarkSeeded() error
+}
+
+// redisExpiryStore 基于 Redis 有序集合的 expiryStore 实现，score 为过期时间
+type redisExpiryStore struct {
+	kv    *xkv.Store
+	chain string
+}
+
+func newRedisExpiryStore(kv *xkv.Store, chain string) *redisExpiryStore {
+	return &redisExpiryStore{kv: kv, chain: chain}
+}
+
+func (s *redisExpiryStore) Schedule(task expiryTask) error {
+	if _, err := s.kv.Zadd(genOrderExpiryCacheKey(s.chain), task.ExpireAt, task.member()); err != nil {
+		return errors.Wrap(err, "failed on add order to expiry schedule")
+	}
+	return nil
+}
+
+func (s *redisExpiryStore) Claim(now int64, limit int, lease int64) ([]expiryTask, error) {
+	result, err := s.kv.Eval(claimExpiryScript, genOrderExpiryCacheKey(s.chain), now, limit, now+lease)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on claim expired orders")
+	}
+	members, _ := result.([]interface{})
+	tasks := make([]expiryTask, 0, len(members))
+	for _, member := range members {
+		value, _ := member.(string)
+		task, err := parseExpiryMember(value)
+		if err != nil {
+			// 无法解析的成员直接删除，避免反复领取
+			_, _ = s.kv.Zrem(genOrderExpiryCacheKey(s.chain), value)
+			continue
+		}
+		task.ExpireAt = now
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *redisExpiryStore) Done(task expiryTask) error {
+	if _, err := s.kv.Zrem(genOrderExpiryCacheKey(s.chain), task.member()); err != nil {
+		return errors.Wrap(err, "failed on remove order from expiry schedule")
+	}
+	return nil
+}
+
+func (s *redisExpiryStore) Seeded() (bool, error) {
+	return s.kv.Exists(genOrderExpirySeededCacheKey(s.chain))
+}
+
+func (s *redisExpiryStore) MarkSeeded() error {
+	return s.kv.Set(genOrderExpirySeededCacheKey(s.chain), fmt.Sprintf("%d", time.Now().Unix()))
+}
+
 // orderExpiryProcess 函数负责处理订单过期的逻辑,主要包含以下功能:
 // 1. 使用defer recover防止panic导致主协程退出
-// 2. 启动时从数据库加载所有活跃订单到时间轮队列
-// 3. 每秒检查一次时间轮,处理到期的订单
+// 2. 首次启动时从数据库加载活跃订单到过期调度中，之后重启直接使用 Redis 中的调度，加载失败时退避重试
+// 3. 每秒领取一次到期的订单并更新状态，停机期间到期的订单在启动后立即被领取
 func (om *OrderManager) orderExpiryProcess() {
 	// 1. 使用 defer recover 来捕获可能的 panic,防止主协程死掉
 	defer func() {
@@ -25,70 +148,87 @@ func (om *OrderManager) orderExpiryProcess() {
 		}
 	}()
 
-	// 2. 启动时从数据库加载所有活跃订单到时间轮队列中
-	if err := om.loadOrdersToQueue(); err != nil {
-		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err))
+	// 2. 调度为空时从数据库初始化
+	if !om.seedExpiryScheduleWithRetry(time.Second) {
 		return
 	}
 
-	// 3. 每秒检查一次时间轮
+	// 3. 每秒检查一次到期订单
 	for {
 		select {
-		case <-time.After(time.Second * 1): // 每秒执行一次检查
-			// 如果当前索引超过时间轮大小,则取模重置
-			if om.CurrentIndex >= WheelSize {
-				om.CurrentIndex = om.CurrentIndex % WheelSize
-			}
+		case <-om.Ctx.Done():
+			return
+		case <-time.After(time.Second * ExpiryCheckInterval):
+			om.processDueExpiries(time.Now().Unix())
+		}
+	}
+}
 
-			// 获取当前时间槽的任务链表头
-			taskLinkHead := om.TimeWheel[om.CurrentIndex].NotifyActivities
-			headIndex := om.CurrentIndex
-			om.CurrentIndex++
-
-			// prev指向前一个节点,p指向当前节点
-			prev := taskLinkHead
-			p := taskLinkHead
-
-			// 遍历当前时间槽的所有任务
-			for p != nil {
-				// 如果任务的循环计数为0,说明到期需要处理
-				if p.CycleCount == 0 {
-					// 异步更新订单状态,避免阻塞主循环
-					go func(chain string, orderId string, collectionAddr string) {
-						if err := om.updateOrderState(orderId, collectionAddr); err != nil {
-							xzap.WithContext(om.Ctx).Error("failed on update order status", zap.Error(err), zap.String("chain", chain), zap.String("order_id", orderId))
-						}
-					}(p.ChainSuffix, p.orderID, p.CollectionAddr)
-
-					// 从链表中删除该节点
-					if prev == p { // 如果是头节点
-						om.TimeWheel[headIndex].NotifyActivities = p.Next
-						prev = p.Next
-						p = p.Next
-					} else { // 如果不是头节点
-						prev.Next = p.Next
-						p = p.Next
-					}
-				} else {
-					// 如果任务未到期,循环计数减1
-					p.CycleCount--
-					prev = p
-					p = p.Next
-				}
+// processDueExpiries 领取 now 之前到期的订单并逐个处理，返回处理完成的订单数量。
+// 处理失败的订单不删除，租约到期后会被重新领取。
+func (om *OrderManager) processDueExpiries(now int64) int {
+	processed := 0
+	for {
+		tasks, err := om.expiry.Claim(now, ExpiryClaimSize, ExpiryLease)
+		if err != nil {
+			xzap.WithContext(om.Ctx).Error("[Order Manage] failed on claim expired orders", zap.Error(err))
+			return processed
+		}
+
+		for _, task := range tasks {
+			if err := om.expireOrder(task.OrderId, task.CollectionAddr); err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on update order status", zap.Error(err),
+					zap.String("chain", om.chain), zap.String("order_id", task.OrderId))
+				continue
+			}
+			if err := om.expiry.Done(task); err != nil {
+				xzap.WithContext(om.Ctx).Error("[Order Manage] failed on finish expired order", zap.Error(err),
+					zap.String("order_id", task.OrderId))
+				continue
 			}
+			processed++
+		}
+
+		if len(tasks) < ExpiryClaimSize {
+			return processed
+		}
+	}
+}
+
+// seedExpiryScheduleWithRetry 初始化过期调度，失败时从 backoff 开始按指数退避重试，
+// 间隔最长为 ExpirySeedMaxBackoff 秒。初始化完成返回 true，上下文取消时返回 false。
+func (om *OrderManager) seedExpiryScheduleWithRetry(backoff time.Duration) bool {
+	for {
+		err := om.seedExpirySchedule()
+		if err == nil {
+			return true
+		}
+		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err),
+			zap.Duration("retry_after", backoff))
+
+		select {
+		case <-om.Ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > ExpirySeedMaxBackoff*time.Second {
+			backoff = ExpirySeedMaxBackoff * time.Second
 		}
 	}
 }
 
-// loadOrdersToQueue 函数负责在系统启动时加载所有活跃订单并处理它们的过期状态
-// 主要功能包括:
-// 1. 从数据库分批加载所有活跃订单
-// 2. 检查每个订单是否已过期:
-//   - 已过期的订单:更新状态为过期并触发地板价更新事件
-//   - 未过期的订单:添加到延迟队列等待过期检查
-func (om *OrderManager) loadOrdersToQueue() error {
+// seedExpirySchedule 首次启动（调度未初始化）时，把数据库中的活跃订单加入过期调度。
+// 已经过期的订单同样加入调度，由 processDueExpiries 统一处理；初始化完成后不再扫描订单表。
+func (om *OrderManager) seedExpirySchedule() error {
+	seeded, err := om.expiry.Seeded()
+	if err != nil {
+		return errors.Wrap(err, "failed on check expiry schedule")
+	}
+	if seeded {
+		return nil
+	}
+
 	// 分批加载所有活跃订单
-	var totalOrders []*multi.Order
 	var id int64
 	for {
 		var orders []*multi.Order
@@ -99,7 +239,15 @@ func (om *OrderManager) loadOrdersToQueue() error {
 			Scan(&orders).Error; err != nil {
 			return errors.Wrap(err, "failed on get collection orders")
 		}
-		totalOrders = append(totalOrders, orders...)
+		for _, order := range orders {
+			if err := om.expiry.Schedule(expiryTask{
+				OrderId:        order.OrderID,
+				CollectionAddr: order.CollectionAddress,
+				ExpireAt:       order.ExpireTime,
+			}); err != nil {
+				return err
+			}
+		}
 		if len(orders) < 1000 {
 			break
 		}
@@ -107,119 +255,29 @@ func (om *OrderManager) loadOrdersToQueue() error {
 		id = orders[len(orders)-1].ID
 	}
 
-	if totalOrders == nil || len(totalOrders) == 0 {
-		return nil
-	}
-
-	// 分别记录已过期和未过期的订单
-	var expiredOrderIDs []int64
-	var expiredOrders []*multi.Order
-	for _, order := range totalOrders {
-		if order.ExpireTime < time.Now().Unix() { // 已过期
-			expiredOrderIDs = append(expiredOrderIDs, order.ID)
-			expiredOrders = append(expiredOrders, order)
-		} else { // 未过期,添加到延迟队列
-			delaySeconds := order.ExpireTime - time.Now().Unix()
-			if err := om.addToOrderExpiryCheckQueue(delaySeconds, om.chain, order.OrderID, order.CollectionAddress); err != nil {
-				xzap.WithContext(om.Ctx).Error("[Order Manage] failed on add order to delay queue",
-					zap.Error(err))
-			}
-		}
-	}
-
-	// 批量更新已过期订单的状态
-	for i := 0; i < len(expiredOrderIDs); i += 100 {
-		end := i + MaxBatchReqNum
-		if i+MaxBatchReqNum >= len(expiredOrderIDs) {
-			end = len(expiredOrderIDs)
-		}
-
-		if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
-			Where("id in (?)", expiredOrderIDs[i:end]).Update("order_status", multi.OrderStatusExpired).Error; err != nil {
-			return errors.Wrap(err, "failed on update expired orders status")
-		}
-	}
-
-	// 为每个过期订单触发地板价更新事件
-	for _, order := range expiredOrders {
-		if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-			EventType:      Expired,
-			CollectionAddr: order.CollectionAddress,
-			OrderId:        order.OrderID,
-		}); err != nil {
-			return errors.Wrap(err, "failed on add update floor price event")
-		}
-	}
-
-	return nil
+	return om.expiry.MarkSeeded()
 }
 
-// addToOrderExpiryCheckQueue 函数用于将订单添加到过期检查队列中
-// 主要功能:
-// 1. 根据延迟时间计算订单在时间轮上的位置
-// 2. 将订单添加到时间轮对应位置的链表中
+// addToOrderExpiryCheckQueue 函数用于将订单添加到过期调度中
 // 参数说明:
-// - delaySeconds: 延迟秒数,即订单过期前的剩余时间
-// - chainSuffix: 链标识
+// - expireAt: 订单的过期时间（秒）
 // - orderId: 订单ID
 // - collectionAddr: NFT集合地址
-func (om *OrderManager) addToOrderExpiryCheckQueue(delaySeconds int64, chainSuffix string, orderId string, collectionAddr string) error {
-	// 加锁保护并发安全
-	om.Mux.Lock()
-	defer om.Mux.Unlock()
-
-	// 计算订单最终的时间轮位置
-	// 从当前索引开始计数
-	calculateValue := om.CurrentIndex + delaySeconds
-
-	// 计算需要循环的圈数
-	// 如果需要循环,则圈数减1(因为从0开始计数)
-	cycle := calculateValue / WheelSize
-	if cycle > 0 {
-		cycle--
-	}
-
-	// 计算订单在时间轮上的实际位置
-	index := calculateValue % WheelSize
-
-	// 创建订单对象
-	orderActivity := &Order{
-		orderID:        orderId,
+func (om *OrderManager) addToOrderExpiryCheckQueue(expireAt int64, orderId string, collectionAddr string) error {
+	return om.expiry.Schedule(expiryTask{
+		OrderId:        orderId,
 		CollectionAddr: collectionAddr,
-		ChainSuffix:    chainSuffix,
-		CycleCount:     cycle,
-		WheelPosition:  index,
-	}
-
-	// 如果该位置为空,直接放入
-	if om.TimeWheel[index].NotifyActivities == nil {
-		om.TimeWheel[index].NotifyActivities = orderActivity
-	} else {
-		// 否则插入到链表头部
-		// 因为不需要排序,所以直接插入到头部即可
-		head := om.TimeWheel[index].NotifyActivities
-		orderActivity.Next = head
-		om.TimeWheel[index].NotifyActivities = orderActivity
-	}
-	return nil
-}
-
-// GetWheelTaskQuantity :check tasks number in the time wheel at the moment
-func (om *OrderManager) GetWheelTaskQuantity(index int64) int64 {
-	orders := om.TimeWheel[index].NotifyActivities
-	if orders == nil {
-		return 0
-	}
-	var orderNum int64
-	for p := orders; p != nil; p = p.Next {
-		orderNum++
-	}
-	return orderNum
+		ExpireAt:       expireAt,
+	})
 }
 
 // updateOrderState : handler function by sql transaction
 // updateOrderState 是一个处理订单状态更新和底价更新的函数。
-// 它将指定订单的状态更新为过期，并触发一个更新底价的事件。
+// 它将仍处于活跃状态的订单更新为过期，并触发一个更新底价的事件。
+// 订单已经不是活跃状态（已成交、已取消或已被其他副本处理）时不修改状态，保证状态只转换一次；
+// 订单已经不存在（例如链重组撤销了挂单）时视为处理完成，由调用方从过期调度中删除。
+// 底价更新事件加入队列后才会从过期调度中删除订单：上一次处理已经把订单更新为过期、
+// 但加入事件失败时，订单仍在调度中并在租约到期后被重新领取，此时重新加入底价更新事件。
 //
 // 参数:
 //   - orderId: 要更新的订单的唯一标识符。
@@ -231,13 +289,49 @@ func (om *OrderManager) GetWheelTaskQuantity(index int64) int64 {
 func (om *OrderManager) updateOrderState(orderId string, collectionAddr string) error {
 	// 更新订单状态为过期
 	// update orders status to expired
-	if err := om.updateOrdersStatus(orderId, multi.OrderStatusExpired); err != nil {
+	expired, err := om.updateOrdersStatus(orderId, multi.OrderStatusExpired)
+	if err != nil {
 		// 若更新订单状态失败，包装错误信息并返回
 		return errors.Wrap(err, "failed on update activities status")
 	}
+	if !expired {
+		// 订单已经是过期状态时，上一次处理可能没有加入底价更新事件，重新加入；
+		// 过期事件只会把订单从地板价队列中移除并重新计算地板价，重复处理没有影响
+		status, err := om.orderStatus(orderId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			xzap.WithContext(om.Ctx).Warn("expired order not found, drop it from expiry schedule",
+				zap.String("order_id", orderId))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if status != multi.OrderStatusExpired {
+			return nil
+		}
+		return om.addExpiredFloorPriceEvent(orderId, collectionAddr)
+	}
+
+	// 过期的订单从集合深度中移除
+	if err := om.RefreshDepth(collectionAddr, []string{orderId}); err != nil {
+		xzap.WithContext(om.Ctx).Error("failed on refresh expired order depth", zap.String("order_id", orderId), zap.Error(err))
+	}
+
+	// 推送订单过期
+	if err := livefeed.PublishOrders(om.Ctx, om.DB, om.Xkv, om.project, om.chain, []string{orderId}); err != nil {
+		xzap.WithContext(om.Ctx).Error("failed on publish expired order event", zap.String("order_id", orderId), zap.Error(err))
+	}
+	if err := apicache.Publish(om.Xkv, apicache.CollectionTag(om.chain, collectionAddr)); err != nil {
+		xzap.WithContext(om.Ctx).Error("failed on publish cache invalidate message", zap.String("order_id", orderId), zap.Error(err))
+	}
 
 	// 更新底价
 	// update floor price
+	return om.addExpiredFloorPriceEvent(orderId, collectionAddr)
+}
+
+// addExpiredFloorPriceEvent 加入订单过期的底价更新事件，失败时返回错误，订单保留在过期调度中等待重试
+func (om *OrderManager) addExpiredFloorPriceEvent(orderId string, collectionAddr string) error {
 	if err := om.addUpdateFloorPriceEvent(&TradeEvent{
 		EventType:      Expired,
 		OrderId:        orderId,
@@ -246,33 +340,42 @@ func (om *OrderManager) updateOrderState(orderId string, collectionAddr string)
 		// 若添加更新底价事件失败，包装错误信息并返回
 		return errors.Wrap(err, "failed on add update floor price event")
 	}
-
-	// 若上述操作均成功，返回 nil 表示操作成功
 	return nil
 }
 
-// updateOrdersStatus 用于更新指定订单的状态。
-// 该函数通过数据库操作，将指定订单ID的订单状态更新为传入的状态。
+// orderStatus 查询订单当前的状态
+func (om *OrderManager) orderStatus(orderID string) (int, error) {
+	var order multi.Order
+	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Select("order_status").
+		Where("order_id = ?", orderID).
+		Take(&order).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get order status")
+	}
+	return order.OrderStatus, nil
+}
+
+// updateOrdersStatus 用于把活跃订单更新为指定状态。
+// 只有处于活跃状态的订单会被更新，多个副本并发处理同一个订单时只有一个会成功。
 //
 // 参数:
 //   - orderID: 要更新状态的订单的唯一标识符。
 //   - orderStatus: 要更新的订单状态，使用整数表示。
 //
 // 返回值:
-//   - 如果更新操作成功，返回 nil。
-//   - 如果更新操作失败，返回一个包含错误信息的错误对象。
-func (om *OrderManager) updateOrdersStatus(orderID string, orderStatus int) error {
-	// 使用数据库连接和上下文，指定要操作的表
-	// 注意：原代码中 fmt.Sprintf("%s", ...) 可简化，这里已按原代码保留注释
-	if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
-		// 筛选出指定订单ID的记录
-		Where("order_id = ?", orderID).
+//   - bool: 订单状态是否被本次调用更新。
+//   - error: 如果更新操作失败，返回一个包含错误信息的错误对象。
+func (om *OrderManager) updateOrdersStatus(orderID string, orderStatus int) (bool, error) {
+	result := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		// 筛选出指定订单ID且仍处于活跃状态的记录
+		Where("order_id = ? and order_status = ?", orderID, multi.OrderStatusActive).
 		// 更新订单状态为传入的状态
-		Update("order_status", orderStatus).Error; err != nil {
+		Update("order_status", orderStatus)
+	if result.Error != nil {
 		// 若更新操作失败，包装错误信息并返回
-		return errors.Wrap(err, "failed on update expired orders status")
+		return false, errors.Wrap(result.Error, "failed on update expired orders status")
 	}
 
-	// 若更新操作成功，返回 nil 表示操作成功
-	return nil
+	// 若更新操作成功，返回订单是否被本次调用更新
+	return result.RowsAffected > 0, nil
 }
@@ -0,0 +1,188 @@
+package ordermanager
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+// memExpiryStore 是内存版 expiryStore，领取语义与 Redis 脚本一致
+type memExpiryStore struct {
+	mu     sync.Mutex
+	scores map[string]int64
+	seeded bool
+}
+
+func newMemExpiryStore() *memExpiryStore {
+	return &memExpiryStore{scores: make(map[string]int64)}
+}
+
+func (s *memExpiryStore) Schedule(task expiryTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scores[task.member()] = task.ExpireAt
+	return nil
+}
+
+func (s *memExpiryStore) Claim(now int64, limit int, lease int64) ([]expiryTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []string
+	for member, score := range s.scores {
+		if score <= now {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return s.scores[members[i]] < s.scores[members[j]] })
+	if len(members) > limit {
+		members = members[:limit]
+	}
+
+	var tasks []expiryTask
+	for _, member := range members {
+		s.scores[member] = now + lease
+		task, err := parseExpiryMember(member)
+		if err != nil {
+			return nil, err
+		}
+		task.ExpireAt = now
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *memExpiryStore) Done(task expiryTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scores, task.member())
+	return nil
+}
+
+func (s *memExpiryStore) Seeded() (bool, error) { return s.seeded, nil }
+func (s *memExpiryStore) MarkSeeded() error     { s.seeded = true; return nil }
+
+func newTestOrderManager(store expiryStore, expired map[string]int) *OrderManager {
+	om := &OrderManager{Ctx: xzap.ToContext(context.Background(), zap.NewNop()), chain: "sepolia", expiry: store}
+	om.expireOrder = func(orderId string, collectionAddr string) error {
+		expired[orderId]++
+		return nil
+	}
+	return om
+}
+
+func TestExpiryDuringDowntime(t *testing.T) {
+	store := newMemExpiryStore()
+	const now = int64(1700000000)
+
+	// 停机前调度的订单：两个在停机期间到期，一个尚未到期
+	replica := newTestOrderManager(store, map[string]int{})
+	assert.NoError(t, replica.addToOrderExpiryCheckQueue(now-3600, "0x01", "0xc1"))
+	assert.NoError(t, replica.addToOrderExpiryCheckQueue(now-1, "0x02", "0xc1"))
+	assert.NoError(t, replica.addToOrderExpiryCheckQueue(now+60, "0x03", "0xc2"))
+
+	// 重启后两个副本共享调度，停机期间到期的订单只被处理一次
+	expiredA := map[string]int{}
+	expiredB := map[string]int{}
+	replicaA := newTestOrderManager(store, expiredA)
+	replicaB := newTestOrderManager(store, expiredB)
+	assert.Equal(t, 2, replicaA.processDueExpiries(now))
+	assert.Equal(t, 0, replicaB.processDueExpiries(now))
+	assert.Equal(t, map[string]int{"0x01": 1, "0x02": 1}, expiredA)
+	assert.Empty(t, expiredB)
+
+	// 未到期的订单按时处理
+	assert.Equal(t, 0, replicaB.processDueExpiries(now+59))
+	assert.Equal(t, 1, replicaB.processDueExpiries(now+60))
+	assert.Equal(t, map[string]int{"0x03": 1}, expiredB)
+	assert.Empty(t, store.scores)
+}
+
+func TestExpiryLeaseRetry(t *testing.T) {
+	store := newMemExpiryStore()
+	const now = int64(1700000000)
+	attempts := 0
+	om := newTestOrderManager(store, map[string]int{})
+	om.expireOrder = func(orderId string, collectionAddr string) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("db unavailable")
+		}
+		return nil
+	}
+	assert.NoError(t, om.addToOrderExpiryCheckQueue(now-10, "0x01", "0xc1"))
+
+	// 第一次处理失败，订单保留在调度中，租约期间不会被其他副本领取
+	assert.Equal(t, 0, om.processDueExpiries(now))
+	assert.Equal(t, 0, om.processDueExpiries(now+ExpiryLease-1))
+	assert.Equal(t, 1, attempts)
+
+	// 租约到期后重新领取
+	assert.Equal(t, 1, om.processDueExpiries(now+ExpiryLease))
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, store.scores)
+}
+
+func TestParseExpiryMember(t *testing.T) {
+	task, err := parseExpiryMember(expiryTask{OrderId: "0x01", CollectionAddr: "0xc1"}.member())
+	assert.NoError(t, err)
+	assert.Equal(t, "0x01", task.OrderId)
+	assert.Equal(t, "0xc1", task.CollectionAddr)
+
+	_, err = parseExpiryMember("0x01")
+	assert.Error(t, err)
+}
+
+func TestExpiryOrderNotFound(t *testing.T) {
+	store := newMemExpiryStore()
+	const now = int64(1700000000)
+	om := newTestOrderManager(store, map[string]int{})
+	mock := useMockDB(t, om)
+	om.expireOrder = om.updateOrderState
+	assert.NoError(t, om.addToOrderExpiryCheckQueue(now-10, "0x01", "0xc1"))
+
+	// 订单已经不存在（例如被链重组撤销），视为处理完成并从调度中删除，不会被反复领取
+	mock.ExpectExec("UPDATE `ob_order_sepolia` SET `order_status`=").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT `order_status` FROM `ob_order_sepolia`").WillReturnRows(sqlmock.NewRows([]string{"order_status"}))
+	assert.Equal(t, 1, om.processDueExpiries(now))
+	assert.Empty(t, store.scores)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// failingSeedStore 在前 failures 次检查初始化状态时返回错误
+type failingSeedStore struct {
+	*memExpiryStore
+	failures int
+}
+
+func (s *failingSeedStore) Seeded() (bool, error) {
+	if s.failures > 0 {
+		s.failures--
+		return false, errors.New("redis unavailable")
+	}
+	return s.memExpiryStore.Seeded()
+}
+
+func TestSeedExpiryScheduleRetry(t *testing.T) {
+	// 已经初始化过的调度不扫描订单表，失败两次后重试成功
+	store := &failingSeedStore{memExpiryStore: newMemExpiryStore(), failures: 2}
+	store.seeded = true
+	om := newTestOrderManager(store, map[string]int{})
+	assert.True(t, om.seedExpiryScheduleWithRetry(time.Millisecond))
+	assert.Equal(t, 0, store.failures)
+
+	// 上下文取消后停止重试
+	ctx, cancel := context.WithCancel(om.Ctx)
+	cancel()
+	store.failures = 1
+	om.Ctx = ctx
+	assert.False(t, om.seedExpiryScheduleWithRetry(time.Millisecond))
+}
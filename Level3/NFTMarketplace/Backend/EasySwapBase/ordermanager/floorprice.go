@@ -8,11 +8,13 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
-	"github.com/zeromicro/go-zero/core/stores/redis"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/livefeed"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
@@ -29,6 +31,7 @@ const (
 	Expired          EventType = 9
 	ImportCollection EventType = 10
 	UpdateCollection EventType = 11
+	Edit             EventType = 12 // editOrders: PrevOrderId 被 OrderId 替换
 )
 
 const (
@@ -36,6 +39,10 @@ const (
 	maxQueueLength = 100
 )
 
+// errUntrackedCollection 事件所属的集合没有被跟踪（未导入或已经被过滤），重试也无法处理，直接确认
+var errUntrackedCollection = errors.New("untracked collection")
+
+// CacheTradeEventsQueuePre 旧版本使用的交易事件列表，启动时其中剩余的事件会被迁移到 CacheTradeEventsStreamPre
 const CacheTradeEventsQueuePre = "cache:es:trade:events:%s"
 
 type collectionTradeInfo struct {
@@ -53,185 +60,311 @@ type TradeEvent struct {
 	From           string          `json:"from"`
 	To             string          `json:"to"`
 	TxHash         string          `json:"txHash"`
+	PrevOrderId    string          `json:"prev_order_id"` // Edit 事件中被替换的旧订单
+	OrderType      int64           `json:"order_type"`    // Edit 事件中新订单的类型，只有挂单影响地板价
 }
 
+// floorPriceProcess 地板价处理的主循环:
+// 1. 从数据库加载订单并更新地板价
+// 2. 重新投递上次退出时已读取但未确认的事件，之前的事件不会被丢弃
+// 3. 持续从事件队列中读取交易事件，处理完成后确认
 func (om *OrderManager) floorPriceProcess() {
-	// 清空缓存中的剩余事件
-	key := genTradeEventsCacheKey(om.chain)
-	if err := om.Xkv.Redis.Ltrim(key, 1, 0); err != nil { // clear all value
-		xzap.WithContext(om.Ctx).Error("failed on flush remaining trade events", zap.Error(err))
-	}
-
 	// 从数据库加载订单并更新地板价
 	if err := om.loadCollectionTradeInfo(); err != nil {
 		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err))
 		return
 	}
 
+	// 恢复未确认的事件，内存中的订单队列刚从数据库加载，重复处理这些事件是安全的
+	redelivered, err := om.events.Recover()
+	if err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on recover pending trade events", zap.Error(err))
+		return
+	}
+	if redelivered > 0 {
+		xzap.WithContext(om.Ctx).Info("redeliver pending trade events", zap.Int("count", redelivered))
+	}
+
 	// 持续监听并处理交易事件
 	for {
-		// 从缓存中获取交易事件
-		result, err := om.Xkv.Lpop(key)
-		if err != nil || result == "" {
-			if err != nil && err != redis.Nil {
-				xzap.WithContext(om.Ctx).Warn("failed on get trade events from cache", zap.Error(err), zap.String("result", result))
-			}
+		select {
+		case <-om.Ctx.Done():
+			return
+		default:
+		}
+		if om.processTradeEvents() == 0 {
 			time.Sleep(1 * time.Second)
-			continue
 		}
+	}
+}
+
+// processTradeEvents 读取一批交易事件并逐个处理，返回读取到的事件数量。
+// 处理成功、无法解析和未跟踪集合的事件立即确认；处理失败的事件保持未确认，空闲超过 TradeEventsRetryIdle 后重新投递，
+// 投递 TradeEventsMaxDeliveries 次仍然失败时转移到死信队列。
+func (om *OrderManager) processTradeEvents() int {
+	events, err := om.events.Fetch(TradeEventsFetchSize)
+	if err != nil {
+		xzap.WithContext(om.Ctx).Warn("failed on get trade events from queue", zap.Error(err))
+		return 0
+	}
 
-		xzap.WithContext(om.Ctx).Info("get trade events from cache", zap.String("event content", result))
+	for _, queued := range events {
+		xzap.WithContext(om.Ctx).Info("get trade events from queue",
+			zap.String("id", queued.ID), zap.Int64("deliveries", queued.Deliveries), zap.String("event content", queued.Raw))
 		// 解析事件内容
 		var event TradeEvent
-		if err := json.Unmarshal([]byte(result), &event); err != nil {
+		if err := json.Unmarshal([]byte(queued.Raw), &event); err != nil {
+			// 无法解析的事件重试也不会成功，直接确认
 			xzap.WithContext(om.Ctx).Warn("failed on unmarshal trade event info", zap.Error(err))
+			tradeEventsHandled.Inc(om.chain, event.EventType.String(), "invalid")
+		} else if err := om.handleTradeEvent(&event); errors.Is(err, errUntrackedCollection) {
+			// 未跟踪集合的事件跳过并确认，不进入重试和死信队列
+			tradeEventsHandled.Inc(om.chain, event.EventType.String(), "skipped")
+		} else if err != nil {
+			om.failTradeEvent(queued, &event, err)
 			continue
+		} else {
+			tradeEventsHandled.Inc(om.chain, event.EventType.String(), "ok")
 		}
 
-		// 检查collection是否被跟踪
-		tradeInfo, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]
-		if !ok && event.EventType != ImportCollection { //
-			xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", event.CollectionAddr))
-			continue
+		if err := om.events.Ack(queued.ID); err != nil {
+			xzap.WithContext(om.Ctx).Warn("failed on ack trade event", zap.Error(err), zap.String("id", queued.ID))
 		}
+	}
+	return len(events)
+}
+
+// failTradeEvent 处理失败的事件保持未确认等待重新投递，达到最大投递次数时转移到死信队列
+func (om *OrderManager) failTradeEvent(queued *QueuedTradeEvent, event *TradeEvent, cause error) {
+	if queued.Deliveries < TradeEventsMaxDeliveries {
+		tradeEventsHandled.Inc(om.chain, event.EventType.String(), "error")
+		return
+	}
+
+	xzap.WithContext(om.Ctx).Error("trade event failed too many times, move to dead letter",
+		zap.String("id", queued.ID), zap.Int64("deliveries", queued.Deliveries), zap.Error(cause))
+	if err := om.events.DeadLetter(queued, cause); err != nil {
+		xzap.WithContext(om.Ctx).Warn("failed on dead letter trade event", zap.Error(err), zap.String("id", queued.ID))
+	}
+	tradeEventsHandled.Inc(om.chain, event.EventType.String(), "dead_letter")
+}
+
+// handleTradeEvent 根据事件类型更新集合的订单队列和地板价，处理失败时记录日志并返回错误，
+// 集合未被跟踪时返回 errUntrackedCollection
+func (om *OrderManager) handleTradeEvent(event *TradeEvent) error {
+	// 检查collection是否被跟踪
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]
+	if !ok && event.EventType != ImportCollection { //
+		xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", event.CollectionAddr))
+		return errUntrackedCollection
+	}
 
-		// 通知collection状态更新
-		if event.CollectionAddr != "" {
-			om.collectionListedCh <- event.CollectionAddr
+	// 通知collection状态更新
+	if event.CollectionAddr != "" {
+		om.collectionListedCh <- event.CollectionAddr
+	}
+
+	// 根据不同事件类型处理
+	switch event.EventType {
+	case Listing: // 上架事件
+		// 只有当价格低于队列最高价或队列为空时才添加订单
+		_, price := tradeInfo.orders.GetMax()
+		if price.GreaterThan(event.Price) || tradeInfo.orders.Len() == 0 {
+			// 重新投递的事件可能晚于订单的取消或成交事件处理，只添加仍然有效的订单
+			active, err := om.orderActive(event.OrderId)
+			if err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on check listing order status",
+					zap.String("order_id", event.OrderId), zap.Error(err))
+				return err
+			}
+			if active {
+				tradeInfo.orders.Add(event.OrderId, event.Price, event.From, event.TokenID)
+			}
+		}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+				zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+				zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
+				zap.Error(err))
+			return err
 		}
 
-		// 根据不同事件类型处理
-		switch event.EventType {
-		case Listing: // 上架事件
-			// 只有当价格低于队列最高价或队列为空时才添加订单
-			_, price := tradeInfo.orders.GetMax()
-			if price.GreaterThan(event.Price) || tradeInfo.orders.Len() == 0 {
+	case Edit: // 修改订单事件
+		// 出价单不在地板价队列中，修改出价不影响地板价
+		if event.OrderType != multi.ListingOrder {
+			return nil
+		}
+		// 旧订单和新订单在同一步中替换，避免中间状态下地板价被错误地抬高
+		tradeInfo.orders.Remove(event.PrevOrderId)
+		_, price := tradeInfo.orders.GetMax()
+		if price.GreaterThan(event.Price) || tradeInfo.orders.Len() == 0 {
+			// 与上架事件相同，新订单已经取消或成交时不再加入队列
+			active, err := om.orderActive(event.OrderId)
+			if err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on check edited order status",
+					zap.String("order_id", event.OrderId), zap.Error(err))
+				return err
+			}
+			if active {
 				tradeInfo.orders.Add(event.OrderId, event.Price, event.From, event.TokenID)
+			} else {
+				tradeInfo.orders.Remove(event.OrderId)
 			}
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+		} else {
+			// 新价格高于队列中的最高价，不在队列中保留
+			tradeInfo.orders.Remove(event.OrderId)
+		}
+		if tradeInfo.orders.Len() == 0 {
+			// 队列为空时重新加载订单
+			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
 					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
+					zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
+				return err
 			}
+		}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+				zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+				zap.String("prev_order_id", event.PrevOrderId),
+				zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
+				zap.Error(err))
+			return err
+		}
 
-		case Cancel, Expired: // 取消或过期事件
-			// 从队列中删除订单
-			tradeInfo.orders.Remove(event.OrderId)
-			if tradeInfo.orders.Len() == 0 {
-				// 队列为空时重新加载订单
-				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-					continue
-				}
-			}
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+	case Cancel, Expired: // 取消或过期事件
+		// 从队列中删除订单
+		tradeInfo.orders.Remove(event.OrderId)
+		if tradeInfo.orders.Len() == 0 {
+			// 队列为空时重新加载订单
+			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
 					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr),
-					zap.Error(err))
+					zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
+				return err
 			}
+		}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+				zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+				zap.String("collection_addr", event.CollectionAddr),
+				zap.Error(err))
+			return err
+		}
 
-		case Buy, Transfer: // 购买或转移事件
-			// 如果是购买事件,从队列中删除订单
-			if event.EventType == Buy {
-				tradeInfo.orders.Remove(event.OrderId)
-			}
+	case Buy, Transfer: // 购买或转移事件
+		// token 转移后原持有人的挂单不再计入深度，新持有人之前的挂单重新计入
+		if err := om.refreshTokenDepth(event.CollectionAddr, event.TokenID); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on refresh token depth",
+				zap.String("collection_addr", event.CollectionAddr), zap.String("token_id", event.TokenID), zap.Error(err))
+		}
 
-			// 检查队列是否为空,为空则重新加载订单
-			if tradeInfo.orders.Len() == 0 {
-				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-					continue
-				}
-			} else {
-				// 移除卖家的所有订单
-				tradeInfo.orders.RemoveMakerOrders(event.From, event.TokenID)
-				// 获取买家的有效订单
-				orders, err := om.getUserValidOrders(event.CollectionAddr, event.TokenID, event.To)
+		// 如果是购买事件,从队列中删除订单
+		if event.EventType == Buy {
+			tradeInfo.orders.Remove(event.OrderId)
+		}
+
+		// 检查队列是否为空,为空则重新加载订单
+		if tradeInfo.orders.Len() == 0 {
+			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
+					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+					zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
+				return err
+			}
+		} else {
+			// 移除卖家的所有订单
+			tradeInfo.orders.RemoveMakerOrders(event.From, event.TokenID)
+			// 获取买家的有效订单。ERC-1155 的卖家转出部分数量后剩余的持有量可能仍然足够，
+			// 卖家的有效订单同样重新加入，ERC-721 的卖家不再是 owner，不会查到订单
+			var orders []*ValidOrder
+			for _, maker := range []string{event.To, event.From} {
+				makerOrders, err := om.getUserValidOrders(event.CollectionAddr, event.TokenID, maker)
 				if err != nil {
 					xzap.WithContext(om.Ctx).Error("failed on get users valid orders",
 						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
 						zap.String("collection_addr", event.CollectionAddr),
 						zap.String("from", event.From), zap.String("to", event.To),
 						zap.Error(err))
-					continue
-				}
-
-				// 添加买家的有效订单到队列
-				for _, order := range orders {
-					if !order.IsOpenseaBanned {
-						_, maxPrice := tradeInfo.orders.GetMax()
-						if maxPrice.GreaterThan(order.Price) {
-							tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
-						}
-					}
+					return err
 				}
+				orders = append(orders, makerOrders...)
+			}
 
-				// 如果队列为空,重新加载订单
-				if tradeInfo.orders.Len() == 0 {
-					if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-						xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-							zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-							zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-						continue
+			// 添加有效订单到队列
+			for _, order := range orders {
+				if !order.IsOpenseaBanned {
+					_, maxPrice := tradeInfo.orders.GetMax()
+					if maxPrice.GreaterThan(order.Price) {
+						tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
 					}
 				}
 			}
 
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
+			// 如果队列为空,重新加载订单
+			if tradeInfo.orders.Len() == 0 {
+				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
+						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
+					return err
+				}
 			}
+		}
 
-		case ImportCollection: // 导入新的Collection事件
-			// 检查Collection是否已存在
-			if _, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]; ok {
-				xzap.WithContext(om.Ctx).Warn("import collection repeated",
-					zap.String("collection_addr", event.CollectionAddr))
-				continue
-			}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+				zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+				zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
+				zap.Error(err))
+			return err
+		}
 
-			// 初始化新的Collection信息
-			om.collectionOrders[strings.ToLower(event.CollectionAddr)] = &collectionTradeInfo{
-				floorPrice: decimal.Zero,
-				orders:     NewPriorityQueueMap(maxQueueLength),
-			}
+	case ImportCollection: // 导入新的Collection事件
+		// 检查Collection是否已存在
+		if _, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]; ok {
+			xzap.WithContext(om.Ctx).Warn("import collection repeated",
+				zap.String("collection_addr", event.CollectionAddr))
+			return nil
+		}
 
-		case UpdateCollection: // 更新Collection事件
-			// 检查地板价是否变化
-			_, floorPrice := tradeInfo.orders.GetMin()
-			if floorPrice.Equal(event.Price) {
-				continue
-			}
+		// 初始化新的Collection信息
+		om.collectionOrders[strings.ToLower(event.CollectionAddr)] = &collectionTradeInfo{
+			floorPrice: decimal.Zero,
+			orders:     NewPriorityQueueMap(maxQueueLength),
+		}
 
-			// 重新加载订单并更新地板价
-			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-				continue
-			}
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
-			}
+	case UpdateCollection: // 更新Collection事件
+		// 检查地板价是否变化
+		_, floorPrice := tradeInfo.orders.GetMin()
+		if floorPrice.Equal(event.Price) {
+			return nil
+		}
 
-		default:
-			xzap.WithContext(om.Ctx).Error("unsupported event type", zap.String("event content", result))
+		// 重新加载订单并更新地板价
+		if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
+				zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+				zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
+			return err
+		}
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
+				zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
+				zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
+				zap.Error(err))
+			return err
 		}
+
+	default:
+		xzap.WithContext(om.Ctx).Error("unsupported event type", zap.Int("event_type", int(event.EventType)))
+		return errors.Errorf("unsupported event type %d", event.EventType)
 	}
+	return nil
 }
 
 // loadCollectionTradeInfo 函数主要负责初始化和加载集合(Collection)的交易信息,主要包含以下步骤:
@@ -260,12 +393,12 @@ func (om *OrderManager) loadCollectionTradeInfo() error {
 		// 查询条件:
 		// - 订单类型为Listing
 		// - 订单状态为Active
-		// - maker必须是token的owner
+		// - maker必须持有挂单的token
 		// - 非OpenSea禁止的item
 		if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
 			Select("co.id as id ,co.order_id as order_id, co.collection_address as collection_address, co.price as price,co.maker as maker,co.token_id as token_id").
 			Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
-			Where("co.order_type=? and co.order_status = ? and co.maker = ci.owner  and (ci.is_opensea_banned,co.marketplace_id)!=(true,1) and co.id > ?", multi.ListingType, multi.OrderStatusActive, id).
+			Where("co.order_type=? and co.order_status = ? and "+om.heldByMakerCondition()+" and (ci.is_opensea_banned,co.marketplace_id)!=(true,1) and co.id > ?", multi.ListingType, multi.OrderStatusActive, id).
 			Order("co.id asc").Limit(1000).
 			Scan(&orders).Error; err != nil {
 			return errors.Wrap(err, "failed on get collection orders")
@@ -303,6 +436,14 @@ func (om *OrderManager) loadCollectionTradeInfo() error {
 	return nil
 }
 
+// heldByMakerCondition 返回挂单的 maker 仍然持有挂单 token 的查询条件，订单表别名为 co，item 表别名为 ci：
+// ERC-721 要求 maker 是 item 的 owner，ERC-1155 要求 maker 的持有数量不少于订单的剩余数量
+func (om *OrderManager) heldByMakerCondition() string {
+	return fmt.Sprintf("(co.maker = ci.owner or exists (select 1 from %s cb where cb.collection_address = co.collection_address"+
+		" and cb.token_id = co.token_id and cb.owner = co.maker and cb.balance >= co.quantity_remaining))",
+		gdb.GetMultiProjectItemBalanceTableName(om.project, om.chain))
+}
+
 func (om *OrderManager) updateFloorPrice(collectionAddr string, price decimal.Decimal) error {
 	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectCollectionTableName(om.project, om.chain)).
 		Where("address=?", collectionAddr).Update("floor_price", price).Error; err != nil {
@@ -323,7 +464,7 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 	tradeInfo, ok := om.collectionOrders[strings.ToLower(address)]
 	if !ok {
 		xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", address))
-		return errors.New("untracked collection")
+		return errUntrackedCollection
 	}
 
 	// 2. 获取集合当前最低价格
@@ -343,6 +484,17 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 		// 记录地板价更新日志
 		xzap.WithContext(om.Ctx).Info("update collection floor price",
 			zap.String("collection_addr", address), zap.String("floor_price", newFloorPrice.String()))
+
+		// 推送地板价变化，推送失败不影响地板价更新
+		if err := livefeed.Publish(om.Xkv, om.chain, livefeed.FloorEvent(address, newFloorPrice, time.Now().Unix())); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on publish floor price event",
+				zap.String("collection_addr", address), zap.Error(err))
+		}
+		// 集合的 API 缓存失效
+		if err := apicache.Publish(om.Xkv, apicache.CollectionTag(om.chain, address)); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on publish cache invalidate message",
+				zap.String("collection_addr", address), zap.Error(err))
+		}
 	}
 	return nil
 }
@@ -353,7 +505,7 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 // 2. 过滤条件:
 //   - 订单类型为listing
 //   - 订单状态为active
-//   - maker必须是token的owner
+//   - maker必须持有挂单的token
 //   - 非OpenSea禁止的item
 //
 // 3. 按价格升序排序并限制返回100条记录
@@ -367,7 +519,7 @@ func (om *OrderManager) getLowestPrice100Orders(address string) ([]*multi.Order,
 	if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
 		Select("co.id,co.order_id as order_id, co.collection_address, co.price, co.maker,co.token_id").
 		Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
-		Where("co.order_type=? and co.order_status = ? and co.maker = ci.owner  and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)", multi.ListingType, multi.OrderStatusActive).
+		Where("co.order_type=? and co.order_status = ? and "+om.heldByMakerCondition()+" and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)", multi.ListingType, multi.OrderStatusActive).
 		Where("co.collection_address = ?", address).Order("co.price asc").Limit(100).
 		Scan(&orders).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get collection lowest price orders")
@@ -389,7 +541,7 @@ func (om *OrderManager) reloadCollectionOrders(address string) error {
 	tradeInfo, ok := om.collectionOrders[strings.ToLower(address)]
 	if !ok {
 		xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", address))
-		return errors.New("untracked collection")
+		return errUntrackedCollection
 	}
 
 	// 2. 获取该集合价格最低的100个订单
@@ -409,6 +561,18 @@ func (om *OrderManager) reloadCollectionOrders(address string) error {
 	return nil
 }
 
+// orderActive 检查订单在数据库中是否仍然有效，订单不存在（被链重组撤销）时返回 false
+func (om *OrderManager) orderActive(orderId string) (bool, error) {
+	status, err := om.orderStatus(orderId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return status == multi.OrderStatusActive, nil
+}
+
 type ValidOrder struct {
 	multi.Order
 	IsOpenseaBanned bool `json:"is_opensea_banned"`
@@ -420,7 +584,7 @@ type ValidOrder struct {
 // 2. 过滤条件包括:
 //   - 订单类型为listing
 //   - 订单状态为active
-//   - maker必须是token的owner
+//   - maker必须持有挂单的token
 //   - 非OpenSea禁止的item
 //
 // 3. 按价格升序排序并限制返回100条记录
@@ -436,7 +600,7 @@ func (om *OrderManager) getUserValidOrders(address, tokenID, maker string) ([]*V
 	if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
 		Select("co.id as id,co.order_id as order_id, co.maker as maker,ci.is_opensea_banned as is_opensea_banned, co.collection_address as collection_address, co.price as price,co.token_id as token_id").
 		Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
-		Where("co.order_type=? and co.order_status = ? and co.maker = ci.owner  and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)", multi.ListingType, multi.OrderStatusActive).
+		Where("co.order_type=? and co.order_status = ? and "+om.heldByMakerCondition()+" and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)", multi.ListingType, multi.OrderStatusActive).
 		Where("co.collection_address = ? and co.token_id=?"+
 			" and co.maker = ?", address, tokenID, maker).Order("co.price asc").Limit(100).
 		Scan(&orders).Error; err != nil {
@@ -452,7 +616,7 @@ func (om *OrderManager) getUserValidOrders(address, tokenID, maker string) ([]*V
 //   - 对于Transfer/ImportCollection/UpdateCollection事件,必须有OrderId
 //   - 对于Listing事件,价格不能为0
 //
-// 2. 将事件序列化并添加到Redis队列中
+// 2. 将事件添加到事件队列中
 // 参数说明:
 // - event: 交易事件,包含事件类型、订单ID、价格等信息
 // 返回值:
@@ -468,19 +632,8 @@ func (om *OrderManager) addUpdateFloorPriceEvent(event *TradeEvent) error {
 		return errors.New("invalid update collection floor price. price is 0")
 	}
 
-	// 序列化事件
-	rawEvent, err := json.Marshal(event)
-	if err != nil {
-		return errors.Wrap(err, "failed on marshal event")
-	}
-
-	// 获取Redis队列key
-	key := genTradeEventsCacheKey(om.chain)
-	// 将事件添加到Redis队列
-	if _, err := om.Xkv.Rpush(key, string(rawEvent)); err != nil {
-		return errors.Wrap(err, "failed on push trade event to queue")
-	}
-	return nil
+	// 将事件添加到事件队列
+	return om.events.Push(event)
 }
 
 func genTradeEventsCacheKey(chain string) string {
@@ -493,7 +646,7 @@ func genTradeEventsCacheKey(chain string) string {
 //   - 对于非Transfer/ImportCollection/UpdateCollection事件,必须有OrderId
 //   - 对于Listing事件,价格不能为0且必须有TokenID
 //
-// 2. 将事件序列化并添加到Redis队列中
+// 2. 将事件添加到Redis Stream事件队列中，由地板价处理协程消费并确认
 // 参数说明:
 // - kv: Redis存储实例
 // - event: 交易事件,包含事件类型、订单ID、价格等信息
@@ -514,18 +667,11 @@ func AddUpdatePriceEvent(kv *xkv.Store, event *TradeEvent, chain string) error {
 	if event.EventType == Listing && event.TokenID == "" {
 		return errors.New("invalid update collection floor price. token_id is null")
 	}
-
-	// 序列化事件
-	rawEvent, err := json.Marshal(event)
-	if err != nil {
-		return errors.Wrap(err, "failed on marshal event")
+	// 如果是Edit事件,必须有被替换的订单、价格和TokenID
+	if event.EventType == Edit && (event.PrevOrderId == "" || event.Price.IsZero() || event.TokenID == "") {
+		return errors.New("invalid update collection floor price. edit event is incomplete")
 	}
 
-	// 获取Redis队列key
-	key := genTradeEventsCacheKey(chain)
-	// 将事件添加到Redis队列
-	if _, err := kv.Rpush(key, string(rawEvent)); err != nil {
-		return errors.Wrap(err, "failed on push trade event to queue")
-	}
-	return nil
+	// 将事件添加到Redis事件队列
+	return NewRedisTradeEventQueue(kv, chain).Push(event)
 }
@@ -95,16 +95,16 @@ func (om *OrderManager) countCollectionListed(cs []string) ([]CollectionListed,
 	// 查询条件:
 	// - order_type=1 表示listing类型订单
 	// - order_status=0 表示订单状态为active
-	// - maker必须是token的owner
+	// - maker必须持有挂单的token
 	// - 非OpenSea禁止的item
 	query := fmt.Sprintf(`SELECT co.collection_address,count(distinct (co.token_id)) as list_count
 FROM %s as ci
          join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id
 WHERE  co.order_type = 1
   and co.order_status = 0
-  and co.maker = ci.owner
+  and %s
   and (ci.is_opensea_banned, co.marketplace_id) != (true, 1)
-group by co.collection_address`, gdb.GetMultiProjectItemTableName(om.project, om.chain), gdb.GetMultiProjectOrderTableName(om.project, om.chain))
+group by co.collection_address`, gdb.GetMultiProjectItemTableName(om.project, om.chain), gdb.GetMultiProjectOrderTableName(om.project, om.chain), om.heldByMakerCondition())
 
 	// 如果指定了集合地址,则修改查询语句添加collection_address筛选条件
 	if len(cs) > 0 {
@@ -113,9 +113,9 @@ FROM %s as ci
          join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id
 WHERE  co.collection_address in (?) and co.order_type = 1
   and co.order_status = 0
-  and co.maker = ci.owner
+  and %s
   and (ci.is_opensea_banned, co.marketplace_id) != (true, 1)
-group by co.collection_address`, gdb.GetMultiProjectItemTableName(om.project, om.chain), gdb.GetMultiProjectOrderTableName(om.project, om.chain))
+group by co.collection_address`, gdb.GetMultiProjectItemTableName(om.project, om.chain), gdb.GetMultiProjectOrderTableName(om.project, om.chain), om.heldByMakerCondition())
 	}
 
 	// 执行SQL查询
@@ -61,6 +61,9 @@ func (pqm *PriorityQueueMap) Len() int {
 //     maker: 订单制造者
 //     tokenID: 订单代币ID
 func (pqm *PriorityQueueMap) Add(orderID string, price decimal.Decimal, maker, tokenID string) {
+	// 同一订单可能通过 Listing 和 Edit 事件重复加入，先移除旧的记录
+	pqm.Remove(orderID)
+
 	// 如果优先级队列的长度超过了最大长度
 	if len(pqm.pq) > pqm.maxLen {
 		// 从orders映射中删除最后一个元素的orderID
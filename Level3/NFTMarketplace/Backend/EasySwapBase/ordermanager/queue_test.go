@@ -64,6 +64,24 @@ func TestQueueRemoveMaker(t *testing.T) {
 	assert.Equal(t, price, decimal.Zero)
 }
 
+func TestQueueAddExisting(t *testing.T) {
+	queue := NewPriorityQueueMap(5)
+	queue.Add("101", decimal.NewFromFloat(1.2), "a", "1")
+	queue.Add("102", decimal.NewFromFloat(1.3), "b", "2")
+	// same order added again with a new price, e.g. listing event after edit event
+	queue.Add("101", decimal.NewFromFloat(1.4), "a", "1")
+
+	assert.Equal(t, queue.Len(), 2)
+	id, price := queue.GetMax()
+	assert.Equal(t, id, "101")
+	assert.Equal(t, price, decimal.NewFromFloat(1.4))
+
+	queue.Remove("101")
+	id, price = queue.GetMin()
+	assert.Equal(t, id, "102")
+	assert.Equal(t, price, decimal.NewFromFloat(1.3))
+}
+
 func TestPoint(t *testing.T) {
 	infos := make(map[string]*collectionTradeInfo)
 	infos["a"] = &collectionTradeInfo{
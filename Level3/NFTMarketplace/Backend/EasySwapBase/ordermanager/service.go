@@ -20,8 +20,6 @@ import (
 )
 
 const (
-	// WheelSize : length of time wheel, 1s for a unit, 1h for a cycle
-	WheelSize           = 3600
 	List                = 3
 	CacheOrdersQueuePre = "cache:es:orders:%s"
 )
@@ -30,33 +28,15 @@ func GenOrdersCacheKey(chain string) string {
 	return fmt.Sprintf(CacheOrdersQueuePre, chain)
 }
 
-// Activity ：collection order-activity
-type Order struct {
-	// order Id
-	orderID        string
-	CollectionAddr string
-	// chain suffix name: ethw/bsc
-	ChainSuffix string
-	// expireIn - createIn (unit: s)
-	CycleCount int64
-	// position of the task on the time wheel
-	WheelPosition int64
-
-	Next *Order
-}
-
-type wheel struct {
-	// linked list
-	NotifyActivities *Order
-}
-
 type OrderManager struct {
 	chain string
 
-	// cycle time wheel
-	TimeWheel [WheelSize]wheel
-	// current time wheel index
-	CurrentIndex int64
+	// expiry 持久化的订单过期调度，多个副本共享
+	expiry expiryStore
+	// expireOrder 把到期订单更新为过期状态，默认为 updateOrderState
+	expireOrder func(orderId string, collectionAddr string) error
+	// events 地板价更新的交易事件队列，事件处理完成后确认
+	events TradeEventQueue
 
 	collectionOrders map[string]*collectionTradeInfo
 
@@ -72,7 +52,7 @@ type OrderManager struct {
 // NewDelayQueue : create func instance entrance
 func New(ctx context.Context, db *gorm.DB, xkv *xkv.Store, chain string, project string) *OrderManager {
 	// 初始化 OrderManager 实例
-	return &OrderManager{
+	om := &OrderManager{
 		// 设置链的名称
 		chain:              chain,
 		// 设置 xkv 存储
@@ -89,7 +69,13 @@ func New(ctx context.Context, db *gorm.DB, xkv *xkv.Store, chain string, project
 		collectionListedCh: make(chan string, 1000),
 		// 设置项目名称
 		project:            project,
+		// 基于 Redis 有序集合的过期调度
+		expiry:             newRedisExpiryStore(xkv, chain),
+		// 基于 Redis Stream 的交易事件队列
+		events:             NewRedisTradeEventQueue(xkv, chain),
 	}
+	om.expireOrder = om.updateOrderState
+	return om
 }
 
 func (om *OrderManager) Start() {
@@ -155,23 +141,11 @@ func (om *OrderManager) ListenNewListingLoop() {
 			// 记录订单过期日志
 			xzap.WithContext(om.Ctx).Info("expired activity order", zap.String("order_id", listing.OrderId))
 
-			// 更新订单状态
-			if err := om.updateOrdersStatus(listing.OrderId, multi.OrderStatusExpired); err != nil {
+			// 更新订单状态并添加更新floorprice事件，订单已不是活跃状态时不做修改
+			if err := om.expireOrder(listing.OrderId, listing.CollectionAddr); err != nil {
 				// 记录更新订单状态失败日志
 				xzap.WithContext(om.Ctx).Error("failed on update activity status", zap.String("order_id", listing.OrderId), zap.Error(err))
 			}
-
-			// 添加更新floorprice事件
-			if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-				EventType:      Expired,
-				CollectionAddr: listing.CollectionAddr,
-				TokenID:        listing.TokenID,
-				OrderId:        listing.OrderId,
-				From:           listing.Maker,
-			}); err != nil {
-				// 记录添加更新floorprice事件失败日志
-				xzap.WithContext(om.Ctx).Error("failed on add update floor price event", zap.String("order_id", listing.OrderId), zap.Error(err))
-			}
 			// 继续循环
 			continue
 		} else { // 订单未过期
@@ -191,9 +165,8 @@ func (om *OrderManager) ListenNewListingLoop() {
 					zap.String("chain", om.chain))
 			}
 
-			// 添加到订单过期检查队列
-			delaySeconds := listing.ExpireIn - time.Now().Unix()
-			if err := om.addToOrderExpiryCheckQueue(delaySeconds, om.chain, listing.OrderId, listing.CollectionAddr); err != nil {
+			// 添加到订单过期调度
+			if err := om.addToOrderExpiryCheckQueue(listing.ExpireIn, listing.OrderId, listing.CollectionAddr); err != nil {
 				// 记录推送订单到过期检查队列失败日志
 				xzap.WithContext(om.Ctx).Error("failed on push order to expired check queue", zap.Error(err), zap.String("order_id", listing.OrderId),
 					zap.String("chain", om.chain))
@@ -0,0 +1,119 @@
+package rarity
+
+import (
+	"sort"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// noneValue 表示 item 没有某个属性，缺少属性本身也是一种稀有度
+const noneValue = "\x00none"
+
+// Score 一个 item 的稀有度
+type Score struct {
+	TokenId string
+	// Normalized 按属性类别数量归一化后的稀有度得分：每个属性取值出现概率的倒数除以该属性的取值数量再求和，越大越稀有
+	Normalized float64
+	// Statistical 统计稀有度：所有属性取值出现概率的乘积，越小越稀有
+	Statistical float64
+	// Rank 稀有度排名，1 为最稀有，两个得分都相同的 item 排名相同
+	Rank int64
+}
+
+// Compute 计算集合内每个 item 的稀有度和排名。
+// tokenIds 是集合内的全部 item，traits 是这些 item 的属性，不在 tokenIds 中的属性会被忽略；
+// 集合没有任何属性时无法区分稀有度，返回 nil。
+func Compute(tokenIds []string, traits []multi.ItemTrait) []Score {
+	total := len(tokenIds)
+	if total == 0 {
+		return nil
+	}
+
+	// 每个 item 的每个属性只取第一个取值
+	itemTraits := make(map[string]map[string]string, total)
+	for _, tokenId := range tokenIds {
+		itemTraits[tokenId] = make(map[string]string)
+	}
+	for _, trait := range traits {
+		values, ok := itemTraits[trait.TokenId]
+		if !ok {
+			continue
+		}
+		if _, ok := values[trait.Trait]; !ok {
+			values[trait.Trait] = trait.TraitValue
+		}
+	}
+
+	// 统计每个属性取值的出现次数，没有该属性的 item 记为 noneValue
+	counts := make(map[string]map[string]int)
+	for _, values := range itemTraits {
+		for trait, value := range values {
+			if counts[trait] == nil {
+				counts[trait] = make(map[string]int)
+			}
+			counts[trait][value]++
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	traitTypes := make([]string, 0, len(counts))
+	for trait, values := range counts {
+		present := 0
+		for _, count := range values {
+			present += count
+		}
+		if present < total {
+			values[noneValue] = total - present
+		}
+		traitTypes = append(traitTypes, trait)
+	}
+	// 固定属性的累加顺序，相同属性组合的 item 得到完全相同的浮点数
+	sort.Strings(traitTypes)
+
+	scores := make([]Score, 0, total)
+	for _, tokenId := range tokenIds {
+		score := Score{TokenId: tokenId, Statistical: 1}
+		for _, trait := range traitTypes {
+			value, ok := itemTraits[tokenId][trait]
+			if !ok {
+				value = noneValue
+			}
+			count := float64(counts[trait][value])
+			score.Normalized += float64(total) / count / float64(len(counts[trait]))
+			score.Statistical *= count / float64(total)
+		}
+		scores = append(scores, score)
+	}
+
+	rank(scores)
+	return scores
+}
+
+// rank 按归一化得分降序、统计稀有度升序排序并计算排名，得分相同的 item 按 token id 排列并且排名相同
+func rank(scores []Score) {
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Normalized != scores[j].Normalized {
+			return scores[i].Normalized > scores[j].Normalized
+		}
+		if scores[i].Statistical != scores[j].Statistical {
+			return scores[i].Statistical < scores[j].Statistical
+		}
+		return lessTokenId(scores[i].TokenId, scores[j].TokenId)
+	})
+	for i := range scores {
+		if i > 0 && scores[i].Normalized == scores[i-1].Normalized && scores[i].Statistical == scores[i-1].Statistical {
+			scores[i].Rank = scores[i-1].Rank
+			continue
+		}
+		scores[i].Rank = int64(i + 1)
+	}
+}
+
+// lessTokenId 按数值大小比较十进制的 token id
+func lessTokenId(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
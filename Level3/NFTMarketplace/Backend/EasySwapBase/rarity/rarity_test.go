@@ -0,0 +1,56 @@
+package rarity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func trait(tokenId, name, value string) multi.ItemTrait {
+	return multi.ItemTrait{TokenId: tokenId, Trait: name, TraitValue: value}
+}
+
+func TestCompute(t *testing.T) {
+	tokenIds := []string{"1", "2", "3", "4"}
+	traits := []multi.ItemTrait{
+		trait("1", "Background", "Blue"),
+		trait("2", "Background", "Blue"),
+		trait("3", "Background", "Blue"),
+		trait("4", "Background", "Gold"),
+		trait("1", "Hat", "Crown"),
+		// 不在集合中的 item 不参与计算
+		trait("5", "Hat", "Crown"),
+	}
+
+	scores := Compute(tokenIds, traits)
+	assert.Len(t, scores, 4)
+
+	byToken := make(map[string]Score)
+	for _, score := range scores {
+		byToken[score.TokenId] = score
+	}
+	// Background: Blue 3/4、Gold 1/4，两个取值；Hat: Crown 1/4、没有 3/4，两个取值
+	assert.InDelta(t, 4.0/3/2+4.0/2, byToken["1"].Normalized, 1e-9)
+	assert.InDelta(t, 4.0/1/2+4.0/3/2, byToken["4"].Normalized, 1e-9)
+	assert.InDelta(t, 3.0/4*1.0/4, byToken["1"].Statistical, 1e-9)
+
+	// 1 和 4 得分相同并列第一，2 和 3 属性完全相同并列第三
+	assert.Equal(t, int64(1), byToken["1"].Rank)
+	assert.Equal(t, int64(1), byToken["4"].Rank)
+	assert.Equal(t, int64(3), byToken["2"].Rank)
+	assert.Equal(t, int64(3), byToken["3"].Rank)
+	assert.Equal(t, []string{"1", "4", "2", "3"}, []string{scores[0].TokenId, scores[1].TokenId, scores[2].TokenId, scores[3].TokenId})
+}
+
+func TestComputeWithoutTraits(t *testing.T) {
+	assert.Nil(t, Compute(nil, nil))
+	assert.Nil(t, Compute([]string{"1", "2"}, nil))
+}
+
+func TestLessTokenId(t *testing.T) {
+	assert.True(t, lessTokenId("9", "10"))
+	assert.True(t, lessTokenId("10", "11"))
+	assert.False(t, lessTokenId("100", "99"))
+}
@@ -0,0 +1,119 @@
+package rarity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+// CacheRarityDirtyKey 属性发生变化、需要重新计算稀有度的集合（集合）
+const CacheRarityDirtyKey = "cache:%s:%s:rarity:dirty"
+
+// updateBatchSize 每条 update 语句更新的 item 数量
+const updateBatchSize = 500
+
+// GetRarityDirtyKey 根据项目名和链名生成待重新计算稀有度的集合的缓存键
+func GetRarityDirtyKey(project, chain string) string {
+	return fmt.Sprintf(CacheRarityDirtyKey, strings.ToLower(project), strings.ToLower(chain))
+}
+
+// MarkDirty 记录集合的属性发生了变化，同一个集合多次标记只会重新计算一次
+func MarkDirty(kvStore *xkv.Store, project, chain, collectionAddr string) error {
+	if _, err := kvStore.Sadd(GetRarityDirtyKey(project, chain), strings.ToLower(collectionAddr)); err != nil {
+		return errors.Wrap(err, "failed on mark rarity dirty")
+	}
+	return nil
+}
+
+// PopDirty 取出一个需要重新计算稀有度的集合，没有时返回空字符串
+func PopDirty(kvStore *xkv.Store, project, chain string) (string, error) {
+	collectionAddr, err := kvStore.Spop(GetRarityDirtyKey(project, chain))
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed on pop rarity dirty")
+	}
+	return collectionAddr, nil
+}
+
+// Recompute 读取集合内全部 item 和属性，重新计算稀有度并写回 ob_item_*。
+// 集合没有属性时所有 item 的稀有度清零，排名为 0 表示未参与排名。
+func Recompute(ctx context.Context, db *gorm.DB, project, chain, collectionAddr string) error {
+	itemTable := gdb.GetMultiProjectItemTableName(project, chain)
+	var tokenIds []string
+	if err := db.WithContext(ctx).Table(itemTable).
+		Where("collection_address = ?", collectionAddr).
+		Pluck("token_id", &tokenIds).Error; err != nil {
+		return errors.Wrap(err, "failed on query collection items")
+	}
+
+	var traits []multi.ItemTrait
+	if err := db.WithContext(ctx).Table(gdb.GetMultiProjectItemTraitTableName(project, chain)).
+		Select("token_id, trait, trait_value").
+		Where("collection_address = ?", collectionAddr).
+		Order("id asc").
+		Find(&traits).Error; err != nil {
+		return errors.Wrap(err, "failed on query collection traits")
+	}
+
+	scores := Compute(tokenIds, traits)
+	if len(scores) == 0 {
+		if err := db.WithContext(ctx).Table(itemTable).
+			Where("collection_address = ? and rarity_rank <> 0", collectionAddr).
+			Updates(map[string]interface{}{
+				"rarity_score":       0,
+				"rarity_statistical": 0,
+				"rarity_rank":        0,
+			}).Error; err != nil {
+			return errors.Wrap(err, "failed on reset item rarity")
+		}
+		return nil
+	}
+
+	for start := 0; start < len(scores); start += updateBatchSize {
+		end := start + updateBatchSize
+		if end > len(scores) {
+			end = len(scores)
+		}
+		if err := updateScores(ctx, db, itemTable, collectionAddr, scores[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateScores 用一条 update ... case 语句更新一批 item 的稀有度
+func updateScores(ctx context.Context, db *gorm.DB, itemTable, collectionAddr string, scores []Score) error {
+	var scoreCase, statisticalCase, rankCase strings.Builder
+	var scoreArgs, statisticalArgs, rankArgs []interface{}
+	tokenIds := make([]string, 0, len(scores))
+	for _, score := range scores {
+		scoreCase.WriteString(" when ? then ?")
+		statisticalCase.WriteString(" when ? then ?")
+		rankCase.WriteString(" when ? then ?")
+		scoreArgs = append(scoreArgs, score.TokenId, score.Normalized)
+		statisticalArgs = append(statisticalArgs, score.TokenId, score.Statistical)
+		rankArgs = append(rankArgs, score.TokenId, score.Rank)
+		tokenIds = append(tokenIds, score.TokenId)
+	}
+
+	if err := db.WithContext(ctx).Table(itemTable).
+		Where("collection_address = ? and token_id in (?)", collectionAddr, tokenIds).
+		Updates(map[string]interface{}{
+			"rarity_score":       gorm.Expr("case token_id"+scoreCase.String()+" else rarity_score end", scoreArgs...),
+			"rarity_statistical": gorm.Expr("case token_id"+statisticalCase.String()+" else rarity_statistical end", statisticalArgs...),
+			"rarity_rank":        gorm.Expr("case token_id"+rankCase.String()+" else rarity_rank end", rankArgs...),
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on update item rarity")
+	}
+	return nil
+}
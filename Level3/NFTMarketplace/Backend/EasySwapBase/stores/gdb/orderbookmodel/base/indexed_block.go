@@ -10,15 +10,59 @@ const (
 )
 
 type IndexedStatus struct {
-	Id               int64 `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
-	ChainId          int   `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL" ` // 链类型(1:以太坊)
-	LastIndexedBlock int64 `json:"last_indexed_block" gorm:"column:last_indexed_block;NULL)"`
-	LastIndexedTime  int64 `json:"last_indexed_time" gorm:"column:last_indexed_time;NULL)"`
-	IndexType        int32 `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`                  //0:activity 1:trade info
-	CreateTime       int64 `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
-	UpdateTime       int64 `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+	Id               int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId          int    `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL" ` // 链类型(1:以太坊)
+	LastIndexedBlock int64  `json:"last_indexed_block" gorm:"column:last_indexed_block;NULL)"`
+	LastIndexedTime  int64  `json:"last_indexed_time" gorm:"column:last_indexed_time;NULL)"`
+	IndexType        int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`                  //0:activity 1:trade info
+	ContractAddress  string `json:"contract_address" gorm:"column:contract_address;type:varchar(42);not null;default:''"`    // 订单簿合约地址，同一条链上的多个订单簿合约分别记录同步进度，其他同步任务为空
+	CreateTime       int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime       int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
 }
 
 func IndexedStatusTableName() string {
 	return "ob_indexed_status"
 }
+
+const (
+	// UndoActionInsert 表示索引时新增了一行数据，回滚时需要删除
+	UndoActionInsert = 1
+	// UndoActionUpdate 表示索引时更新了一行数据，回滚时需要恢复旧值
+	UndoActionUpdate = 2
+)
+
+// IndexedBlock 记录最近已索引区块的哈希，是 ob_indexed_status 的伴生表，
+// 用于检测父区块哈希不一致（链重组）。
+type IndexedBlock struct {
+	Id              int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId         int    `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL"`                                      // 链类型(1:以太坊)
+	IndexType       int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`                  // 与 ob_indexed_status.index_type 对应
+	ContractAddress string `json:"contract_address" gorm:"column:contract_address;type:varchar(42);not null;default:''"`    // 与 ob_indexed_status.contract_address 对应
+	BlockNumber     int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`                        // 区块号
+	BlockHash       string `json:"block_hash" gorm:"column:block_hash;type:varchar(66);not null"`                           // 区块哈希
+	ParentHash      string `json:"parent_hash" gorm:"column:parent_hash;type:varchar(66);not null"`                         // 父区块哈希
+	CreateTime      int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func IndexedBlockTableName() string {
+	return "ob_indexed_block"
+}
+
+// IndexedUndoLog 记录索引某个区块时对业务表所做的修改，
+// 链重组时按 id 倒序回放即可把 ob_order_*、ob_activity_*、ob_item_* 恢复到分叉点之前的状态。
+type IndexedUndoLog struct {
+	Id              int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId         int    `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL"`
+	IndexType       int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`
+	ContractAddress string `json:"contract_address" gorm:"column:contract_address;type:varchar(42);not null;default:''"`    // 与 ob_indexed_status.contract_address 对应
+	BlockNumber     int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`                        // 产生修改的区块号
+	TargetTable     string `json:"target_table" gorm:"column:target_table;type:varchar(128);not null"`                      // 被修改的表
+	Action          int    `json:"action" gorm:"column:action;type:tinyint(4);not null"`                                    // 1:insert 2:update
+	RowKey          string `json:"row_key" gorm:"column:row_key;type:varchar(1024);not null"`                               // 定位行的条件(json)
+	PrevValues      string `json:"prev_values" gorm:"column:prev_values;type:text"`                                         // 更新前的列值(json)，insert 时为空
+	CreateTime      int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func IndexedUndoLogTableName() string {
+	return "ob_indexed_undo_log"
+}
@@ -0,0 +1,37 @@
+package base
+
+// IndexedLog 记录已经应用过的链上日志，(chain_id, index_type, tx_hash, log_index) 唯一，
+// 重复处理同一区间时据此跳过已应用的日志。
+type IndexedLog struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId     int    `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL"`
+	IndexType   int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`
+	BlockNumber int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`                        // 区块号
+	TxHash      string `json:"tx_hash" gorm:"column:tx_hash;type:varchar(66);not null"`                                 // 交易哈希
+	LogIndex    int64  `json:"log_index" gorm:"column:log_index;type:bigint(20);not null"`                              // 日志在区块中的序号
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func IndexedLogTableName() string {
+	return "ob_indexed_log"
+}
+
+// IndexedDeadLetter 记录多次重试仍然处理失败的链上日志，等待人工排查后重新投递
+type IndexedDeadLetter struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId     int    `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL"`
+	IndexType   int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`
+	BlockNumber int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`                        // 区块号
+	BlockHash   string `json:"block_hash" gorm:"column:block_hash;type:varchar(66);not null"`                           // 区块哈希
+	TxHash      string `json:"tx_hash" gorm:"column:tx_hash;type:varchar(66);not null"`                                 // 交易哈希
+	LogIndex    int64  `json:"log_index" gorm:"column:log_index;type:bigint(20);not null"`                              // 日志在区块中的序号
+	Topic       string `json:"topic" gorm:"column:topic;type:varchar(66);not null"`                                     // 事件签名
+	RawLog      string `json:"raw_log" gorm:"column:raw_log;type:text"`                                                 // 原始日志(json)
+	Error       string `json:"error" gorm:"column:error;type:varchar(1024)"`                                            // 最后一次失败原因
+	Attempts    int    `json:"attempts" gorm:"column:attempts;type:int(11);not null;default:0"`                         // 已尝试次数
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func IndexedDeadLetterTableName() string {
+	return "ob_indexed_dead_letter"
+}
@@ -0,0 +1,23 @@
+package base
+
+// IndexedTransfer 记录 Transfer 事件同步器已经应用过的 NFT 转移，(chain_id, tx_hash, log_index, batch_index) 唯一。
+// 重复同步时据此跳过已应用的转移；链重组时按记录反向应用，撤销分叉区块上的转移。
+type IndexedTransfer struct {
+	Id                int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId           int    `json:"chain_id" gorm:"column:chain_id;default:1;NOT NULL"`
+	BlockNumber       int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`                        // 区块号
+	TxHash            string `json:"tx_hash" gorm:"column:tx_hash;type:varchar(66);not null"`                                 // 交易哈希
+	LogIndex          int64  `json:"log_index" gorm:"column:log_index;type:bigint(20);not null"`                              // 日志在区块中的序号
+	BatchIndex        int    `json:"batch_index" gorm:"column:batch_index;type:int(11);not null;default:0"`                   // TransferBatch 中的序号
+	CollectionAddress string `json:"collection_address" gorm:"column:collection_address;type:varchar(42);not null"`           // 合约地址
+	TokenId           string `json:"token_id" gorm:"column:token_id;type:varchar(128);not null"`                              // token_id
+	FromAddress       string `json:"from_address" gorm:"column:from_address;type:varchar(42);not null"`                       // 转出方
+	ToAddress         string `json:"to_address" gorm:"column:to_address;type:varchar(42);not null"`                           // 接收方
+	Amount            int64  `json:"amount" gorm:"column:amount;type:bigint(20);not null;default:1"`                          // 转移数量
+	IsErc1155         bool   `json:"is_erc1155" gorm:"column:is_erc1155;not null;default:0"`                                  // 是否是 ERC-1155 转移
+	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func IndexedTransferTableName() string {
+	return "ob_indexed_transfer"
+}
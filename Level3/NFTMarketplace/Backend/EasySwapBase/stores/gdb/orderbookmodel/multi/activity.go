@@ -20,6 +20,10 @@ const (
 	ItemBid             = 10
 	CancelCollectionBid = 16
 	CancelItemBid       = 17
+	// editOrders 修改订单价格/数量，旧订单被新订单替换
+	EditListing       = 18
+	EditCollectionBid = 19
+	EditItemBid       = 20
 )
 
 const (
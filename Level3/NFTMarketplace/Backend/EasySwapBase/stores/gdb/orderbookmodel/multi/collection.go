@@ -24,6 +24,12 @@ const (
 	OverviewError   = 2
 )
 
+// 合约实现标准
+const (
+	TokenStandardERC721  = 1
+	TokenStandardERC1155 = 2
+)
+
 const (
 	NotSyncHistorySale     = 0
 	AlreadySyncHistorySale = 1
@@ -4,12 +4,28 @@ import (
 	"fmt"
 )
 
+const (
+	// ImportStageQueued 加入任务，等待导入
+	ImportStageQueued = 0
+	// ImportStageCollection 导入 collection 完成，正在导入 item
+	ImportStageCollection = 1
+	// ImportStageFinished 全部完成(指item导入完成，photo不好记录不影响此处的阶段)
+	ImportStageFinished = 2
+	// ImportStageFailed 导入失败，失败原因记录在 msg 中
+	ImportStageFailed = 3
+)
+
 // CollectionImportRecord 导入结果表信息
 type CollectionImportRecord struct {
 	Id                int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:id"` // id
-	CollectionAddress string `json:"address" gorm:"column:address;type:varchar(42);index:index_collection_address;not null;default:'';comment:链上合约地址"`
+	CollectionAddress string `json:"address" gorm:"column:collection_address;type:varchar(42);index:index_collection_address;not null;default:'';comment:链上合约地址"`
 	Msg               string `json:"msg" gorm:"msg;type:varchar(16000);default:'';not null;comment:错误的提示信息"`
-	FinishedStage     int32  `json:"finished_stage" gorm:"column:finished_stage;type:tinyint(1);not null;default:0;comment:已完成的阶段。0表示加入任务，1表示导入collection完成，2全部完成(指item导入完成，photo不好记录不影响此处的阶段)"`
+	FinishedStage     int32  `json:"finished_stage" gorm:"column:finished_stage;type:tinyint(1);not null;default:0;comment:已完成的阶段。0表示加入任务，1表示导入collection完成，2全部完成(指item导入完成，photo不好记录不影响此处的阶段)，3导入失败"`
+	TokenStandard     int64  `json:"token_standard" gorm:"column:token_standard;type:tinyint(4);not null;default:0;comment:合约标准(1:erc721,2:erc1155)"`
+	FromBlock         int64  `json:"from_block" gorm:"column:from_block;type:bigint(20);not null;default:0;comment:合约没有实现ERC721Enumerable或者是ERC-1155时，从该区块开始查找Transfer事件"`
+	ToBlock           int64  `json:"to_block" gorm:"column:to_block;type:bigint(20);not null;default:0;comment:ERC-1155集合重放Transfer事件的截止区块"`
+	ItemTotal         int64  `json:"item_total" gorm:"column:item_total;type:bigint(20);not null;default:0;comment:需要导入的item数量"`
+	ItemImported      int64  `json:"item_imported" gorm:"column:item_imported;type:bigint(20);not null;default:0;comment:已导入的item数量，也是中断后继续导入的位置"`
 	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
 	UpdateTime        int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
 }
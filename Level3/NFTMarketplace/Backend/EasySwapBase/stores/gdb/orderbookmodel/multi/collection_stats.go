@@ -0,0 +1,38 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// CollectionStats 集合在一个时间桶内的成交统计，由同步服务按 5m / 1h / 1d 三种粒度滚动汇总。
+// 地板价快照只在地板价变化时写入当时所在的 5m 桶，某一时刻的地板价为该时刻之前最近的一次快照。
+type CollectionStats struct {
+	Id                int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`
+	CollectionAddress string          `gorm:"column:collection_address" json:"collection_address"`
+	Bucket            int64           `gorm:"column:bucket" json:"bucket"`             // 桶的长度(秒)
+	BucketStart       int64           `gorm:"column:bucket_start" json:"bucket_start"` // 桶的开始时间(秒)，按 UTC 对齐
+	SalesCount        int64           `gorm:"column:sales_count;default:0" json:"sales_count"`
+	Volume            decimal.Decimal `gorm:"column:volume;default:0;NOT NULL" json:"volume"`
+	MinPrice          decimal.Decimal `gorm:"column:min_price;default:0;NOT NULL" json:"min_price"`
+	MaxPrice          decimal.Decimal `gorm:"column:max_price;default:0;NOT NULL" json:"max_price"`
+	OpenPrice         decimal.Decimal `gorm:"column:open_price;default:0;NOT NULL" json:"open_price"`   // 桶内第一笔成交的价格
+	ClosePrice        decimal.Decimal `gorm:"column:close_price;default:0;NOT NULL" json:"close_price"` // 桶内最后一笔成交的价格
+	FloorPrice        decimal.Decimal `gorm:"column:floor_price;default:0;NOT NULL" json:"floor_price"`
+	FloorTime         int64           `gorm:"column:floor_time;default:0" json:"floor_time"` // 地板价快照时间，0 表示没有快照
+	CreateTime        int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"`
+	UpdateTime        int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"`
+}
+
+// AvgPrice 桶内的平均成交价
+func (s *CollectionStats) AvgPrice() decimal.Decimal {
+	if s.SalesCount == 0 {
+		return decimal.Zero
+	}
+	return s.Volume.Div(decimal.NewFromInt(s.SalesCount))
+}
+
+func CollectionStatsTableName(chainName string) string {
+	return fmt.Sprintf("ob_collection_stats_%s", chainName)
+}
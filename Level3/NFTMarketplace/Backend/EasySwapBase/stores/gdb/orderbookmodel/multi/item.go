@@ -19,6 +19,9 @@ type Item struct {
 	ListTime          int64           `gorm:"column:list_time" json:"list_time"`                                                       // 上架时间
 	SalePrice         decimal.Decimal `gorm:"column:sale_price" json:"sale_price"`                                                     // 销售价格
 	Views             int64           `gorm:"column:views" json:"views"`                                                               // 浏览量
+	RarityScore       float64         `gorm:"column:rarity_score" json:"rarity_score"`                                                 // 按属性类别归一化的稀有度得分，越大越稀有
+	RarityStatistical float64         `gorm:"column:rarity_statistical" json:"rarity_statistical"`                                     // 统计稀有度，所有属性取值概率的乘积，越小越稀有
+	RarityRank        int64           `gorm:"column:rarity_rank" json:"rarity_rank"`                                                   // 稀有度排名，1为最稀有，0表示未计算
 	CreateTime        int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
 	UpdateTime        int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
 }
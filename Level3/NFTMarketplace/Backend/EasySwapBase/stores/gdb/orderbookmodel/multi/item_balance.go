@@ -0,0 +1,19 @@
+package multi
+
+import "fmt"
+
+// ItemBalance ERC-1155 token 的持有数量，每个 (collection, token, holder) 一行。
+// ERC-721 的持有人仍然记录在 Item.Owner 中，不写入该表。
+type ItemBalance struct {
+	Id                int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"` // 主键
+	CollectionAddress string `gorm:"column:collection_address;NOT NULL" json:"collection_address"`
+	TokenId           string `gorm:"column:token_id;NOT NULL" json:"token_id"`
+	Owner             string `gorm:"column:owner;NOT NULL" json:"owner"`                                                      // 持有人
+	Balance           int64  `gorm:"column:balance;default:0;NOT NULL" json:"balance"`                                        // 持有数量
+	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ItemBalanceTableName(chainName string) string {
+	return fmt.Sprintf("ob_item_balance_%s", chainName)
+}
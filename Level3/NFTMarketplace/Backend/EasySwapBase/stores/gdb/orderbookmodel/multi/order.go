@@ -51,6 +51,12 @@ type Order struct {
 	Salt       int64 `gorm:"column:salt" json:"salt"`
 	CreateTime int64 `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
 	UpdateTime int64 `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+
+	// editOrders 修改订单时，旧订单的 replaced_by 指向新订单，新订单的 replaces 指向旧订单
+	ReplacedBy string `gorm:"column:replaced_by" json:"replaced_by"`
+	Replaces   string `gorm:"column:replaces" json:"replaces"`
+	// ContractAddress 订单所属的订单簿合约地址（小写），合约暂停时该合约的订单不可成交
+	ContractAddress string `gorm:"column:contract_address" json:"contract_address"`
 }
 
 func OrderTableName(chainName string) string {
@@ -0,0 +1,32 @@
+package multi
+
+import (
+	"fmt"
+)
+
+const (
+	// OrderFailureSkip 合约在挂单/取消/修改订单时跳过了该订单(LogSkipOrder)
+	OrderFailureSkip = 1
+	// OrderFailureBatchMatch 批量撮合中该订单所在的撮合失败(BatchMatchInnerError)
+	OrderFailureBatchMatch = 2
+)
+
+// OrderFailure 记录订单在链上处理失败的情况，order_id 与 ob_order_* 中的 order_id 对应
+type OrderFailure struct {
+	Id                int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	OrderID           string `gorm:"column:order_id" json:"order_id"`                                                         // 订单唯一id
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`                                     // 订单所属集合，订单未入库时为空
+	TokenId           string `gorm:"column:token_id" json:"token_id"`                                                         // 订单对应的token id
+	FailureType       int    `gorm:"column:failure_type;NOT NULL" json:"failure_type"`                                        // 1:skip 2:batch match error
+	BatchOffset       int64  `gorm:"column:batch_offset;default:-1" json:"batch_offset"`                                      // 批量撮合中的序号
+	Reason            string `gorm:"column:reason" json:"reason"`                                                             // 失败原因
+	TxHash            string `gorm:"column:tx_hash" json:"tx_hash"`                                                           // 交易哈希
+	LogIndex          int64  `gorm:"column:log_index" json:"log_index"`                                                       // 日志在区块中的序号
+	BlockNumber       int64  `gorm:"column:block_number" json:"block_number"`                                                 // 区块号
+	EventTime         int64  `gorm:"column:event_time" json:"event_time"`                                                     // 事件时间
+	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func OrderFailureTableName(chainName string) string {
+	return fmt.Sprintf("ob_order_failure_%s", chainName)
+}
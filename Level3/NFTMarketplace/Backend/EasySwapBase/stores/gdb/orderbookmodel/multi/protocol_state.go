@@ -0,0 +1,25 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ProtocolState 记录订单簿合约的全局状态，由同步服务根据合约事件维护
+type ProtocolState struct {
+	Id              int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	ContractAddress string          `gorm:"column:contract_address;NOT NULL" json:"contract_address"`                                // 订单簿合约地址
+	ProtocolShare   decimal.Decimal `gorm:"column:protocol_share;type:decimal(30);default:0" json:"protocol_share"`                  // 协议手续费比例(合约原始值)
+	Vault           string          `gorm:"column:vault" json:"vault"`                                                               // 资产托管合约地址
+	Owner           string          `gorm:"column:owner" json:"owner"`                                                               // 合约owner
+	Paused          bool            `gorm:"column:paused;default:0;NOT NULL" json:"paused"`                                          // 合约是否已暂停
+	WithdrawnEth    decimal.Decimal `gorm:"column:withdrawn_eth;type:decimal(30);default:0" json:"withdrawn_eth"`                    // 累计提取的ETH
+	BlockNumber     int64           `gorm:"column:block_number" json:"block_number"`                                                 // 最后一次变更所在区块
+	CreateTime      int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime      int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ProtocolStateTableName(chainName string) string {
+	return fmt.Sprintf("ob_protocol_state_%s", chainName)
+}
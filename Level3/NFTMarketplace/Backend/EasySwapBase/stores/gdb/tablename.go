@@ -78,3 +78,19 @@ func GetMultiProjectCollectionTradeTableName(project string, chain string) strin
 		return ""
 	}
 }
+
+func GetMultiProjectItemBalanceTableName(project string, chain string) string {
+	if project == OrderBookDexProject {
+		return multi.ItemBalanceTableName(chain)
+	} else {
+		return ""
+	}
+}
+
+func GetMultiProjectCollectionStatsTableName(project string, chain string) string {
+	if project == OrderBookDexProject {
+		return multi.CollectionStatsTableName(chain)
+	} else {
+		return ""
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+var (
+	// backfillFrom 回填的起始区块
+	backfillFrom uint64
+	// backfillTo 回填的结束区块（包含）
+	backfillTo uint64
+	// backfillWorkers 并行获取日志的协程数
+	backfillWorkers int
+	// backfillChain 回填的链名称，为空时使用配置中的第一条链
+	backfillChain string
+)
+
+// BackfillCmd 是一个 cobra 命令，用于回填历史区块中的订单簿事件。
+var BackfillCmd = &cobra.Command{
+	// Use 是命令的使用说明，用户可以通过这个名称来调用此命令。
+	Use: "backfill",
+	// Short 是命令的简短描述，用于快速了解命令的作用。
+	Short: "backfill easy swap order info from history blocks.",
+	// Long 是命令的详细描述，提供更全面的信息。
+	Long: "backfill easy swap order info from history blocks, e.g. sync backfill --from 5000000 --to 6000000 --workers 8.",
+	// Run 是命令执行时调用的函数，回填完成或出错后退出。
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// 读取和解析配置文件
+		cfg, err := config.UnmarshalCmdConfig()
+		if err != nil {
+			xzap.WithContext(ctx).Error("Failed to unmarshal config", zap.Error(err))
+			os.Exit(1)
+		}
+
+		// 初始化日志模块
+		if _, err := xzap.SetUp(*cfg.Log); err != nil {
+			xzap.WithContext(ctx).Error("Failed to set up logger", zap.Error(err))
+			os.Exit(1)
+		}
+
+		// 收到退出信号时取消上下文，已提交的区间不受影响，可以通过 --from 继续
+		onSignal := make(chan os.Signal, 1)
+		signal.Notify(onSignal, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-onSignal
+			cancel()
+		}()
+
+		xzap.WithContext(ctx).Info("backfill start", zap.String("chain", backfillChain),
+			zap.Uint64("from", backfillFrom), zap.Uint64("to", backfillTo), zap.Int("workers", backfillWorkers))
+		if err := service.Backfill(ctx, cfg, backfillChain, backfillFrom, backfillTo, backfillWorkers); err != nil {
+			xzap.WithContext(ctx).Error("Failed to backfill", zap.Error(err))
+			os.Exit(1)
+		}
+		xzap.WithContext(ctx).Info("backfill finished")
+	},
+}
+
+// init 是 Go 语言中的特殊初始化函数，在包被导入时自动执行。
+func init() {
+	flags := BackfillCmd.Flags()
+	flags.Uint64Var(&backfillFrom, "from", 0, "first block to backfill")
+	flags.Uint64Var(&backfillTo, "to", 0, "last block to backfill (inclusive)")
+	flags.IntVar(&backfillWorkers, "workers", 4, "number of parallel range workers")
+	flags.StringVar(&backfillChain, "chain", "", "chain name in config, default is the first chain")
+	_ = BackfillCmd.MarkFlagRequired("from")
+	_ = BackfillCmd.MarkFlagRequired("to")
+
+	// 将 BackfillCmd 命令添加到 rootCmd 主命令中，与 DaemonCmd 并列。
+	rootCmd.AddCommand(BackfillCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+// replayChain 重放死信的链名称，为空时使用配置中的第一条链
+var replayChain string
+
+// ReplayDeadLettersCmd 是一个 cobra 命令，用于重新应用写入死信表的订单簿日志。
+var ReplayDeadLettersCmd = &cobra.Command{
+	// Use 是命令的使用说明，用户可以通过这个名称来调用此命令。
+	Use: "replay-dead-letters",
+	// Short 是命令的简短描述，用于快速了解命令的作用。
+	Short: "replay easy swap orderbook logs in dead letter table.",
+	// Long 是命令的详细描述，提供更全面的信息。
+	Long: "replay easy swap orderbook logs in dead letter table after the decode or validation bug is fixed, e.g. sync replay-dead-letters --chain sepolia.",
+	// Run 是命令执行时调用的函数，重放完成或出错后退出。
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// 读取和解析配置文件
+		cfg, err := config.UnmarshalCmdConfig()
+		if err != nil {
+			xzap.WithContext(ctx).Error("Failed to unmarshal config", zap.Error(err))
+			os.Exit(1)
+		}
+
+		// 初始化日志模块
+		if _, err := xzap.SetUp(*cfg.Log); err != nil {
+			xzap.WithContext(ctx).Error("Failed to set up logger", zap.Error(err))
+			os.Exit(1)
+		}
+
+		// 收到退出信号时取消上下文，每条死信在独立的事务中重放，已重放的死信不受影响
+		onSignal := make(chan os.Signal, 1)
+		signal.Notify(onSignal, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-onSignal
+			cancel()
+		}()
+
+		xzap.WithContext(ctx).Info("replay dead letters start", zap.String("chain", replayChain))
+		if err := service.ReplayDeadLetters(ctx, cfg, replayChain); err != nil {
+			xzap.WithContext(ctx).Error("Failed to replay dead letters", zap.Error(err))
+			os.Exit(1)
+		}
+		xzap.WithContext(ctx).Info("replay dead letters finished")
+	},
+}
+
+// init 是 Go 语言中的特殊初始化函数，在包被导入时自动执行。
+func init() {
+	ReplayDeadLettersCmd.Flags().StringVar(&replayChain, "chain", "", "chain name in config, default is the first chain")
+
+	// 将 ReplayDeadLettersCmd 命令添加到 rootCmd 主命令中，与 BackfillCmd 并列。
+	rootCmd.AddCommand(ReplayDeadLettersCmd)
+}
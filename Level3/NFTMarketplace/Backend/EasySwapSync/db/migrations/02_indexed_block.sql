@@ -0,0 +1,32 @@
+create table ob_indexed_block
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint  default 1 not null comment '链id',
+    index_type   tinyint default 0 not null comment '与 ob_indexed_status.index_type 对应',
+    block_number bigint            not null comment '区块号',
+    block_hash   varchar(66)       not null comment '区块哈希',
+    parent_hash  varchar(66)       not null comment '父区块哈希',
+    create_time  bigint            null comment '创建时间',
+    constraint index_chain_type_block
+        unique (chain_id, index_type, block_number)
+)
+    collate = utf8mb4_general_ci;
+
+create table ob_indexed_undo_log
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint  default 1 not null comment '链id',
+    index_type   tinyint default 0 not null comment '与 ob_indexed_status.index_type 对应',
+    block_number bigint            not null comment '产生修改的区块号',
+    target_table varchar(128)      not null comment '被修改的表',
+    action       tinyint           not null comment '1:insert 2:update',
+    row_key      varchar(1024)     not null comment '定位行的条件(json)',
+    prev_values  text              null comment '更新前的列值(json)',
+    create_time  bigint            null comment '创建时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_chain_type_block
+    on ob_indexed_undo_log (chain_id, index_type, block_number);
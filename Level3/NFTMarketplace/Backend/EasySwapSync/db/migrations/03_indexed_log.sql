@@ -0,0 +1,34 @@
+create table ob_indexed_log
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint  default 1 not null comment '链id',
+    index_type   tinyint default 0 not null comment '与 ob_indexed_status.index_type 对应',
+    block_number bigint            not null comment '区块号',
+    tx_hash      varchar(66)       not null comment '交易哈希',
+    log_index    bigint            not null comment '日志在区块中的序号',
+    create_time  bigint            null comment '创建时间',
+    constraint index_chain_type_tx_log
+        unique (chain_id, index_type, tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
+
+create table ob_indexed_dead_letter
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint  default 1 not null comment '链id',
+    index_type   tinyint default 0 not null comment '与 ob_indexed_status.index_type 对应',
+    block_number bigint            not null comment '区块号',
+    block_hash   varchar(66)       not null comment '区块哈希',
+    tx_hash      varchar(66)       not null comment '交易哈希',
+    log_index    bigint            not null comment '日志在区块中的序号',
+    topic        varchar(66)       not null comment '事件签名',
+    raw_log      text              null comment '原始日志(json)',
+    error        varchar(1024)     null comment '最后一次失败原因',
+    attempts     int     default 0 not null comment '已尝试次数',
+    create_time  bigint            null comment '创建时间',
+    constraint index_chain_type_tx_log
+        unique (chain_id, index_type, tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
@@ -0,0 +1,40 @@
+create table ob_protocol_state_sepolia
+(
+    id               bigint auto_increment comment '主键'
+        primary key,
+    contract_address varchar(42)                not null comment '订单簿合约地址',
+    protocol_share   decimal(30) default 0      not null comment '协议手续费比例(合约原始值)',
+    vault            varchar(42)                null comment '资产托管合约地址',
+    owner            varchar(42)                null comment '合约owner',
+    paused           tinyint(1)  default 0      not null comment '合约是否已暂停',
+    withdrawn_eth    decimal(30) default 0      not null comment '累计提取的ETH',
+    block_number     bigint      default 0      not null comment '最后一次变更所在区块',
+    create_time      bigint                     null comment '创建时间',
+    update_time      bigint                     null comment '更新时间',
+    constraint index_contract_address
+        unique (contract_address)
+)
+    collate = utf8mb4_general_ci;
+
+create table ob_order_failure_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    order_id           varchar(66)   default '' not null comment '订单唯一id',
+    collection_address varchar(42)              null comment '订单所属集合',
+    token_id           varchar(128)             null comment '订单对应的token id',
+    failure_type       tinyint                  not null comment '1:skip 2:batch match error',
+    batch_offset       bigint        default -1 not null comment '批量撮合中的序号',
+    reason             varchar(1024)            null comment '失败原因',
+    tx_hash            varchar(66)              not null comment '交易哈希',
+    log_index          bigint                   not null comment '日志在区块中的序号',
+    block_number       bigint                   not null comment '区块号',
+    event_time         bigint                   null comment '事件时间',
+    create_time        bigint                   null comment '创建时间',
+    constraint index_tx_log_order
+        unique (tx_hash, log_index, order_id)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_order_id
+    on ob_order_failure_sepolia (order_id);
@@ -0,0 +1,9 @@
+alter table ob_order_sepolia
+    add replaced_by varchar(66) default '' not null comment 'editOrders 替换该订单的新订单id' after salt,
+    add replaces    varchar(66) default '' not null comment 'editOrders 中被该订单替换的旧订单id' after replaced_by;
+
+create index index_replaced_by
+    on ob_order_sepolia (replaced_by);
+
+create index index_replaces
+    on ob_order_sepolia (replaces);
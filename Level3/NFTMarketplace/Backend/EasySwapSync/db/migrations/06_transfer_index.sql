@@ -0,0 +1,4 @@
+-- ERC-721 Transfer 同步进度 (index_type = 7)，last_indexed_block 为 0 表示尚未同步，
+-- 首次同步从链配置的 transfer_start_block（最早导入集合的部署区块）开始
+insert into ob_indexed_status (chain_id, last_indexed_block, last_indexed_time, index_type, create_time, update_time)
+values (11155111, 0, 0, 7, unix_timestamp() * 1000, unix_timestamp() * 1000);
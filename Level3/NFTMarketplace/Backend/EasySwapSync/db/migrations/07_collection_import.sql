@@ -0,0 +1,13 @@
+-- 集合导入任务的合约标准和进度
+alter table ob_collection_import_record_sepolia
+    add token_standard tinyint default 0 not null comment '合约标准(1:erc721,2:erc1155)' after finished_stage,
+    add from_block     bigint  default 0 not null comment '合约没有实现ERC721Enumerable时，从该区块开始查找mint事件' after token_standard,
+    add item_total     bigint  default 0 not null comment '需要导入的item数量' after from_block,
+    add item_imported  bigint  default 0 not null comment '已导入的item数量，也是中断后继续导入的位置' after item_total,
+    modify finished_stage tinyint(1) default 0 not null comment '已完成的阶段。0表示加入任务，1表示导入collection完成，2全部完成，3导入失败';
+
+create index index_collection_address
+    on ob_collection_import_record_sepolia (collection_address);
+
+create index index_finished_stage
+    on ob_collection_import_record_sepolia (finished_stage);
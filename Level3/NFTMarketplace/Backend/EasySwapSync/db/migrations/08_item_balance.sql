@@ -0,0 +1,22 @@
+-- ERC-1155 token 的持有数量，每个 (collection, token, holder) 一行，ERC-721 的持有人仍然记录在 ob_item_*.owner
+create table ob_item_balance_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    collection_address varchar(42)      not null comment '合约地址',
+    token_id           varchar(128)     not null comment 'token_id',
+    owner              varchar(42)      not null comment '持有人',
+    balance            bigint default 0 not null comment '持有数量',
+    create_time        bigint           null comment '创建时间',
+    update_time        bigint           null comment '更新时间',
+    constraint index_collection_token_owner
+        unique (collection_address, token_id, owner)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_collection_owner
+    on ob_item_balance_sepolia (collection_address, owner);
+
+-- ERC-1155 集合按 Transfer 事件重放持有数量，重放截止的区块之后的事件由 Transfer 事件同步器处理
+alter table ob_collection_import_record_sepolia
+    add to_block bigint default 0 not null comment 'ERC-1155集合重放Transfer事件的截止区块' after from_block;
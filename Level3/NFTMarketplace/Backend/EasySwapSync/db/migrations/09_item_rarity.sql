@@ -0,0 +1,9 @@
+-- item 的稀有度，集合的属性变化后整体重新计算
+alter table ob_item_sepolia
+    add rarity_score       double default 0 not null comment '按属性类别归一化的稀有度得分，越大越稀有' after views,
+    add rarity_statistical double default 0 not null comment '统计稀有度，所有属性取值概率的乘积，越小越稀有' after rarity_score,
+    add rarity_rank        bigint default 0 not null comment '稀有度排名，1为最稀有，0表示未计算' after rarity_statistical;
+
+create index index_collection_rarity_rank
+    on ob_item_sepolia (collection_address, rarity_rank);
+
@@ -0,0 +1,26 @@
+-- 集合按时间桶汇总的成交统计，bucket 为桶的长度(300 / 3600 / 86400 秒)
+create table ob_collection_stats_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    collection_address varchar(42)                not null comment '合约地址',
+    bucket             bigint                     not null comment '桶的长度(秒)',
+    bucket_start       bigint                     not null comment '桶的开始时间(秒)',
+    sales_count        bigint         default 0   not null comment '成交数量',
+    volume             decimal(30)    default 0   not null comment '成交额',
+    min_price          decimal(30)    default 0   not null comment '最低成交价',
+    max_price          decimal(30)    default 0   not null comment '最高成交价',
+    floor_price        decimal(30)    default 0   not null comment '地板价快照',
+    floor_time         bigint         default 0   not null comment '地板价快照时间，0表示没有快照',
+    create_time        bigint                     null comment '创建时间',
+    update_time        bigint                     null comment '更新时间',
+    constraint index_collection_bucket
+        unique (collection_address, bucket, bucket_start)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_bucket_start
+    on ob_collection_stats_sepolia (bucket, bucket_start);
+
+create index index_collection_floor_time
+    on ob_collection_stats_sepolia (collection_address, floor_time);
@@ -0,0 +1,9 @@
+-- 集合统计增加开盘价和收盘价，K 线由各个桶合并得到
+-- 已有的桶没有开盘价和收盘价，执行后删除缓存中的汇总游标 cache:es:<chain>:stats:rollup:cursor，同步服务会重新汇总全部历史成交
+alter table ob_collection_stats_sepolia
+    add column open_price  decimal(30) default 0 not null comment '桶内第一笔成交的价格' after max_price,
+    add column close_price decimal(30) default 0 not null comment '桶内最后一笔成交的价格' after open_price;
+
+-- 按集合和时间范围查询地板价历史
+create index index_collection_event_time
+    on ob_collection_floor_price_sepolia (collection_address, event_time);
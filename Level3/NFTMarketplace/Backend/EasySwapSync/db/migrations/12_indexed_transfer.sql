@@ -0,0 +1,24 @@
+-- Transfer 事件同步器已应用的转移，用于跳过重复同步的转移，以及链重组时撤销分叉区块上的转移
+create table ob_indexed_transfer
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    chain_id           bigint     default 1 not null comment '链id',
+    block_number       bigint               not null comment '区块号',
+    tx_hash            varchar(66)          not null comment '交易哈希',
+    log_index          bigint               not null comment '日志在区块中的序号',
+    batch_index        int        default 0 not null comment 'TransferBatch 中的序号',
+    collection_address varchar(42)          not null comment '合约地址',
+    token_id           varchar(128)         not null comment 'token_id',
+    from_address       varchar(42)          not null comment '转出方',
+    to_address         varchar(42)          not null comment '接收方',
+    amount             bigint     default 1 not null comment '转移数量',
+    is_erc1155         tinyint(1) default 0 not null comment '是否是 ERC-1155 转移',
+    create_time        bigint               null comment '创建时间',
+    constraint index_chain_tx_log_batch
+        unique (chain_id, tx_hash, log_index, batch_index)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_chain_block
+    on ob_indexed_transfer (chain_id, block_number);
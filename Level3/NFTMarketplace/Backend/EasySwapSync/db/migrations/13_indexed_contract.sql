@@ -0,0 +1,39 @@
+-- 同一条链上部署多个订单簿合约时，订单簿同步进度按 (chain_id, index_type, contract_address) 分别记录，
+-- 其他同步任务（Transfer、地板价等）的 contract_address 为空
+alter table ob_indexed_status
+    add contract_address varchar(42) default '' not null comment '订单簿合约地址(小写)' after index_type;
+
+alter table ob_indexed_block
+    add contract_address varchar(42) default '' not null comment '与 ob_indexed_status.contract_address 对应' after index_type;
+
+alter table ob_indexed_block
+    drop index index_chain_type_block;
+
+alter table ob_indexed_block
+    add constraint index_chain_type_contract_block
+        unique (chain_id, index_type, contract_address, block_number);
+
+alter table ob_indexed_undo_log
+    add contract_address varchar(42) default '' not null comment '与 ob_indexed_status.contract_address 对应' after index_type;
+
+drop index index_chain_type_block on ob_indexed_undo_log;
+
+create index index_chain_type_contract_block
+    on ob_indexed_undo_log (chain_id, index_type, contract_address, block_number);
+
+-- 已有的订单簿同步进度、已索引区块和回滚记录归属到链配置的 dex_address，
+-- 新增的订单簿合约需要插入一条自己的 ob_indexed_status 记录
+update ob_indexed_status
+set contract_address = lower('0x5560e1c2E0260c2274e400d80C30CDC4B92dC8ac')
+where chain_id = 11155111
+  and index_type = 6;
+
+update ob_indexed_block
+set contract_address = lower('0x5560e1c2E0260c2274e400d80C30CDC4B92dC8ac')
+where chain_id = 11155111
+  and index_type = 6;
+
+update ob_indexed_undo_log
+set contract_address = lower('0x5560e1c2E0260c2274e400d80C30CDC4B92dC8ac')
+where chain_id = 11155111
+  and index_type = 6;
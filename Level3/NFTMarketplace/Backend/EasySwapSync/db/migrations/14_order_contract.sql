@@ -0,0 +1,8 @@
+alter table ob_order_sepolia
+    add contract_address varchar(42) default '' not null comment '订单所属的订单簿合约地址' after replaces;
+
+create index index_contract_address
+    on ob_order_sepolia (contract_address);
+
+-- 已有订单都来自升级前唯一的订单簿合约，按配置中的 dex_address（小写）补齐
+-- update ob_order_sepolia set contract_address = '<dex_address>' where contract_address = '';
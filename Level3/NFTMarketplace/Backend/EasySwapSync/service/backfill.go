@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/model"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+	"github.com/ProjectsTask/EasySwapSync/service/orderbookindexer"
+)
+
+// Backfill 回填一条链 [from, to] 区间内的订单簿事件。
+// 参数 chainName 指定配置中的链，为空时使用第一条链。
+// 参数 workers 是并行获取日志的协程数。
+func Backfill(ctx context.Context, cfg *config.Config, chainName string, from, to uint64, workers int) error {
+	chainCfg, err := findChainConfig(cfg, chainName)
+	if err != nil {
+		return err
+	}
+
+	kvStore := newKvStore(cfg)
+	db := model.NewDB(cfg.DB)
+	chainClient, err := newChainClient(ctx, chainCfg)
+	if err != nil {
+		return err
+	}
+	// 回填只把订单写入订单管理队列，不启动订单管理器，由守护进程处理
+	orderManager := ordermanager.New(ctx, db, kvStore, chainCfg.ChainCfg.Name, chainCfg.ProjectCfg.Name)
+	// 依次回填该链上的每个订单簿合约，各合约的同步进度分别记录
+	for _, dex := range chainCfg.ContractCfg.Dexes() {
+		indexer := orderbookindexer.New(ctx, chainCfg, db, kvStore, chainClient, chainCfg.ChainCfg.ID,
+			chainCfg.ChainCfg.Name, dex, orderManager)
+		if err := indexer.Backfill(from, to, workers); err != nil {
+			return errors.Wrapf(err, "failed on backfill orderbook contract %s", dex)
+		}
+	}
+	return nil
+}
+
+// ReplayDeadLetters 重新应用一条链上各订单簿合约写入死信表的日志。
+// 参数 chainName 指定配置中的链，为空时使用第一条链。
+func ReplayDeadLetters(ctx context.Context, cfg *config.Config, chainName string) error {
+	chainCfg, err := findChainConfig(cfg, chainName)
+	if err != nil {
+		return err
+	}
+
+	kvStore := newKvStore(cfg)
+	db := model.NewDB(cfg.DB)
+	chainClient, err := newChainClient(ctx, chainCfg)
+	if err != nil {
+		return err
+	}
+	// 与回填相同，只把订单写入订单管理队列，由守护进程处理
+	orderManager := ordermanager.New(ctx, db, kvStore, chainCfg.ChainCfg.Name, chainCfg.ProjectCfg.Name)
+	for _, dex := range chainCfg.ContractCfg.Dexes() {
+		indexer := orderbookindexer.New(ctx, chainCfg, db, kvStore, chainClient, chainCfg.ChainCfg.ID,
+			chainCfg.ChainCfg.Name, dex, orderManager)
+		replayed, err := indexer.ReplayDeadLetters()
+		if err != nil {
+			return errors.Wrapf(err, "failed on replay dead letters of orderbook contract %s", dex)
+		}
+		xzap.WithContext(ctx).Info("dead letters replayed", zap.String("contract", dex), zap.Int("replayed", replayed))
+	}
+	return nil
+}
+
+// findChainConfig 返回配置中名称为 chainName 的链，为空时返回第一条链
+func findChainConfig(cfg *config.Config, chainName string) (*config.Config, error) {
+	chainConfigs := cfg.ChainConfigs()
+	if err := validateChainConfigs(chainConfigs); err != nil {
+		return nil, err
+	}
+	for _, c := range chainConfigs {
+		if chainName == "" || c.ChainCfg.Name == chainName {
+			return c, nil
+		}
+	}
+	return nil, errors.Errorf("chain %s not found in config", chainName)
+}
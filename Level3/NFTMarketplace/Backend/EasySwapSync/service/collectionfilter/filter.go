@@ -94,6 +94,21 @@ func (f *Filter) Contains(element string) bool {
 	return exists
 }
 
+// Elements 返回过滤器中的全部元素（小写）。
+// 返回值:
+// - []string: 过滤器中元素的副本，顺序不固定。
+func (f *Filter) Elements() []string {
+	// 获取读锁，允许多个 goroutine 同时读取
+	f.lock.RLock()
+	// 延迟解锁，确保在函数返回时释放锁
+	defer f.lock.RUnlock()
+	elements := make([]string, 0, len(f.set))
+	for element := range f.set {
+		elements = append(elements, element)
+	}
+	return elements
+}
+
 // PreloadCollections 预加载符合条件的集合地址到过滤器中。
 // 该函数从数据库中查询所有 floor_price_status 为 CollectionFloorPriceImported 的集合地址，
 // 并将这些地址添加到过滤器中。
@@ -34,3 +34,19 @@ func TestFilter(t *testing.T) {
 		t.Error("Expected Filter to not contain 'Test'")
 	}
 }
+
+func TestFilterElements(t *testing.T) {
+	filter := New(nil, nil, "optimism", "EZSwap")
+	filter.Add("0xABC")
+	filter.Add("0xdef")
+
+	elements := filter.Elements()
+	if len(elements) != 2 {
+		t.Fatalf("Expected 2 elements, got %d", len(elements))
+	}
+	for _, element := range elements {
+		if element != "0xabc" && element != "0xdef" {
+			t.Errorf("Unexpected element %s", element)
+		}
+	}
+}
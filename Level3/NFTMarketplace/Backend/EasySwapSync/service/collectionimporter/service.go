@@ -0,0 +1,776 @@
+package collectionimporter
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/rarity"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/threading"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+const (
+	SleepInterval = 10 // in seconds
+
+	ZeroAddress = "0x0000000000000000000000000000000000000000"
+)
+
+// nodeService 读取合约信息、token owner 和元数据，由 nftchainservice.Service 实现
+type nodeService interface {
+	FetchCollectionInfo(collectionAddr string) (*nftchainservice.CollectionInfo, error)
+	TokenByIndex(collectionAddr string, index int64) (string, error)
+	FetchNftOwner(collectionAddr string, tokenID string) (common.Address, error)
+	TokenURI(collectionAddr string, tokenID string) (string, error)
+	URI(collectionAddr string, tokenID string) (string, error)
+	FetchMetadataByURI(tokenUri string) (*nftchainservice.JsonMetadata, error)
+	GetNFTTransferEventByAddresses(fromBlock, toBlock uint64, addresses []string) ([]*nftchainservice.TransferLog, error)
+}
+
+// blockNumberFetcher 获取当前最新区块高度
+type blockNumberFetcher interface {
+	BlockNumber() (uint64, error)
+}
+
+// Service 处理 ob_collection_import_record_* 中的导入任务：
+// 检测合约标准，读取名称、符号和发行总量，枚举全部 token 及其 owner（ERC-1155 为各持有人的数量）和元数据，
+// 写入 ob_collection_* / ob_item_* / ob_item_balance_* / ob_item_trait_* / ob_item_external_*，
+// 完成后把集合加入运行中的集合过滤器和订单管理器，不需要重启同步服务。
+type Service struct {
+	ctx              context.Context
+	db               *gorm.DB
+	kv               *xkv.Store
+	nodes            nodeService
+	chainClient      blockNumberFetcher
+	collectionFilter *collectionfilter.Filter
+	cfg              config.ImportCfg
+	chainId          int64
+	chain            string
+	project          string
+}
+
+// New 创建一个新的 Service 实例。
+// 参数:
+// - ctx: 上下文环境，用于控制操作的生命周期。
+// - db: 数据库连接，用于读取导入任务和写入集合数据。
+// - xkv: 键值存储，用于通知订单管理器导入了新集合。
+// - nodeService: NFT 链服务，用于读取合约信息、owner 和元数据。
+// - collectionFilter: 集合过滤器，导入的集合会加入其中。
+// - cfg: 导入配置。
+// - chainId: 链的唯一标识符。
+// - chain: 链的名称。
+// - project: 项目名称。
+// 返回值:
+// - *Service: 初始化后的 Service 指针。
+func New(ctx context.Context, db *gorm.DB, xkv *xkv.Store, nodeService *nftchainservice.Service,
+	collectionFilter *collectionfilter.Filter, cfg config.ImportCfg, chainId int64, chain, project string) *Service {
+	return &Service{
+		ctx:              ctx,
+		db:               db,
+		kv:               xkv,
+		nodes:            nodeService,
+		chainClient:      nodeService.NodeClient,
+		collectionFilter: collectionFilter,
+		cfg:              cfg,
+		chainId:          chainId,
+		chain:            chain,
+		project:          project,
+	}
+}
+
+// Start 启动导入任务处理循环
+func (s *Service) Start() {
+	threading.GoSafe(s.ImportLoop)
+}
+
+// ImportLoop 按加入顺序逐个处理未完成的导入任务。
+// 导入失败时把任务标记为失败并记录原因，重新提交导入后从记录的进度继续。
+func (s *Service) ImportLoop() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			xzap.WithContext(s.ctx).Info("ImportLoop stopped due to context cancellation")
+			return
+		default:
+		}
+
+		record, err := s.nextRecord()
+		if err != nil {
+			xzap.WithContext(s.ctx).Error("failed on get collection import record", zap.Error(err))
+			time.Sleep(SleepInterval * time.Second)
+			continue
+		}
+		if record == nil {
+			time.Sleep(SleepInterval * time.Second)
+			continue
+		}
+
+		if err := s.importCollection(record); err != nil {
+			// 进程退出导致的失败保留任务状态，重启后继续导入
+			if s.ctx.Err() != nil {
+				return
+			}
+			xzap.WithContext(s.ctx).Error("failed on import collection", zap.Error(err),
+				zap.String("collection_address", record.CollectionAddress))
+			if err := s.updateRecord(record.Id, map[string]interface{}{
+				"finished_stage": multi.ImportStageFailed,
+				"msg":            truncate(err.Error(), 1600),
+			}); err != nil {
+				xzap.WithContext(s.ctx).Error("failed on mark collection import failed", zap.Error(err),
+					zap.String("collection_address", record.CollectionAddress))
+			}
+		}
+	}
+}
+
+// nextRecord 获取最早加入的未完成导入任务，没有任务时返回 nil
+func (s *Service) nextRecord() (*multi.CollectionImportRecord, error) {
+	var records []*multi.CollectionImportRecord
+	if err := s.db.WithContext(s.ctx).Table(multi.CollectionImportRecordTableName(s.chain)).
+		Where("finished_stage in (?)", []int{multi.ImportStageQueued, multi.ImportStageCollection}).
+		Order("id asc").Limit(1).
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query collection import record")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func (s *Service) updateRecord(id int64, updates map[string]interface{}) error {
+	return s.db.WithContext(s.ctx).Table(multi.CollectionImportRecordTableName(s.chain)).
+		Where("id = ?", id).Updates(updates).Error
+}
+
+// importCollection 导入一个集合：
+// 1. 检测合约标准，写入集合信息
+// 2. 把集合加入过滤器，Transfer 事件同步器从此开始维护该集合的 owner 和持有数量
+// 3. 枚举 token，分批读取 owner（ERC-1155 为重放得到的持有数量）和元数据并写入，每批完成后记录进度
+// 4. 更新集合的统计信息，标记为已导入并通知订单管理器
+func (s *Service) importCollection(record *multi.CollectionImportRecord) error {
+	address := strings.ToLower(record.CollectionAddress)
+	xzap.WithContext(s.ctx).Info("import collection start", zap.String("collection_address", address),
+		zap.Int64("item_imported", record.ItemImported))
+
+	info, err := s.nodes.FetchCollectionInfo(address)
+	if err != nil {
+		return errors.Wrap(err, "failed on fetch collection info")
+	}
+	var standard int64
+	switch {
+	case info.IsERC721:
+		standard = multi.TokenStandardERC721
+	case info.IsERC1155:
+		standard = multi.TokenStandardERC1155
+	default:
+		return errors.New("contract does not support erc721 or erc1155 interface")
+	}
+
+	if err := s.saveCollection(address, info, standard); err != nil {
+		return err
+	}
+	if err := s.updateRecord(record.Id, map[string]interface{}{
+		"finished_stage": multi.ImportStageCollection,
+		"token_standard": standard,
+		"msg":            "",
+	}); err != nil {
+		return errors.Wrap(err, "failed on update collection import stage")
+	}
+
+	// 先加入过滤器再读取 owner：之后发生的转移由 Transfer 事件同步器处理，不会被导入的旧 owner 覆盖
+	s.collectionFilter.Add(address)
+
+	var tokens *tokenList
+	if standard == multi.TokenStandardERC1155 {
+		tokens, err = s.listERC1155Tokens(record, address)
+	} else {
+		tokens, err = s.listTokens(address, info, uint64(record.FromBlock))
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.updateRecord(record.Id, map[string]interface{}{"item_total": tokens.total}); err != nil {
+		return errors.Wrap(err, "failed on update collection import total")
+	}
+
+	for start := record.ItemImported; start < tokens.total; start += int64(s.cfg.BatchSize) {
+		end := start + int64(s.cfg.BatchSize)
+		if end > tokens.total {
+			end = tokens.total
+		}
+		items, err := s.fetchItems(address, tokens, start, end)
+		if err != nil {
+			return err
+		}
+		if err := s.saveItems(record.Id, address, items, end); err != nil {
+			return err
+		}
+		xzap.WithContext(s.ctx).Info("import collection items", zap.String("collection_address", address),
+			zap.Int64("item_imported", end), zap.Int64("item_total", tokens.total))
+	}
+
+	if err := s.finishCollection(record.Id, address, standard); err != nil {
+		return err
+	}
+
+	// 订单管理器收到事件后开始跟踪该集合的地板价
+	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
+		EventType:      ordermanager.ImportCollection,
+		CollectionAddr: address,
+	}, s.chain); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on add import collection event", zap.Error(err),
+			zap.String("collection_address", address))
+	}
+
+	xzap.WithContext(s.ctx).Info("import collection finished", zap.String("collection_address", address),
+		zap.Int64("item_total", tokens.total))
+	return nil
+}
+
+// saveCollection 写入集合信息，重复导入时只更新合约信息，不影响地板价等统计数据
+func (s *Service) saveCollection(address string, info *nftchainservice.CollectionInfo, standard int64) error {
+	collection := &multi.Collection{
+		Symbol:           info.Symbol,
+		ChainId:          int(s.chainId),
+		TokenStandard:    standard,
+		Name:             info.Name,
+		Address:          address,
+		FloorPriceStatus: comm.CollectionFloorPriceNotImport,
+	}
+	if info.TotalSupply != nil && info.TotalSupply.IsInt64() {
+		collection.ItemAmount = info.TotalSupply.Int64()
+	}
+	if err := s.db.WithContext(s.ctx).Table(gdb.GetMultiProjectCollectionTableName(s.project, s.chain)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"symbol", "name", "token_standard", "update_time"}),
+		}).Create(collection).Error; err != nil {
+		return errors.Wrap(err, "failed on save collection")
+	}
+	return nil
+}
+
+// tokenList 需要导入的 token，tokenAt 按导入顺序返回第 index 个 token
+type tokenList struct {
+	total   int64
+	tokenAt func(index int64) (string, error)
+	// creators 通过 mint 事件枚举时记录每个 token 的 mint 接收方
+	creators map[string]string
+	// balances ERC-1155 集合重放 Transfer 事件得到的每个 token 各持有人的数量，ERC-721 集合为 nil
+	balances map[string]map[string]int64
+}
+
+// listTokens 枚举集合的全部 token。
+// 实现了 ERC721Enumerable 的合约通过 tokenByIndex 枚举，否则从 fromBlock 开始查找 mint 事件。
+// 两种方式的顺序都是固定的，中断后按已导入的数量继续。
+func (s *Service) listTokens(address string, info *nftchainservice.CollectionInfo, fromBlock uint64) (*tokenList, error) {
+	if info.Enumerable && info.TotalSupply != nil && info.TotalSupply.IsInt64() {
+		return &tokenList{
+			total: info.TotalSupply.Int64(),
+			tokenAt: func(index int64) (string, error) {
+				return s.nodes.TokenByIndex(address, index)
+			},
+		}, nil
+	}
+
+	toBlock, err := s.chainClient.BlockNumber()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get current block number")
+	}
+	mints, err := s.scanMints(address, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	tokenIds, creators := mintedTokens(mints)
+	return &tokenList{
+		total: int64(len(tokenIds)),
+		tokenAt: func(index int64) (string, error) {
+			return tokenIds[index], nil
+		},
+		creators: creators,
+	}, nil
+}
+
+// scanMints 分段查找 [fromBlock, toBlock] 区间内集合的 Transfer 事件，节点请求失败时把区间减半后重试
+func (s *Service) scanMints(address string, fromBlock, toBlock uint64) ([]*nftchainservice.TransferLog, error) {
+	var logs []*nftchainservice.TransferLog
+	span := s.cfg.BlockRange
+	for start := fromBlock; start <= toBlock; {
+		if s.ctx.Err() != nil {
+			return nil, s.ctx.Err()
+		}
+		end := start + span - 1
+		if end > toBlock {
+			end = toBlock
+		}
+		rangeLogs, err := s.nodes.GetNFTTransferEventByAddresses(start, end, []string{address})
+		if err != nil {
+			if span == 1 {
+				return nil, errors.Wrapf(err, "failed on get transfer events in block %d", start)
+			}
+			span /= 2
+			continue
+		}
+		logs = append(logs, rangeLogs...)
+		start = end + 1
+	}
+	return logs, nil
+}
+
+// mintedTokens 按 mint 顺序返回去重后的 token id，以及每个 token 第一次 mint 的接收方
+func mintedTokens(logs []*nftchainservice.TransferLog) ([]string, map[string]string) {
+	var tokenIds []string
+	creators := make(map[string]string)
+	for _, log := range logs {
+		if log.Removed || strings.ToLower(log.From) != ZeroAddress {
+			continue
+		}
+		if _, ok := creators[log.TokenID]; ok {
+			continue
+		}
+		creators[log.TokenID] = strings.ToLower(log.To)
+		tokenIds = append(tokenIds, log.TokenID)
+	}
+	return tokenIds, creators
+}
+
+// listERC1155Tokens 重放 [fromBlock, 截止区块] 区间内集合的全部转移事件，得到每个 token 各持有人的数量。
+// token 按第一次 mint 的顺序导入，截止区块记录在导入任务中，中断后重放的结果不变。
+func (s *Service) listERC1155Tokens(record *multi.CollectionImportRecord, address string) (*tokenList, error) {
+	toBlock, err := s.replayCutoff(record)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.scanMints(address, uint64(record.FromBlock), toBlock)
+	if err != nil {
+		return nil, err
+	}
+	tokenIds, creators := mintedTokens(logs)
+	return &tokenList{
+		total: int64(len(tokenIds)),
+		tokenAt: func(index int64) (string, error) {
+			return tokenIds[index], nil
+		},
+		creators: creators,
+		balances: replayBalances(logs),
+	}, nil
+}
+
+// replayCutoff 返回 ERC-1155 集合重放转移事件的截止区块。
+// 持有数量由导入和 Transfer 事件同步器分别累加，需要一个不重复也不遗漏的分界：
+// 集合加入过滤器时正在进行的那一轮同步可能不包含该集合，等同步进度再前进一轮后，
+// 之后的每一轮都包含该集合，此时的同步进度之前的事件由导入重放，之后的事件由同步器累加。
+func (s *Service) replayCutoff(record *multi.CollectionImportRecord) (uint64, error) {
+	if record.ToBlock > 0 {
+		return uint64(record.ToBlock), nil
+	}
+
+	start, err := s.transferIndexedBlock()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			return 0, s.ctx.Err()
+		case <-time.After(SleepInterval * time.Second):
+		}
+		next, err := s.transferIndexedBlock()
+		if err != nil {
+			return 0, err
+		}
+		if next <= start {
+			continue
+		}
+
+		// next 是同步器下一轮开始的区块
+		toBlock := next - 1
+		if err := s.updateRecord(record.Id, map[string]interface{}{"to_block": toBlock}); err != nil {
+			return 0, errors.Wrap(err, "failed on update collection import to block")
+		}
+		record.ToBlock = int64(toBlock)
+		return toBlock, nil
+	}
+}
+
+// transferIndexedBlock 获取 Transfer 事件同步器下一轮开始的区块
+func (s *Service) transferIndexedBlock() (uint64, error) {
+	var indexedStatus base.IndexedStatus
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, comm.TransferIndexType).
+		First(&indexedStatus).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get transfer index status")
+	}
+	return uint64(indexedStatus.LastIndexedBlock), nil
+}
+
+// replayBalances 按顺序重放转移事件，返回每个 token 各持有人的数量，数量为 0 的持有人不返回
+func replayBalances(logs []*nftchainservice.TransferLog) map[string]map[string]int64 {
+	balances := make(map[string]map[string]int64)
+	for _, log := range logs {
+		// 数量超过 int64 范围的转移无法记录到持有数量中，与转移索引一致跳过
+		if log.Removed || log.OverflowAmount != "" {
+			continue
+		}
+		holders, ok := balances[log.TokenID]
+		if !ok {
+			holders = make(map[string]int64)
+			balances[log.TokenID] = holders
+		}
+		if from := strings.ToLower(log.From); from != ZeroAddress {
+			holders[from] -= log.Amount
+		}
+		if to := strings.ToLower(log.To); to != ZeroAddress {
+			holders[to] += log.Amount
+		}
+	}
+	for _, holders := range balances {
+		for holder, balance := range holders {
+			if balance == 0 {
+				delete(holders, holder)
+			}
+		}
+	}
+	return balances
+}
+
+// importItem 一个 token 的导入结果
+type importItem struct {
+	tokenId  string
+	owner    string
+	creator  string
+	tokenUri string
+	// balances ERC-1155 token 各持有人的数量，ERC-721 为 nil
+	balances map[string]int64
+	// metadata 获取元数据失败时为 nil，item 仍然导入，元数据可以之后刷新
+	metadata *nftchainservice.JsonMetadata
+}
+
+// fetchItems 并发读取 [start, end) 区间内 token 的 owner 和元数据，已销毁的 token 被跳过
+func (s *Service) fetchItems(address string, tokens *tokenList, start, end int64) ([]*importItem, error) {
+	results := make([]*importItem, end-start)
+	errs := make([]error, end-start)
+	sem := make(chan struct{}, s.cfg.Workers)
+	var wg sync.WaitGroup
+	for index := start; index < end; index++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(index int64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[index-start], errs[index-start] = s.fetchItem(address, tokens, index)
+		}(index)
+	}
+	wg.Wait()
+
+	items := make([]*importItem, 0, len(results))
+	for i, item := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (s *Service) fetchItem(address string, tokens *tokenList, index int64) (*importItem, error) {
+	tokenId, err := tokens.tokenAt(index)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on get token by index %d", index)
+	}
+
+	if tokens.balances != nil {
+		return s.fetchERC1155Item(address, tokens, tokenId)
+	}
+
+	owner, err := s.nodes.FetchNftOwner(address, tokenId)
+	if err != nil {
+		if nftchainservice.IsExecutionReverted(err) {
+			// ownerOf 回滚表示 token 已经销毁
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed on fetch owner of token %s", tokenId)
+	}
+
+	item := &importItem{
+		tokenId: tokenId,
+		owner:   strings.ToLower(owner.String()),
+		creator: tokens.creators[tokenId],
+	}
+	item.tokenUri, err = s.nodes.TokenURI(address, tokenId)
+	if err == nil {
+		item.metadata, err = s.nodes.FetchMetadataByURI(item.tokenUri)
+	}
+	if err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on fetch item metadata", zap.Error(err),
+			zap.String("collection_address", address), zap.String("token_id", tokenId))
+	}
+	return item, nil
+}
+
+// fetchERC1155Item 读取 ERC-1155 token 的元数据，持有数量来自重放的转移事件，已全部销毁的 token 被跳过
+func (s *Service) fetchERC1155Item(address string, tokens *tokenList, tokenId string) (*importItem, error) {
+	balances := tokens.balances[tokenId]
+	if len(balances) == 0 {
+		return nil, nil
+	}
+
+	item := &importItem{
+		tokenId:  tokenId,
+		creator:  tokens.creators[tokenId],
+		balances: balances,
+	}
+	var err error
+	item.tokenUri, err = s.nodes.URI(address, tokenId)
+	if err == nil {
+		item.metadata, err = s.nodes.FetchMetadataByURI(item.tokenUri)
+	}
+	if err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on fetch item metadata", zap.Error(err),
+			zap.String("collection_address", address), zap.String("token_id", tokenId))
+	}
+	return item, nil
+}
+
+// saveItems 在一个事务中写入一批 item 和导入进度，中断后从 imported 继续
+func (s *Service) saveItems(recordId int64, address string, items []*importItem, imported int64) error {
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		for _, item := range items {
+			if err := s.saveItem(tx, address, item); err != nil {
+				return errors.Wrapf(err, "failed on save token %s", item.tokenId)
+			}
+		}
+		if err := tx.Table(multi.CollectionImportRecordTableName(s.chain)).
+			Where("id = ?", recordId).Update("item_imported", imported).Error; err != nil {
+			return errors.Wrap(err, "failed on update collection import progress")
+		}
+		return nil
+	})
+}
+
+// saveItem 写入 item、属性和元数据地址。owner 是加入过滤器之后读取的，可以覆盖已有的值。
+// ERC-1155 的发行量和持有数量是截止区块之前的累计值，与同步器累加的截止区块之后的变化相加。
+func (s *Service) saveItem(tx *gorm.DB, address string, item *importItem) error {
+	record, balances, traits, external := newItemRecords(s.chainId, address, item)
+
+	var itemUpdates clause.Set
+	if item.balances != nil {
+		itemUpdates = clause.Set{{Column: clause.Column{Name: "supply"}, Value: gorm.Expr("supply + VALUES(supply)")}}
+	} else {
+		itemUpdates = clause.AssignmentColumns([]string{"owner"})
+	}
+	itemUpdates = append(itemUpdates, clause.Assignment{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()})
+	if item.metadata != nil {
+		itemUpdates = append(itemUpdates, clause.AssignmentColumns([]string{"name"})...)
+	}
+	if err := tx.Table(gdb.GetMultiProjectItemTableName(s.project, s.chain)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: itemUpdates,
+	}).Create(record).Error; err != nil {
+		return errors.Wrap(err, "failed on upsert item")
+	}
+
+	if len(balances) > 0 {
+		if err := tx.Table(gdb.GetMultiProjectItemBalanceTableName(s.project, s.chain)).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}, {Name: "owner"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "balance"}, Value: gorm.Expr("balance + VALUES(balance)")},
+				{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+			},
+		}).Create(&balances).Error; err != nil {
+			return errors.Wrap(err, "failed on upsert item balances")
+		}
+	}
+
+	if item.metadata == nil {
+		// 元数据获取失败，等待刷新
+		if err := tx.Table(gdb.GetMultiProjectItemExternalTableName(s.project, s.chain)).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "upload_status"}, Value: multi.FetchMetadataFailed},
+				{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+			},
+		}).Create(external).Error; err != nil {
+			return errors.Wrap(err, "failed on upsert item external")
+		}
+		return nil
+	}
+
+	if err := tx.Table(gdb.GetMultiProjectItemTraitTableName(s.project, s.chain)).
+		Where("collection_address = ? and token_id = ?", address, item.tokenId).
+		Delete(&multi.ItemTrait{}).Error; err != nil {
+		return errors.Wrap(err, "failed on delete item traits")
+	}
+	if len(traits) > 0 {
+		if err := tx.Table(gdb.GetMultiProjectItemTraitTableName(s.project, s.chain)).Create(&traits).Error; err != nil {
+			return errors.Wrap(err, "failed on create item traits")
+		}
+	}
+
+	// 与元数据刷新相同：图片没有变化时保留转存状态，图片变化时重新等待转存
+	if err := tx.Table(gdb.GetMultiProjectItemExternalTableName(s.project, s.chain)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "is_uploaded_oss"}, Value: gorm.Expr("IF(image_uri <=> VALUES(image_uri), is_uploaded_oss, 0)")},
+			{Column: clause.Column{Name: "upload_status"}, Value: gorm.Expr("IF(image_uri <=> VALUES(image_uri) AND upload_status <> ?, upload_status, ?)", multi.FetchMetadataFailed, multi.OK)},
+			{Column: clause.Column{Name: "meta_data_uri"}, Value: external.MetaDataUri},
+			{Column: clause.Column{Name: "image_uri"}, Value: external.ImageUri},
+			{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+		},
+	}).Create(external).Error; err != nil {
+		return errors.Wrap(err, "failed on upsert item external")
+	}
+	return nil
+}
+
+// newItemRecords 根据导入结果构建 item、持有数量、属性和 item_external 记录。
+// ERC-1155 的 item 不记录 owner，发行量是各持有人数量之和，持有人按地址排序保证写入顺序固定。
+func newItemRecords(chainId int64, address string, item *importItem) (*multi.Item, []multi.ItemBalance, []multi.ItemTrait, *multi.ItemExternal) {
+	record := &multi.Item{
+		ChainId:           int(chainId),
+		CollectionAddress: address,
+		TokenId:           item.tokenId,
+		Owner:             item.owner,
+		Creator:           item.creator,
+		Supply:            1,
+	}
+	var balances []multi.ItemBalance
+	if item.balances != nil {
+		record.Supply = 0
+		holders := make([]string, 0, len(item.balances))
+		for holder := range item.balances {
+			holders = append(holders, holder)
+		}
+		sort.Strings(holders)
+		for _, holder := range holders {
+			record.Supply += item.balances[holder]
+			balances = append(balances, multi.ItemBalance{
+				CollectionAddress: address,
+				TokenId:           item.tokenId,
+				Owner:             holder,
+				Balance:           item.balances[holder],
+			})
+		}
+	}
+	external := &multi.ItemExternal{
+		CollectionAddress: address,
+		TokenId:           item.tokenId,
+		UploadStatus:      multi.FetchMetadataFailed,
+		MetaDataUri:       item.tokenUri,
+	}
+	if item.metadata == nil {
+		return record, balances, nil, external
+	}
+
+	record.Name = item.metadata.Name
+	external.UploadStatus = multi.OK
+	external.ImageUri = item.metadata.Image
+	var traits []multi.ItemTrait
+	for _, attr := range item.metadata.Attributes {
+		if attr == nil || attr.TraitType == "" {
+			continue
+		}
+		traits = append(traits, multi.ItemTrait{
+			CollectionAddress: address,
+			TokenId:           item.tokenId,
+			Trait:             attr.TraitType,
+			TraitValue:        attr.Value,
+		})
+	}
+	return record, balances, traits, external
+}
+
+// finishCollection 根据导入的 item 更新集合的发行量、持有人数和封面图，标记集合和导入任务为已完成。
+// ERC-1155 集合的持有人数按 ob_item_balance_* 中数量大于 0 的持有人统计。
+// 导入的属性在同一个事务中计算稀有度，集合对外可见时已经有稀有度排名。
+func (s *Service) finishCollection(recordId int64, address string, standard int64) error {
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		var stats struct {
+			ItemAmount  int64
+			OwnerAmount int64
+		}
+		if standard == multi.TokenStandardERC1155 {
+			if err := tx.Table(gdb.GetMultiProjectItemTableName(s.project, s.chain)).
+				Where("collection_address = ? and supply > 0", address).
+				Count(&stats.ItemAmount).Error; err != nil {
+				return errors.Wrap(err, "failed on count collection items")
+			}
+			if err := tx.Table(gdb.GetMultiProjectItemBalanceTableName(s.project, s.chain)).
+				Where("collection_address = ? and balance > 0", address).
+				Distinct("owner").Count(&stats.OwnerAmount).Error; err != nil {
+				return errors.Wrap(err, "failed on count collection owners")
+			}
+		} else if err := tx.Table(gdb.GetMultiProjectItemTableName(s.project, s.chain)).
+			Select("count(*) as item_amount, count(distinct owner) as owner_amount").
+			Where("collection_address = ? and owner <> ?", address, ZeroAddress).
+			Scan(&stats).Error; err != nil {
+			return errors.Wrap(err, "failed on count collection items")
+		}
+
+		if err := rarity.Recompute(s.ctx, tx, s.project, s.chain, address); err != nil {
+			return errors.Wrap(err, "failed on compute collection rarity")
+		}
+
+		var imageUri string
+		if err := tx.Table(gdb.GetMultiProjectItemExternalTableName(s.project, s.chain)).
+			Select("image_uri").
+			Where("collection_address = ? and image_uri <> ''", address).
+			Order("id asc").Limit(1).
+			Scan(&imageUri).Error; err != nil {
+			return errors.Wrap(err, "failed on get collection image")
+		}
+
+		updates := map[string]interface{}{
+			"item_amount":        stats.ItemAmount,
+			"owner_amount":       stats.OwnerAmount,
+			"floor_price_status": comm.CollectionFloorPriceImported,
+		}
+		// 集合没有封面图时使用第一个 item 的图片
+		if imageUri != "" {
+			updates["image_uri"] = gorm.Expr("IF(image_uri IS NULL OR image_uri = '', ?, image_uri)", imageUri)
+		}
+		if err := tx.Table(gdb.GetMultiProjectCollectionTableName(s.project, s.chain)).
+			Where("address = ?", address).Updates(updates).Error; err != nil {
+			return errors.Wrap(err, "failed on update collection")
+		}
+
+		if err := tx.Table(multi.CollectionImportRecordTableName(s.chain)).
+			Where("id = ?", recordId).Updates(map[string]interface{}{
+			"finished_stage": multi.ImportStageFinished,
+			"msg":            "",
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on update collection import stage")
+		}
+		return nil
+	})
+}
+
+// truncate 截断过长的错误信息，避免超过 msg 字段的长度
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
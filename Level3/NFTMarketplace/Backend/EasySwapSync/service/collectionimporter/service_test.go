@@ -0,0 +1,164 @@
+package collectionimporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+func TestMintedTokens(t *testing.T) {
+	minter := "0xF39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	logs := []*nftchainservice.TransferLog{
+		{From: ZeroAddress, To: minter, TokenID: "3"},
+		{From: minter, To: "0x70997970C51812dc3A010C7d01b50e20d17dc79C", TokenID: "3"},
+		{From: ZeroAddress, To: minter, TokenID: "1"},
+		{From: ZeroAddress, To: minter, TokenID: "2", Removed: true},
+		// 销毁后重新 mint 的 token 只导入一次
+		{From: "0x70997970C51812dc3A010C7d01b50e20d17dc79C", To: ZeroAddress, TokenID: "3"},
+		{From: ZeroAddress, To: "0x70997970C51812dc3A010C7d01b50e20d17dc79C", TokenID: "3"},
+	}
+
+	tokenIds, creators := mintedTokens(logs)
+	if len(tokenIds) != 2 || tokenIds[0] != "3" || tokenIds[1] != "1" {
+		t.Fatalf("unexpected minted tokens %v", tokenIds)
+	}
+	if creators["3"] != "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266" {
+		t.Fatalf("creator should be the first mint receiver, got %s", creators["3"])
+	}
+}
+
+// fakeNodes 返回固定的 Transfer 事件，区间超过 maxSpan 时返回错误
+type fakeNodes struct {
+	nodeService
+	maxSpan uint64
+	logs    []*nftchainservice.TransferLog
+	ranges  [][2]uint64
+}
+
+func (f *fakeNodes) GetNFTTransferEventByAddresses(fromBlock, toBlock uint64, addresses []string) ([]*nftchainservice.TransferLog, error) {
+	if toBlock-fromBlock+1 > f.maxSpan {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	f.ranges = append(f.ranges, [2]uint64{fromBlock, toBlock})
+	var logs []*nftchainservice.TransferLog
+	for _, log := range f.logs {
+		if log.BlockNumber >= fromBlock && log.BlockNumber <= toBlock {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func TestScanMints(t *testing.T) {
+	nodes := &fakeNodes{
+		maxSpan: 30,
+		logs: []*nftchainservice.TransferLog{
+			{BlockNumber: 10, From: ZeroAddress, TokenID: "1"},
+			{BlockNumber: 99, From: ZeroAddress, TokenID: "2"},
+			{BlockNumber: 150, From: ZeroAddress, TokenID: "3"},
+		},
+	}
+	s := &Service{ctx: context.Background(), nodes: nodes, cfg: config.ImportCfg{BlockRange: 100}}
+
+	logs, err := s.scanMints("0xa", 0, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].TokenID != "1" || logs[1].TokenID != "2" {
+		t.Fatalf("unexpected logs %v", logs)
+	}
+	// 区间减半到 25 后覆盖 [0, 120]，不重叠也不遗漏
+	var next uint64
+	for _, rng := range nodes.ranges {
+		if rng[0] != next || rng[1]-rng[0]+1 > 25 {
+			t.Fatalf("unexpected ranges %v", nodes.ranges)
+		}
+		next = rng[1] + 1
+	}
+	if next != 121 {
+		t.Fatalf("ranges should end at block 120, got %v", nodes.ranges)
+	}
+
+	nodes.maxSpan = 0
+	if _, err := s.scanMints("0xa", 0, 120); err == nil {
+		t.Fatal("expected error when node rejects every range")
+	}
+}
+
+func TestNewItemRecords(t *testing.T) {
+	item := &importItem{
+		tokenId:  "7",
+		owner:    "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266",
+		tokenUri: "ipfs://QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/7",
+	}
+	record, balances, traits, external := newItemRecords(11155111, "0xa", item)
+	if record.Owner != item.owner || record.Name != "" || len(traits) != 0 || len(balances) != 0 {
+		t.Fatalf("unexpected item without metadata %+v %v", record, traits)
+	}
+	if external.UploadStatus != multi.FetchMetadataFailed || external.MetaDataUri != item.tokenUri {
+		t.Fatalf("item without metadata should wait for refresh, got %+v", external)
+	}
+
+	item.metadata = &nftchainservice.JsonMetadata{
+		Name:  "EasySwap #7",
+		Image: "ipfs://image/7.png",
+		Attributes: []*nftchainservice.OpenseaMetadataProps{
+			{TraitType: "Background", Value: "Blue"},
+			{TraitType: "", Value: "ignored"},
+			nil,
+		},
+	}
+	record, _, traits, external = newItemRecords(11155111, "0xa", item)
+	if record.Name != "EasySwap #7" || record.Supply != 1 || record.ChainId != 11155111 {
+		t.Fatalf("unexpected item %+v", record)
+	}
+	if len(traits) != 1 || traits[0].Trait != "Background" || traits[0].TraitValue != "Blue" {
+		t.Fatalf("unexpected traits %v", traits)
+	}
+	if external.UploadStatus != multi.OK || external.ImageUri != "ipfs://image/7.png" {
+		t.Fatalf("unexpected item external %+v", external)
+	}
+}
+
+func TestReplayBalances(t *testing.T) {
+	alice := "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"
+	bob := "0x70997970c51812dc3a010c7d01b50e20d17dc79c"
+	logs := []*nftchainservice.TransferLog{
+		{From: ZeroAddress, To: alice, TokenID: "1", Amount: 10},
+		{From: alice, To: bob, TokenID: "1", Amount: 4},
+		{From: ZeroAddress, To: bob, TokenID: "2", Amount: 3},
+		{From: bob, To: ZeroAddress, TokenID: "2", Amount: 3},
+		{From: alice, To: bob, TokenID: "1", Amount: 6, Removed: true},
+	}
+
+	balances := replayBalances(logs)
+	if balances["1"][alice] != 6 || balances["1"][bob] != 4 || len(balances["1"]) != 2 {
+		t.Fatalf("unexpected balances of token 1 %v", balances["1"])
+	}
+	// 全部销毁的 token 没有持有人
+	if len(balances["2"]) != 0 {
+		t.Fatalf("burned token should have no holders, got %v", balances["2"])
+	}
+}
+
+func TestNewERC1155ItemRecords(t *testing.T) {
+	item := &importItem{
+		tokenId: "1",
+		balances: map[string]int64{
+			"0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266": 6,
+			"0x70997970c51812dc3a010c7d01b50e20d17dc79c": 4,
+		},
+	}
+	record, balances, _, _ := newItemRecords(11155111, "0xa", item)
+	if record.Owner != "" || record.Supply != 10 {
+		t.Fatalf("unexpected erc1155 item %+v", record)
+	}
+	if len(balances) != 2 || balances[0].Owner != "0x70997970c51812dc3a010c7d01b50e20d17dc79c" || balances[0].Balance != 4 {
+		t.Fatalf("unexpected balances %+v", balances)
+	}
+}
@@ -8,6 +8,7 @@ const (
 const (
 	DBBatchSizeLimit                 = 200
 	CollectionFloorChangeIndexType   = 5
+	TransferIndexType                = 7
 	CollectionFloorSyncPeriod        = 150                // in seconds
 	DaySeconds                       = 3600 * 24          // in seconds
 	MaxCollectionFloorTimeDifference = 10                 // in seconds
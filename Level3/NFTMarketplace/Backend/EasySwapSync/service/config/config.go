@@ -18,17 +18,134 @@ type Config struct {
 	ChainCfg    ChainCfg         `toml:"chain_cfg" mapstructure:"chain_cfg" json:"chain_cfg"`
 	ContractCfg ContractCfg      `toml:"contract_cfg" mapstructure:"contract_cfg" json:"contract_cfg"`
 	ProjectCfg  ProjectCfg       `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
+	// Chains 同一个进程中同步的多条链，为空时使用上面的 ankr_cfg / chain_cfg / contract_cfg 作为唯一的链
+	Chains []ChainEntry `toml:"chains" mapstructure:"chains" json:"chains"`
+	// ImportCfg 集合导入配置，各条链共用
+	ImportCfg *ImportCfg `toml:"import_cfg" mapstructure:"import_cfg" json:"import_cfg"`
+}
+
+// ImportCfg 集合导入配置，没有配置的项使用默认值
+type ImportCfg struct {
+	// Workers 并发获取 item owner 和元数据的协程数
+	Workers int `toml:"workers" mapstructure:"workers" json:"workers"`
+	// BatchSize 每批导入的 item 数量，每批导入后记录进度
+	BatchSize int `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`
+	// BlockRange 查找 mint 事件时每次请求的区块数，节点返回范围过大时自动减半
+	BlockRange uint64 `toml:"block_range" mapstructure:"block_range" json:"block_range"`
+	// 解析元数据时使用的字段名
+	NameTags       []string `toml:"name_tags" mapstructure:"name_tags" json:"name_tags"`
+	ImageTags      []string `toml:"image_tags" mapstructure:"image_tags" json:"image_tags"`
+	AttributesTags []string `toml:"attributes_tags" mapstructure:"attributes_tags" json:"attributes_tags"`
+	TraitNameTags  []string `toml:"trait_name_tags" mapstructure:"trait_name_tags" json:"trait_name_tags"`
+	TraitValueTags []string `toml:"trait_value_tags" mapstructure:"trait_value_tags" json:"trait_value_tags"`
+}
+
+// GetImportCfg 返回集合导入配置，没有配置的项使用默认值
+func (c *Config) GetImportCfg() ImportCfg {
+	var cfg ImportCfg
+	if c.ImportCfg != nil {
+		cfg = *c.ImportCfg
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 8
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.BlockRange == 0 {
+		cfg.BlockRange = 2000
+	}
+	if len(cfg.NameTags) == 0 {
+		cfg.NameTags = []string{"name", "title"}
+	}
+	if len(cfg.ImageTags) == 0 {
+		cfg.ImageTags = []string{"image", "image_url", "animation_url", "media_url", "image_data", "imageUrl"}
+	}
+	if len(cfg.AttributesTags) == 0 {
+		cfg.AttributesTags = []string{"attributes", "properties", "attribute"}
+	}
+	if len(cfg.TraitNameTags) == 0 {
+		cfg.TraitNameTags = []string{"trait_type"}
+	}
+	if len(cfg.TraitValueTags) == 0 {
+		cfg.TraitValueTags = []string{"value"}
+	}
+	return cfg
+}
+
+// ChainEntry 一条链的同步配置：节点、链信息和合约地址
+type ChainEntry struct {
+	AnkrCfg     AnkrCfg     `toml:"ankr_cfg" mapstructure:"ankr_cfg" json:"ankr_cfg"`
+	ChainCfg    ChainCfg    `toml:"chain_cfg" mapstructure:"chain_cfg" json:"chain_cfg"`
+	ContractCfg ContractCfg `toml:"contract_cfg" mapstructure:"contract_cfg" json:"contract_cfg"`
 }
 
 type ChainCfg struct {
 	Name string `toml:"name" mapstructure:"name" json:"name"`
 	ID   int64  `toml:"id" mapstructure:"id" json:"id"`
+	// ConfirmBlocks 订单簿和 Transfer 事件同步落后最新区块的区块数，为 0 时使用内置的默认值
+	ConfirmBlocks uint64 `toml:"confirm_blocks" mapstructure:"confirm_blocks" json:"confirm_blocks"`
+	// TransferStartBlock Transfer 事件同步的起始区块，一般为最早导入集合的部署区块，同步进度落后于它时从这里开始
+	TransferStartBlock uint64 `toml:"transfer_start_block" mapstructure:"transfer_start_block" json:"transfer_start_block"`
 }
 
 type ContractCfg struct {
 	EthAddress  string `toml:"eth_address" mapstructure:"eth_address" json:"eth_address"`
 	WethAddress string `toml:"weth_address" mapstructure:"weth_address" json:"weth_address"`
 	DexAddress  string `toml:"dex_address" mapstructure:"dex_address" json:"dex_address"`
+	// DexAddresses 同一条链上的多个订单簿合约部署，与 DexAddress 合并使用
+	DexAddresses []string `toml:"dex_addresses" mapstructure:"dex_addresses" json:"dex_addresses"`
+}
+
+// Dexes 返回需要同步的全部订单簿合约地址（去重，保持配置顺序）
+func (c ContractCfg) Dexes() []string {
+	var dexes []string
+	seen := make(map[string]bool)
+	for _, address := range append([]string{c.DexAddress}, c.DexAddresses...) {
+		key := strings.ToLower(address)
+		if address == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		dexes = append(dexes, address)
+	}
+	return dexes
+}
+
+// ChainConfigs 为每条链生成一份独立的配置，链相关的 ankr_cfg / chain_cfg / contract_cfg 替换为该链的配置，
+// 其他配置（数据库、缓存、日志等）共享。没有配置 chains 时返回原配置。
+// 链 ID 和名称都相同的多个 chains 是同一条链上的多个订单簿合约部署，合并为一份配置，
+// 订单簿合约地址依次追加，其他链配置以第一个为准。
+func (c *Config) ChainConfigs() []*Config {
+	if len(c.Chains) == 0 {
+		return []*Config{c}
+	}
+
+	configs := make([]*Config, 0, len(c.Chains))
+	for _, entry := range c.Chains {
+		if merged := findChainConfig(configs, entry.ChainCfg); merged != nil {
+			merged.ContractCfg.DexAddresses = append(merged.ContractCfg.DexAddresses, entry.ContractCfg.Dexes()...)
+			continue
+		}
+		chainCfg := *c
+		chainCfg.AnkrCfg = entry.AnkrCfg
+		chainCfg.ChainCfg = entry.ChainCfg
+		chainCfg.ContractCfg = entry.ContractCfg
+		chainCfg.ContractCfg.DexAddresses = append([]string(nil), entry.ContractCfg.DexAddresses...)
+		chainCfg.Chains = nil
+		configs = append(configs, &chainCfg)
+	}
+	return configs
+}
+
+// findChainConfig 查找链 ID 和名称都相同的配置
+func findChainConfig(configs []*Config, chain ChainCfg) *Config {
+	for _, cfg := range configs {
+		if cfg.ChainCfg.ID == chain.ID && cfg.ChainCfg.Name == chain.Name {
+			return cfg
+		}
+	}
+	return nil
 }
 
 type Monitor struct {
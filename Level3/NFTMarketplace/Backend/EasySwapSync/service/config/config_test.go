@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestChainConfigs(t *testing.T) {
+	cfg := &Config{
+		ChainCfg:    ChainCfg{Name: "sepolia", ID: 11155111},
+		ContractCfg: ContractCfg{DexAddress: "0xA"},
+		ProjectCfg:  ProjectCfg{Name: "OrderBookDex"},
+	}
+
+	// 没有配置 chains 时使用单链配置
+	configs := cfg.ChainConfigs()
+	if len(configs) != 1 || configs[0] != cfg {
+		t.Fatalf("expected legacy single chain config, got %v", configs)
+	}
+
+	cfg.Chains = []ChainEntry{
+		{
+			ChainCfg:    ChainCfg{Name: "sepolia", ID: 11155111, ConfirmBlocks: 2},
+			ContractCfg: ContractCfg{DexAddresses: []string{"0xA", "0xB"}},
+		},
+		{
+			ChainCfg:    ChainCfg{Name: "base", ID: 8453},
+			ContractCfg: ContractCfg{DexAddress: "0xC", DexAddresses: []string{"0xc", "0xD"}},
+		},
+	}
+	configs = cfg.ChainConfigs()
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 chain configs, got %d", len(configs))
+	}
+	if configs[0].ChainCfg.ConfirmBlocks != 2 || configs[1].ChainCfg.Name != "base" {
+		t.Fatalf("chain config not applied: %+v %+v", configs[0].ChainCfg, configs[1].ChainCfg)
+	}
+	if configs[1].ProjectCfg.Name != "OrderBookDex" || len(configs[1].Chains) != 0 {
+		t.Fatal("shared config should be copied without chains")
+	}
+
+	dexes := configs[1].ContractCfg.Dexes()
+	if len(dexes) != 2 || dexes[0] != "0xC" || dexes[1] != "0xD" {
+		t.Fatalf("unexpected dex addresses %v", dexes)
+	}
+
+	// 同一条链上的另一个订单簿合约部署合并到该链的配置
+	cfg.Chains = append(cfg.Chains, ChainEntry{
+		ChainCfg:    ChainCfg{Name: "sepolia", ID: 11155111},
+		ContractCfg: ContractCfg{DexAddress: "0xE"},
+	})
+	configs = cfg.ChainConfigs()
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 chain configs, got %d", len(configs))
+	}
+	dexes = configs[0].ContractCfg.Dexes()
+	if len(dexes) != 3 || dexes[2] != "0xE" || configs[0].ChainCfg.ConfirmBlocks != 2 {
+		t.Fatalf("unexpected merged chain config %+v %v", configs[0].ChainCfg, dexes)
+	}
+	if len(cfg.Chains[0].ContractCfg.DexAddresses) != 2 {
+		t.Fatal("merging should not modify the chain entry")
+	}
+}
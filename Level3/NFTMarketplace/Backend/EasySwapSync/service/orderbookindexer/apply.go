@@ -0,0 +1,289 @@
+package orderbookindexer
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// invalidLogError 日志无法解码或者内容不合法，重试也无法成功，直接写入死信表
+type invalidLogError struct {
+	err error
+}
+
+func (e *invalidLogError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidLogError) Unwrap() error {
+	return e.err
+}
+
+// invalidLog 把日志解码或校验失败的错误标记为不可重试
+func invalidLog(err error) error {
+	return &invalidLogError{err: err}
+}
+
+// isInvalidLog 检查错误是否由日志本身不合法引起
+func isInvalidLog(err error) bool {
+	var invalid *invalidLogError
+	return errors.As(err, &invalid)
+}
+
+// eventBatch 是一次区间同步的上下文：
+// 所有数据库修改都通过 tx 在同一个事务中完成，
+// 写入订单管理队列、价格更新队列等外部操作放到 afterCommit 中，事务提交成功后再执行。
+// depthOrders 记录本次修改过的订单（集合地址 -> 订单ID），事务提交后刷新它们在集合深度中的贡献。
+// activities 记录本次新增的活动，实时同步时在事务提交后推送给订阅的客户端，历史回填不推送。
+type eventBatch struct {
+	tx          *gorm.DB
+	blockTimes  map[uint64]uint64
+	edits       map[string]*orderEdit
+	afterCommit []func()
+	depthOrders map[string][]string
+	activities  []multi.Activity
+}
+
+func newEventBatch(tx *gorm.DB, blockTimes map[uint64]uint64) *eventBatch {
+	return &eventBatch{
+		tx:         tx,
+		blockTimes: blockTimes,
+	}
+}
+
+// onCommit 注册一个在事务提交成功后执行的操作
+func (b *eventBatch) onCommit(fn func()) {
+	b.afterCommit = append(b.afterCommit, fn)
+}
+
+// touchDepth 记录订单被修改，重复记录和回滚的日志中记录的订单在刷新时都按数据库的最新状态处理
+func (b *eventBatch) touchDepth(collectionAddr, orderId string) {
+	if b.depthOrders == nil {
+		b.depthOrders = make(map[string][]string)
+	}
+	collectionAddr = strings.ToLower(collectionAddr)
+	b.depthOrders[collectionAddr] = append(b.depthOrders[collectionAddr], orderId)
+}
+
+// addActivity 记录本次新增的活动
+func (b *eventBatch) addActivity(activity *multi.Activity) {
+	b.activities = append(b.activities, *activity)
+}
+
+// flush 执行所有事务提交后的操作
+func (b *eventBatch) flush() {
+	for _, fn := range b.afterCommit {
+		fn()
+	}
+	b.afterCommit = nil
+}
+
+// blockTime 返回区块时间，优先使用同步区间内已获取的区块头，避免在事务中重复请求节点
+func (s *Service) blockTime(batch *eventBatch, number uint64) (uint64, error) {
+	if blockTime, ok := batch.blockTimes[number]; ok {
+		return blockTime, nil
+	}
+	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get block time")
+	}
+	return blockTime, nil
+}
+
+// applyLogs 在 batch 的事务中依次应用区间内的日志。
+// 日志无法解码或内容不合法时写入死信表并继续处理后续日志，修复后通过 ReplayDeadLetters 重新应用；
+// 节点或数据库的临时错误返回错误，整个区间回滚后稍后重试，直到恢复为止。
+func (s *Service) applyLogs(batch *eventBatch, logs []ethereumTypes.Log) error {
+	// 找出 editOrders 产生的取消+挂单组合，按订单修改处理
+	batch.edits = s.detectEdits(logs)
+	for _, log := range logs {
+		err := s.applyLog(batch, log)
+		if err == nil {
+			continue
+		}
+		if !isInvalidLog(err) {
+			return errors.Wrapf(err, "failed on apply log %s", logKey(log))
+		}
+
+		xzap.WithContext(s.ctx).Error("invalid log, move to dead letter",
+			zap.Error(err),
+			zap.String("log", logKey(log)))
+		if err := s.deadLetter(batch.tx, log, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyLog 在一个保存点中应用单条日志，失败时只回滚该日志产生的修改。
+// 已经应用过的日志（tx_hash + log_index 已存在）直接跳过。
+func (s *Service) applyLog(batch *eventBatch, log ethereumTypes.Log) error {
+	pending := len(batch.afterCommit)
+	outer := batch.tx
+	err := outer.Transaction(func(tx *gorm.DB) error {
+		// 处理函数通过 batch.tx 写入，这里临时替换为保存点事务
+		batch.tx = tx
+		defer func() { batch.tx = outer }()
+
+		applied, err := s.markLogApplied(tx, log)
+		if err != nil {
+			return err
+		}
+		if applied {
+			return nil
+		}
+		return s.handleLog(batch, log)
+	})
+	if err != nil {
+		// 丢弃失败日志注册的提交后操作
+		batch.afterCommit = batch.afterCommit[:pending]
+	}
+	return err
+}
+
+// eventTopicCount 事件的主题数量（事件签名和 indexed 参数）
+var eventTopicCount = map[string]int{
+	LogMakeTopic:                 4,
+	LogCancelTopic:               3,
+	LogMatchTopic:                3,
+	LogUpdatedProtocolShareTopic: 2,
+	OwnershipTransferredTopic:    3,
+}
+
+// handleEvent 根据日志的主题（topic）调用相应的事件处理函数，未知的主题直接忽略
+func (s *Service) handleEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	if count, ok := eventTopicCount[log.Topics[0].String()]; ok && len(log.Topics) < count {
+		return invalidLog(errors.Errorf("expect %d topics, got %d", count, len(log.Topics)))
+	}
+	switch log.Topics[0].String() {
+	case LogMakeTopic:
+		// 处理挂单事件
+		return s.handleMakeEvent(batch, log)
+	case LogCancelTopic:
+		// 处理取消订单事件
+		return s.handleCancelEvent(batch, log)
+	case LogMatchTopic:
+		// 处理订单匹配事件
+		return s.handleMatchEvent(batch, log)
+	case LogSkipOrderTopic:
+		// 处理订单被跳过事件
+		return s.handleSkipOrderEvent(batch, log)
+	case BatchMatchInnerErrorTopic:
+		// 处理批量撮合失败事件
+		return s.handleBatchMatchInnerErrorEvent(batch, log)
+	case LogUpdatedProtocolShareTopic:
+		// 处理协议手续费比例更新事件
+		return s.handleUpdatedProtocolShareEvent(batch, log)
+	case LogWithdrawETHTopic:
+		// 处理提取ETH事件
+		return s.handleWithdrawETHEvent(batch, log)
+	case PausedTopic:
+		// 处理合约暂停事件
+		return s.handlePausedEvent(batch, log, true)
+	case UnpausedTopic:
+		// 处理合约恢复事件
+		return s.handlePausedEvent(batch, log, false)
+	case OwnershipTransferredTopic:
+		// 处理合约owner变更事件
+		return s.handleOwnershipTransferredEvent(batch, log)
+	case InitializedTopic:
+		// 处理合约初始化事件
+		return s.handleInitializedEvent(batch, log)
+	default:
+		return nil
+	}
+}
+
+// markLogApplied 记录日志已应用，返回该日志之前是否已经应用过
+func (s *Service) markLogApplied(tx *gorm.DB, log ethereumTypes.Log) (bool, error) {
+	indexedLog := base.IndexedLog{
+		ChainId:     int(s.chainId),
+		IndexType:   EventIndexType,
+		BlockNumber: int64(log.BlockNumber),
+		TxHash:      log.TxHash.String(),
+		LogIndex:    int64(log.Index),
+	}
+	result := tx.WithContext(s.ctx).Table(base.IndexedLogTableName()).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(&indexedLog)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on mark log applied")
+	}
+	if result.RowsAffected == 0 {
+		return true, nil
+	}
+
+	// 链重组回滚该区块时一并删除，保证新分叉上的同一笔交易可以重新应用
+	if err := s.writeUndoLog(tx, log.BlockNumber, base.IndexedLogTableName(), base.UndoActionInsert,
+		logUndoKey(s.chainId, log), nil); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// deadLetter 把处理失败的日志写入死信表
+func (s *Service) deadLetter(tx *gorm.DB, log ethereumTypes.Log, cause error) error {
+	rawLog, err := log.MarshalJSON()
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal log")
+	}
+
+	var topic string
+	if len(log.Topics) > 0 {
+		topic = log.Topics[0].String()
+	}
+
+	deadLetter := base.IndexedDeadLetter{
+		ChainId:     int(s.chainId),
+		IndexType:   EventIndexType,
+		BlockNumber: int64(log.BlockNumber),
+		BlockHash:   log.BlockHash.String(),
+		TxHash:      log.TxHash.String(),
+		LogIndex:    int64(log.Index),
+		Topic:       topic,
+		RawLog:      string(rawLog),
+		Error:       deadLetterMessage(cause),
+		Attempts:    1,
+	}
+	if err := s.createWithUndo(tx, log.BlockNumber, base.IndexedDeadLetterTableName(),
+		logUndoKey(s.chainId, log), &deadLetter); err != nil {
+		return errors.Wrap(err, "failed on create dead letter")
+	}
+	return nil
+}
+
+// deadLetterMessage 返回写入死信表的失败原因，超过字段长度时截断
+func deadLetterMessage(cause error) string {
+	message := cause.Error()
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	return message
+}
+
+// logKey 返回日志的唯一标识 tx_hash:log_index
+func logKey(log ethereumTypes.Log) string {
+	return fmt.Sprintf("%s:%d", log.TxHash.String(), log.Index)
+}
+
+// logUndoKey 返回 ob_indexed_log / ob_indexed_dead_letter 的唯一键
+func logUndoKey(chainId int64, log ethereumTypes.Log) map[string]interface{} {
+	return map[string]interface{}{
+		"chain_id":   chainId,
+		"index_type": EventIndexType,
+		"tx_hash":    log.TxHash.String(),
+		"log_index":  log.Index,
+	}
+}
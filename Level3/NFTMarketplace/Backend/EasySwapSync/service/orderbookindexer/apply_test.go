@@ -0,0 +1,148 @@
+package orderbookindexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// newApplyService 创建使用 sqlmock 事务的 Service，handle 替换日志的事件处理函数
+func newApplyService(t *testing.T, handle func(batch *eventBatch, log ethereumTypes.Log) error) (*Service, *eventBatch, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := newMockDB(t, sqlmock.QueryMatcherRegexp)
+	mock.ExpectBegin()
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	s := &Service{
+		ctx:       xzap.ToContext(context.Background(), zap.NewNop()),
+		chain:     "sepolia",
+		chainId:   11155111,
+		handleLog: handle,
+	}
+	return s, newEventBatch(tx, nil), mock
+}
+
+func testLog(index uint) ethereumTypes.Log {
+	return ethereumTypes.Log{
+		BlockNumber: 8,
+		TxHash:      common.HexToHash("0x01"),
+		Index:       index,
+		Topics:      []common.Hash{common.HexToHash(LogCancelTopic)},
+	}
+}
+
+// expectMarkLog 期望在保存点中记录日志已应用，inserted 为 false 表示日志之前已经应用过
+func expectMarkLog(mock sqlmock.Sqlmock, inserted bool) {
+	mock.ExpectExec("^SAVEPOINT ").WillReturnResult(sqlmock.NewResult(0, 0))
+	if !inserted {
+		mock.ExpectExec("^INSERT INTO `ob_indexed_log`").WillReturnResult(sqlmock.NewResult(0, 0))
+		return
+	}
+	mock.ExpectExec("^INSERT INTO `ob_indexed_log`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO `ob_indexed_undo_log`").WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestApplyLogSkipsDuplicate(t *testing.T) {
+	calls := 0
+	s, batch, mock := newApplyService(t, func(batch *eventBatch, log ethereumTypes.Log) error {
+		calls++
+		return nil
+	})
+
+	expectMarkLog(mock, true)
+	expectMarkLog(mock, false)
+	if err := s.applyLogs(batch, []ethereumTypes.Log{testLog(0), testLog(0)}); err != nil {
+		t.Fatal(err)
+	}
+	// 已经应用过的日志不再处理
+	if calls != 1 {
+		t.Fatalf("expected duplicate log to be skipped, handled %d times", calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyLogRollbackToSavepoint(t *testing.T) {
+	s, batch, mock := newApplyService(t, func(batch *eventBatch, log ethereumTypes.Log) error {
+		if err := batch.tx.Exec("UPDATE `ob_order_sepolia` SET `order_status` = 3").Error; err != nil {
+			return err
+		}
+		batch.onCommit(func() {})
+		return errors.New("failed on get cancel order")
+	})
+	kept := false
+	batch.onCommit(func() { kept = true })
+
+	expectMarkLog(mock, true)
+	mock.ExpectExec("^UPDATE `ob_order_sepolia`").WillReturnResult(sqlmock.NewResult(0, 1))
+	// 只回滚到该日志的保存点，之前的修改保留在事务中
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT ").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := s.applyLog(batch, testLog(0)); err == nil {
+		t.Fatal("expected apply error")
+	}
+	// 失败日志注册的提交后操作被丢弃，之前日志注册的操作保留
+	if len(batch.afterCommit) != 1 {
+		t.Fatalf("expected 1 pending after commit operation, got %d", len(batch.afterCommit))
+	}
+	batch.flush()
+	if !kept {
+		t.Fatal("after commit operation of previous log should be kept")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyLogsDeadLetter(t *testing.T) {
+	s, batch, mock := newApplyService(t, func(batch *eventBatch, log ethereumTypes.Log) error {
+		if log.Index == 0 {
+			return invalidLog(errors.New("failed on unpack LogCancel event"))
+		}
+		return nil
+	})
+	logs := []ethereumTypes.Log{testLog(0), testLog(1)}
+
+	// 日志不合法时直接写入死信表，并继续处理后续日志
+	expectMarkLog(mock, true)
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO `ob_indexed_dead_letter`").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), "failed on unpack LogCancel event", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO `ob_indexed_undo_log`").WillReturnResult(sqlmock.NewResult(2, 1))
+	expectMarkLog(mock, true)
+	if err := s.applyLogs(batch, logs); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyLogsRetryInfrastructureError(t *testing.T) {
+	s, batch, mock := newApplyService(t, func(batch *eventBatch, log ethereumTypes.Log) error {
+		return errors.New("failed to get block time")
+	})
+
+	// 节点或数据库错误不写入死信表，整个区间返回错误，稍后重试
+	for attempt := 0; attempt < 3; attempt++ {
+		expectMarkLog(mock, true)
+		mock.ExpectExec("^ROLLBACK TO SAVEPOINT ").WillReturnResult(sqlmock.NewResult(0, 0))
+		if err := s.applyLogs(batch, []ethereumTypes.Log{testLog(0), testLog(1)}); err == nil {
+			t.Fatalf("attempt %d: expected error", attempt)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,306 @@
+package orderbookindexer
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// BackfillChunkSize 回填时每个任务覆盖的区块数，结果按任务顺序应用
+	BackfillChunkSize = 5000
+	// MaxFetchAttempts 获取一个区间的日志或区块时间失败时的最大尝试次数
+	MaxFetchAttempts = 5
+	// MaxApplyAttempts 应用一个任务的日志遇到节点或数据库错误时的最大尝试次数
+	MaxApplyAttempts = 3
+)
+
+// rangeTooLargeErrors 节点因为区间过大或结果过多拒绝 eth_getLogs 时返回的错误信息（小写）
+var rangeTooLargeErrors = []string{
+	"too many results",
+	"more than 10000 results",
+	"query returned more than",
+	"response size exceeded",
+	"block range is too large",
+	"block range too large",
+	"exceed maximum block range",
+}
+
+// isRangeTooLarge 判断错误是否是区间过大，需要缩小区间重试
+func isRangeTooLarge(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, pattern := range rangeTooLargeErrors {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockRange 闭区间 [from, to]
+type blockRange struct {
+	from uint64
+	to   uint64
+}
+
+// splitRange 把 [from, to] 按 size 切分为连续的区间
+func splitRange(from, to, size uint64) []blockRange {
+	var ranges []blockRange
+	for start := from; start <= to; start += size {
+		end := start + size - 1
+		if end > to || end < start {
+			end = to
+		}
+		ranges = append(ranges, blockRange{from: start, to: end})
+		if end == to {
+			break
+		}
+	}
+	return ranges
+}
+
+// backfillResult 一个任务获取到的日志和日志所在区块的时间
+type backfillResult struct {
+	index      int
+	rng        blockRange
+	logs       []ethereumTypes.Log
+	blockTimes map[uint64]uint64
+	err        error
+}
+
+// Backfill 回填 [from, to] 区间内的订单簿事件。
+// 区间按 BackfillChunkSize 切分后由 workers 个协程并行获取日志，节点返回结果过多时自动缩小查询区间；
+// 每个任务只为包含日志的区块获取一次区块时间；结果按区块顺序逐个任务在事务中应用。
+// 已应用过的日志会被跳过，可以重复执行；同步进度落在任务区间内时一并推进到任务结束之后。
+// 回填只处理已经足够确认的区块（落后最新区块 MaxReorgDepth 以上），不记录区块哈希。
+func (s *Service) Backfill(from, to uint64, workers int) error {
+	if from > to {
+		return errors.Errorf("invalid range [%d, %d]", from, to)
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	head, err := s.chainClient.BlockNumber()
+	if err != nil {
+		return errors.Wrap(err, "failed on get current block number")
+	}
+	if head < MaxReorgDepth || to > head-MaxReorgDepth {
+		return errors.Errorf("backfill range must end before block %d to avoid reorgs", head-MaxReorgDepth)
+	}
+
+	chunks := splitRange(from, to, BackfillChunkSize)
+	// span 是当前的 eth_getLogs 查询区间大小，所有协程共享，结果过多时减半，成功时逐步恢复
+	span := uint64(BackfillChunkSize)
+
+	tasks := make(chan int)
+	results := make(chan *backfillResult, workers)
+	// 限制已获取但尚未应用的任务数量，避免前面的任务较慢时内存无限增长
+	inflight := make(chan struct{}, 2*workers)
+	done := make(chan struct{})
+	defer close(done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range tasks {
+				result := &backfillResult{index: index, rng: chunks[index]}
+				result.logs, result.blockTimes, result.err = s.fetchBackfillRange(chunks[index], &span)
+				select {
+				case results <- result:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(tasks)
+		for index := range chunks {
+			select {
+			case inflight <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case tasks <- index:
+			case <-done:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 按任务顺序应用结果
+	pending := make(map[int]*backfillResult)
+	next := 0
+	for next < len(chunks) {
+		result, ok := <-results
+		if !ok {
+			return errors.New("backfill workers stopped unexpectedly")
+		}
+		pending[result.index] = result
+		for result, ok := pending[next]; ok; result, ok = pending[next] {
+			delete(pending, next)
+			if err := s.ctx.Err(); err != nil {
+				return errors.Wrapf(err, "backfill stopped, resume with --from %d", result.rng.from)
+			}
+			if result.err != nil {
+				return errors.Wrapf(result.err, "failed on fetch blocks [%d, %d], resume with --from %d",
+					result.rng.from, result.rng.to, result.rng.from)
+			}
+			if err := s.applyBackfillRange(result); err != nil {
+				return errors.Wrapf(err, "failed on apply blocks [%d, %d], resume with --from %d",
+					result.rng.from, result.rng.to, result.rng.from)
+			}
+			<-inflight
+			next++
+
+			xzap.WithContext(s.ctx).Info("backfill orderbook event ...",
+				zap.Uint64("start_block", result.rng.from),
+				zap.Uint64("end_block", result.rng.to),
+				zap.Int("logs", len(result.logs)),
+				zap.Int("progress", next),
+				zap.Int("total", len(chunks)))
+		}
+	}
+	return nil
+}
+
+// fetchBackfillRange 获取区间内的订单簿合约日志，以及日志所在区块的时间。
+// 节点返回结果过多时把共享的 span 减半后重试，成功后逐步翻倍恢复，最大不超过 BackfillChunkSize。
+func (s *Service) fetchBackfillRange(rng blockRange, span *uint64) ([]ethereumTypes.Log, map[uint64]uint64, error) {
+	var logs []ethereumTypes.Log
+	attempts := 0
+	for start := rng.from; start <= rng.to; {
+		size := atomic.LoadUint64(span)
+		end := start + size - 1
+		if end > rng.to {
+			end = rng.to
+		}
+
+		rawLogs, err := s.chainClient.FilterLogs(s.ctx, types.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: []string{s.contract},
+		})
+		if err != nil {
+			if isRangeTooLarge(err) && end > start {
+				// 缩小查询区间后重试，不计入失败次数
+				atomic.CompareAndSwapUint64(span, size, maxUint64((end-start+1)/2, 1))
+				continue
+			}
+			if attempts++; attempts >= MaxFetchAttempts || s.ctx.Err() != nil {
+				return nil, nil, errors.Wrapf(err, "failed on get logs [%d, %d]", start, end)
+			}
+			time.Sleep(time.Duration(attempts) * time.Second)
+			continue
+		}
+
+		for _, rawLog := range rawLogs {
+			log := rawLog.(ethereumTypes.Log)
+			if log.Removed {
+				continue
+			}
+			logs = append(logs, log)
+		}
+		attempts = 0
+		start = end + 1
+		if size < BackfillChunkSize {
+			atomic.CompareAndSwapUint64(span, size, minUint64(size*2, BackfillChunkSize))
+		}
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	// 只为包含日志的区块获取一次区块时间，事件处理时直接使用
+	blockTimes := make(map[uint64]uint64)
+	for _, log := range logs {
+		if _, ok := blockTimes[log.BlockNumber]; ok {
+			continue
+		}
+		blockTime, err := s.fetchBlockTime(log.BlockNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+		blockTimes[log.BlockNumber] = blockTime
+	}
+	return logs, blockTimes, nil
+}
+
+// fetchBlockTime 获取区块时间，失败时重试
+func (s *Service) fetchBlockTime(number uint64) (uint64, error) {
+	var err error
+	for attempts := 1; attempts <= MaxFetchAttempts; attempts++ {
+		var blockTime uint64
+		blockTime, err = s.chainClient.BlockTimeByNumber(s.ctx, new(big.Int).SetUint64(number))
+		if err == nil {
+			return blockTime, nil
+		}
+		time.Sleep(time.Duration(attempts) * time.Second)
+	}
+	return 0, errors.Wrapf(err, "failed on get block time %d", number)
+}
+
+// applyBackfillRange 在一个事务中应用一个任务的日志。
+// 同步进度落在任务区间内时推进到任务结束之后，使守护进程从回填结束的位置继续同步。
+// 节点或数据库错误时按 MaxApplyAttempts 重试整个任务，仍然失败时返回错误，由 --from 从该任务继续回填。
+func (s *Service) applyBackfillRange(result *backfillResult) error {
+	var err error
+	for attempts := 0; attempts < MaxApplyAttempts; attempts++ {
+		var batch *eventBatch
+		err = s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+			batch = newEventBatch(tx, result.blockTimes)
+			if err := s.applyLogs(batch, result.logs); err != nil {
+				return err
+			}
+			if err := tx.Table(base.IndexedStatusTableName()).
+				Where("chain_id = ? and index_type = ? and contract_address = ? and last_indexed_block >= ? and last_indexed_block <= ?",
+					s.chainId, EventIndexType, s.contract, result.rng.from, result.rng.to).
+				Update("last_indexed_block", result.rng.to+1).Error; err != nil {
+				return errors.Wrap(err, "failed on update orderbook event sync block number")
+			}
+			return nil
+		})
+		if err == nil {
+			// 事务提交成功后再通知订单管理器
+			batch.flush()
+			return nil
+		}
+	}
+	return err
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,97 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+// limitedChain 模拟一个限制 eth_getLogs 区间大小的节点
+type limitedChain struct {
+	fakeChain
+	maxRange   uint64
+	logs       []ethereumTypes.Log
+	blockTimes map[uint64]int
+}
+
+func (c *limitedChain) FilterLogs(ctx context.Context, q types.FilterQuery) ([]interface{}, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	if to-from+1 > c.maxRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	var logs []interface{}
+	// 倒序返回，验证结果会按区块和日志序号排序
+	for i := len(c.logs) - 1; i >= 0; i-- {
+		if c.logs[i].BlockNumber >= from && c.logs[i].BlockNumber <= to {
+			logs = append(logs, c.logs[i])
+		}
+	}
+	return logs, nil
+}
+
+func (c *limitedChain) BlockTimeByNumber(ctx context.Context, number *big.Int) (uint64, error) {
+	c.blockTimes[number.Uint64()]++
+	return number.Uint64() * 12, nil
+}
+
+func TestSplitRange(t *testing.T) {
+	ranges := splitRange(1, 10, 4)
+	if len(ranges) != 3 || ranges[0] != (blockRange{1, 4}) || ranges[2] != (blockRange{9, 10}) {
+		t.Fatalf("unexpected ranges %v", ranges)
+	}
+	if ranges := splitRange(5, 5, 4); len(ranges) != 1 || ranges[0] != (blockRange{5, 5}) {
+		t.Fatalf("unexpected single block range %v", ranges)
+	}
+}
+
+func TestFetchBackfillRange(t *testing.T) {
+	chain := &limitedChain{maxRange: 100, blockTimes: make(map[uint64]int)}
+	for _, number := range []uint64{10, 10, 350, 999} {
+		chain.logs = append(chain.logs, ethereumTypes.Log{
+			BlockNumber: number,
+			TxHash:      common.BigToHash(new(big.Int).SetUint64(number)),
+			Index:       uint(len(chain.logs)),
+		})
+	}
+	s := &Service{
+		ctx:         xzap.ToContext(context.Background(), zap.NewNop()),
+		cfg:         &config.Config{ContractCfg: config.ContractCfg{DexAddress: "0x7d29d1860bD4d3A74bBD9a03C9B043d375311dCb"}},
+		contract:    "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb",
+		chainClient: chain,
+	}
+
+	span := uint64(BackfillChunkSize)
+	logs, blockTimes, err := s.fetchBackfillRange(blockRange{from: 1, to: 1000}, &span)
+	if err != nil {
+		t.Fatalf("fetch range: %v", err)
+	}
+	// 查询区间缩小后成功，之后逐步恢复但还没有恢复到初始大小
+	if span >= BackfillChunkSize {
+		t.Fatalf("span should shrink after provider rejected the range, got %d", span)
+	}
+	if len(logs) != 4 || logs[0].Index != 0 || logs[1].Index != 1 || logs[3].BlockNumber != 999 {
+		t.Fatalf("unexpected logs %v", logs)
+	}
+	// 每个包含日志的区块只获取一次区块时间
+	if len(blockTimes) != 3 || blockTimes[350] != 350*12 || chain.blockTimes[10] != 1 {
+		t.Fatalf("unexpected block times %v calls %v", blockTimes, chain.blockTimes)
+	}
+}
+
+func TestIsRangeTooLarge(t *testing.T) {
+	if !isRangeTooLarge(errors.New("Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range")) {
+		t.Fatal("expected response size error to be detected")
+	}
+	if isRangeTooLarge(errors.New("connection refused")) {
+		t.Fatal("network errors should not shrink the range")
+	}
+}
@@ -0,0 +1,87 @@
+package orderbookindexer
+
+import (
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ReplayDeadLetters 重新应用死信表中该合约的日志，一般在修复解码或校验逻辑后执行。
+// 死信按区块号和日志序号依次重放，每条日志在独立的事务中应用，成功后删除对应的死信；
+// 日志仍然不合法时累加尝试次数并记录最新的失败原因，继续处理后续死信；节点或数据库错误时返回错误，稍后重新执行即可。
+// 重放时该日志之后的日志已经应用，依赖先后顺序的事件（例如挂单之后的成交）需要人工确认结果。
+// 返回成功重放的死信数量。
+func (s *Service) ReplayDeadLetters() (int, error) {
+	var deadLetters []base.IndexedDeadLetter
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedDeadLetterTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, EventIndexType).
+		Order("block_number asc, log_index asc").
+		Find(&deadLetters).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on query dead letters")
+	}
+
+	replayed := 0
+	for _, deadLetter := range deadLetters {
+		var log ethereumTypes.Log
+		if err := log.UnmarshalJSON([]byte(deadLetter.RawLog)); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on unmarshal dead letter log",
+				zap.Int64("id", deadLetter.Id), zap.Error(err))
+			continue
+		}
+		// 同一条链上可能部署了多个订单簿合约，只重放本合约的日志
+		if strings.ToLower(log.Address.String()) != s.contract {
+			continue
+		}
+
+		ok, err := s.replayDeadLetter(deadLetter, log)
+		if err != nil {
+			return replayed, err
+		}
+		if ok {
+			replayed++
+		}
+	}
+	return replayed, nil
+}
+
+// replayDeadLetter 在一个事务中应用死信中的日志并删除该死信，返回是否应用成功
+func (s *Service) replayDeadLetter(deadLetter base.IndexedDeadLetter, log ethereumTypes.Log) (bool, error) {
+	var batch *eventBatch
+	var invalid error
+	err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		batch = newEventBatch(tx, nil)
+		if err := s.applyLog(batch, log); err != nil {
+			if !isInvalidLog(err) {
+				return errors.Wrapf(err, "failed on apply log %s", logKey(log))
+			}
+			// 日志仍然不合法，保留死信并记录本次失败
+			invalid = err
+			return tx.Table(base.IndexedDeadLetterTableName()).Where("id = ?", deadLetter.Id).
+				Updates(map[string]interface{}{
+					"attempts": gorm.Expr("attempts + 1"),
+					"error":    deadLetterMessage(err),
+				}).Error
+		}
+		return tx.Table(base.IndexedDeadLetterTableName()).Where("id = ?", deadLetter.Id).
+			Delete(&base.IndexedDeadLetter{}).Error
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed on replay dead letter %d", deadLetter.Id)
+	}
+	if invalid != nil {
+		xzap.WithContext(s.ctx).Warn("dead letter log is still invalid",
+			zap.Int64("id", deadLetter.Id), zap.String("log", logKey(log)), zap.Error(invalid))
+		return false, nil
+	}
+
+	// 事务提交成功后再通知订单管理器，并刷新深度和推送变化
+	batch.flush()
+	s.refreshDepth(batch.depthOrders)
+	s.publishFeed(batch.depthOrders, batch.activities)
+	return true, nil
+}
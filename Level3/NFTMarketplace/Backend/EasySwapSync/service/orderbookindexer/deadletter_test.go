@@ -0,0 +1,78 @@
+package orderbookindexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func TestReplayDeadLetters(t *testing.T) {
+	db, mock := newMockDB(t, sqlmock.QueryMatcherRegexp)
+	contract := "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb"
+	var handled []uint
+	s := &Service{
+		ctx:      xzap.ToContext(context.Background(), zap.NewNop()),
+		db:       db,
+		chain:    "sepolia",
+		chainId:  11155111,
+		contract: contract,
+		handleLog: func(batch *eventBatch, log ethereumTypes.Log) error {
+			handled = append(handled, log.Index)
+			if log.Index == 1 {
+				return invalidLog(errors.New("failed on unpack LogMake event"))
+			}
+			return nil
+		},
+	}
+
+	rawLog := func(address string, index uint) string {
+		log := testLog(index)
+		log.Address = common.HexToAddress(address)
+		raw, err := log.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(raw)
+	}
+	mock.ExpectQuery("^SELECT \\* FROM `ob_indexed_dead_letter` WHERE chain_id = \\? and index_type = \\? ORDER BY block_number asc, log_index asc").
+		WithArgs(11155111, EventIndexType).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "raw_log"}).
+			AddRow(1, rawLog(contract, 0)).
+			AddRow(2, rawLog(contract, 1)).
+			AddRow(3, rawLog("0x5fbdb2315678afecb367f032d93f642f64180aa3", 2)))
+
+	// 第一条死信应用成功后删除
+	mock.ExpectBegin()
+	expectMarkLog(mock, true)
+	mock.ExpectExec("^DELETE FROM `ob_indexed_dead_letter` WHERE id = \\?").
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// 第二条死信仍然不合法，保留并累加尝试次数
+	mock.ExpectBegin()
+	expectMarkLog(mock, true)
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^UPDATE `ob_indexed_dead_letter` SET `attempts`=attempts \\+ 1,`error`=\\? WHERE id = \\?").
+		WithArgs("failed on unpack LogMake event", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	replayed, err := s.ReplayDeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 {
+		t.Fatalf("expected 1 replayed dead letter, got %d", replayed)
+	}
+	// 其他合约的死信不重放
+	if len(handled) != 2 || handled[0] != 0 || handled[1] != 1 {
+		t.Fatalf("unexpected handled logs %v", handled)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package orderbookindexer
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// orderEdit 表示 editOrders 对一个订单的修改。
+// 合约在 _editOrderTry 中先触发旧订单的 LogCancel，紧接着触发新订单的 LogMake，
+// 两条日志在同一笔交易中相邻（中间只有托管合约的调用，不会产生订单簿合约的日志）。
+type orderEdit struct {
+	oldOrderId        string
+	newOrderId        string
+	collectionAddress string
+	tokenId           string
+}
+
+// matches 判断订单是否就是本次修改的旧订单，合约只允许修改价格和数量，集合和token id 必须一致
+func (e *orderEdit) matches(order *multi.Order) bool {
+	return order.OrderID == e.oldOrderId &&
+		strings.EqualFold(order.CollectionAddress, e.collectionAddress) &&
+		order.TokenId == e.tokenId
+}
+
+// detectEdits 在区间日志中找出 editOrders 产生的 LogCancel + LogMake 组合。
+// 返回值以日志唯一标识（tx_hash:log_index）为键，同一个修改对应取消和挂单两条日志。
+func (s *Service) detectEdits(logs []ethereumTypes.Log) map[string]*orderEdit {
+	edits := make(map[string]*orderEdit)
+	for i := 0; i+1 < len(logs); i++ {
+		cancelLog, makeLog := logs[i], logs[i+1]
+		if len(cancelLog.Topics) < 3 || cancelLog.Topics[0].String() != LogCancelTopic {
+			continue
+		}
+		if len(makeLog.Topics) < 4 || makeLog.Topics[0].String() != LogMakeTopic {
+			continue
+		}
+		// 必须是同一笔交易中同一个 maker 的连续两条日志
+		if cancelLog.TxHash != makeLog.TxHash || cancelLog.Topics[2] != makeLog.Topics[3] {
+			continue
+		}
+
+		var event struct {
+			OrderKey [32]byte
+			Nft      struct {
+				TokenId        *big.Int
+				CollectionAddr common.Address
+				Amount         *big.Int
+			}
+			Price  *big.Int
+			Expiry uint64
+			Salt   uint64
+		}
+		if err := s.parsedAbi.UnpackIntoInterface(&event, "LogMake", makeLog.Data); err != nil {
+			// 解析失败的挂单日志按普通挂单处理，由 handleMakeEvent 报告错误
+			continue
+		}
+
+		edit := &orderEdit{
+			oldOrderId:        HexPrefix + hex.EncodeToString(cancelLog.Topics[1].Bytes()),
+			newOrderId:        HexPrefix + hex.EncodeToString(event.OrderKey[:]),
+			collectionAddress: event.Nft.CollectionAddr.String(),
+			tokenId:           event.Nft.TokenId.String(),
+		}
+		edits[logKey(cancelLog)] = edit
+		edits[logKey(makeLog)] = edit
+		i++
+	}
+	return edits
+}
+
+// replaceOrder 处理 editOrders 中旧订单的取消：把旧订单指向新订单。
+// 旧订单被替换不是用户意义上的取消，不记录取消活动，也不单独通知订单管理器，
+// 由新订单的 LogMake 一并完成替换。
+func (s *Service) replaceOrder(batch *eventBatch, log ethereumTypes.Log, edit *orderEdit) error {
+	if err := s.updateWithUndo(batch.tx, log.BlockNumber, multi.OrderTableName(s.chain),
+		map[string]interface{}{"order_id": edit.oldOrderId},
+		map[string]interface{}{"replaced_by": edit.newOrderId}); err != nil {
+		return errors.Wrapf(err, "failed on update order %s replaced by", edit.oldOrderId)
+	}
+	return nil
+}
+
+// replacedOrder 返回被 newOrderId 替换的旧订单，旧订单必须已经在同一笔交易的 LogCancel 中被标记
+func (s *Service) replacedOrder(batch *eventBatch, edit *orderEdit) (*multi.Order, error) {
+	var orders []multi.Order
+	if err := batch.tx.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
+		Where("order_id = ? and replaced_by = ?", edit.oldOrderId, edit.newOrderId).
+		Limit(1).Find(&orders).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get replaced order")
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return &orders[0], nil
+}
+
+// editActivityType 根据订单类型返回修改订单的活动类型
+func editActivityType(orderType int64) int {
+	switch orderType {
+	case multi.ListingOrder:
+		return multi.EditListing
+	case multi.CollectionBidOrder:
+		return multi.EditCollectionBid
+	default:
+		return multi.EditItemBid
+	}
+}
+
+// notifyOrderEdited 通知订单管理器旧挂单被新挂单替换，在事务提交后调用，只用于挂单
+func (s *Service) notifyOrderEdited(prevOrderId string, newOrder *multi.Order) {
+	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
+		EventType:      ordermanager.Edit,
+		OrderId:        newOrder.OrderID,
+		PrevOrderId:    prevOrderId,
+		CollectionAddr: newOrder.CollectionAddress,
+		TokenID:        newOrder.TokenId,
+		Price:          newOrder.Price,
+		From:           newOrder.Maker,
+		OrderType:      newOrder.OrderType,
+	}, s.chain); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on add update price event",
+			zap.Error(err),
+			zap.String("type", "edit"),
+			zap.String("order_id", newOrder.OrderID),
+			zap.String("prev_order_id", prevOrderId))
+	}
+}
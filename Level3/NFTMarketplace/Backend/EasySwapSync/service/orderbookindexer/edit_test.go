@@ -0,0 +1,78 @@
+package orderbookindexer
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestDetectEdits(t *testing.T) {
+	parsedAbi, err := abi.JSON(strings.NewReader(contractAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{parsedAbi: parsedAbi}
+
+	data, _ := hex.DecodeString(logMakeData)
+	maker := common.HexToHash("0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266")
+	other := common.HexToHash("0x70997970c51812dc3a010c7d01b50e20d17dc79c")
+	oldKey := common.HexToHash("0x01")
+	editTx := common.HexToHash("0xe1")
+	makeTx := common.HexToHash("0xe2")
+
+	cancel := func(tx common.Hash, index uint, maker common.Hash) ethereumTypes.Log {
+		return ethereumTypes.Log{
+			TxHash: tx,
+			Index:  index,
+			Topics: []common.Hash{common.HexToHash(LogCancelTopic), oldKey, maker},
+		}
+	}
+	make := func(tx common.Hash, index uint, maker common.Hash) ethereumTypes.Log {
+		return ethereumTypes.Log{
+			TxHash: tx,
+			Index:  index,
+			Topics: []common.Hash{common.HexToHash(LogMakeTopic), common.HexToHash("0x0"), common.HexToHash("0x1"), maker},
+			Data:   data,
+		}
+	}
+
+	logs := []ethereumTypes.Log{
+		cancel(editTx, 1, maker), // editOrders
+		make(editTx, 3, maker),
+		cancel(editTx, 4, maker), // 取消后没有挂单
+		make(makeTx, 0, maker),   // 不同交易
+		cancel(makeTx, 1, maker), // 不同 maker
+		make(makeTx, 2, other),
+	}
+	edits := s.detectEdits(logs)
+	if len(edits) != 2 {
+		t.Fatalf("expected one edit with two logs, got %d", len(edits))
+	}
+
+	edit := edits[logKey(logs[0])]
+	if edit == nil || edits[logKey(logs[1])] != edit {
+		t.Fatal("cancel and make of editOrders should share one edit")
+	}
+	if edit.oldOrderId != HexPrefix+hex.EncodeToString(oldKey.Bytes()) ||
+		edit.newOrderId != "0xc773ae81bc9a186dc6c5d70a486730a6f734578ae1a0116acd0aaaf69250d265" {
+		t.Fatalf("unexpected order ids %s -> %s", edit.oldOrderId, edit.newOrderId)
+	}
+
+	old := &multi.Order{
+		OrderID:           edit.oldOrderId,
+		CollectionAddress: "0xe7f1725e7734ce288f8367e1bb143e90bb3f0512",
+		TokenId:           "0",
+	}
+	if !edit.matches(old) {
+		t.Fatal("edit should match order on the same collection and token")
+	}
+	old.TokenId = "1"
+	if edit.matches(old) {
+		t.Fatal("edit should not match order on another token")
+	}
+}
@@ -0,0 +1,232 @@
+package orderbookindexer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// ResubscribeInterval websocket 断开后重新订阅的初始等待时间（秒），连续失败时翻倍
+	ResubscribeInterval = 1
+	// MaxResubscribeInterval 重新订阅的最大等待时间（秒）
+	MaxResubscribeInterval = 60
+	// StaleHeadInterval 超过该时间（秒）没有收到新区块时，不再使用推送的最新区块，改为请求节点
+	StaleHeadInterval = 60
+)
+
+// logFeed 缓存 websocket 推送的订单簿合约日志。
+// 订阅建立时记录当时的最新区块，之后的区块的日志都会被推送过来，
+// 只有完整落在订阅覆盖范围内的区间才直接使用缓存的日志，其余区间（订阅建立之前、断线期间）回退到 FilterLogs 补齐。
+type logFeed struct {
+	mu sync.Mutex
+	// since 订阅覆盖的第一个区块，0 表示当前没有可用的订阅
+	since uint64
+	// head 最新推送的区块号
+	head uint64
+	// updated 最近一次收到新区块的时间
+	updated time.Time
+	// logs 按区块号缓存的日志，同一个区块可能包含不同分叉上的日志，使用时按区块哈希过滤
+	logs map[uint64][]ethereumTypes.Log
+	// notify 收到新区块时通知同步循环
+	notify chan struct{}
+}
+
+func newLogFeed() *logFeed {
+	return &logFeed{
+		logs:   make(map[uint64][]ethereumTypes.Log),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// reset 在订阅建立（since > 0）或断开（since = 0）时清空缓存
+func (f *logFeed) reset(since, head uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.since = since
+	f.head = head
+	f.updated = time.Now()
+	f.logs = make(map[uint64][]ethereumTypes.Log)
+}
+
+// setHead 记录新区块并通知同步循环
+func (f *logFeed) setHead(number uint64) {
+	f.mu.Lock()
+	if f.since != 0 && number > f.head {
+		f.head = number
+		f.updated = time.Now()
+	}
+	f.mu.Unlock()
+
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+// add 缓存一条推送的日志，被重组移除的日志从缓存中删除
+func (f *logFeed) add(log ethereumTypes.Log) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.since == 0 || log.BlockNumber < f.since {
+		return
+	}
+
+	logs := f.logs[log.BlockNumber]
+	for i, cached := range logs {
+		if cached.BlockHash == log.BlockHash && cached.TxHash == log.TxHash && cached.Index == log.Index {
+			logs = append(logs[:i], logs[i+1:]...)
+			break
+		}
+	}
+	if !log.Removed {
+		logs = append(logs, log)
+	}
+	f.logs[log.BlockNumber] = logs
+}
+
+// latest 返回最新推送的区块号，没有可用订阅或者长时间没有收到新区块时返回 false
+func (f *logFeed) latest() (uint64, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.since == 0 || time.Since(f.updated) > StaleHeadInterval*time.Second {
+		return 0, false
+	}
+	return f.head, true
+}
+
+// take 返回 headers 覆盖区间内、属于 headers 所在分叉的缓存日志，按区块号和日志序号排序。
+// 新区块头和日志是两个独立的推送，只有收到更新的区块头之后才认为区块的日志已经推送完整，
+// 区间不在订阅覆盖范围内时返回 false，由调用方通过 FilterLogs 获取。
+func (f *logFeed) take(headers []*types.Header) ([]ethereumTypes.Log, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.since == 0 || len(headers) == 0 {
+		return nil, false
+	}
+	startBlock, endBlock := headers[0].Number, headers[len(headers)-1].Number
+	if startBlock < f.since || endBlock >= f.head {
+		return nil, false
+	}
+
+	var logs []ethereumTypes.Log
+	for _, header := range headers {
+		for _, log := range f.logs[header.Number] {
+			if log.BlockHash.Hex() == header.Hash {
+				logs = append(logs, log)
+			}
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+	return logs, true
+}
+
+// prune 删除 before 之前区块的缓存日志
+func (f *logFeed) prune(before uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for number := range f.logs {
+		if number < before {
+			delete(f.logs, number)
+		}
+	}
+}
+
+// SubscribeOrderBookEventLoop 通过 websocket 订阅新区块头和订单簿合约日志，写入 logFeed。
+// 订阅断开后把 logFeed 标记为不可用，同步循环自动回退到轮询，并按退避时间重新订阅；
+// 断线期间的区块不在新订阅的覆盖范围内，由同步循环通过 FilterLogs 补齐。
+func (s *Service) SubscribeOrderBookEventLoop() {
+	backoff := ResubscribeInterval
+	for {
+		err := s.subscribeOrderBookEvents()
+		if errors.Is(err, chainclient.ErrSubscriptionNotSupported) {
+			xzap.WithContext(s.ctx).Warn("chain client does not support subscription, fallback to polling")
+			return
+		}
+		s.feed.reset(0, 0)
+
+		select {
+		case <-s.ctx.Done():
+			xzap.WithContext(s.ctx).Info("SubscribeOrderBookEventLoop stopped due to context cancellation")
+			return
+		default:
+		}
+
+		xzap.WithContext(s.ctx).Error("orderbook event subscription stopped, fallback to polling",
+			zap.Error(err), zap.Int("resubscribe_after", backoff))
+		time.Sleep(time.Duration(backoff) * time.Second)
+		if backoff *= 2; backoff > MaxResubscribeInterval {
+			backoff = MaxResubscribeInterval
+		}
+	}
+}
+
+// subscribeOrderBookEvents 建立一次订阅并持续接收推送，直到订阅断开或上下文取消
+func (s *Service) subscribeOrderBookEvents() error {
+	heads := make(chan *types.Header, 16)
+	headSub, err := s.chainClient.SubscribeNewHead(s.ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer headSub.Unsubscribe()
+
+	logs := make(chan interface{}, 256)
+	logSub, err := s.chainClient.SubscribeFilterLogs(s.ctx, types.FilterQuery{
+		Addresses: []string{s.contract},
+	}, logs)
+	if err != nil {
+		return err
+	}
+	defer logSub.Unsubscribe()
+
+	// 订阅建立之后的区块的日志都会被推送，当前最新区块及之前的日志仍然通过 FilterLogs 获取
+	head, err := s.chainClient.BlockNumber()
+	if err != nil {
+		return errors.Wrap(err, "failed on get current block number")
+	}
+	s.feed.reset(head+1, head)
+	xzap.WithContext(s.ctx).Info("orderbook event subscription established", zap.Uint64("since", head+1))
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case header := <-heads:
+			s.feed.setHead(header.Number)
+		case log := <-logs:
+			s.feed.add(log.(ethereumTypes.Log))
+		case err := <-headSub.Err():
+			return errors.Wrap(err, "new head subscription failed")
+		case err := <-logSub.Err():
+			return errors.Wrap(err, "log subscription failed")
+		}
+	}
+}
+
+// waitNewBlock 等待新区块：订阅可用时收到新区块头即返回，否则等待 SleepInterval
+func (s *Service) waitNewBlock() {
+	if s.feed == nil {
+		time.Sleep(SleepInterval * time.Second)
+		return
+	}
+
+	timer := time.NewTimer(SleepInterval * time.Second)
+	defer timer.Stop()
+	select {
+	case <-s.feed.notify:
+	case <-timer.C:
+	case <-s.ctx.Done():
+	}
+}
@@ -0,0 +1,117 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+func feedHeaders(chain *fakeChain, start, end uint64) []*types.Header {
+	var headers []*types.Header
+	for number := start; number <= end; number++ {
+		header, _ := chain.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func feedLog(fork, number uint64, index uint) ethereumTypes.Log {
+	return ethereumTypes.Log{
+		BlockNumber: number,
+		BlockHash:   common.HexToHash(blockHash(fork, number)),
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(number)),
+		Index:       index,
+	}
+}
+
+func TestLogFeedTake(t *testing.T) {
+	chain := &fakeChain{}
+	feed := newLogFeed()
+
+	// 没有订阅时回退到 FilterLogs
+	if _, ok := feed.take(feedHeaders(chain, 10, 12)); ok {
+		t.Fatal("feed without subscription should not be used")
+	}
+
+	// 订阅建立时最新区块为 9
+	feed.reset(10, 9)
+	feed.add(feedLog(0, 9, 0))
+	feed.add(feedLog(0, 11, 1))
+	feed.add(feedLog(0, 11, 0))
+	feed.add(feedLog(0, 12, 0))
+	feed.setHead(12)
+
+	// 订阅之前的区块需要补齐
+	if _, ok := feed.take(feedHeaders(chain, 9, 11)); ok {
+		t.Fatal("blocks before subscription should be backfilled")
+	}
+	// 最新区块的日志可能还没有推送完整
+	if _, ok := feed.take(feedHeaders(chain, 10, 12)); ok {
+		t.Fatal("head block should not be taken")
+	}
+
+	logs, ok := feed.take(feedHeaders(chain, 10, 11))
+	if !ok || len(logs) != 2 || logs[0].Index != 0 || logs[1].Index != 1 {
+		t.Fatalf("unexpected logs %v ok=%v", logs, ok)
+	}
+
+	// 被重组移除的日志从缓存中删除，旧分叉上的日志按区块哈希过滤
+	removed := feedLog(0, 11, 1)
+	removed.Removed = true
+	feed.add(removed)
+	chain.forkAt = 11
+	feed.add(feedLog(1, 11, 3))
+	feed.setHead(13)
+	logs, ok = feed.take(feedHeaders(chain, 10, 12))
+	if !ok || len(logs) != 1 || logs[0].Index != 3 {
+		t.Fatalf("unexpected logs after reorg %v ok=%v", logs, ok)
+	}
+
+	// 断线后回退到 FilterLogs
+	feed.reset(0, 0)
+	if _, ok := feed.take(feedHeaders(chain, 10, 12)); ok {
+		t.Fatal("feed should not be used after disconnect")
+	}
+	if _, ok := feed.latest(); ok {
+		t.Fatal("latest should not be used after disconnect")
+	}
+}
+
+func TestSyncBlocksUseFeed(t *testing.T) {
+	chain := &fakeChain{}
+	s := &Service{
+		ctx:         xzap.ToContext(context.Background(), zap.NewNop()),
+		cfg:         &config.Config{ContractCfg: config.ContractCfg{DexAddress: "0x7d29d1860bD4d3A74bBD9a03C9B043d375311dCb"}},
+		contract:    "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb",
+		chainClient: chain,
+		chain:       "sepolia",
+		blocks:      &memBlockStore{hashes: make(map[uint64]string)},
+		feed:        newLogFeed(),
+	}
+	s.feed.reset(5, 4)
+	s.feed.setHead(20)
+
+	// 订阅之前的区间通过 FilterLogs 补齐
+	if _, err := s.syncBlocks(1, 10); err != nil {
+		t.Fatalf("sync backfill: %v", err)
+	}
+	if len(chain.queries) != 1 {
+		t.Fatalf("expected backfill query, got %d", len(chain.queries))
+	}
+
+	// 订阅覆盖的区间直接使用推送的日志
+	if _, err := s.syncBlocks(11, 15); err != nil {
+		t.Fatalf("sync from feed: %v", err)
+	}
+	if len(chain.queries) != 1 {
+		t.Fatalf("logs should come from feed, got %d queries", len(chain.queries))
+	}
+}
@@ -0,0 +1,107 @@
+package orderbookindexer
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFillAmountOf(t *testing.T) {
+	var order Order
+	if got := fillAmountOf(&order); got != 1 {
+		t.Fatalf("order without amount should fill 1, got %d", got)
+	}
+	order.Nft.Amount = big.NewInt(1)
+	if got := fillAmountOf(&order); got != 1 {
+		t.Fatalf("erc721 listing should fill 1, got %d", got)
+	}
+	order.Nft.Amount = big.NewInt(5)
+	if got := fillAmountOf(&order); got != 5 {
+		t.Fatalf("erc1155 listing should fill its amount, got %d", got)
+	}
+}
+
+func TestRemainingAfterFill(t *testing.T) {
+	cases := []struct {
+		remaining, fill, want int64
+	}{
+		{remaining: 1, fill: 1, want: 0},
+		{remaining: 5, fill: 1, want: 4},
+		{remaining: 5, fill: 3, want: 2},
+		// 超出剩余数量的成交不会产生负数
+		{remaining: 2, fill: 3, want: 0},
+	}
+	for _, c := range cases {
+		if got := remainingAfterFill(c.remaining, c.fill); got != c.want {
+			t.Fatalf("remainingAfterFill(%d, %d) = %d, want %d", c.remaining, c.fill, got, c.want)
+		}
+	}
+}
+
+// expectFillOrder 期望查询订单并按 updateWithUndo 更新剩余数量，args 为 UPDATE 的参数
+func expectFillOrder(mock sqlmock.Sqlmock, orderId string, remaining int64, args ...driver.Value) {
+	mock.ExpectQuery("^SELECT \\* FROM `ob_order_sepolia` WHERE order_id = \\?").
+		WithArgs(orderId).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "collection_address", "quantity_remaining"}).
+			AddRow(orderId, "0xc0113c7", remaining))
+	mock.ExpectQuery("^SELECT .* FROM `ob_order_sepolia` WHERE `order_id` = \\?").
+		WithArgs(orderId).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity_remaining"}).AddRow(remaining))
+	mock.ExpectExec("^INSERT INTO `ob_indexed_undo_log`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^UPDATE `ob_order_sepolia` SET").
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestFillMatchedOrders(t *testing.T) {
+	s, batch, mock := newApplyService(t, nil)
+	var sellOrder Order
+	sellOrder.Nft.Amount = big.NewInt(3)
+
+	// ERC-1155 挂单交付 3 份后成交完成，出价 5 份的买单每次撮合只成交 1 份
+	expectFillOrder(mock, "0xsell", 3, multi.OrderStatusFilled, 0, "0xbuyer", "0xsell")
+	expectFillOrder(mock, "0xbuy", 5, 4, "0xbuy")
+	if err := s.fillMatchedOrders(batch, 8, "0xsell", &sellOrder, "0xbuy", "0xbuyer"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 买单剩余最后一份时撮合后成交完成
+	sellOrder.Nft.Amount = big.NewInt(1)
+	expectFillOrder(mock, "0xsell2", 1, multi.OrderStatusFilled, 0, "0xbuyer", "0xsell2")
+	expectFillOrder(mock, "0xbuy", 1, multi.OrderStatusFilled, 0, "0xbuy")
+	if err := s.fillMatchedOrders(batch, 9, "0xsell2", &sellOrder, "0xbuy", "0xbuyer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleMakeEventAmountOverflow(t *testing.T) {
+	parsedAbi, err := abi.JSON(strings.NewReader(contractAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{parsedAbi: parsedAbi}
+
+	// LogMake 的第 4 个字是挂单数量（uint96），改为超过 int64 的值
+	data, _ := hex.DecodeString(logMakeData)
+	copy(data[96:128], common.LeftPadBytes(new(big.Int).Lsh(big.NewInt(1), 80).Bytes(), 32))
+	log := ethereumTypes.Log{
+		Topics: []common.Hash{common.HexToHash(LogMakeTopic), common.HexToHash("0x0"), common.HexToHash("0x1"),
+			common.HexToHash("0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266")},
+		Data: data,
+	}
+	err = s.handleMakeEvent(newEventBatch(nil, nil), log)
+	if !isInvalidLog(err) || !strings.Contains(err.Error(), "overflows int64") {
+		t.Fatalf("expected amount overflow invalid log error, got %v", err)
+	}
+}
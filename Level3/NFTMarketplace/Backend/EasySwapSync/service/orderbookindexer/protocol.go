@@ -0,0 +1,314 @@
+package orderbookindexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// 订单簿合约除挂单、取消、撮合之外的其他事件
+const (
+	LogSkipOrderTopic            = "0x43d1f368251ebe03c021962d50212d072e7ccee5c8ad3f541d93d0dc43bbd420"
+	BatchMatchInnerErrorTopic    = "0x050f709fb65709f10a27682788a9d67fe74de81b310b5c34e3d32f0e2c3ac557"
+	LogUpdatedProtocolShareTopic = "0x0b52884d4590055c8791518c34458834f75feed662340ef0b5af2898e7a9be9f"
+	LogWithdrawETHTopic          = "0xab0f46966ebb6f17d26b8f6add4624e39fcfdeaccfeaba589d57f81cb5cb6666"
+	PausedTopic                  = "0x62e78cea01bee320cd4e420270b5ea74000d11b0c9f74754ebdbfc544b05a258"
+	UnpausedTopic                = "0x5db9ee0a495bf2e6ff9c91a7834c1ba4fdd244a5e8aa4e537bd38aeae4b073aa"
+	OwnershipTransferredTopic    = "0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0"
+	InitializedTopic             = "0xc7f505b2f371ae2175ee4913f4499e1f2633a7b5936321eed1cdaeb6115181d2"
+)
+
+var (
+	// assetTypeHash 对应合约 LibOrder.ASSET_TYPEHASH
+	assetTypeHash = crypto.Keccak256Hash([]byte("Asset(uint256 tokenId,address collection,uint96 amount)"))
+	// orderTypeHash 对应合约 LibOrder.ORDER_TYPEHASH
+	orderTypeHash = crypto.Keccak256Hash([]byte("Order(uint8 side,uint8 saleKind,address maker,Asset nft,uint128 price,uint64 expiry,uint64 salt)Asset(uint256 tokenId,address collection,uint96 amount)"))
+)
+
+// MatchDetail 对应合约 matchOrders 的入参 LibOrder.MatchDetail
+type MatchDetail struct {
+	SellOrder Order
+	BuyOrder  Order
+}
+
+// transactionFetcher 是底层节点客户端（*ethclient.Client）中按哈希查询交易的能力
+type transactionFetcher interface {
+	TransactionByHash(ctx context.Context, hash common.Hash) (*ethereumTypes.Transaction, bool, error)
+}
+
+// handleSkipOrderEvent 处理LogSkipOrder事件，合约在挂单、取消或修改订单校验失败时触发。
+// 该函数把被跳过的订单记录到订单失败表中。
+func (s *Service) handleSkipOrderEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	var event struct {
+		OrderKey [32]byte
+		Salt     uint64
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "LogSkipOrder", log.Data); err != nil {
+		return invalidLog(errors.Wrap(err, "failed on unpack LogSkipOrder event"))
+	}
+
+	orderId := HexPrefix + hex.EncodeToString(event.OrderKey[:])
+	return s.recordOrderFailure(batch, log, []string{orderId}, multi.OrderFailureSkip, -1, "skipped by orderbook")
+}
+
+// handleBatchMatchInnerErrorEvent 处理BatchMatchInnerError事件，matchOrders 中某一组订单撮合失败时触发。
+// 事件只包含失败的序号，需要从交易入参中还原出对应的买卖订单。
+func (s *Service) handleBatchMatchInnerErrorEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	var event struct {
+		Offset *big.Int
+		Msg    []byte
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "BatchMatchInnerError", log.Data); err != nil {
+		return invalidLog(errors.Wrap(err, "failed on unpack BatchMatchInnerError event"))
+	}
+
+	reason := decodeRevertReason(event.Msg)
+	offset := event.Offset.Int64()
+
+	details, err := s.matchDetails(log.TxHash)
+	if err != nil {
+		return err
+	}
+	// 无法还原订单（例如通过其他合约调用），仍然记录失败，避免丢失
+	if offset >= int64(len(details)) {
+		return s.recordOrderFailure(batch, log, []string{""}, multi.OrderFailureBatchMatch, offset, reason)
+	}
+
+	detail := details[offset]
+	return s.recordOrderFailure(batch, log, []string{orderKey(detail.SellOrder), orderKey(detail.BuyOrder)},
+		multi.OrderFailureBatchMatch, offset, reason)
+}
+
+// recordOrderFailure 记录订单处理失败，已入库的订单会带上集合地址和token id
+func (s *Service) recordOrderFailure(batch *eventBatch, log ethereumTypes.Log, orderIds []string, failureType int, offset int64, reason string) error {
+	blockTime, err := s.blockTime(batch, log.BlockNumber)
+	if err != nil {
+		return err
+	}
+
+	// 查询已入库的订单
+	orders := make(map[string]multi.Order)
+	var existing []multi.Order
+	if err := batch.tx.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
+		Select("order_id", "collection_address", "token_id").
+		Where("order_id in (?)", orderIds).
+		Find(&existing).Error; err != nil {
+		return errors.Wrap(err, "failed on get failed orders")
+	}
+	for _, order := range existing {
+		orders[order.OrderID] = order
+	}
+
+	for _, orderId := range orderIds {
+		failure := multi.OrderFailure{
+			OrderID:     orderId,
+			FailureType: failureType,
+			BatchOffset: offset,
+			Reason:      reason,
+			TxHash:      log.TxHash.String(),
+			LogIndex:    int64(log.Index),
+			BlockNumber: int64(log.BlockNumber),
+			EventTime:   int64(blockTime),
+		}
+		if order, ok := orders[orderId]; ok {
+			failure.CollectionAddress = order.CollectionAddress
+			failure.TokenId = order.TokenId
+		}
+
+		if err := s.createWithUndo(batch.tx, log.BlockNumber, multi.OrderFailureTableName(s.chain), map[string]interface{}{
+			"tx_hash":   failure.TxHash,
+			"log_index": failure.LogIndex,
+			"order_id":  failure.OrderID,
+		}, &failure); err != nil {
+			return errors.Wrap(err, "failed on create order failure")
+		}
+	}
+	return nil
+}
+
+// handleUpdatedProtocolShareEvent 处理LogUpdatedProtocolShare事件，更新协议手续费比例
+func (s *Service) handleUpdatedProtocolShareEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	share := new(big.Int).SetBytes(log.Topics[1].Bytes())
+	return s.updateProtocolState(batch, log, map[string]interface{}{
+		"protocol_share": decimal.NewFromBigInt(share, 0),
+	})
+}
+
+// handleWithdrawETHEvent 处理LogWithdrawETH事件，累计合约owner提取的ETH
+func (s *Service) handleWithdrawETHEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	var event struct {
+		Recipient common.Address
+		Amount    *big.Int
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "LogWithdrawETH", log.Data); err != nil {
+		return invalidLog(errors.Wrap(err, "failed on unpack LogWithdrawETH event"))
+	}
+
+	state, err := s.protocolState(batch, log)
+	if err != nil {
+		return err
+	}
+	return s.updateProtocolState(batch, log, map[string]interface{}{
+		"withdrawn_eth": state.WithdrawnEth.Add(decimal.NewFromBigInt(event.Amount, 0)),
+	})
+}
+
+// handlePausedEvent 处理Paused/Unpaused事件，合约暂停期间订单无法成交
+func (s *Service) handlePausedEvent(batch *eventBatch, log ethereumTypes.Log, paused bool) error {
+	return s.updateProtocolState(batch, log, map[string]interface{}{
+		"paused": paused,
+	})
+}
+
+// handleOwnershipTransferredEvent 处理OwnershipTransferred事件，更新合约owner
+func (s *Service) handleOwnershipTransferredEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	newOwner := common.BytesToAddress(log.Topics[2].Bytes())
+	return s.updateProtocolState(batch, log, map[string]interface{}{
+		"owner": strings.ToLower(newOwner.String()),
+	})
+}
+
+// handleInitializedEvent 处理Initialized事件。
+// 合约没有 vault 相关事件，这里从 initialize 调用的入参中解析出初始的 vault 和手续费比例。
+func (s *Service) handleInitializedEvent(batch *eventBatch, log ethereumTypes.Log) error {
+	input, err := s.transactionInput(log.TxHash)
+	if err != nil {
+		return err
+	}
+
+	method := s.parsedAbi.Methods["initialize"]
+	// 通过代理合约构造函数等方式初始化时无法解析，只保证状态行存在
+	if len(input) < 4 || !bytes.Equal(input[:4], method.ID) {
+		_, err := s.protocolState(batch, log)
+		return err
+	}
+
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return invalidLog(errors.Wrap(err, "failed on unpack initialize input"))
+	}
+	share, _ := args[0].(*big.Int)
+	vault, _ := args[1].(common.Address)
+	values := map[string]interface{}{
+		"vault": strings.ToLower(vault.String()),
+	}
+	if share != nil {
+		values["protocol_share"] = decimal.NewFromBigInt(share, 0)
+	}
+	return s.updateProtocolState(batch, log, values)
+}
+
+// protocolState 查询当前合约的协议状态，不存在时先插入一行默认值
+func (s *Service) protocolState(batch *eventBatch, log ethereumTypes.Log) (*multi.ProtocolState, error) {
+	contract := strings.ToLower(log.Address.String())
+	state := multi.ProtocolState{
+		ContractAddress: contract,
+		ProtocolShare:   decimal.Zero,
+		WithdrawnEth:    decimal.Zero,
+		BlockNumber:     int64(log.BlockNumber),
+	}
+	if err := s.createWithUndo(batch.tx, log.BlockNumber, multi.ProtocolStateTableName(s.chain),
+		map[string]interface{}{"contract_address": contract}, &state); err != nil {
+		return nil, errors.Wrap(err, "failed on create protocol state")
+	}
+
+	var states []multi.ProtocolState
+	if err := batch.tx.WithContext(s.ctx).Table(multi.ProtocolStateTableName(s.chain)).
+		Where("contract_address = ?", contract).
+		Limit(1).Find(&states).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get protocol state")
+	}
+	if len(states) == 0 {
+		return nil, errors.Errorf("protocol state of %s not found", contract)
+	}
+	return &states[0], nil
+}
+
+// updateProtocolState 更新当前合约的协议状态
+func (s *Service) updateProtocolState(batch *eventBatch, log ethereumTypes.Log, values map[string]interface{}) error {
+	state, err := s.protocolState(batch, log)
+	if err != nil {
+		return err
+	}
+
+	values["block_number"] = int64(log.BlockNumber)
+	if err := s.updateWithUndo(batch.tx, log.BlockNumber, multi.ProtocolStateTableName(s.chain),
+		map[string]interface{}{"contract_address": state.ContractAddress}, values); err != nil {
+		return errors.Wrap(err, "failed on update protocol state")
+	}
+	return nil
+}
+
+// transactionInput 获取交易的入参
+func (s *Service) transactionInput(txHash common.Hash) ([]byte, error) {
+	client, ok := s.chainClient.Client().(transactionFetcher)
+	if !ok {
+		return nil, errors.New("chain client does not support get transaction")
+	}
+	tx, _, err := client.TransactionByHash(s.ctx, txHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on get transaction %s", txHash.String())
+	}
+	return tx.Data(), nil
+}
+
+// matchDetails 从 matchOrders 交易入参中解析出撮合明细，不是直接调用 matchOrders 时返回空
+func (s *Service) matchDetails(txHash common.Hash) ([]MatchDetail, error) {
+	input, err := s.transactionInput(txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	method := s.parsedAbi.Methods["matchOrders"]
+	if len(input) < 4 || !bytes.Equal(input[:4], method.ID) {
+		return nil, nil
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, invalidLog(errors.Wrap(err, "failed on unpack matchOrders input"))
+	}
+
+	details := *abi.ConvertType(args[0], new([]MatchDetail)).(*[]MatchDetail)
+	return details, nil
+}
+
+// orderKey 按合约 LibOrder.hash 计算订单的 OrderKey
+func orderKey(order Order) string {
+	assetHash := crypto.Keccak256(
+		assetTypeHash.Bytes(),
+		common.LeftPadBytes(order.Nft.TokenId.Bytes(), 32),
+		common.LeftPadBytes(order.Nft.CollectionAddr.Bytes(), 32),
+		common.LeftPadBytes(order.Nft.Amount.Bytes(), 32),
+	)
+
+	// abi.encodePacked: 各字段按类型实际长度紧密拼接
+	key := crypto.Keccak256(
+		orderTypeHash.Bytes(),
+		[]byte{order.Side},
+		[]byte{order.SaleKind},
+		order.Maker.Bytes(),
+		assetHash,
+		common.LeftPadBytes(order.Price.Bytes(), 16),
+		new(big.Int).SetUint64(order.Expiry).FillBytes(make([]byte, 8)),
+		new(big.Int).SetUint64(order.Salt).FillBytes(make([]byte, 8)),
+	)
+	return HexPrefix + hex.EncodeToString(key)
+}
+
+// decodeRevertReason 解析 revert 信息，Error(string) 返回字符串，其余返回十六进制
+func decodeRevertReason(msg []byte) string {
+	if reason, err := abi.UnpackRevert(msg); err == nil {
+		return reason
+	}
+	return HexPrefix + hex.EncodeToString(msg)
+}
@@ -0,0 +1,64 @@
+package orderbookindexer
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// logMakeData 是一条真实的 LogMake 事件数据，订单 key 由合约计算
+const logMakeData = "c773ae81bc9a186dc6c5d70a486730a6f734578ae1a0116acd0aaaf69250d2650000000000000000000000000000000000000000000000000000000000000000000000000000000000000000e7f1725e7734ce288f8367e1bb143e90bb3f05120000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000002386f26fc10000000000000000000000000000000000000000000000000000000000006558875d0000000000000000000000000000000000000000000000000000000000000001"
+
+func TestOrderKey(t *testing.T) {
+	parsedAbi, err := abi.JSON(strings.NewReader(contractAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := hex.DecodeString(logMakeData)
+	var event struct {
+		OrderKey [32]byte
+		Nft      struct {
+			TokenId        *big.Int
+			CollectionAddr common.Address
+			Amount         *big.Int
+		}
+		Price  *big.Int
+		Expiry uint64
+		Salt   uint64
+	}
+	if err := parsedAbi.UnpackIntoInterface(&event, "LogMake", data); err != nil {
+		t.Fatal(err)
+	}
+
+	order := Order{
+		Side:     List,
+		SaleKind: FixForItem,
+		Maker:    common.HexToAddress("0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"),
+		Price:    event.Price,
+		Expiry:   event.Expiry,
+		Salt:     event.Salt,
+	}
+	order.Nft.TokenId = event.Nft.TokenId
+	order.Nft.CollectionAddr = event.Nft.CollectionAddr
+	order.Nft.Amount = event.Nft.Amount
+
+	if got, want := orderKey(order), HexPrefix+hex.EncodeToString(event.OrderKey[:]); got != want {
+		t.Fatalf("order key mismatch: got %s, want %s", got, want)
+	}
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	// Error("HD: order closed")
+	msg, _ := hex.DecodeString("08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000001048443a206f7264657220636c6f73656400000000000000000000000000000000")
+	if reason := decodeRevertReason(msg); reason != "HD: order closed" {
+		t.Fatalf("unexpected reason %q", reason)
+	}
+	if reason := decodeRevertReason([]byte{0x01, 0x02}); reason != "0x0102" {
+		t.Fatalf("unexpected reason %q", reason)
+	}
+}
@@ -0,0 +1,43 @@
+package orderbookindexer
+
+import (
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/livefeed"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"go.uber.org/zap"
+)
+
+// publishFeed 把修改过的订单（按数据库中的最新状态）和新增的活动推送给订阅的客户端，并使涉及的集合和 item 的 API 缓存失效，
+// 在事务提交后调用，失败时只记录日志，不影响同步进度
+func (s *Service) publishFeed(depthOrders map[string][]string, activities []multi.Activity) {
+	if s.kv == nil {
+		return
+	}
+	for i := range activities {
+		if err := livefeed.Publish(s.kv, s.chain, livefeed.ActivityEvent(&activities[i])); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on publish activity event",
+				zap.String("tx_hash", activities[i].TxHash), zap.Error(err))
+		}
+	}
+
+	var orderIds []string
+	for _, ids := range depthOrders {
+		orderIds = append(orderIds, ids...)
+	}
+	if err := livefeed.PublishOrders(s.ctx, s.db, s.kv, s.cfg.ProjectCfg.Name, s.chain, orderIds); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on publish order events", zap.Error(err))
+	}
+
+	var tags []string
+	for _, activity := range activities {
+		tags = append(tags, apicache.CollectionTag(s.chain, activity.CollectionAddress),
+			apicache.ItemTag(s.chain, activity.CollectionAddress, activity.TokenId))
+	}
+	for collectionAddr := range depthOrders {
+		tags = append(tags, apicache.CollectionTag(s.chain, collectionAddr))
+	}
+	if err := apicache.Publish(s.kv, tags...); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on publish cache invalidate message", zap.Error(err))
+	}
+}
@@ -0,0 +1,351 @@
+package orderbookindexer
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxReorgDepth 向前查找分叉点的最大深度，超过该深度的重组需要人工介入
+	MaxReorgDepth = 64
+	// RetainBlocks 保留的已索引区块哈希和回滚日志数量
+	RetainBlocks = 2 * MaxReorgDepth
+)
+
+// blockStore 保存已索引区块的哈希与同步进度，并负责链重组时的数据回滚
+type blockStore interface {
+	// BlockHash 返回已索引区块的哈希，没有记录时返回空字符串
+	BlockHash(ctx context.Context, number uint64) (string, error)
+	// Commit 在一个事务中执行 apply（应用区间内的事件），保存区间内的区块哈希，并把同步进度推进到 nextBlock。
+	// apply 返回错误时整个事务回滚，同步进度保持不变
+	Commit(ctx context.Context, headers []*types.Header, nextBlock uint64, apply func(tx *gorm.DB) error) error
+	// Rollback 撤销 fromBlock 及之后区块产生的全部修改，并把同步进度回退到 fromBlock，
+	// 返回被撤销的回滚日志
+	Rollback(ctx context.Context, fromBlock uint64) ([]*base.IndexedUndoLog, error)
+}
+
+// dbBlockStore 是基于 ob_indexed_status / ob_indexed_block / ob_indexed_undo_log 的 blockStore 实现，
+// 记录按 (chain_id, index_type, contract_address) 区分
+type dbBlockStore struct {
+	db        *gorm.DB
+	chainId   int64
+	indexType int32
+	contract  string
+}
+
+func newDBBlockStore(db *gorm.DB, chainId int64, indexType int32, contract string) *dbBlockStore {
+	return &dbBlockStore{
+		db:        db,
+		chainId:   chainId,
+		indexType: indexType,
+		contract:  contract,
+	}
+}
+
+// BlockHash 查询已索引区块的哈希
+func (bs *dbBlockStore) BlockHash(ctx context.Context, number uint64) (string, error) {
+	var blocks []base.IndexedBlock
+	if err := bs.db.WithContext(ctx).Table(base.IndexedBlockTableName()).
+		Where("chain_id = ? and index_type = ? and contract_address = ? and block_number = ?", bs.chainId, bs.indexType, bs.contract, number).
+		Limit(1).Find(&blocks).Error; err != nil {
+		return "", errors.Wrap(err, "failed on get indexed block")
+	}
+	if len(blocks) == 0 {
+		return "", nil
+	}
+	return blocks[0].BlockHash, nil
+}
+
+// Commit 在一个事务中应用事件、保存区块哈希、推进同步进度，并清理过旧的区块哈希和回滚日志
+func (bs *dbBlockStore) Commit(ctx context.Context, headers []*types.Header, nextBlock uint64, apply func(tx *gorm.DB) error) error {
+	return bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if apply != nil {
+			if err := apply(tx); err != nil {
+				return err
+			}
+		}
+
+		if len(headers) > 0 {
+			blocks := make([]base.IndexedBlock, 0, len(headers))
+			for _, header := range headers {
+				blocks = append(blocks, base.IndexedBlock{
+					ChainId:         int(bs.chainId),
+					IndexType:       bs.indexType,
+					ContractAddress: bs.contract,
+					BlockNumber:     int64(header.Number),
+					BlockHash:       header.Hash,
+					ParentHash:      header.ParentHash,
+				})
+			}
+			if err := tx.Table(base.IndexedBlockTableName()).Clauses(clause.OnConflict{
+				UpdateAll: true,
+			}).Create(&blocks).Error; err != nil {
+				return errors.Wrap(err, "failed on save indexed blocks")
+			}
+		}
+
+		if err := tx.Table(base.IndexedStatusTableName()).
+			Where("chain_id = ? and index_type = ? and contract_address = ?", bs.chainId, bs.indexType, bs.contract).
+			Update("last_indexed_block", nextBlock).Error; err != nil {
+			return errors.Wrap(err, "failed on update orderbook event sync block number")
+		}
+
+		// 只保留最近 RetainBlocks 个区块的数据
+		if nextBlock > RetainBlocks {
+			expired := nextBlock - RetainBlocks
+			if err := tx.Table(base.IndexedBlockTableName()).
+				Where("chain_id = ? and index_type = ? and contract_address = ? and block_number < ?", bs.chainId, bs.indexType, bs.contract, expired).
+				Delete(&base.IndexedBlock{}).Error; err != nil {
+				return errors.Wrap(err, "failed on prune indexed blocks")
+			}
+			if err := tx.Table(base.IndexedUndoLogTableName()).
+				Where("chain_id = ? and index_type = ? and contract_address = ? and block_number < ?", bs.chainId, bs.indexType, bs.contract, expired).
+				Delete(&base.IndexedUndoLog{}).Error; err != nil {
+				return errors.Wrap(err, "failed on prune undo logs")
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback 按 id 倒序回放 fromBlock 之后的回滚日志，删除对应的区块哈希，并回退同步进度
+func (bs *dbBlockStore) Rollback(ctx context.Context, fromBlock uint64) ([]*base.IndexedUndoLog, error) {
+	var undoLogs []*base.IndexedUndoLog
+	err := bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(base.IndexedUndoLogTableName()).
+			Where("chain_id = ? and index_type = ? and contract_address = ? and block_number >= ?", bs.chainId, bs.indexType, bs.contract, fromBlock).
+			Order("id desc").Find(&undoLogs).Error; err != nil {
+			return errors.Wrap(err, "failed on get undo logs")
+		}
+
+		for _, undoLog := range undoLogs {
+			if err := applyUndoLog(tx, undoLog); err != nil {
+				return errors.Wrapf(err, "failed on apply undo log %d", undoLog.Id)
+			}
+		}
+
+		if err := tx.Table(base.IndexedUndoLogTableName()).
+			Where("chain_id = ? and index_type = ? and contract_address = ? and block_number >= ?", bs.chainId, bs.indexType, bs.contract, fromBlock).
+			Delete(&base.IndexedUndoLog{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete undo logs")
+		}
+		if err := tx.Table(base.IndexedBlockTableName()).
+			Where("chain_id = ? and index_type = ? and contract_address = ? and block_number >= ?", bs.chainId, bs.indexType, bs.contract, fromBlock).
+			Delete(&base.IndexedBlock{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete indexed blocks")
+		}
+		if err := tx.Table(base.IndexedStatusTableName()).
+			Where("chain_id = ? and index_type = ? and contract_address = ?", bs.chainId, bs.indexType, bs.contract).
+			Update("last_indexed_block", fromBlock).Error; err != nil {
+			return errors.Wrap(err, "failed on rollback orderbook event sync block number")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return undoLogs, nil
+}
+
+// fetchHeaders 获取 [startBlock, endBlock] 区间内的区块头，并校验区间内部哈希是连续的。
+// 如果获取过程中发生了重组，返回错误，由调用方稍后重试。
+func (s *Service) fetchHeaders(startBlock, endBlock uint64) ([]*types.Header, error) {
+	headers := make([]*types.Header, 0, endBlock-startBlock+1)
+	for number := startBlock; number <= endBlock; number++ {
+		header, err := s.chainClient.HeaderByNumber(s.ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed on get header %d", number)
+		}
+		if len(headers) > 0 && headers[len(headers)-1].Hash != header.ParentHash {
+			return nil, errors.Errorf("block %d parent hash mismatch while fetching headers", number)
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// findForkPoint 检查 first 是否能接上已索引的区块。
+// 如果父区块哈希不一致，则从 first 的前一个区块开始向前查找链上哈希与本地记录一致的区块（分叉点）。
+// 返回值:
+// - uint64: 分叉点区块号，仅在 reorged 为 true 时有效
+// - bool: 是否发生了重组
+// - error: 查询失败或重组深度超过 MaxReorgDepth
+func (s *Service) findForkPoint(first *types.Header) (uint64, bool, error) {
+	if first.Number == 0 {
+		return 0, false, nil
+	}
+
+	parentHash, err := s.blocks.BlockHash(s.ctx, first.Number-1)
+	if err != nil {
+		return 0, false, err
+	}
+	// 没有本地记录（首次同步或记录已被清理）或者哈希一致，说明没有重组
+	if parentHash == "" || parentHash == first.ParentHash {
+		return 0, false, nil
+	}
+
+	for number := first.Number - 1; number > 0 && first.Number-number <= MaxReorgDepth; number-- {
+		localHash, err := s.blocks.BlockHash(s.ctx, number)
+		if err != nil {
+			return 0, false, err
+		}
+		// 更早的区块没有本地记录，无法再校验，把它视为分叉点
+		if localHash == "" {
+			return number, true, nil
+		}
+
+		header, err := s.chainClient.HeaderByNumber(s.ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "failed on get header %d", number)
+		}
+		if header.Hash == localHash {
+			return number, true, nil
+		}
+	}
+
+	return 0, false, errors.Errorf("reorg deeper than %d blocks at block %d", MaxReorgDepth, first.Number)
+}
+
+// rollbackTo 撤销分叉点之后已索引的数据，并通知订单管理器被撤销的挂单
+func (s *Service) rollbackTo(forkPoint uint64) error {
+	undoLogs, err := s.blocks.Rollback(s.ctx, forkPoint+1)
+	if err != nil {
+		return errors.Wrap(err, "failed on rollback indexed blocks")
+	}
+
+	// 被撤销插入的订单已经不存在了，需要从地板价队列中移除；被撤销修改的订单需要刷新集合深度
+	depthOrders := make(map[string][]string)
+	for _, undoLog := range undoLogs {
+		if undoLog.TargetTable != multi.OrderTableName(s.chain) {
+			continue
+		}
+		key, err := decodeUndoValues(undoLog.RowKey)
+		if err != nil {
+			continue
+		}
+		orderId, _ := key["order_id"].(string)
+		collection, _ := key["collection_address"].(string)
+		// 修改记录的主键只有订单ID，刷新时按数据库中订单所属的集合处理
+		if orderId != "" {
+			depthOrders[strings.ToLower(collection)] = append(depthOrders[strings.ToLower(collection)], orderId)
+		}
+		if undoLog.Action == base.UndoActionInsert {
+			s.notifyOrderReverted(orderId, collection)
+		}
+	}
+	// 深度按数据库中回滚后的状态刷新，恢复为有效状态的订单重新计入深度
+	s.refreshDepth(depthOrders)
+	s.requeueReactivatedOrders(reactivatedOrderIds(undoLogs, multi.OrderTableName(s.chain)))
+	// 推送回滚后的订单状态，被撤销插入的订单已经不存在，不再推送
+	s.publishFeed(depthOrders, nil)
+	return nil
+}
+
+// reactivatedOrderIds 返回回滚后恢复为有效状态的订单：被撤销的取消、成交或过期会把订单状态改回有效。
+// 回滚日志按 id 倒序排列，同一订单最早的一条修改日志中的旧值就是回滚后的状态，被撤销插入的订单已经不存在
+func reactivatedOrderIds(undoLogs []*base.IndexedUndoLog, orderTable string) []string {
+	restored := make(map[string]bool)
+	inserted := make(map[string]bool)
+	var orderIds []string
+	for _, undoLog := range undoLogs {
+		if undoLog.TargetTable != orderTable {
+			continue
+		}
+		key, err := decodeUndoValues(undoLog.RowKey)
+		if err != nil {
+			continue
+		}
+		orderId, _ := key["order_id"].(string)
+		if orderId == "" {
+			continue
+		}
+		if undoLog.Action == base.UndoActionInsert {
+			inserted[orderId] = true
+			continue
+		}
+		prev, err := decodeUndoValues(undoLog.PrevValues)
+		if err != nil {
+			continue
+		}
+		status, ok := prev["order_status"].(json.Number)
+		if !ok {
+			continue
+		}
+		if _, seen := restored[orderId]; !seen {
+			orderIds = append(orderIds, orderId)
+		}
+		restored[orderId] = status.String() == strconv.Itoa(multi.OrderStatusActive)
+	}
+
+	result := make([]string, 0, len(orderIds))
+	for _, orderId := range orderIds {
+		if restored[orderId] && !inserted[orderId] {
+			result = append(result, orderId)
+		}
+	}
+	return result
+}
+
+// requeueReactivatedOrders 把回滚后恢复为有效状态的订单重新加入订单管理器，重新参与地板价计算和过期调度
+func (s *Service) requeueReactivatedOrders(orderIds []string) {
+	if s.orderManager == nil || len(orderIds) == 0 {
+		return
+	}
+	var orders []multi.Order
+	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
+		Where("order_id in (?) and order_status = ?", orderIds, multi.OrderStatusActive).
+		Find(&orders).Error; err != nil {
+		xzap.WithContext(s.ctx).Error("failed on get reactivated orders", zap.Error(err))
+		return
+	}
+	for i := range orders {
+		if err := s.orderManager.AddToOrderManagerQueue(&orders[i]); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on add reactivated order to manager queue",
+				zap.Error(err),
+				zap.String("order_id", orders[i].OrderID))
+		}
+	}
+}
+
+// refreshDepth 刷新订单在集合深度中的贡献，失败时只记录日志，下次启动时重建深度
+func (s *Service) refreshDepth(depthOrders map[string][]string) {
+	if s.orderManager == nil {
+		return
+	}
+	for collection, orderIds := range depthOrders {
+		if err := s.orderManager.RefreshDepth(collection, orderIds); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on refresh collection depth",
+				zap.String("collection_addr", collection), zap.Error(err))
+		}
+	}
+}
+
+// notifyOrderReverted 通知订单管理器某个订单已因链重组被撤销
+func (s *Service) notifyOrderReverted(orderId, collection string) {
+	if s.kv == nil || orderId == "" || collection == "" {
+		return
+	}
+	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
+		OrderId:        orderId,
+		CollectionAddr: collection,
+		EventType:      ordermanager.Cancel,
+	}, s.chain); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on add update price event",
+			zap.Error(err),
+			zap.String("type", "reorg"),
+			zap.String("order_id", orderId))
+	}
+}
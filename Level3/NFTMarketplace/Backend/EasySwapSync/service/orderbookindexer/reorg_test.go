@@ -0,0 +1,268 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+// fakeChain 模拟一条可以在指定区块分叉的链
+type fakeChain struct {
+	forkAt  uint64 // 从该区块开始切换到分叉链，0 表示未分叉
+	logs    []interface{}
+	queries []types.FilterQuery
+}
+
+func blockHash(fork, number uint64) string {
+	return common.BigToHash(new(big.Int).SetUint64(fork<<32 | number)).Hex()
+}
+
+func (c *fakeChain) hash(number uint64) string {
+	if c.forkAt != 0 && number >= c.forkAt {
+		return blockHash(1, number)
+	}
+	return blockHash(0, number)
+}
+
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	n := number.Uint64()
+	header := &types.Header{Number: n, Hash: c.hash(n)}
+	if n > 0 {
+		header.ParentHash = c.hash(n - 1)
+	}
+	return header, nil
+}
+
+func (c *fakeChain) FilterLogs(ctx context.Context, q types.FilterQuery) ([]interface{}, error) {
+	c.queries = append(c.queries, q)
+	return c.logs, nil
+}
+
+func (c *fakeChain) BlockTimeByNumber(context.Context, *big.Int) (uint64, error) { return 0, nil }
+func (c *fakeChain) Client() interface{}                                         { return nil }
+func (c *fakeChain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+func (c *fakeChain) CallContractByChain(ctx context.Context, param types.CallParam) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+func (c *fakeChain) BlockNumber() (uint64, error) { return 100, nil }
+func (c *fakeChain) BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+func (c *fakeChain) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, errors.New("not implemented")
+}
+func (c *fakeChain) SubscribeFilterLogs(ctx context.Context, q types.FilterQuery, ch chan<- interface{}) (ethereum.Subscription, error) {
+	return nil, errors.New("not implemented")
+}
+
+// memBlockStore 是内存版 blockStore
+type memBlockStore struct {
+	hashes    map[uint64]string
+	nextBlock uint64
+	rollbacks []uint64
+}
+
+func (m *memBlockStore) BlockHash(ctx context.Context, number uint64) (string, error) {
+	return m.hashes[number], nil
+}
+
+func (m *memBlockStore) Commit(ctx context.Context, headers []*types.Header, nextBlock uint64, apply func(tx *gorm.DB) error) error {
+	if apply != nil {
+		if err := apply(nil); err != nil {
+			return err
+		}
+	}
+	for _, header := range headers {
+		m.hashes[header.Number] = header.Hash
+	}
+	m.nextBlock = nextBlock
+	return nil
+}
+
+func (m *memBlockStore) Rollback(ctx context.Context, fromBlock uint64) ([]*base.IndexedUndoLog, error) {
+	for number := range m.hashes {
+		if number >= fromBlock {
+			delete(m.hashes, number)
+		}
+	}
+	m.nextBlock = fromBlock
+	m.rollbacks = append(m.rollbacks, fromBlock)
+	return nil, nil
+}
+
+func TestSyncBlocksRollbackOnReorg(t *testing.T) {
+	chain := &fakeChain{}
+	store := &memBlockStore{hashes: make(map[uint64]string)}
+	s := &Service{
+		ctx:         xzap.ToContext(context.Background(), zap.NewNop()),
+		cfg:         &config.Config{ContractCfg: config.ContractCfg{DexAddress: "0x7d29d1860bD4d3A74bBD9a03C9B043d375311dCb"}},
+		contract:    "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb",
+		chainClient: chain,
+		chain:       "sepolia",
+		blocks:      store,
+	}
+
+	next, err := s.syncBlocks(1, 10)
+	if err != nil || next != 11 {
+		t.Fatalf("sync canonical chain: next=%d err=%v", next, err)
+	}
+
+	// 区块 8 及之后被替换，分叉点为 7
+	chain.forkAt = 8
+	next, err = s.syncBlocks(11, 15)
+	if err != nil {
+		t.Fatalf("sync after reorg: %v", err)
+	}
+	if next != 8 {
+		t.Fatalf("expected resync from block 8, got %d", next)
+	}
+	if len(store.rollbacks) != 1 || store.rollbacks[0] != 8 {
+		t.Fatalf("expected rollback from block 8, got %v", store.rollbacks)
+	}
+	if len(chain.queries) != 1 {
+		t.Fatalf("logs should not be fetched when reorg detected, got %d queries", len(chain.queries))
+	}
+
+	// 获取期间返回了旧分叉上的日志，不能被处理
+	chain.logs = []interface{}{ethereumTypes.Log{BlockNumber: 9, BlockHash: common.HexToHash(blockHash(0, 9))}}
+	if _, err = s.syncBlocks(8, 15); err == nil {
+		t.Fatal("expected error for log from stale fork")
+	}
+	if store.nextBlock != 8 {
+		t.Fatalf("checkpoint should stay at 8, got %d", store.nextBlock)
+	}
+
+	// 重新索引新分叉
+	chain.logs = nil
+	next, err = s.syncBlocks(8, 15)
+	if err != nil || next != 16 {
+		t.Fatalf("resync new fork: next=%d err=%v", next, err)
+	}
+	for number := uint64(8); number <= 15; number++ {
+		if store.hashes[number] != blockHash(1, number) {
+			t.Fatalf("block %d hash not replaced by new fork", number)
+		}
+	}
+	if store.hashes[7] != blockHash(0, 7) {
+		t.Fatal("fork point hash should be kept")
+	}
+}
+
+// newMockDB 创建基于 sqlmock 的 gorm 连接，matcher 决定语句按全文还是按正则匹配
+func newMockDB(t *testing.T, matcher sqlmock.QueryMatcher) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func TestDBBlockStoreRollback(t *testing.T) {
+	db, mock := newMockDB(t, sqlmock.QueryMatcherEqual)
+	store := newDBBlockStore(db, 11155111, EventIndexType, "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb")
+
+	// 区块 8 插入了一条成交活动，并把订单更新为已成交
+	undoLogs := sqlmock.NewRows([]string{"id", "chain_id", "index_type", "block_number", "target_table", "action", "row_key", "prev_values"}).
+		AddRow(2, 11155111, EventIndexType, 8, "ob_order_sepolia", base.UndoActionUpdate,
+			`{"order_id":"0xo1"}`, `{"order_status":0,"quantity_remaining":1}`).
+		AddRow(1, 11155111, EventIndexType, 8, "ob_activity_sepolia", base.UndoActionInsert,
+			`{"activity_type":3,"collection_address":"0xc","token_id":"1","tx_hash":"0xt"}`, "")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM `ob_indexed_undo_log` WHERE chain_id = ? and index_type = ? and contract_address = ? and block_number >= ? ORDER BY id desc").
+		WithArgs(11155111, EventIndexType, "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb", 8).WillReturnRows(undoLogs)
+	// 按 id 倒序回放：先恢复订单的旧值，再删除插入的活动
+	mock.ExpectExec("UPDATE `ob_order_sepolia` SET `order_status`=?,`quantity_remaining`=? WHERE `order_id` = ?").
+		WithArgs("0", "1", "0xo1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `ob_activity_sepolia` WHERE `activity_type` = ? AND `collection_address` = ? AND `token_id` = ? AND `tx_hash` = ?").
+		WithArgs("3", "0xc", "1", "0xt").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `ob_indexed_undo_log` WHERE chain_id = ? and index_type = ? and contract_address = ? and block_number >= ?").
+		WithArgs(11155111, EventIndexType, "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb", 8).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM `ob_indexed_block` WHERE chain_id = ? and index_type = ? and contract_address = ? and block_number >= ?").
+		WithArgs(11155111, EventIndexType, "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb", 8).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE `ob_indexed_status` SET `last_indexed_block`=? WHERE chain_id = ? and index_type = ? and contract_address = ?").
+		WithArgs(8, 11155111, EventIndexType, "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err := store.Rollback(context.Background(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 2 {
+		t.Fatalf("expected 2 reverted undo logs, got %d", len(reverted))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBBlockStoreRollbackFailure(t *testing.T) {
+	db, mock := newMockDB(t, sqlmock.QueryMatcherEqual)
+	store := newDBBlockStore(db, 11155111, EventIndexType, "0x7d29d1860bd4d3a74bbd9a03c9b043d375311dcb")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM `ob_indexed_undo_log` WHERE chain_id = ? and index_type = ? and contract_address = ? and block_number >= ? ORDER BY id desc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "target_table", "action", "row_key", "prev_values"}).
+			AddRow(1, "ob_order_sepolia", base.UndoActionUpdate, `{"order_id":"0xo1"}`, `{"order_status":0}`))
+	mock.ExpectExec("UPDATE `ob_order_sepolia` SET `order_status`=? WHERE `order_id` = ?").
+		WillReturnError(errors.New("lock wait timeout"))
+	// 回放失败时整个事务回滚，同步进度不变
+	mock.ExpectRollback()
+
+	if _, err := store.Rollback(context.Background(), 8); err == nil {
+		t.Fatal("expected rollback error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReactivatedOrderIds(t *testing.T) {
+	table := multi.OrderTableName("sepolia")
+	undoLog := func(action int, orderId, prev string) *base.IndexedUndoLog {
+		return &base.IndexedUndoLog{TargetTable: table, Action: action, RowKey: `{"order_id":"` + orderId + `"}`, PrevValues: prev}
+	}
+	// 按 id 倒序排列
+	undoLogs := []*base.IndexedUndoLog{
+		// 0xo1 先部分成交再被取消，回滚后恢复为有效
+		undoLog(base.UndoActionUpdate, "0xo1", `{"order_status":0}`),
+		undoLog(base.UndoActionUpdate, "0xo1", `{"quantity_remaining":2}`),
+		// 0xo2 在回滚区间之前已经过期，回滚后仍然是过期状态
+		undoLog(base.UndoActionUpdate, "0xo2", `{"order_status":2}`),
+		// 0xo3 在回滚区间内创建，回滚后已经不存在
+		undoLog(base.UndoActionUpdate, "0xo3", `{"order_status":0}`),
+		undoLog(base.UndoActionInsert, "0xo3", ""),
+		// 其他表的日志忽略
+		{TargetTable: multi.ActivityTableName("sepolia"), Action: base.UndoActionUpdate, RowKey: `{"order_id":"0xo4"}`, PrevValues: `{"order_status":0}`},
+	}
+
+	got := reactivatedOrderIds(undoLogs, table)
+	if !reflect.DeepEqual(got, []string{"0xo1"}) {
+		t.Fatalf("unexpected reactivated orders %v", got)
+	}
+}
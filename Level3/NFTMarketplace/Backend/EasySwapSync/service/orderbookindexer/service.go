@@ -25,7 +25,6 @@ import (
 	"github.com/zeromicro/go-zero/core/threading"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 
 	"github.com/ProjectsTask/EasySwapSync/service/comm"
 	"github.com/ProjectsTask/EasySwapSync/service/config"
@@ -71,7 +70,13 @@ type Service struct {
 	chainClient  chainclient.ChainClient
 	chainId      int64
 	chain        string
+	// contract 同步的订单簿合约地址（小写），同步进度按 (链 ID, 合约地址) 记录
+	contract     string
 	parsedAbi    abi.ABI
+	blocks       blockStore
+	feed         *logFeed
+	// handleLog 处理单条日志，默认为 handleEvent
+	handleLog func(batch *eventBatch, log ethereumTypes.Log) error
 }
 
 var MultiChainMaxBlockDifference = map[string]uint64{
@@ -84,7 +89,7 @@ var MultiChainMaxBlockDifference = map[string]uint64{
 }
 
 // New 是一个构造函数，用于创建一个新的 Service 实例。
-// 该函数接收多个参数，包括上下文、配置、数据库连接、键值存储、链客户端、链ID、链名称和订单管理器，
+// 该函数接收多个参数，包括上下文、配置、数据库连接、键值存储、链客户端、链ID、链名称、订单簿合约地址和订单管理器，
 // 并返回一个初始化后的 Service 指针。
 // 参数:
 // - ctx: 上下文环境，用于控制操作的生命周期。
@@ -94,14 +99,15 @@ var MultiChainMaxBlockDifference = map[string]uint64{
 // - chainClient: 链客户端，用于与区块链进行交互。
 // - chainId: 链的唯一标识符。
 // - chain: 链的名称。
+// - contract: 同步的订单簿合约地址，同一条链上的多个订单簿合约各自创建一个 Service。
 // - orderManager: 订单管理器，用于管理订单相关操作。
 // 返回值:
 // - *Service: 初始化后的 Service 指针。
-func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, chainClient chainclient.ChainClient, chainId int64, chain string, orderManager *ordermanager.OrderManager) *Service {
+func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, chainClient chainclient.ChainClient, chainId int64, chain string, contract string, orderManager *ordermanager.OrderManager) *Service {
 	// 通过ABI实例化parsedAbi，这里忽略了可能出现的错误
 	parsedAbi, _ := abi.JSON(strings.NewReader(contractAbi))
 	// 返回一个新的Service实例，包含传入的参数和解析后的ABI
-	return &Service{
+	s := &Service{
 		// 上下文环境
 		ctx: ctx,
 		// 配置信息
@@ -118,22 +124,38 @@ func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, c
 		chain: chain,
 		// 链ID
 		chainId: chainId,
+		// 订单簿合约地址
+		contract: strings.ToLower(contract),
 		// 解析后的ABI
 		parsedAbi: parsedAbi,
+		// 已索引区块哈希存储，用于链重组检测和回滚
+		blocks: newDBBlockStore(db, chainId, EventIndexType, strings.ToLower(contract)),
+		// websocket 推送的日志缓存，未开启 enable_wss 时为 nil
+		feed: newFeedIfEnabled(cfg),
 	}
+	s.handleLog = s.handleEvent
+	return s
 }
 
-// Start 方法用于启动服务的主要功能，它会并发地启动两个关键的循环任务。
-// 这两个任务分别是订单簿事件同步循环和集合底价变化的维护循环。
+// newFeedIfEnabled 开启 enable_wss 时创建 logFeed
+func newFeedIfEnabled(cfg *config.Config) *logFeed {
+	if cfg == nil || !cfg.AnkrCfg.EnableWss {
+		return nil
+	}
+	return newLogFeed()
+}
+
+// Start 方法用于启动订单簿事件同步循环，开启 enable_wss 时同时订阅推送的日志。
+// 集合底价变化的维护循环按链执行，由调用方对每条链只启动一次 UpKeepingCollectionFloorChangeLoop。
 func (s *Service) Start() {
 	// 启动一个安全的 goroutine 来执行订单簿事件同步循环。
 	// SyncOrderBookEventLoop 方法会持续监听区块链上的订单簿事件，
 	// 并根据事件类型更新数据库和订单管理队列。
 	threading.GoSafe(s.SyncOrderBookEventLoop)
-	// 启动另一个安全的 goroutine 来执行集合底价变化的维护循环。
-	// UpKeepingCollectionFloorChangeLoop 方法会定期清理过期的集合底价变化数据，
-	// 并更新集合的底价信息。
-	threading.GoSafe(s.UpKeepingCollectionFloorChangeLoop)
+	// 开启 enable_wss 时订阅新区块和订单簿合约日志，同步循环优先使用推送的日志。
+	if s.feed != nil {
+		threading.GoSafe(s.SubscribeOrderBookEventLoop)
+	}
 }
 
 // SyncOrderBookEventLoop 是一个服务方法，用于持续同步订单簿事件。
@@ -146,14 +168,21 @@ func (s *Service) SyncOrderBookEventLoop() {
 	var indexedStatus base.IndexedStatus
 	// 从数据库中查询最后同步的区块高度
 	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
-		Where("chain_id = ? and index_type = ?", s.chainId, EventIndexType).
+		Where("chain_id = ? and index_type = ? and contract_address = ?", s.chainId, EventIndexType, s.contract).
 		First(&indexedStatus).Error; err != nil {
 		// 如果查询失败，记录错误日志并返回
 		xzap.WithContext(s.ctx).Error("failed on get listing index status",
-			zap.Error(err))
+			zap.String("contract", s.contract), zap.Error(err))
 		return
 	}
 
+	// 开始同步前重建集合深度，修复上次退出时没有来得及刷新的订单
+	if s.orderManager != nil {
+		if err := s.orderManager.RebuildDepth(); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on rebuild collection depth", zap.Error(err))
+		}
+	}
+
 	// 获取最后同步的区块高度
 	lastSyncBlock := uint64(indexedStatus.LastIndexedBlock)
 	// 进入无限循环，持续同步订单簿事件
@@ -168,7 +197,7 @@ func (s *Service) SyncOrderBookEventLoop() {
 		}
 
 		// 获取当前区块链的最新区块高度
-		currentBlockNum, err := s.chainClient.BlockNumber()
+		currentBlockNum, err := s.currentBlockNumber()
 		if err != nil {
 			// 如果获取失败，记录错误日志并等待一段时间后重试
 			xzap.WithContext(s.ctx).Error("failed on get current block number", zap.Error(err))
@@ -177,9 +206,9 @@ func (s *Service) SyncOrderBookEventLoop() {
 		}
 
 		// 检查最后同步的区块高度是否接近当前区块高度
-		if lastSyncBlock > currentBlockNum-MultiChainMaxBlockDifference[s.chain] {
-			// 如果接近，等待一段时间后重试
-			time.Sleep(SleepInterval * time.Second)
+		if lastSyncBlock > currentBlockNum-s.confirmBlocks() {
+			// 如果接近，等待新区块后重试
+			s.waitNewBlock()
 			continue
 		}
 
@@ -188,66 +217,135 @@ func (s *Service) SyncOrderBookEventLoop() {
 		// 计算本次同步的结束区块高度
 		endBlock := startBlock + SyncBlockPeriod
 		// 使用内置的 math.Min 函数更新结束区块高度，确保不超过当前区块高度减去最大允许的区块差异
-		endBlock = uint64(math.Min(float64(endBlock), float64(currentBlockNum-MultiChainMaxBlockDifference[s.chain])))
-
-		// 构建日志过滤查询条件
-		query := types.FilterQuery{
-			FromBlock: new(big.Int).SetUint64(startBlock),
-			ToBlock:   new(big.Int).SetUint64(endBlock),
-			Addresses: []string{s.cfg.ContractCfg.DexAddress},
-		}
+		endBlock = uint64(math.Min(float64(endBlock), float64(currentBlockNum-s.confirmBlocks())))
 
-		// 根据查询条件获取日志
-		logs, err := s.chainClient.FilterLogs(s.ctx, query)
+		// 同步区间内的事件，发生链重组时会回滚到分叉点
+		nextBlock, err := s.syncBlocks(startBlock, endBlock)
 		if err != nil {
-			// 如果获取日志失败，记录错误日志并等待一段时间后重试
-			xzap.WithContext(s.ctx).Error("failed on get log", zap.Error(err))
+			// 区间内的修改和同步进度在同一个事务中提交，失败时整体回滚，等待一段时间后重试
+			xzap.WithContext(s.ctx).Error("failed on sync orderbook event", zap.Error(err),
+				zap.Uint64("start_block", startBlock), zap.Uint64("end_block", endBlock))
 			time.Sleep(SleepInterval * time.Second)
 			continue
 		}
+		lastSyncBlock = nextBlock
+	}
+}
+
+// confirmBlocks 返回同步落后最新区块的区块数，优先使用链配置中的 confirm_blocks
+func (s *Service) confirmBlocks() uint64 {
+	if s.cfg.ChainCfg.ConfirmBlocks > 0 {
+		return s.cfg.ChainCfg.ConfirmBlocks
+	}
+	return MultiChainMaxBlockDifference[s.chain]
+}
+
+// currentBlockNumber 返回可以同步到的最新区块高度。
+// 订阅可用时使用推送的最新区块，最新区块的日志可能尚未推送完整，只同步到它的前一个区块；否则请求节点。
+func (s *Service) currentBlockNumber() (uint64, error) {
+	if s.feed != nil {
+		if head, ok := s.feed.latest(); ok && head > 0 {
+			return head - 1, nil
+		}
+	}
+	return s.chainClient.BlockNumber()
+}
 
-		// 遍历获取到的日志
-		for _, log := range logs {
-			// 将日志转换为以太坊日志类型
-			ethLog := log.(ethereumTypes.Log)
-			// 根据日志的主题（topic）调用相应的事件处理函数
-			switch ethLog.Topics[0].String() {
-			case LogMakeTopic:
-				// 处理挂单事件
-				s.handleMakeEvent(ethLog)
-			case LogCancelTopic:
-				// 处理取消订单事件
-				s.handleCancelEvent(ethLog)
-			case LogMatchTopic:
-				// 处理订单匹配事件
-				s.handleMatchEvent(ethLog)
-			default:
+// filterLogs 获取区间内的订单簿合约日志，订阅完整覆盖该区间时直接使用推送的日志
+func (s *Service) filterLogs(query types.FilterQuery, headers []*types.Header) ([]interface{}, error) {
+	if s.feed != nil {
+		if feedLogs, ok := s.feed.take(headers); ok {
+			logs := make([]interface{}, 0, len(feedLogs))
+			for _, log := range feedLogs {
+				logs = append(logs, log)
 			}
+			return logs, nil
 		}
+	}
+	return s.chainClient.FilterLogs(s.ctx, query)
+}
 
-		// 更新最后同步的区块高度
-		lastSyncBlock = endBlock + 1
-		// 将最后同步的区块高度更新到数据库中
-		if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
-			Where("chain_id = ? and index_type = ?", s.chainId, EventIndexType).
-			Update("last_indexed_block", lastSyncBlock).Error; err != nil {
-			// 如果更新失败，记录错误日志并返回
-			xzap.WithContext(s.ctx).Error("failed on update orderbook event sync block number",
-				zap.Error(err))
-			return
+// syncBlocks 同步 [startBlock, endBlock] 区间内的订单簿事件，返回下一次同步的起始区块。
+// 处理事件之前会先检查区间的第一个区块能否接上已索引的区块：
+// 如果父区块哈希不一致，说明发生了链重组，此时回滚分叉点之后的数据，并从分叉点的下一个区块重新索引。
+func (s *Service) syncBlocks(startBlock, endBlock uint64) (uint64, error) {
+	// 获取区间内的区块头
+	headers, err := s.fetchHeaders(startBlock, endBlock)
+	if err != nil {
+		return startBlock, err
+	}
+
+	// 检查是否发生了链重组
+	forkPoint, reorged, err := s.findForkPoint(headers[0])
+	if err != nil {
+		return startBlock, errors.Wrap(err, "failed on check reorg")
+	}
+	if reorged {
+		xzap.WithContext(s.ctx).Warn("chain reorg detected, rollback orderbook events",
+			zap.Uint64("start_block", startBlock), zap.Uint64("fork_point", forkPoint))
+		if err := s.rollbackTo(forkPoint); err != nil {
+			return startBlock, err
+		}
+		return forkPoint + 1, nil
+	}
+
+	// 构建日志过滤查询条件
+	query := types.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(startBlock),
+		ToBlock:   new(big.Int).SetUint64(endBlock),
+		Addresses: []string{s.contract},
+	}
+
+	// 优先使用 websocket 推送的日志，区间不在订阅覆盖范围内时根据查询条件获取日志
+	logs, err := s.filterLogs(query, headers)
+	if err != nil {
+		return startBlock, errors.Wrap(err, "failed on get log")
+	}
+
+	// 日志所在区块必须与刚获取的区块头一致，否则说明获取期间发生了重组，稍后重试
+	ethLogs := make([]ethereumTypes.Log, 0, len(logs))
+	for _, log := range logs {
+		// 将日志转换为以太坊日志类型
+		ethLog := log.(ethereumTypes.Log)
+		if ethLog.BlockNumber < startBlock || ethLog.BlockNumber > endBlock ||
+			headers[ethLog.BlockNumber-startBlock].Hash != ethLog.BlockHash.Hex() {
+			return startBlock, errors.Errorf("log block hash mismatch at block %d", ethLog.BlockNumber)
 		}
+		ethLogs = append(ethLogs, ethLog)
+	}
 
-		// 记录同步信息
-		xzap.WithContext(s.ctx).Info("sync orderbook event ...",
-			zap.Uint64("start_block", startBlock),
-			zap.Uint64("end_block", endBlock))
+	blockTimes := make(map[uint64]uint64, len(headers))
+	for _, header := range headers {
+		blockTimes[header.Number] = header.Time
 	}
+
+	// 在一个事务中应用区间内的日志，保存区块哈希并更新最后同步的区块高度
+	var batch *eventBatch
+	if err := s.blocks.Commit(s.ctx, headers, endBlock+1, func(tx *gorm.DB) error {
+		batch = newEventBatch(tx, blockTimes)
+		return s.applyLogs(batch, ethLogs)
+	}); err != nil {
+		return startBlock, errors.Wrap(err, "failed on commit orderbook events")
+	}
+	// 事务提交成功后再通知订单管理器，刷新修改过的订单在集合深度中的贡献，并推送订单和活动的变化
+	batch.flush()
+	s.refreshDepth(batch.depthOrders)
+	s.publishFeed(batch.depthOrders, batch.activities)
+	if s.feed != nil {
+		s.feed.prune(endBlock + 1)
+	}
+
+	// 记录同步信息
+	xzap.WithContext(s.ctx).Info("sync orderbook event ...",
+		zap.Uint64("start_block", startBlock),
+		zap.Uint64("end_block", endBlock))
+	return endBlock + 1, nil
 }
 
 // 处理挂单事件
 // handleMakeEvent 处理LogMake事件，当有新的订单挂单时触发。
-// 该函数会解析事件数据，将订单信息存入数据库和活动表，并将订单添加到订单管理队列。
-func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
+// 该函数会解析事件数据，将订单信息存入数据库和活动表，并在事务提交后将订单添加到订单管理队列。
+func (s *Service) handleMakeEvent(batch *eventBatch, log ethereumTypes.Log) error {
 	// 定义一个结构体来存储解析后的事件数据
 	var event struct {
 		OrderKey [32]byte
@@ -265,9 +363,12 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 	// 通过ABI解析日志数据，将其存入event结构体
 	err := s.parsedAbi.UnpackIntoInterface(&event, "LogMake", log.Data)
 	if err != nil {
-		// 如果解析失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("Error unpacking LogMake event:", zap.Error(err))
-		return
+		// 如果解析失败，返回错误
+		return invalidLog(errors.Wrap(err, "failed on unpack LogMake event"))
+	}
+	// 数量超过 int64 的订单无法写入订单表，与 ERC-1155 转账相同写入死信表
+	if !event.Nft.Amount.IsInt64() {
+		return invalidLog(errors.Errorf("order amount %s overflows int64", event.Nft.Amount.String()))
 	}
 	// Extract indexed fields from topics
 	// 从日志的topics中提取索引字段
@@ -303,21 +404,30 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 		Size:              event.Nft.Amount.Int64(),
 		OrderType:         orderType,
 		Salt:              int64(event.Salt),
+		ContractAddress:   s.contract,
+	}
+	// editOrders 产生的新订单，关联被替换的旧订单
+	var replaced *multi.Order
+	if edit, ok := batch.edits[logKey(log)]; ok {
+		if replaced, err = s.replacedOrder(batch, edit); err != nil {
+			return err
+		}
+		if replaced != nil {
+			newOrder.Replaces = replaced.OrderID
+		}
 	}
 	// 将订单信息存入数据库，如果订单已存在则不做处理
-	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newOrder).Error; err != nil {
-		// 如果存储失败，记录错误日志
-		xzap.WithContext(s.ctx).Error("failed on create order",
-			zap.Error(err))
+	if err := s.createWithUndo(batch.tx, log.BlockNumber, multi.OrderTableName(s.chain), map[string]interface{}{
+		"order_id":           newOrder.OrderID,
+		"collection_address": newOrder.CollectionAddress,
+	}, &newOrder); err != nil {
+		return errors.Wrap(err, "failed on create order")
 	}
+	batch.touchDepth(newOrder.CollectionAddress, newOrder.OrderID)
 	// 获取该日志所在区块的时间
-	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, big.NewInt(int64(log.BlockNumber)))
+	blockTime, err := s.blockTime(batch, log.BlockNumber)
 	if err != nil {
-		// 如果获取失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("failed to get block time", zap.Error(err))
-		return
+		return err
 	}
 	// 根据side和saleKind确定活动类型
 	var activityType int
@@ -330,6 +440,10 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 	} else {
 		activityType = multi.Listing
 	}
+	if replaced != nil {
+		// 修改订单，活动中记录为修改而不是新的挂单
+		activityType = editActivityType(orderType)
+	}
 	// 创建一个新的活动结构体
 	newActivity := multi.Activity{ // 将订单信息存入活动表
 		ActivityType:      activityType,
@@ -345,34 +459,106 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 		EventTime:         int64(blockTime),
 	}
 	// 将活动信息存入数据库，如果活动已存在则不做处理
-	if err := s.db.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newActivity).Error; err != nil {
-		// 如果存储失败，记录警告日志
-		xzap.WithContext(s.ctx).Warn("failed on create activity",
-			zap.Error(err))
+	if err := s.createWithUndo(batch.tx, log.BlockNumber, multi.ActivityTableName(s.chain), activityUndoKey(&newActivity), &newActivity); err != nil {
+		return errors.Wrap(err, "failed on create activity")
+	}
+	batch.addActivity(&newActivity)
+
+	// 事务提交后将订单信息存入订单管理队列
+	batch.onCommit(func() {
+		if err := s.orderManager.AddToOrderManagerQueue(&multi.Order{
+			ExpireTime:        newOrder.ExpireTime,
+			OrderID:           newOrder.OrderID,
+			CollectionAddress: newOrder.CollectionAddress,
+			TokenId:           newOrder.TokenId,
+			Price:             newOrder.Price,
+			Maker:             newOrder.Maker,
+		}); err != nil {
+			// 如果添加失败，记录错误日志
+			xzap.WithContext(s.ctx).Error("failed on add order to manager queue",
+				zap.Error(err),
+				zap.String("order_id", newOrder.OrderID))
+		}
+		// 修改挂单时，在订单管理器中用新订单替换旧订单，出价单不影响地板价
+		if replaced != nil && newOrder.OrderType == multi.ListingOrder {
+			s.notifyOrderEdited(replaced.OrderID, &newOrder)
+		}
+	})
+	return nil
+}
+
+// fillAmountOf 返回卖单在撮合中的成交数量，即卖单交付的数量：ERC-721 的挂单固定为 1，ERC-1155 的挂单可以是多份
+func fillAmountOf(sellOrder *Order) int64 {
+	if sellOrder.Nft.Amount != nil && sellOrder.Nft.Amount.IsInt64() && sellOrder.Nft.Amount.Int64() > 1 {
+		return sellOrder.Nft.Amount.Int64()
 	}
+	return 1
+}
 
-	// 将订单信息存入订单管理队列
-	if err := s.orderManager.AddToOrderManagerQueue(&multi.Order{
-		ExpireTime:        newOrder.ExpireTime,
-		OrderID:           newOrder.OrderID,
-		CollectionAddress: newOrder.CollectionAddress,
-		TokenId:           newOrder.TokenId,
-		Price:             newOrder.Price,
-		Maker:             newOrder.Maker,
-	}); err != nil {
-		// 如果添加失败，记录错误日志
-		xzap.WithContext(s.ctx).Error("failed on add order to manager queue",
-			zap.Error(err),
-			zap.String("order_id", newOrder.OrderID))
+// remainingAfterFill 返回成交 fillAmount 份后订单的剩余数量，不会小于 0
+func remainingAfterFill(remaining, fillAmount int64) int64 {
+	if remaining <= fillAmount {
+		return 0
+	}
+	return remaining - fillAmount
+}
+
+// fillOrder 按成交数量扣减订单的剩余数量，剩余数量为 0 时订单标记为已成交。
+// taker 不为空时记录成交的买方。订单不存在时不做处理。
+func (s *Service) fillOrder(batch *eventBatch, blockNumber uint64, orderId string, fillAmount int64, taker string) error {
+	var orders []multi.Order
+	if err := batch.tx.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
+		Where("order_id = ?", orderId).
+		Limit(1).Find(&orders).Error; err != nil {
+		return errors.Wrapf(err, "failed on get order %s", orderId)
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+
+	remaining := remainingAfterFill(orders[0].QuantityRemaining, fillAmount)
+	updates := map[string]interface{}{"quantity_remaining": remaining}
+	if remaining == 0 {
+		updates["order_status"] = multi.OrderStatusFilled
+	}
+	if taker != "" {
+		updates["taker"] = taker
+	}
+	if err := s.updateWithUndo(batch.tx, blockNumber, multi.OrderTableName(s.chain),
+		map[string]interface{}{"order_id": orderId}, updates); err != nil {
+		return errors.Wrapf(err, "failed on update order %s quantity_remaining", orderId)
+	}
+	batch.touchDepth(orders[0].CollectionAddress, orderId)
+	return nil
+}
+
+// fillMatchedOrders 扣减撮合双方订单的剩余数量：卖单按交付的数量扣减，买单每次撮合只成交一份。
+// 不存在的订单无需更新，说明不是从平台前端发起的交易
+func (s *Service) fillMatchedOrders(batch *eventBatch, blockNumber uint64, sellOrderId string, sellOrder *Order, buyOrderId, buyer string) error {
+	if err := s.fillOrder(batch, blockNumber, sellOrderId, fillAmountOf(sellOrder), buyer); err != nil {
+		return err
+	}
+	return s.fillOrder(batch, blockNumber, buyOrderId, 1, "")
+}
+
+// collectionTokenStandard 查询集合的合约标准，集合不存在时按 ERC-721 处理
+func (s *Service) collectionTokenStandard(batch *eventBatch, collection string) (int64, error) {
+	var standards []int64
+	if err := batch.tx.WithContext(s.ctx).Table(multi.CollectionTableName(s.chain)).
+		Where("address = ?", strings.ToLower(collection)).
+		Limit(1).Pluck("token_standard", &standards).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get collection token standard")
+	}
+	if len(standards) == 0 {
+		return multi.TokenStandardERC721, nil
 	}
+	return standards[0], nil
 }
 
 // handleMatchEvent 处理LogMatch事件，当订单匹配成功时触发。
-// 该函数会解析事件数据，更新订单状态、数量和NFT所有者信息，
-// 并将交易信息存入活动表和价格更新队列。
-func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
+// 该函数会解析事件数据，按成交数量更新订单状态和剩余数量，更新ERC-721的NFT所有者信息，
+// 并将交易信息存入活动表，事务提交后再写入价格更新队列。
+func (s *Service) handleMatchEvent(batch *eventBatch, log ethereumTypes.Log) error {
 	// 定义一个结构体，用于存储解包后的日志事件数据
 	var event struct {
 		MakeOrder Order
@@ -383,9 +569,8 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 	// 使用ABI解包日志数据
 	err := s.parsedAbi.UnpackIntoInterface(&event, "LogMatch", log.Data)
 	if err != nil {
-		// 如果解包失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("Error unpacking LogMatch event:", zap.Error(err))
-		return
+		// 如果解包失败，返回错误
+		return invalidLog(errors.Wrap(err, "failed on unpack LogMatch event"))
 	}
 
 	// 通过topic获取订单ID
@@ -397,7 +582,8 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 	var from string
 	var to string
 	var sellOrderId string
-	var buyOrder multi.Order
+	var buyOrderId string
+	var sellOrder *Order
 
 	// 判断订单是买单还是卖单
 	if event.MakeOrder.Side == Bid { // 买单， 由卖方发起交易撮合
@@ -413,53 +599,9 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 		to = event.MakeOrder.Maker.String()
 		// 设置卖方订单ID
 		sellOrderId = takeOrderId
-
-		// 更新卖方订单状态
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", takeOrderId).
-			Updates(map[string]interface{}{
-				"order_status":       multi.OrderStatusFilled,
-				"quantity_remaining": 0,
-				"taker":              to,
-			}).Error; err != nil {
-			// 如果更新失败，记录错误日志并返回
-			xzap.WithContext(s.ctx).Error("failed on update order status",
-				zap.String("order_id", takeOrderId))
-			return
-		}
-
-		// 查询买方订单信息，不存在则无需更新，说明不是从平台前端发起的交易
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", makeOrderId).
-			First(&buyOrder).Error; err != nil {
-			// 如果查询失败，记录错误日志并返回
-			xzap.WithContext(s.ctx).Error("failed on get buy order",
-				zap.Error(err))
-			return
-		}
-		// 更新买方订单的剩余数量
-		if buyOrder.QuantityRemaining > 1 {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", makeOrderId).
-				Update("quantity_remaining", buyOrder.QuantityRemaining-1).Error; err != nil {
-				// 如果更新失败，记录错误日志并返回
-				xzap.WithContext(s.ctx).Error("failed on update order quantity_remaining",
-					zap.String("order_id", makeOrderId))
-				return
-			}
-		} else {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", makeOrderId).
-				Updates(map[string]interface{}{
-					"order_status":       multi.OrderStatusFilled,
-					"quantity_remaining": 0,
-				}).Error; err != nil {
-				// 如果更新失败，记录错误日志并返回
-				xzap.WithContext(s.ctx).Error("failed on update order status",
-					zap.String("order_id", makeOrderId))
-				return
-			}
-		}
+		sellOrder = &event.TakeOrder
+		// 设置买方订单ID
+		buyOrderId = makeOrderId
 	} else { // 卖单， 由买方发起交易撮合， 同理
 		// 设置NFT所有者
 		owner = strings.ToLower(event.TakeOrder.Maker.String())
@@ -473,67 +615,26 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 		to = event.TakeOrder.Maker.String()
 		// 设置卖方订单ID
 		sellOrderId = makeOrderId
+		sellOrder = &event.MakeOrder
+		// 设置买方订单ID
+		buyOrderId = takeOrderId
+	}
 
-		// 更新卖方订单状态
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", makeOrderId).
-			Updates(map[string]interface{}{
-				"order_status":       multi.OrderStatusFilled,
-				"quantity_remaining": 0,
-				"taker":              to,
-			}).Error; err != nil {
-			// 如果更新失败，记录错误日志并返回
-			xzap.WithContext(s.ctx).Error("failed on update order status",
-				zap.String("order_id", makeOrderId))
-			return
-		}
-
-		// 查询买方订单信息，不存在则无需更新，说明不是从平台前端发起的交易
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", takeOrderId).
-			First(&buyOrder).Error; err != nil {
-			// 如果查询失败，记录错误日志并返回
-			xzap.WithContext(s.ctx).Error("failed on get buy order",
-				zap.Error(err))
-			return
-		}
-		// 更新买方订单的剩余数量
-		if buyOrder.QuantityRemaining > 1 {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", takeOrderId).
-				Update("quantity_remaining", buyOrder.QuantityRemaining-1).Error; err != nil {
-				// 如果更新失败，记录错误日志并返回
-				xzap.WithContext(s.ctx).Error("failed on update order quantity_remaining",
-					zap.String("order_id", takeOrderId))
-				return
-			}
-		} else {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", takeOrderId).
-				Updates(map[string]interface{}{
-					"order_status":       multi.OrderStatusFilled,
-					"quantity_remaining": 0,
-				}).Error; err != nil {
-				// 如果更新失败，记录错误日志并返回
-				xzap.WithContext(s.ctx).Error("failed on update order status",
-					zap.String("order_id", takeOrderId))
-				return
-			}
-		}
+	if err := s.fillMatchedOrders(batch, log.BlockNumber, sellOrderId, sellOrder, buyOrderId, to); err != nil {
+		return err
 	}
 
 	// 获取该日志所在区块的时间
-	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, big.NewInt(int64(log.BlockNumber)))
+	blockTime, err := s.blockTime(batch, log.BlockNumber)
 	if err != nil {
-		// 如果获取失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("failed to get block time", zap.Error(err))
-		return
+		return err
 	}
 	// 创建一个新的活动结构体
 	newActivity := multi.Activity{
 		ActivityType:      multi.Sale,
-		Maker:             event.MakeOrder.Maker.String(),
-		Taker:             event.TakeOrder.Maker.String(),
+		// 成交记录的 maker 固定为卖方、taker 固定为买方，与撮合时哪一方是挂单无关，集合统计按此计算买卖双方数量
+		Maker:             from,
+		Taker:             to,
 		MarketplaceID:     multi.MarketOrderBook,
 		CollectionAddress: collection,
 		TokenId:           tokenId,
@@ -544,76 +645,81 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 		EventTime:         int64(blockTime),
 	}
 	// 将活动信息存入数据库，如果活动已存在则不做处理
-	if err := s.db.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newActivity).Error; err != nil {
-		// 如果存储失败，记录警告日志
-		xzap.WithContext(s.ctx).Warn("failed on create activity",
-			zap.Error(err))
+	if err := s.createWithUndo(batch.tx, log.BlockNumber, multi.ActivityTableName(s.chain), activityUndoKey(&newActivity), &newActivity); err != nil {
+		return errors.Wrap(err, "failed on create activity")
 	}
+	batch.addActivity(&newActivity)
 
-	// 更新NFT的所有者
-	if err := s.db.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).
-		Where("collection_address = ? and token_id = ?", strings.ToLower(collection), tokenId).
-		Update("owner", owner).Error; err != nil {
-		// 如果更新失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("failed to update item owner",
-			zap.Error(err))
-		return
+	// 更新NFT的所有者。ERC-1155 的持有数量由 Transfer 事件同步器根据 TransferSingle / TransferBatch 维护
+	standard, err := s.collectionTokenStandard(batch, collection)
+	if err != nil {
+		return err
 	}
-
-	// 将交易信息存入价格更新队列
-	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
-		OrderId:        sellOrderId,
-		CollectionAddr: collection,
-		EventType:      ordermanager.Buy,
-		TokenID:        tokenId,
-		From:           from,
-		To:             to,
-	}, s.chain); err != nil {
-		// 如果添加失败，记录错误日志
-		xzap.WithContext(s.ctx).Error("failed on add update price event",
-			zap.Error(err),
-			zap.String("type", "sale"),
-			zap.String("order_id", sellOrderId))
+	if standard != multi.TokenStandardERC1155 {
+		if err := s.updateWithUndo(batch.tx, log.BlockNumber, multi.ItemTableName(s.chain),
+			map[string]interface{}{"collection_address": strings.ToLower(collection), "token_id": tokenId},
+			map[string]interface{}{"owner": owner}); err != nil {
+			return errors.Wrap(err, "failed to update item owner")
+		}
 	}
+
+	// 事务提交后将交易信息存入价格更新队列
+	batch.onCommit(func() {
+		if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
+			OrderId:        sellOrderId,
+			CollectionAddr: collection,
+			EventType:      ordermanager.Buy,
+			TokenID:        tokenId,
+			From:           from,
+			To:             to,
+		}, s.chain); err != nil {
+			// 如果添加失败，记录错误日志
+			xzap.WithContext(s.ctx).Error("failed on add update price event",
+				zap.Error(err),
+				zap.String("type", "sale"),
+				zap.String("order_id", sellOrderId))
+		}
+	})
+	return nil
 }
 
 // handleCancelEvent 处理LogCancel事件，当订单被取消时触发。
-// 该函数会更新订单状态为已取消，将取消信息存入活动表，并将交易信息存入价格更新队列。
-func (s *Service) handleCancelEvent(log ethereumTypes.Log) {
+// 该函数会更新订单状态为已取消，将取消信息存入活动表，事务提交后再写入价格更新队列。
+func (s *Service) handleCancelEvent(batch *eventBatch, log ethereumTypes.Log) error {
 	// 从日志的topics中提取订单ID
 	orderId := HexPrefix + hex.EncodeToString(log.Topics[1].Bytes())
 	// 注释掉的代码，原计划从日志的topics中提取订单创建者地址
 	//maker := common.BytesToAddress(log.Topics[2].Bytes())
 	// 更新数据库中订单的状态为已取消
-	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-		Where("order_id = ?", orderId).
-		Update("order_status", multi.OrderStatusCancelled).Error; err != nil {
-		// 如果更新失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("failed on update order status",
-			zap.String("order_id", orderId))
-		return
+	if err := s.updateWithUndo(batch.tx, log.BlockNumber, multi.OrderTableName(s.chain),
+		map[string]interface{}{"order_id": orderId},
+		map[string]interface{}{"order_status": multi.OrderStatusCancelled}); err != nil {
+		return errors.Wrapf(err, "failed on update order %s status", orderId)
 	}
 
 	// 定义一个变量来存储取消的订单信息
-	var cancelOrder multi.Order
+	var cancelOrders []multi.Order
 	// 从数据库中查询取消的订单信息
-	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
+	if err := batch.tx.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
 		Where("order_id = ?", orderId).
-		First(&cancelOrder).Error; err != nil {
-		// 如果查询失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("failed on get cancel order",
-			zap.Error(err))
-		return
+		Limit(1).Find(&cancelOrders).Error; err != nil {
+		return errors.Wrap(err, "failed on get cancel order")
+	}
+	// 订单不存在，说明不是从平台发起的挂单，无需记录活动
+	if len(cancelOrders) == 0 {
+		return nil
+	}
+	cancelOrder := cancelOrders[0]
+	batch.touchDepth(cancelOrder.CollectionAddress, cancelOrder.OrderID)
+	// editOrders 中的取消：旧订单被新订单替换，不作为取消处理
+	if edit, ok := batch.edits[logKey(log)]; ok && edit.matches(&cancelOrder) {
+		return s.replaceOrder(batch, log, edit)
 	}
 
 	// 获取该日志所在区块的时间
-	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, big.NewInt(int64(log.BlockNumber)))
+	blockTime, err := s.blockTime(batch, log.BlockNumber)
 	if err != nil {
-		// 如果获取失败，记录错误日志并返回
-		xzap.WithContext(s.ctx).Error("failed to get block time", zap.Error(err))
-		return
+		return err
 	}
 	// 根据订单类型确定活动类型
 	var activityType int
@@ -642,27 +748,27 @@ func (s *Service) handleCancelEvent(log ethereumTypes.Log) {
 		EventTime:         int64(blockTime),
 	}
 	// 将活动信息存入数据库，如果活动已存在则不做处理
-	if err := s.db.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newActivity).Error; err != nil {
-		// 如果存储失败，记录警告日志
-		xzap.WithContext(s.ctx).Warn("failed on create activity",
-			zap.Error(err))
-	}
-
-	// 将交易信息存入价格更新队列，通知价格更新
-	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
-		OrderId:        cancelOrder.OrderID,
-		CollectionAddr: cancelOrder.CollectionAddress,
-		TokenID:        cancelOrder.TokenId,
-		EventType:      ordermanager.Cancel,
-	}, s.chain); err != nil {
-		// 如果添加失败，记录错误日志
-		xzap.WithContext(s.ctx).Error("failed on add update price event",
-			zap.Error(err),
-			zap.String("type", "cancel"),
-			zap.String("order_id", cancelOrder.OrderID))
-	}
+	if err := s.createWithUndo(batch.tx, log.BlockNumber, multi.ActivityTableName(s.chain), activityUndoKey(&newActivity), &newActivity); err != nil {
+		return errors.Wrap(err, "failed on create activity")
+	}
+	batch.addActivity(&newActivity)
+
+	// 事务提交后将交易信息存入价格更新队列，通知价格更新
+	batch.onCommit(func() {
+		if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
+			OrderId:        cancelOrder.OrderID,
+			CollectionAddr: cancelOrder.CollectionAddress,
+			TokenID:        cancelOrder.TokenId,
+			EventType:      ordermanager.Cancel,
+		}, s.chain); err != nil {
+			// 如果添加失败，记录错误日志
+			xzap.WithContext(s.ctx).Error("failed on add update price event",
+				zap.Error(err),
+				zap.String("type", "cancel"),
+				zap.String("order_id", cancelOrder.OrderID))
+		}
+	})
+	return nil
 }
 
 // UpKeepingCollectionFloorChangeLoop 是一个服务方法，用于维护集合底价的变化。
@@ -28,7 +28,7 @@ func TestSyncEvent(t *testing.T) {
 	})
 
 	chainClient, _ := chainclient.New(10, "https://rpc.ankr.com/optimism/9c6c678ebcb56da1cb80f7632c7c02264831232c3d53453c7726a611e7ca36d7")
-	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", nil)
+	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", "0x7d29d1860bD4d3A74bBD9a03C9B043d375311dCb", nil)
 
 	query := types.FilterQuery{
 		FromBlock: new(big.Int).SetUint64(111819366),
@@ -38,15 +38,16 @@ func TestSyncEvent(t *testing.T) {
 
 	logs, _ := chainClient.FilterLogs(ctx, query)
 
+	batch := newEventBatch(db, nil)
 	for _, log := range logs {
 		ethLog := log.(ethereumTypes.Log)
 		switch ethLog.Topics[0].String() {
 		case LogMakeTopic:
-			orderbookSyncer.handleMakeEvent(ethLog)
+			orderbookSyncer.handleMakeEvent(batch, ethLog)
 		case LogCancelTopic:
-			orderbookSyncer.handleCancelEvent(ethLog)
+			orderbookSyncer.handleCancelEvent(batch, ethLog)
 		case LogMatchTopic:
-			orderbookSyncer.handleMatchEvent(ethLog)
+			orderbookSyncer.handleMatchEvent(batch, ethLog)
 		default:
 
 		}
@@ -65,7 +66,7 @@ func TestHandleMakeEvent(t *testing.T) {
 		MaxOpenConns: 1500,
 	})
 	chainClient, _ := chainclient.New(10, "https://rpc.ankr.com/optimism/9c6c678ebcb56da1cb80f7632c7c02264831232c3d53453c7726a611e7ca36d7")
-	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", nil)
+	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", "0x7d29d1860bD4d3A74bBD9a03C9B043d375311dCb", nil)
 	data, _ := hex.DecodeString("c773ae81bc9a186dc6c5d70a486730a6f734578ae1a0116acd0aaaf69250d2650000000000000000000000000000000000000000000000000000000000000000000000000000000000000000e7f1725e7734ce288f8367e1bb143e90bb3f05120000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000002386f26fc10000000000000000000000000000000000000000000000000000000000006558875d0000000000000000000000000000000000000000000000000000000000000001")
 	log := ethereumTypes.Log{
 		Address: common.HexToAddress("0x123"),
@@ -79,5 +80,5 @@ func TestHandleMakeEvent(t *testing.T) {
 		BlockNumber: 111482956,
 		TxHash:      common.HexToHash("0x000000000000000000000000f39fd6e51aad88f6f4ce6ab8827279cfffb92266"),
 	}
-	orderbookSyncer.handleMakeEvent(log)
+	orderbookSyncer.handleMakeEvent(newEventBatch(db, nil), log)
 }
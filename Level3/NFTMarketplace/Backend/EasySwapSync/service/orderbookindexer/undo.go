@@ -0,0 +1,185 @@
+package orderbookindexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createWithUndo 插入一行数据（已存在则忽略），并在真正插入时记录一条 insert 类型的回滚日志。
+// 参数:
+// - db: 数据库连接（可以是事务）
+// - blockNumber: 产生该修改的区块号
+// - table: 目标表名
+// - key: 能唯一定位该行的条件，回滚时据此删除
+// - value: 要插入的数据
+func (s *Service) createWithUndo(db *gorm.DB, blockNumber uint64, table string, key map[string]interface{}, value interface{}) error {
+	// 插入数据，如果已存在则不做处理
+	result := db.WithContext(s.ctx).Table(table).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(value)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "failed on create row")
+	}
+	// 数据已存在，说明不是本区块产生的，无需记录回滚日志
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return s.writeUndoLog(db, blockNumber, table, base.UndoActionInsert, key, nil)
+}
+
+// updateWithUndo 更新 key 定位到的行，并把被更新列的旧值记录到回滚日志中。
+// 目标行不存在时不做任何修改。
+// 参数:
+// - db: 数据库连接（可以是事务）
+// - blockNumber: 产生该修改的区块号
+// - table: 目标表名
+// - key: 能唯一定位该行的条件
+// - values: 需要更新的列和新值
+func (s *Service) updateWithUndo(db *gorm.DB, blockNumber uint64, table string, key map[string]interface{}, values map[string]interface{}) error {
+	// 查询被更新列的旧值
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var rows []map[string]interface{}
+	if err := db.WithContext(s.ctx).Table(table).Select(columns).Where(key).Limit(1).Find(&rows).Error; err != nil {
+		return errors.Wrap(err, "failed on query previous values")
+	}
+	// 目标行不存在，无需更新
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if err := s.writeUndoLog(db, blockNumber, table, base.UndoActionUpdate, key, normalizeRow(rows[0])); err != nil {
+		return err
+	}
+
+	if err := db.WithContext(s.ctx).Table(table).Where(key).Updates(values).Error; err != nil {
+		return errors.Wrap(err, "failed on update row")
+	}
+	return nil
+}
+
+// writeUndoLog 写入一条回滚日志
+func (s *Service) writeUndoLog(db *gorm.DB, blockNumber uint64, table string, action int, key map[string]interface{}, prev map[string]interface{}) error {
+	rawKey, err := json.Marshal(key)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal undo key")
+	}
+
+	var rawPrev []byte
+	if prev != nil {
+		if rawPrev, err = json.Marshal(prev); err != nil {
+			return errors.Wrap(err, "failed on marshal undo values")
+		}
+	}
+
+	undoLog := base.IndexedUndoLog{
+		ChainId:         int(s.chainId),
+		IndexType:       EventIndexType,
+		ContractAddress: s.contract,
+		BlockNumber:     int64(blockNumber),
+		TargetTable:     table,
+		Action:          action,
+		RowKey:          string(rawKey),
+		PrevValues:      string(rawPrev),
+	}
+	if err := db.WithContext(s.ctx).Table(base.IndexedUndoLogTableName()).Create(&undoLog).Error; err != nil {
+		return errors.Wrap(err, "failed on create undo log")
+	}
+	return nil
+}
+
+// activityUndoKey 返回活动记录的唯一键，与 ob_activity_* 的唯一索引 index_tx_collection_token_type 一致
+func activityUndoKey(activity *multi.Activity) map[string]interface{} {
+	return map[string]interface{}{
+		"tx_hash":            activity.TxHash,
+		"collection_address": activity.CollectionAddress,
+		"token_id":           activity.TokenId,
+		"activity_type":      activity.ActivityType,
+	}
+}
+
+// applyUndoLog 回放一条回滚日志：insert 删除对应行，update 恢复旧值
+func applyUndoLog(db *gorm.DB, undoLog *base.IndexedUndoLog) error {
+	key, err := decodeUndoValues(undoLog.RowKey)
+	if err != nil {
+		return errors.Wrap(err, "failed on decode undo key")
+	}
+	if len(key) == 0 {
+		return errors.New("empty undo key")
+	}
+
+	switch undoLog.Action {
+	case base.UndoActionInsert:
+		// 按 key 拼接删除条件，列名来自索引服务自己写入的日志
+		columns := make([]string, 0, len(key))
+		for column := range key {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		conditions := make([]string, 0, len(columns))
+		args := make([]interface{}, 0, len(columns))
+		for _, column := range columns {
+			conditions = append(conditions, fmt.Sprintf("`%s` = ?", column))
+			args = append(args, key[column])
+		}
+		stmt := fmt.Sprintf("DELETE FROM `%s` WHERE %s", undoLog.TargetTable, strings.Join(conditions, " AND "))
+		if err := db.Exec(stmt, args...).Error; err != nil {
+			return errors.Wrap(err, "failed on delete inserted row")
+		}
+	case base.UndoActionUpdate:
+		prev, err := decodeUndoValues(undoLog.PrevValues)
+		if err != nil {
+			return errors.Wrap(err, "failed on decode undo values")
+		}
+		if len(prev) == 0 {
+			return nil
+		}
+		if err := db.Table(undoLog.TargetTable).Where(key).Updates(prev).Error; err != nil {
+			return errors.Wrap(err, "failed on restore updated row")
+		}
+	default:
+		return errors.Errorf("unknown undo action %d", undoLog.Action)
+	}
+
+	return nil
+}
+
+// decodeUndoValues 解析回滚日志中的 json，数字保持为 json.Number 以免丢失精度
+func decodeUndoValues(raw string) (map[string]interface{}, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.UseNumber()
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// normalizeRow 把数据库驱动返回的 []byte 转成字符串，避免 json 序列化成 base64
+func normalizeRow(row map[string]interface{}) map[string]interface{} {
+	for column, value := range row {
+		if raw, ok := value.([]byte); ok {
+			row[column] = string(raw)
+		}
+	}
+	return row
+}
@@ -2,35 +2,52 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"net/url"
 	"sync"
 
-	"github.com/ProjectsTask/EasySwapBase/chain"
 	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/collectionstats"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/pkg/errors"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/core/stores/kv"
 	"github.com/zeromicro/go-zero/core/stores/redis"
+	"github.com/zeromicro/go-zero/core/threading"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 
 	"github.com/ProjectsTask/EasySwapSync/service/orderbookindexer"
 
 	"github.com/ProjectsTask/EasySwapSync/model"
 	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/collectionimporter"
 	"github.com/ProjectsTask/EasySwapSync/service/config"
+	"github.com/ProjectsTask/EasySwapSync/service/transferindexer"
 )
 
 type Service struct {
-	ctx              context.Context
-	config           *config.Config
-	kvStore          *xkv.Store
-	db               *gorm.DB
-	wg               *sync.WaitGroup
-	collectionFilter *collectionfilter.Filter
-	orderbookIndexer *orderbookindexer.Service
-	orderManager     *ordermanager.OrderManager
+	ctx     context.Context
+	config  *config.Config
+	kvStore *xkv.Store
+	db      *gorm.DB
+	wg      *sync.WaitGroup
+	// chains 每条链的同步组件
+	chains []*chainSyncer
+}
+
+// chainSyncer 一条链的同步组件。
+// 每条链使用独立的链客户端、集合过滤器、订单管理器和同步器，同步进度按链 ID 分别记录。
+type chainSyncer struct {
+	cfg                *config.Config
+	collectionFilter   *collectionfilter.Filter
+	orderbookIndexers  []*orderbookindexer.Service
+	transferIndexer    *transferindexer.Service
+	collectionImporter *collectionimporter.Service
+	orderManager       *ordermanager.OrderManager
+	statsRollup        *collectionstats.Rollup
 }
 
 // New 函数用于创建一个新的 Service 实例。
@@ -38,6 +55,47 @@ type Service struct {
 // 参数 cfg 是一个指向 config.Config 结构体的指针，包含了 Service 的配置信息。
 // 返回值是一个指向 Service 结构体的指针和一个错误对象。如果创建成功，错误对象为 nil。
 func New(ctx context.Context, cfg *config.Config) (*Service, error) {
+	// 使用配置好的 Redis 节点信息创建一个新的 xkv.Store 实例。
+	kvStore := newKvStore(cfg)
+
+	// 根据配置文件中的数据库信息创建一个新的数据库实例。
+	db := model.NewDB(cfg.DB)
+
+	// 为每条链创建独立的同步组件，数据库和缓存在各条链之间共享。
+	chainConfigs := cfg.ChainConfigs()
+	if err := validateChainConfigs(chainConfigs); err != nil {
+		return nil, err
+	}
+	var chains []*chainSyncer
+	for _, chainCfg := range chainConfigs {
+		syncer, err := newChainSyncer(ctx, chainCfg, db, kvStore)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed on create syncer for chain %s", chainCfg.ChainCfg.Name)
+		}
+		chains = append(chains, syncer)
+	}
+
+	// 初始化一个 Service 结构体实例。
+	manager := Service{
+		// 上下文对象，用于控制 Service 的生命周期
+		ctx: ctx,
+		// 配置信息
+		config: cfg,
+		// 数据库实例
+		db: db,
+		// 键值存储实例
+		kvStore: kvStore,
+		// 每条链的同步组件
+		chains: chains,
+		// 同步等待组，用于等待所有 goroutine 完成
+		wg: &sync.WaitGroup{},
+	}
+	// 返回 Service 实例的指针和 nil 错误。
+	return &manager, nil
+}
+
+// newKvStore 根据配置创建 Redis 存储
+func newKvStore(cfg *config.Config) *xkv.Store {
 	// 初始化一个 kv.KvConf 类型的变量，用于存储 Redis 节点配置。
 	var kvConf kv.KvConf
 	// 遍历配置文件中的 Redis 节点配置。
@@ -58,80 +116,147 @@ func New(ctx context.Context, cfg *config.Config) (*Service, error) {
 	}
 
 	// 使用配置好的 Redis 节点信息创建一个新的 xkv.Store 实例。
-	kvStore := xkv.NewStore(kvConf)
+	return xkv.NewStore(kvConf)
+}
 
-	// 声明一个错误变量，用于存储可能出现的错误。
-	var err error
-	// 根据配置文件中的数据库信息创建一个新的数据库实例。
-	db := model.NewDB(cfg.DB)
+// validateChainConfigs 检查链配置：同一条链的多个订单簿合约部署已合并为一份配置，
+// 合并后链 ID 和链名称仍然重复说明链 ID 相同而名称不同，每条链至少配置一个订单簿合约
+func validateChainConfigs(chainConfigs []*config.Config) error {
+	ids := make(map[int64]bool)
+	names := make(map[string]bool)
+	for _, chainCfg := range chainConfigs {
+		if chainCfg.ChainCfg.ID == 0 || chainCfg.ChainCfg.Name == "" {
+			return errors.New("chain id and name are required")
+		}
+		if ids[chainCfg.ChainCfg.ID] || names[chainCfg.ChainCfg.Name] {
+			return errors.Errorf("duplicate chain %s(%d)", chainCfg.ChainCfg.Name, chainCfg.ChainCfg.ID)
+		}
+		if len(chainCfg.ContractCfg.Dexes()) == 0 {
+			return errors.Errorf("no dex address configured for chain %s", chainCfg.ChainCfg.Name)
+		}
+		ids[chainCfg.ChainCfg.ID] = true
+		names[chainCfg.ChainCfg.Name] = true
+	}
+	return nil
+}
+
+// newChainSyncer 根据一条链的配置创建该链的同步组件
+func newChainSyncer(ctx context.Context, cfg *config.Config, db *gorm.DB, kvStore *xkv.Store) (*chainSyncer, error) {
 	// 创建一个新的 collectionfilter.Filter 实例，用于过滤集合信息。
 	collectionFilter := collectionfilter.New(ctx, db, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
 	// 创建一个新的 ordermanager.OrderManager 实例，用于管理订单信息。
 	orderManager := ordermanager.New(ctx, db, kvStore, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
-	// 声明一个指向 orderbookindexer.Service 结构体的指针，用于同步订单簿信息。
-	var orderbookSyncer *orderbookindexer.Service
-	// 声明一个 chainclient.ChainClient 接口类型的变量，用于与区块链节点通信。
-	var chainClient chainclient.ChainClient
-	// 打印链客户端的 URL 信息，方便调试。
-	fmt.Println("chainClient url:" + cfg.AnkrCfg.HttpsUrl + cfg.AnkrCfg.ApiKey)
+	// 创建链客户端，用于与区块链节点通信。
+	chainClient, err := newChainClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// 根据配置文件中的链 ID 和 API 密钥创建一个新的链客户端实例。
-	chainClient, err = chainclient.New(int(cfg.ChainCfg.ID), cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey)
-	// 检查创建链客户端时是否出现错误。
+	// 为该链上的每个订单簿合约创建一个 orderbookindexer.Service 实例，同步进度按 (链 ID, 合约地址) 分别记录。
+	var orderbookSyncers []*orderbookindexer.Service
+	for _, dex := range cfg.ContractCfg.Dexes() {
+		orderbookSyncers = append(orderbookSyncers, orderbookindexer.New(ctx, cfg, db, kvStore, chainClient,
+			cfg.ChainCfg.ID, cfg.ChainCfg.Name, dex, orderManager))
+	}
+	// 创建 NFT 链服务，用于获取集合的 Transfer 事件，以及导入集合时读取合约信息和元数据
+	importCfg := cfg.GetImportCfg()
+	nodeService, err := nftchainservice.New(ctx, cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey, cfg.ChainCfg.Name, int(cfg.ChainCfg.ID),
+		importCfg.NameTags, importCfg.ImageTags, importCfg.AttributesTags, importCfg.TraitNameTags, importCfg.TraitValueTags)
 	if err != nil {
-		// 如果出现错误，返回 nil 和一个包装后的错误信息。
-		return nil, errors.Wrap(err, "failed on create evm client")
+		return nil, errors.Wrap(err, "failed on create nft chain service")
+	}
+	// 创建 Transfer 事件同步器，用于维护 NFT 的 owner
+	transferSyncer := transferindexer.New(ctx, db, kvStore, nodeService, collectionFilter, cfg.ChainCfg)
+	// 创建集合导入器，处理导入任务并把导入完成的集合加入过滤器和订单管理器
+	importer := collectionimporter.New(ctx, db, kvStore, nodeService, collectionFilter, importCfg,
+		cfg.ChainCfg.ID, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
+	// 创建集合统计汇总任务，把成交记录和地板价汇总到按时间分桶的统计表
+	statsRollup := collectionstats.New(ctx, db, kvStore, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
+
+	return &chainSyncer{
+		cfg:                cfg,
+		collectionFilter:   collectionFilter,
+		orderbookIndexers:  orderbookSyncers,
+		transferIndexer:    transferSyncer,
+		collectionImporter: importer,
+		orderManager:       orderManager,
+		statsRollup:        statsRollup,
+	}, nil
+}
+
+// newChainClient 根据一条链的配置创建链客户端
+func newChainClient(ctx context.Context, cfg *config.Config) (chainclient.ChainClient, error) {
+	// 配置中的链都是 EVM 链，注册后即可创建链客户端，新链只需要增加配置
+	if err := chainclient.Register(int(cfg.ChainCfg.ID), chainclient.VMTypeEVM); err != nil {
+		return nil, errors.Wrap(err, "failed on register chain")
 	}
 
-	// 根据配置文件中的链 ID 选择不同的同步器。
-	switch cfg.ChainCfg.ID {
-	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID:
-		// 创建一个新的 orderbookindexer.Service 实例，用于同步订单簿信息。
-		orderbookSyncer = orderbookindexer.New(ctx, cfg, db, kvStore, chainClient, cfg.ChainCfg.ID, cfg.ChainCfg.Name, orderManager)
+	// 记录链客户端连接的节点，URL 中可能带有 API 密钥，只记录主机名。
+	xzap.WithContext(ctx).Info("create chain client",
+		zap.String("chain", cfg.ChainCfg.Name), zap.String("host", urlHost(cfg.AnkrCfg.HttpsUrl)))
+
+	// 根据配置文件中的链 ID 和 API 密钥创建一个新的链客户端实例。
+	// 开启 enable_wss 时同时连接 websocket 节点，订单簿同步器会订阅新区块和日志。
+	var chainClient chainclient.ChainClient
+	var err error
+	if cfg.AnkrCfg.EnableWss {
+		chainClient, err = chainclient.NewWithWebsocket(int(cfg.ChainCfg.ID), cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey,
+			cfg.AnkrCfg.WebsocketUrl+cfg.AnkrCfg.ApiKey)
+	} else {
+		chainClient, err = chainclient.New(int(cfg.ChainCfg.ID), cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey)
 	}
-	// 再次检查是否出现错误，这一步可能是多余的，需要确认逻辑。
+	// 检查创建链客户端时是否出现错误。
 	if err != nil {
 		// 如果出现错误，返回 nil 和一个包装后的错误信息。
-		return nil, errors.Wrap(err, "failed on create trade info server")
-	}
-	// 初始化一个 Service 结构体实例。
-	manager := Service{
-		// 上下文对象，用于控制 Service 的生命周期
-		ctx: ctx,
-		// 配置信息
-		config: cfg,
-		// 数据库实例
-		db: db,
-		// 键值存储实例
-		kvStore: kvStore,
-		// 集合过滤器实例
-		collectionFilter: collectionFilter,
-		// 订单簿同步器实例
-		orderbookIndexer: orderbookSyncer,
-		// 订单管理器实例
-		orderManager: orderManager,
-		// 同步等待组，用于等待所有 goroutine 完成
-		wg: &sync.WaitGroup{},
+		return nil, errors.Wrap(err, "failed on create evm client")
 	}
-	// 返回 Service 实例的指针和 nil 错误。
-	return &manager, nil
+	return chainClient, nil
 }
 
 // Start 方法用于启动 Service 实例中的各个组件。
-// 该方法会按顺序调用集合过滤器的预加载方法，以及订单簿同步器和订单管理器的启动方法。
+// 该方法会按顺序启动每条链的集合过滤器、订单簿同步器、Transfer 事件同步器、集合导入器、订单管理器和集合统计汇总任务。
 // 如果在预加载集合时出现错误，该方法会返回一个包装后的错误信息。
 // 返回值为错误对象，如果启动过程中没有出现错误，返回 nil。
 func (s *Service) Start() error {
+	for _, syncer := range s.chains {
+		if err := syncer.start(); err != nil {
+			return errors.Wrapf(err, "failed on start syncer for chain %s", syncer.cfg.ChainCfg.Name)
+		}
+	}
+	// 如果所有组件都成功启动，返回 nil 表示没有错误。
+	return nil
+}
+
+// start 启动一条链的同步组件
+func (c *chainSyncer) start() error {
 	// 调用集合过滤器的 PreloadCollections 方法，预先加载集合信息到过滤器中。
 	// 如果预加载过程中出现错误，将错误信息包装并返回。
-	if err := s.collectionFilter.PreloadCollections(); err != nil {
+	if err := c.collectionFilter.PreloadCollections(); err != nil {
 		return errors.Wrap(err, "failed on preload collection to filter")
 	}
 
-	// 启动订单簿同步器，开始同步订单簿信息。
-	s.orderbookIndexer.Start()
+	// 启动每个订单簿合约的同步器，开始同步订单簿信息。
+	for _, indexer := range c.orderbookIndexers {
+		indexer.Start()
+	}
+	// 集合底价变化的维护任务按链执行，只需要启动一次。
+	threading.GoSafe(c.orderbookIndexers[0].UpKeepingCollectionFloorChangeLoop)
+	// 启动 Transfer 事件同步器，开始同步 NFT 的 owner。
+	c.transferIndexer.Start()
+	// 启动集合导入器，开始处理导入任务。
+	c.collectionImporter.Start()
 	// 启动订单管理器，开始管理订单信息。
-	s.orderManager.Start()
-	// 如果所有组件都成功启动，返回 nil 表示没有错误。
+	c.orderManager.Start()
+	// 启动集合统计汇总任务。
+	c.statsRollup.Start()
 	return nil
 }
+
+// urlHost 返回节点 URL 的主机名，解析失败时返回空字符串
+func urlHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
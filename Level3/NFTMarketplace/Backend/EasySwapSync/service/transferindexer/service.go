@@ -0,0 +1,620 @@
+package transferindexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/apicache"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/zeromicro/go-zero/core/threading"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+const (
+	SleepInterval   = 10 // in seconds
+	SyncBlockPeriod = 10
+	// DefaultConfirmBlocks 链配置未设置 confirm_blocks 时，只同步落后最新区块 DefaultConfirmBlocks 个区块之前的转移事件。
+	DefaultConfirmBlocks = 12
+	// RetainBlocks 保留已同步区块哈希和已应用转移记录的区块数。
+	// 确认数不足以避免的链重组在该深度内可以自动撤销，更深的重组需要人工介入
+	RetainBlocks = 256
+
+	ZeroAddress = "0x0000000000000000000000000000000000000000"
+)
+
+// transferFetcher 获取指定区块范围内、指定合约的 ERC-721 / ERC-1155 转移事件，由 nftchainservice.Service 实现
+type transferFetcher interface {
+	GetNFTTransferEventByAddresses(fromBlock, toBlock uint64, addresses []string) ([]*nftchainservice.TransferLog, error)
+}
+
+// chainClient 获取当前最新区块高度和区块头，用于等待确认数和检测链重组
+type chainClient interface {
+	BlockNumber() (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// Service 同步已导入集合的 ERC-721 / ERC-1155 转移事件，维护 ob_item_* 的 owner 和 ob_item_balance_* 的持有数量，
+// 记录 Mint/Transfer 活动，并通知订单管理器把失效的挂单移出地板价队列。
+type Service struct {
+	ctx              context.Context
+	db               *gorm.DB
+	kv               *xkv.Store
+	transfers        transferFetcher
+	chainClient      chainClient
+	collectionFilter *collectionfilter.Filter
+	chainId          int64
+	chain            string
+	confirmBlocks    uint64
+	startBlock       uint64
+}
+
+// New 创建一个新的 Service 实例。
+// 参数:
+// - ctx: 上下文环境，用于控制操作的生命周期。
+// - db: 数据库连接，用于与数据库交互。
+// - xkv: 键值存储，用于写入地板价更新事件。
+// - nodeService: NFT 链服务，用于获取 Transfer 事件。
+// - collectionFilter: 集合过滤器，只同步已导入的集合。
+// - chainCfg: 链配置，提供链ID、链名称、确认数和同步的起始区块。
+// 返回值:
+// - *Service: 初始化后的 Service 指针。
+func New(ctx context.Context, db *gorm.DB, xkv *xkv.Store, nodeService *nftchainservice.Service,
+	collectionFilter *collectionfilter.Filter, chainCfg config.ChainCfg) *Service {
+	return &Service{
+		ctx:              ctx,
+		db:               db,
+		kv:               xkv,
+		transfers:        nodeService,
+		chainClient:      nodeService.NodeClient,
+		collectionFilter: collectionFilter,
+		chainId:          chainCfg.ID,
+		chain:            chainCfg.Name,
+		confirmBlocks:    chainCfg.ConfirmBlocks,
+		startBlock:       chainCfg.TransferStartBlock,
+	}
+}
+
+// Start 启动 Transfer 事件同步循环
+func (s *Service) Start() {
+	threading.GoSafe(s.SyncTransferEventLoop)
+}
+
+// confirmations 返回同步落后最新区块的区块数，优先使用链配置中的 confirm_blocks
+func (s *Service) confirmations() uint64 {
+	if s.confirmBlocks > 0 {
+		return s.confirmBlocks
+	}
+	return DefaultConfirmBlocks
+}
+
+// SyncTransferEventLoop 持续同步 Transfer 事件。
+// 它从 ob_indexed_status 中获取最后同步的区块高度（不早于配置的起始区块），每次同步 SyncBlockPeriod 个区块，
+// 同步的区块始终落后最新区块 confirmations() 个区块。每一轮开始前检查上一轮同步的区块是否被重组，
+// 被重组时撤销分叉点之后的转移，从分叉点重新同步。
+func (s *Service) SyncTransferEventLoop() {
+	var indexedStatus base.IndexedStatus
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, comm.TransferIndexType).
+		First(&indexedStatus).Error; err != nil {
+		xzap.WithContext(s.ctx).Error("failed on get transfer index status",
+			zap.Error(err))
+		return
+	}
+
+	lastSyncBlock := uint64(indexedStatus.LastIndexedBlock)
+	if lastSyncBlock < s.startBlock {
+		lastSyncBlock = s.startBlock
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			xzap.WithContext(s.ctx).Info("SyncTransferEventLoop stopped due to context cancellation")
+			return
+		default:
+		}
+
+		currentBlockNum, err := s.chainClient.BlockNumber()
+		if err != nil {
+			xzap.WithContext(s.ctx).Error("failed on get current block number", zap.Error(err))
+			time.Sleep(SleepInterval * time.Second)
+			continue
+		}
+
+		// 等待足够的确认数
+		confirmBlocks := s.confirmations()
+		if currentBlockNum < confirmBlocks || lastSyncBlock > currentBlockNum-confirmBlocks {
+			time.Sleep(SleepInterval * time.Second)
+			continue
+		}
+
+		// 确认数不足以避免的重组：上一轮同步的区块已不在链上，撤销分叉点之后的转移后重新同步
+		forkPoint, reorged, err := s.findForkPoint(lastSyncBlock)
+		if err != nil {
+			xzap.WithContext(s.ctx).Error("failed on check transfer reorg", zap.Error(err),
+				zap.Uint64("start_block", lastSyncBlock))
+			time.Sleep(SleepInterval * time.Second)
+			continue
+		}
+		if reorged {
+			xzap.WithContext(s.ctx).Warn("chain reorg detected, rollback transfers",
+				zap.Uint64("start_block", lastSyncBlock), zap.Uint64("fork_point", forkPoint))
+			if err := s.rollbackTo(forkPoint); err != nil {
+				xzap.WithContext(s.ctx).Error("failed on rollback transfers", zap.Error(err),
+					zap.Uint64("fork_point", forkPoint))
+				time.Sleep(SleepInterval * time.Second)
+				continue
+			}
+			lastSyncBlock = forkPoint + 1
+			continue
+		}
+
+		startBlock := lastSyncBlock
+		endBlock := startBlock + SyncBlockPeriod
+		if endBlock > currentBlockNum-confirmBlocks {
+			endBlock = currentBlockNum - confirmBlocks
+		}
+
+		if err := s.syncTransfers(startBlock, endBlock); err != nil {
+			// 区间内的修改和同步进度在同一个事务中提交，失败时整体回滚，等待一段时间后重试
+			xzap.WithContext(s.ctx).Error("failed on sync transfer event", zap.Error(err),
+				zap.Uint64("start_block", startBlock), zap.Uint64("end_block", endBlock))
+			time.Sleep(SleepInterval * time.Second)
+			continue
+		}
+		lastSyncBlock = endBlock + 1
+	}
+}
+
+// syncTransfers 同步 [startBlock, endBlock] 区间内已导入集合的 Transfer 事件。
+// owner、活动、已应用的转移、区间末尾的区块哈希和同步进度在同一个事务中提交，事务提交后再通知订单管理器。
+func (s *Service) syncTransfers(startBlock, endBlock uint64) error {
+	// 先记录区间末尾的区块哈希，下一轮据此检查区间是否被重组
+	header, err := s.chainClient.HeaderByNumber(s.ctx, new(big.Int).SetUint64(endBlock))
+	if err != nil {
+		return errors.Wrapf(err, "failed on get header %d", endBlock)
+	}
+
+	var transfers []*nftchainservice.TransferLog
+	// 没有已导入的集合时只推进同步进度
+	if collections := s.collectionFilter.Elements(); len(collections) > 0 {
+		logs, err := s.transfers.GetNFTTransferEventByAddresses(startBlock, endBlock, collections)
+		if err != nil {
+			return errors.Wrap(err, "failed on get transfer events")
+		}
+		for _, log := range logs {
+			if log.Removed || !s.collectionFilter.Contains(log.Address) {
+				continue
+			}
+			transfers = append(transfers, log)
+		}
+	}
+
+	var events []*ordermanager.TradeEvent
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		for _, transfer := range transfers {
+			// 数量超过 ob_item_balance_*.balance（bigint）范围的转移无法记录，写入死信表等待人工处理后跳过。
+			// 区间内其他转移通过 ob_indexed_transfer 去重，区间重试时只应用一次，跳过单条转移不影响持有数量的累加
+			if transfer.OverflowAmount != "" {
+				if err := s.deadLetterTransfer(tx, transfer); err != nil {
+					return err
+				}
+				continue
+			}
+			applied, err := s.markTransferApplied(tx, transfer)
+			if err != nil {
+				return err
+			}
+			if applied {
+				continue
+			}
+			event, err := s.applyTransfer(tx, transfer)
+			if err != nil {
+				return errors.Wrapf(err, "failed on apply transfer %s:%d", transfer.TransactionHash, transfer.Index)
+			}
+			events = append(events, event)
+		}
+
+		if err := tx.Table(base.IndexedBlockTableName()).Clauses(clause.OnConflict{
+			UpdateAll: true,
+		}).Create(&base.IndexedBlock{
+			ChainId:     int(s.chainId),
+			IndexType:   comm.TransferIndexType,
+			BlockNumber: int64(header.Number),
+			BlockHash:   header.Hash,
+			ParentHash:  header.ParentHash,
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on save indexed block")
+		}
+
+		if err := tx.Table(base.IndexedStatusTableName()).
+			Where("chain_id = ? and index_type = ?", s.chainId, comm.TransferIndexType).
+			Update("last_indexed_block", endBlock+1).Error; err != nil {
+			return errors.Wrap(err, "failed on update transfer event sync block number")
+		}
+
+		// 只保留最近 RetainBlocks 个区块的数据
+		if endBlock > RetainBlocks {
+			expired := endBlock - RetainBlocks
+			if err := tx.Table(base.IndexedBlockTableName()).
+				Where("chain_id = ? and index_type = ? and block_number < ?", s.chainId, comm.TransferIndexType, expired).
+				Delete(&base.IndexedBlock{}).Error; err != nil {
+				return errors.Wrap(err, "failed on prune indexed blocks")
+			}
+			if err := tx.Table(base.IndexedTransferTableName()).
+				Where("chain_id = ? and block_number < ?", s.chainId, expired).
+				Delete(&base.IndexedTransfer{}).Error; err != nil {
+				return errors.Wrap(err, "failed on prune indexed transfers")
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	s.notifyTransfers(events)
+
+	xzap.WithContext(s.ctx).Info("sync transfer event ...",
+		zap.Uint64("start_block", startBlock),
+		zap.Uint64("end_block", endBlock),
+		zap.Int("transfers", len(transfers)))
+	return nil
+}
+
+// notifyTransfers 在事务提交后通知订单管理器，转出方在该 token 上的挂单不再有效，并使集合和 item 的 API 缓存失效
+func (s *Service) notifyTransfers(events []*ordermanager.TradeEvent) {
+	var tags []string
+	for _, event := range events {
+		if err := ordermanager.AddUpdatePriceEvent(s.kv, event, s.chain); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on add update price event",
+				zap.Error(err),
+				zap.String("type", "transfer"),
+				zap.String("collection_address", event.CollectionAddr),
+				zap.String("token_id", event.TokenID))
+		}
+		tags = append(tags, apicache.CollectionTag(s.chain, event.CollectionAddr),
+			apicache.ItemTag(s.chain, event.CollectionAddr, event.TokenID))
+	}
+	// owner 变化后集合和 item 的 API 缓存失效
+	if err := apicache.Publish(s.kv, tags...); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on publish cache invalidate message", zap.Error(err))
+	}
+}
+
+// markTransferApplied 记录转移已应用，返回该转移之前是否已经应用过
+func (s *Service) markTransferApplied(tx *gorm.DB, transfer *nftchainservice.TransferLog) (bool, error) {
+	result := tx.WithContext(s.ctx).Table(base.IndexedTransferTableName()).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(newIndexedTransfer(s.chainId, transfer))
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on mark transfer applied")
+	}
+	return result.RowsAffected == 0, nil
+}
+
+// deadLetterTransfer 把无法应用的转移写入死信表，同一条日志只记录一次
+func (s *Service) deadLetterTransfer(tx *gorm.DB, transfer *nftchainservice.TransferLog) error {
+	xzap.WithContext(s.ctx).Error("transfer amount overflows int64, move to dead letter",
+		zap.String("tx_hash", transfer.TransactionHash), zap.Uint("log_index", transfer.Index),
+		zap.String("collection_address", transfer.Address), zap.String("token_id", transfer.TokenID),
+		zap.String("amount", transfer.OverflowAmount))
+
+	rawLog, err := json.Marshal(transfer)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal transfer")
+	}
+	if err := tx.WithContext(s.ctx).Table(base.IndexedDeadLetterTableName()).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(&base.IndexedDeadLetter{
+		ChainId:     int(s.chainId),
+		IndexType:   comm.TransferIndexType,
+		BlockNumber: int64(transfer.BlockNumber),
+		BlockHash:   transfer.BlockHash,
+		TxHash:      transfer.TransactionHash,
+		LogIndex:    int64(transfer.Index),
+		Topic:       transfer.Topic0,
+		RawLog:      string(rawLog),
+		Error:       fmt.Sprintf("transfer amount %s of token %s (batch index %d) overflows int64", transfer.OverflowAmount, transfer.TokenID, transfer.BatchIndex),
+		Attempts:    1,
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on create transfer dead letter")
+	}
+	return nil
+}
+
+// findForkPoint 检查 nextBlock 之前最后一个已同步的区块是否仍在链上。
+// 如果区块哈希不一致，则按区块号倒序查找链上哈希与本地记录一致的区块（分叉点）。
+// 返回值:
+// - uint64: 分叉点区块号，仅在 reorged 为 true 时有效
+// - bool: 是否发生了重组
+// - error: 查询失败或重组深度超过保留的区块
+func (s *Service) findForkPoint(nextBlock uint64) (uint64, bool, error) {
+	if nextBlock == 0 {
+		return 0, false, nil
+	}
+
+	var blocks []base.IndexedBlock
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedBlockTableName()).
+		Where("chain_id = ? and index_type = ? and block_number < ?", s.chainId, comm.TransferIndexType, nextBlock).
+		Order("block_number desc").Find(&blocks).Error; err != nil {
+		return 0, false, errors.Wrap(err, "failed on get indexed blocks")
+	}
+	// 没有本地记录（首次同步或记录已被清理），无法校验
+	if len(blocks) == 0 {
+		return 0, false, nil
+	}
+
+	for i, block := range blocks {
+		header, err := s.chainClient.HeaderByNumber(s.ctx, big.NewInt(block.BlockNumber))
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "failed on get header %d", block.BlockNumber)
+		}
+		if header.Hash == block.BlockHash {
+			// 最后一个已同步的区块仍在链上，没有重组
+			return uint64(block.BlockNumber), i > 0, nil
+		}
+	}
+
+	return 0, false, errors.Errorf("transfer reorg deeper than %d blocks at block %d", RetainBlocks, nextBlock)
+}
+
+// rollbackTo 撤销分叉点之后的转移，并把同步进度回退到分叉点的下一个区块，事务提交后通知订单管理器反向的转移
+func (s *Service) rollbackTo(forkPoint uint64) error {
+	var events []*ordermanager.TradeEvent
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		events, err = s.revertTransfers(tx, forkPoint)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	s.notifyTransfers(events)
+	return nil
+}
+
+// revertTransfers 在事务中按应用顺序倒序撤销分叉点之后的转移：反向应用 owner 和持有数量的变化，删除对应的活动，
+// 删除转移记录、死信和区块哈希，并回退同步进度。返回需要在事务提交后发送给订单管理器的事件
+func (s *Service) revertTransfers(tx *gorm.DB, forkPoint uint64) ([]*ordermanager.TradeEvent, error) {
+	var transfers []*base.IndexedTransfer
+	if err := tx.Table(base.IndexedTransferTableName()).
+		Where("chain_id = ? and block_number > ?", s.chainId, forkPoint).
+		Order("block_number desc, log_index desc, batch_index desc").
+		Find(&transfers).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get indexed transfers")
+	}
+
+	var events []*ordermanager.TradeEvent
+	for _, indexed := range transfers {
+		transfer := indexedTransferLog(indexed)
+		_, activity, _ := newTransferRecords(s.chainId, transfer)
+		if err := tx.Table(multi.ActivityTableName(s.chain)).
+			Where("tx_hash = ? and collection_address = ? and token_id = ? and activity_type = ?",
+				activity.TxHash, activity.CollectionAddress, activity.TokenId, activity.ActivityType).
+			Delete(&multi.Activity{}).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on delete transfer activity")
+		}
+
+		// 反向的转移把 token 从接收方转回转出方
+		transfer.From, transfer.To = transfer.To, transfer.From
+		event, err := s.applyTransferState(tx, transfer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed on revert transfer %s:%d", indexed.TxHash, indexed.LogIndex)
+		}
+		events = append(events, event)
+	}
+
+	if err := tx.Table(base.IndexedTransferTableName()).
+		Where("chain_id = ? and block_number > ?", s.chainId, forkPoint).
+		Delete(&base.IndexedTransfer{}).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on delete indexed transfers")
+	}
+	if err := tx.Table(base.IndexedDeadLetterTableName()).
+		Where("chain_id = ? and index_type = ? and block_number > ?", s.chainId, comm.TransferIndexType, forkPoint).
+		Delete(&base.IndexedDeadLetter{}).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on delete transfer dead letters")
+	}
+	if err := tx.Table(base.IndexedBlockTableName()).
+		Where("chain_id = ? and index_type = ? and block_number > ?", s.chainId, comm.TransferIndexType, forkPoint).
+		Delete(&base.IndexedBlock{}).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on delete indexed blocks")
+	}
+	if err := tx.Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, comm.TransferIndexType).
+		Update("last_indexed_block", forkPoint+1).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on rollback transfer event sync block number")
+	}
+	return events, nil
+}
+
+// applyTransfer 在事务中应用一条 Transfer 事件：更新 item 的 owner 或持有数量，并记录 Mint/Transfer 活动。
+// 返回需要在事务提交后发送给订单管理器的事件。
+func (s *Service) applyTransfer(tx *gorm.DB, transfer *nftchainservice.TransferLog) (*ordermanager.TradeEvent, error) {
+	event, err := s.applyTransferState(tx, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	// 活动表有 (tx_hash, collection_address, token_id, activity_type) 唯一索引，重复同步时忽略
+	_, activity, _ := newTransferRecords(s.chainId, transfer)
+	if err := tx.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(activity).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on create transfer activity")
+	}
+
+	return event, nil
+}
+
+// applyTransferState 在事务中应用转移带来的 owner 变化。
+// ERC-1155 的转移累计到 ob_item_balance_* 的持有数量，item 只累计 mint 和销毁带来的发行量变化。
+// 链重组时以反向的转移调用，撤销原来的变化。
+func (s *Service) applyTransferState(tx *gorm.DB, transfer *nftchainservice.TransferLog) (*ordermanager.TradeEvent, error) {
+	item, _, event := newTransferRecords(s.chainId, transfer)
+
+	if transfer.IsERC1155 {
+		if err := tx.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "supply"}, Value: gorm.Expr("supply + VALUES(supply)")},
+				{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+			},
+		}).Create(item).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on upsert item supply")
+		}
+		if balances := newBalanceRecords(transfer); len(balances) > 0 {
+			if err := tx.WithContext(s.ctx).Table(multi.ItemBalanceTableName(s.chain)).Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}, {Name: "owner"}},
+				DoUpdates: clause.Set{
+					{Column: clause.Column{Name: "balance"}, Value: gorm.Expr("balance + VALUES(balance)")},
+					{Column: clause.Column{Name: "update_time"}, Value: time.Now().UnixMilli()},
+				},
+			}).Create(&balances).Error; err != nil {
+				return nil, errors.Wrap(err, "failed on upsert item balance")
+			}
+		}
+	} else if err := tx.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+		// item 不存在时创建，已存在时只更新 owner
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"owner", "update_time"}),
+	}).Create(item).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on upsert item owner")
+	}
+
+	return event, nil
+}
+
+// newIndexedTransfer 根据 Transfer 事件构建已应用转移的记录
+func newIndexedTransfer(chainId int64, transfer *nftchainservice.TransferLog) *base.IndexedTransfer {
+	return &base.IndexedTransfer{
+		ChainId:           int(chainId),
+		BlockNumber:       int64(transfer.BlockNumber),
+		TxHash:            transfer.TransactionHash,
+		LogIndex:          int64(transfer.Index),
+		BatchIndex:        transfer.BatchIndex,
+		CollectionAddress: strings.ToLower(transfer.Address),
+		TokenId:           transfer.TokenID,
+		FromAddress:       strings.ToLower(transfer.From),
+		ToAddress:         strings.ToLower(transfer.To),
+		Amount:            transfer.Amount,
+		IsErc1155:         transfer.IsERC1155,
+	}
+}
+
+// indexedTransferLog 把已应用转移的记录还原为 Transfer 事件
+func indexedTransferLog(indexed *base.IndexedTransfer) *nftchainservice.TransferLog {
+	return &nftchainservice.TransferLog{
+		Address:         indexed.CollectionAddress,
+		TransactionHash: indexed.TxHash,
+		BlockNumber:     uint64(indexed.BlockNumber),
+		From:            indexed.FromAddress,
+		To:              indexed.ToAddress,
+		TokenID:         indexed.TokenId,
+		Amount:          indexed.Amount,
+		IsERC1155:       indexed.IsErc1155,
+		BatchIndex:      indexed.BatchIndex,
+		Index:           uint(indexed.LogIndex),
+	}
+}
+
+// newTransferRecords 根据 Transfer 事件构建 item、活动和订单管理器事件。
+// from 为零地址时是 Mint，to 为零地址时是销毁（owner 置为零地址）。
+// ERC-1155 的 item 不记录 owner，Supply 是这次转移带来的发行量变化：mint 增加，销毁减少。
+func newTransferRecords(chainId int64, transfer *nftchainservice.TransferLog) (*multi.Item, *multi.Activity, *ordermanager.TradeEvent) {
+	from := strings.ToLower(transfer.From)
+	to := strings.ToLower(transfer.To)
+	collection := strings.ToLower(transfer.Address)
+
+	activityType := multi.Transfer
+	var creator string
+	if from == ZeroAddress {
+		activityType = multi.Mint
+		creator = to
+	}
+
+	item := &multi.Item{
+		ChainId:           int(chainId),
+		CollectionAddress: collection,
+		TokenId:           transfer.TokenID,
+		Owner:             to,
+		Creator:           creator,
+		Supply:            1,
+	}
+	if transfer.IsERC1155 {
+		item.Owner = ""
+		item.Supply = 0
+		if from == ZeroAddress {
+			item.Supply += transfer.Amount
+		}
+		if to == ZeroAddress {
+			item.Supply -= transfer.Amount
+		}
+	}
+	activity := &multi.Activity{
+		ActivityType:      activityType,
+		Maker:             from,
+		Taker:             to,
+		MarketplaceID:     multi.MarketOrderBook,
+		CollectionAddress: collection,
+		TokenId:           transfer.TokenID,
+		Price:             decimal.Zero,
+		BlockNumber:       int64(transfer.BlockNumber),
+		TxHash:            transfer.TransactionHash,
+		EventTime:         int64(transfer.BlockTime),
+	}
+	event := &ordermanager.TradeEvent{
+		EventType:      ordermanager.Transfer,
+		CollectionAddr: collection,
+		TokenID:        transfer.TokenID,
+		From:           from,
+		To:             to,
+		TxHash:         transfer.TransactionHash,
+	}
+	return item, activity, event
+}
+
+// newBalanceRecords 根据 ERC-1155 转移构建持有数量的变化：转出方减少，接收方增加，零地址不记录
+func newBalanceRecords(transfer *nftchainservice.TransferLog) []multi.ItemBalance {
+	from := strings.ToLower(transfer.From)
+	to := strings.ToLower(transfer.To)
+	if from == to || transfer.Amount == 0 {
+		return nil
+	}
+
+	collection := strings.ToLower(transfer.Address)
+	var balances []multi.ItemBalance
+	if from != ZeroAddress {
+		balances = append(balances, multi.ItemBalance{
+			CollectionAddress: collection,
+			TokenId:           transfer.TokenID,
+			Owner:             from,
+			Balance:           -transfer.Amount,
+		})
+	}
+	if to != ZeroAddress {
+		balances = append(balances, multi.ItemBalance{
+			CollectionAddress: collection,
+			TokenId:           transfer.TokenID,
+			Owner:             to,
+			Balance:           transfer.Amount,
+		})
+	}
+	return balances
+}
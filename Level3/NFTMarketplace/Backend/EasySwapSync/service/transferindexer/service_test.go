@@ -0,0 +1,256 @@
+package transferindexer
+
+import (
+	"context"
+	"math/big"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+func TestNewTransferRecords(t *testing.T) {
+	mint := &nftchainservice.TransferLog{
+		Address:         "0xE7f1725E7734CE288F8367e1Bb143E90bb3F0512",
+		TransactionHash: "0x01",
+		BlockNumber:     100,
+		BlockTime:       1700000000,
+		From:            ZeroAddress,
+		To:              "0xF39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+		TokenID:         "7",
+	}
+	item, activity, event := newTransferRecords(11155111, mint)
+	if activity.ActivityType != multi.Mint {
+		t.Fatalf("expected mint activity, got %d", activity.ActivityType)
+	}
+	if item.Owner != "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266" || item.Creator != item.Owner {
+		t.Fatalf("unexpected minted item owner %s creator %s", item.Owner, item.Creator)
+	}
+	if item.CollectionAddress != "0xe7f1725e7734ce288f8367e1bb143e90bb3f0512" || item.TokenId != "7" {
+		t.Fatalf("unexpected item %s/%s", item.CollectionAddress, item.TokenId)
+	}
+	if event.EventType != ordermanager.Transfer || event.To != item.Owner {
+		t.Fatalf("unexpected trade event %+v", event)
+	}
+
+	transfer := *mint
+	transfer.From = mint.To
+	transfer.To = "0x70997970C51812dc3A010C7d01b50e20d17dc79C"
+	item, activity, event = newTransferRecords(11155111, &transfer)
+	if activity.ActivityType != multi.Transfer {
+		t.Fatalf("expected transfer activity, got %d", activity.ActivityType)
+	}
+	if item.Creator != "" {
+		t.Fatalf("creator should only be set on mint, got %s", item.Creator)
+	}
+	if event.From != "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266" ||
+		event.To != "0x70997970c51812dc3a010c7d01b50e20d17dc79c" {
+		t.Fatalf("unexpected trade event %+v", event)
+	}
+}
+
+func TestNewERC1155TransferRecords(t *testing.T) {
+	holder := "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"
+	mint := &nftchainservice.TransferLog{
+		Address:   "0xE7f1725E7734CE288F8367e1Bb143E90bb3F0512",
+		From:      ZeroAddress,
+		To:        "0xF39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+		TokenID:   "7",
+		Amount:    5,
+		IsERC1155: true,
+	}
+	item, activity, _ := newTransferRecords(11155111, mint)
+	if item.Owner != "" || item.Supply != 5 || item.Creator != holder || activity.ActivityType != multi.Mint {
+		t.Fatalf("unexpected minted erc1155 item %+v", item)
+	}
+	balances := newBalanceRecords(mint)
+	if len(balances) != 1 || balances[0].Owner != holder || balances[0].Balance != 5 {
+		t.Fatalf("unexpected mint balances %+v", balances)
+	}
+
+	transfer := *mint
+	transfer.From = mint.To
+	transfer.To = "0x70997970C51812dc3A010C7d01b50e20d17dc79C"
+	transfer.Amount = 2
+	item, _, _ = newTransferRecords(11155111, &transfer)
+	if item.Supply != 0 {
+		t.Fatalf("transfer should not change supply, got %d", item.Supply)
+	}
+	balances = newBalanceRecords(&transfer)
+	if len(balances) != 2 || balances[0].Owner != holder || balances[0].Balance != -2 ||
+		balances[1].Owner != "0x70997970c51812dc3a010c7d01b50e20d17dc79c" || balances[1].Balance != 2 {
+		t.Fatalf("unexpected transfer balances %+v", balances)
+	}
+
+	burn := transfer
+	burn.To = ZeroAddress
+	item, _, _ = newTransferRecords(11155111, &burn)
+	if item.Supply != -2 || len(newBalanceRecords(&burn)) != 1 {
+		t.Fatalf("burn should decrease supply and only the sender balance, got %+v", item)
+	}
+
+	self := transfer
+	self.To = self.From
+	if balances := newBalanceRecords(&self); len(balances) != 0 {
+		t.Fatalf("transfer to self should not change balances, got %+v", balances)
+	}
+}
+
+// fakeChainClient 按区块号返回固定的区块哈希
+type fakeChainClient struct {
+	head   uint64
+	hashes map[uint64]string
+}
+
+func (c *fakeChainClient) BlockNumber() (uint64, error) {
+	return c.head, nil
+}
+
+func (c *fakeChainClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: number.Uint64(), Hash: c.hashes[number.Uint64()]}, nil
+}
+
+// newMockDB 创建基于 sqlmock 的 gorm 连接，语句按正则匹配，单条写入不开启默认事务
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func TestFindForkPoint(t *testing.T) {
+	blockRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"block_number", "block_hash"}).
+			AddRow(120, "0x120").AddRow(110, "0x110").AddRow(100, "0x100")
+	}
+	selectBlocks := regexp.QuoteMeta("SELECT * FROM `ob_indexed_block` WHERE chain_id = ? and index_type = ? and block_number < ? ORDER BY block_number desc")
+
+	for _, tc := range []struct {
+		name      string
+		hashes    map[uint64]string
+		forkPoint uint64
+		reorged   bool
+		wantErr   bool
+	}{
+		{name: "no reorg", hashes: map[uint64]string{120: "0x120"}, forkPoint: 120},
+		// 确认数内没有避免的重组，区块 120 和 110 已不在链上
+		{name: "reorg", hashes: map[uint64]string{120: "0x120b", 110: "0x110b", 100: "0x100"}, forkPoint: 100, reorged: true},
+		{name: "too deep", hashes: map[uint64]string{}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectQuery(selectBlocks).WithArgs(11155111, comm.TransferIndexType, 121).WillReturnRows(blockRows())
+			s := &Service{ctx: context.Background(), db: db, chainClient: &fakeChainClient{hashes: tc.hashes}, chainId: 11155111, chain: "sepolia"}
+
+			forkPoint, reorged, err := s.findForkPoint(121)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected reorg deeper than retained blocks to fail")
+				}
+				return
+			}
+			if err != nil || reorged != tc.reorged || (reorged && forkPoint != tc.forkPoint) {
+				t.Fatalf("unexpected fork point %d reorged %v err %v", forkPoint, reorged, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// 没有已同步区块的记录时无法校验，视为没有重组
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(selectBlocks).WillReturnRows(sqlmock.NewRows([]string{"block_number", "block_hash"}))
+	s := &Service{ctx: context.Background(), db: db, chainClient: &fakeChainClient{}, chainId: 11155111, chain: "sepolia"}
+	if _, reorged, err := s.findForkPoint(121); err != nil || reorged {
+		t.Fatalf("expected no reorg without indexed blocks, got %v %v", reorged, err)
+	}
+}
+
+func TestRevertTransfers(t *testing.T) {
+	db, mock := newMockDB(t)
+	s := &Service{ctx: context.Background(), db: db, chainId: 11155111, chain: "sepolia"}
+	from := "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"
+	to := "0x70997970c51812dc3a010c7d01b50e20d17dc79c"
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `ob_indexed_transfer` WHERE chain_id = ? and block_number > ? "+
+		"ORDER BY block_number desc, log_index desc, batch_index desc")).
+		WithArgs(11155111, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"block_number", "tx_hash", "log_index", "batch_index", "collection_address",
+			"token_id", "from_address", "to_address", "amount", "is_erc1155"}).
+			AddRow(110, "0x02", 3, 1, "0xc1", "7", from, to, 2, true).
+			AddRow(105, "0x01", 1, 0, "0xc2", "9", from, to, 1, false))
+
+	// ERC-1155：删除活动，持有数量和发行量反向累加，转出方加回、接收方减去
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `ob_activity_sepolia` WHERE tx_hash = ? and collection_address = ? and token_id = ? and activity_type = ?")).
+		WithArgs("0x02", "0xc1", "7", multi.Transfer).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `ob_item_sepolia` .* ON DUPLICATE KEY UPDATE `supply`=supply \\+ VALUES\\(supply\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `ob_item_balance_sepolia` .* ON DUPLICATE KEY UPDATE `balance`=balance \\+ VALUES\\(balance\\)").
+		WithArgs("0xc1", "7", to, int64(-2), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"0xc1", "7", from, int64(2), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	// ERC-721：删除活动，owner 恢复为转出方
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `ob_activity_sepolia`")).
+		WithArgs("0x01", "0xc2", "9", multi.Transfer).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `ob_item_sepolia` .* ON DUPLICATE KEY UPDATE `owner`=VALUES\\(`owner`\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `ob_indexed_transfer` WHERE chain_id = ? and block_number > ?")).
+		WithArgs(11155111, 100).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `ob_indexed_dead_letter` WHERE chain_id = ? and index_type = ? and block_number > ?")).
+		WithArgs(11155111, comm.TransferIndexType, 100).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `ob_indexed_block` WHERE chain_id = ? and index_type = ? and block_number > ?")).
+		WithArgs(11155111, comm.TransferIndexType, 100).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `ob_indexed_status` SET `last_indexed_block`=?")).
+		WithArgs(101, 11155111, comm.TransferIndexType).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	events, err := s.revertTransfers(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	// 订单管理器收到反向的转移，按转回后的 owner 刷新挂单
+	if len(events) != 2 || events[0].From != to || events[0].To != from || events[1].TokenID != "9" || events[1].To != from {
+		t.Fatalf("unexpected revert events %+v", events)
+	}
+}
+
+func TestDeadLetterTransfer(t *testing.T) {
+	db, mock := newMockDB(t)
+	s := &Service{ctx: xzap.ToContext(context.Background(), zap.NewNop()), db: db, chainId: 11155111, chain: "sepolia"}
+	transfer := &nftchainservice.TransferLog{Address: "0xc1", TransactionHash: "0x03", BlockNumber: 120, BlockHash: "0xb1",
+		Topic0: nftchainservice.EVMTransferBatchTopic.String(), TokenID: "7", OverflowAmount: "18446744073709551616",
+		IsERC1155: true, BatchIndex: 1, Index: 5}
+
+	// 同一条日志重复写入时忽略，区间重试保持幂等
+	mock.ExpectExec("INSERT INTO `ob_indexed_dead_letter` .* ON DUPLICATE KEY UPDATE `id`=`id`").
+		WithArgs(11155111, comm.TransferIndexType, 120, "0xb1", "0x03", 5, transfer.Topic0, sqlmock.AnyArg(),
+			"transfer amount 18446744073709551616 of token 7 (batch index 1) overflows int64", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := s.deadLetterTransfer(db, transfer); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}